@@ -1610,6 +1610,52 @@ func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object,
 	return f.NewObject(ctx, remote)
 }
 
+// maxPutURLSize is the largest blob which can be uploaded from a URL
+// in one go
+const maxPutURLSize = 5000 * 1024 * 1024
+
+// PutURL uploads the object described by src having Azure read the
+// data from url rather than sending it through rclone
+//
+// If it isn't possible then return fs.ErrorCantCopy
+func (f *Fs) PutURL(ctx context.Context, url string, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	size := src.Size()
+	if size < 0 || size > maxPutURLSize {
+		fs.Debugf(src, "Can't upload from URL - size %d must be known and at most %d", size, maxPutURLSize)
+		return nil, fs.ErrorCantCopy
+	}
+	o := &Object{
+		fs:     f,
+		remote: src.Remote(),
+	}
+	ui, err := o.prepareUpload(ctx, src, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare upload: %w", err)
+	}
+	opt := blockblob.UploadBlobFromURLOptions{
+		Metadata:    o.getMetadata(),
+		Tier:        parseTier(f.opt.AccessTier),
+		HTTPHeaders: &ui.httpHeaders,
+	}
+	err = f.pacer.Call(func() (bool, error) {
+		_, err := ui.blb.UploadBlobFromURL(ctx, url, &opt)
+		return f.shouldRetry(ctx, err)
+	})
+	if bloberror.HasCode(err, bloberror.CannotVerifyCopySource) {
+		fs.Debugf(o, "Can't upload from URL - Azure couldn't read it: %v", err)
+		return nil, fs.ErrorCantCopy
+	}
+	if err != nil {
+		return nil, err
+	}
+	o.clearMetaData()
+	err = o.readMetaData(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
 // ------------------------------------------------------------
 
 // Fs returns the parent Fs
@@ -2221,6 +2267,10 @@ func (o *Object) uploadSinglepart(ctx context.Context, in io.Reader, size int64,
 
 	rw := multipart.NewRW()
 	defer fs.CheckClose(rw, &err)
+	err = rw.Reserve(ctx, size)
+	if err != nil {
+		return fmt.Errorf("single part upload: failed to get memory: %w", err)
+	}
 
 	n, err := io.CopyN(rw, in, size+1)
 	if err != nil && err != io.EOF {
@@ -2448,6 +2498,7 @@ var (
 	_ fs.Fs              = &Fs{}
 	_ fs.Copier          = &Fs{}
 	_ fs.PutStreamer     = &Fs{}
+	_ fs.PutURLer        = &Fs{}
 	_ fs.Purger          = &Fs{}
 	_ fs.ListRer         = &Fs{}
 	_ fs.OpenChunkWriter = &Fs{}
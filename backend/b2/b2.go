@@ -163,6 +163,19 @@ Note that chunks are stored in memory and there may be up to
 in memory.`,
 			Default:  4,
 			Advanced: true,
+		}, {
+			Name: "finish_concurrency",
+			Help: `Maximum number of large file API calls to make at once.
+
+When many large files are uploaded at once they all fetch the URLs to
+upload their parts to and finish at about the same time. A burst of
+these calls can trip the rate limits of B2, so rclone only makes this
+many of the calls to get part upload URLs and to finish large files at
+once and the rest wait their turn.
+
+Set to 0 for no limit.`,
+			Default:  4,
+			Advanced: true,
 		}, {
 			Name: "disable_checksum",
 			Help: `Disable checksums for large (> upload cutoff) files.
@@ -267,6 +280,7 @@ type Options struct {
 	CopyCutoff                    fs.SizeSuffix        `config:"copy_cutoff"`
 	ChunkSize                     fs.SizeSuffix        `config:"chunk_size"`
 	UploadConcurrency             int                  `config:"upload_concurrency"`
+	FinishConcurrency             int                  `config:"finish_concurrency"`
 	DisableCheckSum               bool                 `config:"disable_checksum"`
 	DownloadURL                   string               `config:"download_url"`
 	DownloadAuthorizationDuration fs.Duration          `config:"download_auth_duration"`
@@ -295,6 +309,7 @@ type Fs struct {
 	authMu          sync.Mutex                             // lock for authorizing the account
 	pacer           *fs.Pacer                              // To pace and retry the API calls
 	uploadToken     *pacer.TokenDispenser                  // control concurrency
+	finishToken     *pacer.TokenDispenser                  // limits the large file API calls at once - nil for no limit
 }
 
 // Object describes a b2 object
@@ -515,6 +530,9 @@ func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, e
 		pacer:       fs.NewPacer(ctx, pacer.NewDefault(pacer.MinSleep(minSleep), pacer.MaxSleep(maxSleep), pacer.DecayConstant(decayConstant))),
 		uploadToken: pacer.NewTokenDispenser(ci.Transfers),
 	}
+	if opt.FinishConcurrency > 0 {
+		f.finishToken = pacer.NewTokenDispenser(opt.FinishConcurrency)
+	}
 	f.setRoot(root)
 	f.features = (&fs.Features{
 		ReadMimeType:          true,
@@ -1948,6 +1966,11 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 	if size < 0 {
 		// Check if the file is large enough for a chunked upload (needs to be at least two chunks)
 		rw := o.fs.getRW(false)
+		err := rw.Reserve(ctx, int64(o.fs.opt.ChunkSize))
+		if err != nil {
+			o.fs.putRW(rw)
+			return fmt.Errorf("failed to get memory for upload: %w", err)
+		}
 
 		n, err := io.CopyN(rw, in, int64(o.fs.opt.ChunkSize))
 		if err == nil {
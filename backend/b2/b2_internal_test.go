@@ -1,11 +1,20 @@
 package b2
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fstest"
 	"github.com/rclone/rclone/fstest/fstests"
+	"github.com/rclone/rclone/lib/pacer"
+	"github.com/rclone/rclone/lib/rest"
+	"github.com/stretchr/testify/assert"
 )
 
 // Test b2 string encoding
@@ -170,6 +179,85 @@ func TestParseTimeString(t *testing.T) {
 
 }
 
+func TestFinishConcurrency(t *testing.T) {
+	ctx := context.Background()
+	// Count the calls in progress at once, making each take a while
+	// so they overlap if they aren't limited
+	var (
+		mu       sync.Mutex
+		inFlight int
+		maxIn    int
+		calls    = map[string]int{}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls[r.URL.Path]++
+		inFlight++
+		if inFlight > maxIn {
+			maxIn = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		_, _ = fmt.Fprint(w, `{"fileId":"id"}`)
+	}))
+	defer srv.Close()
+
+	for _, test := range []struct {
+		concurrency int
+		wantMax     int
+	}{
+		{concurrency: 2, wantMax: 2},
+		{concurrency: 1, wantMax: 1},
+		{concurrency: 0, wantMax: 16},
+	} {
+		t.Run(fmt.Sprint(test.concurrency), func(t *testing.T) {
+			f := &Fs{
+				name:  "b2",
+				opt:   Options{FinishConcurrency: test.concurrency},
+				srv:   rest.NewClient(http.DefaultClient).SetRoot(srv.URL).SetErrorHandler(errorHandler),
+				pacer: fs.NewPacer(ctx, pacer.NewDefault(pacer.MinSleep(time.Millisecond))),
+			}
+			if test.concurrency > 0 {
+				f.finishToken = pacer.NewTokenDispenser(test.concurrency)
+			}
+			mu.Lock()
+			maxIn = 0
+			calls = map[string]int{}
+			mu.Unlock()
+
+			// Fetch part URLs and finish large files all at once
+			var wg sync.WaitGroup
+			start := make(chan struct{})
+			for i := 0; i < 8; i++ {
+				up := &largeUpload{f: f, o: &Object{fs: f, remote: fmt.Sprintf("file%d", i)}, id: "id"}
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+					<-start
+					_, err := up.getUploadURL(ctx)
+					assert.NoError(t, err)
+				}()
+				go func() {
+					defer wg.Done()
+					<-start
+					assert.NoError(t, up.Close(ctx))
+				}()
+			}
+			close(start)
+			wg.Wait()
+
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, map[string]int{"/b2_get_upload_part_url": 8, "/b2_finish_large_file": 8}, calls)
+			assert.LessOrEqual(t, maxIn, test.wantMax)
+			assert.Greater(t, maxIn, 0)
+		})
+	}
+}
+
 // -run TestIntegration/FsMkdir/FsPutFiles/Internal
 func (f *Fs) InternalTest(t *testing.T) {
 	// Internal tests go here
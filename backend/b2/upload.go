@@ -20,6 +20,7 @@ import (
 	"github.com/rclone/rclone/fs/chunksize"
 	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/lib/atexit"
+	"github.com/rclone/rclone/lib/multipart"
 	"github.com/rclone/rclone/lib/pool"
 	"github.com/rclone/rclone/lib/rest"
 	"golang.org/x/sync/errgroup"
@@ -164,6 +165,23 @@ func (f *Fs) newLargeUpload(ctx context.Context, o *Object, in io.Reader, src fs
 	return up, nil
 }
 
+// getFinishToken waits until another call to get a part upload URL
+// or finish a large file is allowed if finish_concurrency is set.
+//
+// This should be returned with putFinishToken when finished
+func (f *Fs) getFinishToken() {
+	if f.finishToken != nil {
+		f.finishToken.Get()
+	}
+}
+
+// putFinishToken returns the token from getFinishToken
+func (f *Fs) putFinishToken() {
+	if f.finishToken != nil {
+		f.finishToken.Put()
+	}
+}
+
 // getUploadURL returns the upload info with the UploadURL and the AuthorizationToken
 //
 // This should be returned with returnUploadURL when finished
@@ -183,10 +201,12 @@ func (up *largeUpload) getUploadURL(ctx context.Context) (upload *api.GetUploadP
 	var request = api.GetUploadPartURLRequest{
 		ID: up.id,
 	}
+	up.f.getFinishToken()
 	err = up.f.pacer.Call(func() (bool, error) {
 		resp, err := up.f.srv.CallJSON(ctx, &opts, &request, &upload)
 		return up.f.shouldRetry(ctx, resp, err)
 	})
+	up.f.putFinishToken()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get upload URL: %w", err)
 	}
@@ -348,10 +368,12 @@ func (up *largeUpload) Close(ctx context.Context) error {
 		SHA1s: up.sha1s,
 	}
 	var response api.FileInfo
+	up.f.getFinishToken()
 	err := up.f.pacer.Call(func() (bool, error) {
 		resp, err := up.f.srv.CallJSON(ctx, &opts, &request, &response)
 		return up.f.shouldRetry(ctx, resp, err)
 	})
+	up.f.putFinishToken()
 	if err != nil {
 		return err
 	}
@@ -415,6 +437,11 @@ func (up *largeUpload) Stream(ctx context.Context, initialUploadBlock *pool.RW)
 		if part == 0 {
 			n = rw.Size()
 		} else {
+			err = rw.Reserve(gCtx, up.chunkSize)
+			if err != nil {
+				up.f.putRW(rw)
+				return fmt.Errorf("failed to get memory for chunk: %w", err)
+			}
 			n, err = io.CopyN(rw, up.in, up.chunkSize)
 			if err == io.EOF {
 				if n == 0 {
@@ -443,7 +470,7 @@ func (up *largeUpload) Stream(ctx context.Context, initialUploadBlock *pool.RW)
 		part := part // for the closure
 		g.Go(func() (err error) {
 			defer up.f.putRW(rw)
-			_, err = up.WriteChunk(gCtx, part, rw)
+			_, err = multipart.WriteChunk(gCtx, up.o, up, part, rw)
 			return err
 		})
 	}
@@ -0,0 +1,400 @@
+// Package cas implements a backend which stores files on another
+// remote named by the hash of their contents.
+package cas
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fs/operations"
+)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "cas",
+		Description: "Content addressable store on a remote",
+		NewFs:       NewFs,
+		Options: []fs.Option{{
+			Name: "remote",
+			Help: `Remote to store the files in.
+
+Normally should contain a ':' and a path, e.g. "myremote:path/to/dir",
+"myremote:bucket" or maybe "myremote:" (not recommended).`,
+			Required: true,
+		}, {
+			Name: "hash_type",
+			Help: `Hash to name the files by.
+
+Changing this means the files stored before can't be found.`,
+			Default: "sha256",
+			Examples: []fs.OptionExample{{
+				Value: "md5",
+				Help:  "MD5",
+			}, {
+				Value: "sha1",
+				Help:  "SHA-1",
+			}, {
+				Value: "sha256",
+				Help:  "SHA-256",
+			}},
+			Advanced: true,
+		}, {
+			Name: "prefix_length",
+			Help: `Number of characters of the hash to name the directory of each file by.
+
+Files are stored in directories named by the start of their hash so
+no single directory gets too big. Set to 0 to store all the files in
+one directory.
+
+Changing this means the files stored before can't be found.`,
+			Default:  2,
+			Advanced: true,
+		}},
+	})
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	Remote       string `config:"remote"`
+	HashType     string `config:"hash_type"`
+	PrefixLength int    `config:"prefix_length"`
+}
+
+// Fs represents a content addressable store on a remote
+type Fs struct {
+	name     string       // name of this remote
+	opt      Options      // options for this Fs
+	features *fs.Features // optional features
+	base     fs.Fs        // the remote the files are stored on
+	ht       hash.Type    // the hash the files are named by
+}
+
+// NewFs constructs an Fs from the path.
+//
+// The path must be empty or the hash of a file stored already.
+func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, error) {
+	// Parse config into Options struct
+	opt := new(Options)
+	err := configstruct.Set(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	if opt.Remote == "" {
+		return nil, errors.New("cas can't point to an empty remote - check the value of the remote setting")
+	}
+	if strings.HasPrefix(opt.Remote, name+":") {
+		return nil, errors.New("can't point cas remote at itself - check the value of the remote setting")
+	}
+	var ht hash.Type
+	if err := ht.Set(opt.HashType); err != nil || ht == hash.None {
+		return nil, fmt.Errorf("unknown hash_type %q", opt.HashType)
+	}
+	if opt.PrefixLength < 0 || opt.PrefixLength >= hash.Width(ht, false) {
+		return nil, fmt.Errorf("prefix_length must be between 0 and %d", hash.Width(ht, false)-1)
+	}
+	base, err := cache.Get(ctx, opt.Remote)
+	if err != nil && err != fs.ErrorIsFile {
+		return nil, fmt.Errorf("failed to make remote %q to store the files in: %w", opt.Remote, err)
+	}
+	f := &Fs{
+		name: name,
+		opt:  *opt,
+		base: base,
+		ht:   ht,
+	}
+	cache.PinUntilFinalized(f.base, f)
+
+	f.features = (&fs.Features{
+		CaseInsensitive:         false,
+		DuplicateFiles:          false,
+		CanHaveEmptyDirectories: false,
+		BucketBased:             true,
+	}).Fill(ctx, f).Mask(ctx, f.base)
+	// Files are spooled to find their hash so can be streamed to
+	// any remote
+	f.features.PutStream = f.PutStream
+
+	// The path can only be a file
+	root = strings.Trim(root, "/")
+	if root != "" {
+		if _, err := f.NewObject(ctx, root); err != nil {
+			return nil, fmt.Errorf("cas path must be empty or the hash of a stored file: %q: %w", root, err)
+		}
+		return f, fs.ErrorIsFile
+	}
+	return f, nil
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return ""
+}
+
+// String converts this Fs to a string
+func (f *Fs) String() string {
+	return fmt.Sprintf("cas of %s", f.base)
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// Precision of the ModTimes in this Fs
+func (f *Fs) Precision() time.Duration {
+	return f.base.Precision()
+}
+
+// Hashes returns the supported hash sets.
+//
+// The hash the files are named by is always supported.
+func (f *Fs) Hashes() hash.Set {
+	hashes := f.base.Hashes()
+	return hashes.Add(f.ht)
+}
+
+// isHash returns true if s is a hash of the type the files are
+// named by
+func (f *Fs) isHash(s string) bool {
+	if len(s) != hash.Width(f.ht, false) {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// key returns the path on the base remote of the file with hash sum
+func (f *Fs) key(sum string) string {
+	if f.opt.PrefixLength == 0 {
+		return sum
+	}
+	return path.Join(sum[:f.opt.PrefixLength], sum)
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// All the files are in the root, named by their hash, so this is
+// the only directory.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	if dir != "" {
+		return nil, fs.ErrorDirNotFound
+	}
+	baseEntries, err := f.base.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	// Read the prefix directories if in use
+	if f.opt.PrefixLength > 0 {
+		var files fs.DirEntries
+		for _, entry := range baseEntries {
+			if _, ok := entry.(fs.Directory); !ok {
+				continue
+			}
+			dirEntries, err := f.base.List(ctx, entry.Remote())
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, dirEntries...)
+		}
+		baseEntries = files
+	}
+	for _, entry := range baseEntries {
+		bo, ok := entry.(fs.Object)
+		if !ok {
+			continue
+		}
+		sum := path.Base(bo.Remote())
+		if !f.isHash(sum) || f.key(sum) != bo.Remote() {
+			fs.Debugf(bo, "Ignoring file which isn't named by its hash")
+			continue
+		}
+		entries = append(entries, f.newObject(sum, bo))
+	}
+	return entries, nil
+}
+
+// NewObject finds the Object with hash remote.  If it can't be found
+// it returns the error fs.ErrorObjectNotFound.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	if !f.isHash(remote) {
+		return nil, fs.ErrorObjectNotFound
+	}
+	bo, err := f.base.NewObject(ctx, f.key(remote))
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(remote, bo), nil
+}
+
+// spool copies in to a temporary file finding its hash and size.
+//
+// The file is returned positioned at the start and should be closed
+// and removed when finished with.
+func (f *Fs) spool(in io.Reader) (file *os.File, size int64, sum string, err error) {
+	file, err = os.CreateTemp("", "rclone-cas-")
+	if err != nil {
+		return nil, 0, "", fmt.Errorf("failed to create temporary local file to spool file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = file.Close()
+			_ = os.Remove(file.Name())
+		}
+	}()
+	hasher, err := hash.NewMultiHasherTypes(hash.NewHashSet(f.ht))
+	if err != nil {
+		return nil, 0, "", err
+	}
+	size, err = io.Copy(io.MultiWriter(file, hasher), in)
+	if err != nil {
+		return nil, 0, "", fmt.Errorf("failed to write temporary local file: %w", err)
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, "", err
+	}
+	sum, err = hasher.SumString(f.ht, false)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	return file, size, sum, nil
+}
+
+// put stores in under its hash unless a file with that hash is
+// stored already.
+//
+// The hash of src is used if it has one, otherwise in is spooled to
+// a temporary file to find it.
+//
+// If want is set then the contents must have that hash, otherwise an
+// error is returned without storing anything.
+func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, want string, options ...fs.OpenOption) (*Object, error) {
+	size := src.Size()
+	sum, _ := src.Hash(ctx, f.ht)
+	sum = strings.ToLower(sum)
+	if !f.isHash(sum) || size < 0 {
+		file, fileSize, fileSum, err := f.spool(in)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = file.Close()
+			_ = os.Remove(file.Name())
+		}()
+		if size >= 0 && size != fileSize {
+			return nil, fmt.Errorf("upload size mismatch: expecting %d but got %d", size, fileSize)
+		}
+		in, size, sum = file, fileSize, fileSum
+	}
+	if want != "" && sum != want {
+		return nil, fmt.Errorf("can't change the contents of %s - the new contents have %v %s", want, f.ht, sum)
+	}
+	info := object.NewStaticObjectInfo(f.key(sum), src.ModTime(ctx), size, true, map[hash.Type]string{f.ht: sum}, f.base)
+	bo, err := f.base.NewObject(ctx, f.key(sum))
+	switch {
+	case err == nil && bo.Size() == size:
+		fs.Debugf(bo, "Not storing as a file with the same hash is stored already")
+	case err == nil:
+		fs.Errorf(bo, "Replacing file with wrong size %d, expecting %d", bo.Size(), size)
+		err = bo.Update(ctx, in, info, options...)
+	case err == fs.ErrorObjectNotFound:
+		bo, err = f.base.Put(ctx, in, info, options...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to store file %s: %w", sum, err)
+	}
+	return f.newObject(sum, bo), nil
+}
+
+// Put in to the remote with the modTime given of the given size
+//
+// The file is stored named by its hash whatever the remote path of
+// src, so the Object returned has the hash as its remote. Nothing is
+// uploaded if a file with the same hash is stored already.
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	o, err := f.put(ctx, in, src, "", options...)
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// PutStream uploads to the remote path with the modTime given of indeterminate size
+func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.Put(ctx, in, src, options...)
+}
+
+// Mkdir makes the directory (container, bucket)
+//
+// Only the root exists so this makes the root on the remote and does
+// nothing for any other directory.
+func (f *Fs) Mkdir(ctx context.Context, dir string) error {
+	if dir != "" {
+		return nil
+	}
+	return f.base.Mkdir(ctx, "")
+}
+
+// Rmdir removes the directory (container, bucket) if empty
+//
+// Return an error if it doesn't exist or isn't empty
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	if dir != "" {
+		return fs.ErrorDirNotFound
+	}
+	entries, err := f.List(ctx, "")
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return fs.ErrorDirectoryNotEmpty
+	}
+	// Remove the empty prefix directories as well as the root
+	return operations.Rmdirs(ctx, f.base, "", false)
+}
+
+// About gets quota information from the remote
+func (f *Fs) About(ctx context.Context) (*fs.Usage, error) {
+	do := f.base.Features().About
+	if do == nil {
+		return nil, errors.New("not supported by underlying remote")
+	}
+	return do(ctx)
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs          = (*Fs)(nil)
+	_ fs.PutStreamer = (*Fs)(nil)
+	_ fs.Abouter     = (*Fs)(nil)
+)
@@ -0,0 +1,216 @@
+package cas
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// casConfig returns the config for a cas remote on dir with the
+// defaults overridden by config
+func casConfig(dir string, config configmap.Simple) configmap.Simple {
+	m := configmap.Simple{
+		"remote":        dir,
+		"hash_type":     "sha256",
+		"prefix_length": "2",
+	}
+	for k, v := range config {
+		m[k] = v
+	}
+	return m
+}
+
+// makeCas makes a cas remote on a temporary directory with the
+// config given returning it and the directory
+func makeCas(t *testing.T, config configmap.Simple) (*Fs, string) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	f, err := NewFs(ctx, "TestCasInternal", "", casConfig(dir, config))
+	require.NoError(t, err)
+	return f.(*Fs), dir
+}
+
+// storedFiles returns the paths of the files stored in dir
+func storedFiles(t *testing.T, dir string) (files []string) {
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(dir, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	require.NoError(t, err)
+	return files
+}
+
+// put uploads contents to f as remote with the hashes given
+func put(t *testing.T, f fs.Fs, remote string, contents string, hashes map[hash.Type]string) fs.Object {
+	ctx := context.Background()
+	src := object.NewStaticObjectInfo(remote, fstest.Time("2001-02-03T04:05:06Z"), int64(len(contents)), true, hashes, nil)
+	o, err := f.Put(ctx, strings.NewReader(contents), src)
+	require.NoError(t, err)
+	return o
+}
+
+// read reads the contents of remote on f
+func read(t *testing.T, f fs.Fs, remote string) string {
+	ctx := context.Background()
+	o, err := f.NewObject(ctx, remote)
+	require.NoError(t, err)
+	in, err := o.Open(ctx)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	return string(data)
+}
+
+// sha256sum returns the SHA-256 of s in hex
+func sha256sum(s string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(s)))
+}
+
+func TestCasPutTwice(t *testing.T) {
+	ctx := context.Background()
+	f, dir := makeCas(t, nil)
+	const contents = "hello world"
+	sum := sha256sum(contents)
+
+	// The file is stored under its hash whatever it is called
+	o := put(t, f, "file1.txt", contents, nil)
+	assert.Equal(t, sum, o.Remote())
+	assert.Equal(t, int64(len(contents)), o.Size())
+	assert.Equal(t, []string{sum[:2] + "/" + sum}, storedFiles(t, dir))
+
+	// Identical contents are only stored once
+	o = put(t, f, "dir/file2.txt", contents, nil)
+	assert.Equal(t, sum, o.Remote())
+	assert.Equal(t, []string{sum[:2] + "/" + sum}, storedFiles(t, dir))
+
+	// The hash of the source is used if it has one so the contents
+	// aren't read if they are stored already
+	src := object.NewStaticObjectInfo("file3.txt", fstest.Time("2001-02-03T04:05:06Z"), int64(len(contents)), true, map[hash.Type]string{hash.SHA256: sum}, nil)
+	o, err := f.Put(ctx, iotest.ErrReader(errors.New("shouldn't be read")), src)
+	require.NoError(t, err)
+	assert.Equal(t, sum, o.Remote())
+
+	// Files of unknown size are stored under their hash too
+	other := "other contents"
+	src = object.NewStaticObjectInfo("stream.txt", fstest.Time("2001-02-03T04:05:06Z"), -1, true, nil, nil)
+	o, err = f.Features().PutStream(ctx, strings.NewReader(other), src)
+	require.NoError(t, err)
+	assert.Equal(t, sha256sum(other), o.Remote())
+	assert.Equal(t, int64(len(other)), o.Size())
+	assert.Len(t, storedFiles(t, dir), 2)
+
+	// The files are listed and read by their hashes
+	entries, err := f.List(ctx, "")
+	require.NoError(t, err)
+	var remotes []string
+	for _, entry := range entries {
+		remotes = append(remotes, entry.Remote())
+	}
+	assert.ElementsMatch(t, []string{sum, sha256sum(other)}, remotes)
+	assert.Equal(t, contents, read(t, f, sum))
+	assert.Equal(t, other, read(t, f, sha256sum(other)))
+	hashSum, err := o.Hash(ctx, hash.SHA256)
+	require.NoError(t, err)
+	assert.Equal(t, sha256sum(other), hashSum)
+
+	// Anything else isn't found
+	_, err = f.NewObject(ctx, "file1.txt")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+	_, err = f.NewObject(ctx, sha256sum("missing"))
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+	_, err = f.List(ctx, "dir")
+	assert.Equal(t, fs.ErrorDirNotFound, err)
+
+	// A file can't be changed to different contents
+	o, err = f.NewObject(ctx, sum)
+	require.NoError(t, err)
+	changed := "changed contents"
+	src = object.NewStaticObjectInfo(sum, fstest.Time("2001-02-03T04:05:06Z"), int64(len(changed)), true, nil, nil)
+	err = o.Update(ctx, strings.NewReader(changed), src)
+	assert.ErrorContains(t, err, "can't change the contents")
+	assert.Equal(t, contents, read(t, f, sum))
+	assert.Len(t, storedFiles(t, dir), 2, "changed contents mustn't be stored")
+
+	// This is checked before reading if the source has a hash
+	src = object.NewStaticObjectInfo(sum, fstest.Time("2001-02-03T04:05:06Z"), int64(len(changed)), true, map[hash.Type]string{hash.SHA256: sha256sum(changed)}, nil)
+	err = o.Update(ctx, iotest.ErrReader(errors.New("shouldn't be read")), src)
+	assert.ErrorContains(t, err, "can't change the contents")
+	assert.Len(t, storedFiles(t, dir), 2)
+
+	// The root can only be removed when empty
+	assert.Equal(t, fs.ErrorDirectoryNotEmpty, f.Rmdir(ctx, ""))
+	for _, entry := range entries {
+		require.NoError(t, entry.(fs.Object).Remove(ctx))
+	}
+	require.NoError(t, f.Rmdir(ctx, ""))
+	_, err = os.Stat(dir)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestCasOptions(t *testing.T) {
+	const contents = "hello world"
+	sum := sha256sum(contents)
+
+	// All the files can be in one directory
+	f, dir := makeCas(t, configmap.Simple{"prefix_length": "0"})
+	assert.Equal(t, sum, put(t, f, "file", contents, nil).Remote())
+	assert.Equal(t, []string{sum}, storedFiles(t, dir))
+
+	// Other hashes can be used
+	f, dir = makeCas(t, configmap.Simple{"hash_type": "md5", "prefix_length": "3"})
+	md5sum := "5eb63bbbe01eeed093cb22bb8f5acdc3"
+	assert.Equal(t, md5sum, put(t, f, "file", contents, nil).Remote())
+	assert.Equal(t, []string{md5sum[:3] + "/" + md5sum}, storedFiles(t, dir))
+
+	// Bad options are errors
+	ctx := context.Background()
+	_, err := NewFs(ctx, "TestCasInternal", "", casConfig(dir, configmap.Simple{"hash_type": "potato"}))
+	assert.ErrorContains(t, err, "unknown hash_type")
+	_, err = NewFs(ctx, "TestCasInternal", "", casConfig(dir, configmap.Simple{"prefix_length": "64"}))
+	assert.ErrorContains(t, err, "prefix_length")
+}
+
+func TestCasNewFsFile(t *testing.T) {
+	ctx := context.Background()
+	f, dir := makeCas(t, nil)
+	const contents = "hello world"
+	sum := put(t, f, "file", contents, nil).Remote()
+
+	// A path which is the hash of a stored file is a file
+	fFile, err := NewFs(ctx, "TestCasInternal", sum, casConfig(dir, nil))
+	assert.Equal(t, fs.ErrorIsFile, err)
+	assert.Equal(t, contents, read(t, fFile, sum))
+
+	// Any other path is an error
+	_, err = NewFs(ctx, "TestCasInternal", "dir", casConfig(dir, nil))
+	assert.ErrorContains(t, err, "must be empty or the hash of a stored file")
+	_, err = NewFs(ctx, "TestCasInternal", sha256sum("missing"), casConfig(dir, nil))
+	assert.ErrorIs(t, err, fs.ErrorObjectNotFound)
+
+	// Listing a stored file by its hash finds it
+	entries, err := fFile.List(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, sum, entries[0].Remote())
+	assert.Equal(t, contents, read(t, fFile, entries[0].Remote()))
+}
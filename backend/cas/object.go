@@ -0,0 +1,111 @@
+package cas
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+)
+
+// Object describes a file in the content addressable store
+//
+// Its remote is the hash of its contents.
+type Object struct {
+	f   *Fs
+	sum string    // hash of the contents
+	bo  fs.Object // the file on the base remote
+}
+
+// newObject makes an Object with hash sum stored as bo
+func (f *Fs) newObject(sum string, bo fs.Object) *Object {
+	return &Object{
+		f:   f,
+		sum: sum,
+		bo:  bo,
+	}
+}
+
+// Fs returns the parent Fs
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// Return a string version
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.sum
+}
+
+// Remote returns the remote path which is the hash of the contents
+func (o *Object) Remote() string {
+	return o.sum
+}
+
+// Size returns the size of the file
+func (o *Object) Size() int64 {
+	return o.bo.Size()
+}
+
+// ModTime returns the modification time of the file
+func (o *Object) ModTime(ctx context.Context) time.Time {
+	return o.bo.ModTime(ctx)
+}
+
+// SetModTime sets the modification time of the file
+func (o *Object) SetModTime(ctx context.Context, modTime time.Time) error {
+	return o.bo.SetModTime(ctx, modTime)
+}
+
+// Storable returns a boolean indicating if this object is storable
+func (o *Object) Storable() bool {
+	return true
+}
+
+// Hash returns the selected checksum of the file
+//
+// The hash the file is named by is returned without asking the
+// remote.
+func (o *Object) Hash(ctx context.Context, ht hash.Type) (string, error) {
+	if ht == o.f.ht {
+		return o.sum, nil
+	}
+	return o.bo.Hash(ctx, ht)
+}
+
+// Open an object for read
+func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	return o.bo.Open(ctx, options...)
+}
+
+// Update the object with the contents of the io.Reader, modTime and size
+//
+// As files are named by their contents this can only store the same
+// contents again, for example to replace a damaged file.
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	newO, err := o.f.put(ctx, in, src, o.sum, options...)
+	if err != nil {
+		return err
+	}
+	o.bo = newO.bo
+	return nil
+}
+
+// Remove the file
+func (o *Object) Remove(ctx context.Context) error {
+	return o.bo.Remove(ctx)
+}
+
+// UnWrap returns the file on the base remote
+func (o *Object) UnWrap() fs.Object {
+	return o.bo
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Object          = (*Object)(nil)
+	_ fs.ObjectUnWrapper = (*Object)(nil)
+)
@@ -264,6 +264,23 @@ If meta format is set to "none", rename transactions will always be used.
 This method is EXPERIMENTAL, don't use on production systems.`,
 				},
 			},
+		}, {
+			Name:     "rechunk",
+			Advanced: true,
+			Default:  false,
+			Help: `Re-chunk files copied or moved from a chunker remote with a different chunk size.
+
+Normally files can't be copied server-side between chunker remotes
+with different chunk sizes so rclone copies them through the generic
+download and upload path.
+
+With this set, chunker copies and moves them itself. Files small
+enough not to be chunked on either side are copied or moved
+server-side if both remotes wrap the same remote, as they are stored
+the same way whatever the chunk size. Other files have their chunks
+read in order and written straight out as chunks of the destination
+chunk size, without reassembling the whole file first. The source is
+removed after a move once the new chunks and metadata are in place.`,
 		}},
 	})
 }
@@ -354,6 +371,12 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 
 	f.features.Disable("ListR") // Recursive listing may cause chunker skip files
 
+	// Re-chunking streams the data itself so doesn't need wrappedFs
+	// to support Copy
+	if f.opt.Rechunk && f.features.Copy == nil {
+		f.features.Copy = f.Copy
+	}
+
 	return f, err
 }
 
@@ -367,6 +390,7 @@ type Options struct {
 	HashType     string        `config:"hash_type"`
 	FailHard     bool          `config:"fail_hard"`
 	Transactions string        `config:"transactions"`
+	Rechunk      bool          `config:"rechunk"`
 }
 
 // Fs represents a wrapped fs.Fs
@@ -1814,6 +1838,72 @@ func (f *Fs) okForServerSide(ctx context.Context, src fs.Object, opName string)
 	return
 }
 
+// okForRechunk returns the source object if it is a file on a chunker
+// remote with a different chunk size which might be copied or moved
+// to f server-side.
+func (f *Fs) okForRechunk(src fs.Object) (obj *Object, ok bool) {
+	if !f.opt.Rechunk {
+		return nil, false
+	}
+	obj, ok = src.(*Object)
+	if !ok || f.opt.ChunkSize == obj.f.opt.ChunkSize {
+		return nil, false
+	}
+	return obj, true
+}
+
+// rechunk copies or moves o from a chunker remote with a different
+// chunk size to remote.
+//
+// If o isn't chunked on either side and both remotes wrap the same
+// remote it is copied or moved server-side with do, if set, as it is
+// stored the same way whatever the chunk size.
+//
+// Otherwise the chunks of o are read in order and streamed straight
+// into new chunks of the destination chunk size, so the file is never
+// held in full. The metadata object is written last, as for any
+// upload, so the new composite only appears once all its chunks are
+// in place. If moving, o is removed once it has been copied.
+func (f *Fs) rechunk(ctx context.Context, o *Object, remote string, do copyMoveFn, opName string) (newObj fs.Object, err error) {
+	if err := f.forbidChunk(o, remote); err != nil {
+		return nil, fmt.Errorf("can't %s: %w", opName, err)
+	}
+	if err := o.readMetadata(ctx); err != nil {
+		return nil, fmt.Errorf("can't %s this file: %w", opName, err)
+	}
+	if do != nil && !o.isComposite() && !f.hashAll && o.size <= int64(f.opt.ChunkSize) && operations.SameConfig(f.base, o.f.base) {
+		fs.Debugf(o, "%s non-chunked object...", opName)
+		oResult, err := do(ctx, o.mainChunk(), remote)
+		if err != nil {
+			return nil, err
+		}
+		return f.newObject("", oResult, nil), nil
+	}
+
+	fs.Debugf(o, "%s re-chunking from %v to %v chunks...", opName, o.f.opt.ChunkSize, f.opt.ChunkSize)
+	in, err := o.Open(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("can't %s: failed to open source: %w", opName, err)
+	}
+	newObj, err = f.put(ctx, in, o, remote, nil, f.base.Put, opName, nil)
+	closeErr := in.Close()
+	if err == nil && closeErr != nil {
+		err = fmt.Errorf("can't %s: failed to read source: %w", opName, closeErr)
+		if removeErr := newObj.Remove(ctx); removeErr != nil {
+			fs.Errorf(newObj, "Failed to remove after failed %s: %v", opName, removeErr)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if opName == "move" {
+		if err := o.Remove(ctx); err != nil {
+			return nil, fmt.Errorf("can't move: failed to remove source after re-chunking: %w", err)
+		}
+	}
+	return newObj, nil
+}
+
 // Copy src to this remote using server-side copy operations.
 //
 // This is stored with the remote path given.
@@ -1826,10 +1916,16 @@ func (f *Fs) okForServerSide(ctx context.Context, src fs.Object, opName string)
 func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
 	baseCopy := f.base.Features().Copy
 	if baseCopy == nil {
+		if obj, ok := f.okForRechunk(src); ok {
+			return f.rechunk(ctx, obj, remote, nil, "copy")
+		}
 		return nil, fs.ErrorCantCopy
 	}
 	obj, md5, sha1, ok := f.okForServerSide(ctx, src, "copy")
 	if !ok {
+		if obj, ok := f.okForRechunk(src); ok {
+			return f.rechunk(ctx, obj, remote, baseCopy, "copy")
+		}
 		return nil, fs.ErrorCantCopy
 	}
 	return f.copyOrMove(ctx, obj, remote, baseCopy, md5, sha1, "copy")
@@ -1850,6 +1946,9 @@ func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object,
 	}
 	obj, md5, sha1, ok := f.okForServerSide(ctx, src, "move")
 	if !ok {
+		if obj, ok := f.okForRechunk(src); ok {
+			return f.rechunk(ctx, obj, remote, baseMove, "move")
+		}
 		return nil, fs.ErrorCantMove
 	}
 	return f.copyOrMove(ctx, obj, remote, baseMove, md5, sha1, "move")
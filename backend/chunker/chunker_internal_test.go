@@ -899,6 +899,76 @@ func testMD5AllSlow(t *testing.T, f *Fs) {
 	require.NoError(t, operations.Purge(ctx, baseFs, ""))
 }
 
+// Test copies and moves between chunker remotes with different chunk
+// sizes with rechunk set
+func testRechunk(t *testing.T, f *Fs) {
+	ctx := context.Background()
+	srcFs := deriveFs(ctx, t, f, "rechunk/src", settings{
+		"chunk_size": "1000b",
+	})
+	dstFs := deriveFs(ctx, t, f, "rechunk/dst", settings{
+		"chunk_size": "3000b",
+		"rechunk":    true,
+	})
+	dst, ok := dstFs.(*Fs)
+	require.True(t, ok, "fs must be a chunker remote")
+	defer func() {
+		_ = operations.Purge(ctx, f.base, "rechunk")
+	}()
+
+	large := random.String(10000)
+	srcLarge := testPutFile(ctx, t, srcFs, "large", large, "large file", true)
+	require.Equal(t, 10, len(srcLarge.(*Object).chunks))
+	small := random.String(100)
+	srcSmall := testPutFile(ctx, t, srcFs, "small", small, "small file", true)
+
+	checkRechunked := func(newObj fs.Object, contents string) {
+		o, ok := newObj.(*Object)
+		require.True(t, ok)
+		assert.Equal(t, 4, len(o.chunks))
+		for _, chunk := range o.chunks {
+			assert.LessOrEqual(t, chunk.Size(), int64(dst.opt.ChunkSize))
+		}
+		reread, err := dstFs.NewObject(ctx, o.Remote())
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(contents)), reread.Size())
+		assert.True(t, fstests.ReadObject(ctx, t, reread, -1) == contents, "contents differ")
+	}
+
+	// A chunked file is re-chunked when copied
+	newLarge, err := dst.Copy(ctx, srcLarge, "large")
+	require.NoError(t, err)
+	checkRechunked(newLarge, large)
+	_, err = srcFs.NewObject(ctx, "large")
+	require.NoError(t, err, "source must be left alone by copy")
+
+	// and when moved
+	newLarge, err = dst.Move(ctx, srcLarge, "moved")
+	require.NoError(t, err)
+	checkRechunked(newLarge, large)
+	_, err = srcFs.NewObject(ctx, "large")
+	assert.ErrorIs(t, err, fs.ErrorObjectNotFound, "source must be removed by move")
+	for _, chunk := range srcLarge.(*Object).chunks {
+		_, err = f.base.NewObject(ctx, chunk.Remote())
+		assert.ErrorIs(t, err, fs.ErrorObjectNotFound, "source chunks must be removed by move")
+	}
+
+	// A small file isn't chunked on either side so is moved
+	// server-side if both remotes wrap the same remote
+	newSmall, err := dst.Move(ctx, srcSmall, "small")
+	require.NoError(t, err)
+	assert.Equal(t, small, fstests.ReadObject(ctx, t, newSmall, -1))
+	_, err = srcFs.NewObject(ctx, "small")
+	assert.ErrorIs(t, err, fs.ErrorObjectNotFound)
+
+	// Without rechunk it can't be
+	plainFs := deriveFs(ctx, t, f, "rechunk/plain", settings{
+		"chunk_size": "2000b",
+	})
+	_, err = plainFs.(*Fs).Move(ctx, newSmall, "small")
+	assert.ErrorIs(t, err, fs.ErrorCantMove)
+}
+
 // InternalTest dispatches all internal tests
 func (f *Fs) InternalTest(t *testing.T) {
 	t.Run("PutLarge", func(t *testing.T) {
@@ -934,6 +1004,9 @@ func (f *Fs) InternalTest(t *testing.T) {
 	t.Run("MD5AllSlow", func(t *testing.T) {
 		testMD5AllSlow(t, f)
 	})
+	t.Run("Rechunk", func(t *testing.T) {
+		testRechunk(t, f)
+	})
 }
 
 var _ fstests.InternalTester = (*Fs)(nil)
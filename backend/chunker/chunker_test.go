@@ -41,6 +41,8 @@ func TestIntegration(t *testing.T) {
 			"PublicLink",
 			"OpenWriterAt",
 			"OpenChunkWriter",
+			"DeleteObjects",
+			"PutURL",
 			"MergeDirs",
 			"DirCacheFlush",
 			"UserInfo",
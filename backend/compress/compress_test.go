@@ -20,6 +20,8 @@ var defaultOpt = fstests.Opt{
 	UnimplementableFsMethods: []string{
 		"OpenWriterAt",
 		"OpenChunkWriter",
+		"DeleteObjects",
+		"PutURL",
 		"MergeDirs",
 		"DirCacheFlush",
 		"PutUnchecked",
@@ -8,6 +8,7 @@ import (
 	"io"
 	"path"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rclone/rclone/fs"
@@ -379,16 +380,54 @@ func (f *Fs) addDir(ctx context.Context, entries *fs.DirEntries, dir fs.Director
 	return nil
 }
 
+// isDirMarker returns true if obj is a directory marker, an object
+// whose name ends in "/" which some backends return to represent a
+// directory.
+func isDirMarker(obj fs.Object) bool {
+	remote := obj.Remote()
+	return remote == "" || strings.HasSuffix(remote, "/")
+}
+
 // Encrypt some directory entries.  This alters entries returning it as newEntries.
-func (f *Fs) encryptEntries(ctx context.Context, entries fs.DirEntries) (newEntries fs.DirEntries, err error) {
+//
+// dir is the encrypted directory being listed. Directory markers are
+// returned as the directories they mark, leaving out the marker for
+// dir itself and any directories already returned, so they don't
+// show up as objects with empty names or as duplicates.
+//
+// seen is the set of encrypted directories returned already, which
+// this adds to. It should be shared between the batches of entries
+// of a single ListR.
+func (f *Fs) encryptEntries(ctx context.Context, entries fs.DirEntries, dir string, seen map[string]struct{}) (newEntries fs.DirEntries, err error) {
+	// Directories in entries are used in preference to markers
+	dirs := make(map[string]struct{})
+	for _, entry := range entries {
+		if x, ok := entry.(fs.Directory); ok {
+			dirs[x.Remote()] = struct{}{}
+		}
+	}
 	newEntries = entries[:0] // in place filter
 	errors := 0
 	var firsterr error
 	for _, entry := range entries {
 		switch x := entry.(type) {
 		case fs.Object:
-			err = f.add(&newEntries, x)
+			if isDirMarker(x) {
+				remote := strings.TrimSuffix(x.Remote(), "/")
+				_, inEntries := dirs[remote]
+				if _, found := seen[remote]; found || inEntries || remote == dir {
+					continue
+				}
+				seen[remote] = struct{}{}
+				err = f.addDir(ctx, &newEntries, fs.NewDir(remote, x.ModTime(ctx)))
+			} else {
+				err = f.add(&newEntries, x)
+			}
 		case fs.Directory:
+			if _, found := seen[x.Remote()]; found {
+				continue
+			}
+			seen[x.Remote()] = struct{}{}
 			err = f.addDir(ctx, &newEntries, x)
 		default:
 			return nil, fmt.Errorf("unknown object type %T", entry)
@@ -416,11 +455,12 @@ func (f *Fs) encryptEntries(ctx context.Context, entries fs.DirEntries) (newEntr
 // This should return ErrDirNotFound if the directory isn't
 // found.
 func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
-	entries, err = f.Fs.List(ctx, f.cipher.EncryptDirName(dir))
+	encryptedDir := f.cipher.EncryptDirName(dir)
+	entries, err = f.Fs.List(ctx, encryptedDir)
 	if err != nil {
 		return nil, err
 	}
-	return f.encryptEntries(ctx, entries)
+	return f.encryptEntries(ctx, entries, encryptedDir, make(map[string]struct{}))
 }
 
 // ListR lists the objects and directories of the Fs starting
@@ -440,8 +480,15 @@ func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err e
 // Don't implement this unless you have a more efficient way
 // of listing recursively that doing a directory traversal.
 func (f *Fs) ListR(ctx context.Context, dir string, callback fs.ListRCallback) (err error) {
-	return f.Fs.Features().ListR(ctx, f.cipher.EncryptDirName(dir), func(entries fs.DirEntries) error {
-		newEntries, err := f.encryptEntries(ctx, entries)
+	encryptedDir := f.cipher.EncryptDirName(dir)
+	// The marker for a directory may come in a different batch to
+	// the directory or to other markers for it
+	var mu sync.Mutex
+	seen := make(map[string]struct{})
+	return f.Fs.Features().ListR(ctx, encryptedDir, func(entries fs.DirEntries) error {
+		mu.Lock()
+		newEntries, err := f.encryptEntries(ctx, entries, encryptedDir, seen)
+		mu.Unlock()
 		if err != nil {
 			return err
 		}
@@ -6,12 +6,15 @@ import (
 	"crypto/md5"
 	"fmt"
 	"io"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fstest/mockfs"
+	"github.com/rclone/rclone/fstest/mockobject"
 	"github.com/rclone/rclone/lib/random"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -119,6 +122,119 @@ func testComputeHash(t *testing.T, f *Fs) {
 	assert.Equal(t, remoteObjHash, computedHash)
 }
 
+// markerFs is a mock Fs which lists directory markers like s3 does
+type markerFs struct {
+	*mockfs.Fs
+	features *fs.Features
+	dirs     map[string]fs.DirEntries
+}
+
+// Features returns the optional features of this Fs
+func (f *markerFs) Features() *fs.Features {
+	return f.features
+}
+
+// List returns a copy of the entries in dir
+func (f *markerFs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	entries, found := f.dirs[dir]
+	if !found {
+		return nil, fs.ErrorDirNotFound
+	}
+	return append(fs.DirEntries(nil), entries...), nil
+}
+
+// ListR returns all the entries at or below dir, one in each batch,
+// so the marker for each directory listed comes in a different batch
+// to the marker or directory in its parent's listing
+func (f *markerFs) ListR(ctx context.Context, dir string, callback fs.ListRCallback) error {
+	for listDir, entries := range f.dirs {
+		if listDir == dir || strings.HasPrefix(listDir, dir+"/") || dir == "" {
+			for _, entry := range entries {
+				err := callback(fs.DirEntries{entry})
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Check that directory markers in the wrapped remote are listed as
+// directories without any phantom entries.
+func TestDirMarkers(t *testing.T) {
+	ctx := context.Background()
+	for _, mode := range []NameEncryptionMode{NameEncryptionStandard, NameEncryptionObfuscated, NameEncryptionOff} {
+		t.Run(mode.String(), func(t *testing.T) {
+			enc, err := NewNameEncoding("base32")
+			require.NoError(t, err)
+			c, err := newCipher(mode, "", "", true, enc)
+			require.NoError(t, err)
+			mock, err := mockfs.NewFs(ctx, "mock", "", nil)
+			require.NoError(t, err)
+			file := func(remote string) fs.DirEntry {
+				return mockobject.New(c.EncryptFileName(remote))
+			}
+			dir := func(remote string) fs.DirEntry {
+				return fs.NewDir(c.EncryptDirName(remote), time.Time{})
+			}
+			marker := func(remote string) fs.DirEntry {
+				return mockobject.New(c.EncryptDirName(remote) + "/")
+			}
+			wrapped := &markerFs{
+				Fs: mock.(*mockfs.Fs),
+				dirs: map[string]fs.DirEntries{
+					"": {
+						mockobject.New(""), // marker for the root
+						file("file.txt"),
+						dir("dir"),
+						marker("dir"),
+						marker("empty"),
+					},
+					c.EncryptDirName("dir"): {
+						marker("dir"),
+						file("dir/file2.txt"),
+						marker("dir/sub"),
+					},
+				},
+			}
+			wrapped.features = (&fs.Features{}).Fill(ctx, wrapped)
+			f := &Fs{
+				Fs:     wrapped,
+				name:   "crypt",
+				cipher: c,
+			}
+
+			describe := func(entries fs.DirEntries) (out []string) {
+				for _, entry := range entries {
+					if _, ok := entry.(fs.Directory); ok {
+						out = append(out, entry.Remote()+"/")
+					} else {
+						out = append(out, entry.Remote())
+					}
+				}
+				return out
+			}
+
+			entries, err := f.List(ctx, "")
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []string{"file.txt", "dir/", "empty/"}, describe(entries))
+
+			entries, err = f.List(ctx, "dir")
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []string{"dir/file2.txt", "dir/sub/"}, describe(entries))
+
+			var all fs.DirEntries
+			err = f.ListR(ctx, "", func(entries fs.DirEntries) error {
+				all = append(all, entries...)
+				return nil
+			})
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []string{"file.txt", "dir/", "empty/", "dir/file2.txt", "dir/sub/"}, describe(all))
+		})
+	}
+}
+
 // InternalTest is called by fstests.Run to extra tests
 func (f *Fs) InternalTest(t *testing.T) {
 	t.Run("ObjectInfo", func(t *testing.T) { testObjectInfo(t, f, false) })
@@ -0,0 +1,115 @@
+// Content defined chunking
+
+package dedup
+
+import (
+	"io"
+	"math/bits"
+)
+
+// gearTable maps each byte to a random value for the rolling hash.
+//
+// It is generated from a fixed seed with splitmix64. It must never
+// change otherwise data stored before the change won't deduplicate
+// with data stored after it.
+var gearTable = func() (table [256]uint64) {
+	x := uint64(0x64656475705f6765) // "dedup_ge"
+	for i := range table {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// chunker splits a stream into content defined chunks.
+//
+// A chunk ends where the top bits of a rolling hash of the last 64
+// bytes are all zero, so the same data is split into the same
+// chunks wherever it appears in a stream.
+type chunker struct {
+	in      io.Reader
+	buf     []byte // buffer of maxSize bytes
+	start   int    // start of the unread data in buf
+	end     int    // end of the data in buf
+	eof     bool   // set when in is exhausted
+	minSize int    // chunks are at least this big, except the last
+	maxSize int    // chunks are never bigger than this
+	mask    uint64 // a chunk ends when these bits of the hash are zero
+}
+
+// newChunker makes a chunker reading from in making chunks of
+// between avgSize/4 and avgSize*4 bytes, with an average of about
+// avgSize.
+//
+// avgSize is rounded down to a power of 2 and should be at least
+// 1 KiB.
+func newChunker(in io.Reader, avgSize int) *chunker {
+	avgBits := bits.Len(uint(avgSize)) - 1
+	avgSize = 1 << avgBits
+	maxSize := avgSize * 4
+	return &chunker{
+		in:      in,
+		buf:     make([]byte, maxSize),
+		minSize: avgSize / 4,
+		maxSize: maxSize,
+		mask:    ^uint64(0) << (64 - avgBits),
+	}
+}
+
+// fill reads data into the buffer until it holds at least maxSize
+// bytes or the input is exhausted.
+func (c *chunker) fill() error {
+	if c.eof || c.end-c.start >= c.maxSize {
+		return nil
+	}
+	// Move the unread data to the start of the buffer
+	c.end = copy(c.buf, c.buf[c.start:c.end])
+	c.start = 0
+	n, err := io.ReadFull(c.in, c.buf[c.end:])
+	c.end += n
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		c.eof = true
+		return nil
+	}
+	return err
+}
+
+// cut returns the length of the chunk at the start of data
+func (c *chunker) cut(data []byte) int {
+	if len(data) <= c.minSize {
+		return len(data)
+	}
+	n := len(data)
+	if n > c.maxSize {
+		n = c.maxSize
+	}
+	// Only the last 64 bytes affect the hash so start there
+	var h uint64
+	for i := c.minSize - 64; i < n; i++ {
+		h = (h << 1) + gearTable[data[i]]
+		if i >= c.minSize && h&c.mask == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
+
+// next returns the next chunk or io.EOF if there are no more.
+//
+// The chunk returned is only valid until the next call.
+func (c *chunker) next() ([]byte, error) {
+	err := c.fill()
+	if err != nil {
+		return nil, err
+	}
+	if c.start == c.end {
+		return nil, io.EOF
+	}
+	n := c.cut(c.buf[c.start:c.end])
+	chunk := c.buf[c.start : c.start+n]
+	c.start += n
+	return chunk, nil
+}
@@ -0,0 +1,692 @@
+// Package dedup implements a backend which stores files as
+// deduplicated content defined chunks on another remote.
+package dedup
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/walk"
+)
+
+// Globals
+const (
+	filesDir        = "files"  // directory on the remote for the manifests
+	chunksDir       = "chunks" // directory on the remote for the chunks
+	manifestExt     = ".dedup" // suffix of the manifest files
+	manifestVersion = 1        // version of the manifest format
+	minChunkSize    = fs.SizeSuffix(1024)
+)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "dedup",
+		Description: "Deduplicate files stored on a remote",
+		NewFs:       NewFs,
+		Options: []fs.Option{{
+			Name: "remote",
+			Help: `Remote to store the deduplicated files in.
+
+Normally should contain a ':' and a path, e.g. "myremote:path/to/dir",
+"myremote:bucket" or maybe "myremote:" (not recommended).`,
+			Required: true,
+		}, {
+			Name: "chunk_size",
+			Help: `Average size of the chunks files are split into.
+
+Chunks are between a quarter of and four times this size. Smaller
+chunks find more duplicate data but need more transactions to store
+and read.
+
+This is rounded down to a power of 2. Changing it means data stored
+afterwards won't deduplicate well with data stored before.`,
+			Default:  fs.SizeSuffix(1024 * 1024),
+			Advanced: true,
+		}, {
+			Name: "cleanup_grace",
+			Help: `Don't remove unused chunks newer than this in cleanup.
+
+Chunks are uploaded before the manifest which uses them is written,
+so a chunk being uploaded looks unused until its upload finishes.
+Cleanup leaves unused chunks alone until they are this old so it can
+run while files are being uploaded, as long as no upload takes longer
+than this.
+
+Uploads which reuse a chunk stored already refresh its modification
+time if it is older than half this, so cleanup won't remove it either.`,
+			Default:  fs.Duration(time.Hour),
+			Advanced: true,
+		}},
+	})
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	Remote       string        `config:"remote"`
+	ChunkSize    fs.SizeSuffix `config:"chunk_size"`
+	CleanupGrace fs.Duration   `config:"cleanup_grace"`
+}
+
+// manifest describes how to reassemble a file from its chunks
+type manifest struct {
+	Version int             `json:"ver"`
+	Size    int64           `json:"size"`
+	MD5     string          `json:"md5"`
+	Chunks  []manifestChunk `json:"chunks"`
+}
+
+// manifestChunk is a chunk in a manifest
+type manifestChunk struct {
+	Hash string `json:"hash"` // SHA-256 of the chunk in hex
+	Size int64  `json:"size"`
+}
+
+// Fs represents a deduplicated remote
+type Fs struct {
+	name     string       // name of this remote
+	root     string       // the path we are working on
+	opt      Options      // options for this Fs
+	features *fs.Features // optional features
+	files    fs.Fs        // the manifests, rooted at root
+	chunks   fs.Fs        // the chunks
+}
+
+// NewFs constructs an Fs from the path.
+//
+// The returned Fs is the actual Fs, referenced by remote in the config
+func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, error) {
+	// Parse config into Options struct
+	opt := new(Options)
+	err := configstruct.Set(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	if opt.Remote == "" {
+		return nil, errors.New("dedup can't point to an empty remote - check the value of the remote setting")
+	}
+	if strings.HasPrefix(opt.Remote, name+":") {
+		return nil, errors.New("can't point dedup remote at itself - check the value of the remote setting")
+	}
+	if opt.ChunkSize < minChunkSize {
+		return nil, fmt.Errorf("chunk_size must be at least %v", minChunkSize)
+	}
+	root = strings.Trim(root, "/")
+	f, err := newFs(ctx, name, root, opt)
+	if err != nil {
+		return nil, err
+	}
+	// Check to see if the root points to a file
+	if root != "" {
+		parent := path.Dir(root)
+		if parent == "." {
+			parent = ""
+		}
+		pf, err := newFs(ctx, name, parent, opt)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := pf.NewObject(ctx, path.Base(root)); err == nil {
+			return pf, fs.ErrorIsFile
+		}
+	}
+	return f, nil
+}
+
+// newFs makes an Fs rooted at root
+func newFs(ctx context.Context, name, root string, opt *Options) (*Fs, error) {
+	f := &Fs{
+		name: name,
+		root: root,
+		opt:  *opt,
+	}
+	var err error
+	f.files, err = cache.Get(ctx, fspath.JoinRootPath(opt.Remote, path.Join(filesDir, root)))
+	if err != nil && err != fs.ErrorIsFile {
+		return nil, fmt.Errorf("failed to make remote %q for the files: %w", opt.Remote, err)
+	}
+	f.chunks, err = cache.Get(ctx, fspath.JoinRootPath(opt.Remote, chunksDir))
+	if err != nil && err != fs.ErrorIsFile {
+		return nil, fmt.Errorf("failed to make remote %q for the chunks: %w", opt.Remote, err)
+	}
+	// Pin both remotes into the cache until f is garbage collected
+	cache.Pin(f.files)
+	cache.Pin(f.chunks)
+	runtime.SetFinalizer(f, func(f *Fs) {
+		cache.Unpin(f.files)
+		cache.Unpin(f.chunks)
+	})
+
+	f.features = (&fs.Features{
+		CaseInsensitive:         true,
+		DuplicateFiles:          false,
+		CanHaveEmptyDirectories: true,
+		BucketBased:             true,
+	}).Fill(ctx, f).Mask(ctx, f.files)
+	// Reading the hash needs the manifest to be read
+	f.features.SlowHash = true
+	// Files are uploaded in chunks so can be streamed to any remote
+	// and chunks are cleaned up whether the remote can clean up or not
+	f.features.PutStream = f.PutStream
+	f.features.CleanUp = f.CleanUp
+	return f, nil
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// String converts this Fs to a string
+func (f *Fs) String() string {
+	return fmt.Sprintf("dedup root '%s'", f.root)
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// Precision of the ModTimes in this Fs
+func (f *Fs) Precision() time.Duration {
+	return f.files.Precision()
+}
+
+// Hashes returns the supported hash sets.
+func (f *Fs) Hashes() hash.Set {
+	return hash.Set(hash.MD5)
+}
+
+// manifestName returns the name of the manifest for remote of size
+//
+// The size is stored in the name so the files can be listed without
+// reading the manifests.
+func manifestName(remote string, size int64) string {
+	return remote + "." + strconv.FormatInt(size, 10) + manifestExt
+}
+
+// parseManifestName returns the remote and size from the name of a
+// manifest. ok is false if name isn't a manifest.
+func parseManifestName(name string) (remote string, size int64, ok bool) {
+	name, found := strings.CutSuffix(name, manifestExt)
+	if !found {
+		return "", 0, false
+	}
+	i := strings.LastIndexByte(name, '.')
+	if i <= 0 || name[i-1] == '/' {
+		return "", 0, false
+	}
+	size, err := strconv.ParseInt(name[i+1:], 10, 64)
+	if err != nil || size < 0 {
+		return "", 0, false
+	}
+	return name[:i], size, true
+}
+
+// chunkName returns the name of the chunk with SHA-256 id
+func chunkName(id string) string {
+	return path.Join(id[:2], id)
+}
+
+// newObject makes an Object from the manifest mo or returns nil
+// if mo isn't a manifest
+func (f *Fs) newObject(mo fs.Object) *Object {
+	remote, size, ok := parseManifestName(mo.Remote())
+	if !ok {
+		return nil
+	}
+	return &Object{
+		f:      f,
+		remote: remote,
+		size:   size,
+		mo:     mo,
+	}
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	entries, err = f.files.List(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	newEntries := entries[:0] // in place filter
+	for _, entry := range entries {
+		switch x := entry.(type) {
+		case fs.Object:
+			o := f.newObject(x)
+			if o == nil {
+				fs.Debugf(x, "Ignoring file which isn't a dedup manifest")
+				continue
+			}
+			newEntries = append(newEntries, o)
+		case fs.Directory:
+			newEntries = append(newEntries, x)
+		default:
+			return nil, fmt.Errorf("unknown object type %T", entry)
+		}
+	}
+	return newEntries, nil
+}
+
+// NewObject finds the Object at remote.  If it can't be found
+// it returns the error fs.ErrorObjectNotFound.
+//
+// As the name of the manifest contains the size this lists the
+// directory containing remote to find it.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	dir := path.Dir(remote)
+	if dir == "." {
+		dir = ""
+	}
+	entries, err := f.files.List(ctx, dir)
+	if err == fs.ErrorDirNotFound {
+		return nil, fs.ErrorObjectNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if mo, ok := entry.(fs.Object); ok {
+			if o := f.newObject(mo); o != nil && o.remote == remote {
+				return o, nil
+			}
+		}
+	}
+	return nil, fs.ErrorObjectNotFound
+}
+
+// removeOldManifests removes the manifests for remote other than keep
+//
+// These are left when a file is overwritten with one of a different
+// size as the size is part of the name of the manifest.
+func (f *Fs) removeOldManifests(ctx context.Context, remote string, keep fs.Object) error {
+	dir := path.Dir(remote)
+	if dir == "." {
+		dir = ""
+	}
+	entries, err := f.files.List(ctx, dir)
+	if err != nil {
+		return fmt.Errorf("failed to list old manifests: %w", err)
+	}
+	for _, entry := range entries {
+		mo, ok := entry.(fs.Object)
+		if !ok || mo.Remote() == keep.Remote() {
+			continue
+		}
+		if oldRemote, _, ok := parseManifestName(mo.Remote()); ok && oldRemote == remote {
+			err = mo.Remove(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to remove old manifest: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// putChunk stores the chunk data with SHA-256 id unless it is
+// stored already
+//
+// This always looks for the chunk on the remote, rather than
+// remembering which chunks have been stored, as CleanUp may have
+// removed it since.
+func (f *Fs) putChunk(ctx context.Context, id string, data []byte) error {
+	remote := chunkName(id)
+	size := int64(len(data))
+	co, err := f.chunks.NewObject(ctx, remote)
+	switch {
+	case err == nil && co.Size() == size:
+		// Already stored - make sure CleanUp doesn't remove it
+		// before the manifest using it is written
+		f.touchChunk(ctx, co)
+	case err == nil:
+		fs.Errorf(co, "Replacing chunk with wrong size %d, expecting %d", co.Size(), size)
+		err = co.Update(ctx, bytes.NewReader(data), object.NewStaticObjectInfo(remote, time.Now(), size, true, nil, f.chunks))
+	case err == fs.ErrorObjectNotFound:
+		_, err = f.chunks.Put(ctx, bytes.NewReader(data), object.NewStaticObjectInfo(remote, time.Now(), size, true, nil, f.chunks))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store chunk %s: %w", id, err)
+	}
+	return nil
+}
+
+// touchChunk refreshes the modification time of the chunk co if it
+// is older than half the cleanup grace period so CleanUp won't treat
+// it as unused while an upload is using it
+func (f *Fs) touchChunk(ctx context.Context, co fs.Object) {
+	grace := time.Duration(f.opt.CleanupGrace)
+	now := time.Now()
+	if grace <= 0 || now.Sub(co.ModTime(ctx)) < grace/2 {
+		return
+	}
+	err := co.SetModTime(ctx, now)
+	if err != nil {
+		fs.Debugf(co, "Failed to refresh modification time of chunk: %v", err)
+	}
+}
+
+// putChunks splits in into chunks, storing any which aren't stored
+// already, and returns the manifest for them.
+func (f *Fs) putChunks(ctx context.Context, in io.Reader) (*manifest, error) {
+	m := &manifest{
+		Version: manifestVersion,
+		Chunks:  []manifestChunk{},
+	}
+	md5sum := md5.New()
+	c := newChunker(in, int(f.opt.ChunkSize))
+	for {
+		chunk, err := c.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(chunk)
+		id := hex.EncodeToString(sum[:])
+		err = f.putChunk(ctx, id, chunk)
+		if err != nil {
+			return nil, err
+		}
+		_, _ = md5sum.Write(chunk)
+		m.Size += int64(len(chunk))
+		m.Chunks = append(m.Chunks, manifestChunk{Hash: id, Size: int64(len(chunk))})
+	}
+	m.MD5 = hex.EncodeToString(md5sum.Sum(nil))
+	return m, nil
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// The data is split into chunks and only the chunks which aren't
+// stored already are uploaded.
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	o := &Object{
+		f:      f,
+		remote: src.Remote(),
+	}
+	err := o.upload(ctx, in, src)
+	if err != nil {
+		return nil, err
+	}
+	err = f.removeOldManifests(ctx, o.remote, o.mo)
+	if err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+// PutStream uploads to the remote path with the modTime given of indeterminate size
+func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.Put(ctx, in, src, options...)
+}
+
+// Mkdir makes the directory (container, bucket)
+//
+// Shouldn't return an error if it already exists
+func (f *Fs) Mkdir(ctx context.Context, dir string) error {
+	return f.files.Mkdir(ctx, dir)
+}
+
+// Rmdir removes the directory (container, bucket) if empty
+//
+// Return an error if it doesn't exist or isn't empty
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	return f.files.Rmdir(ctx, dir)
+}
+
+// Purge all files in the directory
+//
+// This removes the manifests only - the chunks are removed by
+// CleanUp.
+func (f *Fs) Purge(ctx context.Context, dir string) error {
+	do := f.files.Features().Purge
+	if do == nil {
+		return fs.ErrorCantPurge
+	}
+	return do(ctx, dir)
+}
+
+// sameStore returns true if f and other keep their chunks in the
+// same place so manifests can be moved between them
+func (f *Fs) sameStore(other *Fs) bool {
+	return fs.ConfigString(f.chunks) == fs.ConfigString(other.chunks)
+}
+
+// Copy src to this remote using server-side copy operations.
+//
+// This copies the manifest only as the chunks are shared.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantCopy
+func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok || !f.sameStore(srcObj.f) {
+		fs.Debugf(src, "Can't copy - not same remote type")
+		return nil, fs.ErrorCantCopy
+	}
+	do := f.files.Features().Copy
+	if do == nil {
+		return nil, fs.ErrorCantCopy
+	}
+	mo, err := do(ctx, srcObj.mo, manifestName(remote, srcObj.size))
+	if err != nil {
+		return nil, err
+	}
+	o := f.newObject(mo)
+	err = f.removeOldManifests(ctx, remote, mo)
+	if err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+// Move src to this remote using server-side move operations.
+//
+// This moves the manifest only as the chunks are shared.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantMove
+func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok || !f.sameStore(srcObj.f) {
+		fs.Debugf(src, "Can't move - not same remote type")
+		return nil, fs.ErrorCantMove
+	}
+	do := f.files.Features().Move
+	if do == nil {
+		return nil, fs.ErrorCantMove
+	}
+	mo, err := do(ctx, srcObj.mo, manifestName(remote, srcObj.size))
+	if err != nil {
+		return nil, err
+	}
+	o := f.newObject(mo)
+	err = f.removeOldManifests(ctx, remote, mo)
+	if err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+// DirMove moves src, srcRemote to this remote at dstRemote
+// using server-side move operations.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantDirMove
+//
+// If destination exists then return fs.ErrorDirExists
+func (f *Fs) DirMove(ctx context.Context, src fs.Fs, srcRemote, dstRemote string) error {
+	srcFs, ok := src.(*Fs)
+	if !ok || !f.sameStore(srcFs) {
+		fs.Debugf(srcFs, "Can't move directory - not same remote type")
+		return fs.ErrorCantDirMove
+	}
+	do := f.files.Features().DirMove
+	if do == nil {
+		return fs.ErrorCantDirMove
+	}
+	return do(ctx, srcFs.files, srcRemote, dstRemote)
+}
+
+// About gets quota information from the remote
+func (f *Fs) About(ctx context.Context) (*fs.Usage, error) {
+	do := f.files.Features().About
+	if do == nil {
+		return nil, errors.New("not supported by underlying remote")
+	}
+	return do(ctx)
+}
+
+// CleanUp removes the chunks which no file uses any more.
+//
+// This reads the manifests of every file in the remote, not just
+// those under the root, so it only removes chunks it knows to be
+// unused. Chunks newer than the cleanup grace period are left alone
+// as they may belong to uploads which haven't written their manifests
+// yet.
+func (f *Fs) CleanUp(ctx context.Context) error {
+	files, err := cache.Get(ctx, fspath.JoinRootPath(f.opt.Remote, filesDir))
+	if err != nil && err != fs.ErrorIsFile {
+		return fmt.Errorf("failed to make remote %q for the files: %w", f.opt.Remote, err)
+	}
+	// Find the chunks in use
+	used := make(map[string]struct{})
+	var mu sync.Mutex
+	err = walk.ListR(ctx, files, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			mo, ok := entry.(fs.Object)
+			if !ok {
+				continue
+			}
+			if _, _, ok := parseManifestName(mo.Remote()); !ok {
+				continue
+			}
+			m, err := readManifest(ctx, mo)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			for _, chunk := range m.Chunks {
+				used[chunk.Hash] = struct{}{}
+			}
+			mu.Unlock()
+		}
+		return nil
+	})
+	if err != nil && err != fs.ErrorDirNotFound {
+		return fmt.Errorf("failed to read manifests - not removing any chunks: %w", err)
+	}
+	// Remove the chunks not in use
+	var removed, recent int
+	cutoff := time.Now().Add(-time.Duration(f.opt.CleanupGrace))
+	err = walk.ListR(ctx, f.chunks, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			co, ok := entry.(fs.Object)
+			if !ok {
+				continue
+			}
+			id := path.Base(co.Remote())
+			if _, ok := used[id]; ok {
+				continue
+			}
+			if co.ModTime(ctx).After(cutoff) {
+				fs.Debugf(co, "Not removing unused chunk as it is newer than %v", f.opt.CleanupGrace)
+				mu.Lock()
+				recent++
+				mu.Unlock()
+				continue
+			}
+			err := operations.DeleteFile(ctx, co)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			removed++
+			mu.Unlock()
+		}
+		return nil
+	})
+	if err != nil && err != fs.ErrorDirNotFound {
+		return fmt.Errorf("failed to remove unused chunks: %w", err)
+	}
+	fs.Infof(f, "Removed %d unused chunks, %d chunks in use, %d unused chunks too new to remove", removed, len(used), recent)
+	return nil
+}
+
+// readManifest reads the manifest in mo
+func readManifest(ctx context.Context, mo fs.Object) (m *manifest, err error) {
+	in, err := mo.Open(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %w", err)
+	}
+	defer fs.CheckClose(in, &err)
+	m = new(manifest)
+	err = json.NewDecoder(in).Decode(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest %v: %w", mo, err)
+	}
+	if m.Version != manifestVersion {
+		return nil, fmt.Errorf("unsupported version %d of manifest %v", m.Version, mo)
+	}
+	return m, nil
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs          = (*Fs)(nil)
+	_ fs.PutStreamer = (*Fs)(nil)
+	_ fs.Purger      = (*Fs)(nil)
+	_ fs.Copier      = (*Fs)(nil)
+	_ fs.Mover       = (*Fs)(nil)
+	_ fs.DirMover    = (*Fs)(nil)
+	_ fs.Abouter     = (*Fs)(nil)
+	_ fs.CleanUpper  = (*Fs)(nil)
+)
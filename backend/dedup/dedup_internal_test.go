@@ -0,0 +1,367 @@
+package dedup
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	_ "github.com/rclone/rclone/backend/memory"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// randomData returns n bytes of random data made from seed
+func randomData(seed int64, n int) []byte {
+	data := make([]byte, n)
+	_, _ = rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+// split returns the chunks data is split into
+func split(t *testing.T, data []byte, avgSize int) (chunks [][]byte) {
+	c := newChunker(bytes.NewReader(data), avgSize)
+	for {
+		chunk, err := c.next()
+		if err == io.EOF {
+			return chunks
+		}
+		require.NoError(t, err)
+		chunks = append(chunks, append([]byte(nil), chunk...))
+	}
+}
+
+func TestChunker(t *testing.T) {
+	const avgSize = 4096
+	data := randomData(1, 1024*1024)
+	chunks := split(t, data, avgSize)
+
+	// The chunks put back together are the data
+	assert.Equal(t, data, bytes.Join(chunks, nil))
+
+	// The chunks are within the size limits
+	for i, chunk := range chunks {
+		assert.LessOrEqual(t, len(chunk), 4*avgSize)
+		if i < len(chunks)-1 {
+			assert.GreaterOrEqual(t, len(chunk), avgSize/4)
+		}
+	}
+	assert.InDelta(t, len(data)/avgSize, len(chunks), float64(len(data)/avgSize/2))
+
+	// Inserting data at the start only changes the first chunk
+	shifted := split(t, append([]byte("inserted"), data...), avgSize)
+	assert.Equal(t, chunks[1:], shifted[1:])
+
+	// Nothing to split
+	assert.Empty(t, split(t, nil, avgSize))
+}
+
+// makeDedup makes a dedup remote on a temporary directory
+// returning it and the directory
+func makeDedup(t *testing.T) (*Fs, string) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	f, err := NewFs(ctx, "TestDedupInternal", "", configmap.Simple{
+		"remote":     dir,
+		"chunk_size": "4Ki",
+	})
+	require.NoError(t, err)
+	return f.(*Fs), dir
+}
+
+// countChunks returns the number of chunks stored in dir
+func countChunks(t *testing.T, dir string) (n int) {
+	err := filepath.Walk(filepath.Join(dir, chunksDir), func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			n++
+		}
+		return err
+	})
+	require.NoError(t, err)
+	return n
+}
+
+// put uploads contents to remote on f
+func put(t *testing.T, f fs.Fs, remote string, contents []byte) fs.Object {
+	ctx := context.Background()
+	src := object.NewStaticObjectInfo(remote, fstest.Time("2001-02-03T04:05:06Z"), int64(len(contents)), true, nil, nil)
+	o, err := f.Put(ctx, bytes.NewReader(contents), src)
+	require.NoError(t, err)
+	return o
+}
+
+// read reads the contents of remote on f
+func read(t *testing.T, f fs.Fs, remote string, options ...fs.OpenOption) []byte {
+	ctx := context.Background()
+	o, err := f.NewObject(ctx, remote)
+	require.NoError(t, err)
+	in, err := o.Open(ctx, options...)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	return data
+}
+
+func TestDedupReuse(t *testing.T) {
+	ctx := context.Background()
+	f, dir := makeDedup(t)
+	data := randomData(2, 256*1024)
+
+	// Storing a file stores its chunks
+	put(t, f, "file1", data)
+	chunks1 := countChunks(t, dir)
+	assert.Greater(t, chunks1, 10)
+
+	// A copy of a file stores no more chunks
+	put(t, f, "dir/copy", data)
+	assert.Equal(t, chunks1, countChunks(t, dir))
+
+	// A file overlapping the first only stores the chunks which
+	// are different
+	overlap := append([]byte("some new data at the start"), data[:200*1024]...)
+	overlap = append(overlap, randomData(3, 32*1024)...)
+	put(t, f, "dir/overlap", overlap)
+	chunks2 := countChunks(t, dir)
+	added := chunks2 - chunks1
+	assert.Greater(t, added, 0)
+	assert.Less(t, added, len(split(t, overlap, 4096))/2)
+
+	// The files read back correctly
+	assert.Equal(t, data, read(t, f, "file1"))
+	assert.Equal(t, data, read(t, f, "dir/copy"))
+	assert.Equal(t, overlap, read(t, f, "dir/overlap"))
+
+	// Ranges across chunks read back correctly
+	assert.Equal(t, data[1000:100000], read(t, f, "file1", &fs.RangeOption{Start: 1000, End: 99999}))
+	assert.Equal(t, data[123456:], read(t, f, "file1", &fs.SeekOption{Offset: 123456}))
+	assert.Equal(t, data[len(data)-10:], read(t, f, "file1", &fs.RangeOption{Start: -1, End: 10}))
+
+	// The MD5 is of the whole file
+	o, err := f.NewObject(ctx, "dir/overlap")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(overlap)), o.Size())
+	md5sum, err := o.Hash(ctx, hash.MD5)
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%x", md5.Sum(overlap)), md5sum)
+
+	// Removing files leaves the chunks until they are cleaned up,
+	// which only removes the chunks no file uses
+	require.NoError(t, o.Remove(ctx))
+	assert.Equal(t, chunks2, countChunks(t, dir))
+	require.NoError(t, f.CleanUp(ctx))
+	assert.Equal(t, chunks1, countChunks(t, dir))
+	assert.Equal(t, data, read(t, f, "dir/copy"))
+
+	// Updating a file to a different size replaces its manifest
+	o, err = f.NewObject(ctx, "file1")
+	require.NoError(t, err)
+	src := object.NewStaticObjectInfo("file1", fstest.Time("2001-02-03T04:05:06Z"), int64(len(overlap)), true, nil, nil)
+	require.NoError(t, o.Update(ctx, bytes.NewReader(overlap), src))
+	assert.Equal(t, overlap, read(t, f, "file1"))
+	entries, err := f.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(entries)) // file1 and dir
+
+	// Once nothing uses the chunks they are all cleaned up
+	require.NoError(t, o.Remove(ctx))
+	o, err = f.NewObject(ctx, "dir/copy")
+	require.NoError(t, err)
+	require.NoError(t, o.Remove(ctx))
+	require.NoError(t, f.CleanUp(ctx))
+	assert.Equal(t, 0, countChunks(t, dir))
+
+	// Chunks removed by cleanup are stored again
+	put(t, f, "file1", data)
+	assert.Equal(t, chunks1, countChunks(t, dir))
+	assert.Equal(t, data, read(t, f, "file1"))
+}
+
+// chunkPaths returns the paths of the chunks stored in dir
+func chunkPaths(t *testing.T, dir string) (paths []string) {
+	err := filepath.Walk(filepath.Join(dir, chunksDir), func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			paths = append(paths, path)
+		}
+		return err
+	})
+	require.NoError(t, err)
+	return paths
+}
+
+func TestDedupCleanUpGrace(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	newF, err := NewFs(ctx, "TestDedupCleanUpGrace", "", configmap.Simple{
+		"remote":        dir,
+		"chunk_size":    "4Ki",
+		"cleanup_grace": "1h",
+	})
+	require.NoError(t, err)
+	f := newF.(*Fs)
+	data := randomData(6, 64*1024)
+	old := time.Now().Add(-2 * time.Hour)
+	age := func() {
+		for _, path := range chunkPaths(t, dir) {
+			require.NoError(t, os.Chtimes(path, old, old))
+		}
+	}
+
+	// Chunks which aren't used yet are left alone while they are new
+	o := put(t, f, "file", data)
+	chunks := countChunks(t, dir)
+	require.NoError(t, o.Remove(ctx))
+	require.NoError(t, f.CleanUp(ctx))
+	assert.Equal(t, chunks, countChunks(t, dir))
+
+	// Reusing old chunks makes them new again
+	age()
+	o = put(t, f, "file", data)
+	require.NoError(t, o.Remove(ctx))
+	require.NoError(t, f.CleanUp(ctx))
+	assert.Equal(t, chunks, countChunks(t, dir))
+
+	// Old unused chunks are removed
+	age()
+	require.NoError(t, f.CleanUp(ctx))
+	assert.Equal(t, 0, countChunks(t, dir))
+}
+
+func TestDedupCorruptChunk(t *testing.T) {
+	f, dir := makeDedup(t)
+	data := randomData(7, 64*1024)
+	put(t, f, "file", data)
+
+	// Corrupt a chunk keeping its size
+	paths := chunkPaths(t, dir)
+	require.Greater(t, len(paths), 2)
+	chunk, err := os.ReadFile(paths[0])
+	require.NoError(t, err)
+	chunk[len(chunk)/2] ^= 0xFF
+	require.NoError(t, os.WriteFile(paths[0], chunk, 0600))
+
+	ctx := context.Background()
+	readErr := func(options ...fs.OpenOption) error {
+		o, err := f.NewObject(ctx, "file")
+		require.NoError(t, err)
+		in, err := o.Open(ctx, options...)
+		require.NoError(t, err)
+		_, err = io.ReadAll(in)
+		_ = in.Close()
+		return err
+	}
+	err = readErr()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is corrupted: SHA-256 is")
+
+	// The corruption is found starting part way through the chunk
+	o, err := f.NewObject(ctx, "file")
+	require.NoError(t, err)
+	m, err := o.(*Object).manifest(ctx)
+	require.NoError(t, err)
+	var offset int64
+	for _, c := range m.Chunks {
+		if c.Hash == filepath.Base(paths[0]) {
+			break
+		}
+		offset += c.Size
+	}
+	err = readErr(&fs.SeekOption{Offset: offset + int64(len(chunk)) - 1})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is corrupted: SHA-256 is")
+
+	// Truncate the chunk
+	require.NoError(t, os.WriteFile(paths[0], chunk[:len(chunk)/2], 0600))
+	err = readErr()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is corrupted: expecting")
+}
+
+func TestDedupOverwrite(t *testing.T) {
+	ctx := context.Background()
+	small := randomData(4, 1000)
+	large := randomData(5, 10000)
+
+	// Use the memory backend as it can copy server-side
+	newF, err := NewFs(ctx, "TestDedupOverwrite", "", configmap.Simple{
+		"remote":     ":memory:TestDedupOverwrite",
+		"chunk_size": "4Ki",
+	})
+	require.NoError(t, err)
+	f := newF.(*Fs)
+
+	// manifests returns the names of the manifests in dir
+	manifests := func(f *Fs, dir string) (names []string) {
+		entries, err := f.files.List(ctx, dir)
+		require.NoError(t, err)
+		for _, entry := range entries {
+			if _, ok := entry.(fs.Object); ok {
+				names = append(names, entry.Remote())
+			}
+		}
+		return names
+	}
+
+	// Putting over a file with a different size replaces its manifest
+	put(t, f, "file", small)
+	put(t, f, "file", large)
+	assert.Equal(t, []string{manifestName("file", int64(len(large)))}, manifests(f, ""))
+	assert.Equal(t, large, read(t, f, "file"))
+
+	// Copying over a file with a different size replaces its manifest
+	src := put(t, f, "dir/src", small)
+	_, err = f.Copy(ctx, src, "file")
+	require.NoError(t, err)
+	assert.Equal(t, []string{manifestName("file", int64(len(small)))}, manifests(f, ""))
+	assert.Equal(t, small, read(t, f, "file"))
+
+	// Moving over a file with a different size replaces its
+	// manifest - use the local backend as it can move server-side
+	f, _ = makeDedup(t)
+	put(t, f, "file", small)
+	src = put(t, f, "dir/src", large)
+	_, err = f.Move(ctx, src, "file")
+	require.NoError(t, err)
+	assert.Equal(t, []string{manifestName("file", int64(len(large)))}, manifests(f, ""))
+	assert.Equal(t, large, read(t, f, "file"))
+	assert.Empty(t, manifests(f, "dir"))
+}
+
+func TestParseManifestName(t *testing.T) {
+	for _, test := range []struct {
+		in     string
+		remote string
+		size   int64
+		ok     bool
+	}{
+		{in: "file.txt.123.dedup", remote: "file.txt", size: 123, ok: true},
+		{in: "dir/file.0.dedup", remote: "dir/file", size: 0, ok: true},
+		{in: "file.5.dedup.7.dedup", remote: "file.5.dedup", size: 7, ok: true},
+		{in: "file.txt"},
+		{in: "file.dedup"},
+		{in: ".1.dedup"},
+		{in: "dir/.1.dedup"},
+		{in: "file.-1.dedup"},
+		{in: "file.x.dedup"},
+	} {
+		remote, size, ok := parseManifestName(test.in)
+		assert.Equal(t, test.ok, ok, test.in)
+		assert.Equal(t, test.remote, remote, test.in)
+		assert.Equal(t, test.size, size, test.in)
+		if ok {
+			assert.Equal(t, test.in, manifestName(remote, size))
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package dedup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	gohash "hash"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+)
+
+// Object describes a deduplicated file
+//
+// It is stored as a manifest listing the chunks of its contents.
+type Object struct {
+	f      *Fs
+	remote string    // the path of the file
+	size   int64     // size of the file
+	mo     fs.Object // the manifest or nil if not uploaded yet
+	mu     sync.Mutex
+	m      *manifest // the manifest once read
+}
+
+// Fs returns the parent Fs
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// Return a string version
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *Object) Remote() string {
+	return o.remote
+}
+
+// Size returns the size of the file
+func (o *Object) Size() int64 {
+	return o.size
+}
+
+// ModTime returns the modification time of the file
+//
+// This is stored as the modification time of the manifest.
+func (o *Object) ModTime(ctx context.Context) time.Time {
+	return o.mo.ModTime(ctx)
+}
+
+// SetModTime sets the modification time of the file
+func (o *Object) SetModTime(ctx context.Context, modTime time.Time) error {
+	return o.mo.SetModTime(ctx, modTime)
+}
+
+// Storable returns a boolean indicating if this object is storable
+func (o *Object) Storable() bool {
+	return true
+}
+
+// manifest returns the manifest, reading it if necessary
+func (o *Object) manifest(ctx context.Context) (*manifest, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.m != nil {
+		return o.m, nil
+	}
+	m, err := readManifest(ctx, o.mo)
+	if err != nil {
+		return nil, err
+	}
+	o.m = m
+	return m, nil
+}
+
+// Hash returns the MD5 of the file which is stored in the manifest
+func (o *Object) Hash(ctx context.Context, ht hash.Type) (string, error) {
+	if ht != hash.MD5 {
+		return "", hash.ErrUnsupported
+	}
+	m, err := o.manifest(ctx)
+	if err != nil {
+		return "", err
+	}
+	return m.MD5, nil
+}
+
+// Open an object for read
+//
+// This reads the chunks one after another.
+func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	m, err := o.manifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var offset, limit int64 = 0, -1
+	for _, option := range options {
+		switch x := option.(type) {
+		case *fs.RangeOption:
+			offset, limit = x.Decode(m.Size)
+		case *fs.SeekOption:
+			offset = x.Offset
+		default:
+			if option.Mandatory() {
+				fs.Logf(o, "Unsupported mandatory option: %v", option)
+			}
+		}
+	}
+	if offset > m.Size {
+		offset = m.Size
+	}
+	if limit < 0 || offset+limit > m.Size {
+		limit = m.Size - offset
+	}
+	return newChunkReader(ctx, o.f, m.Chunks, offset, limit), nil
+}
+
+// upload splits in into chunks and writes the manifest for them,
+// replacing the existing manifest if there is one.
+func (o *Object) upload(ctx context.Context, in io.Reader, src fs.ObjectInfo) error {
+	m, err := o.f.putChunks(ctx, in)
+	if err != nil {
+		return err
+	}
+	if size := src.Size(); size >= 0 && size != m.Size {
+		return fmt.Errorf("upload size mismatch: expecting %d but got %d", size, m.Size)
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	name := manifestName(o.remote, m.Size)
+	info := object.NewStaticObjectInfo(name, src.ModTime(ctx), int64(len(data)), true, nil, o.f.files)
+	oldMo := o.mo
+	var mo fs.Object
+	if oldMo != nil && oldMo.Remote() == name {
+		err = oldMo.Update(ctx, bytes.NewReader(data), info)
+		mo = oldMo
+	} else {
+		mo, err = o.f.files.Put(ctx, bytes.NewReader(data), info)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	// The size changed so remove the manifest with the old size
+	if oldMo != nil && oldMo.Remote() != name {
+		err = oldMo.Remove(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to remove old manifest: %w", err)
+		}
+	}
+	o.mu.Lock()
+	o.mo = mo
+	o.size = m.Size
+	o.m = m
+	o.mu.Unlock()
+	return nil
+}
+
+// Update the object with the contents of the io.Reader, modTime and size
+//
+// Only the chunks which aren't stored already are uploaded.
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	return o.upload(ctx, in, src)
+}
+
+// Remove the file
+//
+// This removes the manifest only - the chunks are removed by
+// CleanUp if no other file uses them.
+func (o *Object) Remove(ctx context.Context) error {
+	return o.mo.Remove(ctx)
+}
+
+// chunkReader reads a range of a file from its chunks
+//
+// Each chunk is checked against its SHA-256 as it is read. Chunks are
+// read from their start so this includes the first chunk of a range,
+// but the last chunk of a range is only checked if it is read to its
+// end.
+type chunkReader struct {
+	ctx       context.Context
+	f         *Fs
+	chunks    []manifestChunk // chunks still to be read
+	offset    int64           // offset to start reading the first chunk at
+	remaining int64           // bytes still to be read
+	in        io.ReadCloser   // the chunk being read or nil
+	chunk     manifestChunk   // the chunk being read
+	left      int64           // bytes of the chunk still to be read
+	hasher    gohash.Hash     // SHA-256 of the chunk read so far
+}
+
+// newChunkReader makes a reader for limit bytes from offset of the
+// file made from chunks
+func newChunkReader(ctx context.Context, f *Fs, chunks []manifestChunk, offset, limit int64) *chunkReader {
+	// Skip the chunks before offset
+	for len(chunks) > 0 && offset >= chunks[0].Size {
+		offset -= chunks[0].Size
+		chunks = chunks[1:]
+	}
+	return &chunkReader{
+		ctx:       ctx,
+		f:         f,
+		chunks:    chunks,
+		offset:    offset,
+		remaining: limit,
+	}
+}
+
+// openChunk opens the next chunk for reading
+func (r *chunkReader) openChunk() error {
+	if len(r.chunks) == 0 {
+		return io.ErrUnexpectedEOF
+	}
+	chunk := r.chunks[0]
+	r.chunks = r.chunks[1:]
+	co, err := r.f.chunks.NewObject(r.ctx, chunkName(chunk.Hash))
+	if err != nil {
+		return fmt.Errorf("failed to find chunk %s: %w", chunk.Hash, err)
+	}
+	r.in, err = co.Open(r.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open chunk %s: %w", chunk.Hash, err)
+	}
+	r.chunk = chunk
+	r.left = chunk.Size
+	r.hasher = sha256.New()
+	// Read the start of the chunk too so its hash can be checked
+	if r.offset > 0 {
+		n, err := io.CopyN(r.hasher, r.in, r.offset)
+		r.left -= n
+		r.offset = 0
+		if err == io.EOF {
+			return r.errShort()
+		} else if err != nil {
+			return fmt.Errorf("failed to read chunk %s: %w", chunk.Hash, err)
+		}
+	}
+	if r.left == 0 {
+		return r.closeChunk()
+	}
+	return nil
+}
+
+// errShort returns an error for a chunk which ended too soon
+func (r *chunkReader) errShort() error {
+	return fmt.Errorf("chunk %s is corrupted: expecting %d bytes but got %d", r.chunk.Hash, r.chunk.Size, r.chunk.Size-r.left)
+}
+
+// closeChunk closes the chunk which has been read to its end and
+// checks its SHA-256
+func (r *chunkReader) closeChunk() error {
+	err := r.in.Close()
+	r.in = nil
+	if err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(r.hasher.Sum(nil)); sum != r.chunk.Hash {
+		return fmt.Errorf("chunk %s is corrupted: SHA-256 is %s", r.chunk.Hash, sum)
+	}
+	return nil
+}
+
+// Read reads up to len(p) bytes into p
+func (r *chunkReader) Read(p []byte) (n int, err error) {
+	if r.remaining <= 0 {
+		return 0, io.EOF
+	}
+	for r.in == nil {
+		err = r.openChunk()
+		if err != nil {
+			return 0, err
+		}
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	if int64(len(p)) > r.left {
+		p = p[:r.left]
+	}
+	n, err = r.in.Read(p)
+	_, _ = r.hasher.Write(p[:n])
+	r.remaining -= int64(n)
+	r.left -= int64(n)
+	if r.left == 0 {
+		return n, r.closeChunk()
+	}
+	if err == io.EOF {
+		return n, r.errShort()
+	}
+	return n, err
+}
+
+// Close closes the chunk being read
+func (r *chunkReader) Close() error {
+	if r.in == nil {
+		return nil
+	}
+	err := r.in.Close()
+	r.in = nil
+	return err
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Object = (*Object)(nil)
+)
@@ -12,8 +12,10 @@ const (
 	// BlockSize of the checksum in bytes.
 	BlockSize = sha256.BlockSize
 	// Size of the checksum in bytes.
-	Size              = sha256.BlockSize
-	bytesPerBlock     = 4 * 1024 * 1024
+	Size = sha256.BlockSize
+	// BytesPerBlock is the size of the blocks of the data which
+	// are hashed with SHA-256 and then hashed together.
+	BytesPerBlock     = 4 * 1024 * 1024
 	hashReturnedError = "hash function returned error"
 )
 
@@ -55,7 +57,7 @@ func (d *digest) Write(p []byte) (n int, err error) {
 	n = len(p)
 	for len(p) > 0 {
 		d.writtenMore = true
-		toWrite := bytesPerBlock - d.n
+		toWrite := BytesPerBlock - d.n
 		if toWrite > len(p) {
 			toWrite = len(p)
 		}
@@ -66,7 +68,7 @@ func (d *digest) Write(p []byte) (n int, err error) {
 		d.n += toWrite
 		p = p[toWrite:]
 		// Accumulate the total hash
-		if d.n == bytesPerBlock {
+		if d.n == BytesPerBlock {
 			d.writeBlockHash()
 		}
 	}
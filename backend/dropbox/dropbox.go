@@ -23,6 +23,7 @@ of path_display and all will be well.
 
 import (
 	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
@@ -148,6 +149,7 @@ func getOauthConfig(m configmap.Mapper) *oauth2.Config {
 // Register with Fs
 func init() {
 	DbHashType = hash.RegisterHash("dropbox", "DropboxHash", 64, dbhash.New)
+	hash.RegisterBlockHash(DbHashType, dbhash.BytesPerBlock, sha256.New, sha256.New)
 	fs.Register(&fs.RegInfo{
 		Name:        "dropbox",
 		Description: "Dropbox",
@@ -1,9 +1,17 @@
 package dropbox
 
 import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
 	"testing"
 
+	"github.com/rclone/rclone/backend/dropbox/dbhash"
+	"github.com/rclone/rclone/fs/hash"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestInternalCheckPathLength(t *testing.T) {
@@ -42,3 +50,22 @@ func TestInternalCheckPathLength(t *testing.T) {
 		assert.Equal(t, test.ok, err == nil, test.in)
 	}
 }
+
+func TestInternalHashParallel(t *testing.T) {
+	ctx := context.Background()
+	data := make([]byte, 3*dbhash.BytesPerBlock+123)
+	_, _ = rand.New(rand.NewSource(1)).Read(data)
+	assert.Equal(t, int64(dbhash.BytesPerBlock), hash.BlockSize(DbHashType))
+	for _, size := range []int{0, 1, dbhash.BytesPerBlock, dbhash.BytesPerBlock + 1, len(data)} {
+		h := dbhash.New()
+		_, _ = h.Write(data[:size])
+		want := hex.EncodeToString(h.Sum(nil))
+		for _, concurrency := range []int{1, 4} {
+			t.Run(fmt.Sprintf("size=%d,concurrency=%d", size, concurrency), func(t *testing.T) {
+				got, err := hash.StreamParallel(ctx, bytes.NewReader(data), int64(size), DbHashType, concurrency)
+				require.NoError(t, err)
+				assert.Equal(t, want, got)
+			})
+		}
+	}
+}
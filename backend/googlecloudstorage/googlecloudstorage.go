@@ -78,6 +78,10 @@ func init() {
 		Prefix:      "gcs",
 		Description: "Google Cloud Storage (this is not Google Drive)",
 		NewFs:       NewFs,
+		MetadataInfo: &fs.MetadataInfo{
+			System: systemMetadataInfo,
+			Help:   `User metadata is stored as custom metadata on the object.`,
+		},
 		Config: func(ctx context.Context, name string, m configmap.Mapper, config fs.ConfigIn) (*fs.ConfigOut, error) {
 			saFile, _ := m.Get("service_account_file")
 			saCreds, _ := m.Get("service_account_credentials")
@@ -332,9 +336,31 @@ set. Normally rclone will download these files as compressed objects.
 If this flag is set then rclone will decompress these files with
 "Content-Encoding: gzip" as they are received. This means that rclone
 can't check the size and hash but the file contents will be decompressed.
+
+The "content-encoding" metadata of these files isn't passed on when
+copying them with --metadata as the data is no longer compressed.
 `,
 			Advanced: true,
 			Default:  false,
+		}, {
+			Name: "use_custom_time",
+			Help: `If set use the customTime of objects as their modification time.
+
+GCS objects have a user settable customTime which can be used in
+lifecycle rules. If this flag is set rclone reads the modification
+time of objects from their customTime if it is set, and sets the
+customTime as well as the mtime metadata when uploading objects or
+setting their modification time.
+
+Note that GCS doesn't allow the customTime to be removed or set to an
+earlier time, so rclone will upload the object again if it needs to
+set an earlier modification time.
+
+The customTime can also be read and written with the "custom-time"
+metadata key when using --metadata.
+`,
+			Default:  false,
+			Advanced: true,
 		}, {
 			Name:     "endpoint",
 			Help:     "Endpoint for the service.\n\nLeave blank normally.",
@@ -379,6 +405,7 @@ type Options struct {
 	Enc                       encoder.MultiEncoder `config:"encoding"`
 	EnvAuth                   bool                 `config:"env_auth"`
 	DirectoryMarkers          bool                 `config:"directory_markers"`
+	UseCustomTime             bool                 `config:"use_custom_time"`
 }
 
 // Fs represents a remote storage server
@@ -396,18 +423,79 @@ type Fs struct {
 	warnCompressed sync.Once        // warn once about compressed files
 }
 
+// system metadata keys which this backend owns
+var systemMetadataInfo = map[string]fs.MetadataHelp{
+	"cache-control": {
+		Help:    "Cache-Control header",
+		Type:    "string",
+		Example: "no-cache",
+	},
+	"content-disposition": {
+		Help:    "Content-Disposition header",
+		Type:    "string",
+		Example: "inline",
+	},
+	"content-encoding": {
+		Help:    "Content-Encoding header",
+		Type:    "string",
+		Example: "gzip",
+	},
+	"content-language": {
+		Help:    "Content-Language header",
+		Type:    "string",
+		Example: "en-US",
+	},
+	"content-type": {
+		Help:    "Content-Type header",
+		Type:    "string",
+		Example: "text/plain",
+	},
+	"custom-time": {
+		Help:    "User settable customTime of the object, can't be set earlier than its current value",
+		Type:    "RFC 3339",
+		Example: "2006-01-02T15:04:05.999999999Z07:00",
+	},
+	"tier": {
+		Help:     "Storage class of the object",
+		Type:     "string",
+		Example:  "STANDARD",
+		ReadOnly: true,
+	},
+	"mtime": {
+		Help:    "Time of last modification, read from rclone metadata",
+		Type:    "RFC 3339",
+		Example: "2006-01-02T15:04:05.999999999Z07:00",
+	},
+	"btime": {
+		Help:     "Time of file birth (creation)",
+		Type:     "RFC 3339",
+		Example:  "2006-01-02T15:04:05.999999999Z07:00",
+		ReadOnly: true,
+	},
+}
+
 // Object describes a storage object
 //
 // Will definitely have info but maybe not meta
 type Object struct {
-	fs       *Fs       // what this object is part of
-	remote   string    // The remote path
-	url      string    // download path
-	md5sum   string    // The MD5Sum of the object
-	bytes    int64     // Bytes in the object
-	modTime  time.Time // Modified time of the object
-	mimeType string
-	gzipped  bool // set if object has Content-Encoding: gzip
+	fs         *Fs       // what this object is part of
+	remote     string    // The remote path
+	url        string    // download path
+	md5sum     string    // The MD5Sum of the object
+	bytes      int64     // Bytes in the object
+	modTime    time.Time // Modified time of the object
+	customTime time.Time // customTime of the object - zero if not set
+	mimeType   string
+	gzipped    bool              // set if object has Content-Encoding: gzip
+	meta       map[string]string // custom metadata of the object
+
+	// System metadata
+	cacheControl       string    // Cache-Control: header
+	contentDisposition string    // Content-Disposition: header
+	contentEncoding    string    // Content-Encoding: header
+	contentLanguage    string    // Content-Language: header
+	storageClass       string    // e.g. STANDARD
+	timeCreated        time.Time // when the object was created
 }
 
 // ------------------------------------------------------------
@@ -559,6 +647,9 @@ func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, e
 		WriteMimeType:     true,
 		BucketBased:       true,
 		BucketBasedRootOK: true,
+		ReadMetadata:      true,
+		WriteMetadata:     true,
+		UserMetadata:      true,
 	}).Fill(ctx, f)
 	if opt.DirectoryMarkers {
 		f.features.CanHaveEmptyDirectories = true
@@ -1158,6 +1249,14 @@ func (o *Object) setMetaData(info *storage.Object) {
 	o.bytes = int64(info.Size)
 	o.mimeType = info.ContentType
 	o.gzipped = info.ContentEncoding == "gzip"
+	o.meta = info.Metadata
+	o.cacheControl = info.CacheControl
+	o.contentDisposition = info.ContentDisposition
+	o.contentEncoding = info.ContentEncoding
+	o.contentLanguage = info.ContentLanguage
+	o.storageClass = info.StorageClass
+	o.timeCreated = parseTime(o, "timeCreated", info.TimeCreated)
+	o.customTime = parseTime(o, "customTime", info.CustomTime)
 
 	// Read md5sum
 	md5sumData, err := base64.StdEncoding.DecodeString(info.Md5Hash)
@@ -1167,13 +1266,42 @@ func (o *Object) setMetaData(info *storage.Object) {
 		o.md5sum = hex.EncodeToString(md5sumData)
 	}
 
+	o.modTime = o.readModTime(info)
+
+	// If gunzipping then size and md5sum are unknown
+	if o.gzipped && o.fs.opt.Decompress {
+		o.bytes = -1
+		o.md5sum = ""
+	}
+}
+
+// parseTime parses a time from the API returning a zero time if it
+// isn't set or can't be parsed
+func parseTime(o *Object, what, timeString string) time.Time {
+	if timeString == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(timeFormat, timeString)
+	if err != nil {
+		fs.Debugf(o, "Failed to read %s: %v", what, err)
+		return time.Time{}
+	}
+	return t
+}
+
+// readModTime works out the modification time from a storage.Object
+func (o *Object) readModTime(info *storage.Object) time.Time {
+	// use the customTime if required and available
+	if o.fs.opt.UseCustomTime && !o.customTime.IsZero() {
+		return o.customTime
+	}
+
 	// read mtime out of metadata if available
 	mtimeString, ok := info.Metadata[metaMtime]
 	if ok {
 		modTime, err := time.Parse(timeFormat, mtimeString)
 		if err == nil {
-			o.modTime = modTime
-			return
+			return modTime
 		}
 		fs.Debugf(o, "Failed to read mtime from metadata: %s", err)
 	}
@@ -1183,8 +1311,7 @@ func (o *Object) setMetaData(info *storage.Object) {
 	if ok {
 		unixTimeSec, err := strconv.ParseInt(mtimeGsutilString, 10, 64)
 		if err == nil {
-			o.modTime = time.Unix(unixTimeSec, 0)
-			return
+			return time.Unix(unixTimeSec, 0)
 		}
 		fs.Debugf(o, "Failed to read GSUtil mtime from metadata: %s", err)
 	}
@@ -1193,15 +1320,8 @@ func (o *Object) setMetaData(info *storage.Object) {
 	modTime, err := time.Parse(timeFormat, info.Updated)
 	if err != nil {
 		fs.Logf(o, "Bad time decode: %v", err)
-	} else {
-		o.modTime = modTime
-	}
-
-	// If gunzipping then size and md5sum are unknown
-	if o.gzipped && o.fs.opt.Decompress {
-		o.bytes = -1
-		o.md5sum = ""
 	}
+	return modTime
 }
 
 // readObjectInfo reads the definition for an object
@@ -1280,6 +1400,12 @@ func (o *Object) SetModTime(ctx context.Context, modTime time.Time) (err error)
 	}
 	object.Metadata[metaMtime] = modTime.Format(timeFormat)
 	object.Metadata[metaMtimeGsutil] = strconv.FormatInt(modTime.Unix(), 10)
+	if o.fs.opt.UseCustomTime {
+		err = setCustomTime(object, modTime)
+		if err != nil {
+			return err
+		}
+	}
 	// Copy the object to itself to update the metadata
 	// Using PATCH requires too many permissions
 	bucket, bucketPath := o.split()
@@ -1303,6 +1429,21 @@ func (o *Object) SetModTime(ctx context.Context, modTime time.Time) (err error)
 	return nil
 }
 
+// setCustomTime sets the customTime of object to t
+//
+// GCS doesn't allow the customTime to be set earlier than its current
+// value so this returns fs.ErrorCantSetModTimeWithoutDelete if it is.
+func setCustomTime(object *storage.Object, t time.Time) error {
+	if object.CustomTime != "" {
+		current, err := time.Parse(timeFormat, object.CustomTime)
+		if err == nil && t.Before(current) {
+			return fs.ErrorCantSetModTimeWithoutDelete
+		}
+	}
+	object.CustomTime = t.UTC().Format(timeFormat)
+	return nil
+}
+
 // Storable returns a boolean as to whether this object is storable
 func (o *Object) Storable() bool {
 	return true
@@ -1366,14 +1507,19 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 			return err
 		}
 	}
-	modTime := src.ModTime(ctx)
-
 	object := storage.Object{
 		Bucket:      bucket,
 		Name:        bucketPath,
 		ContentType: fs.MimeType(ctx, src),
-		Metadata:    metadataFromModTime(modTime),
 	}
+
+	// Fetch metadata if --metadata is in use
+	meta, err := fs.GetMetadataOptions(ctx, o.fs, src, options)
+	if err != nil {
+		return fmt.Errorf("failed to read metadata from source object: %w", err)
+	}
+	o.applyMetadata(&object, meta, src.ModTime(ctx))
+
 	// Apply upload options
 	for _, option := range options {
 		key, value := option.Header()
@@ -1424,6 +1570,99 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 	return nil
 }
 
+// applyMetadata sets the system and user metadata in meta on object
+// along with the modification time.
+//
+// The "mtime" key in meta overrides modTime.
+func (o *Object) applyMetadata(object *storage.Object, meta fs.Metadata, modTime time.Time) {
+	userMeta := make(map[string]string, len(meta)+2)
+	for k, v := range meta {
+		switch k {
+		case "cache-control":
+			object.CacheControl = v
+		case "content-disposition":
+			object.ContentDisposition = v
+		case "content-encoding":
+			object.ContentEncoding = v
+		case "content-language":
+			object.ContentLanguage = v
+		case "content-type":
+			object.ContentType = v
+		case "custom-time":
+			customTime, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				fs.Debugf(o, "failed to parse metadata %s: %q: %v", k, v, err)
+			} else {
+				object.CustomTime = customTime.UTC().Format(timeFormat)
+			}
+		case "mtime":
+			// mtime in meta overrides source ModTime
+			metaModTime, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				fs.Debugf(o, "failed to parse metadata %s: %q: %v", k, v, err)
+			} else {
+				modTime = metaModTime
+			}
+		case "btime", "tier":
+			// read only so ignore
+		default:
+			userMeta[k] = v
+		}
+	}
+	for k, v := range metadataFromModTime(modTime) {
+		userMeta[k] = v
+	}
+	object.Metadata = userMeta
+	if o.fs.opt.UseCustomTime && object.CustomTime == "" {
+		object.CustomTime = modTime.UTC().Format(timeFormat)
+	}
+}
+
+// Metadata returns metadata for an object
+//
+// It should return nil if there is no Metadata
+func (o *Object) Metadata(ctx context.Context) (metadata fs.Metadata, err error) {
+	err = o.readMetaData(ctx)
+	if err != nil {
+		return nil, err
+	}
+	metadata = make(fs.Metadata, len(o.meta)+8)
+	for k, v := range o.meta {
+		switch k {
+		case metaMtime:
+			if modTime, err := time.Parse(timeFormat, v); err == nil {
+				metadata["mtime"] = modTime.Format(time.RFC3339Nano)
+			}
+		case metaMtimeGsutil:
+			// don't return the duplicate mtime
+		default:
+			metadata[k] = v
+		}
+	}
+	setMetadata := func(k, v string) {
+		if v != "" {
+			metadata[k] = v
+		}
+	}
+	setTimeMetadata := func(k string, t time.Time) {
+		if !t.IsZero() {
+			metadata[k] = t.Format(time.RFC3339Nano)
+		}
+	}
+	setMetadata("content-type", o.mimeType)
+	setMetadata("cache-control", o.cacheControl)
+	setMetadata("content-disposition", o.contentDisposition)
+	// The data read is no longer encoded if it is decompressed
+	if !(o.gzipped && o.fs.opt.Decompress) {
+		setMetadata("content-encoding", o.contentEncoding)
+	}
+	setMetadata("content-language", o.contentLanguage)
+	setMetadata("tier", o.storageClass)
+	setTimeMetadata("btime", o.timeCreated)
+	setTimeMetadata("custom-time", o.customTime)
+	return metadata, nil
+}
+
 // Remove an object
 func (o *Object) Remove(ctx context.Context) (err error) {
 	bucket, bucketPath := o.split()
@@ -1451,4 +1690,5 @@ var (
 	_ fs.ListRer     = &Fs{}
 	_ fs.Object      = &Object{}
 	_ fs.MimeTyper   = &Object{}
+	_ fs.Metadataer  = &Object{}
 )
@@ -0,0 +1,165 @@
+package googlecloudstorage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/storage/v1"
+)
+
+// makeObject makes an Object from info with the options passed in
+func makeObject(opt Options, info *storage.Object) *Object {
+	o := &Object{
+		fs:     &Fs{opt: opt},
+		remote: "file.txt",
+	}
+	o.setMetaData(info)
+	return o
+}
+
+func TestReadModTime(t *testing.T) {
+	const (
+		updated    = "2001-02-03T04:05:06.499999999Z"
+		mtime      = "2002-02-03T04:05:06.499999999Z"
+		customTime = "2003-02-03T04:05:06.499999999Z"
+	)
+	for _, test := range []struct {
+		name          string
+		useCustomTime bool
+		metadata      map[string]string
+		customTime    string
+		want          string
+	}{
+		{name: "updated", want: updated},
+		{name: "gsutil", metadata: map[string]string{metaMtimeGsutil: "1012709106"}, want: "2002-02-03T04:05:06Z"},
+		{name: "mtime", metadata: map[string]string{metaMtime: mtime, metaMtimeGsutil: "1"}, want: mtime},
+		{name: "customTime ignored", metadata: map[string]string{metaMtime: mtime}, customTime: customTime, want: mtime},
+		{name: "customTime", useCustomTime: true, metadata: map[string]string{metaMtime: mtime}, customTime: customTime, want: customTime},
+		{name: "customTime unset", useCustomTime: true, metadata: map[string]string{metaMtime: mtime}, want: mtime},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			o := makeObject(Options{UseCustomTime: test.useCustomTime}, &storage.Object{
+				Updated:    updated,
+				Metadata:   test.metadata,
+				CustomTime: test.customTime,
+			})
+			assert.True(t, fstest.Time(test.want).Equal(o.modTime), o.modTime)
+		})
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	ctx := context.Background()
+	o := makeObject(Options{}, &storage.Object{
+		Updated:         "2001-02-03T04:05:06.499999999Z",
+		TimeCreated:     "2000-02-03T04:05:06.499999999Z",
+		CustomTime:      "2003-02-03T04:05:06.499999999Z",
+		ContentType:     "text/plain",
+		ContentEncoding: "gzip",
+		StorageClass:    "STANDARD",
+		Metadata: map[string]string{
+			metaMtime:       "2002-02-03T04:05:06.499999999Z",
+			metaMtimeGsutil: "1012709106",
+			"potato":        "jersey royal",
+		},
+	})
+	metadata, err := o.Metadata(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, fs.Metadata{
+		"mtime":            "2002-02-03T04:05:06.499999999Z",
+		"btime":            "2000-02-03T04:05:06.499999999Z",
+		"custom-time":      "2003-02-03T04:05:06.499999999Z",
+		"content-type":     "text/plain",
+		"content-encoding": "gzip",
+		"tier":             "STANDARD",
+		"potato":           "jersey royal",
+	}, metadata)
+}
+
+func TestApplyMetadata(t *testing.T) {
+	modTime := fstest.Time("2001-02-03T04:05:06.499999999Z")
+	for _, test := range []struct {
+		name           string
+		useCustomTime  bool
+		meta           fs.Metadata
+		wantMtime      string
+		wantCustomTime string
+	}{
+		{
+			name:      "none",
+			wantMtime: "2001-02-03T04:05:06.499999999Z",
+		}, {
+			name:           "useCustomTime",
+			useCustomTime:  true,
+			wantMtime:      "2001-02-03T04:05:06.499999999Z",
+			wantCustomTime: "2001-02-03T04:05:06.499999999Z",
+		}, {
+			name:           "mtime",
+			useCustomTime:  true,
+			meta:           fs.Metadata{"mtime": "2002-02-03T04:05:06.499999999+01:00"},
+			wantMtime:      "2002-02-03T04:05:06.499999999+01:00",
+			wantCustomTime: "2002-02-03T03:05:06.499999999Z",
+		}, {
+			name:           "custom-time",
+			meta:           fs.Metadata{"custom-time": "2003-02-03T04:05:06.499999999Z"},
+			wantMtime:      "2001-02-03T04:05:06.499999999Z",
+			wantCustomTime: "2003-02-03T04:05:06.499999999Z",
+		}, {
+			name:           "custom-time with useCustomTime",
+			useCustomTime:  true,
+			meta:           fs.Metadata{"custom-time": "2003-02-03T04:05:06.499999999Z"},
+			wantMtime:      "2001-02-03T04:05:06.499999999Z",
+			wantCustomTime: "2003-02-03T04:05:06.499999999Z",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			o := &Object{fs: &Fs{opt: Options{UseCustomTime: test.useCustomTime}}}
+			var object storage.Object
+			o.applyMetadata(&object, test.meta, modTime)
+			assert.Equal(t, test.wantMtime, object.Metadata[metaMtime])
+			assert.Equal(t, test.wantCustomTime, object.CustomTime)
+		})
+	}
+
+	// Check system and user metadata
+	o := &Object{fs: &Fs{}}
+	var object storage.Object
+	o.applyMetadata(&object, fs.Metadata{
+		"cache-control":       "no-cache",
+		"content-disposition": "inline",
+		"content-encoding":    "gzip",
+		"content-language":    "en-GB",
+		"content-type":        "text/html",
+		"tier":                "COLDLINE",
+		"btime":               "2000-02-03T04:05:06.499999999Z",
+		"potato":              "maris piper",
+	}, modTime)
+	assert.Equal(t, "no-cache", object.CacheControl)
+	assert.Equal(t, "inline", object.ContentDisposition)
+	assert.Equal(t, "gzip", object.ContentEncoding)
+	assert.Equal(t, "en-GB", object.ContentLanguage)
+	assert.Equal(t, "text/html", object.ContentType)
+	assert.Equal(t, "", object.StorageClass)
+	assert.Equal(t, map[string]string{
+		metaMtime:       "2001-02-03T04:05:06.499999999Z",
+		metaMtimeGsutil: "981173106",
+		"potato":        "maris piper",
+	}, object.Metadata)
+}
+
+func TestSetCustomTime(t *testing.T) {
+	t1 := fstest.Time("2001-02-03T04:05:06.499999999Z")
+	t2 := t1.Add(time.Hour)
+	var object storage.Object
+	require.NoError(t, setCustomTime(&object, t1))
+	assert.Equal(t, "2001-02-03T04:05:06.499999999Z", object.CustomTime)
+	require.NoError(t, setCustomTime(&object, t2))
+	assert.Equal(t, "2001-02-03T05:05:06.499999999Z", object.CustomTime)
+	assert.Equal(t, fs.ErrorCantSetModTimeWithoutDelete, setCustomTime(&object, t1))
+	assert.Equal(t, "2001-02-03T05:05:06.499999999Z", object.CustomTime)
+}
@@ -75,6 +75,9 @@ netbsd, macOS and Solaris. It is **not** supported on Windows yet
 User metadata is stored as extended attributes (which may not be
 supported by all file systems) under the "user.*" prefix.
 
+Extended attributes in other namespaces, such as "security.*", can be
+preserved too with the ` + "`--local-xattr`" + ` flag.
+
 Metadata is supported on files and directories.
 `,
 		},
@@ -270,6 +273,27 @@ only useful for reading.
 				Value: cTime.String(),
 				Help:  "The last status change time.",
 			}},
+		}, {
+			Name: "xattr",
+			Help: `Comma separated list of extra xattr namespaces to preserve as metadata.
+
+Normally only extended attributes in the "user" namespace are read and
+written as metadata, named without the "user." prefix.
+
+Set this to preserve the extended attributes in other namespaces too,
+for example "security" to keep SELinux labels. These are named in the
+metadata with their namespace, e.g. "security.selinux". Without this
+set on the destination, such metadata is stored in the "user" namespace
+instead, e.g. as "user.security.selinux".
+
+Writing to namespaces other than "user" usually needs extra
+privileges. If the destination can't store an extended attribute, for
+example because of permissions or its size, rclone will log a warning
+and carry on.
+
+Use this with ` + "`--metadata`" + ` for it to have any effect.`,
+			Default:  fs.CommaSepList{},
+			Advanced: true,
 		}, {
 			Name:     config.ConfigEncoding,
 			Help:     config.ConfigEncodingHelp,
@@ -295,6 +319,7 @@ type Options struct {
 	NoSparse          bool                 `config:"no_sparse"`
 	NoSetModTime      bool                 `config:"no_set_modtime"`
 	TimeType          timeType             `config:"time_type"`
+	Xattr             fs.CommaSepList      `config:"xattr"`
 	Enc               encoder.MultiEncoder `config:"encoding"`
 }
 
@@ -310,6 +335,7 @@ type Fs struct {
 	warnedMu       sync.Mutex          // used for locking access to 'warned'.
 	warned         map[string]struct{} // whether we have warned about this string
 	xattrSupported atomic.Int32        // whether xattrs are supported
+	xattrNS        []string            // extra xattr namespaces to preserve with "." suffix
 
 	// do os.Lstat or os.Stat
 	lstat        func(name string) (os.FileInfo, error)
@@ -325,6 +351,7 @@ type Object struct {
 	size    int64 // file metadata - always present
 	mode    os.FileMode
 	modTime time.Time
+	inode   string               // device and inode numbers or "" if unknown
 	hashes  map[hash.Type]string // Hashes
 	// these are read only and don't need the mutex held
 	translatedLink bool // Is this object a translated link
@@ -364,6 +391,15 @@ func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, e
 	if xattrSupported {
 		f.xattrSupported.Store(1)
 	}
+	for _, item := range f.opt.Xattr {
+		ns := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(item)), ".")
+		if ns == "" || strings.Contains(ns, ".") {
+			return nil, fmt.Errorf("invalid xattr namespace %q", item)
+		}
+		if ns+"." != xattrPrefix {
+			f.xattrNS = append(f.xattrNS, ns+".")
+		}
+	}
 	f.root = cleanRootPath(root, f.opt.NoUNC, f.opt.Enc)
 	f.features = (&fs.Features{
 		CaseInsensitive:          f.caseInsensitive(),
@@ -542,7 +578,7 @@ func (f *Fs) newDirectory(dir string, fi os.FileInfo) *Directory {
 // This should return ErrDirNotFound if the directory isn't
 // found.
 func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
-	filter, useFilter := filter.GetConfig(ctx), filter.GetUseFilter(ctx)
+	filter, useFilter, countExcluded := filter.GetConfig(ctx), filter.GetUseFilter(ctx), filter.GetCountExcluded(ctx)
 
 	fsDirPath := f.localPath(dir)
 	_, err = os.Stat(fsDirPath)
@@ -653,6 +689,9 @@ func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err e
 				// Don't include non directory if not included
 				// we leave directory filtering to the layer above
 				if useFilter && !filter.IncludeRemote(newRemote) {
+					if countExcluded {
+						accounting.Stats(ctx).Skipped(accounting.SkipFiltered, 1)
+					}
 					continue
 				}
 				fso, err := f.newObjectWithInfo(newRemote, fi)
@@ -1070,32 +1109,39 @@ func (o *Object) Hash(ctx context.Context, r hash.Type) (string, error) {
 	o.fs.objectMetaMu.RUnlock()
 
 	if changed || !hashFound {
-		var in io.ReadCloser
-
-		if !o.translatedLink {
-			var fd *os.File
-			fd, err = file.Open(o.path)
-			if fd != nil {
-				in = newFadviseReadCloser(o, fd, 0, 0)
+		var hashes map[hash.Type]string
+		if o.canHashBlocks(ctx, r) {
+			hashes, err = o.hashBlocks(ctx, r)
+			if err != nil {
+				return "", err
 			}
 		} else {
-			in, err = o.openTranslatedLink(0, -1)
-		}
-		// If not checking for updates, only read size given
-		if o.fs.opt.NoCheckUpdated {
-			in = readers.NewLimitedReadCloser(in, o.size)
-		}
-		if err != nil {
-			return "", fmt.Errorf("hash: failed to open: %w", err)
-		}
-		var hashes map[hash.Type]string
-		hashes, err = hash.StreamTypes(readers.NewContextReader(ctx, in), hash.NewHashSet(r))
-		closeErr := in.Close()
-		if err != nil {
-			return "", fmt.Errorf("hash: failed to read: %w", err)
-		}
-		if closeErr != nil {
-			return "", fmt.Errorf("hash: failed to close: %w", closeErr)
+			var in io.ReadCloser
+
+			if !o.translatedLink {
+				var fd *os.File
+				fd, err = file.Open(o.path)
+				if fd != nil {
+					in = newFadviseReadCloser(o, fd, 0, 0)
+				}
+			} else {
+				in, err = o.openTranslatedLink(0, -1)
+			}
+			// If not checking for updates, only read size given
+			if o.fs.opt.NoCheckUpdated {
+				in = readers.NewLimitedReadCloser(in, o.size)
+			}
+			if err != nil {
+				return "", fmt.Errorf("hash: failed to open: %w", err)
+			}
+			hashes, err = hash.StreamTypes(readers.NewContextReader(ctx, in), hash.NewHashSet(r))
+			closeErr := in.Close()
+			if err != nil {
+				return "", fmt.Errorf("hash: failed to read: %w", err)
+			}
+			if closeErr != nil {
+				return "", fmt.Errorf("hash: failed to close: %w", closeErr)
+			}
 		}
 		hashValue = hashes[r]
 		o.fs.objectMetaMu.Lock()
@@ -1109,6 +1155,39 @@ func (o *Object) Hash(ctx context.Context, r hash.Type) (string, error) {
 	return hashValue, nil
 }
 
+// canHashBlocks returns true if hash r of the object can be
+// calculated by hashing --multi-thread-hash blocks of it at once
+func (o *Object) canHashBlocks(ctx context.Context, r hash.Type) bool {
+	blockSize := hash.BlockSize(r)
+	if blockSize <= 0 || o.translatedLink || fs.GetConfig(ctx).MultiThreadHash <= 1 {
+		return false
+	}
+	o.fs.objectMetaMu.RLock()
+	defer o.fs.objectMetaMu.RUnlock()
+	return o.size > blockSize
+}
+
+// hashBlocks calculates hash r of the object by hashing
+// --multi-thread-hash blocks of it at once
+func (o *Object) hashBlocks(ctx context.Context, r hash.Type) (map[hash.Type]string, error) {
+	fd, err := file.Open(o.path)
+	if err != nil {
+		return nil, fmt.Errorf("hash: failed to open: %w", err)
+	}
+	o.fs.objectMetaMu.RLock()
+	size := o.size
+	o.fs.objectMetaMu.RUnlock()
+	hashValue, err := hash.StreamParallel(ctx, fd, size, r, fs.GetConfig(ctx).MultiThreadHash)
+	closeErr := fd.Close()
+	if err != nil {
+		return nil, fmt.Errorf("hash: failed to read: %w", err)
+	}
+	if closeErr != nil {
+		return nil, fmt.Errorf("hash: failed to close: %w", closeErr)
+	}
+	return map[hash.Type]string{r: hashValue}, nil
+}
+
 // Size returns the size of an object in bytes
 func (o *Object) Size() int64 {
 	o.fs.objectMetaMu.RLock()
@@ -1123,6 +1202,14 @@ func (o *Object) ModTime(ctx context.Context) time.Time {
 	return o.modTime
 }
 
+// Inode returns the device and inode numbers of the object as a
+// string or "" if not known
+func (o *Object) Inode() string {
+	o.fs.objectMetaMu.RLock()
+	defer o.fs.objectMetaMu.RUnlock()
+	return o.inode
+}
+
 // Set the atime and ltime of the object
 func (o *Object) setTimes(atime, mtime time.Time) (err error) {
 	if o.translatedLink {
@@ -1424,6 +1511,11 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 	if err != nil {
 		return fmt.Errorf("failed to read metadata from source object: %w", err)
 	}
+	if _, found := meta["btime"]; found && !haveSetBTime && fs.GetConfig(ctx).PreserveBirthtime {
+		warnBirthtime.Do(func() {
+			fs.Logf(o.fs, "Can't set the birth (creation) time on %s so --preserve-birthtime is ignored", runtime.GOOS)
+		})
+	}
 	err = o.writeMetadata(meta)
 	if err != nil {
 		return fmt.Errorf("failed to set metadata: %w", err)
@@ -1433,7 +1525,10 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 	return o.lstat()
 }
 
-var sparseWarning sync.Once
+var (
+	sparseWarning sync.Once
+	warnBirthtime sync.Once
+)
 
 // OpenWriterAt opens with a handle for random access writes
 //
@@ -1488,6 +1583,7 @@ func (o *Object) setMetadata(info os.FileInfo) {
 	o.size = info.Size()
 	o.modTime = readTime(o.fs.opt.TimeType, info)
 	o.mode = info.Mode()
+	o.inode = readInode(info)
 	o.fs.objectMetaMu.Unlock()
 	// Read the size of the link.
 	//
@@ -1629,6 +1725,7 @@ var (
 	_ fs.MkdirMetadataer = &Fs{}
 	_ fs.Object          = &Object{}
 	_ fs.Metadataer      = &Object{}
+	_ fs.Inoder          = &Object{}
 	_ fs.Directory       = &Directory{}
 	_ fs.SetModTimer     = &Directory{}
 	_ fs.SetMetadataer   = &Directory{}
@@ -380,6 +380,85 @@ func TestMetadata(t *testing.T) {
 
 }
 
+// Test xattrs in other namespaces are copied with --local-xattr
+func TestMetadataXattrNamespaces(t *testing.T) {
+	if !xattrSupported {
+		t.Skip("xattrs not supported on this OS")
+	}
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	ci.Metadata = true
+	r := fstest.NewRun(t)
+	const filePath = "xattrfile.txt"
+	when := time.Now()
+	r.WriteFile(filePath, "xattr file contents", when)
+
+	newFs := func(dir string, m configmap.Simple) *Fs {
+		f, err := NewFs(ctx, "local", dir, m)
+		require.NoError(t, err)
+		return f.(*Fs)
+	}
+	getXattr := func(f *Fs, remote string) fs.Metadata {
+		obj, err := f.NewObject(ctx, remote)
+		require.NoError(t, err)
+		m, err := obj.(*Object).getXattr()
+		require.NoError(t, err)
+		return m
+	}
+	srcDir := r.Flocal.Root()
+	fsrc := newFs(srcDir, configmap.Simple{"xattr": "trusted,security"})
+	obj, err := fsrc.NewObject(ctx, filePath)
+	require.NoError(t, err)
+	o := obj.(*Object)
+
+	// Setting xattrs outside the user namespace needs privileges
+	large := string(bytes.Repeat([]byte{'x'}, xattrMaxSize+1))
+	require.NoError(t, o.setXattr(fs.Metadata{
+		"potato":         "chips",
+		"trusted.rclone": "trusted value",
+		"cabbage":        large,
+	}))
+	m, err := o.getXattr()
+	require.NoError(t, err)
+	if m["trusted.rclone"] == "" {
+		t.Skip("can't set trusted xattrs - need to run as root")
+	}
+	assert.Equal(t, fs.Metadata{"potato": "chips", "trusted.rclone": "trusted value"}, m, "too large xattr must be skipped")
+
+	// Without the option only the user namespace is read
+	assert.Equal(t, fs.Metadata{"potato": "chips"}, getXattr(newFs(srcDir, configmap.Simple{}), filePath))
+
+	// Xattrs which aren't read leave empty rather than nil metadata
+	r.WriteFile("trusted only", "content", when)
+	obj, err = fsrc.NewObject(ctx, "trusted only")
+	require.NoError(t, err)
+	require.NoError(t, obj.(*Object).setXattr(fs.Metadata{"trusted.rclone": "trusted value"}))
+	m = getXattr(newFs(srcDir, configmap.Simple{}), "trusted only")
+	assert.NotNil(t, m)
+	assert.Equal(t, fs.Metadata{}, m)
+
+	// Round trip the xattrs with a copy
+	want := fs.Metadata{"potato": "chips", "trusted.rclone": "trusted value"}
+	dstDir := t.TempDir()
+	fdst := newFs(dstDir, configmap.Simple{"xattr": "trusted"})
+	dst, err := operations.Copy(ctx, fdst, nil, filePath, o)
+	require.NoError(t, err)
+	assert.Equal(t, want, getXattr(fdst, dst.Remote()))
+	// The trusted xattr must be stored in its own namespace
+	assert.Equal(t, fs.Metadata{"potato": "chips"}, getXattr(newFs(dstDir, configmap.Simple{}), dst.Remote()))
+
+	// Without the option the destination stores it as a user xattr
+	dstDir = t.TempDir()
+	fdst = newFs(dstDir, configmap.Simple{})
+	dst, err = operations.Copy(ctx, fdst, nil, filePath, o)
+	require.NoError(t, err)
+	assert.Equal(t, want, getXattr(fdst, dst.Remote()))
+
+	// Check invalid namespaces are refused
+	_, err = NewFs(ctx, "local", srcDir, configmap.Simple{"xattr": "trusted.x"})
+	assert.ErrorContains(t, err, "invalid xattr namespace")
+}
+
 func TestFilter(t *testing.T) {
 	ctx := context.Background()
 	r := fstest.NewRun(t)
@@ -6,6 +6,7 @@
 package local
 
 import (
+	"fmt"
 	"os"
 	"syscall"
 
@@ -25,3 +26,13 @@ func readDevice(fi os.FileInfo, oneFileSystem bool) uint64 {
 	}
 	return uint64(statT.Dev) // nolint: unconvert
 }
+
+// readInode turns a valid os.FileInfo into a string made from the
+// device and inode numbers, returning "" if it fails.
+func readInode(fi os.FileInfo) string {
+	statT, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", uint64(statT.Dev), uint64(statT.Ino)) // nolint: unconvert
+}
@@ -15,6 +15,7 @@ import (
 const (
 	xattrPrefix    = "user." // FIXME is this correct for all unixes?
 	xattrSupported = xattr.XATTR_SUPPORTED
+	xattrMaxSize   = 64 * 1024 // largest xattr value linux can store
 )
 
 // Check to see if the error supplied is a not supported error, and if
@@ -35,6 +36,64 @@ func (f *Fs) xattrIsNotSupported(err error) bool {
 	return false
 }
 
+// xattrKey returns the metadata key for the xattr name or "" if it
+// shouldn't be read as metadata.
+//
+// Xattrs in the user namespace have the namespace removed and those in
+// the namespaces set with --local-xattr keep it.
+func (f *Fs) xattrKey(name string) string {
+	name = strings.ToLower(name)
+	if strings.HasPrefix(name, xattrPrefix) {
+		key := name[len(xattrPrefix):]
+		if _, found := systemMetadataInfo[key]; found {
+			return ""
+		}
+		return key
+	}
+	for _, ns := range f.xattrNS {
+		if strings.HasPrefix(name, ns) {
+			return name
+		}
+	}
+	return ""
+}
+
+// xattrName returns the xattr name to store the metadata key under and
+// whether it is in the user namespace
+func (f *Fs) xattrName(key string) (name string, user bool) {
+	for _, ns := range f.xattrNS {
+		if strings.HasPrefix(key, ns) {
+			return key, false
+		}
+	}
+	return xattrPrefix + key, true
+}
+
+// xattrCantStore returns true if err means the xattr name can't be
+// stored on this file, in which case it warns and the xattr should be
+// skipped.
+//
+// Failing to write an xattr outside the user namespace, for example
+// because of permissions, or one which is too large isn't fatal as the
+// file system may not allow it even though it supports xattrs.
+func (o *Object) xattrCantStore(name string, user bool, err error) bool {
+	xattrErr, ok := err.(*xattr.Error)
+	if !ok {
+		return false
+	}
+	switch xattrErr.Err {
+	case syscall.E2BIG, syscall.ENOSPC, syscall.ERANGE:
+	case syscall.EPERM, syscall.EACCES, syscall.EINVAL, syscall.ENOTSUP:
+		if user {
+			return false
+		}
+	default:
+		return false
+	}
+	fs.Logf(o, "Destination can't store xattr %q - skipping: %v", name, xattrErr.Err)
+	return true
+}
+
 // getXattr returns the extended attributes for an object
 //
 // It doesn't return any attributes owned by this backend in
@@ -60,6 +119,10 @@ func (o *Object) getXattr() (metadata fs.Metadata, err error) {
 	}
 	metadata = make(fs.Metadata, len(list))
 	for _, k := range list {
+		key := o.fs.xattrKey(k)
+		if key == "" {
+			continue
+		}
 		var v []byte
 		if o.fs.opt.FollowSymlinks {
 			v, err = xattr.Get(o.path, k)
@@ -72,15 +135,7 @@ func (o *Object) getXattr() (metadata fs.Metadata, err error) {
 			}
 			return nil, fmt.Errorf("failed to read xattr key %q: %w", k, err)
 		}
-		k = strings.ToLower(k)
-		if !strings.HasPrefix(k, xattrPrefix) {
-			continue
-		}
-		k = k[len(xattrPrefix):]
-		if _, found := systemMetadataInfo[k]; found {
-			continue
-		}
-		metadata[k] = string(v)
+		metadata[key] = string(v)
 	}
 	return metadata, nil
 }
@@ -97,7 +152,11 @@ func (o *Object) setXattr(metadata fs.Metadata) (err error) {
 		if _, found := systemMetadataInfo[k]; found {
 			continue
 		}
-		k = xattrPrefix + k
+		k, user := o.fs.xattrName(k)
+		if len(value) > xattrMaxSize {
+			fs.Logf(o, "Destination can't store xattr %q - skipping: value is %d bytes, more than the maximum %d", k, len(value), xattrMaxSize)
+			continue
+		}
 		v := []byte(value)
 		if o.fs.opt.FollowSymlinks {
 			err = xattr.Set(o.path, k, v)
@@ -105,6 +164,9 @@ func (o *Object) setXattr(metadata fs.Metadata) (err error) {
 			err = xattr.LSet(o.path, k, v)
 		}
 		if err != nil {
+			if o.xattrCantStore(k, user, err) {
+				continue
+			}
 			if o.fs.xattrIsNotSupported(err) {
 				return nil
 			}
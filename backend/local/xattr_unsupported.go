@@ -7,7 +7,9 @@ package local
 import "github.com/rclone/rclone/fs"
 
 const (
+	xattrPrefix    = "user."
 	xattrSupported = false
+	xattrMaxSize   = 64 * 1024
 )
 
 // getXattr returns the extended attributes for an object
@@ -0,0 +1,551 @@
+// Package mirror implements a backend which writes to two remotes at
+// once and reads from the first with failover to the second.
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/hash"
+	"golang.org/x/sync/errgroup"
+)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "mirror",
+		Description: "Mirror writes to two remotes",
+		NewFs:       NewFs,
+		Options: []fs.Option{{
+			Name: "primary",
+			Help: `Remote to read from and write to.
+
+Normally should contain a ':' and a path, e.g. "myremote:path/to/dir",
+"myremote:bucket" or maybe "myremote:" (not recommended).`,
+			Required: true,
+		}, {
+			Name: "secondary",
+			Help: `Remote to write to and to read from if the primary fails.
+
+Normally should contain a ':' and a path, e.g. "myremote:path/to/dir",
+"myremote:bucket" or maybe "myremote:" (not recommended).`,
+			Required: true,
+		}, {
+			Name: "secondary_timeout",
+			Help: `Max time to wait for the secondary to take more data when uploading.
+
+If the upload to the secondary doesn't take any data for this long
+then it is given up on and the upload fails, unless
+allow_secondary_failure is set.
+
+Set to 0 to wait for the secondary as long as it takes.`,
+			Default:  fs.Duration(time.Minute),
+			Advanced: true,
+		}, {
+			Name: "allow_secondary_failure",
+			Help: `Carry on uploading to the primary if the upload to the secondary fails.
+
+Normally an upload fails if the upload to either remote fails. If
+this is set then when the upload to the secondary fails, or times
+out, rclone carries on uploading to the primary only, so a slow or
+broken secondary doesn't hold up the primary. The error is logged and
+counted, and the file will be missing or out of date on the secondary
+until it is next synced.`,
+			Default:  false,
+			Advanced: true,
+		}},
+	})
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	Primary               string      `config:"primary"`
+	Secondary             string      `config:"secondary"`
+	SecondaryTimeout      fs.Duration `config:"secondary_timeout"`
+	AllowSecondaryFailure bool        `config:"allow_secondary_failure"`
+}
+
+// Fs represents a mirror of two remotes
+type Fs struct {
+	name      string       // name of this remote
+	root      string       // the path we are working on
+	opt       Options      // options for this Fs
+	features  *fs.Features // optional features
+	primary   fs.Fs        // remote to read from and write to
+	secondary fs.Fs        // remote to write to and read from on failure
+	hashSet   hash.Set     // hashes supported by both remotes
+}
+
+// NewFs constructs an Fs from the path.
+//
+// The returned Fs is the actual Fs, referenced by remote in the config
+func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (outFs fs.Fs, err error) {
+	// Parse config into Options struct
+	opt := new(Options)
+	err = configstruct.Set(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	for _, remote := range []string{opt.Primary, opt.Secondary} {
+		if remote == "" {
+			return nil, errors.New("mirror can't point to an empty remote - check the value of the primary and secondary settings")
+		}
+		if strings.HasPrefix(remote, name+":") {
+			return nil, errors.New("can't point mirror remote at itself - check the value of the primary and secondary settings")
+		}
+	}
+	f := &Fs{
+		name: name,
+		root: root,
+		opt:  *opt,
+	}
+	var isFile bool
+	f.primary, err = cache.Get(ctx, fspath.JoinRootPath(opt.Primary, root))
+	if err == fs.ErrorIsFile {
+		// The primary is rooted at the parent so root the
+		// secondary there too
+		isFile = true
+		f.root = path.Dir(root)
+		if f.root == "." || f.root == "/" {
+			f.root = ""
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to make primary remote %q: %w", opt.Primary, err)
+	}
+	f.secondary, err = cache.Get(ctx, fspath.JoinRootPath(opt.Secondary, f.root))
+	if err != nil && err != fs.ErrorIsFile {
+		return nil, fmt.Errorf("failed to make secondary remote %q: %w", opt.Secondary, err)
+	}
+	if err == fs.ErrorIsFile && !isFile {
+		return nil, fmt.Errorf("secondary remote %q is a file but primary %q isn't", opt.Secondary, opt.Primary)
+	}
+	// Pin both remotes into the cache until f is garbage collected
+	cache.Pin(f.primary)
+	cache.Pin(f.secondary)
+	runtime.SetFinalizer(f, func(f *Fs) {
+		cache.Unpin(f.primary)
+		cache.Unpin(f.secondary)
+	})
+
+	f.hashSet = f.primary.Hashes().Overlap(f.secondary.Hashes())
+	f.features = (&fs.Features{
+		CaseInsensitive:         true,
+		DuplicateFiles:          false,
+		CanHaveEmptyDirectories: true,
+		BucketBased:             true,
+	}).Fill(ctx, f).Mask(ctx, f.primary).Mask(ctx, f.secondary)
+	// The mirror is case insensitive if either remote is
+	f.features.CaseInsensitive = f.primary.Features().CaseInsensitive || f.secondary.Features().CaseInsensitive
+
+	if isFile {
+		return f, fs.ErrorIsFile
+	}
+	return f, nil
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// String converts this Fs to a string
+func (f *Fs) String() string {
+	return fmt.Sprintf("mirror root '%s'", f.root)
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// Precision is the greatest precision of the two remotes
+func (f *Fs) Precision() time.Duration {
+	precision := f.primary.Precision()
+	if secondary := f.secondary.Precision(); secondary > precision {
+		precision = secondary
+	}
+	return precision
+}
+
+// Hashes returns the hashes supported by both remotes
+func (f *Fs) Hashes() hash.Set {
+	return f.hashSet
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// This lists the primary, failing over to the secondary if the
+// listing fails.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	u := f.primary
+	entries, err = u.List(ctx, dir)
+	if err != nil && err != fs.ErrorDirNotFound {
+		fs.Errorf(f.primary, "Failed to list %q - trying secondary: %v", dir, err)
+		u = f.secondary
+		entries, err = u.List(ctx, dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, entry := range entries {
+		if o, ok := entry.(fs.Object); ok {
+			entries[i] = f.newObject(o)
+		}
+	}
+	return entries, nil
+}
+
+// NewObject finds the Object at remote.  If it can't be found
+// it returns the error fs.ErrorObjectNotFound.
+//
+// This finds the Object on the primary, failing over to the
+// secondary if that fails with an error other than not found.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	o, err := f.primary.NewObject(ctx, remote)
+	if err != nil && err != fs.ErrorObjectNotFound && err != fs.ErrorIsDir {
+		fs.Errorf(f.primary, "Failed to find %q - trying secondary: %v", remote, err)
+		o, err = f.secondary.NewObject(ctx, remote)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(o), nil
+}
+
+// putFn uploads in to the remote u returning the object and whether
+// it was created by the upload
+type putFn func(ctx context.Context, u fs.Fs, in io.Reader) (o fs.Object, created bool, err error)
+
+// errSecondaryTimeout is returned when the secondary doesn't take
+// the data in time
+var errSecondaryTimeout = errors.New("secondary didn't take any data in time")
+
+// secondaryWriter writes the data to the pipe to the upload to the
+// secondary.
+//
+// If the upload doesn't take the data within the timeout, or fails,
+// then the secondary is given up on and the rest of the data is
+// discarded so the upload to the primary isn't held up.
+type secondaryWriter struct {
+	out      *io.PipeWriter
+	in       *io.PipeReader
+	timeout  time.Duration      // max time to wait for a write - 0 for no limit
+	cancel   context.CancelFunc // cancels the upload to the secondary
+	failed   bool               // set if the secondary has been given up on
+	timedOut bool               // set if that was because of the timeout
+}
+
+// Write p to the secondary, never returning an error
+func (w *secondaryWriter) Write(p []byte) (int, error) {
+	if w.failed {
+		return len(p), nil
+	}
+	if w.timeout <= 0 {
+		if _, err := w.out.Write(p); err != nil {
+			w.failed = true
+		}
+		return len(p), nil
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := w.out.Write(p)
+		done <- err
+	}()
+	timer := time.NewTimer(w.timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		if err != nil {
+			w.failed = true
+		}
+	case <-timer.C:
+		w.failed, w.timedOut = true, true
+		_ = w.in.CloseWithError(errSecondaryTimeout)
+		w.cancel()
+		// wait for the write to stop using p
+		<-done
+	}
+	return len(p), nil
+}
+
+// mirror reads in once, uploading it to both remotes at the same time
+// with put.
+//
+// If the upload to the primary fails it returns an error, removing
+// the object on the secondary if the upload created it. If the upload
+// to the secondary fails or is too slow then it is given up on and
+// the upload to the primary carries on, returning an error once it
+// has finished unless allow_secondary_failure is set, in which case
+// the error is logged and counted. Otherwise it returns the Object on
+// the primary.
+func (f *Fs) mirror(ctx context.Context, in io.Reader, put putFn) (*Object, error) {
+	primaryIn, primaryOut := io.Pipe()
+	secondaryIn, secondaryOut := io.Pipe()
+	secondaryCtx, cancelSecondary := context.WithCancel(ctx)
+	defer cancelSecondary()
+	secondary := &secondaryWriter{
+		out:     secondaryOut,
+		in:      secondaryIn,
+		timeout: time.Duration(f.opt.SecondaryTimeout),
+		cancel:  cancelSecondary,
+	}
+	copyDone := make(chan struct{})
+	go func() {
+		defer close(copyDone)
+		_, err := io.Copy(io.MultiWriter(primaryOut, secondary), in)
+		// a nil error closes the pipes with io.EOF
+		_ = primaryOut.CloseWithError(err)
+		_ = secondaryOut.CloseWithError(err)
+	}()
+	var (
+		wg                       sync.WaitGroup
+		primaryObject            fs.Object
+		secondaryObject          fs.Object
+		secondaryCreated         bool
+		primaryErr, secondaryErr error
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		primaryObject, _, primaryErr = put(ctx, f.primary, primaryIn)
+		if primaryErr != nil {
+			primaryErr = fmt.Errorf("%v: %w", f.primary, primaryErr)
+			// stop the copy and the other upload
+			_ = primaryIn.CloseWithError(primaryErr)
+			cancelSecondary()
+			return
+		}
+		// unblock the copy if the upload didn't read all the data
+		_ = primaryIn.CloseWithError(io.ErrClosedPipe)
+	}()
+	go func() {
+		defer wg.Done()
+		secondaryObject, secondaryCreated, secondaryErr = put(secondaryCtx, f.secondary, secondaryIn)
+		// unblock the copy if the upload failed or didn't read
+		// all the data
+		_ = secondaryIn.CloseWithError(io.ErrClosedPipe)
+	}()
+	wg.Wait()
+	// Both readers are closed now so the copy will finish
+	<-copyDone
+	if primaryErr != nil {
+		if secondaryErr == nil && secondaryCreated {
+			// Don't leave the object only on the secondary
+			if err := secondaryObject.Remove(ctx); err != nil {
+				fs.Errorf(secondaryObject, "Failed to remove after failed upload to primary: %v", err)
+			}
+		}
+		return nil, primaryErr
+	}
+	if secondaryErr != nil {
+		if secondary.timedOut {
+			secondaryErr = fmt.Errorf("no data taken for %v: %w", secondary.timeout, secondaryErr)
+		}
+		if !f.opt.AllowSecondaryFailure {
+			return nil, fmt.Errorf("failed to upload to secondary %v: %w", f.secondary, secondaryErr)
+		}
+		err := fmt.Errorf("failed to upload to secondary %v - file is only on the primary: %w", f.secondary, secondaryErr)
+		fs.Errorf(primaryObject, "%v", err)
+		// Count the error to fail the sync, but retrying won't
+		// help as the file is on the primary now
+		_ = accounting.Stats(ctx).Error(fserrors.NoRetryError(err))
+	}
+	return f.newObject(primaryObject), nil
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// The data is read once and uploaded to both remotes.
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.mirror(ctx, in, func(ctx context.Context, u fs.Fs, in io.Reader) (fs.Object, bool, error) {
+		o, err := u.Put(ctx, in, src, options...)
+		return o, true, err
+	})
+}
+
+// PutStream uploads to the remote path with the modTime given of indeterminate size
+//
+// The data is read once and uploaded to both remotes.
+func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.mirror(ctx, in, func(ctx context.Context, u fs.Fs, in io.Reader) (fs.Object, bool, error) {
+		o, err := u.Features().PutStream(ctx, in, src, options...)
+		return o, true, err
+	})
+}
+
+// both runs fn on the primary and secondary at the same time
+func (f *Fs) both(ctx context.Context, fn func(ctx context.Context, u fs.Fs) error) error {
+	g, gCtx := errgroup.WithContext(ctx)
+	for _, u := range []fs.Fs{f.primary, f.secondary} {
+		u := u
+		g.Go(func() error {
+			err := fn(gCtx, u)
+			if err != nil {
+				return fmt.Errorf("%v: %w", u, err)
+			}
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+// Mkdir makes the directory on both remotes
+//
+// Shouldn't return an error if it already exists
+func (f *Fs) Mkdir(ctx context.Context, dir string) error {
+	return f.both(ctx, func(ctx context.Context, u fs.Fs) error {
+		return u.Mkdir(ctx, dir)
+	})
+}
+
+// Rmdir removes the directory on both remotes
+//
+// Return an error if it doesn't exist or isn't empty
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	return f.both(ctx, func(ctx context.Context, u fs.Fs) error {
+		return u.Rmdir(ctx, dir)
+	})
+}
+
+// Object describes a mirrored object
+//
+// It embeds the Object on the primary, or the secondary if the
+// primary failed when it was found.
+type Object struct {
+	fs.Object
+	f *Fs
+}
+
+// newObject wraps o which is on one of the remotes
+func (f *Fs) newObject(o fs.Object) *Object {
+	return &Object{
+		Object: o,
+		f:      f,
+	}
+}
+
+// Fs returns the parent Fs
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// UnWrap returns the wrapped Object
+func (o *Object) UnWrap() fs.Object {
+	return o.Object
+}
+
+// onPrimary returns true if the wrapped Object is on the primary
+func (o *Object) onPrimary() bool {
+	return o.Object.Fs() == fs.Info(o.f.primary)
+}
+
+// upstreamObject returns the Object on u or nil if it doesn't exist
+func (o *Object) upstreamObject(ctx context.Context, u fs.Fs) (fs.Object, error) {
+	if o.Object.Fs() == fs.Info(u) {
+		return o.Object, nil
+	}
+	uo, err := u.NewObject(ctx, o.Remote())
+	if err == fs.ErrorObjectNotFound {
+		return nil, nil
+	}
+	return uo, err
+}
+
+// Open an object for read
+//
+// If opening the object on the primary fails, it is opened on the
+// secondary instead.
+func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	in, err := o.Object.Open(ctx, options...)
+	if err == nil || !o.onPrimary() {
+		return in, err
+	}
+	fs.Errorf(o, "Failed to open on primary - trying secondary: %v", err)
+	so, serr := o.f.secondary.NewObject(ctx, o.Remote())
+	if serr != nil {
+		return nil, fmt.Errorf("failed to open on primary: %w and failed to find on secondary: %v", err, serr)
+	}
+	return so.Open(ctx, options...)
+}
+
+// Update the object on both remotes with the contents of the
+// io.Reader, modTime and size
+//
+// The data is read once and uploaded to both remotes. If the object
+// is missing on one of the remotes then it is created.
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	newO, err := o.f.mirror(ctx, in, func(ctx context.Context, u fs.Fs, in io.Reader) (fs.Object, bool, error) {
+		uo, err := o.upstreamObject(ctx, u)
+		if err != nil {
+			return nil, false, err
+		}
+		if uo == nil {
+			uo, err = u.Put(ctx, in, src, options...)
+			return uo, true, err
+		}
+		return uo, false, uo.Update(ctx, in, src, options...)
+	})
+	if err != nil {
+		return err
+	}
+	o.Object = newO.Object
+	return nil
+}
+
+// SetModTime sets the modification time of the object on both remotes
+func (o *Object) SetModTime(ctx context.Context, modTime time.Time) error {
+	return o.f.both(ctx, func(ctx context.Context, u fs.Fs) error {
+		uo, err := o.upstreamObject(ctx, u)
+		if err != nil || uo == nil {
+			return err
+		}
+		return uo.SetModTime(ctx, modTime)
+	})
+}
+
+// Remove the object from both remotes
+func (o *Object) Remove(ctx context.Context) error {
+	return o.f.both(ctx, func(ctx context.Context, u fs.Fs) error {
+		uo, err := o.upstreamObject(ctx, u)
+		if err != nil || uo == nil {
+			return err
+		}
+		return uo.Remove(ctx)
+	})
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs              = (*Fs)(nil)
+	_ fs.PutStreamer     = (*Fs)(nil)
+	_ fs.Object          = (*Object)(nil)
+	_ fs.ObjectUnWrapper = (*Object)(nil)
+)
@@ -0,0 +1,177 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/lib/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeMirror makes a mirror of two local temporary directories with
+// the extra config passed in returning the mirror and the directories
+func makeMirror(t *testing.T, config ...string) (f fs.Fs, primary, secondary string) {
+	ctx := context.Background()
+	primary, secondary = t.TempDir(), t.TempDir()
+	m := configmap.Simple{
+		"primary":   primary,
+		"secondary": secondary,
+	}
+	for i := 0; i+1 < len(config); i += 2 {
+		m[config[i]] = config[i+1]
+	}
+	f, err := NewFs(ctx, "TestMirrorInternal", "", m)
+	require.NoError(t, err)
+	return f, primary, secondary
+}
+
+// exists returns true if remote exists in dir
+func exists(dir, remote string) bool {
+	_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(remote)))
+	return err == nil
+}
+
+// readFile reads the contents of the file at remote in dir
+func readFile(t *testing.T, dir, remote string) string {
+	data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(remote)))
+	require.NoError(t, err)
+	return string(data)
+}
+
+// put uploads contents to remote on f
+func put(ctx context.Context, t *testing.T, f fs.Fs, remote, contents string) (fs.Object, error) {
+	src := object.NewStaticObjectInfo(remote, fstest.Time("2001-02-03T04:05:06.499999999Z"), int64(len(contents)), true, nil, nil)
+	return f.Put(ctx, bytes.NewBufferString(contents), src)
+}
+
+func TestMirrorWritesBoth(t *testing.T) {
+	ctx := context.Background()
+	f, primary, secondary := makeMirror(t)
+
+	o, err := put(ctx, t, f, "dir/file.txt", "hello mirror")
+	require.NoError(t, err)
+	assert.Equal(t, "dir/file.txt", o.Remote())
+	assert.Equal(t, "hello mirror", readFile(t, primary, "dir/file.txt"))
+	assert.Equal(t, "hello mirror", readFile(t, secondary, "dir/file.txt"))
+
+	// Update writes both too
+	newContents := "hello again mirror"
+	src := object.NewStaticObjectInfo("dir/file.txt", fstest.Time("2002-02-03T04:05:06.499999999Z"), int64(len(newContents)), true, nil, nil)
+	require.NoError(t, o.Update(ctx, bytes.NewBufferString(newContents), src))
+	assert.Equal(t, newContents, readFile(t, primary, "dir/file.txt"))
+	assert.Equal(t, newContents, readFile(t, secondary, "dir/file.txt"))
+
+	// Remove removes from both
+	require.NoError(t, o.Remove(ctx))
+	for _, dir := range []string{primary, secondary} {
+		_, err := os.Stat(filepath.Join(dir, "dir", "file.txt"))
+		assert.True(t, os.IsNotExist(err), dir)
+	}
+}
+
+func TestMirrorWriteFails(t *testing.T) {
+	ctx := context.Background()
+	f, primary, secondary := makeMirror(t)
+
+	// Make a directory where the file should go on the secondary
+	// so the upload there fails
+	require.NoError(t, os.MkdirAll(filepath.Join(secondary, "file.txt"), 0777))
+
+	// A failure on the secondary fails the upload
+	_, err := put(ctx, t, f, "file.txt", "hello mirror")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), secondary)
+
+	// A failure on the primary fails the upload and the file isn't
+	// left on the secondary
+	require.NoError(t, os.MkdirAll(filepath.Join(primary, "file2.txt"), 0777))
+	_, err = put(ctx, t, f, "file2.txt", "hello mirror")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), primary)
+	assert.False(t, exists(secondary, "file2.txt"))
+}
+
+func TestMirrorAllowSecondaryFailure(t *testing.T) {
+	ctx := context.Background()
+	f, primary, secondary := makeMirror(t, "allow_secondary_failure", "true")
+	require.NoError(t, os.MkdirAll(filepath.Join(secondary, "file.txt"), 0777))
+
+	// The upload carries on to the primary and the error is counted
+	ctx = accounting.WithStatsGroup(ctx, "TestMirrorAllowSecondaryFailure")
+	_, err := put(ctx, t, f, "file.txt", "hello mirror")
+	require.NoError(t, err)
+	assert.Equal(t, "hello mirror", readFile(t, primary, "file.txt"))
+	assert.Equal(t, int64(1), accounting.Stats(ctx).GetErrors())
+}
+
+// hangingFs is an fs.Fs whose uploads never read any data
+type hangingFs struct {
+	fs.Fs
+}
+
+// Put waits until the context is cancelled without reading in
+func (f hangingFs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestMirrorSecondaryTimeout(t *testing.T) {
+	ctx := context.Background()
+	contents := random.String(1024 * 1024)
+	for _, allowFailure := range []bool{false, true} {
+		t.Run(fmt.Sprintf("allow_secondary_failure=%v", allowFailure), func(t *testing.T) {
+			f, primary, _ := makeMirror(t, "secondary_timeout", "100ms", "allow_secondary_failure", fmt.Sprint(allowFailure))
+			f.(*Fs).secondary = hangingFs{Fs: f.(*Fs).secondary}
+
+			// A secondary which doesn't take the data is given
+			// up on and the upload to the primary finishes
+			ctx := accounting.WithStatsGroup(ctx, "TestMirrorSecondaryTimeout-"+fmt.Sprint(allowFailure))
+			start := time.Now()
+			_, err := put(ctx, t, f, "file.txt", contents)
+			assert.Less(t, time.Since(start), 10*time.Second)
+			assert.Equal(t, contents, readFile(t, primary, "file.txt"))
+			if allowFailure {
+				require.NoError(t, err)
+				assert.Equal(t, int64(1), accounting.Stats(ctx).GetErrors())
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "no data taken for 100ms")
+			}
+		})
+	}
+}
+
+func TestMirrorReadFailover(t *testing.T) {
+	ctx := context.Background()
+	f, primary, _ := makeMirror(t)
+
+	_, err := put(ctx, t, f, "file.txt", "hello mirror")
+	require.NoError(t, err)
+
+	o, err := f.NewObject(ctx, "file.txt")
+	require.NoError(t, err)
+	assert.True(t, o.(*Object).onPrimary())
+
+	// Break the primary
+	require.NoError(t, os.Remove(filepath.Join(primary, "file.txt")))
+
+	in, err := o.Open(ctx)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, "hello mirror", string(data))
+}
@@ -0,0 +1,267 @@
+package pack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/lib/random"
+)
+
+const (
+	packDirName  = ".rclone-pack" // name of the directory the packs of a directory are stored in
+	archiveExt   = ".pack"        // extension of the archive holding the contents of the packed files
+	indexExt     = ".json"        // extension of the index of an archive
+	indexVersion = 1              // version of the index format
+)
+
+// packIndex is the index of an archive, stored as JSON next to it
+type packIndex struct {
+	Version int         `json:"version"`
+	Files   []packEntry `json:"files"`
+}
+
+// packEntry describes a file in an archive
+type packEntry struct {
+	Name    string            `json:"name"`             // leaf name of the file
+	Offset  int64             `json:"offset"`           // offset of the file in the archive
+	Size    int64             `json:"size"`             // size of the file
+	ModTime time.Time         `json:"modtime"`          // modification time of the file
+	Hashes  map[string]string `json:"hashes,omitempty"` // hashes of the file by hash name
+}
+
+// cachedIndex is an index read from the base remote along with the
+// size and modification time of the file it was read from
+type cachedIndex struct {
+	size    int64
+	modTime time.Time
+	index   *packIndex
+}
+
+// parentDir returns the directory remote is in
+func parentDir(remote string) string {
+	dir := path.Dir(remote)
+	if dir == "." || dir == "/" {
+		return ""
+	}
+	return dir
+}
+
+// isPackPath returns true if remote is in a directory packs are stored in
+func isPackPath(remote string) bool {
+	for _, part := range strings.Split(remote, "/") {
+		if part == packDirName {
+			return true
+		}
+	}
+	return false
+}
+
+// packDir returns the directory on the base remote the packs of the
+// files in dir are stored in
+func packDir(dir string) string {
+	return path.Join(dir, packDirName)
+}
+
+// archivePath returns the path on the base remote of the archive of
+// pack id in dir
+func archivePath(dir, id string) string {
+	return path.Join(packDir(dir), id+archiveExt)
+}
+
+// indexPath returns the path on the base remote of the index of pack
+// id in dir
+func indexPath(dir, id string) string {
+	return path.Join(packDir(dir), id+indexExt)
+}
+
+// newPackID makes a new pack id
+//
+// Pack ids sort in the order the packs were made in.
+func newPackID() string {
+	return time.Now().UTC().Format("20060102T150405.000000000") + "-" + random.String(8)
+}
+
+// readIndex reads the index in o, using the cached copy if o hasn't
+// changed since it was read.
+func (f *Fs) readIndex(ctx context.Context, o fs.Object) (index *packIndex, err error) {
+	f.mu.Lock()
+	cached, ok := f.indexes[o.Remote()]
+	f.mu.Unlock()
+	if ok && cached.size == o.Size() && cached.modTime.Equal(o.ModTime(ctx)) {
+		return cached.index, nil
+	}
+	in, err := o.Open(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pack index: %w", err)
+	}
+	defer fs.CheckClose(in, &err)
+	index = new(packIndex)
+	if err = json.NewDecoder(in).Decode(index); err != nil {
+		return nil, fmt.Errorf("failed to read pack index %q: %w", o.Remote(), err)
+	}
+	if index.Version != indexVersion {
+		return nil, fmt.Errorf("unknown version %d of pack index %q", index.Version, o.Remote())
+	}
+	f.cacheIndex(ctx, o, index)
+	return index, nil
+}
+
+// cacheIndex remembers that o contains index
+func (f *Fs) cacheIndex(ctx context.Context, o fs.Object, index *packIndex) {
+	f.mu.Lock()
+	f.indexes[o.Remote()] = cachedIndex{
+		size:    o.Size(),
+		modTime: o.ModTime(ctx),
+		index:   index,
+	}
+	f.mu.Unlock()
+}
+
+// packed returns the files packed in dir keyed by leaf name
+//
+// If a file is in more than one pack then the newest is used.
+func (f *Fs) packed(ctx context.Context, dir string) (map[string]*Object, error) {
+	entries, err := f.base.List(ctx, packDir(dir))
+	if err == fs.ErrorDirNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var indexObjects []fs.Object
+	for _, entry := range entries {
+		if o, ok := entry.(fs.Object); ok && strings.HasSuffix(o.Remote(), indexExt) {
+			indexObjects = append(indexObjects, o)
+		}
+	}
+	sort.Slice(indexObjects, func(i, j int) bool {
+		return indexObjects[i].Remote() < indexObjects[j].Remote()
+	})
+	packed := make(map[string]*Object)
+	for _, o := range indexObjects {
+		index, err := f.readIndex(ctx, o)
+		if err != nil {
+			return nil, err
+		}
+		id := strings.TrimSuffix(path.Base(o.Remote()), indexExt)
+		for _, entry := range index.Files {
+			packed[entry.Name] = f.newPackedObject(path.Join(dir, entry.Name), id, entry)
+		}
+	}
+	return packed, nil
+}
+
+// indexLocks holds the locks of the pack indexes being changed keyed
+// by their path on the base remote, so that Fs with different roots
+// on the same remote don't change an index at the same time.
+var indexLocks = struct {
+	mu    sync.Mutex
+	locks map[string]*indexLock
+}{locks: make(map[string]*indexLock)}
+
+// indexLock is held while changing a pack index
+type indexLock struct {
+	mu    sync.Mutex
+	users int // number of callers holding or waiting for mu
+}
+
+// lockIndex locks the index of pack id in dir returning a function
+// to unlock it.
+func (f *Fs) lockIndex(dir, id string) (unlock func()) {
+	key := fspath.JoinRootPath(f.opt.Remote, path.Join(f.root, indexPath(dir, id)))
+	indexLocks.mu.Lock()
+	l := indexLocks.locks[key]
+	if l == nil {
+		l = new(indexLock)
+		indexLocks.locks[key] = l
+	}
+	l.users++
+	indexLocks.mu.Unlock()
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		indexLocks.mu.Lock()
+		l.users--
+		if l.users == 0 {
+			delete(indexLocks.locks, key)
+		}
+		indexLocks.mu.Unlock()
+	}
+}
+
+// writeIndex writes index as the index of pack id in dir, removing
+// the pack if index is empty.
+//
+// Call with the index locked with lockIndex.
+func (f *Fs) writeIndex(ctx context.Context, dir, id string, index *packIndex) error {
+	remote := indexPath(dir, id)
+	if len(index.Files) == 0 {
+		// Nothing is left in the pack so remove it, index first
+		// so the archive is never used without it
+		for _, toRemove := range []string{remote, archivePath(dir, id)} {
+			o, err := f.base.NewObject(ctx, toRemove)
+			if err == nil {
+				err = o.Remove(ctx)
+			}
+			if err != nil && err != fs.ErrorObjectNotFound {
+				return fmt.Errorf("failed to remove empty pack: %w", err)
+			}
+		}
+		f.mu.Lock()
+		delete(f.indexes, remote)
+		f.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	info := object.NewStaticObjectInfo(remote, time.Now(), int64(len(data)), true, nil, f.base)
+	o, err := f.base.Put(ctx, bytes.NewReader(data), info)
+	if err != nil {
+		return fmt.Errorf("failed to write pack index: %w", err)
+	}
+	f.cacheIndex(ctx, o, index)
+	return nil
+}
+
+// updateIndex changes the entry of packed file o in the index of its
+// pack by calling change on a copy of it. The entry is removed if
+// change returns false.
+func (f *Fs) updateIndex(ctx context.Context, o *Object, change func(entry *packEntry) bool) error {
+	dir := parentDir(o.remote)
+	defer f.lockIndex(dir, o.id)()
+	indexObject, err := f.base.NewObject(ctx, indexPath(dir, o.id))
+	if err != nil {
+		return err
+	}
+	index, err := f.readIndex(ctx, indexObject)
+	if err != nil {
+		return err
+	}
+	newIndex := &packIndex{Version: indexVersion}
+	found := false
+	for _, entry := range index.Files {
+		if entry.Name == o.entry.Name && entry.Offset == o.entry.Offset {
+			found = true
+			if !change(&entry) {
+				continue
+			}
+		}
+		newIndex.Files = append(newIndex.Files, entry)
+	}
+	if !found {
+		return fs.ErrorObjectNotFound
+	}
+	return f.writeIndex(ctx, dir, o.id, newIndex)
+}
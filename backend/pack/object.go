@@ -0,0 +1,202 @@
+package pack
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/lib/readers"
+)
+
+// Object describes a file which is either stored as itself on the
+// base remote or packed into an archive with other small files.
+type Object struct {
+	f      *Fs
+	remote string    // remote path of the file
+	bo     fs.Object // the file on the base remote if not packed
+	id     string    // id of the pack the file is in if packed
+	entry  packEntry // entry of the file in the pack index if packed
+}
+
+// newObject makes an Object for remote stored as bo
+func (f *Fs) newObject(remote string, bo fs.Object) *Object {
+	return &Object{
+		f:      f,
+		remote: remote,
+		bo:     bo,
+	}
+}
+
+// newPackedObject makes an Object for remote packed in pack id
+func (f *Fs) newPackedObject(remote string, id string, entry packEntry) *Object {
+	return &Object{
+		f:      f,
+		remote: remote,
+		id:     id,
+		entry:  entry,
+	}
+}
+
+// packed returns true if the file is packed into an archive
+func (o *Object) packed() bool {
+	return o.bo == nil
+}
+
+// Fs returns the parent Fs
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// Return a string version
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *Object) Remote() string {
+	return o.remote
+}
+
+// Size returns the size of the file
+func (o *Object) Size() int64 {
+	if o.packed() {
+		return o.entry.Size
+	}
+	return o.bo.Size()
+}
+
+// ModTime returns the modification time of the file
+func (o *Object) ModTime(ctx context.Context) time.Time {
+	if o.packed() {
+		return o.entry.ModTime
+	}
+	return o.bo.ModTime(ctx)
+}
+
+// SetModTime sets the modification time of the file
+//
+// The modification time of a packed file is kept in the pack index.
+func (o *Object) SetModTime(ctx context.Context, modTime time.Time) error {
+	if !o.packed() {
+		return o.bo.SetModTime(ctx, modTime)
+	}
+	err := o.f.updateIndex(ctx, o, func(entry *packEntry) bool {
+		entry.ModTime = modTime
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	o.entry.ModTime = modTime
+	return nil
+}
+
+// Storable returns a boolean indicating if this object is storable
+func (o *Object) Storable() bool {
+	return true
+}
+
+// Hash returns the selected checksum of the file
+//
+// The hashes of a packed file are found when it is packed and kept
+// in the pack index.
+func (o *Object) Hash(ctx context.Context, ht hash.Type) (string, error) {
+	if !o.packed() {
+		return o.bo.Hash(ctx, ht)
+	}
+	if !o.f.Hashes().Contains(ht) {
+		return "", hash.ErrUnsupported
+	}
+	return o.entry.Hashes[ht.String()], nil
+}
+
+// Open an object for read
+//
+// A packed file is read from its slice of the archive it is in.
+func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	if !o.packed() {
+		return o.bo.Open(ctx, options...)
+	}
+	var (
+		size        = o.entry.Size
+		offset      int64
+		limit       int64 = -1
+		openOptions []fs.OpenOption
+	)
+	for _, option := range options {
+		switch x := option.(type) {
+		case *fs.SeekOption:
+			offset = x.Offset
+		case *fs.RangeOption:
+			offset, limit = x.Decode(size)
+		default:
+			openOptions = append(openOptions, option)
+		}
+	}
+	if offset < 0 {
+		offset = 0
+	} else if offset > size {
+		offset = size
+	}
+	if limit < 0 || offset+limit > size {
+		limit = size - offset
+	}
+	if limit == 0 {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	archive, err := o.f.base.NewObject(ctx, archivePath(parentDir(o.remote), o.id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find pack of %v: %w", o, err)
+	}
+	start := o.entry.Offset + offset
+	openOptions = append(openOptions, &fs.RangeOption{Start: start, End: start + limit - 1})
+	in, err := archive.Open(ctx, openOptions...)
+	if err != nil {
+		return nil, err
+	}
+	return readers.NewLimitedReadCloser(in, limit), nil
+}
+
+// Update the object with the contents of the io.Reader, modTime and size
+//
+// The new contents may be packed or not depending on their size
+// whether the old contents were or not.
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	newO, err := o.f.put(ctx, in, src, o.remote, o, options...)
+	if err != nil {
+		return err
+	}
+	*o = *newO
+	return nil
+}
+
+// Remove the file
+//
+// A packed file is removed from the pack index and the pack is
+// removed when nothing is left in it.
+func (o *Object) Remove(ctx context.Context) error {
+	if !o.packed() {
+		return o.bo.Remove(ctx)
+	}
+	return o.f.updateIndex(ctx, o, func(entry *packEntry) bool {
+		return false
+	})
+}
+
+// UnWrap returns the file on the base remote or nil if it is packed
+func (o *Object) UnWrap() fs.Object {
+	return o.bo
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Object          = (*Object)(nil)
+	_ fs.ObjectUnWrapper = (*Object)(nil)
+)
@@ -0,0 +1,512 @@
+// Package pack implements a backend which packs small files into
+// archives on another remote.
+package pack
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/lib/batcher"
+)
+
+// Configure the batcher
+var defaultBatcherOptions = batcher.Options{
+	Mode:               "sync",
+	MaxBatchSize:       1000,
+	DefaultTimeoutSync: 500 * time.Millisecond,
+}
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "pack",
+		Description: "Pack small files into archives on a remote",
+		NewFs:       NewFs,
+		Options: []fs.Option{{
+			Name: "remote",
+			Help: `Remote to store the files in.
+
+Normally should contain a ':' and a path, e.g. "myremote:path/to/dir",
+"myremote:bucket" or maybe "myremote:" (not recommended).`,
+			Required: true,
+		}, {
+			Name: "threshold",
+			Help: `Files smaller than this are packed into archives.
+
+Files this size or bigger, or of unknown size, are stored as they are.`,
+			Default: fs.SizeSuffix(64 * 1024),
+		}, {
+			Name: "batch_size",
+			Help: fmt.Sprintf(`Max number of files to pack into one archive.
+
+The files being uploaded at the same time are packed together, so
+there are at most --transfers files in each archive. Use a bigger
+--transfers, for example --transfers 64, to make bigger archives.
+
+By default this is 0 which means the same as --transfers. It has to
+be less than %d.`, defaultBatcherOptions.MaxBatchSize),
+			Default:  0,
+			Advanced: true,
+		}, {
+			Name: "batch_timeout",
+			Help: fmt.Sprintf(`Max time to wait for more files before packing an archive.
+
+The default for this is 0 which means %v.`, defaultBatcherOptions.DefaultTimeoutSync),
+			Default:  fs.Duration(0),
+			Advanced: true,
+		}},
+	})
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	Remote       string        `config:"remote"`
+	Threshold    fs.SizeSuffix `config:"threshold"`
+	BatchSize    int           `config:"batch_size"`
+	BatchTimeout fs.Duration   `config:"batch_timeout"`
+}
+
+// Fs represents a remote with its small files packed into archives
+type Fs struct {
+	name     string                               // name of this remote
+	root     string                               // the path we are working on
+	opt      Options                              // options for this Fs
+	features *fs.Features                         // optional features
+	base     fs.Fs                                // the remote the files are stored on
+	batcher  *batcher.Batcher[*packItem, *Object] // packs the small files being uploaded
+	mu       sync.Mutex                           // protects the below
+	indexes  map[string]cachedIndex               // pack indexes read keyed by path
+}
+
+// packItem is a small file waiting to be packed
+type packItem struct {
+	remote  string            // remote path of the file
+	data    []byte            // contents of the file
+	modTime time.Time         // modification time of the file
+	hashes  map[string]string // hashes of the file by hash name
+}
+
+// NewFs constructs an Fs from the path.
+//
+// The path may be a directory, a file stored on the remote or a
+// packed file.
+func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, error) {
+	// Parse config into Options struct
+	opt := new(Options)
+	err := configstruct.Set(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	if opt.Remote == "" {
+		return nil, errors.New("pack can't point to an empty remote - check the value of the remote setting")
+	}
+	if strings.HasPrefix(opt.Remote, name+":") {
+		return nil, errors.New("can't point pack remote at itself - check the value of the remote setting")
+	}
+	root = strings.Trim(root, "/")
+	if isPackPath(root) {
+		return nil, fmt.Errorf("pack path can't contain %q as that is where the packs are stored", packDirName)
+	}
+	f, err := newFs(ctx, name, root, opt)
+	if err != nil && err != fs.ErrorIsFile {
+		return nil, err
+	}
+	// The root might be a packed file
+	if err == nil && root != "" {
+		parent, err := newFs(ctx, name, parentDir(root), opt)
+		if err == nil {
+			packed, err := parent.packed(ctx, "")
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := packed[path.Base(root)]; ok {
+				f = parent
+			}
+		}
+	}
+	f.batcher, err = batcher.New(ctx, f, f.commitBatch, batcherOptions(opt))
+	if err != nil {
+		return nil, err
+	}
+	cache.PinUntilFinalized(f.base, f)
+	if f.root != root {
+		return f, fs.ErrorIsFile
+	}
+	return f, nil
+}
+
+// batcherOptions returns the options for the batcher set from opt
+func batcherOptions(opt *Options) batcher.Options {
+	batcherOptions := defaultBatcherOptions
+	batcherOptions.Size = opt.BatchSize
+	batcherOptions.Timeout = time.Duration(opt.BatchTimeout)
+	return batcherOptions
+}
+
+// newFs makes an Fs for root on the base remote without a batcher
+//
+// It returns fs.ErrorIsFile if root is a file stored on the base
+// remote.
+func newFs(ctx context.Context, name, root string, opt *Options) (*Fs, error) {
+	base, err := cache.Get(ctx, fspath.JoinRootPath(opt.Remote, root))
+	if err != nil && err != fs.ErrorIsFile {
+		return nil, fmt.Errorf("failed to make remote %q to store the files in: %w", opt.Remote, err)
+	}
+	f := &Fs{
+		name:    name,
+		root:    root,
+		opt:     *opt,
+		base:    base,
+		indexes: make(map[string]cachedIndex),
+	}
+	if err == fs.ErrorIsFile {
+		f.root = parentDir(root)
+	}
+	f.features = (&fs.Features{
+		CaseInsensitive:         false,
+		DuplicateFiles:          false,
+		CanHaveEmptyDirectories: true,
+	}).Fill(ctx, f).Mask(ctx, f.base)
+	// Files waiting to be packed are packed on shutdown whatever
+	// the base remote
+	f.features.Shutdown = f.Shutdown
+	return f, err
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// String converts this Fs to a string
+func (f *Fs) String() string {
+	return fmt.Sprintf("pack of %s", f.base)
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// Precision of the ModTimes in this Fs
+func (f *Fs) Precision() time.Duration {
+	return f.base.Precision()
+}
+
+// Hashes returns the supported hash sets.
+//
+// The hashes of packed files are found when they are packed.
+func (f *Fs) Hashes() hash.Set {
+	return f.base.Hashes()
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// The files packed in dir are listed along with those stored as
+// they are.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	if isPackPath(dir) {
+		return nil, fs.ErrorDirNotFound
+	}
+	baseEntries, err := f.base.List(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	hasPacks := false
+	stored := make(map[string]struct{}, len(baseEntries))
+	for _, entry := range baseEntries {
+		switch x := entry.(type) {
+		case fs.Object:
+			stored[path.Base(x.Remote())] = struct{}{}
+			entries = append(entries, f.newObject(x.Remote(), x))
+		case fs.Directory:
+			if path.Base(x.Remote()) == packDirName {
+				hasPacks = true
+				continue
+			}
+			entries = append(entries, x)
+		}
+	}
+	if !hasPacks {
+		return entries, nil
+	}
+	packed, err := f.packed(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	for leaf, o := range packed {
+		if _, found := stored[leaf]; found {
+			fs.Debugf(o, "Ignoring packed file as a file with the same name is stored as it is")
+			continue
+		}
+		entries = append(entries, o)
+	}
+	return entries, nil
+}
+
+// NewObject finds the Object at remote.  If it can't be found
+// it returns the error fs.ErrorObjectNotFound.
+//
+// A file stored as it is is used in preference to a packed one.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	o, err := f.newObjectWithInfo(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// newObjectWithInfo finds the Object at remote
+func (f *Fs) newObjectWithInfo(ctx context.Context, remote string) (*Object, error) {
+	if isPackPath(remote) {
+		return nil, fs.ErrorObjectNotFound
+	}
+	bo, err := f.base.NewObject(ctx, remote)
+	if err == nil {
+		return f.newObject(remote, bo), nil
+	}
+	if err != fs.ErrorObjectNotFound {
+		return nil, err
+	}
+	packed, err := f.packed(ctx, parentDir(remote))
+	if err != nil {
+		return nil, err
+	}
+	if o, ok := packed[path.Base(remote)]; ok {
+		return o, nil
+	}
+	return nil, fs.ErrorObjectNotFound
+}
+
+// put uploads in as remote, replacing old if set.
+//
+// Files smaller than the threshold are packed and the rest are
+// stored as they are.
+func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, remote string, old *Object, options ...fs.OpenOption) (o *Object, err error) {
+	if isPackPath(remote) {
+		return nil, fmt.Errorf("can't store %q as %q is where the packs are stored", remote, packDirName)
+	}
+	size := src.Size()
+	switch {
+	case size >= 0 && size < int64(f.opt.Threshold):
+		o, err = f.pack(ctx, in, src, remote)
+	case old != nil && !old.packed():
+		err = old.bo.Update(ctx, in, src, options...)
+		o = f.newObject(remote, old.bo)
+	default:
+		var bo fs.Object
+		bo, err = f.base.Put(ctx, in, fs.NewOverrideRemote(src, remote), options...)
+		o = f.newObject(remote, bo)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Remove the old contents if they are stored elsewhere
+	if old != nil && (old.packed() || o.packed()) {
+		if err := old.Remove(ctx); err != nil && err != fs.ErrorObjectNotFound {
+			fs.Errorf(old, "Failed to remove old contents: %v", err)
+		}
+	}
+	return o, nil
+}
+
+// pack reads in and waits for it to be packed into an archive with
+// the other small files being uploaded
+func (f *Fs) pack(ctx context.Context, in io.Reader, src fs.ObjectInfo, remote string) (*Object, error) {
+	data := make([]byte, src.Size())
+	if _, err := io.ReadFull(in, data); err != nil {
+		return nil, fmt.Errorf("failed to read file to pack: %w", err)
+	}
+	hasher, err := hash.NewMultiHasherTypes(f.Hashes())
+	if err != nil {
+		return nil, err
+	}
+	_, _ = hasher.Write(data)
+	hashes := make(map[string]string)
+	for ht, sum := range hasher.Sums() {
+		hashes[ht.String()] = sum
+	}
+	return f.batcher.Commit(ctx, remote, &packItem{
+		remote:  remote,
+		data:    data,
+		modTime: src.ModTime(ctx),
+		hashes:  hashes,
+	})
+}
+
+// commitBatch packs the files in items into an archive for each
+// directory they are in
+func (f *Fs) commitBatch(ctx context.Context, items []*packItem, results []*Object, errors []error) (err error) {
+	var (
+		dirs  []string
+		byDir = make(map[string][]int)
+	)
+	for i, item := range items {
+		dir := parentDir(item.remote)
+		if _, found := byDir[dir]; !found {
+			dirs = append(dirs, dir)
+		}
+		byDir[dir] = append(byDir[dir], i)
+	}
+	for _, dir := range dirs {
+		dirItems := make([]*packItem, len(byDir[dir]))
+		for j, i := range byDir[dir] {
+			dirItems[j] = items[i]
+		}
+		objects, err := f.writePack(ctx, dir, dirItems)
+		for j, i := range byDir[dir] {
+			if err != nil {
+				errors[i] = err
+			} else {
+				results[i] = objects[j]
+			}
+		}
+	}
+	return nil
+}
+
+// writePack uploads an archive of the files in items, which must all
+// be in dir, and its index.
+func (f *Fs) writePack(ctx context.Context, dir string, items []*packItem) ([]*Object, error) {
+	id := newPackID()
+	var archive bytes.Buffer
+	index := &packIndex{Version: indexVersion}
+	for _, item := range items {
+		index.Files = append(index.Files, packEntry{
+			Name:    path.Base(item.remote),
+			Offset:  int64(archive.Len()),
+			Size:    int64(len(item.data)),
+			ModTime: item.modTime,
+			Hashes:  item.hashes,
+		})
+		archive.Write(item.data)
+	}
+	info := object.NewStaticObjectInfo(archivePath(dir, id), time.Now(), int64(archive.Len()), true, nil, f.base)
+	archiveObject, err := f.base.Put(ctx, &archive, info)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload pack: %w", err)
+	}
+	unlock := f.lockIndex(dir, id)
+	err = f.writeIndex(ctx, dir, id, index)
+	unlock()
+	if err != nil {
+		if removeErr := archiveObject.Remove(ctx); removeErr != nil {
+			fs.Errorf(archiveObject, "Failed to remove pack without index: %v", removeErr)
+		}
+		return nil, err
+	}
+	fs.Debugf(f, "Packed %d files into %q", len(items), archivePath(dir, id))
+	objects := make([]*Object, len(items))
+	for i, item := range items {
+		objects[i] = f.newPackedObject(item.remote, id, index.Files[i])
+	}
+	return objects, nil
+}
+
+// Put in to the remote with the modTime given of the given size
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	old, err := f.newObjectWithInfo(ctx, src.Remote())
+	switch err {
+	case nil:
+	case fs.ErrorObjectNotFound:
+		old = nil
+	default:
+		return nil, err
+	}
+	o, err := f.put(ctx, in, src, src.Remote(), old, options...)
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Mkdir makes the directory (container, bucket)
+//
+// Shouldn't return an error if it already exists
+func (f *Fs) Mkdir(ctx context.Context, dir string) error {
+	return f.base.Mkdir(ctx, dir)
+}
+
+// Rmdir removes the directory (container, bucket) if empty
+//
+// Anything left in the directory the packs are stored in is removed
+// as it holds no files.
+//
+// Return an error if it doesn't exist or isn't empty
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	entries, err := f.List(ctx, dir)
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return fs.ErrorDirectoryNotEmpty
+	}
+	packEntries, err := f.base.List(ctx, packDir(dir))
+	switch err {
+	case nil:
+		for _, entry := range packEntries {
+			if o, ok := entry.(fs.Object); ok {
+				if err := o.Remove(ctx); err != nil {
+					return fmt.Errorf("failed to remove unused pack: %w", err)
+				}
+			}
+		}
+		if err := f.base.Rmdir(ctx, packDir(dir)); err != nil {
+			return err
+		}
+	case fs.ErrorDirNotFound:
+	default:
+		return err
+	}
+	return f.base.Rmdir(ctx, dir)
+}
+
+// About gets quota information from the remote
+func (f *Fs) About(ctx context.Context) (*fs.Usage, error) {
+	do := f.base.Features().About
+	if do == nil {
+		return nil, errors.New("not supported by underlying remote")
+	}
+	return do(ctx)
+}
+
+// Shutdown the backend, packing any files waiting to be packed.
+func (f *Fs) Shutdown(ctx context.Context) error {
+	f.batcher.Shutdown()
+	return nil
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs         = (*Fs)(nil)
+	_ fs.Abouter    = (*Fs)(nil)
+	_ fs.Shutdowner = (*Fs)(nil)
+)
@@ -0,0 +1,280 @@
+package pack
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/lib/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// packConfig returns the config for a pack remote on dir with the
+// defaults overridden by config
+func packConfig(dir string, config configmap.Simple) configmap.Simple {
+	m := configmap.Simple{
+		"remote":        dir,
+		"threshold":     "1k",
+		"batch_size":    "10",
+		"batch_timeout": "10ms",
+	}
+	for k, v := range config {
+		m[k] = v
+	}
+	return m
+}
+
+// makePack makes a pack remote on a temporary directory with the
+// config given returning it and the directory
+func makePack(t *testing.T, config configmap.Simple) (*Fs, string) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	f, err := NewFs(ctx, "TestPackInternal", "", packConfig(dir, config))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, f.(*Fs).Shutdown(ctx))
+	})
+	return f.(*Fs), dir
+}
+
+// storedFiles returns the paths of the files stored in dir
+func storedFiles(t *testing.T, dir string) (files []string) {
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(dir, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	require.NoError(t, err)
+	return files
+}
+
+// put uploads contents to f as remote
+func put(t *testing.T, f fs.Fs, remote string, contents string) fs.Object {
+	ctx := context.Background()
+	src := object.NewStaticObjectInfo(remote, fstest.Time("2001-02-03T04:05:06Z"), int64(len(contents)), true, nil, nil)
+	o, err := f.Put(ctx, strings.NewReader(contents), src)
+	require.NoError(t, err)
+	return o
+}
+
+// read reads the contents of remote on f with the options given
+func read(t *testing.T, f fs.Fs, remote string, options ...fs.OpenOption) string {
+	ctx := context.Background()
+	o, err := f.NewObject(ctx, remote)
+	require.NoError(t, err)
+	in, err := o.Open(ctx, options...)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	return string(data)
+}
+
+// list returns the remotes of the entries in dir on f sorted
+func list(t *testing.T, f fs.Fs, dir string) (remotes []string) {
+	entries, err := f.List(context.Background(), dir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		remotes = append(remotes, entry.Remote())
+	}
+	sort.Strings(remotes)
+	return remotes
+}
+
+// countPacks returns the number of archives and indexes in files
+func countPacks(files []string) (archives, indexes int) {
+	for _, file := range files {
+		switch {
+		case strings.HasSuffix(file, archiveExt):
+			archives++
+		case strings.HasSuffix(file, indexExt):
+			indexes++
+		}
+	}
+	return archives, indexes
+}
+
+func TestPackManySmallFiles(t *testing.T) {
+	ctx := context.Background()
+	f, dir := makePack(t, nil)
+
+	// Upload lots of small files at once so they are packed together
+	const n = 50
+	contents := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		contents[fmt.Sprintf("dir/file%02d.txt", i)] = random.String(10 + i*10)
+	}
+	var wg sync.WaitGroup
+	for remote, data := range contents {
+		wg.Add(1)
+		go func(remote, data string) {
+			defer wg.Done()
+			put(t, f, remote, data)
+		}(remote, data)
+	}
+	wg.Wait()
+
+	// Only the packs are stored and there are fewer of them than files
+	files := storedFiles(t, dir)
+	archives, indexes := countPacks(files)
+	assert.Equal(t, len(files), archives+indexes)
+	assert.Equal(t, archives, indexes)
+	assert.GreaterOrEqual(t, archives, n/10)
+	assert.Less(t, archives, n)
+	for _, file := range files {
+		assert.True(t, strings.HasPrefix(file, "dir/"+packDirName+"/"), file)
+	}
+
+	// Each file is listed and read back by itself
+	var remotes []string
+	for remote := range contents {
+		remotes = append(remotes, remote)
+	}
+	sort.Strings(remotes)
+	assert.Equal(t, []string{"dir"}, list(t, f, ""))
+	assert.Equal(t, remotes, list(t, f, "dir"))
+	for remote, data := range contents {
+		assert.Equal(t, data, read(t, f, remote), remote)
+	}
+
+	// The metadata of each file is kept in the pack index
+	const remote = "dir/file07.txt"
+	data := contents[remote]
+	o, err := f.NewObject(ctx, remote)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), o.Size())
+	assert.True(t, fstest.Time("2001-02-03T04:05:06Z").Equal(o.ModTime(ctx)))
+	md5sum, err := o.Hash(ctx, hash.MD5)
+	require.NoError(t, err)
+	assert.Equal(t, md5sum, hashOf(t, hash.MD5, data))
+	newTime := fstest.Time("2011-12-13T14:15:16Z")
+	require.NoError(t, o.SetModTime(ctx, newTime))
+	o, err = f.NewObject(ctx, remote)
+	require.NoError(t, err)
+	assert.True(t, newTime.Equal(o.ModTime(ctx)))
+
+	// Parts of a file are read from its slice of the pack
+	assert.Equal(t, data[5:15], read(t, f, remote, &fs.RangeOption{Start: 5, End: 14}))
+	assert.Equal(t, data[20:], read(t, f, remote, &fs.SeekOption{Offset: 20}))
+	assert.Equal(t, data[len(data)-7:], read(t, f, remote, &fs.RangeOption{Start: -1, End: 7}))
+	assert.Equal(t, data[60:], read(t, f, remote, &fs.RangeOption{Start: 60, End: 1000}))
+
+	// Removing all the files removes the packs
+	for remote := range contents {
+		o, err := f.NewObject(ctx, remote)
+		require.NoError(t, err)
+		require.NoError(t, o.Remove(ctx))
+	}
+	assert.Empty(t, storedFiles(t, dir))
+	assert.Empty(t, list(t, f, "dir"))
+	_, err = f.NewObject(ctx, remote)
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+	require.NoError(t, f.Rmdir(ctx, "dir"))
+	_, err = os.Stat(filepath.Join(dir, "dir"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+// hashOf returns the hash of type ht of data
+func hashOf(t *testing.T, ht hash.Type, data string) string {
+	sum, err := hash.NewMultiHasherTypes(hash.NewHashSet(ht))
+	require.NoError(t, err)
+	_, _ = sum.Write([]byte(data))
+	s, err := sum.SumString(ht, false)
+	require.NoError(t, err)
+	return s
+}
+
+func TestPackThreshold(t *testing.T) {
+	ctx := context.Background()
+	f, dir := makePack(t, nil)
+	small := random.String(100)
+	big := random.String(2000)
+
+	// Files at or above the threshold are stored as they are
+	put(t, f, "big.txt", big)
+	put(t, f, "small.txt", small)
+	files := storedFiles(t, dir)
+	assert.Contains(t, files, "big.txt")
+	assert.NotContains(t, files, "small.txt")
+	assert.Equal(t, []string{"big.txt", "small.txt"}, list(t, f, ""))
+	assert.Equal(t, big, read(t, f, "big.txt"))
+	assert.Equal(t, small, read(t, f, "small.txt"))
+
+	// Updating a packed file with big contents stores it as it is
+	// and takes it out of the pack
+	o, err := f.NewObject(ctx, "small.txt")
+	require.NoError(t, err)
+	src := object.NewStaticObjectInfo("small.txt", fstest.Time("2001-02-03T04:05:06Z"), int64(len(big)), true, nil, nil)
+	require.NoError(t, o.Update(ctx, strings.NewReader(big), src))
+	assert.Equal(t, []string{"big.txt", "small.txt"}, storedFiles(t, dir))
+	assert.Equal(t, big, read(t, f, "small.txt"))
+
+	// And the other way round
+	put(t, f, "big.txt", small)
+	files = storedFiles(t, dir)
+	assert.NotContains(t, files, "big.txt")
+	archives, indexes := countPacks(files)
+	assert.Equal(t, 1, archives)
+	assert.Equal(t, 1, indexes)
+	assert.Equal(t, small, read(t, f, "big.txt"))
+
+	// Replacing a packed file leaves only the new contents
+	put(t, f, "big.txt", "new contents")
+	assert.Equal(t, "new contents", read(t, f, "big.txt"))
+	archives, indexes = countPacks(storedFiles(t, dir))
+	assert.Equal(t, 1, archives)
+	assert.Equal(t, 1, indexes)
+
+	// Files can't be stored where the packs are
+	src = object.NewStaticObjectInfo(packDirName+"/file.txt", fstest.Time("2001-02-03T04:05:06Z"), 1, true, nil, nil)
+	_, err = f.Put(ctx, strings.NewReader("x"), src)
+	assert.ErrorContains(t, err, "where the packs are stored")
+	_, err = f.List(ctx, packDirName)
+	assert.Equal(t, fs.ErrorDirNotFound, err)
+}
+
+func TestPackNewFsFile(t *testing.T) {
+	ctx := context.Background()
+	f, dir := makePack(t, nil)
+	const contents = "hello world"
+	put(t, f, "dir/small.txt", contents)
+	put(t, f, "dir/big.txt", random.String(2000))
+
+	// A packed file can be the root
+	fFile, err := NewFs(ctx, "TestPackInternal", "dir/small.txt", packConfig(dir, nil))
+	assert.Equal(t, fs.ErrorIsFile, err)
+	assert.Equal(t, "dir", fFile.Root())
+	assert.Equal(t, contents, read(t, fFile, "small.txt"))
+	require.NoError(t, fFile.Features().Shutdown(ctx))
+
+	// So can a file stored as it is
+	fFile, err = NewFs(ctx, "TestPackInternal", "dir/big.txt", packConfig(dir, nil))
+	assert.Equal(t, fs.ErrorIsFile, err)
+	assert.Equal(t, "dir", fFile.Root())
+	require.NoError(t, fFile.Features().Shutdown(ctx))
+
+	// A directory is a directory
+	fDir, err := NewFs(ctx, "TestPackInternal", "dir", packConfig(dir, nil))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"big.txt", "small.txt"}, list(t, fDir, ""))
+	require.NoError(t, fDir.Features().Shutdown(ctx))
+
+	// Packs can't be the root
+	_, err = NewFs(ctx, "TestPackInternal", "dir/"+packDirName, packConfig(dir, nil))
+	assert.ErrorContains(t, err, "where the packs are stored")
+}
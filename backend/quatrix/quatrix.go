@@ -1124,9 +1124,15 @@ func (o *Object) dynamicUpload(ctx context.Context, size int64, modTime time.Tim
 		localChunk = o.fs.uploadMemoryManager.Consume(o.id, size-offset, speed)
 
 		rw := multipart.NewRW()
+		err := rw.Reserve(ctx, localChunk)
+		if err != nil {
+			_ = rw.Close()
+			return fmt.Errorf("get memory for chunk with offset %d size %d: %w", offset, localChunk, err)
+		}
 
-		_, err := io.CopyN(rw, in, localChunk)
+		_, err = io.CopyN(rw, in, localChunk)
 		if err != nil {
+			_ = rw.Close()
 			return fmt.Errorf("read chunk with offset %d size %d: %w", offset, localChunk, err)
 		}
 
@@ -0,0 +1,85 @@
+// This file implements correcting the signing time for clock skew
+
+package s3
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/rclone/rclone/fs"
+)
+
+// errCodeClockSkew is returned by the server if the time a request
+// was signed with is too far from its own time
+const errCodeClockSkew = "RequestTimeTooSkewed"
+
+// clockSkew keeps the offset of the server's clock from the local
+// clock which is used to correct the time requests are signed with
+type clockSkew struct {
+	offset atomic.Int64 // nanoseconds to add to the local time
+}
+
+// now returns the local time corrected by the offset
+func (skew *clockSkew) now() time.Time {
+	return time.Now().Add(time.Duration(skew.offset.Load()))
+}
+
+// sign signs the request with the corrected time
+func (skew *clockSkew) sign(req *request.Request) {
+	v4.SignSDKRequestWithCurrentTime(req, skew.now)
+}
+
+// maxClockSkew is the largest difference between the time a request
+// is signed with and the server's time that S3 accepts
+const maxClockSkew = 15 * time.Minute
+
+// check is called after an error response has been decoded. If the
+// error says the clock is skewed it updates the offset from the Date
+// header of the response so the retry is signed with the server's
+// time.
+//
+// Responses to HEAD requests have no body to say why they failed, so
+// a 403 error with a Date header too far from the corrected local time
+// is treated as clock skew too.
+func (skew *clockSkew) check(req *request.Request) {
+	awsErr, ok := req.Error.(awserr.Error)
+	if !ok || req.HTTPResponse == nil {
+		return
+	}
+	isSkewErr := awsErr.Code() == errCodeClockSkew
+	if !isSkewErr && req.HTTPResponse.StatusCode != http.StatusForbidden {
+		return
+	}
+	serverTime, err := http.ParseTime(req.HTTPResponse.Header.Get("Date"))
+	if err != nil {
+		if isSkewErr {
+			fs.Errorf("s3", "Clock skew detected but couldn't read server time: %v", err)
+		}
+		return
+	}
+	offset := serverTime.Sub(time.Now()).Round(time.Second)
+	old := time.Duration(skew.offset.Load())
+	if !isSkewErr {
+		if (offset - old).Abs() <= maxClockSkew {
+			return
+		}
+		req.Error = awserr.NewRequestFailure(awserr.New(errCodeClockSkew, "request time too skewed", awsErr), req.HTTPResponse.StatusCode, req.RequestID)
+	}
+	if skew.offset.Swap(int64(offset)) != int64(offset) {
+		fs.Logf("s3", "Server clock is %v from the local clock - correcting the time used to sign requests", offset)
+	}
+}
+
+// install sets up the handlers on c to correct for clock skew
+func (skew *clockSkew) install(c *s3.S3) {
+	c.Handlers.Sign.Swap(v4.SignRequestHandler.Name, request.NamedHandler{
+		Name: v4.SignRequestHandler.Name,
+		Fn:   skew.sign,
+	})
+	c.Handlers.UnmarshalError.PushBack(skew.check)
+}
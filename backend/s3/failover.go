@@ -0,0 +1,209 @@
+// This file implements failing over between endpoints
+
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/rclone/rclone/fs"
+)
+
+// probeTimeout is the longest a probe of a failed endpoint can take
+const probeTimeout = time.Minute
+
+// failoverEndpoint is an endpoint which can be failed over to
+type failoverEndpoint struct {
+	url       *url.URL  // scheme and host of the endpoint
+	down      bool      // set if the endpoint has failed
+	probing   bool      // set while the endpoint is being probed
+	lastProbe time.Time // when the endpoint failed or was last probed
+}
+
+// endpointFailover switches between endpoints when the one in use
+// fails repeatedly.
+//
+// The endpoints are in order of preference. Failed endpoints are
+// probed every probeInterval and switched back to when they recover.
+type endpointFailover struct {
+	client        *http.Client  // client to probe endpoints with
+	threshold     int           // consecutive failures before failing over
+	probeInterval time.Duration // how often to probe failed endpoints
+	mu            sync.Mutex
+	endpoints     []*failoverEndpoint
+	active        int // index of the endpoint in use
+	failures      int // consecutive failures of the endpoint in use
+}
+
+// parseEndpoint parses an endpoint as used in the config
+func parseEndpoint(endpoint string) (*url.URL, error) {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse endpoint %q: %w", endpoint, err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("no host in endpoint %q", endpoint)
+	}
+	return u, nil
+}
+
+// newEndpointFailover returns an endpointFailover for the endpoints
+// in opt or nil if failover_endpoints isn't set.
+func newEndpointFailover(opt *Options, client *http.Client) (*endpointFailover, error) {
+	if len(opt.FailoverEndpoints) == 0 {
+		return nil, nil
+	}
+	if opt.Endpoint == "" {
+		return nil, errors.New("endpoint must be set to use failover_endpoints")
+	}
+	if opt.FailoverThreshold < 1 {
+		return nil, errors.New("failover_threshold must be at least 1")
+	}
+	f := &endpointFailover{
+		client:        client,
+		threshold:     opt.FailoverThreshold,
+		probeInterval: time.Duration(opt.FailoverProbeInterval),
+	}
+	for _, endpoint := range append([]string{opt.Endpoint}, opt.FailoverEndpoints...) {
+		u, err := parseEndpoint(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		f.endpoints = append(f.endpoints, &failoverEndpoint{url: u})
+	}
+	return f, nil
+}
+
+// find returns the index of the endpoint host is for or -1 if not
+// found. host may have a bucket name prepended to the endpoint.
+func (f *endpointFailover) find(host string) (i int, prefix string) {
+	for i, e := range f.endpoints {
+		if host == e.url.Host {
+			return i, ""
+		}
+		if strings.HasSuffix(host, "."+e.url.Host) {
+			return i, strings.TrimSuffix(host, e.url.Host)
+		}
+	}
+	return -1, ""
+}
+
+// current returns the endpoint to use, probing any failed endpoints
+// which are due a probe.
+func (f *endpointFailover) current() *url.URL {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, e := range f.endpoints {
+		if e.down && !e.probing && time.Since(e.lastProbe) >= f.probeInterval {
+			e.probing = true
+			go f.probe(i)
+		}
+	}
+	return f.endpoints[f.active].url
+}
+
+// rewrite points the request at the current endpoint before it is
+// signed so it is sent there.
+func (f *endpointFailover) rewrite(req *request.Request) {
+	u := req.HTTPRequest.URL
+	i, prefix := f.find(u.Host)
+	if i < 0 {
+		return
+	}
+	active := f.current()
+	u.Scheme = active.Scheme
+	u.Host = prefix + active.Host
+}
+
+// record notes the result of an attempt at a request, failing over
+// to the next endpoint if the endpoint has failed too many times in a
+// row.
+func (f *endpointFailover) record(req *request.Request) {
+	if req.Context().Err() != nil {
+		return
+	}
+	failed := req.Error != nil && (req.HTTPResponse == nil || req.HTTPResponse.StatusCode == 0 || req.HTTPResponse.StatusCode >= 500)
+	i, _ := f.find(req.HTTPRequest.URL.Host)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if i != f.active {
+		return
+	}
+	if !failed {
+		f.failures = 0
+		return
+	}
+	f.failures++
+	if f.failures < f.threshold {
+		return
+	}
+	f.failures = 0
+	failedEndpoint := f.endpoints[f.active]
+	failedEndpoint.down = true
+	failedEndpoint.lastProbe = time.Now()
+	// Use the next endpoint which is up, or the next one if all are down
+	next := (f.active + 1) % len(f.endpoints)
+	for j := 1; j < len(f.endpoints); j++ {
+		k := (f.active + j) % len(f.endpoints)
+		if !f.endpoints[k].down {
+			next = k
+			break
+		}
+	}
+	f.active = next
+	fs.Logf("s3", "Endpoint %s failed %d times in a row - failing over to %s: %v", failedEndpoint.url.Host, f.threshold, f.endpoints[next].url.Host, req.Error)
+}
+
+// probe checks whether the failed endpoint i is working again and
+// switches back to it if it is preferred to the one in use.
+//
+// Any response which isn't a server error means it is working.
+func (f *endpointFailover) probe(i int) {
+	e := f.endpoints[i]
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	var up bool
+	req, err := http.NewRequestWithContext(ctx, "GET", e.url.String(), nil)
+	if err == nil {
+		var resp *http.Response
+		resp, err = f.client.Do(req)
+		if err == nil {
+			_ = resp.Body.Close()
+			up = resp.StatusCode < 500
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e.probing = false
+	e.lastProbe = time.Now()
+	if !up {
+		fs.Debugf("s3", "Endpoint %s is still failing: %v", e.url.Host, err)
+		return
+	}
+	e.down = false
+	if i < f.active || f.endpoints[f.active].down {
+		fs.Logf("s3", "Endpoint %s has recovered - switching back to it from %s", e.url.Host, f.endpoints[f.active].url.Host)
+		f.active = i
+		f.failures = 0
+	} else {
+		fs.Logf("s3", "Endpoint %s has recovered", e.url.Host)
+	}
+}
+
+// install sets up the handlers on c to send requests to the current
+// endpoint and record whether they succeeded
+func (f *endpointFailover) install(c *s3.S3) {
+	c.Handlers.Sign.PushFront(f.rewrite)
+	c.Handlers.CompleteAttempt.PushBack(f.record)
+}
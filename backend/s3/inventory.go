@@ -0,0 +1,408 @@
+// This file implements listing from S3 Inventory reports
+
+package s3
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/bucket"
+)
+
+// inventoryManifest is the manifest.json of an S3 Inventory report
+//
+// See: https://docs.aws.amazon.com/AmazonS3/latest/userguide/storage-inventory-location.html
+type inventoryManifest struct {
+	SourceBucket      string `json:"sourceBucket"`
+	DestinationBucket string `json:"destinationBucket"`
+	CreationTimestamp string `json:"creationTimestamp"` // milliseconds since the epoch
+	FileFormat        string `json:"fileFormat"`
+	FileSchema        string `json:"fileSchema"`
+	Files             []struct {
+		Key  string `json:"key"`
+		Size int64  `json:"size"`
+	} `json:"files"`
+}
+
+// inventory is the manifest of an S3 Inventory report
+//
+// The objects in the report aren't kept in memory - they are read
+// from the files of the report each time the bucket is listed.
+type inventory struct {
+	bucket    string    // the bucket the inventory is for
+	created   time.Time // when the inventory was created
+	dstBucket string    // the bucket the files of the report are in
+	schema    string    // the columns of the files
+	files     []string  // the keys of the files of the report
+}
+
+// getInventory returns the inventory from the inventory option,
+// reading its manifest the first time it is called
+func (f *Fs) getInventory(ctx context.Context) (*inventory, error) {
+	f.inventoryMu.Lock()
+	defer f.inventoryMu.Unlock()
+	if f.inventory != nil {
+		return f.inventory, nil
+	}
+	inv, err := f.readInventory(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read inventory %q: %w", f.opt.Inventory, err)
+	}
+	fs.Infof(f, "Listing bucket %q from the %d files of its inventory created %v", inv.bucket, len(inv.files), inv.created)
+	if age := time.Since(inv.created); f.opt.InventoryMaxAge > 0 && age > time.Duration(f.opt.InventoryMaxAge) {
+		fs.Logf(f, "Inventory of bucket %q is %v old so the listings may be out of date", inv.bucket, age.Truncate(time.Second))
+	}
+	f.inventory = inv
+	return inv, nil
+}
+
+// openInventoryObject opens the object at bucketPath for reading
+func (f *Fs) openInventoryObject(ctx context.Context, bucketName, bucketPath string) (in io.ReadCloser, err error) {
+	req := s3.GetObjectInput{
+		Bucket: &bucketName,
+		Key:    &bucketPath,
+	}
+	if f.opt.RequesterPays {
+		req.RequestPayer = aws.String(s3.RequestPayerRequester)
+	}
+	var resp *s3.GetObjectOutput
+	err = f.pacer.Call(func() (bool, error) {
+		resp, err = f.c.GetObjectWithContext(ctx, &req)
+		return f.shouldRetry(ctx, err)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %q: %w", bucket.Join(bucketName, bucketPath), err)
+	}
+	return resp.Body, nil
+}
+
+// readInventory reads the manifest of the inventory
+func (f *Fs) readInventory(ctx context.Context) (inv *inventory, err error) {
+	manifestBucket, manifestPath := bucket.Split(strings.Trim(f.opt.Inventory, "/"))
+	if manifestBucket == "" || manifestPath == "" {
+		return nil, errors.New("inventory must be in the form bucket/path/to/manifest.json")
+	}
+	in, err := f.openInventoryObject(ctx, manifestBucket, manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	var manifest inventoryManifest
+	err = json.NewDecoder(in).Decode(&manifest)
+	_ = in.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	return newInventory(&manifest)
+}
+
+// newInventory makes the inventory from the manifest
+func newInventory(manifest *inventoryManifest) (*inventory, error) {
+	if !strings.EqualFold(manifest.FileFormat, "CSV") {
+		return nil, fmt.Errorf("inventory format %q not supported - only CSV inventories can be read", manifest.FileFormat)
+	}
+	if manifest.SourceBucket == "" {
+		return nil, errors.New("manifest has no sourceBucket")
+	}
+	inv := &inventory{
+		bucket: manifest.SourceBucket,
+		schema: manifest.FileSchema,
+	}
+	if manifest.CreationTimestamp != "" {
+		ms, err := strconv.ParseInt(manifest.CreationTimestamp, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad creationTimestamp in manifest: %w", err)
+		}
+		inv.created = time.UnixMilli(ms)
+	}
+	// The destinationBucket is an ARN, e.g. arn:aws:s3:::bucket
+	inv.dstBucket = manifest.DestinationBucket
+	if i := strings.LastIndex(inv.dstBucket, ":"); i >= 0 {
+		inv.dstBucket = inv.dstBucket[i+1:]
+	}
+	for _, file := range manifest.Files {
+		inv.files = append(inv.files, file.Key)
+	}
+	return inv, nil
+}
+
+// inventoryReader reads the objects from a CSV inventory file
+type inventoryReader struct {
+	in      io.ReadCloser
+	gz      *gzip.Reader   // nil if the file isn't compressed
+	r       *csv.Reader    // reads the records
+	columns map[string]int // column number by name
+	key     int            // column of the Key
+	records int            // number of records read so far
+}
+
+// newInventoryReader reads the objects from in which has the columns
+// in schema
+func newInventoryReader(in io.ReadCloser, schema string, gzipped bool) (ir *inventoryReader, err error) {
+	ir = &inventoryReader{
+		in:      in,
+		columns: map[string]int{},
+	}
+	for i, name := range strings.Split(schema, ",") {
+		ir.columns[strings.TrimSpace(name)] = i
+	}
+	var ok bool
+	ir.key, ok = ir.columns["Key"]
+	if !ok {
+		_ = in.Close()
+		return nil, errors.New("no Key in inventory schema")
+	}
+	var r io.Reader = in
+	if gzipped {
+		ir.gz, err = gzip.NewReader(in)
+		if err != nil {
+			_ = in.Close()
+			return nil, err
+		}
+		r = ir.gz
+	}
+	ir.r = csv.NewReader(r)
+	ir.r.FieldsPerRecord = -1
+	ir.r.ReuseRecord = true
+	return ir, nil
+}
+
+// get returns the value of the named column or "" if not present
+func (ir *inventoryReader) get(record []string, name string) string {
+	i, ok := ir.columns[name]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return record[i]
+}
+
+// skip skips over n records
+func (ir *inventoryReader) skip(n int) error {
+	for ir.records < n {
+		if _, err := ir.r.Read(); err != nil {
+			return err
+		}
+		ir.records++
+	}
+	return nil
+}
+
+// next returns the next current object in the file or io.EOF if there
+// are no more
+func (ir *inventoryReader) next() (*s3.Object, error) {
+	for {
+		record, err := ir.r.Read()
+		if err != nil {
+			return nil, err
+		}
+		ir.records++
+		// Skip old versions and delete markers in versioned inventories
+		if ir.get(record, "IsLatest") == "false" || ir.get(record, "IsDeleteMarker") == "true" {
+			continue
+		}
+		if ir.key >= len(record) {
+			return nil, fmt.Errorf("record has no Key: %q", record)
+		}
+		// The keys are URL encoded in CSV inventories
+		key, err := url.QueryUnescape(record[ir.key])
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode key %q: %w", record[ir.key], err)
+		}
+		object := &s3.Object{
+			Key: aws.String(key),
+		}
+		if size := ir.get(record, "Size"); size != "" {
+			n, err := strconv.ParseInt(size, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad Size for %q: %w", key, err)
+			}
+			object.Size = &n
+		}
+		if lastModified := ir.get(record, "LastModifiedDate"); lastModified != "" {
+			t, err := time.Parse(time.RFC3339, lastModified)
+			if err != nil {
+				return nil, fmt.Errorf("bad LastModifiedDate for %q: %w", key, err)
+			}
+			object.LastModified = &t
+		}
+		if etag := ir.get(record, "ETag"); etag != "" {
+			object.ETag = aws.String(`"` + etag + `"`)
+		}
+		if storageClass := ir.get(record, "StorageClass"); storageClass != "" {
+			object.StorageClass = aws.String(storageClass)
+		}
+		return object, nil
+	}
+}
+
+// close the file
+func (ir *inventoryReader) close() error {
+	if ir.gz != nil {
+		_ = ir.gz.Close()
+	}
+	return ir.in.Close()
+}
+
+// Inventory bucket lister
+//
+// This reads the files of the inventory one record at a time,
+// returning the objects in pages of up to MaxKeys as ListObjectsV2
+// would, so only a page of objects is in memory at once.
+type inventoryList struct {
+	f        *Fs
+	inv      *inventory
+	req      s3.ListObjectsV2Input
+	encode   bool
+	file     int                 // index of the file being read
+	ir       *inventoryReader    // reader for the file - nil if not open
+	records  int                 // records of the file returned so far
+	prefixes map[string]struct{} // common prefixes returned so far
+}
+
+// Create a new inventory bucket lister for the request if the
+// inventory option is set and can be used for this listing.
+//
+// It returns nil if the bucket should be listed with the API.
+func (f *Fs) newInventoryList(ctx context.Context, req *s3.ListObjectsV2Input, opt listOpt) (bucketLister, error) {
+	if f.opt.Inventory == "" || opt.withVersions || opt.versionAt.IsSet() || opt.restoreStatus {
+		return nil, nil
+	}
+	inv, err := f.getInventory(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if inv.bucket != aws.StringValue(req.Bucket) {
+		return nil, nil
+	}
+	return &inventoryList{
+		f:        f,
+		inv:      inv,
+		req:      *req,
+		prefixes: map[string]struct{}{},
+	}, nil
+}
+
+// open opens the current file, carrying on after the records
+// returned already if it was open before
+func (ls *inventoryList) open(ctx context.Context) error {
+	key := ls.inv.files[ls.file]
+	in, err := ls.f.openInventoryObject(ctx, ls.inv.dstBucket, key)
+	if err != nil {
+		return err
+	}
+	ls.ir, err = newInventoryReader(in, ls.inv.schema, strings.HasSuffix(key, ".gz"))
+	if err != nil {
+		return fmt.Errorf("failed to read %q: %w", key, err)
+	}
+	if err = ls.ir.skip(ls.records); err != nil {
+		ls.closeFile()
+		return fmt.Errorf("failed to read %q: %w", key, err)
+	}
+	return nil
+}
+
+// closeFile closes the current file if open
+func (ls *inventoryList) closeFile() {
+	if ls.ir != nil {
+		_ = ls.ir.close()
+		ls.ir = nil
+	}
+}
+
+// List the next page of objects from the inventory in the same form
+// ListObjectsV2 would return them
+//
+// If reading fails the file is opened again on the next call,
+// carrying on from the end of the last page returned. Pages don't
+// span files.
+func (ls *inventoryList) List(ctx context.Context) (resp *s3.ListObjectsV2Output, versionIDs []*string, err error) {
+	prefix := aws.StringValue(ls.req.Prefix)
+	delimiter := aws.StringValue(ls.req.Delimiter)
+	maxKeys := int(aws.Int64Value(ls.req.MaxKeys))
+	if maxKeys <= 0 {
+		maxKeys = 1000
+	}
+	encode := func(s string) *string {
+		if ls.encode {
+			s = url.QueryEscape(s)
+		}
+		return &s
+	}
+	resp = &s3.ListObjectsV2Output{}
+	startRecords := ls.records
+	var added []string // common prefixes added in this page
+	// fail abandons the page so it is read again next time
+	fail := func(err error) (*s3.ListObjectsV2Output, []*string, error) {
+		ls.closeFile()
+		ls.records = startRecords
+		for _, commonPrefix := range added {
+			delete(ls.prefixes, commonPrefix)
+		}
+		return nil, nil, err
+	}
+	for n := 0; n < maxKeys && ls.file < len(ls.inv.files); {
+		if ls.ir == nil {
+			if err = ls.open(ctx); err != nil {
+				return fail(err)
+			}
+		}
+		object, err := ls.ir.next()
+		if err == io.EOF {
+			ls.closeFile()
+			ls.file++
+			ls.records, startRecords = 0, 0
+			if n > 0 {
+				// pages don't span files so they can be read again
+				break
+			}
+			continue
+		}
+		if err != nil {
+			return fail(fmt.Errorf("failed to read %q: %w", ls.inv.files[ls.file], err))
+		}
+		ls.records = ls.ir.records
+		key := *object.Key
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if delimiter != "" {
+			if j := strings.Index(key[len(prefix):], delimiter); j >= 0 {
+				commonPrefix := key[:len(prefix)+j+len(delimiter)]
+				if _, found := ls.prefixes[commonPrefix]; !found {
+					ls.prefixes[commonPrefix] = struct{}{}
+					added = append(added, commonPrefix)
+					resp.CommonPrefixes = append(resp.CommonPrefixes, &s3.CommonPrefix{Prefix: encode(commonPrefix)})
+					n++
+				}
+				continue
+			}
+		}
+		object.Key = encode(key)
+		resp.Contents = append(resp.Contents, object)
+		n++
+	}
+	resp.IsTruncated = aws.Bool(ls.file < len(ls.inv.files))
+	return resp, nil, nil
+}
+
+// URL Encode the listings
+func (ls *inventoryList) URLEncodeListings(encode bool) {
+	ls.encode = encode
+}
+
+// Close the file being read if the listing is stopped part way
+func (ls *inventoryList) Close() error {
+	ls.closeFile()
+	return nil
+}
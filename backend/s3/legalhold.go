@@ -0,0 +1,184 @@
+// This file implements the legal-hold backend command
+
+package s3
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"golang.org/x/sync/errgroup"
+)
+
+// Returned from "legal-hold"
+type legalHoldStatusOut struct {
+	Status    string
+	Remote    string
+	LegalHold string
+}
+
+// checkObjectLock returns an error if the bucket doesn't have object
+// lock enabled. Other errors reading the object lock configuration,
+// such as not having permission to, are ignored.
+func (f *Fs) checkObjectLock(ctx context.Context, bucket string) error {
+	req := s3.GetObjectLockConfigurationInput{
+		Bucket: &bucket,
+	}
+	var resp *s3.GetObjectLockConfigurationOutput
+	err := f.pacer.Call(func() (bool, error) {
+		var err error
+		resp, err = f.c.GetObjectLockConfigurationWithContext(ctx, &req)
+		return f.shouldRetry(ctx, err)
+	})
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "ObjectLockConfigurationNotFoundError" {
+		return fmt.Errorf("bucket %q doesn't have object lock enabled so can't have legal holds", bucket)
+	}
+	if err != nil {
+		fs.Debugf(f, "Couldn't read object lock configuration of bucket %q: %v", bucket, err)
+		return nil
+	}
+	if resp.ObjectLockConfiguration == nil || resp.ObjectLockConfiguration.ObjectLockEnabled == nil || *resp.ObjectLockConfiguration.ObjectLockEnabled != s3.ObjectLockEnabledEnabled {
+		return fmt.Errorf("bucket %q doesn't have object lock enabled so can't have legal holds", bucket)
+	}
+	return nil
+}
+
+// legalHold reads the legal hold status of the objects or sets it if
+// status is set in opt
+func (f *Fs) legalHold(ctx context.Context, opt map[string]string) (out []legalHoldStatusOut, err error) {
+	var status string
+	if s, ok := opt["status"]; ok {
+		status = strings.ToUpper(s)
+		if status != s3.ObjectLockLegalHoldStatusOn && status != s3.ObjectLockLegalHoldStatusOff {
+			return nil, fmt.Errorf("legal hold status must be %s or %s not %q", s3.ObjectLockLegalHoldStatusOn, s3.ObjectLockLegalHoldStatusOff, s)
+		}
+	}
+	concurrency := fs.GetConfig(ctx).CheckersFor(f)
+	if s := opt["concurrency"]; s != "" {
+		concurrency, err = strconv.Atoi(s)
+		if err != nil || concurrency < 1 {
+			return nil, fmt.Errorf("bad concurrency %q", s)
+		}
+	}
+
+	// Check the object lock of each bucket once, failing straight
+	// away if the root bucket doesn't have it
+	var (
+		bucketsMu sync.Mutex
+		buckets   = map[string]error{}
+	)
+	checkBucket := func(bucket string) error {
+		bucketsMu.Lock()
+		defer bucketsMu.Unlock()
+		err, found := buckets[bucket]
+		if !found {
+			err = f.checkObjectLock(ctx, bucket)
+			buckets[bucket] = err
+		}
+		return err
+	}
+	if f.rootBucket != "" {
+		if err := checkBucket(f.rootBucket); err != nil {
+			return nil, err
+		}
+	}
+
+	action := "read"
+	if status != "" {
+		action = "set"
+	}
+	var outMu sync.Mutex
+	out = []legalHoldStatusOut{}
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrency)
+	err = operations.ListFn(ctx, f, func(obj fs.Object) {
+		st := legalHoldStatusOut{Status: "OK", Remote: obj.Remote(), LegalHold: status}
+		addStatus := func() {
+			outMu.Lock()
+			out = append(out, st)
+			outMu.Unlock()
+		}
+		o, ok := obj.(*Object)
+		if !ok {
+			st.Status = "Not an S3 object"
+			addStatus()
+			return
+		}
+		if status != "" && operations.SkipDestructive(ctx, obj, "set legal hold "+status) {
+			addStatus()
+			return
+		}
+		g.Go(func() error {
+			defer addStatus()
+			bucket, _ := o.split()
+			err := checkBucket(bucket)
+			if err == nil {
+				st.LegalHold, err = o.legalHold(gCtx, status)
+			}
+			if err != nil {
+				fs.Errorf(o, "Failed to %s legal hold: %v", action, err)
+				st.Status = err.Error()
+				st.LegalHold = ""
+			}
+			return nil
+		})
+	})
+	gErr := g.Wait()
+	if err != nil {
+		return out, err
+	}
+	return out, gErr
+}
+
+// legalHold sets the legal hold status of the object to status if
+// set and returns the legal hold status of the object.
+func (o *Object) legalHold(ctx context.Context, status string) (string, error) {
+	bucket, bucketPath := o.split()
+	if status != "" {
+		req := s3.PutObjectLegalHoldInput{
+			Bucket:    &bucket,
+			Key:       &bucketPath,
+			VersionId: o.versionID,
+			LegalHold: &s3.ObjectLockLegalHold{
+				Status: &status,
+			},
+		}
+		err := o.fs.pacer.Call(func() (bool, error) {
+			_, err := o.fs.c.PutObjectLegalHoldWithContext(ctx, &req)
+			return o.fs.shouldRetry(ctx, err)
+		})
+		if err != nil {
+			return "", err
+		}
+		fs.Infof(o, "Set legal hold %s", status)
+		return status, nil
+	}
+	req := s3.GetObjectLegalHoldInput{
+		Bucket:    &bucket,
+		Key:       &bucketPath,
+		VersionId: o.versionID,
+	}
+	var resp *s3.GetObjectLegalHoldOutput
+	err := o.fs.pacer.Call(func() (bool, error) {
+		var err error
+		resp, err = o.fs.c.GetObjectLegalHoldWithContext(ctx, &req)
+		return o.fs.shouldRetry(ctx, err)
+	})
+	// Objects which have never had a legal hold don't have one
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "NoSuchObjectLockConfiguration" {
+		return s3.ObjectLockLegalHoldStatusOff, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if resp.LegalHold == nil || resp.LegalHold.Status == nil {
+		return s3.ObjectLockLegalHoldStatusOff, nil
+	}
+	return *resp.LegalHold.Status, nil
+}
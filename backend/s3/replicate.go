@@ -0,0 +1,264 @@
+// This file implements the replicate-versions backend command
+
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/operations"
+	"golang.org/x/sync/errgroup"
+)
+
+// keyVersion is an entry in the version history of a key
+type keyVersion struct {
+	versionID    string
+	size         int64
+	etag         string
+	lastModified time.Time
+	deleteMarker bool
+}
+
+// matches returns true if the destination version dst could be a
+// replica of v
+func (v *keyVersion) matches(dst *keyVersion) bool {
+	if v.deleteMarker || dst.deleteMarker {
+		return v.deleteMarker == dst.deleteMarker
+	}
+	return v.size == dst.size
+}
+
+// String describes the version
+func (v *keyVersion) String() string {
+	if v.deleteMarker {
+		return fmt.Sprintf("delete marker %q from %v", v.versionID, v.lastModified)
+	}
+	return fmt.Sprintf("version %q from %v", v.versionID, v.lastModified)
+}
+
+// listKeyVersions lists all the versions and delete markers of the
+// keys starting with prefix in bucket calling fn with the history of
+// each key in turn, oldest first.
+//
+// If exact is set then only the key which is equal to prefix is
+// listed.
+func (f *Fs) listKeyVersions(ctx context.Context, bucket, prefix string, exact bool, fn func(key string, versions []keyVersion) error) error {
+	req := s3.ListObjectVersionsInput{
+		Bucket: &bucket,
+		Prefix: &prefix,
+	}
+	if f.opt.RequesterPays {
+		req.RequestPayer = aws.String(s3.RequestPayerRequester)
+	}
+	var (
+		key      string
+		versions []keyVersion
+	)
+	flush := func() error {
+		if len(versions) == 0 {
+			return nil
+		}
+		// S3 returns the versions newest first
+		for i, j := 0, len(versions)-1; i < j; i, j = i+1, j-1 {
+			versions[i], versions[j] = versions[j], versions[i]
+		}
+		err := fn(key, versions)
+		versions = nil
+		return err
+	}
+	for {
+		var resp *s3.ListObjectVersionsOutput
+		err := f.pacer.Call(func() (bool, error) {
+			var err error
+			resp, err = f.c.ListObjectVersionsWithContext(ctx, &req)
+			return f.shouldRetry(ctx, err)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list versions: %w", err)
+		}
+		for _, v := range mergeDeleteMarkers(resp.Versions, resp.DeleteMarkers) {
+			k := aws.StringValue(v.Key)
+			if exact && k != prefix {
+				continue
+			}
+			if k != key {
+				if err := flush(); err != nil {
+					return err
+				}
+				key = k
+			}
+			versions = append(versions, keyVersion{
+				versionID:    aws.StringValue(v.VersionId),
+				size:         aws.Int64Value(v.Size),
+				etag:         aws.StringValue(v.ETag),
+				lastModified: aws.TimeValue(v.LastModified),
+				deleteMarker: v.Size == isDeleteMarker,
+			})
+		}
+		if !aws.BoolValue(resp.IsTruncated) {
+			break
+		}
+		req.KeyMarker = resp.NextKeyMarker
+		req.VersionIdMarker = resp.NextVersionIdMarker
+	}
+	return flush()
+}
+
+// Returned from "replicate-versions"
+type replicateVersionsOut struct {
+	Keys          int `json:"keys"`          // number of keys examined
+	Versions      int `json:"versions"`      // number of object versions copied
+	DeleteMarkers int `json:"deleteMarkers"` // number of delete markers created
+	Skipped       int `json:"skipped"`       // number of versions already replicated
+	Errors        int `json:"errors"`        // number of keys which couldn't be replicated
+}
+
+// replicateVersions copies the version history of every key in f to
+// the s3 remote dstRemote, oldest first, so the history of the
+// destination mirrors the source.
+func (f *Fs) replicateVersions(ctx context.Context, dstRemote string) (out *replicateVersionsOut, err error) {
+	fdst, err := cache.Get(ctx, dstRemote)
+	if err != nil && err != fs.ErrorIsFile {
+		return nil, fmt.Errorf("failed to make destination %q: %w", dstRemote, err)
+	}
+	dst, ok := fdst.(*Fs)
+	if !ok {
+		return nil, fmt.Errorf("destination %q must be an s3 remote", dstRemote)
+	}
+	srcBucket, srcDirectory := f.split("")
+	if srcBucket == "" || dst.rootBucket == "" {
+		return nil, errors.New("need a bucket for the source and the destination")
+	}
+	status, err := dst.setGetVersioning(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read versioning of destination: %w", err)
+	}
+	if status != s3.BucketVersioningStatusEnabled {
+		return nil, fmt.Errorf("destination bucket must have versioning enabled but it is %q", status)
+	}
+	prefix := srcDirectory
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	out = new(replicateVersionsOut)
+	var outMu sync.Mutex
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(f.ci.Transfers)
+	err = f.listKeyVersions(gCtx, srcBucket, prefix, false, func(key string, versions []keyVersion) error {
+		remote := strings.TrimPrefix(key, prefix)
+		g.Go(func() error {
+			st, err := f.replicateKeyVersions(gCtx, dst, remote, srcBucket, key, versions)
+			outMu.Lock()
+			defer outMu.Unlock()
+			out.Keys++
+			out.Versions += st.Versions
+			out.DeleteMarkers += st.DeleteMarkers
+			out.Skipped += st.Skipped
+			if err != nil {
+				out.Errors++
+				fs.Errorf(remote, "Failed to replicate versions: %v", fs.CountError(err))
+			}
+			return nil
+		})
+		return nil
+	})
+	waitErr := g.Wait()
+	if err == nil {
+		err = waitErr
+	}
+	if err == nil && out.Errors > 0 {
+		err = fmt.Errorf("failed to replicate the versions of %d keys", out.Errors)
+	}
+	return out, err
+}
+
+// replicateKeyVersions copies the versions of srcKey in srcBucket
+// which aren't in the history of remote in dst yet.
+//
+// The history in dst must be the same as the start of versions,
+// otherwise it returns an error as versions can't be inserted in the
+// middle of the history.
+func (f *Fs) replicateKeyVersions(ctx context.Context, dst *Fs, remote, srcBucket, srcKey string, versions []keyVersion) (st replicateVersionsOut, err error) {
+	dstBucket, dstKey := dst.split(remote)
+	var dstVersions []keyVersion
+	err = dst.listKeyVersions(ctx, dstBucket, dstKey, true, func(key string, versions []keyVersion) error {
+		dstVersions = versions
+		return nil
+	})
+	if err != nil {
+		return st, err
+	}
+	if len(dstVersions) > len(versions) {
+		return st, fmt.Errorf("destination has %d versions but source only has %d", len(dstVersions), len(versions))
+	}
+	for i := range dstVersions {
+		if !versions[i].matches(&dstVersions[i]) {
+			return st, fmt.Errorf("destination history differs from source at %v", &versions[i])
+		}
+	}
+	st.Skipped = len(dstVersions)
+	for i := len(dstVersions); i < len(versions); i++ {
+		v := &versions[i]
+		if operations.SkipDestructive(ctx, remote, fmt.Sprintf("replicate %v", v)) {
+			continue
+		}
+		if v.deleteMarker {
+			err = dst.createDeleteMarker(ctx, dstBucket, dstKey)
+			if err != nil {
+				return st, fmt.Errorf("failed to create %v: %w", v, err)
+			}
+			st.DeleteMarkers++
+		} else {
+			err = f.copyVersion(ctx, dst, remote, srcBucket, srcKey, dstBucket, dstKey, v)
+			if err != nil {
+				return st, fmt.Errorf("failed to copy %v: %w", v, err)
+			}
+			st.Versions++
+		}
+		fs.Infof(remote, "Replicated %v", v)
+	}
+	return st, nil
+}
+
+// copyVersion copies version v of srcKey to dstKey in dst with a
+// server-side copy keeping its metadata
+func (f *Fs) copyVersion(ctx context.Context, dst *Fs, remote, srcBucket, srcKey, dstBucket, dstKey string, v *keyVersion) error {
+	src := &Object{
+		fs:           f,
+		remote:       remote,
+		bytes:        v.size,
+		lastModified: v.lastModified,
+		versionID:    aws.String(v.versionID),
+	}
+	src.setMD5FromEtag(v.etag)
+	req := s3.CopyObjectInput{
+		MetadataDirective: aws.String(s3.MetadataDirectiveCopy),
+	}
+	_, err := dst.copy(ctx, &req, dstBucket, dstKey, srcBucket, srcKey, src)
+	return err
+}
+
+// createDeleteMarker deletes key in bucket without a version ID which
+// makes a delete marker in a versioned bucket
+func (f *Fs) createDeleteMarker(ctx context.Context, bucket, key string) error {
+	req := s3.DeleteObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	}
+	if f.opt.RequesterPays {
+		req.RequestPayer = aws.String(s3.RequestPayerRequester)
+	}
+	return f.pacer.Call(func() (bool, error) {
+		_, err := f.c.DeleteObjectWithContext(ctx, &req)
+		return f.shouldRetry(ctx, err)
+	})
+}
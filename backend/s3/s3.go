@@ -24,7 +24,9 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 
@@ -46,6 +48,7 @@ import (
 	"github.com/rclone/rclone/fs/config"
 	"github.com/rclone/rclone/fs/config/configmap"
 	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/filter"
 	"github.com/rclone/rclone/fs/fserrors"
 	"github.com/rclone/rclone/fs/fshttp"
 	"github.com/rclone/rclone/fs/hash"
@@ -62,6 +65,7 @@ import (
 	"github.com/rclone/rclone/lib/version"
 	"golang.org/x/net/http/httpguts"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/singleflight"
 )
 
 // The S3 providers
@@ -1831,6 +1835,31 @@ the default (private) will be used.
 				Help:     "Owner gets FULL_CONTROL.\nThe AuthenticatedUsers group gets READ access.\nNot supported on Buckets.\nThis acl is available on IBM Cloud (Infra) and On-Premise IBM COS.",
 				Provider: "IBMCOS",
 			}},
+		}, {
+			Name: "acl_rules",
+			Help: `Canned ACLs to use for objects matching globs.
+
+This is a comma separated list of glob=acl rules. When an object is
+uploaded or server-side copied the rules are checked in order and the
+canned ACL of the first rule whose glob matches the key of the object
+in the bucket is used instead of "acl". If no rule matches then "acl"
+is used.
+
+The globs are the same as those used in filters, so a glob starting
+with / matches from the root of the bucket, and one without matches
+at any directory level. For example
+
+    /public/**=public-read,*.key=private
+
+Makes objects under public/ publicly readable and any .key files
+private, wherever they are. Use quotes around a rule if the glob
+contains a comma, for example
+
+    "/{css,js}/**=public-read"
+`,
+			Provider: "!Storj,Synology,Cloudflare",
+			Default:  fs.CommaSepList{},
+			Advanced: true,
 		}, {
 			Name: "bucket_acl",
 			Help: `Canned ACL used when creating buckets.
@@ -1857,6 +1886,69 @@ header is added and the default (private) will be used.
 				Value: "authenticated-read",
 				Help:  "Owner gets FULL_CONTROL.\nThe AuthenticatedUsers group gets READ access.",
 			}},
+		}, {
+			Name: "bucket_encryption",
+			Help: `Default server-side encryption set on buckets rclone creates.
+
+If set rclone sets this as the default encryption of each bucket it
+creates, so objects put in the bucket by any tool are encrypted. If it
+is "aws:kms" the key in "sse_kms_key_id" is used, or the AWS managed
+key if that isn't set.
+
+This is only applied when creating buckets.`,
+			Provider: "AWS,Ceph,ChinaMobile,Minio",
+			Advanced: true,
+			Examples: []fs.OptionExample{{
+				Value: "",
+				Help:  "None",
+			}, {
+				Value: "AES256",
+				Help:  "AES256",
+			}, {
+				Value: "aws:kms",
+				Help:  "aws:kms",
+			}},
+		}, {
+			Name: "bucket_versioning",
+			Help: `If set, enable versioning on buckets rclone creates.
+
+This is only applied when creating buckets. Use the "versioning"
+backend command to change it on existing buckets.`,
+			Default:  false,
+			Advanced: true,
+		}, {
+			Name: "bucket_object_lock",
+			Help: `If set, enable object lock on buckets rclone creates.
+
+This also enables versioning on the bucket. Object lock can only be
+enabled when a bucket is created.
+
+Use "bucket_object_lock_mode" and "bucket_object_lock_days" to set a
+default retention for objects put in the bucket.`,
+			Default:  false,
+			Advanced: true,
+		}, {
+			Name: "bucket_object_lock_mode",
+			Help: `Default object lock retention mode of buckets rclone creates.
+
+If set, "bucket_object_lock_days" must be set too and object lock is
+enabled on the bucket.`,
+			Advanced: true,
+			Examples: []fs.OptionExample{{
+				Value: "",
+				Help:  "No default retention",
+			}, {
+				Value: "GOVERNANCE",
+				Help:  "Users with special permissions can remove or shorten the retention",
+			}, {
+				Value: "COMPLIANCE",
+				Help:  "No user can remove or shorten the retention",
+			}},
+		}, {
+			Name:     "bucket_object_lock_days",
+			Help:     `Default object lock retention in days of buckets rclone creates.`,
+			Default:  0,
+			Advanced: true,
 		}, {
 			Name:     "requester_pays",
 			Help:     "Enables requester pays option when interacting with S3 bucket.",
@@ -1939,6 +2031,28 @@ If you leave it blank, this is calculated automatically from the sse_customer_ke
 				Help:  "None",
 			}},
 			Sensitive: true,
+		}, {
+			Name: "preserve_encryption",
+			Help: strings.ReplaceAll(`Copy the server-side encryption of S3 source objects.
+
+Normally objects are stored with the encryption set by
+|server_side_encryption| and |sse_kms_key_id|, or the bucket's default
+encryption if those aren't set, whatever the encryption of the object
+they were copied from.
+
+If this is set then when copying from another S3 object (either
+server-side or between S3 remotes) rclone reads the encryption of the
+source object and stores the destination with the same encryption
+algorithm and KMS key instead.
+
+This isn't possible if the KMS key of the source is in a different
+region to the destination, or if either the source or destination
+uses SSE-C, in which case rclone will log a warning and use the
+destination's encryption settings.
+`, "|", "`"),
+			Provider: "AWS,Ceph,Minio",
+			Default:  false,
+			Advanced: true,
 		}, {
 			Name:     "storage_class",
 			Help:     "The storage class to use when storing new objects in S3.",
@@ -2134,6 +2248,23 @@ large file of a known size to stay below this number of chunks limit.
 `,
 			Default:  maxUploadParts,
 			Advanced: true,
+		}, {
+			Name: "chunk_size_alignment",
+			Help: `Round the chunk size up to a multiple of this.
+
+Some S3 gateways perform best when the parts of a multipart upload are
+a multiple of a particular size, for example 8 MiB. If this is set
+then the chunk size rclone calculates for a multipart upload will be
+rounded up to a multiple of it.
+
+Rounding up only ever makes the chunks bigger, so the minimum chunk
+size and the max_upload_parts limit are still respected. If rounding
+up would make the chunks bigger than the maximum part size of 5 GiB
+then the chunk size is left unaligned.
+
+Set to 0 to disable.`,
+			Default:  fs.SizeSuffix(0),
+			Advanced: true,
 		}, {
 			Name: "copy_cutoff",
 			Help: `Cutoff for switching to multipart copy.
@@ -2246,6 +2377,37 @@ WARNING: Storing parts of an incomplete multipart upload counts towards space us
 `,
 			Default:  false,
 			Advanced: true,
+		}, {
+			Name: "multipart_complete_retries",
+			Help: `Number of extra attempts to complete a multipart upload.
+
+Once all the parts of a multipart upload have been uploaded rclone
+completes it. If this fails with a retriable error, even after the
+low level retries, rclone waits (1s, then 2s, 4s, ...) and tries to
+complete it again this many times before aborting the upload, so the
+parts uploaded aren't wasted.
+
+If the response to a completion which succeeded gets lost, the retry
+fails as the upload doesn't exist any more. In this case rclone checks
+whether the object has the ETag the upload should have given it and
+if so treats the upload as successful.
+`,
+			Default:  3,
+			Advanced: true,
+		}, {
+			Name: "multipart_complete_concurrency",
+			Help: `Maximum number of multipart uploads to complete at once.
+
+When many large files are uploaded at once their multipart uploads
+can all finish at the same time. Completing a multipart upload is an
+expensive call for the provider and a burst of them can trip its rate
+limits, so rclone only completes this many at once and the rest wait
+their turn.
+
+Set to 0 for no limit.
+`,
+			Default:  4,
+			Advanced: true,
 		}, {
 			Name: "list_chunk",
 			Help: `Size of listing chunk (response list for each ListObject S3 request).
@@ -2285,6 +2447,100 @@ rclone's choice here.
 `,
 			Default:  fs.Tristate{},
 			Advanced: true,
+		}, {
+			Name: "list_retries",
+			Help: `Number of times to retry a page of a listing which fails part way through.
+
+Each page of a listing is retried --low-level-retries times. If a
+page after the first still fails with an error which can be retried,
+rclone carries on the listing from that page this many more times
+rather than failing the whole listing, which would mean listing
+everything again.
+
+This helps when listing big buckets over unreliable links.
+
+Set to 0 to fail the listing when the low level retries run out.
+`,
+			Default:  3,
+			Advanced: true,
+		}, {
+			Name: "list_coalesce",
+			Help: `Share listings of the same directory which are made at the same time.
+
+If this is set then when a directory is listed while a listing of the
+same directory is already in progress, rclone waits for that listing
+and uses its result rather than listing the directory again. This
+saves transactions when lots of things are reading the same
+directories at once, for example with rclone mount or rclone serve.
+
+Note that a listing shared like this may not include objects which
+were uploaded after it started.
+`,
+			Default:  false,
+			Advanced: true,
+		}, {
+			Name:     "invalid_utf8",
+			Default:  invalidUTF8Encode,
+			Advanced: true,
+			Help: strings.ReplaceAll(`How to list objects whose names aren't valid UTF-8
+
+S3 object keys can contain byte sequences which aren't valid UTF-8,
+usually written by tools which don't check them. This controls what
+rclone does with them when listing.
+
+- |encode| - pass the names through the |encoding| option. With the
+  default encoding the invalid bytes are replaced with quoted
+  characters which rclone maps back when reading the object.
+- |skip| - leave the objects out of listings, logging the name of
+  each one skipped and how many were skipped.
+- |percent| - replace each invalid byte with |%XX| where |XX| is the
+  byte in upper case hex, so a key of |file\xff.txt| is listed as
+  |file%FF.txt|, which most destinations can store.
+
+With |percent| the names listed are read from the real keys, as are
+files in the directories listed. Other names with |%XX| in, for
+example files being written, are stored as they are.
+`, "|", "`"),
+		}, {
+			Name: "inventory",
+			Help: `Path to an S3 Inventory manifest.json to list the bucket from.
+
+For buckets with very large numbers of objects, reading an [S3
+Inventory](https://docs.aws.amazon.com/AmazonS3/latest/userguide/storage-inventory.html)
+report is much quicker and cheaper than listing the bucket with
+ListObjects.
+
+If this is set then listings of the bucket the inventory is for are
+read from the inventory instead of calling the API. This is used by
+any command which lists the bucket, for example sync, check and ls.
+
+Set it to the bucket and path of the manifest.json of the report, e.g.
+
+    inventory-bucket/source-bucket/config-id/2024-05-01T01-00Z/manifest.json
+
+Only inventories in the CSV format are supported - inventories in the
+Parquet or ORC formats can't be read.
+
+The manifest is read once when it is first needed. Each listing reads
+the objects from the files of the report as it goes rather than
+keeping them in memory, so use --fast-list to list the whole bucket
+with one pass through the report rather than one per directory.
+
+Note that the listings will be as old as the inventory, so objects
+created or deleted since the inventory was made won't be seen. See
+inventory_max_age.
+`,
+			Advanced: true,
+		}, {
+			Name: "inventory_max_age",
+			Help: `Warn if the inventory is older than this.
+
+Inventories are typically made once a day, so if rclone reads an
+inventory older than this it will log a warning that the listings
+may be out of date. Set to 0 to disable the warning.
+`,
+			Default:  fs.Duration(48 * time.Hour),
+			Advanced: true,
 		}, {
 			Name: "no_check_bucket",
 			Help: `If set, don't attempt to check the bucket exists or create it.
@@ -2295,6 +2551,19 @@ rclone does if you know the bucket exists already.
 It can also be needed if the user you are using does not have bucket
 creation permissions. Before v1.52.0 this would have passed silently
 due to a bug.
+`,
+			Default:  false,
+			Advanced: true,
+		}, {
+			Name: "no_create_bucket",
+			Help: `If set, don't create buckets which don't exist.
+
+Normally rclone creates the bucket if it doesn't exist when it needs
+to write to it. If this is set then rclone will return an error
+instead, which can be safer if a mistyped bucket name shouldn't be
+created.
+
+This is ignored if "no_check_bucket" is set.
 `,
 			Default:  false,
 			Advanced: true,
@@ -2336,6 +2605,25 @@ very small even with this flag.
 			Help:     `If set, do not do HEAD before GET when getting objects.`,
 			Default:  false,
 			Advanced: true,
+		}, {
+			Name: "wait_visible",
+			Help: `Wait up to this long for written objects to become visible.
+
+AWS S3 is strongly consistent, so objects can be read as soon as they
+have been written, but some S3 compatible providers are only
+eventually consistent. This means an object may not be found (or the
+old version found) for a while after it has been uploaded or copied,
+which can make operations after the write fail or miss it.
+
+If this is set then after writing an object rclone will HEAD it,
+backing off exponentially between attempts, until it is visible with
+the new contents, or return an error if it isn't visible in this
+time. This is done even if "no_head" is set.
+
+Leave this at 0 (the default) to not wait.
+`,
+			Default:  fs.Duration(0),
+			Advanced: true,
 		}, {
 			Name:     config.ConfigEncoding,
 			Help:     config.ConfigEncodingHelp,
@@ -2386,13 +2674,25 @@ cheaper egress for data downloaded through the CloudFront network.`,
 			Advanced: true,
 		}, {
 			Name:     "directory_markers",
-			Default:  false,
+			Default:  dirMarkersNoCreate,
 			Advanced: true,
-			Help: `Upload an empty object with a trailing slash when a new directory is created
-
-Empty folders are unsupported for bucket based remotes, this option creates an empty
-object ending with "/", to persist the folder.
-`,
+			Help: strings.ReplaceAll(`How to use directory markers
+
+Empty folders are unsupported for bucket based remotes. Some tools
+represent a folder with a directory marker, which is an empty object
+whose name ends with "/". This controls how rclone uses them.
+
+- |no-create| - don't create directory markers. Any existing markers
+  are shown as directories in listings.
+- |create| - upload a directory marker for each new directory and
+  remove it when the directory is removed, to persist empty folders.
+- |preserve| - don't create directory markers, but treat existing
+  markers as real directories, so an empty directory with a marker
+  exists and is only removed by rclone when the directory itself is
+  removed, not when syncing into it.
+
+For compatibility |false| means |no-create| and |true| means |create|.
+`, "|", "`"),
 		}, {
 			Name: "use_multipart_etag",
 			Help: `Whether to use ETag in multipart uploads for verification
@@ -2401,6 +2701,52 @@ This should be true, false or left unset to use the default for the provider.
 `,
 			Default:  fs.Tristate{},
 			Advanced: true,
+		}, {
+			Name: "use_object_attributes",
+			Help: strings.ReplaceAll(`Whether to read SHA-256, SHA-1 and CRC-32 checksums with GetObjectAttributes
+
+If this is set rclone will support the SHA-256, SHA-1 and CRC-32
+hashes as well as MD5. These are read from the checksums S3 stores for
+objects uploaded with the |x-amz-checksum-*| headers using the
+|GetObjectAttributes| call. This means these checksums can be used
+with |--checksum| and |rclone check| without downloading the objects.
+
+Objects uploaded without a checksum or uploaded as multipart uploads
+(which only have a checksum of the checksums of the parts) will return
+an empty hash for these types.
+
+Reading the checksums costs an extra transaction per object so this
+is off by default. Not all S3 providers support |GetObjectAttributes|.
+`, "|", "`"),
+			Default:  false,
+			Advanced: true,
+		}, {
+			Name: "read_acl",
+			Help: strings.ReplaceAll(`Whether to read the ACL of objects into their metadata
+
+If this is set rclone will read the ACL of each object with
+|GetObjectAcl| when its metadata is read and return its grants as the
+|acl-grants| metadata, e.g. in |rclone lsjson --metadata|. This is
+useful for auditing the permissions of the objects in a bucket.
+
+Reading the ACL costs an extra transaction per object so this is off
+by default. Use |--s3-read-acl-sample| to only read the ACLs of some
+of the objects.
+`, "|", "`"),
+			Default:  false,
+			Advanced: true,
+		}, {
+			Name: "read_acl_sample",
+			Help: strings.ReplaceAll(`Maximum number of objects to read the ACL of with --s3-read-acl
+
+Once the ACLs of this many objects have been read, the metadata of
+the rest of the objects won't have |acl-grants|. This limits the cost
+of sampling the permissions of a large bucket.
+
+Set to 0 to read the ACLs of all the objects.
+`, "|", "`"),
+			Default:  0,
+			Advanced: true,
 		}, {
 			Name: "use_presigned_request",
 			Help: `Whether to use a presigned request or PutObject for single part uploads
@@ -2457,6 +2803,9 @@ set. Normally rclone will download these files as compressed objects.
 If this flag is set then rclone will decompress these files with
 "Content-Encoding: gzip" as they are received. This means that rclone
 can't check the size and hash but the file contents will be decompressed.
+
+The "content-encoding" metadata of these files isn't passed on when
+copying them with --metadata as the data is no longer compressed.
 `,
 			Advanced: true,
 			Default:  false,
@@ -2552,6 +2901,49 @@ knows about - please make a bug report if not.
 `,
 			Default:  fs.Tristate{},
 			Advanced: true,
+		}, {
+			Name: "fix_clock_skew",
+			Help: `Set to correct the time requests are signed with if the local clock is wrong.
+
+If the local clock is too far from the server's clock then the server
+rejects requests with a RequestTimeTooSkewed error. When this is set,
+rclone reads the server's time from the Date header of the error
+response, retries the request and signs this and all subsequent
+requests with the corrected time. It logs a NOTICE saying how far out
+the local clock is when it does this.
+
+This only applies to v4 signatures.
+`,
+			Default:  true,
+			Advanced: true,
+		}, {
+			Name: "failover_endpoints",
+			Help: `Comma separated list of endpoints to fail over to if the endpoint fails.
+
+If this is set then the endpoint and these endpoints are used in
+order of preference. If failover_threshold requests in a row to the
+endpoint in use fail with a network error or a server error (5xx)
+then rclone switches to the next one which hasn't failed.
+
+Failed endpoints are probed every failover_probe_interval and rclone
+switches back to them when they respond again.
+
+This is intended for several endpoints serving the same buckets, for
+example the nodes of an S3 compatible cluster, so the endpoints must
+all accept the same credentials. The endpoint must be set to use this.
+`,
+			Default:  fs.CommaSepList{},
+			Advanced: true,
+		}, {
+			Name:     "failover_threshold",
+			Help:     "Number of failed requests in a row before failing over to the next endpoint.",
+			Default:  3,
+			Advanced: true,
+		}, {
+			Name:     "failover_probe_interval",
+			Help:     "How often to probe failed endpoints to see if they have recovered.",
+			Default:  fs.Duration(time.Minute),
+			Advanced: true,
 		},
 		}})
 }
@@ -2565,12 +2957,134 @@ const (
 	maxSizeForCopy      = 4768 * 1024 * 1024
 	maxUploadParts      = 10000 // maximum allowed number of parts in a multi-part upload
 	minChunkSize        = fs.SizeSuffix(1024 * 1024 * 5)
+	maxChunkSize        = fs.SizeSuffix(5 * 1024 * 1024 * 1024)
 	defaultUploadCutoff = fs.SizeSuffix(200 * 1024 * 1024)
 	maxUploadCutoff     = fs.SizeSuffix(5 * 1024 * 1024 * 1024)
 	minSleep            = 10 * time.Millisecond           // In case of error, start at 10ms sleep.
 	maxExpireDuration   = fs.Duration(7 * 24 * time.Hour) // max expiry is 1 week
+	waitVisibleMinSleep = 100 * time.Millisecond          // first sleep waiting for an object to be visible
+	waitVisibleMaxSleep = 5 * time.Second                 // longest sleep waiting for an object to be visible
+)
+
+// completeRetrySleep is the first sleep between attempts to complete
+// a multipart upload
+var completeRetrySleep = time.Second
+
+// dirMarkers is the policy for directory marker objects
+type dirMarkers byte
+
+// dirMarkers policies
+const (
+	dirMarkersNoCreate dirMarkers = iota // don't create markers
+	dirMarkersCreate                     // create markers on Mkdir and remove them on Rmdir
+	dirMarkersPreserve                   // don't create markers but treat existing ones as directories
+)
+
+// Choices returns the valid choices for dirMarkers
+func (dirMarkers) Choices() []string {
+	return []string{
+		dirMarkersNoCreate: "no-create",
+		dirMarkersCreate:   "create",
+		dirMarkersPreserve: "preserve",
+	}
+}
+
+// String renders the dirMarkers as a string
+func (m dirMarkers) String() string {
+	choices := m.Choices()
+	if int(m) >= len(choices) {
+		return fmt.Sprintf("Unknown(%d)", m)
+	}
+	return choices[m]
+}
+
+// Set the dirMarkers from a string
+//
+// true and false are accepted for compatibility with the boolean
+// option this replaced.
+func (m *dirMarkers) Set(s string) error {
+	switch strings.ToLower(s) {
+	case "true":
+		*m = dirMarkersCreate
+		return nil
+	case "false", "":
+		*m = dirMarkersNoCreate
+		return nil
+	}
+	for i, choice := range m.Choices() {
+		if strings.EqualFold(s, choice) {
+			*m = dirMarkers(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid directory markers %q from: %s", s, strings.Join(m.Choices(), ", "))
+}
+
+// Type of the value
+func (m dirMarkers) Type() string {
+	return strings.Join(m.Choices(), "|")
+}
+
+// Scan implements the fmt.Scanner interface
+func (m *dirMarkers) Scan(s fmt.ScanState, ch rune) error {
+	token, err := s.Token(true, nil)
+	if err != nil {
+		return err
+	}
+	return m.Set(string(token))
+}
+
+// create returns true if markers should be made for new directories
+func (m dirMarkers) create() bool {
+	return m == dirMarkersCreate
+}
+
+// exist returns true if markers should be used to decide whether a
+// directory exists and removed with the directory
+func (m dirMarkers) exist() bool {
+	return m == dirMarkersCreate || m == dirMarkersPreserve
+}
+
+// invalidUTF8 is the policy for listing names which aren't valid UTF-8
+type invalidUTF8 = fs.Enum[invalidUTF8Choices]
+
+// invalidUTF8 policies
+const (
+	invalidUTF8Encode  invalidUTF8 = iota // pass the name through the encoding
+	invalidUTF8Skip                       // leave the object out of the listing
+	invalidUTF8Percent                    // percent encode the invalid bytes
 )
 
+type invalidUTF8Choices struct{}
+
+func (invalidUTF8Choices) Choices() []string {
+	return []string{
+		invalidUTF8Encode:  "encode",
+		invalidUTF8Skip:    "skip",
+		invalidUTF8Percent: "percent",
+	}
+}
+
+// percentEncodeInvalidUTF8 replaces each byte of s which isn't part
+// of a valid UTF-8 sequence with %XX
+func percentEncodeInvalidUTF8(s string) string {
+	if utf8.ValidString(s) {
+		return s
+	}
+	var out strings.Builder
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size <= 1 {
+			_, _ = fmt.Fprintf(&out, "%%%02X", s[i])
+			i++
+			continue
+		}
+		out.WriteString(s[i : i+size])
+		i += size
+	}
+	return out.String()
+}
+
 // globals
 var (
 	errNotWithVersionAt = errors.New("can't modify or delete files in --s3-version-at mode")
@@ -2625,6 +3139,12 @@ var systemMetadataInfo = map[string]fs.MetadataHelp{
 		Example:  "2006-01-02T15:04:05.999999999Z07:00",
 		ReadOnly: true,
 	},
+	"acl-grants": {
+		Help:     "Grants of the object ACL as PERMISSION:Type:Grantee, read with --s3-read-acl",
+		Type:     "comma separated list",
+		Example:  "FULL_CONTROL:CanonicalUser:79a59df900b949e5,READ:Group:http://acs.amazonaws.com/groups/global/AllUsers",
+		ReadOnly: true,
+	},
 }
 
 // Options defines the configuration for this backend
@@ -2639,7 +3159,13 @@ type Options struct {
 	UseDualStack          bool                 `config:"use_dual_stack"`
 	LocationConstraint    string               `config:"location_constraint"`
 	ACL                   string               `config:"acl"`
+	ACLRules              fs.CommaSepList      `config:"acl_rules"`
 	BucketACL             string               `config:"bucket_acl"`
+	BucketEncryption      string               `config:"bucket_encryption"`
+	BucketVersioning      bool                 `config:"bucket_versioning"`
+	BucketObjectLock      bool                 `config:"bucket_object_lock"`
+	BucketObjectLockMode  string               `config:"bucket_object_lock_mode"`
+	BucketObjectLockDays  int64                `config:"bucket_object_lock_days"`
 	RequesterPays         bool                 `config:"requester_pays"`
 	ServerSideEncryption  string               `config:"server_side_encryption"`
 	SSEKMSKeyID           string               `config:"sse_kms_key_id"`
@@ -2647,11 +3173,13 @@ type Options struct {
 	SSECustomerKey        string               `config:"sse_customer_key"`
 	SSECustomerKeyBase64  string               `config:"sse_customer_key_base64"`
 	SSECustomerKeyMD5     string               `config:"sse_customer_key_md5"`
+	PreserveEncryption    bool                 `config:"preserve_encryption"`
 	StorageClass          string               `config:"storage_class"`
 	UploadCutoff          fs.SizeSuffix        `config:"upload_cutoff"`
 	CopyCutoff            fs.SizeSuffix        `config:"copy_cutoff"`
 	ChunkSize             fs.SizeSuffix        `config:"chunk_size"`
 	MaxUploadParts        int                  `config:"max_upload_parts"`
+	ChunkSizeAlignment    fs.SizeSuffix        `config:"chunk_size_alignment"`
 	DisableChecksum       bool                 `config:"disable_checksum"`
 	SharedCredentialsFile string               `config:"shared_credentials_file"`
 	Profile               string               `config:"profile"`
@@ -2661,17 +3189,29 @@ type Options struct {
 	V2Auth                bool                 `config:"v2_auth"`
 	UseAccelerateEndpoint bool                 `config:"use_accelerate_endpoint"`
 	LeavePartsOnError     bool                 `config:"leave_parts_on_error"`
+	CompleteRetries       int                  `config:"multipart_complete_retries"`
+	CompleteConcurrency   int                  `config:"multipart_complete_concurrency"`
 	ListChunk             int64                `config:"list_chunk"`
 	ListVersion           int                  `config:"list_version"`
 	ListURLEncode         fs.Tristate          `config:"list_url_encode"`
+	ListRetries           int                  `config:"list_retries"`
+	ListCoalesce          bool                 `config:"list_coalesce"`
+	InvalidUTF8           invalidUTF8          `config:"invalid_utf8"`
+	Inventory             string               `config:"inventory"`
+	InventoryMaxAge       fs.Duration          `config:"inventory_max_age"`
 	NoCheckBucket         bool                 `config:"no_check_bucket"`
+	NoCreateBucket        bool                 `config:"no_create_bucket"`
 	NoHead                bool                 `config:"no_head"`
 	NoHeadObject          bool                 `config:"no_head_object"`
+	WaitVisible           fs.Duration          `config:"wait_visible"`
 	Enc                   encoder.MultiEncoder `config:"encoding"`
 	DisableHTTP2          bool                 `config:"disable_http2"`
 	DownloadURL           string               `config:"download_url"`
-	DirectoryMarkers      bool                 `config:"directory_markers"`
+	DirectoryMarkers      dirMarkers           `config:"directory_markers"`
 	UseMultipartEtag      fs.Tristate          `config:"use_multipart_etag"`
+	UseObjectAttributes   bool                 `config:"use_object_attributes"`
+	ReadACL               bool                 `config:"read_acl"`
+	ReadACLSample         int                  `config:"read_acl_sample"`
 	UsePresignedRequest   bool                 `config:"use_presigned_request"`
 	Versions              bool                 `config:"versions"`
 	VersionAt             fs.Time              `config:"version_at"`
@@ -2682,6 +3222,10 @@ type Options struct {
 	NoSystemMetadata      bool                 `config:"no_system_metadata"`
 	UseAlreadyExists      fs.Tristate          `config:"use_already_exists"`
 	UseMultipartUploads   fs.Tristate          `config:"use_multipart_uploads"`
+	FixClockSkew          bool                 `config:"fix_clock_skew"`
+	FailoverEndpoints     fs.CommaSepList      `config:"failover_endpoints"`
+	FailoverThreshold     int                  `config:"failover_threshold"`
+	FailoverProbeInterval fs.Duration          `config:"failover_probe_interval"`
 }
 
 // Fs represents a remote s3 server
@@ -2704,6 +3248,52 @@ type Fs struct {
 	versioningMu   sync.Mutex
 	versioning     fs.Tristate // if set bucket is using versions
 	warnCompressed sync.Once   // warn once about compressed files
+	aclRules       []aclRule   // parsed acl_rules
+	inventoryMu    sync.Mutex
+	inventory      *inventory // the inventory if read
+	credsMu        sync.Mutex
+	credsRefreshed time.Time             // when the credentials were last refreshed after an auth failure
+	credsChanged   bool                  // set if that refresh changed the credentials
+	skew           *clockSkew            // corrects the signing time for clock skew
+	completeTokens *pacer.TokenDispenser // limits the multipart uploads completing at once - nil for no limit
+	aclReads       atomic.Int64          // number of objects whose ACL has been read - for read_acl_sample
+	regionGroup    singleflight.Group    // shares bucket region lookups in progress
+	listGroup      singleflight.Group    // shares listings in progress if list_coalesce is set
+	invalidUTF8    sync.Map              // "bucket/name" percent encoded by listings to the real key
+
+	failover *endpointFailover // switches endpoints if the endpoint fails - nil if not in use
+}
+
+// aclRule is a parsed rule from acl_rules
+type aclRule struct {
+	glob *regexp.Regexp // matches the keys this applies to
+	acl  string         // canned ACL to use
+}
+
+// parseACLRules parses the acl_rules option
+func parseACLRules(rules fs.CommaSepList) (out []aclRule, err error) {
+	for _, rule := range rules {
+		i := strings.LastIndex(rule, "=")
+		if i <= 0 || i == len(rule)-1 {
+			return nil, fmt.Errorf("acl rule %q must be in the form glob=acl", rule)
+		}
+		glob, err := filter.GlobToRegexp(rule[:i], false)
+		if err != nil {
+			return nil, fmt.Errorf("bad glob in acl rule %q: %w", rule, err)
+		}
+		out = append(out, aclRule{glob: glob, acl: rule[i+1:]})
+	}
+	return out, nil
+}
+
+// aclFor returns the canned ACL to use for the key bucketPath
+func (f *Fs) aclFor(bucketPath string) string {
+	for _, rule := range f.aclRules {
+		if rule.glob.MatchString(bucketPath) {
+			return rule.acl
+		}
+	}
+	return f.opt.ACL
 }
 
 // Object describes a s3 object
@@ -2712,14 +3302,17 @@ type Object struct {
 	//
 	// List will read everything but meta & mimeType - to fill
 	// that in you need to call readMetaData
-	fs           *Fs               // what this object is part of
-	remote       string            // The remote path
-	md5          string            // md5sum of the object
-	bytes        int64             // size of the object
-	lastModified time.Time         // Last modified
-	meta         map[string]string // The object metadata if known - may be nil - with lower case keys
-	mimeType     string            // MimeType of object - may be ""
-	versionID    *string           // If present this points to an object version
+	fs           *Fs                  // what this object is part of
+	remote       string               // The remote path
+	md5          string               // md5sum of the object
+	etag         string               // ETag of the object as read from S3
+	bytes        int64                // size of the object
+	lastModified time.Time            // Last modified
+	meta         map[string]string    // The object metadata if known - may be nil - with lower case keys
+	mimeType     string               // MimeType of object - may be ""
+	versionID    *string              // If present this points to an object version
+	checksums    map[hash.Type]string // checksums read with GetObjectAttributes - nil if not read yet
+	grants       *string              // ACL grants read with GetObjectAcl - nil if not read yet
 
 	// Metadata as pointers to strings as they often won't be present
 	storageClass       *string // e.g. GLACIER
@@ -2727,6 +3320,11 @@ type Object struct {
 	contentDisposition *string // Content-Disposition: header
 	contentEncoding    *string // Content-Encoding: header
 	contentLanguage    *string // Content-Language: header
+
+	// Server-side encryption, only known after a HEAD
+	sse                  *string // X-Amz-Server-Side-Encryption: header
+	sseKMSKeyID          *string // X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id: header
+	sseCustomerAlgorithm *string // X-Amz-Server-Side-Encryption-Customer-Algorithm: header
 }
 
 // ------------------------------------------------------------
@@ -2765,6 +3363,71 @@ var retryErrorCodes = []int{
 	503, // Service Unavailable/Slow Down - "Reduce your request rate"
 }
 
+// authErrorCodes are the error codes which might be caused by
+// credentials expiring or being rotated
+var authErrorCodes = map[string]struct{}{
+	"ExpiredToken":          {},
+	"ExpiredTokenException": {},
+	"InvalidAccessKeyId":    {},
+	"InvalidToken":          {},
+	"TokenRefreshRequired":  {},
+}
+
+// credsRefreshInterval is how long the result of a credentials refresh
+// is used for other requests which fail with auth errors
+const credsRefreshInterval = 10 * time.Second
+
+// isAuthError returns true if the error might be caused by expired or
+// rotated credentials
+func isAuthError(awsError awserr.Error) bool {
+	if _, ok := authErrorCodes[awsError.Code()]; ok {
+		return true
+	}
+	if reqErr, ok := awsError.(awserr.RequestFailure); ok {
+		return reqErr.StatusCode() == http.StatusForbidden
+	}
+	return false
+}
+
+// refreshCredentials is called when a request fails with an auth
+// error. It forces the credentials to be fetched again and returns
+// true if they changed, in which case the request should be retried.
+//
+// This is needed for short lived credentials, like those from the
+// signing helper, which may be rotated before the provider's
+// IsExpired reports them as expired.
+//
+// Requests which were in flight with the old credentials will fail
+// together, so only the first of these refreshes the credentials and
+// the others use its result.
+func (f *Fs) refreshCredentials(ctx context.Context) bool {
+	creds := f.c.Config.Credentials
+	if creds == nil || creds == credentials.AnonymousCredentials {
+		return false
+	}
+	f.credsMu.Lock()
+	defer f.credsMu.Unlock()
+	if time.Since(f.credsRefreshed) < credsRefreshInterval {
+		return f.credsChanged
+	}
+	old, err := creds.GetWithContext(ctx)
+	if err != nil {
+		return false
+	}
+	creds.Expire()
+	fresh, err := creds.GetWithContext(ctx)
+	f.credsRefreshed = time.Now()
+	f.credsChanged = err == nil && (fresh.AccessKeyID != old.AccessKeyID ||
+		fresh.SecretAccessKey != old.SecretAccessKey ||
+		fresh.SessionToken != old.SessionToken)
+	if err != nil {
+		fs.Errorf(f, "Failed to refresh credentials: %v", err)
+	} else if f.credsChanged {
+		fs.Infof(f, "Refreshed credentials from %s after auth failure", fresh.ProviderName)
+	}
+	return f.credsChanged
+}
+
 // S3 is pretty resilient, and the built in retry handling is probably sufficient
 // as it should notice closed connections and timeouts which are the most likely
 // sort of failure modes
@@ -2782,6 +3445,16 @@ func (f *Fs) shouldRetry(ctx context.Context, err error) (bool, error) {
 		if awsError.Code() == "RequestTimeout" {
 			return true, err
 		}
+		// If the clock is skewed the retry is signed with the corrected time
+		if awsError.Code() == errCodeClockSkew && f.opt.FixClockSkew {
+			fs.Debugf(f, "Retrying with corrected clock after: %v", err)
+			return true, err
+		}
+		// If the credentials have been rotated then refresh them and retry
+		if isAuthError(awsError) && f.refreshCredentials(ctx) {
+			fs.Debugf(f, "Retrying with refreshed credentials after: %v", err)
+			return true, err
+		}
 		// Failing that, if it's a RequestFailure it's probably got an http status code we can check
 		if reqErr, ok := err.(awserr.RequestFailure); ok {
 			// 301 if wrong region for bucket - can only update if running from a bucket
@@ -2816,7 +3489,12 @@ func parsePath(path string) (root string) {
 // relative to f.root
 func (f *Fs) split(rootRelativePath string) (bucketName, bucketPath string) {
 	bucketName, bucketPath = bucket.Split(bucket.Join(f.root, rootRelativePath))
-	return f.opt.Enc.FromStandardName(bucketName), f.opt.Enc.FromStandardPath(bucketPath)
+	bucketName = f.opt.Enc.FromStandardName(bucketName)
+	bucketPath = f.opt.Enc.FromStandardPath(bucketPath)
+	if f.opt.InvalidUTF8 == invalidUTF8Percent {
+		bucketPath = f.invalidUTF8Key(bucketName, bucketPath)
+	}
+	return bucketName, bucketPath
 }
 
 // split returns bucket and bucketPath from the object
@@ -2880,7 +3558,13 @@ func (r resolver) EndpointFor(service, region string, opts ...func(*endpoints.Op
 }
 
 // s3Connection makes a connection to s3
-func s3Connection(ctx context.Context, opt *Options, client *http.Client) (*s3.S3, *session.Session, error) {
+//
+// If skew is not nil it is used to correct the time requests are
+// signed with if the server says the local clock is wrong.
+//
+// If failover is not nil it is used to switch endpoints when the
+// endpoint fails.
+func s3Connection(ctx context.Context, opt *Options, client *http.Client, skew *clockSkew, failover *endpointFailover) (*s3.S3, *session.Session, error) {
 	ci := fs.GetConfig(ctx)
 	// Make the auth
 	v := credentials.Value{
@@ -3007,6 +3691,11 @@ func s3Connection(ctx context.Context, opt *Options, client *http.Client) (*s3.S
 		c.Handlers.Sign.Clear()
 		c.Handlers.Sign.PushBackNamed(corehandlers.BuildContentLengthHandler)
 		c.Handlers.Sign.PushBack(signer)
+	} else if skew != nil && opt.FixClockSkew {
+		skew.install(c)
+	}
+	if failover != nil {
+		failover.install(c)
 	}
 	return c, ses, nil
 }
@@ -3344,6 +4033,19 @@ func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, e
 	if opt.BucketACL == "" {
 		opt.BucketACL = opt.ACL
 	}
+	aclRules, err := parseACLRules(opt.ACLRules)
+	if err != nil {
+		return nil, fmt.Errorf("s3: --s3-acl-rules: %w", err)
+	}
+	opt.BucketObjectLockMode = strings.ToUpper(opt.BucketObjectLockMode)
+	switch {
+	case opt.BucketObjectLockMode != "" && opt.BucketObjectLockMode != s3.ObjectLockRetentionModeGovernance && opt.BucketObjectLockMode != s3.ObjectLockRetentionModeCompliance:
+		return nil, fmt.Errorf("s3: bucket_object_lock_mode must be %s or %s", s3.ObjectLockRetentionModeGovernance, s3.ObjectLockRetentionModeCompliance)
+	case (opt.BucketObjectLockMode == "") != (opt.BucketObjectLockDays <= 0):
+		return nil, errors.New("s3: bucket_object_lock_mode and bucket_object_lock_days must be set together")
+	case opt.BucketObjectLockMode != "":
+		opt.BucketObjectLock = true
+	}
 	if opt.SSECustomerKeyBase64 != "" && opt.SSECustomerKey != "" {
 		return nil, errors.New("s3: can't use sse_customer_key and sse_customer_key_base64 at the same time")
 	} else if opt.SSECustomerKeyBase64 != "" {
@@ -3360,7 +4062,12 @@ func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, e
 		opt.SSECustomerKeyMD5 = base64.StdEncoding.EncodeToString(md5sumBinary[:])
 	}
 	srv := getClient(ctx, opt)
-	c, ses, err := s3Connection(ctx, opt, srv)
+	skew := new(clockSkew)
+	failover, err := newEndpointFailover(opt, srv)
+	if err != nil {
+		return nil, fmt.Errorf("s3: %w", err)
+	}
+	c, ses, err := s3Connection(ctx, opt, srv, skew, failover)
 	if err != nil {
 		return nil, err
 	}
@@ -3373,16 +4080,22 @@ func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, e
 	pc.SetRetries(2)
 
 	f := &Fs{
-		name:    name,
-		opt:     *opt,
-		ci:      ci,
-		ctx:     ctx,
-		c:       c,
-		ses:     ses,
-		pacer:   pc,
-		cache:   bucket.NewCache(),
-		srv:     srv,
-		srvRest: rest.NewClient(fshttp.NewClient(ctx)),
+		name:     name,
+		opt:      *opt,
+		ci:       ci,
+		ctx:      ctx,
+		c:        c,
+		ses:      ses,
+		pacer:    pc,
+		cache:    bucket.NewCache(),
+		srv:      srv,
+		srvRest:  rest.NewClient(fshttp.NewClient(ctx)),
+		aclRules: aclRules,
+		skew:     skew,
+		failover: failover,
+	}
+	if opt.CompleteConcurrency > 0 {
+		f.completeTokens = pacer.NewTokenDispenser(opt.CompleteConcurrency)
 	}
 	if opt.ServerSideEncryption == "aws:kms" || opt.SSECustomerAlgorithm != "" {
 		// From: https://docs.aws.amazon.com/AmazonS3/latest/API/RESTCommonResponseHeaders.html
@@ -3406,6 +4119,7 @@ func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, e
 		SetTier:           true,
 		GetTier:           true,
 		SlowModTime:       true,
+		PresignedLinks:    true,
 	}).Fill(ctx, f)
 	if opt.Provider == "Storj" {
 		f.features.SetTier = false
@@ -3414,7 +4128,11 @@ func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, e
 	if opt.Provider == "IDrive" {
 		f.features.SetTier = false
 	}
-	if opt.DirectoryMarkers {
+	if opt.Provider == "GCS" || opt.VersionAt.IsSet() {
+		// GCS doesn't support deleting multiple objects at once
+		f.features.DeleteObjects = nil
+	}
+	if opt.DirectoryMarkers.create() {
 		f.features.CanHaveEmptyDirectories = true
 	}
 	// f.listMultipartUploads()
@@ -3560,7 +4278,17 @@ func (f *Fs) getBucketLocation(ctx context.Context, bucket string) (string, erro
 
 // Updates the region for the bucket by reading the region from the
 // bucket then updating the session.
+//
+// Concurrent calls for the same bucket share one update.
 func (f *Fs) updateRegionForBucket(ctx context.Context, bucket string) error {
+	_, err, _ := f.regionGroup.Do(bucket, func() (interface{}, error) {
+		return nil, f.doUpdateRegionForBucket(ctx, bucket)
+	})
+	return err
+}
+
+// doUpdateRegionForBucket does the work of updateRegionForBucket
+func (f *Fs) doUpdateRegionForBucket(ctx context.Context, bucket string) error {
 	region, err := f.getBucketLocation(ctx, bucket)
 	if err != nil {
 		return fmt.Errorf("reading bucket location failed: %w", err)
@@ -3575,7 +4303,7 @@ func (f *Fs) updateRegionForBucket(ctx context.Context, bucket string) error {
 	// Make a new session with the new region
 	oldRegion := f.opt.Region
 	f.opt.Region = region
-	c, ses, err := s3Connection(f.ctx, &f.opt, f.srv)
+	c, ses, err := s3Connection(f.ctx, &f.opt, f.srv, f.skew, f.failover)
 	if err != nil {
 		return fmt.Errorf("creating new session failed: %w", err)
 	}
@@ -3917,8 +4645,17 @@ func (f *Fs) list(ctx context.Context, opt listOpt, fn listFn) error {
 	if f.opt.RequesterPays {
 		req.RequestPayer = aws.String(s3.RequestPayerRequester)
 	}
-	var listBucket bucketLister
+	listBucket, err := f.newInventoryList(ctx, &req, opt)
+	if err != nil {
+		return err
+	}
 	switch {
+	case listBucket != nil:
+		// listing from the inventory - close the file it is
+		// reading if the listing stops part way
+		defer func() {
+			_ = listBucket.(io.Closer).Close()
+		}()
 	case opt.withVersions || opt.versionAt.IsSet():
 		listBucket = f.newVersionsList(&req, opt.hidden, time.Time(opt.versionAt))
 	case f.opt.ListVersion == 1:
@@ -3927,10 +4664,19 @@ func (f *Fs) list(ctx context.Context, opt listOpt, fn listFn) error {
 		listBucket = f.newV2List(&req)
 	}
 	foundItems := 0
+	skipped := 0
+	pages := 0       // number of pages listed
+	pageRetries := 0 // number of times the current page has been retried
+	defer func() {
+		if skipped > 0 {
+			fs.Logf(f, "Skipped %d entries in %q whose names aren't valid UTF-8", skipped, bucket.Join(opt.bucket, opt.directory))
+		}
+	}()
 	for {
 		var resp *s3.ListObjectsV2Output
 		var err error
 		var versionIDs []*string
+		var retry bool
 		err = f.pacer.Call(func() (bool, error) {
 			listBucket.URLEncodeListings(urlEncodeListings)
 			resp, versionIDs, err = listBucket.List(ctx)
@@ -3946,8 +4692,17 @@ func (f *Fs) list(ctx context.Context, opt listOpt, fn listFn) error {
 					}
 				}
 			}
-			return f.shouldRetry(ctx, err)
+			retry, err = f.shouldRetry(ctx, err)
+			return retry, err
 		})
+		// The listing only moves on to the next page when a page
+		// succeeds so carry on from the failed page rather than
+		// failing the pages listed already.
+		if err != nil && retry && pages > 0 && pageRetries < f.opt.ListRetries {
+			pageRetries++
+			fs.Logf(f, "Retrying page %d of listing %q (%d/%d) after: %v", pages+1, bucket.Join(opt.bucket, opt.directory), pageRetries, f.opt.ListRetries, err)
+			continue
+		}
 		if err != nil {
 			if awsErr, ok := err.(awserr.RequestFailure); ok {
 				if awsErr.StatusCode() == http.StatusNotFound {
@@ -3967,6 +4722,8 @@ func (f *Fs) list(ctx context.Context, opt listOpt, fn listFn) error {
 			}
 			return err
 		}
+		pages++
+		pageRetries = 0
 		if !opt.recurse {
 			foundItems += len(resp.CommonPrefixes)
 			for _, commonPrefix := range resp.CommonPrefixes {
@@ -3982,6 +4739,11 @@ func (f *Fs) list(ctx context.Context, opt listOpt, fn listFn) error {
 						continue
 					}
 				}
+				remote, ok := f.checkUTF8(opt.bucket, remote, "directory")
+				if !ok {
+					skipped++
+					continue
+				}
 				remote = f.opt.Enc.ToStandardPath(remote)
 				if !strings.HasPrefix(remote, opt.prefix) {
 					fs.Logf(f, "Odd name received %q", remote)
@@ -4011,8 +4773,13 @@ func (f *Fs) list(ctx context.Context, opt listOpt, fn listFn) error {
 					continue
 				}
 			}
-			remote = f.opt.Enc.ToStandardPath(remote)
-			if !strings.HasPrefix(remote, opt.prefix) {
+			remote, ok := f.checkUTF8(opt.bucket, remote, "object")
+			if !ok {
+				skipped++
+				continue
+			}
+			remote = f.opt.Enc.ToStandardPath(remote)
+			if !strings.HasPrefix(remote, opt.prefix) {
 				fs.Logf(f, "Odd name received %q", remote)
 				continue
 			}
@@ -4053,7 +4820,7 @@ func (f *Fs) list(ctx context.Context, opt listOpt, fn listFn) error {
 			break
 		}
 	}
-	if f.opt.DirectoryMarkers && foundItems == 0 && opt.directory != "" {
+	if f.opt.DirectoryMarkers.exist() && foundItems == 0 && opt.directory != "" {
 		// Determine whether the directory exists or not by whether it has a marker
 		req := s3.HeadObjectInput{
 			Bucket: &opt.bucket,
@@ -4070,6 +4837,62 @@ func (f *Fs) list(ctx context.Context, opt listOpt, fn listFn) error {
 	return nil
 }
 
+// checkUTF8 applies --s3-invalid-utf8 to name from a listing of
+// bucketName if it isn't valid UTF-8, returning the name to use or
+// false if the entry should be skipped.
+func (f *Fs) checkUTF8(bucketName, name, what string) (string, bool) {
+	if utf8.ValidString(name) {
+		return name, true
+	}
+	switch f.opt.InvalidUTF8 {
+	case invalidUTF8Skip:
+		fs.Logf(f, "Skipping %s with invalid UTF-8 name %q", what, name)
+		return "", false
+	case invalidUTF8Percent:
+		encoded := percentEncodeInvalidUTF8(name)
+		f.rememberInvalidUTF8(bucketName, encoded, name)
+		return encoded, true
+	}
+	return name, true
+}
+
+// rememberInvalidUTF8 remembers that key in bucketName was listed as
+// encoded, along with the directories it is in, so that split reads
+// them from the real key.
+func (f *Fs) rememberInvalidUTF8(bucketName, encoded, key string) {
+	encodedParts := strings.Split(strings.TrimSuffix(encoded, "/"), "/")
+	keyParts := strings.Split(strings.TrimSuffix(key, "/"), "/")
+	for i := range keyParts {
+		if encodedParts[i] != keyParts[i] {
+			encodedDir := strings.Join(encodedParts[:i+1], "/")
+			f.invalidUTF8.Store(bucketName+"/"+encodedDir, strings.Join(keyParts[:i+1], "/"))
+		}
+	}
+}
+
+// invalidUTF8Key returns the key to use for bucketPath in bucketName
+//
+// If bucketPath, or a directory it is in, was percent encoded by a
+// listing then the encoded part is replaced with the real key.
+// Other names are returned unchanged, so names with %XX in which
+// weren't listed, for example when writing files, are used as is.
+func (f *Fs) invalidUTF8Key(bucketName, bucketPath string) string {
+	if !strings.Contains(bucketPath, "%") {
+		return bucketPath
+	}
+	dir := bucketPath
+	for {
+		if key, ok := f.invalidUTF8.Load(bucketName + "/" + dir); ok {
+			return key.(string) + bucketPath[len(dir):]
+		}
+		i := strings.LastIndexByte(dir, '/')
+		if i < 0 {
+			return bucketPath
+		}
+		dir = dir[:i]
+	}
+}
+
 // Convert a list item into a DirEntry
 func (f *Fs) itemToDirEntry(ctx context.Context, remote string, object *s3.Object, versionID *string, isDirectory bool) (fs.DirEntry, error) {
 	if isDirectory {
@@ -4146,6 +4969,69 @@ func (f *Fs) listBuckets(ctx context.Context) (entries fs.DirEntries, err error)
 // This should return ErrDirNotFound if the directory isn't
 // found.
 func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	if !f.opt.ListCoalesce {
+		return f.listEntries(ctx, dir)
+	}
+	v, err, shared := f.listGroup.Do(dir, func() (interface{}, error) {
+		entries, err := f.listEntries(ctx, dir)
+		if err != nil && ctx.Err() != nil {
+			err = sharedCtxError{err: err}
+		}
+		return entries, err
+	})
+	var ctxErr sharedCtxError
+	if errors.As(err, &ctxErr) {
+		if shared && ctx.Err() == nil {
+			// The listing we shared failed because its caller's
+			// context was done but ours isn't, so list the
+			// directory ourselves
+			return f.listEntries(ctx, dir)
+		}
+		return nil, ctxErr.err
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries = v.(fs.DirEntries)
+	if shared {
+		// Each caller gets its own copy of the entries as
+		// callers may sort them or change the objects
+		entries = cloneEntries(ctx, entries)
+	}
+	return entries, nil
+}
+
+// sharedCtxError wraps the error of work shared with a
+// singleflight.Group, such as a listing, made when the context of the
+// caller doing it was done
+type sharedCtxError struct {
+	err error
+}
+
+// Error satisfies the error interface
+func (e sharedCtxError) Error() string {
+	return e.err.Error()
+}
+
+// cloneEntries returns a copy of entries with copies of the objects
+// and directories in it
+func cloneEntries(ctx context.Context, entries fs.DirEntries) fs.DirEntries {
+	newEntries := make(fs.DirEntries, len(entries))
+	for i, entry := range entries {
+		switch x := entry.(type) {
+		case *Object:
+			newEntries[i] = x.clone()
+		case fs.Directory:
+			newEntries[i] = fs.NewDirCopy(ctx, x)
+		default:
+			newEntries[i] = entry
+		}
+	}
+	return newEntries
+}
+
+// listEntries lists the objects and directories in dir - see List
+func (f *Fs) listEntries(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
 	bucket, directory := f.split(dir)
 	if bucket == "" {
 		if directory != "" {
@@ -4261,7 +5147,7 @@ func (f *Fs) bucketExists(ctx context.Context, bucket string) (bool, error) {
 
 // Create directory marker file and parents
 func (f *Fs) createDirectoryMarker(ctx context.Context, bucket, dir string) error {
-	if !f.opt.DirectoryMarkers || bucket == "" {
+	if !f.opt.DirectoryMarkers.create() || bucket == "" {
 		return nil
 	}
 
@@ -4331,6 +5217,19 @@ func (f *Fs) makeBucket(ctx context.Context, bucket string) error {
 		return nil
 	}
 	return f.cache.Create(bucket, func() error {
+		configure := f.opt.BucketEncryption != "" || f.opt.BucketVersioning || f.opt.BucketObjectLock
+		if f.opt.NoCreateBucket || configure {
+			// Check first as some providers return success when
+			// creating a bucket which exists and the settings for
+			// new buckets must only be applied to new buckets
+			found, err := f.bucketExists(ctx, bucket)
+			if err != nil || found {
+				return err
+			}
+			if f.opt.NoCreateBucket {
+				return fserrors.NoRetryError(fmt.Errorf("bucket %q doesn't exist and --s3-no-create-bucket is set", bucket))
+			}
+		}
 		req := s3.CreateBucketInput{
 			Bucket: &bucket,
 			ACL:    stringPointerOrNil(f.opt.BucketACL),
@@ -4340,12 +5239,19 @@ func (f *Fs) makeBucket(ctx context.Context, bucket string) error {
 				LocationConstraint: &f.opt.LocationConstraint,
 			}
 		}
+		if f.opt.BucketObjectLock {
+			req.ObjectLockEnabledForBucket = aws.Bool(true)
+		}
 		err := f.pacer.Call(func() (bool, error) {
 			_, err := f.c.CreateBucketWithContext(ctx, &req)
 			return f.shouldRetry(ctx, err)
 		})
 		if err == nil {
 			fs.Infof(f, "Bucket %q created with ACL %q", bucket, f.opt.BucketACL)
+			err = f.configureBucket(ctx, bucket)
+			if err != nil {
+				err = f.removeUnconfiguredBucket(ctx, bucket, err)
+			}
 		}
 		if awsErr, ok := err.(awserr.Error); ok {
 			switch awsErr.Code() {
@@ -4367,13 +5273,101 @@ func (f *Fs) makeBucket(ctx context.Context, bucket string) error {
 	})
 }
 
+// removeUnconfiguredBucket removes bucket which has just been created
+// but which configureBucket failed with configErr, returning the error
+// to return.
+//
+// Otherwise the bucket would be found on the next attempt and used
+// without its settings. If it can't be removed the error is fatal.
+func (f *Fs) removeUnconfiguredBucket(ctx context.Context, bucket string, configErr error) error {
+	req := s3.DeleteBucketInput{
+		Bucket: &bucket,
+	}
+	err := f.pacer.Call(func() (bool, error) {
+		_, err := f.c.DeleteBucketWithContext(ctx, &req)
+		return f.shouldRetry(ctx, err)
+	})
+	if err != nil {
+		fs.Errorf(f, "Failed to remove bucket %q which couldn't be configured - remove it before trying again: %v", bucket, err)
+		return fserrors.FatalError(configErr)
+	}
+	fs.Infof(f, "Bucket %q deleted as it couldn't be configured", bucket)
+	return configErr
+}
+
+// configureBucket applies the encryption, versioning and object lock
+// settings for new buckets to a bucket which has just been created
+func (f *Fs) configureBucket(ctx context.Context, bucket string) error {
+	if f.opt.BucketEncryption != "" {
+		sse := &s3.ServerSideEncryptionByDefault{
+			SSEAlgorithm: &f.opt.BucketEncryption,
+		}
+		if f.opt.BucketEncryption == s3.ServerSideEncryptionAwsKms && f.opt.SSEKMSKeyID != "" {
+			sse.KMSMasterKeyID = &f.opt.SSEKMSKeyID
+		}
+		req := s3.PutBucketEncryptionInput{
+			Bucket: &bucket,
+			ServerSideEncryptionConfiguration: &s3.ServerSideEncryptionConfiguration{
+				Rules: []*s3.ServerSideEncryptionRule{{
+					ApplyServerSideEncryptionByDefault: sse,
+				}},
+			},
+		}
+		err := f.pacer.Call(func() (bool, error) {
+			_, err := f.c.PutBucketEncryptionWithContext(ctx, &req)
+			return f.shouldRetry(ctx, err)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to set encryption of new bucket %q: %w", bucket, err)
+		}
+	}
+	// Object lock enables versioning itself
+	if f.opt.BucketVersioning && !f.opt.BucketObjectLock {
+		req := s3.PutBucketVersioningInput{
+			Bucket: &bucket,
+			VersioningConfiguration: &s3.VersioningConfiguration{
+				Status: aws.String(s3.BucketVersioningStatusEnabled),
+			},
+		}
+		err := f.pacer.Call(func() (bool, error) {
+			_, err := f.c.PutBucketVersioningWithContext(ctx, &req)
+			return f.shouldRetry(ctx, err)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to enable versioning of new bucket %q: %w", bucket, err)
+		}
+	}
+	if f.opt.BucketObjectLockMode != "" {
+		req := s3.PutObjectLockConfigurationInput{
+			Bucket: &bucket,
+			ObjectLockConfiguration: &s3.ObjectLockConfiguration{
+				ObjectLockEnabled: aws.String(s3.ObjectLockEnabledEnabled),
+				Rule: &s3.ObjectLockRule{
+					DefaultRetention: &s3.DefaultRetention{
+						Mode: &f.opt.BucketObjectLockMode,
+						Days: &f.opt.BucketObjectLockDays,
+					},
+				},
+			},
+		}
+		err := f.pacer.Call(func() (bool, error) {
+			_, err := f.c.PutObjectLockConfigurationWithContext(ctx, &req)
+			return f.shouldRetry(ctx, err)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to set object lock retention of new bucket %q: %w", bucket, err)
+		}
+	}
+	return nil
+}
+
 // Rmdir deletes the bucket if the fs is at the root
 //
 // Returns an error if it isn't empty
 func (f *Fs) Rmdir(ctx context.Context, dir string) error {
 	bucket, directory := f.split(dir)
 	// Remove directory marker file
-	if f.opt.DirectoryMarkers && bucket != "" && dir != "" {
+	if f.opt.DirectoryMarkers.exist() && bucket != "" && dir != "" {
 		o := &Object{
 			fs:     f,
 			remote: dir + "/",
@@ -4417,9 +5411,11 @@ func pathEscape(s string) string {
 //
 // It adds the boiler plate to the req passed in and calls the s3
 // method
-func (f *Fs) copy(ctx context.Context, req *s3.CopyObjectInput, dstBucket, dstPath, srcBucket, srcPath string, src *Object) error {
+// copy does a server-side copy returning the ETag of the new object
+// if known
+func (f *Fs) copy(ctx context.Context, req *s3.CopyObjectInput, dstBucket, dstPath, srcBucket, srcPath string, src *Object) (etag string, err error) {
 	req.Bucket = &dstBucket
-	req.ACL = stringPointerOrNil(f.opt.ACL)
+	req.ACL = stringPointerOrNil(f.aclFor(dstPath))
 	req.Key = &dstPath
 	source := pathEscape(bucket.Join(srcBucket, srcPath))
 	if src.versionID != nil {
@@ -4447,6 +5443,7 @@ func (f *Fs) copy(ctx context.Context, req *s3.CopyObjectInput, dstBucket, dstPa
 	if f.opt.SSEKMSKeyID != "" {
 		req.SSEKMSKeyId = &f.opt.SSEKMSKeyID
 	}
+	f.preserveEncryption(ctx, src, &req.ServerSideEncryption, &req.SSEKMSKeyId)
 	if req.StorageClass == nil && f.opt.StorageClass != "" {
 		req.StorageClass = &f.opt.StorageClass
 	}
@@ -4454,10 +5451,72 @@ func (f *Fs) copy(ctx context.Context, req *s3.CopyObjectInput, dstBucket, dstPa
 	if src.bytes >= int64(f.opt.CopyCutoff) {
 		return f.copyMultipart(ctx, req, dstBucket, dstPath, srcBucket, srcPath, src)
 	}
-	return f.pacer.Call(func() (bool, error) {
-		_, err := f.c.CopyObjectWithContext(ctx, req)
+	var resp *s3.CopyObjectOutput
+	err = f.pacer.Call(func() (bool, error) {
+		resp, err = f.c.CopyObjectWithContext(ctx, req)
 		return f.shouldRetry(ctx, err)
 	})
+	if err != nil {
+		return "", err
+	}
+	if resp.CopyObjectResult != nil {
+		etag = aws.StringValue(resp.CopyObjectResult.ETag)
+	}
+	return etag, nil
+}
+
+// kmsKeyRegion returns the region of a KMS key ARN such as
+// arn:aws:kms:us-east-1:111122223333:key/xxx or "" if unknown
+func kmsKeyRegion(keyID string) string {
+	parts := strings.SplitN(keyID, ":", 6)
+	if len(parts) < 6 || parts[0] != "arn" || parts[2] != "kms" {
+		return ""
+	}
+	return parts[3]
+}
+
+// preserveEncryption sets sse and kmsKeyID to the server-side
+// encryption of src if --s3-preserve-encryption is set and src is an
+// S3 object, reading it with a HEAD request if necessary.
+//
+// If the encryption can't be used on f a warning is logged and sse
+// and kmsKeyID are left as they are.
+func (f *Fs) preserveEncryption(ctx context.Context, src fs.ObjectInfo, sse, kmsKeyID **string) {
+	if !f.opt.PreserveEncryption {
+		return
+	}
+	srcObj, ok := fs.UnWrapObjectInfo(src).(*Object)
+	if u, isWrapper := src.(fs.ObjectUnWrapper); !ok && isWrapper {
+		// src may be an ObjectInfo wrapping an Object, e.g. to rename it
+		srcObj, ok = fs.UnWrapObject(u.UnWrap()).(*Object)
+	}
+	if !ok {
+		return
+	}
+	err := srcObj.readMetaData(ctx)
+	if err != nil {
+		fs.Logf(src, "Can't preserve encryption: failed to read metadata: %v", err)
+		return
+	}
+	if aws.StringValue(srcObj.sseCustomerAlgorithm) != "" {
+		fs.Logf(src, "Can't preserve SSE-C encryption as the key isn't known - using the destination's encryption settings")
+		return
+	}
+	srcSSE := aws.StringValue(srcObj.sse)
+	if srcSSE == "" {
+		return
+	}
+	if f.opt.SSECustomerAlgorithm != "" {
+		fs.Logf(src, "Can't preserve %s encryption as the destination uses SSE-C", srcSSE)
+		return
+	}
+	srcKeyID := aws.StringValue(srcObj.sseKMSKeyID)
+	if region := kmsKeyRegion(srcKeyID); region != "" && f.opt.Region != "" && region != f.opt.Region {
+		fs.Logf(src, "Can't preserve encryption with KMS key %q from region %q in region %q - using the destination's encryption settings", srcKeyID, region, f.opt.Region)
+		return
+	}
+	*sse = &srcSSE
+	*kmsKeyID = stringPointerOrNil(srcKeyID)
 }
 
 func calculateRange(partSize, partIndex, numParts, totalSize int64) string {
@@ -4473,10 +5532,10 @@ func calculateRange(partSize, partIndex, numParts, totalSize int64) string {
 	return fmt.Sprintf("bytes=%v-%v", start, ends)
 }
 
-func (f *Fs) copyMultipart(ctx context.Context, copyReq *s3.CopyObjectInput, dstBucket, dstPath, srcBucket, srcPath string, src *Object) (err error) {
+func (f *Fs) copyMultipart(ctx context.Context, copyReq *s3.CopyObjectInput, dstBucket, dstPath, srcBucket, srcPath string, src *Object) (etag string, err error) {
 	info, err := src.headObject(ctx)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	req := &s3.CreateMultipartUploadInput{}
@@ -4504,7 +5563,7 @@ func (f *Fs) copyMultipart(ctx context.Context, copyReq *s3.CopyObjectInput, dst
 		cout, err = f.c.CreateMultipartUploadWithContext(ctx, req)
 		return f.shouldRetry(ctx, err)
 	}); err != nil {
-		return err
+		return "", err
 	}
 	uid := cout.UploadId
 
@@ -4567,11 +5626,12 @@ func (f *Fs) copyMultipart(ctx context.Context, copyReq *s3.CopyObjectInput, dst
 
 	err = g.Wait()
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	return f.pacer.Call(func() (bool, error) {
-		_, err := f.c.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+	var resp *s3.CompleteMultipartUploadOutput
+	err = f.pacer.Call(func() (bool, error) {
+		resp, err = f.c.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
 			Bucket: &dstBucket,
 			Key:    &dstPath,
 			MultipartUpload: &s3.CompletedMultipartUpload{
@@ -4582,6 +5642,10 @@ func (f *Fs) copyMultipart(ctx context.Context, copyReq *s3.CopyObjectInput, dst
 		})
 		return f.shouldRetry(ctx, err)
 	})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(resp.ETag), nil
 }
 
 // Copy src to this remote using server-side copy operations.
@@ -4623,15 +5687,27 @@ func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object,
 		req.MetadataDirective = aws.String(s3.MetadataDirectiveReplace)
 	}
 
-	err = f.copy(ctx, &req, dstBucket, dstPath, srcBucket, srcPath, srcObj)
+	etag, err := f.copy(ctx, &req, dstBucket, dstPath, srcBucket, srcPath, srcObj)
 	if err != nil {
 		return nil, err
 	}
+	if f.opt.WaitVisible > 0 {
+		o := &Object{fs: f, remote: remote}
+		head, err := o.waitVisible(ctx, etag)
+		if err != nil {
+			return nil, err
+		}
+		o.setMetaData(head)
+		return o, nil
+	}
 	return f.NewObject(ctx, remote)
 }
 
 // Hashes returns the supported hash sets.
 func (f *Fs) Hashes() hash.Set {
+	if f.opt.UseObjectAttributes {
+		return attributeHashes | hash.Set(hash.MD5)
+	}
 	return hash.Set(hash.MD5)
 }
 
@@ -4740,6 +5816,166 @@ It returns a list of status dictionaries.
 	Opts: map[string]string{
 		"all": "if set then show all objects, not just ones with restore status",
 	},
+}, {
+	Name:  "rewrite",
+	Short: "Rewrite the metadata of objects in place without re-uploading them",
+	Long: `This command copies each object onto itself server-side to rewrite
+its metadata without downloading or uploading the data. This is much
+cheaper than re-uploading the objects.
+
+The objects are rewritten with the current encryption, ACL and storage
+class settings of the backend, so this can be used to apply changes to
+--s3-server-side-encryption, --s3-sse-kms-key-id, --s3-acl or
+--s3-storage-class to existing objects.
+
+The existing metadata of each object is kept. Any options passed with
+-o are set as metadata on the objects, as are any from --metadata-set.
+These can be system metadata such as content-type or cache-control or
+user metadata. Use -o tier=CLASS to set the storage class.
+
+Usage Examples:
+
+    rclone backend rewrite s3:bucket/path/to/object
+    rclone backend rewrite s3:bucket/path/to/directory -o tier=STANDARD_IA
+    rclone backend rewrite --s3-server-side-encryption aws:kms s3:bucket
+    rclone backend rewrite s3:bucket -o cache-control="max-age=3600" -o owner=me
+
+This command obeys the filters. Test first with --interactive/-i or --dry-run flags
+
+    rclone --interactive backend rewrite --include "*.txt" s3:bucket/path -o content-type=text/plain
+
+Objects in the GLACIER and DEEP_ARCHIVE storage classes can't be
+rewritten and are reported with an error status.
+
+Note that copying an object onto itself will create a new version if
+versioning is enabled on the bucket.
+
+It returns a list of status dictionaries with Remote and Status
+keys. The Status will be OK if it was successful or an error message
+if not.
+
+    [
+        {
+            "Status": "OK",
+            "Remote": "test.txt"
+        },
+        {
+            "Status": "OK",
+            "Remote": "test/file4.txt"
+        }
+    ]
+
+`,
+	Opts: map[string]string{
+		"tier": "Storage class to rewrite the objects with",
+	},
+}, {
+	Name:  "legal-hold",
+	Short: "Read or set the object lock legal hold of objects",
+	Long: `This command reads the object lock legal hold status of each object,
+or sets it with -o status=ON or clears it with -o status=OFF.
+
+Legal holds stop objects being deleted or overwritten until they are
+cleared, whatever their retention period. They can only be used in
+buckets with object lock enabled, see --s3-bucket-object-lock. Using
+this on a bucket without object lock enabled is an error.
+
+Usage Examples:
+
+    rclone backend legal-hold s3:bucket/path/to/dir
+    rclone backend legal-hold s3:bucket/path/to/dir -o status=ON
+    rclone backend legal-hold s3:bucket/path/to/object -o status=OFF
+
+The objects are processed --checkers at a time, use -o concurrency=N
+to change this.
+
+This command obeys the filters. Test first with --interactive/-i or --dry-run flags
+
+    rclone --dry-run backend legal-hold --include "*.eml" s3:bucket/mail -o status=ON
+
+With --s3-versions or --s3-version-at the legal hold of the versions
+listed is read or set rather than the current versions.
+
+It returns a list of status dictionaries with Remote, Status and
+LegalHold keys. The Status will be OK if it was successful or an
+error message if not. LegalHold is ON or OFF.
+
+    [
+        {
+            "Status": "OK",
+            "Remote": "mail/1.eml",
+            "LegalHold": "ON"
+        },
+        {
+            "Status": "OK",
+            "Remote": "mail/2.eml",
+            "LegalHold": "ON"
+        }
+    ]
+
+`,
+	Opts: map[string]string{
+		"status":      "ON to set the legal hold or OFF to clear it - if not set the legal hold is read",
+		"concurrency": "Number of objects to process at once (default --checkers)",
+	},
+}, {
+	Name:  "add-checksum",
+	Short: "Make S3 store a checksum for objects which don't have one",
+	Long: `This command makes S3 calculate and store a checksum for each object
+which doesn't have one already, by copying the object onto itself
+server-side with a checksum algorithm set. The data isn't downloaded or
+uploaded by rclone.
+
+This is useful for objects uploaded by tools which didn't send a
+checksum, or migrated from elsewhere, so that the checksums can be
+read with --s3-use-object-attributes and used by sync --checksum and
+rclone check.
+
+The algorithm is set with -o algorithm=NAME and can be sha256 (the
+default), sha1 or crc32.
+
+Usage Examples:
+
+    rclone backend add-checksum s3:bucket/path/to/object
+    rclone backend add-checksum s3:bucket/path/to/directory -o algorithm=sha1
+
+This command obeys the filters. Test first with --interactive/-i or --dry-run flags
+
+    rclone --interactive backend add-checksum --include "*.txt" s3:bucket/path
+
+The existing metadata, storage class and encryption of each object are
+kept as with the rewrite command.
+
+Objects of --s3-copy-cutoff or larger are copied with a multipart copy
+which only stores a checksum of the checksums of the parts, so they are
+reported with an error status. Raise --s3-copy-cutoff (up to 5 GiB) to
+include them.
+
+Note that copying an object onto itself will create a new version if
+versioning is enabled on the bucket.
+
+It returns a list of status dictionaries with Remote, Status and
+Checksum keys. The Status will be OK if a checksum was added, Exists if
+the object had one already, or an error message if not. The Checksum
+is the hex checksum of the object if known.
+
+    [
+        {
+            "Status": "OK",
+            "Remote": "test.txt",
+            "Checksum": "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+        },
+        {
+            "Status": "Exists",
+            "Remote": "test/file4.txt",
+            "Checksum": "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+        }
+    ]
+
+`,
+	Opts: map[string]string{
+		"algorithm": "Checksum algorithm to add: sha256 (default), sha1 or crc32",
+	},
 }, {
 	Name:  "list-multipart-uploads",
 	Short: "List the unfinished multipart uploads",
@@ -4788,6 +6024,15 @@ it would do.
     rclone backend cleanup -o max-age=7w s3:bucket/path/to/object
 
 Durations are parsed as per the rest of rclone, 2h, 7d, 7w etc.
+
+It returns the number of uploads removed and the total size of their
+parts which is the storage reclaimed. With --dry-run these are the
+uploads which would have been removed.
+
+    {
+        "uploads": 2,
+        "size": 104857600
+    }
 `,
 	Opts: map[string]string{
 		"max-age": "Max age of upload to delete",
@@ -4817,6 +6062,50 @@ supplied.
 It may return "Enabled", "Suspended" or "Unversioned". Note that once versioning
 has been enabled the status can't be set back to "Unversioned".
 `,
+}, {
+	Name:  "replicate-versions",
+	Short: "Copy the version history of objects to another bucket.",
+	Long: `This command copies all the versions and delete markers of the
+objects in the remote to another s3 remote, so that the version
+history of the destination mirrors the source. It can be used to keep
+a backup of a versioned bucket including its history.
+
+    rclone backend replicate-versions s3:bucket/path s3-backup:backup-bucket/path
+
+The destination bucket must have versioning enabled.
+
+The versions of each object are copied oldest first with server-side
+copies keeping their metadata, so the most recent version ends up as
+the current version. Delete markers are recreated by deleting the
+object in the destination. The versions in the destination will have
+new version IDs and last modified times but rclone's modification time
+is kept in the metadata.
+
+It can be run again to copy new versions. If the history of an object
+in the destination is the same as the start of the history in the
+source (checking the sizes of the versions and the positions of the
+delete markers) only the new versions are copied. Otherwise that
+object is reported as an error and not changed, as versions can't be
+inserted into the middle of a history.
+
+As the copies are server-side the destination remote must be able to
+read the source bucket.
+
+Note that you can use --interactive/-i or --dry-run with this command to see what
+it would do.
+
+It returns the number of objects examined, the number of versions and
+delete markers replicated, the number already replicated and the
+number of objects which couldn't be replicated.
+
+    {
+        "keys": 2,
+        "versions": 3,
+        "deleteMarkers": 1,
+        "skipped": 0,
+        "errors": 0
+    }
+`,
 }, {
 	Name:  "set",
 	Short: "Set command for updating the config parameters.",
@@ -4919,6 +6208,12 @@ func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[str
 	case "restore-status":
 		_, all := opt["all"]
 		return f.restoreStatus(ctx, all)
+	case "rewrite":
+		return f.rewrite(ctx, opt)
+	case "legal-hold":
+		return f.legalHold(ctx, opt)
+	case "add-checksum":
+		return f.addChecksum(ctx, opt["algorithm"])
 	case "list-multipart-uploads":
 		return f.listMultipartUploadsAll(ctx)
 	case "cleanup":
@@ -4929,18 +6224,23 @@ func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[str
 				return nil, fmt.Errorf("bad max-age: %w", err)
 			}
 		}
-		return nil, f.cleanUp(ctx, maxAge)
+		return f.cleanUp(ctx, maxAge)
 	case "cleanup-hidden":
 		return nil, f.CleanUpHidden(ctx)
 	case "versioning":
 		return f.setGetVersioning(ctx, arg...)
+	case "replicate-versions":
+		if len(arg) != 1 {
+			return nil, errors.New("need exactly 1 argument - the destination remote")
+		}
+		return f.replicateVersions(ctx, arg[0])
 	case "set":
 		newOpt := f.opt
 		err := configstruct.Set(configmap.Simple(opt), &newOpt)
 		if err != nil {
 			return nil, fmt.Errorf("reading config: %w", err)
 		}
-		c, ses, err := s3Connection(f.ctx, &newOpt, f.srv)
+		c, ses, err := s3Connection(f.ctx, &newOpt, f.srv, f.skew, f.failover)
 		if err != nil {
 			return nil, fmt.Errorf("updating session: %w", err)
 		}
@@ -5006,6 +6306,202 @@ func (f *Fs) restoreStatus(ctx context.Context, all bool) (out []restoreStatusOu
 	return out, nil
 }
 
+// Returned from "rewrite"
+type rewriteStatusOut struct {
+	Status string
+	Remote string
+}
+
+// rewrite copies the objects onto themselves to rewrite their
+// metadata, setting any metadata in opt
+func (f *Fs) rewrite(ctx context.Context, opt map[string]string) (out []rewriteStatusOut, err error) {
+	meta := make(fs.Metadata, len(opt))
+	for k, v := range opt {
+		meta[strings.ToLower(k)] = v
+	}
+	var outMu sync.Mutex
+	out = []rewriteStatusOut{}
+	err = operations.ListFn(ctx, f, func(obj fs.Object) {
+		// Remember this is run --checkers times concurrently
+		o, ok := obj.(*Object)
+		st := rewriteStatusOut{Status: "OK", Remote: obj.Remote()}
+		defer func() {
+			outMu.Lock()
+			out = append(out, st)
+			outMu.Unlock()
+		}()
+		if operations.SkipDestructive(ctx, obj, "rewrite") {
+			return
+		}
+		if !ok {
+			st.Status = "Not an S3 object"
+			return
+		}
+		err := o.rewrite(ctx, meta, "")
+		if err != nil {
+			st.Status = err.Error()
+		}
+	})
+	if err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+// rewrite copies the object onto itself replacing its metadata with
+// the existing metadata updated with meta.
+//
+// The copy applies the encryption, ACL and storage class settings of
+// the backend. If checksumAlgorithm is set S3 is asked to store a
+// checksum of the object made with it.
+func (o *Object) rewrite(ctx context.Context, meta fs.Metadata, checksumAlgorithm string) error {
+	err := o.readMetaData(ctx)
+	if err != nil {
+		return err
+	}
+	if o.storageClass != nil && (*o.storageClass == "GLACIER" || *o.storageClass == "DEEP_ARCHIVE") {
+		return fmt.Errorf("can't rewrite object in %s storage class", *o.storageClass)
+	}
+
+	// Read the existing metadata as with --metadata and merge meta into it
+	ctx, ci := fs.AddConfig(ctx)
+	ci.Metadata = true
+	options := append(fs.MetadataAsOpenOptions(ctx), fs.MetadataOption(meta))
+	ui, err := o.prepareUpload(ctx, o, options, true)
+	if err != nil {
+		return fmt.Errorf("failed to prepare rewrite: %w", err)
+	}
+	req := s3.CopyObjectInput{
+		MetadataDirective: aws.String(s3.MetadataDirectiveReplace),
+	}
+	setFrom_s3CopyObjectInput_s3PutObjectInput(&req, ui.req)
+
+	// btime is only stored as user metadata if it was set explicitly
+	if _, found := o.meta["btime"]; !found && meta["btime"] == "" {
+		delete(req.Metadata, "btime")
+	}
+	// Keep the hash as the data isn't changing
+	if md5sumBase64, found := o.meta[metaMD5Hash]; found {
+		req.Metadata[metaMD5Hash] = &md5sumBase64
+	}
+	// Keep the storage class unless it is being changed
+	if tier := meta["tier"]; tier != "" {
+		req.StorageClass = aws.String(strings.ToUpper(tier))
+	} else if req.StorageClass == nil && o.storageClass != nil {
+		req.StorageClass = o.storageClass
+	}
+	if checksumAlgorithm != "" {
+		req.ChecksumAlgorithm = &checksumAlgorithm
+	}
+
+	bucket, bucketPath := o.split()
+	_, err = o.fs.copy(ctx, &req, bucket, bucketPath, bucket, bucketPath, o)
+	if err != nil {
+		return err
+	}
+	// Read the metadata again next time it is needed
+	o.meta = nil
+	o.checksums = nil
+	o.grants = nil
+	return nil
+}
+
+// checksumAlgorithms maps the hashes which can be read with
+// GetObjectAttributes to the algorithm to ask S3 to store them with
+var checksumAlgorithms = map[hash.Type]string{
+	hash.SHA1:   s3.ChecksumAlgorithmSha1,
+	hash.SHA256: s3.ChecksumAlgorithmSha256,
+	hash.CRC32:  s3.ChecksumAlgorithmCrc32,
+}
+
+// Returned from "add-checksum"
+type addChecksumStatusOut struct {
+	Status   string
+	Remote   string
+	Checksum string
+}
+
+// addChecksum rewrites the objects which don't have a checksum of
+// the type named by algorithm so S3 stores one
+func (f *Fs) addChecksum(ctx context.Context, algorithm string) (out []addChecksumStatusOut, err error) {
+	ht := hash.SHA256
+	if algorithm != "" {
+		err = ht.Set(algorithm)
+		if err != nil {
+			return nil, err
+		}
+	}
+	checksumAlgorithm, ok := checksumAlgorithms[ht]
+	if !ok {
+		return nil, fmt.Errorf("can't add %v checksums - use sha256, sha1 or crc32", ht)
+	}
+	var outMu sync.Mutex
+	out = []addChecksumStatusOut{}
+	err = operations.ListFn(ctx, f, func(obj fs.Object) {
+		// Remember this is run --checkers times concurrently
+		o, ok := obj.(*Object)
+		st := addChecksumStatusOut{Status: "OK", Remote: obj.Remote()}
+		defer func() {
+			outMu.Lock()
+			out = append(out, st)
+			outMu.Unlock()
+		}()
+		if !ok {
+			st.Status = "Not an S3 object"
+			return
+		}
+		checksum, err := o.addChecksum(ctx, ht, checksumAlgorithm)
+		st.Checksum = checksum
+		if err == errChecksumExists {
+			st.Status = "Exists"
+		} else if err != nil {
+			st.Status = err.Error()
+		}
+	})
+	if err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+// errChecksumExists is returned from addChecksum if the object has a
+// checksum already
+var errChecksumExists = errors.New("object has a checksum already")
+
+// addChecksum makes S3 store a checksum of type ht for the object if
+// it hasn't got one by rewriting it with checksumAlgorithm, returning
+// the checksum.
+func (o *Object) addChecksum(ctx context.Context, ht hash.Type, checksumAlgorithm string) (checksum string, err error) {
+	if o.checksums == nil {
+		err = o.readChecksums(ctx)
+		if err != nil {
+			return "", err
+		}
+	}
+	if checksum = o.checksums[ht]; checksum != "" {
+		return checksum, errChecksumExists
+	}
+	if o.bytes >= int64(o.fs.opt.CopyCutoff) {
+		return "", fmt.Errorf("can't add a checksum to an object of --s3-copy-cutoff %v or larger", o.fs.opt.CopyCutoff)
+	}
+	if operations.SkipDestructive(ctx, o, "add checksum") {
+		return "", nil
+	}
+	err = o.rewrite(ctx, nil, checksumAlgorithm)
+	if err != nil {
+		return "", err
+	}
+	err = o.readChecksums(ctx)
+	if err != nil {
+		return "", err
+	}
+	checksum = o.checksums[ht]
+	if checksum == "" {
+		return "", fmt.Errorf("no %v checksum was stored - the provider may not support checksums", ht)
+	}
+	return checksum, nil
+}
+
 // listMultipartUploads lists all outstanding multipart uploads for (bucket, key)
 //
 // Note that rather lazily we treat key as a prefix so it matches
@@ -5070,16 +6566,61 @@ func (f *Fs) listMultipartUploadsAll(ctx context.Context) (uploadsMap map[string
 	return uploadsMap, err
 }
 
+// multipartUploadSize returns the total size of the parts uploaded
+// so far to a pending multipart upload
+func (f *Fs) multipartUploadSize(ctx context.Context, bucket string, upload *s3.MultipartUpload) (size int64, err error) {
+	var partNumberMarker *int64
+	for {
+		req := s3.ListPartsInput{
+			Bucket:           &bucket,
+			Key:              upload.Key,
+			UploadId:         upload.UploadId,
+			PartNumberMarker: partNumberMarker,
+		}
+		var resp *s3.ListPartsOutput
+		err = f.pacer.Call(func() (bool, error) {
+			resp, err = f.c.ListPartsWithContext(ctx, &req)
+			return f.shouldRetry(ctx, err)
+		})
+		if err != nil {
+			return size, fmt.Errorf("list parts of multipart upload bucket %q key %q: %w", bucket, *upload.Key, err)
+		}
+		for _, part := range resp.Parts {
+			size += aws.Int64Value(part.Size)
+		}
+		if !aws.BoolValue(resp.IsTruncated) {
+			break
+		}
+		partNumberMarker = resp.NextPartNumberMarker
+	}
+	return size, nil
+}
+
+// cleanUpResult reports what cleanUp removed
+type cleanUpResult struct {
+	Uploads int64 `json:"uploads"` // number of pending multipart uploads removed
+	Size    int64 `json:"size"`    // size of the parts of the removed uploads
+}
+
 // cleanUpBucket removes all pending multipart uploads for a given bucket over the age of maxAge
-func (f *Fs) cleanUpBucket(ctx context.Context, bucket string, maxAge time.Duration, uploads []*s3.MultipartUpload) (err error) {
+//
+// The uploads removed, or which would have been removed with
+// --dry-run, are added to result.
+func (f *Fs) cleanUpBucket(ctx context.Context, bucket string, maxAge time.Duration, uploads []*s3.MultipartUpload, result *cleanUpResult) (err error) {
 	fs.Infof(f, "cleaning bucket %q of pending multipart uploads older than %v", bucket, maxAge)
 	for _, upload := range uploads {
 		if upload.Initiated != nil && upload.Key != nil && upload.UploadId != nil {
 			age := time.Since(*upload.Initiated)
 			what := fmt.Sprintf("pending multipart upload for bucket %q key %q dated %v (%v ago)", bucket, *upload.Key, upload.Initiated, age)
 			if age > maxAge {
-				fs.Infof(f, "removing %s", what)
+				size, sizeErr := f.multipartUploadSize(ctx, bucket, upload)
+				if sizeErr != nil {
+					fs.Errorf(f, "%v", sizeErr)
+				}
+				fs.Infof(f, "removing %s size %v", what, fs.SizeSuffix(size))
 				if operations.SkipDestructive(ctx, what, "remove pending upload") {
+					result.Uploads++
+					result.Size += size
 					continue
 				}
 				req := s3.AbortMultipartUploadInput{
@@ -5091,6 +6632,9 @@ func (f *Fs) cleanUpBucket(ctx context.Context, bucket string, maxAge time.Durat
 				if abortErr != nil {
 					err = fmt.Errorf("failed to remove %s: %w", what, abortErr)
 					fs.Errorf(f, "%v", err)
+				} else {
+					result.Uploads++
+					result.Size += size
 				}
 			} else {
 				fs.Debugf(f, "ignoring %s", what)
@@ -5101,19 +6645,22 @@ func (f *Fs) cleanUpBucket(ctx context.Context, bucket string, maxAge time.Durat
 }
 
 // CleanUp removes all pending multipart uploads
-func (f *Fs) cleanUp(ctx context.Context, maxAge time.Duration) (err error) {
+//
+// It returns the number and size of the uploads removed.
+func (f *Fs) cleanUp(ctx context.Context, maxAge time.Duration) (result cleanUpResult, err error) {
 	uploadsMap, err := f.listMultipartUploadsAll(ctx)
 	if err != nil {
-		return err
+		return result, err
 	}
 	for bucket, uploads := range uploadsMap {
-		cleanErr := f.cleanUpBucket(ctx, bucket, maxAge, uploads)
-		if err != nil {
+		cleanErr := f.cleanUpBucket(ctx, bucket, maxAge, uploads, &result)
+		if cleanErr != nil {
 			fs.Errorf(f, "Failed to cleanup bucket %q: %v", bucket, cleanErr)
 			err = cleanErr
 		}
 	}
-	return err
+	fs.Infof(f, "Removed %d pending multipart uploads freeing %v", result.Uploads, fs.SizeSuffix(result.Size))
+	return result, err
 }
 
 // Read whether the bucket is versioned or not
@@ -5182,7 +6729,8 @@ func (f *Fs) setGetVersioning(ctx context.Context, arg ...string) (status string
 
 // CleanUp removes all pending multipart uploads older than 24 hours
 func (f *Fs) CleanUp(ctx context.Context) (err error) {
-	return f.cleanUp(ctx, 24*time.Hour)
+	_, err = f.cleanUp(ctx, 24*time.Hour)
+	return err
 }
 
 // purge deletes all the files and directories
@@ -5281,6 +6829,98 @@ func (f *Fs) Purge(ctx context.Context, dir string) error {
 	return f.purge(ctx, dir, false)
 }
 
+// maxDeleteObjects is the maximum number of keys DeleteObjects will
+// accept in one call
+const maxDeleteObjects = 1000
+
+// DeleteObjects deletes the objects passed in using as few calls to
+// DeleteObjects as possible.
+//
+// It returns an error for each object which is nil if the object was
+// deleted.
+func (f *Fs) DeleteObjects(ctx context.Context, objs []fs.Object) []error {
+	errs := make([]error, len(objs))
+	// Group the objects by bucket remembering their index in objs
+	byBucket := map[string][]int{}
+	var buckets []string
+	for i, obj := range objs {
+		o, ok := obj.(*Object)
+		if !ok {
+			errs[i] = fmt.Errorf("can't delete %T with DeleteObjects", obj)
+			continue
+		}
+		bucket, _ := o.split()
+		if _, found := byBucket[bucket]; !found {
+			buckets = append(buckets, bucket)
+		}
+		byBucket[bucket] = append(byBucket[bucket], i)
+	}
+	for _, bucket := range buckets {
+		indexes := byBucket[bucket]
+		for len(indexes) > 0 {
+			n := len(indexes)
+			if n > maxDeleteObjects {
+				n = maxDeleteObjects
+			}
+			f.deleteObjectsChunk(ctx, bucket, objs, indexes[:n], errs)
+			indexes = indexes[n:]
+		}
+	}
+	return errs
+}
+
+// deleteObjectsChunk deletes the objs at indexes, which are all in
+// bucket, with a single DeleteObjects call setting errs for each one.
+func (f *Fs) deleteObjectsChunk(ctx context.Context, bucket string, objs []fs.Object, indexes []int, errs []error) {
+	type objectKey struct {
+		key       string
+		versionID string
+	}
+	byKey := make(map[objectKey]int, len(indexes))
+	identifiers := make([]*s3.ObjectIdentifier, 0, len(indexes))
+	for _, i := range indexes {
+		o := objs[i].(*Object)
+		_, bucketPath := o.split()
+		identifiers = append(identifiers, &s3.ObjectIdentifier{
+			Key:       aws.String(bucketPath),
+			VersionId: o.versionID,
+		})
+		byKey[objectKey{key: bucketPath, versionID: aws.StringValue(o.versionID)}] = i
+	}
+	req := s3.DeleteObjectsInput{
+		Bucket: &bucket,
+		Delete: &s3.Delete{
+			Objects: identifiers,
+			Quiet:   aws.Bool(true),
+		},
+	}
+	if f.opt.RequesterPays {
+		req.RequestPayer = aws.String(s3.RequestPayerRequester)
+	}
+	var resp *s3.DeleteObjectsOutput
+	err := f.pacer.Call(func() (bool, error) {
+		var err error
+		resp, err = f.c.DeleteObjectsWithContext(ctx, &req)
+		return f.shouldRetry(ctx, err)
+	})
+	if err != nil {
+		for _, i := range indexes {
+			errs[i] = err
+		}
+		return
+	}
+	// In quiet mode only the keys which failed are returned
+	for _, deleteError := range resp.Errors {
+		key := objectKey{key: aws.StringValue(deleteError.Key), versionID: aws.StringValue(deleteError.VersionId)}
+		i, ok := byKey[key]
+		if !ok {
+			fs.Errorf(f, "DeleteObjects returned error for unknown key %q: %s", key.key, aws.StringValue(deleteError.Message))
+			continue
+		}
+		errs[i] = fmt.Errorf("%s: %s", aws.StringValue(deleteError.Code), aws.StringValue(deleteError.Message))
+	}
+}
+
 // CleanUpHidden deletes all the hidden files.
 func (f *Fs) CleanUpHidden(ctx context.Context) error {
 	return f.purge(ctx, "", true)
@@ -5288,6 +6928,24 @@ func (f *Fs) CleanUpHidden(ctx context.Context) error {
 
 // ------------------------------------------------------------
 
+// clone returns a copy of o which can be changed without changing o
+func (o *Object) clone() *Object {
+	newO := *o
+	if o.meta != nil {
+		newO.meta = make(map[string]string, len(o.meta))
+		for k, v := range o.meta {
+			newO.meta[k] = v
+		}
+	}
+	if o.checksums != nil {
+		newO.checksums = make(map[hash.Type]string, len(o.checksums))
+		for k, v := range o.checksums {
+			newO.checksums[k] = v
+		}
+	}
+	return &newO
+}
+
 // Fs returns the parent Fs
 func (o *Object) Fs() fs.Info {
 	return o.fs
@@ -5310,6 +6968,7 @@ var matchMd5 = regexp.MustCompile(`^[0-9a-f]{32}$`)
 
 // Set the MD5 from the etag
 func (o *Object) setMD5FromEtag(etag string) {
+	o.etag = etag
 	if o.fs.etagIsNotMD5 {
 		o.md5 = ""
 		return
@@ -5328,14 +6987,26 @@ func (o *Object) setMD5FromEtag(etag string) {
 }
 
 // Hash returns the Md5sum of an object returning a lowercase hex string
+//
+// If --s3-use-object-attributes is set it can also return the SHA-256,
+// SHA-1 and CRC-32 checksums stored by S3.
 func (o *Object) Hash(ctx context.Context, t hash.Type) (string, error) {
-	if t != hash.MD5 {
+	if t != hash.MD5 && !(o.fs.opt.UseObjectAttributes && attributeHashes.Contains(t)) {
 		return "", hash.ErrUnsupported
 	}
 	// If decompressing, erase the hash
 	if o.bytes < 0 {
 		return "", nil
 	}
+	if t != hash.MD5 {
+		if o.checksums == nil {
+			err := o.readChecksums(ctx)
+			if err != nil {
+				return "", err
+			}
+		}
+		return o.checksums[t], nil
+	}
 	// If we haven't got an MD5, then check the metadata
 	if o.md5 == "" {
 		err := o.readMetaData(ctx)
@@ -5346,6 +7017,80 @@ func (o *Object) Hash(ctx context.Context, t hash.Type) (string, error) {
 	return o.md5, nil
 }
 
+// attributeHashes are the hashes which can be read with
+// GetObjectAttributes in addition to MD5
+var attributeHashes = hash.NewHashSet(hash.SHA1, hash.SHA256, hash.CRC32)
+
+// readChecksums reads the checksums S3 stores for the object with
+// GetObjectAttributes and stores them in o.checksums.
+//
+// Only full object checksums are stored. Multipart uploads only have
+// a checksum of the checksums of the parts which can't be compared
+// with a hash of the whole object.
+func (o *Object) readChecksums(ctx context.Context) (err error) {
+	bucket, bucketPath := o.split()
+	req := s3.GetObjectAttributesInput{
+		Bucket:    &bucket,
+		Key:       &bucketPath,
+		VersionId: o.versionID,
+		ObjectAttributes: []*string{
+			aws.String(s3.ObjectAttributesChecksum),
+			aws.String(s3.ObjectAttributesObjectParts),
+		},
+	}
+	if o.fs.opt.RequesterPays {
+		req.RequestPayer = aws.String(s3.RequestPayerRequester)
+	}
+	if o.fs.opt.SSECustomerAlgorithm != "" {
+		req.SSECustomerAlgorithm = &o.fs.opt.SSECustomerAlgorithm
+	}
+	if o.fs.opt.SSECustomerKey != "" {
+		req.SSECustomerKey = &o.fs.opt.SSECustomerKey
+	}
+	if o.fs.opt.SSECustomerKeyMD5 != "" {
+		req.SSECustomerKeyMD5 = &o.fs.opt.SSECustomerKeyMD5
+	}
+	var resp *s3.GetObjectAttributesOutput
+	err = o.fs.pacer.Call(func() (bool, error) {
+		var err error
+		resp, err = o.fs.c.GetObjectAttributesWithContext(ctx, &req)
+		return o.fs.shouldRetry(ctx, err)
+	})
+	if err != nil {
+		if awsErr, ok := err.(awserr.RequestFailure); ok {
+			if awsErr.StatusCode() == http.StatusNotFound {
+				return fs.ErrorObjectNotFound
+			}
+		}
+		return fmt.Errorf("failed to read checksums: %w", err)
+	}
+	o.checksums = map[hash.Type]string{}
+	if resp.Checksum == nil {
+		return nil
+	}
+	if resp.ObjectParts != nil && aws.Int64Value(resp.ObjectParts.TotalPartsCount) > 0 {
+		fs.Debugf(o, "Ignoring checksums of multipart upload")
+		return nil
+	}
+	for t, checksum := range map[hash.Type]*string{
+		hash.SHA1:   resp.Checksum.ChecksumSHA1,
+		hash.SHA256: resp.Checksum.ChecksumSHA256,
+		hash.CRC32:  resp.Checksum.ChecksumCRC32,
+	} {
+		checksumBase64 := aws.StringValue(checksum)
+		if checksumBase64 == "" || strings.Contains(checksumBase64, "-") {
+			continue
+		}
+		checksumBytes, err := base64.StdEncoding.DecodeString(checksumBase64)
+		if err != nil || len(checksumBytes) != hash.Width(t, false)/2 {
+			fs.Debugf(o, "Failed to read %v checksum %q", t, checksumBase64)
+			continue
+		}
+		o.checksums[t] = hex.EncodeToString(checksumBytes)
+	}
+	return nil
+}
+
 // Size returns the size of an object in bytes
 func (o *Object) Size() int64 {
 	return o.bytes
@@ -5361,6 +7106,42 @@ func (o *Object) headObject(ctx context.Context) (resp *s3.HeadObjectOutput, err
 	return o.fs.headObject(ctx, &req)
 }
 
+// waitVisible HEADs the object until it is visible, backing off
+// between attempts, for providers which are eventually consistent.
+//
+// If etag is set the object isn't visible until the HEAD returns it
+// so the old version of an overwritten object isn't used.
+func (o *Object) waitVisible(ctx context.Context, etag string) (head *s3.HeadObjectOutput, err error) {
+	timeout := time.Duration(o.fs.opt.WaitVisible)
+	deadline := time.Now().Add(timeout)
+	etag = strings.Trim(etag, `"`)
+	sleep := waitVisibleMinSleep
+	for {
+		head, err = o.headObject(ctx)
+		if err == nil {
+			if etag == "" || strings.Trim(aws.StringValue(head.ETag), `"`) == etag {
+				return head, nil
+			}
+			err = fmt.Errorf("old version has ETag %s not %s", aws.StringValue(head.ETag), etag)
+		} else if err != fs.ErrorObjectNotFound {
+			return nil, err
+		}
+		if time.Now().Add(sleep).After(deadline) {
+			return nil, fmt.Errorf("object not visible after --s3-wait-visible %v: %w", o.fs.opt.WaitVisible, err)
+		}
+		fs.Debugf(o, "Waiting %v for object to become visible: %v", sleep, err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(sleep):
+		}
+		sleep *= 2
+		if sleep > waitVisibleMaxSleep {
+			sleep = waitVisibleMaxSleep
+		}
+	}
+}
+
 func (f *Fs) headObject(ctx context.Context, req *s3.HeadObjectInput) (resp *s3.HeadObjectOutput, err error) {
 	if f.opt.RequesterPays {
 		req.RequestPayer = aws.String(s3.RequestPayerRequester)
@@ -5471,14 +7252,23 @@ func (o *Object) setMetaData(resp *s3.HeadObjectOutput) {
 	o.contentDisposition = resp.ContentDisposition
 	o.contentEncoding = resp.ContentEncoding
 	o.contentLanguage = resp.ContentLanguage
+	o.sse = resp.ServerSideEncryption
+	o.sseKMSKeyID = resp.SSEKMSKeyId
+	o.sseCustomerAlgorithm = resp.SSECustomerAlgorithm
 
 	// If decompressing then size and md5sum are unknown
-	if o.fs.opt.Decompress && aws.StringValue(o.contentEncoding) == "gzip" {
+	if o.decompressed() {
 		o.bytes = -1
 		o.md5 = ""
 	}
 }
 
+// decompressed returns true if the object is gzip encoded and will be
+// decompressed when read because --s3-decompress is set
+func (o *Object) decompressed() bool {
+	return o.fs.opt.Decompress && aws.StringValue(o.contentEncoding) == "gzip"
+}
+
 // ModTime returns the modification time of the object
 //
 // It attempts to read the objects mtime and if that isn't present the
@@ -5529,7 +7319,8 @@ func (o *Object) SetModTime(ctx context.Context, modTime time.Time) error {
 	if o.fs.opt.RequesterPays {
 		req.RequestPayer = aws.String(s3.RequestPayerRequester)
 	}
-	return o.fs.copy(ctx, &req, bucket, bucketPath, bucket, bucketPath, o)
+	_, err = o.fs.copy(ctx, &req, bucket, bucketPath, bucket, bucketPath, o)
+	return err
 }
 
 // Storable raturns a boolean indicating if this object is storable
@@ -5749,12 +7540,14 @@ func (f *Fs) OpenChunkWriter(ctx context.Context, remote string, src fs.ObjectIn
 	// buffers here (default 5 MiB). With a maximum number of parts (10,000) this will be a file of
 	// 48 GiB which seems like a not too unreasonable limit.
 	if size == -1 {
+		chunkSize = chunksize.Align(src, chunkSize, f.opt.ChunkSizeAlignment, maxChunkSize)
 		warnStreamUpload.Do(func() {
 			fs.Logf(f, "Streaming uploads using chunk size %v will have maximum file size of %v",
-				f.opt.ChunkSize, fs.SizeSuffix(int64(chunkSize)*int64(uploadParts)))
+				chunkSize, fs.SizeSuffix(int64(chunkSize)*int64(uploadParts)))
 		})
 	} else {
 		chunkSize = chunksize.Calculator(src, size, uploadParts, chunkSize)
+		chunkSize = chunksize.Align(src, chunkSize, f.opt.ChunkSizeAlignment, maxChunkSize)
 	}
 
 	var mOut *s3.CreateMultipartUploadOutput
@@ -5912,20 +7705,48 @@ func (w *s3ChunkWriter) Close(ctx context.Context) (err error) {
 		return *w.completedParts[i].PartNumber < *w.completedParts[j].PartNumber
 	})
 	var resp *s3.CompleteMultipartUploadOutput
-	err = w.f.pacer.Call(func() (bool, error) {
-		resp, err = w.f.c.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
-			Bucket: w.bucket,
-			Key:    w.key,
-			MultipartUpload: &s3.CompletedMultipartUpload{
-				Parts: w.completedParts,
-			},
-			RequestPayer: w.multiPartUploadInput.RequestPayer,
-			UploadId:     w.uploadID,
+	sleep := completeRetrySleep
+	for try := 1; ; try++ {
+		if w.f.completeTokens != nil {
+			w.f.completeTokens.Get()
+		}
+		err = w.f.pacer.Call(func() (bool, error) {
+			resp, err = w.f.c.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+				Bucket: w.bucket,
+				Key:    w.key,
+				MultipartUpload: &s3.CompletedMultipartUpload{
+					Parts: w.completedParts,
+				},
+				RequestPayer: w.multiPartUploadInput.RequestPayer,
+				UploadId:     w.uploadID,
+			})
+			return w.f.shouldRetry(ctx, err)
 		})
-		return w.f.shouldRetry(ctx, err)
-	})
-	if err != nil {
-		return fmt.Errorf("failed to complete multipart upload %q: %w", *w.uploadID, err)
+		if w.f.completeTokens != nil {
+			w.f.completeTokens.Put()
+		}
+		if err == nil {
+			break
+		}
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && awsErr.Code() == s3.ErrCodeNoSuchUpload {
+			if head := w.completedObject(ctx); head != nil {
+				fs.Debugf(w.o, "multipart upload %q was completed by an earlier attempt", *w.uploadID)
+				resp = &s3.CompleteMultipartUploadOutput{ETag: head.ETag, VersionId: head.VersionId}
+				err = nil
+				break
+			}
+		}
+		if !fserrors.IsRetryError(err) || try > w.f.opt.CompleteRetries {
+			return fmt.Errorf("failed to complete multipart upload %q: %w", *w.uploadID, err)
+		}
+		fs.Logf(w.o, "Failed to complete multipart upload %q - retrying in %v (%d/%d): %v", *w.uploadID, sleep, try, w.f.opt.CompleteRetries, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(sleep):
+		}
+		sleep *= 2
 	}
 	if resp != nil {
 		if resp.ETag != nil {
@@ -5939,6 +7760,34 @@ func (w *s3ChunkWriter) Close(ctx context.Context) (err error) {
 	return err
 }
 
+// wantETag returns the ETag the object should have once the upload
+// is complete if the ETag is the MD5 of the MD5s of the parts
+func (w *s3ChunkWriter) wantETag() string {
+	w.md5sMu.Lock()
+	defer w.md5sMu.Unlock()
+	hashOfHashes := md5.Sum(w.md5s)
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(hashOfHashes[:]), len(w.completedParts))
+}
+
+// completedObject returns the object if it was created by completing
+// this upload, or nil if it wasn't or this can't be told.
+//
+// This is used to check whether an attempt to complete the upload
+// succeeded even though its response was lost.
+func (w *s3ChunkWriter) completedObject(ctx context.Context) *s3.HeadObjectOutput {
+	if w.f.etagIsNotMD5 {
+		return nil
+	}
+	head, err := w.o.headObject(ctx)
+	if err != nil {
+		return nil
+	}
+	if strings.Trim(aws.StringValue(head.ETag), `"`) != w.wantETag() {
+		return nil
+	}
+	return head
+}
+
 func (o *Object) uploadMultipart(ctx context.Context, src fs.ObjectInfo, in io.Reader, options ...fs.OpenOption) (wantETag, gotETag string, versionID *string, ui uploadInfo, err error) {
 	chunkWriter, err := multipart.UploadMultipart(ctx, src, in, multipart.UploadMultipartOptions{
 		Open:        o.fs,
@@ -5952,8 +7801,7 @@ func (o *Object) uploadMultipart(ctx context.Context, src fs.ObjectInfo, in io.R
 	gotETag = s3cw.eTag
 	versionID = aws.String(s3cw.versionID)
 
-	hashOfHashes := md5.Sum(s3cw.md5s)
-	wantETag = fmt.Sprintf("%s-%d", hex.EncodeToString(hashOfHashes[:]), len(s3cw.completedParts))
+	wantETag = s3cw.wantETag()
 
 	return wantETag, gotETag, versionID, s3cw.ui, nil
 }
@@ -6107,7 +7955,7 @@ func (o *Object) prepareUpload(ctx context.Context, src fs.ObjectInfo, options [
 
 	ui.req = &s3.PutObjectInput{
 		Bucket: &bucket,
-		ACL:    stringPointerOrNil(o.fs.opt.ACL),
+		ACL:    stringPointerOrNil(o.fs.aclFor(bucketPath)),
 		Key:    &bucketPath,
 	}
 
@@ -6138,7 +7986,7 @@ func (o *Object) prepareUpload(ctx context.Context, src fs.ObjectInfo, options [
 			ui.req.ContentType = pv
 		case "x-amz-tagging":
 			ui.req.Tagging = pv
-		case "tier":
+		case "tier", "acl-grants":
 			// ignore
 		case "mtime":
 			// mtime in meta overrides source ModTime
@@ -6213,6 +8061,7 @@ func (o *Object) prepareUpload(ctx context.Context, src fs.ObjectInfo, options [
 	if o.fs.opt.SSEKMSKeyID != "" {
 		ui.req.SSEKMSKeyId = &o.fs.opt.SSEKMSKeyID
 	}
+	o.fs.preserveEncryption(ctx, src, &ui.req.ServerSideEncryption, &ui.req.SSEKMSKeyId)
 	if o.fs.opt.StorageClass != "" {
 		ui.req.StorageClass = &o.fs.opt.StorageClass
 	}
@@ -6305,7 +8154,13 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 	// so make up the object as best we can assuming it got
 	// uploaded properly. If size < 0 then we need to do the HEAD.
 	var head *s3.HeadObjectOutput
-	if o.fs.opt.NoHead && size >= 0 {
+	if o.fs.opt.WaitVisible > 0 {
+		o.meta = nil // wipe old metadata
+		head, err = o.waitVisible(ctx, gotETag)
+		if err != nil {
+			return err
+		}
+	} else if o.fs.opt.NoHead && size >= 0 {
 		head = new(s3.HeadObjectOutput)
 		//structs.SetFrom(head, &req)
 		setFrom_s3HeadObjectOutput_s3PutObjectInput(head, ui.req)
@@ -6328,6 +8183,7 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 			return err
 		}
 	}
+	o.checksums = nil // the checksums need reading again
 	o.setMetaData(head)
 
 	// Check multipart upload ETag if required
@@ -6343,6 +8199,22 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 
 // Remove an object
 func (o *Object) Remove(ctx context.Context) error {
+	return o.remove(ctx, "")
+}
+
+// RemoveIfUnchanged removes the object only if its ETag is the one it
+// was read with, returning fs.ErrorObjectChanged if not.
+//
+// Object versions can't change so are removed unconditionally.
+func (o *Object) RemoveIfUnchanged(ctx context.Context) error {
+	if o.etag == "" || o.versionID != nil {
+		return o.remove(ctx, "")
+	}
+	return o.remove(ctx, o.etag)
+}
+
+// remove the object, only if it has ETag ifMatch if set
+func (o *Object) remove(ctx context.Context, ifMatch string) error {
 	if o.fs.opt.VersionAt.IsSet() {
 		return errNotWithVersionAt
 	}
@@ -6356,9 +8228,25 @@ func (o *Object) Remove(ctx context.Context) error {
 		req.RequestPayer = aws.String(s3.RequestPayerRequester)
 	}
 	err := o.fs.pacer.Call(func() (bool, error) {
-		_, err := o.fs.c.DeleteObjectWithContext(ctx, &req)
+		httpReq, _ := o.fs.c.DeleteObjectRequest(&req)
+		httpReq.HTTPRequest = httpReq.HTTPRequest.WithContext(ctx)
+		if ifMatch != "" {
+			httpReq.HTTPRequest.Header.Set("If-Match", ifMatch)
+		}
+		err := httpReq.Send()
 		return o.fs.shouldRetry(ctx, err)
 	})
+	if ifMatch != "" {
+		if reqErr, ok := err.(awserr.RequestFailure); ok {
+			switch reqErr.StatusCode() {
+			case http.StatusPreconditionFailed:
+				return fs.ErrorObjectChanged
+			case http.StatusNotFound:
+				// Already deleted
+				return nil
+			}
+		}
+	}
 	return err
 }
 
@@ -6381,7 +8269,7 @@ func (o *Object) SetTier(tier string) (err error) {
 		MetadataDirective: aws.String(s3.MetadataDirectiveCopy),
 		StorageClass:      aws.String(tier),
 	}
-	err = o.fs.copy(ctx, &req, bucket, bucketPath, bucket, bucketPath, o)
+	_, err = o.fs.copy(ctx, &req, bucket, bucketPath, bucket, bucketPath, o)
 	if err != nil {
 		return err
 	}
@@ -6438,26 +8326,92 @@ func (o *Object) Metadata(ctx context.Context) (metadata fs.Metadata, err error)
 	}
 	setMetadata("cache-control", o.cacheControl)
 	setMetadata("content-disposition", o.contentDisposition)
-	setMetadata("content-encoding", o.contentEncoding)
+	// The data read is no longer encoded if it is decompressed
+	if !o.decompressed() {
+		setMetadata("content-encoding", o.contentEncoding)
+	}
 	setMetadata("content-language", o.contentLanguage)
 	metadata["tier"] = o.GetTier()
 
+	if o.fs.opt.ReadACL && !o.fs.opt.NoSystemMetadata {
+		if o.grants == nil {
+			err = o.readACL(ctx)
+			if err != nil {
+				return nil, err
+			}
+		}
+		setMetadata("acl-grants", o.grants)
+	}
+
 	return metadata, nil
 }
 
+// readACL reads the grants of the object ACL with GetObjectAcl and
+// stores them in o.grants.
+//
+// If --s3-read-acl-sample ACLs have been read already then o.grants
+// is set to empty without reading it.
+func (o *Object) readACL(ctx context.Context) (err error) {
+	if sample := o.fs.opt.ReadACLSample; sample > 0 && o.fs.aclReads.Add(1) > int64(sample) {
+		o.grants = aws.String("")
+		return nil
+	}
+	bucket, bucketPath := o.split()
+	req := s3.GetObjectAclInput{
+		Bucket:    &bucket,
+		Key:       &bucketPath,
+		VersionId: o.versionID,
+	}
+	if o.fs.opt.RequesterPays {
+		req.RequestPayer = aws.String(s3.RequestPayerRequester)
+	}
+	var resp *s3.GetObjectAclOutput
+	err = o.fs.pacer.Call(func() (bool, error) {
+		var err error
+		resp, err = o.fs.c.GetObjectAclWithContext(ctx, &req)
+		return o.fs.shouldRetry(ctx, err)
+	})
+	if err != nil {
+		if awsErr, ok := err.(awserr.RequestFailure); ok {
+			if awsErr.StatusCode() == http.StatusNotFound {
+				return fs.ErrorObjectNotFound
+			}
+		}
+		return fmt.Errorf("failed to read ACL: %w", err)
+	}
+	grants := make([]string, 0, len(resp.Grants))
+	for _, grant := range resp.Grants {
+		if grant.Grantee == nil {
+			continue
+		}
+		grantee := aws.StringValue(grant.Grantee.ID)
+		if grantee == "" {
+			grantee = aws.StringValue(grant.Grantee.URI)
+		}
+		if grantee == "" {
+			grantee = aws.StringValue(grant.Grantee.EmailAddress)
+		}
+		grants = append(grants, aws.StringValue(grant.Permission)+":"+aws.StringValue(grant.Grantee.Type)+":"+grantee)
+	}
+	o.grants = aws.String(strings.Join(grants, ","))
+	return nil
+}
+
 // Check the interfaces are satisfied
 var (
-	_ fs.Fs              = &Fs{}
-	_ fs.Purger          = &Fs{}
-	_ fs.Copier          = &Fs{}
-	_ fs.PutStreamer     = &Fs{}
-	_ fs.ListRer         = &Fs{}
-	_ fs.Commander       = &Fs{}
-	_ fs.CleanUpper      = &Fs{}
-	_ fs.OpenChunkWriter = &Fs{}
-	_ fs.Object          = &Object{}
-	_ fs.MimeTyper       = &Object{}
-	_ fs.GetTierer       = &Object{}
-	_ fs.SetTierer       = &Object{}
-	_ fs.Metadataer      = &Object{}
+	_ fs.Fs                 = &Fs{}
+	_ fs.Purger             = &Fs{}
+	_ fs.DeleteObjectser    = &Fs{}
+	_ fs.Copier             = &Fs{}
+	_ fs.PutStreamer        = &Fs{}
+	_ fs.ListRer            = &Fs{}
+	_ fs.Commander          = &Fs{}
+	_ fs.CleanUpper         = &Fs{}
+	_ fs.OpenChunkWriter    = &Fs{}
+	_ fs.Object             = &Object{}
+	_ fs.MimeTyper          = &Object{}
+	_ fs.GetTierer          = &Object{}
+	_ fs.SetTierer          = &Object{}
+	_ fs.Metadataer         = &Object{}
+	_ fs.ConditionalRemover = &Object{}
 )
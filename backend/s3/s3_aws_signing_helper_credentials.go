@@ -4,17 +4,19 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/credentials/endpointcreds"
-	"github.com/aws/aws-sdk-go/aws/request"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
 	"strconv"
 	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/endpointcreds"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"golang.org/x/sync/singleflight"
 )
 
 const (
@@ -84,6 +86,7 @@ type awsSigningHelperProvider struct {
 	ttl              time.Duration
 	httpClient       *http.Client
 	awsCredsProvider *endpointcreds.Provider
+	retrieveGroup    singleflight.Group // shares retrievals in progress
 }
 
 func (p *awsSigningHelperProvider) IsExpired() bool {
@@ -94,7 +97,32 @@ func (p *awsSigningHelperProvider) Retrieve() (credentials.Value, error) {
 	return p.RetrieveWithContext(aws.BackgroundContext())
 }
 
+// RetrieveWithContext fetches a session token then the credentials.
+//
+// Concurrent calls share one fetch. If the fetch fails because the
+// context of the caller making it was done, the other callers sharing
+// it fetch the credentials again. This goes through retrieveGroup
+// again as the fetch sets the token on the shared awsCredsProvider.
 func (p *awsSigningHelperProvider) RetrieveWithContext(ctx credentials.Context) (credentials.Value, error) {
+	v, err, shared := p.retrieveGroup.Do("", func() (interface{}, error) {
+		value, err := p.retrieve(ctx)
+		if err != nil && ctx.Err() != nil {
+			err = sharedCtxError{err: err}
+		}
+		return value, err
+	})
+	var ctxErr sharedCtxError
+	if errors.As(err, &ctxErr) {
+		if shared && ctx.Err() == nil {
+			return p.RetrieveWithContext(ctx)
+		}
+		return v.(credentials.Value), ctxErr.err
+	}
+	return v.(credentials.Value), err
+}
+
+// retrieve does the work of RetrieveWithContext
+func (p *awsSigningHelperProvider) retrieve(ctx credentials.Context) (credentials.Value, error) {
 	token, err := p.receiveToken(ctx)
 	if err != nil {
 		return credentials.Value{ProviderName: providerName},
@@ -5,18 +5,37 @@ import (
 	"compress/gzip"
 	"context"
 	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"path"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/defaults"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/fserrors"
 	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fs/operations"
 	"github.com/rclone/rclone/fstest"
 	"github.com/rclone/rclone/fstest/fstests"
 	"github.com/rclone/rclone/lib/bucket"
@@ -444,6 +463,816 @@ func (f *Fs) InternalTestVersions(t *testing.T) {
 	// Purge gets tested later
 }
 
+func TestObjectAttributesHash(t *testing.T) {
+	ctx := context.Background()
+	const (
+		sha256Hex = "b5bb9d8014a0f9b1d61e21e796d78dccdf1352f23cd32812f4850b878ae4944c"
+		sha1Hex   = "f1d2d2f924e986ac86fdf7b36c94bcdf32beec15"
+		crc32Hex  = "7e3265a8"
+	)
+	toBase64 := func(hexString string) string {
+		b, err := hex.DecodeString(hexString)
+		require.NoError(t, err)
+		return base64.StdEncoding.EncodeToString(b)
+	}
+	// Don't let the environment change the transport
+	t.Setenv("AWS_CA_BUNDLE", "")
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.URL.Query()["attributes"]; !ok {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		requests = append(requests, r.URL.Path)
+		assert.Equal(t, "Checksum,ObjectParts", r.Header.Get("x-amz-object-attributes"))
+		switch r.URL.Path {
+		case "/bucket/single":
+			_, _ = fmt.Fprintf(w, `<GetObjectAttributesResponse><Checksum><ChecksumSHA1>%s</ChecksumSHA1><ChecksumSHA256>%s</ChecksumSHA256><ChecksumCRC32>%s</ChecksumCRC32></Checksum></GetObjectAttributesResponse>`,
+				toBase64(sha1Hex), toBase64(sha256Hex), toBase64(crc32Hex))
+		case "/bucket/multipart":
+			_, _ = fmt.Fprintf(w, `<GetObjectAttributesResponse><Checksum><ChecksumSHA256>%s-2</ChecksumSHA256></Checksum><ObjectParts><TotalPartsCount>2</TotalPartsCount></ObjectParts></GetObjectAttributesResponse>`,
+				toBase64(sha256Hex))
+		case "/bucket/nochecksum":
+			_, _ = fmt.Fprint(w, `<GetObjectAttributesResponse></GetObjectAttributesResponse>`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = fmt.Fprint(w, `<Error><Code>NoSuchKey</Code></Error>`)
+		}
+	}))
+	defer srv.Close()
+
+	newFs := func(useObjectAttributes bool) *Fs {
+		remote := fmt.Sprintf(":s3,provider=Other,endpoint='%s',access_key_id=key,secret_access_key=secret,force_path_style,use_object_attributes=%v:bucket", srv.URL, useObjectAttributes)
+		f, err := fs.NewFs(ctx, remote)
+		require.NoError(t, err)
+		return f.(*Fs)
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		f := newFs(false)
+		assert.Equal(t, hash.Set(hash.MD5), f.Hashes())
+		o := &Object{fs: f, remote: "single", md5: "8ee2027983915ec78acc45027d874316"}
+		_, err := o.Hash(ctx, hash.SHA256)
+		assert.Equal(t, hash.ErrUnsupported, err)
+		assert.Empty(t, requests)
+	})
+
+	f := newFs(true)
+	assert.Equal(t, hash.NewHashSet(hash.MD5, hash.SHA1, hash.SHA256, hash.CRC32), f.Hashes())
+
+	t.Run("Single", func(t *testing.T) {
+		requests = nil
+		o := &Object{fs: f, remote: "single", md5: "8ee2027983915ec78acc45027d874316"}
+		for ht, want := range map[hash.Type]string{
+			hash.MD5:    "8ee2027983915ec78acc45027d874316",
+			hash.SHA1:   sha1Hex,
+			hash.SHA256: sha256Hex,
+			hash.CRC32:  crc32Hex,
+		} {
+			got, err := o.Hash(ctx, ht)
+			require.NoError(t, err)
+			assert.Equal(t, want, got, ht)
+		}
+		// The attributes should only be read once
+		assert.Equal(t, []string{"/bucket/single"}, requests)
+	})
+
+	t.Run("Multipart", func(t *testing.T) {
+		o := &Object{fs: f, remote: "multipart"}
+		got, err := o.Hash(ctx, hash.SHA256)
+		require.NoError(t, err)
+		assert.Equal(t, "", got)
+	})
+
+	t.Run("NoChecksum", func(t *testing.T) {
+		o := &Object{fs: f, remote: "nochecksum"}
+		got, err := o.Hash(ctx, hash.CRC32)
+		require.NoError(t, err)
+		assert.Equal(t, "", got)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		o := &Object{fs: f, remote: "potato"}
+		_, err := o.Hash(ctx, hash.SHA1)
+		assert.Equal(t, fs.ErrorObjectNotFound, err)
+	})
+}
+
+func TestDirMarkersSet(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want dirMarkers
+		err  bool
+	}{
+		{in: "", want: dirMarkersNoCreate},
+		{in: "false", want: dirMarkersNoCreate},
+		{in: "true", want: dirMarkersCreate},
+		{in: "no-create", want: dirMarkersNoCreate},
+		{in: "CREATE", want: dirMarkersCreate},
+		{in: "preserve", want: dirMarkersPreserve},
+		{in: "potato", err: true},
+	} {
+		var got dirMarkers
+		err := got.Set(test.in)
+		if test.err {
+			assert.Error(t, err, test.in)
+			continue
+		}
+		require.NoError(t, err, test.in)
+		assert.Equal(t, test.want, got, test.in)
+		if test.in != "" && test.in != "true" && test.in != "false" {
+			assert.Equal(t, strings.ToLower(test.in), got.String())
+		}
+	}
+}
+
+// fakeS3 is a minimal S3 server which stores objects in memory
+// keeping keys with trailing slashes so directory markers can be
+// tested.
+type fakeS3 struct {
+	mu               sync.Mutex
+	objects          map[string][]byte
+	acls             map[string]string      // X-Amz-Acl of objects if not nil
+	headers          map[string]http.Header // stored headers of objects if not nil
+	puts             int                    // number of PUTs which uploaded data
+	uploads          []fakeUpload           // pending multipart uploads
+	key              string                 // if set only requests signed with this access key are allowed
+	denied           int                    // number of requests denied because of the key
+	deletes          int                    // number of DeleteObjects calls
+	locked           map[string]bool        // keys which DeleteObjects fails to delete if not nil
+	skew             time.Duration          // offset of the server's clock from the local clock
+	skewed           int                    // number of requests denied because of the clock skew
+	gets             int                    // number of GETs which downloaded data
+	sha256s          map[string]string      // base64 SHA-256 checksums stored with objects if not nil
+	buckets          map[string]http.Header // headers buckets were created with - all buckets exist if nil
+	configs          map[string]string      // bucket configuration PUTs by "bucket?subresource"
+	failConfigs      int                    // number of bucket configuration PUTs to fail
+	failDeleteBucket bool                   // set to fail bucket deletes
+	lag              int                    // number of HEADs and GETs of a key after a PUT which see the old object
+	stale            map[string]*fakeStale  // old objects still seen by keys which were PUT with lag set
+	heads            int                    // number of HEADs
+	etags            map[string]string      // ETags of objects which aren't the MD5 of their data
+	parts            int                    // number of multipart upload parts uploaded
+	failing          int                    // number of CompleteMultipartUploads left which fail
+	lost             bool                   // set if failing CompleteMultipartUploads complete the upload
+	holds            map[string]string      // legal hold status of objects - object lock is enabled if not nil
+	aclGets          int                    // number of GetObjectAcls
+	lists            int                    // number of list requests
+	badPage          int                    // page of listings which fails while badLeft > 0
+	badLeft          int                    // number of times left badPage fails
+}
+
+// fakeStale is the old object fakeS3 returns for a key for a while
+// after it is PUT to simulate eventual consistency
+type fakeStale struct {
+	n     int    // number of HEADs and GETs left which see the old object
+	data  []byte // the old data
+	found bool   // whether the old object existed
+}
+
+// fakeETag returns the ETag fakeS3 gives data
+func fakeETag(data []byte) string {
+	return fmt.Sprintf(`"%x"`, md5.Sum(data))
+}
+
+// isStoredHeader returns true if fakeS3 stores header k with the object
+func isStoredHeader(k string) bool {
+	switch k {
+	case "Content-Type", "Cache-Control", "Content-Encoding", "X-Amz-Storage-Class":
+		return true
+	}
+	return isSSEHeader(k) || strings.HasPrefix(k, "X-Amz-Meta-")
+}
+
+// isSSEHeader returns true if k is a server-side encryption header
+// which, like S3, fakeS3 doesn't copy from the source of a copy
+func isSSEHeader(k string) bool {
+	switch k {
+	case "X-Amz-Server-Side-Encryption", "X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", "X-Amz-Server-Side-Encryption-Customer-Algorithm":
+		return true
+	}
+	return false
+}
+
+// fakeUpload is a pending multipart upload in fakeS3
+type fakeUpload struct {
+	key       string
+	id        string
+	initiated time.Time
+	parts     []int64          // sizes of the parts
+	contents  map[int64][]byte // contents of the parts uploaded by part number
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.key != "" && !strings.Contains(r.Header.Get("Authorization"), "Credential="+s.key+"/") {
+		s.denied++
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = fmt.Fprint(w, "<Error><Code>InvalidAccessKeyId</Code><Message>The AWS Access Key Id you provided does not exist in our records.</Message></Error>")
+		return
+	}
+	if s.skew != 0 {
+		serverTime := time.Now().Add(s.skew)
+		w.Header().Set("Date", serverTime.UTC().Format(http.TimeFormat))
+		signed, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+		if err != nil || serverTime.Sub(signed).Abs() > 15*time.Minute {
+			s.skewed++
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = fmt.Fprint(w, "<Error><Code>RequestTimeTooSkewed</Code><Message>The difference between the request time and the current time is too large.</Message></Error>")
+			return
+		}
+	}
+	bucketName, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+	if key == "" {
+		switch r.Method {
+		case "HEAD":
+			if _, found := s.buckets[bucketName]; s.buckets != nil && !found {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case "PUT":
+			if s.buckets != nil {
+				s.putBucket(w, r, bucketName)
+			}
+		case "DELETE":
+			if s.failDeleteBucket {
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = fmt.Fprint(w, "<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>")
+				return
+			}
+			delete(s.buckets, bucketName)
+			w.WriteHeader(http.StatusNoContent)
+		case "GET":
+			if query.Has("uploads") {
+				s.listUploads(w)
+				return
+			}
+			if query.Has("object-lock") {
+				s.getObjectLock(w)
+				return
+			}
+			maxKeys, _ := strconv.Atoi(query.Get("max-keys"))
+			s.list(w, query.Get("prefix"), query.Get("delimiter"), query.Get("marker"), maxKeys, query.Get("encoding-type") == "url")
+		case "POST":
+			if !query.Has("delete") {
+				w.WriteHeader(http.StatusNotImplemented)
+				return
+			}
+			s.deleteObjects(w, r)
+		default:
+			w.WriteHeader(http.StatusNotImplemented)
+		}
+		return
+	}
+	if bucketName != "bucket" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if uploadID := query.Get("uploadId"); uploadID != "" {
+		s.serveUpload(w, r, uploadID)
+		return
+	}
+	if query.Has("legal-hold") {
+		s.serveLegalHold(w, r, key)
+		return
+	}
+	switch r.Method {
+	case "POST":
+		if !query.Has("uploads") {
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		id := fmt.Sprintf("upload-%d", len(s.uploads)+1)
+		s.uploads = append(s.uploads, fakeUpload{key: key, id: id, initiated: time.Now(), contents: map[int64][]byte{}})
+		_, _ = fmt.Fprintf(w, "<InitiateMultipartUploadResult><Bucket>bucket</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>", key, id)
+	case "PUT":
+		data, _ := io.ReadAll(r.Body)
+		header := http.Header{}
+		if copySource := r.Header.Get("X-Amz-Copy-Source"); copySource != "" {
+			_, srcKey, _ := strings.Cut(strings.TrimPrefix(copySource, "/"), "/")
+			data = s.objects[srcKey]
+			if r.Header.Get("X-Amz-Metadata-Directive") != "REPLACE" && s.headers != nil {
+				header = s.headers[srcKey].Clone()
+				for k := range header {
+					if isSSEHeader(k) {
+						delete(header, k)
+					}
+				}
+			}
+			_, _ = fmt.Fprintf(w, "<CopyObjectResult><LastModified>2001-02-03T04:05:06.000Z</LastModified><ETag>%s</ETag></CopyObjectResult>", fakeETag(data))
+		} else {
+			s.puts++
+		}
+		if s.lag > 0 {
+			if s.stale == nil {
+				s.stale = map[string]*fakeStale{}
+			}
+			old, found := s.objects[key]
+			s.stale[key] = &fakeStale{n: s.lag, data: old, found: found}
+		}
+		w.Header().Set("ETag", fakeETag(data))
+		s.objects[key] = data
+		delete(s.etags, key)
+		if s.sha256s != nil && r.Header.Get("X-Amz-Checksum-Algorithm") == "SHA256" {
+			sum := sha256.Sum256(data)
+			s.sha256s[key] = base64.StdEncoding.EncodeToString(sum[:])
+		}
+		if s.acls != nil {
+			s.acls[key] = r.Header.Get("X-Amz-Acl")
+		}
+		if s.headers != nil {
+			for k, v := range r.Header {
+				if isStoredHeader(k) {
+					header[k] = v
+				}
+			}
+			s.headers[key] = header
+		}
+	case "HEAD", "GET":
+		data, found := s.objects[key]
+		if r.Method == "HEAD" {
+			s.heads++
+		}
+		if stale := s.stale[key]; stale != nil && stale.n > 0 {
+			stale.n--
+			data, found = stale.data, stale.found
+		}
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if query.Has("acl") {
+			s.aclGets++
+			const grant = `<Grant><Grantee xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="%s">%s</Grantee><Permission>%s</Permission></Grant>`
+			grants := fmt.Sprintf(grant, "CanonicalUser", "<ID>owner</ID>", "FULL_CONTROL")
+			if s.acls[key] == "public-read" {
+				grants += fmt.Sprintf(grant, "Group", "<URI>http://acs.amazonaws.com/groups/global/AllUsers</URI>", "READ")
+			}
+			_, _ = fmt.Fprintf(w, "<AccessControlPolicy><Owner><ID>owner</ID></Owner><AccessControlList>%s</AccessControlList></AccessControlPolicy>", grants)
+			return
+		}
+		if query.Has("attributes") {
+			var checksum string
+			if sum := s.sha256s[key]; sum != "" {
+				checksum = "<Checksum><ChecksumSHA256>" + sum + "</ChecksumSHA256></Checksum>"
+			}
+			_, _ = fmt.Fprintf(w, "<GetObjectAttributesResponse>%s</GetObjectAttributesResponse>", checksum)
+			return
+		}
+		for k, v := range s.headers[key] {
+			w.Header()[k] = v
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.Header().Set("ETag", fakeETag(data))
+		if etag, ok := s.etags[key]; ok {
+			w.Header().Set("ETag", etag)
+		}
+		if r.Method == "GET" {
+			s.gets++
+			_, _ = w.Write(data)
+		}
+	case "DELETE":
+		if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+			if _, found := s.objects[key]; !found {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = fmt.Fprint(w, "<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>")
+				return
+			}
+			if ifMatch != s.etag(key) {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				_, _ = fmt.Fprint(w, "<Error><Code>PreconditionFailed</Code><Message>At least one of the pre-conditions you specified did not hold</Message></Error>")
+				return
+			}
+		}
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// etag returns the ETag of the object at key
+func (s *fakeS3) etag(key string) string {
+	if etag, ok := s.etags[key]; ok {
+		return etag
+	}
+	return fakeETag(s.objects[key])
+}
+
+// putBucket creates a bucket or sets its configuration
+func (s *fakeS3) putBucket(w http.ResponseWriter, r *http.Request, bucketName string) {
+	data, _ := io.ReadAll(r.Body)
+	for _, subresource := range []string{"encryption", "versioning", "object-lock"} {
+		if r.URL.Query().Has(subresource) {
+			if s.failConfigs > 0 {
+				s.failConfigs--
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = fmt.Fprint(w, "<Error><Code>InvalidRequest</Code><Message>Configuration failed</Message></Error>")
+				return
+			}
+			s.configs[bucketName+"?"+subresource] = string(data)
+			return
+		}
+	}
+	if _, found := s.buckets[bucketName]; found {
+		w.WriteHeader(http.StatusConflict)
+		_, _ = fmt.Fprint(w, "<Error><Code>BucketAlreadyOwnedByYou</Code><Message>Your previous request to create the named bucket succeeded and you already own it.</Message></Error>")
+		return
+	}
+	s.buckets[bucketName] = r.Header.Clone()
+	s.configs[bucketName] = string(data)
+}
+
+// getObjectLock returns the object lock configuration of the bucket
+func (s *fakeS3) getObjectLock(w http.ResponseWriter) {
+	if s.holds == nil {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = fmt.Fprint(w, "<Error><Code>ObjectLockConfigurationNotFoundError</Code><Message>Object Lock configuration does not exist for this bucket</Message></Error>")
+		return
+	}
+	_, _ = fmt.Fprint(w, "<ObjectLockConfiguration><ObjectLockEnabled>Enabled</ObjectLockEnabled></ObjectLockConfiguration>")
+}
+
+// serveLegalHold reads or sets the legal hold of the object at key
+func (s *fakeS3) serveLegalHold(w http.ResponseWriter, r *http.Request, key string) {
+	if s.holds == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprint(w, "<Error><Code>InvalidRequest</Code><Message>Bucket is missing Object Lock Configuration</Message></Error>")
+		return
+	}
+	if _, found := s.objects[key]; !found {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = fmt.Fprint(w, "<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>")
+		return
+	}
+	switch r.Method {
+	case "PUT":
+		var hold struct {
+			Status string
+		}
+		data, _ := io.ReadAll(r.Body)
+		if err := xml.Unmarshal(data, &hold); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.holds[key] = hold.Status
+	case "GET":
+		status, found := s.holds[key]
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = fmt.Fprint(w, "<Error><Code>NoSuchObjectLockConfiguration</Code><Message>The specified object does not have a ObjectLock configuration</Message></Error>")
+			return
+		}
+		_, _ = fmt.Fprintf(w, "<LegalHold><Status>%s</Status></LegalHold>", status)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// listUploads lists the pending multipart uploads
+func (s *fakeS3) listUploads(w http.ResponseWriter) {
+	var uploads strings.Builder
+	for _, upload := range s.uploads {
+		_, _ = fmt.Fprintf(&uploads, "<Upload><Key>%s</Key><UploadId>%s</UploadId><Initiated>%s</Initiated></Upload>", upload.key, upload.id, upload.initiated.UTC().Format(time.RFC3339))
+	}
+	_, _ = fmt.Fprintf(w, "<ListMultipartUploadsResult><Bucket>bucket</Bucket><IsTruncated>false</IsTruncated>%s</ListMultipartUploadsResult>", uploads.String())
+}
+
+// serveUpload uploads a part to, completes, lists the parts of or
+// aborts a pending multipart upload
+func (s *fakeS3) serveUpload(w http.ResponseWriter, r *http.Request, uploadID string) {
+	for i, upload := range s.uploads {
+		if upload.id != uploadID {
+			continue
+		}
+		switch r.Method {
+		case "PUT":
+			partNumber, _ := strconv.ParseInt(r.URL.Query().Get("partNumber"), 10, 64)
+			data, _ := io.ReadAll(r.Body)
+			upload.contents[partNumber] = data
+			s.parts++
+			w.Header().Set("ETag", fakeETag(data))
+		case "POST":
+			if s.failing > 0 {
+				s.failing--
+				if s.lost {
+					s.completeUpload(upload, r)
+					s.uploads = append(s.uploads[:i], s.uploads[i+1:]...)
+				}
+				w.WriteHeader(http.StatusInternalServerError)
+				_, _ = fmt.Fprint(w, "<Error><Code>InternalError</Code><Message>We encountered an internal error. Please try again.</Message></Error>")
+				return
+			}
+			etag := s.completeUpload(upload, r)
+			s.uploads = append(s.uploads[:i], s.uploads[i+1:]...)
+			_, _ = fmt.Fprintf(w, "<CompleteMultipartUploadResult><Bucket>bucket</Bucket><Key>%s</Key><ETag>%s</ETag></CompleteMultipartUploadResult>", upload.key, etag)
+		case "GET":
+			var parts strings.Builder
+			for j, size := range upload.parts {
+				_, _ = fmt.Fprintf(&parts, "<Part><PartNumber>%d</PartNumber><Size>%d</Size></Part>", j+1, size)
+			}
+			_, _ = fmt.Fprintf(w, "<ListPartsResult><IsTruncated>false</IsTruncated>%s</ListPartsResult>", parts.String())
+		case "DELETE":
+			s.uploads = append(s.uploads[:i], s.uploads[i+1:]...)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotImplemented)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNotFound)
+	_, _ = fmt.Fprint(w, "<Error><Code>NoSuchUpload</Code><Message>The specified upload does not exist.</Message></Error>")
+}
+
+// completeUpload makes the object from the parts of upload listed in
+// the CompleteMultipartUpload request r returning its ETag
+func (s *fakeS3) completeUpload(upload fakeUpload, r *http.Request) string {
+	var req struct {
+		Parts []struct {
+			PartNumber int64
+		} `xml:"Part"`
+	}
+	body, _ := io.ReadAll(r.Body)
+	_ = xml.Unmarshal(body, &req)
+	var data, md5s []byte
+	for _, part := range req.Parts {
+		data = append(data, upload.contents[part.PartNumber]...)
+		sum := md5.Sum(upload.contents[part.PartNumber])
+		md5s = append(md5s, sum[:]...)
+	}
+	sum := md5.Sum(md5s)
+	etag := fmt.Sprintf(`"%x-%d"`, sum, len(req.Parts))
+	s.objects[upload.key] = data
+	if s.etags == nil {
+		s.etags = map[string]string{}
+	}
+	s.etags[upload.key] = etag
+	return etag
+}
+
+// deleteObjects deletes the objects in a DeleteObjects request
+func (s *fakeS3) deleteObjects(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Objects []struct {
+			Key string `xml:"Key"`
+		} `xml:"Object"`
+	}
+	err := xml.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.deletes++
+	var errs strings.Builder
+	for _, object := range req.Objects {
+		if s.locked[object.Key] {
+			_, _ = fmt.Fprintf(&errs, "<Error><Key>%s</Key><Code>AccessDenied</Code><Message>Access Denied</Message></Error>", object.Key)
+			continue
+		}
+		delete(s.objects, object.Key)
+	}
+	_, _ = fmt.Fprintf(w, "<DeleteResult>%s</DeleteResult>", errs.String())
+}
+
+// list the objects as a ListObjects (v1) response
+//
+// The listing is returned in pages of maxKeys entries, if set,
+// starting after marker. If urlEncode is set the names are URL
+// encoded.
+func (s *fakeS3) list(w http.ResponseWriter, prefix, delimiter, marker string, maxKeys int, urlEncode bool) {
+	s.lists++
+	encode := func(name string) string {
+		if urlEncode {
+			return url.QueryEscape(name)
+		}
+		return name
+	}
+	var keys []string
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	// entries are the keys and common prefixes in the listing in order
+	type entry struct {
+		name     string
+		isPrefix bool
+	}
+	var entries []entry
+	seen := map[string]bool{}
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if i := strings.Index(key[len(prefix):], delimiter); delimiter != "" && i >= 0 {
+			commonPrefix := key[:len(prefix)+i+1]
+			if !seen[commonPrefix] {
+				seen[commonPrefix] = true
+				entries = append(entries, entry{name: commonPrefix, isPrefix: true})
+			}
+			continue
+		}
+		entries = append(entries, entry{name: key})
+	}
+	start := sort.Search(len(entries), func(i int) bool {
+		return entries[i].name > marker
+	})
+	if maxKeys > 0 && start/maxKeys+1 == s.badPage && s.badLeft > 0 {
+		s.badLeft--
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = fmt.Fprint(w, "<Error><Code>InternalError</Code><Message>We encountered an internal error. Please try again.</Message></Error>")
+		return
+	}
+	entries = entries[start:]
+	truncated := maxKeys > 0 && len(entries) > maxKeys
+	if truncated {
+		entries = entries[:maxKeys]
+	}
+	var contents, prefixes strings.Builder
+	for _, e := range entries {
+		if e.isPrefix {
+			_, _ = fmt.Fprintf(&prefixes, "<CommonPrefixes><Prefix>%s</Prefix></CommonPrefixes>", encode(e.name))
+		} else {
+			_, _ = fmt.Fprintf(&contents, "<Contents><Key>%s</Key><Size>%d</Size><LastModified>2001-02-03T04:05:06.000Z</LastModified><ETag>%s</ETag></Contents>", encode(e.name), len(s.objects[e.name]), s.etag(e.name))
+		}
+	}
+	nextMarker := ""
+	if truncated {
+		nextMarker = "<NextMarker>" + encode(entries[len(entries)-1].name) + "</NextMarker>"
+	}
+	_, _ = fmt.Fprintf(w, "<ListBucketResult><IsTruncated>%v</IsTruncated>%s%s%s</ListBucketResult>", truncated, nextMarker, contents.String(), prefixes.String())
+}
+
+func TestDirectoryMarkers(t *testing.T) {
+	ctx := context.Background()
+	// Don't let the environment change the transport
+	t.Setenv("AWS_CA_BUNDLE", "")
+	for _, mode := range []dirMarkers{dirMarkersNoCreate, dirMarkersCreate, dirMarkersPreserve} {
+		t.Run(mode.String(), func(t *testing.T) {
+			fake := &fakeS3{objects: map[string][]byte{}}
+			srv := httptest.NewServer(fake)
+			defer srv.Close()
+			remote := fmt.Sprintf(":s3,provider=Other,endpoint='%s',access_key_id=key,secret_access_key=secret,force_path_style,list_version=1,list_url_encode=false,directory_markers=%v:bucket", srv.URL, mode)
+			f, err := fs.NewFs(ctx, remote)
+			require.NoError(t, err)
+			require.NoError(t, f.Mkdir(ctx, ""))
+			assert.Equal(t, mode.create(), f.Features().CanHaveEmptyDirectories)
+			hasMarker := func(key string) bool {
+				fake.mu.Lock()
+				defer fake.mu.Unlock()
+				_, found := fake.objects[key]
+				return found
+			}
+			putMarker := func(key string) {
+				fake.mu.Lock()
+				defer fake.mu.Unlock()
+				fake.objects[key] = nil
+			}
+
+			// Mkdir only makes markers in create mode
+			require.NoError(t, f.Mkdir(ctx, "new/sub"))
+			assert.Equal(t, mode.create(), hasMarker("new/"))
+			assert.Equal(t, mode.create(), hasMarker("new/sub/"))
+
+			// A marker made by another tool is always listed as a directory
+			putMarker("other/")
+			entries, err := f.List(ctx, "")
+			require.NoError(t, err)
+			var dirs []string
+			for _, entry := range entries {
+				if _, ok := entry.(fs.Directory); ok {
+					dirs = append(dirs, entry.Remote())
+				}
+			}
+			assert.Contains(t, dirs, "other")
+			entries, err = f.List(ctx, "other")
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+
+			// Without a marker an empty directory only doesn't
+			// exist if markers are used to record directories
+			_, err = f.List(ctx, "missing")
+			if mode.exist() {
+				assert.Equal(t, fs.ErrorDirNotFound, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			// Removing a file in the directory leaves the marker
+			src := object.NewStaticObjectInfo("other/file.txt", time.Now(), 5, true, nil, nil)
+			o, err := f.Put(ctx, strings.NewReader("hello"), src)
+			require.NoError(t, err)
+			require.NoError(t, o.Remove(ctx))
+			assert.True(t, hasMarker("other/"))
+
+			// Rmdir removes existing markers unless in no-create mode
+			require.NoError(t, f.Rmdir(ctx, "other"))
+			assert.Equal(t, !mode.exist(), hasMarker("other/"))
+		})
+	}
+}
+
+func TestPercentInvalidUTF8(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want string
+	}{
+		{"", ""},
+		{"file.txt", "file.txt"},
+		{"caf\xc3\xa9", "caf\xc3\xa9"},
+		{"bad\xffname", "bad%FFname"},
+		{"\xfe\xff", "%FE%FF"},
+		{"caf\xc3", "caf%C3"},
+		{"\xc3\xa9\xa9", "\xc3\xa9%A9"},
+	} {
+		got := percentEncodeInvalidUTF8(test.in)
+		assert.Equal(t, test.want, got, test.in)
+		assert.True(t, utf8.ValidString(got), test.in)
+	}
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	ctx := context.Background()
+	// Don't let the environment change the transport
+	t.Setenv("AWS_CA_BUNDLE", "")
+	fake := &fakeS3{objects: map[string][]byte{
+		"good.txt":            []byte("good"),
+		"bad\xffname.txt":     []byte("bad"),
+		"dir\xfe/file.txt":    []byte("file"),
+		"dir/\xc3.txt":        []byte("short"),
+		"dir/caf\xc3\xa9.txt": []byte("valid"),
+	}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	for _, test := range []struct {
+		mode     invalidUTF8
+		root     []string
+		dir      []string
+		contents map[string]string
+	}{{
+		mode: invalidUTF8Encode,
+		root: []string{"bad\xffname.txt", "dir", "dir\xfe", "good.txt"},
+	}, {
+		mode: invalidUTF8Skip,
+		root: []string{"dir", "good.txt"},
+		dir:  []string{"dir/café.txt"},
+	}, {
+		mode: invalidUTF8Percent,
+		root: []string{"bad%FFname.txt", "dir", "dir%FE", "good.txt"},
+		dir:  []string{"dir/%C3.txt", "dir/café.txt"},
+		contents: map[string]string{
+			"bad%FFname.txt":  "bad",
+			"dir%FE/file.txt": "file",
+			"dir/%C3.txt":     "short",
+		},
+	}} {
+		t.Run(test.mode.String(), func(t *testing.T) {
+			remote := fmt.Sprintf(":s3,provider=Other,endpoint='%s',access_key_id=key,secret_access_key=secret,force_path_style,list_version=1,list_url_encode=true,encoding=Slash,invalid_utf8=%v:bucket", srv.URL, test.mode)
+			f, err := fs.NewFs(ctx, remote)
+			require.NoError(t, err)
+			names := func(dir string) (names []string) {
+				entries, err := f.List(ctx, dir)
+				require.NoError(t, err)
+				for _, entry := range entries {
+					names = append(names, entry.Remote())
+				}
+				sort.Strings(names)
+				return names
+			}
+			assert.Equal(t, test.root, names(""))
+			if test.dir != nil {
+				assert.Equal(t, test.dir, names("dir"))
+			}
+			for name, want := range test.contents {
+				o, err := f.NewObject(ctx, name)
+				require.NoError(t, err, name)
+				in, err := o.Open(ctx)
+				require.NoError(t, err, name)
+				got, err := io.ReadAll(in)
+				require.NoError(t, err)
+				require.NoError(t, in.Close())
+				assert.Equal(t, want, string(got), name)
+			}
+			if test.mode != invalidUTF8Percent {
+				return
+			}
+			// Names which weren't listed are written as they are,
+			// apart from the directories which were listed
+			for name, key := range map[string]string{
+				"new%FF.txt":     "new%FF.txt",
+				"dir%FE/new.txt": "dir\xfe/new.txt",
+			} {
+				src := object.NewStaticObjectInfo(name, time.Now(), 3, true, nil, nil)
+				_, err := f.Put(ctx, bytes.NewBufferString("new"), src)
+				require.NoError(t, err, name)
+				assert.Equal(t, "new", string(fake.objects[key]), name)
+			}
+		})
+	}
+}
+
 func (f *Fs) InternalTest(t *testing.T) {
 	t.Run("Metadata", f.InternalTestMetadata)
 	t.Run("NoHead", f.InternalTestNoHead)
@@ -451,3 +1280,1826 @@ func (f *Fs) InternalTest(t *testing.T) {
 }
 
 var _ fstests.InternalTester = (*Fs)(nil)
+
+func TestParseACLRules(t *testing.T) {
+	for _, test := range []struct {
+		in      fs.CommaSepList
+		wantErr bool
+	}{
+		{in: nil},
+		{in: fs.CommaSepList{"/public/**=public-read", "*.key=private"}},
+		{in: fs.CommaSepList{"/{css,js}/**=public-read"}},
+		{in: fs.CommaSepList{"public-read"}, wantErr: true},
+		{in: fs.CommaSepList{"=public-read"}, wantErr: true},
+		{in: fs.CommaSepList{"/public/**="}, wantErr: true},
+		{in: fs.CommaSepList{"***=private"}, wantErr: true},
+	} {
+		rules, err := parseACLRules(test.in)
+		if test.wantErr {
+			assert.Error(t, err, test.in)
+		} else {
+			assert.NoError(t, err, test.in)
+			assert.Equal(t, len(test.in), len(rules))
+		}
+	}
+
+	rules, err := parseACLRules(fs.CommaSepList{"/public/**=public-read", "*.key=private", "/{css,js}/**=authenticated-read"})
+	require.NoError(t, err)
+	f := &Fs{opt: Options{ACL: "bucket-owner-read"}, aclRules: rules}
+	for _, test := range []struct {
+		key  string
+		want string
+	}{
+		{"public/index.html", "public-read"},
+		{"public/sub/dir/image.png", "public-read"},
+		{"public/secret.key", "public-read"}, // first match wins
+		{"dir/public/index.html", "bucket-owner-read"},
+		{"dir/secret.key", "private"},
+		{"secret.key", "private"},
+		{"css/site.css", "authenticated-read"},
+		{"index.html", "bucket-owner-read"},
+	} {
+		assert.Equal(t, test.want, f.aclFor(test.key), test.key)
+	}
+}
+
+func TestReadACL(t *testing.T) {
+	ctx := context.Background()
+	// Don't let the environment change the transport
+	t.Setenv("AWS_CA_BUNDLE", "")
+	fake := &fakeS3{objects: map[string][]byte{
+		"file1": []byte("one"),
+		"file2": []byte("two"),
+		"file3": []byte("three"),
+	}, acls: map[string]string{"file2": "public-read"}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	// lsjson returns the acl-grants metadata of each file
+	lsjson := func(options string) map[string]string {
+		remote := fmt.Sprintf(":s3,provider=Other,endpoint='%s',access_key_id=key,secret_access_key=secret,force_path_style,list_version=1%s:bucket", srv.URL, options)
+		f, err := fs.NewFs(ctx, remote)
+		require.NoError(t, err)
+		grants := map[string]string{}
+		err = operations.ListJSON(ctx, f, "", &operations.ListJSONOpt{Metadata: true}, func(item *operations.ListJSONItem) error {
+			grants[item.Path] = item.Metadata["acl-grants"]
+			return nil
+		})
+		require.NoError(t, err)
+		return grants
+	}
+
+	// The ACLs aren't read by default
+	assert.Equal(t, map[string]string{"file1": "", "file2": "", "file3": ""}, lsjson(""))
+	assert.Equal(t, 0, fake.aclGets)
+
+	const owner = "FULL_CONTROL:CanonicalUser:owner"
+	assert.Equal(t, map[string]string{
+		"file1": owner,
+		"file2": owner + ",READ:Group:http://acs.amazonaws.com/groups/global/AllUsers",
+		"file3": owner,
+	}, lsjson(",read_acl"))
+	assert.Equal(t, 3, fake.aclGets)
+
+	// Only a sample of the ACLs are read if set
+	fake.aclGets = 0
+	grants := lsjson(",read_acl,read_acl_sample=2")
+	assert.Equal(t, 2, fake.aclGets)
+	var read int
+	for _, grant := range grants {
+		if grant != "" {
+			read++
+		}
+	}
+	assert.Equal(t, 2, read)
+}
+
+func TestListRetries(t *testing.T) {
+	ctx := context.Background()
+	// Don't let the environment change the transport
+	t.Setenv("AWS_CA_BUNDLE", "")
+	// Only try each page once, and once more in the SDK, so the
+	// failures reach the listing
+	ctx, ci := fs.AddConfig(ctx)
+	ci.LowLevelRetries = 1
+	fake := &fakeS3{objects: map[string][]byte{}}
+	var want []string
+	for i := 0; i < 25; i++ {
+		name := fmt.Sprintf("file%02d", i)
+		fake.objects[name] = []byte(name)
+		want = append(want, name)
+	}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	// list lists the bucket in pages of 10 failing page badPage
+	// badLeft times
+	list := func(options string, badPage, badLeft int) ([]string, error) {
+		fake.badPage, fake.badLeft, fake.lists = badPage, badLeft, 0
+		remote := fmt.Sprintf(":s3,provider=Other,endpoint='%s',access_key_id=key,secret_access_key=secret,force_path_style,list_version=1,list_chunk=10%s:bucket", srv.URL, options)
+		f, err := fs.NewFs(ctx, remote)
+		require.NoError(t, err)
+		entries, err := f.List(ctx, "")
+		var remotes []string
+		for _, entry := range entries {
+			remotes = append(remotes, entry.Remote())
+		}
+		return remotes, err
+	}
+
+	// Without failures the listing is three pages
+	remotes, err := list("", 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, want, remotes)
+	assert.Equal(t, 3, fake.lists)
+
+	// Without list_retries a failing page fails the listing after
+	// the low level retries, which take tries requests
+	_, err = list(",list_retries=0", 3, 100)
+	assert.ErrorContains(t, err, "InternalError")
+	tries := fake.lists - 2
+	require.Greater(t, tries, 0)
+
+	// A page failing part way through is carried on from
+	remotes, err = list("", 3, tries+1)
+	require.NoError(t, err)
+	assert.Equal(t, want, remotes)
+	assert.Equal(t, 0, fake.badLeft)
+	assert.Equal(t, 2+tries+2, fake.lists)
+
+	// Unless the page fails more than list_retries times
+	_, err = list(",list_retries=1", 3, 100)
+	assert.ErrorContains(t, err, "InternalError")
+	assert.Equal(t, 2+2*tries, fake.lists)
+
+	// The first page isn't retried as nothing has been listed yet
+	_, err = list("", 1, tries+1)
+	assert.ErrorContains(t, err, "InternalError")
+	assert.Equal(t, tries, fake.lists)
+}
+
+// slowHandler delays the requests to h which match so that requests
+// made at the same time are all in progress together
+func slowHandler(h http.Handler, match func(r *http.Request) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if match(r) {
+			time.Sleep(200 * time.Millisecond)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// concurrently calls fn n times at once and waits for them to finish
+func concurrently(n int, fn func()) {
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			fn()
+		}()
+	}
+	close(start)
+	wg.Wait()
+}
+
+func TestListCoalesce(t *testing.T) {
+	ctx := context.Background()
+	// Don't let the environment change the transport
+	t.Setenv("AWS_CA_BUNDLE", "")
+	fake := &fakeS3{objects: map[string][]byte{
+		"dir/file1": []byte("one"),
+		"dir/file2": []byte("two"),
+	}}
+	srv := httptest.NewServer(slowHandler(fake, func(r *http.Request) bool {
+		return r.Method == "GET" && r.URL.Path == "/bucket"
+	}))
+	defer srv.Close()
+
+	// listAll lists dir n times at once returning the sorted
+	// remotes of each listing
+	const n = 10
+	listAll := func(options, dir string) (listings [][]string) {
+		remote := fmt.Sprintf(":s3,provider=Other,endpoint='%s',access_key_id=key,secret_access_key=secret,force_path_style%s:bucket", srv.URL, options)
+		f, err := fs.NewFs(ctx, remote)
+		require.NoError(t, err)
+		fake.lists = 0
+		var mu sync.Mutex
+		concurrently(n, func() {
+			entries, err := f.List(ctx, dir)
+			require.NoError(t, err)
+			// Sort in place to check callers don't share
+			// the entries
+			sort.Slice(entries, func(i, j int) bool {
+				return entries[i].Remote() > entries[j].Remote()
+			})
+			var remotes []string
+			for _, entry := range entries {
+				remotes = append(remotes, entry.Remote())
+			}
+			mu.Lock()
+			listings = append(listings, remotes)
+			mu.Unlock()
+		})
+		return listings
+	}
+
+	// Without list_coalesce each caller lists the directory
+	listings := listAll("", "dir")
+	assert.Equal(t, n, fake.lists)
+	assert.Len(t, listings, n)
+
+	// With it the listings in progress at once are shared
+	listings = listAll(",list_coalesce", "dir")
+	assert.Equal(t, 1, fake.lists)
+	require.Len(t, listings, n)
+	for _, remotes := range listings {
+		assert.Equal(t, []string{"dir/file2", "dir/file1"}, remotes)
+	}
+
+	// Listings of different directories aren't shared
+	remote := fmt.Sprintf(":s3,provider=Other,endpoint='%s',access_key_id=key,secret_access_key=secret,force_path_style,list_coalesce:bucket", srv.URL)
+	f, err := fs.NewFs(ctx, remote)
+	require.NoError(t, err)
+	fake.lists = 0
+	concurrently(2, func() {
+		_, err := f.List(ctx, "")
+		require.NoError(t, err)
+	})
+	_, err = f.List(ctx, "dir")
+	require.NoError(t, err)
+	assert.Equal(t, 2, fake.lists)
+
+	// Each caller gets its own objects
+	var mu sync.Mutex
+	objects := map[fs.DirEntry]struct{}{}
+	concurrently(2, func() {
+		entries, err := f.List(ctx, "dir")
+		require.NoError(t, err)
+		mu.Lock()
+		for _, entry := range entries {
+			objects[entry] = struct{}{}
+		}
+		mu.Unlock()
+	})
+	assert.Len(t, objects, 4)
+
+	// A listing whose caller's context times out doesn't fail the
+	// listings sharing it
+	fake.lists = 0
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := f.List(timeoutCtx, "dir")
+		assert.Error(t, err)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	entries, err := f.List(ctx, "dir")
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+	wg.Wait()
+	assert.Equal(t, 2, fake.lists)
+}
+
+func TestUpdateRegionForBucketCoalesce(t *testing.T) {
+	ctx := context.Background()
+	// Don't let the environment change the transport
+	t.Setenv("AWS_CA_BUNDLE", "")
+	var lookups atomic.Int32
+	srv := httptest.NewServer(slowHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "HEAD" && r.URL.Path == "/bucket" {
+			lookups.Add(1)
+			w.Header().Set("X-Amz-Bucket-Region", "eu-west-2")
+		}
+	}), func(r *http.Request) bool {
+		return r.Method == "HEAD"
+	}))
+	defer srv.Close()
+	remote := fmt.Sprintf(":s3,provider=Other,endpoint='%s',access_key_id=key,secret_access_key=secret,force_path_style:bucket", srv.URL)
+	fsrc, err := fs.NewFs(ctx, remote)
+	require.NoError(t, err)
+	f := fsrc.(*Fs)
+
+	// Concurrent updates for the bucket share one region lookup
+	// and switch
+	lookups.Store(0)
+	concurrently(10, func() {
+		assert.NoError(t, f.updateRegionForBucket(ctx, "bucket"))
+	})
+	assert.Equal(t, int32(1), lookups.Load())
+	assert.Equal(t, "eu-west-2", f.opt.Region)
+
+	// But later ones look the region up again
+	err = f.updateRegionForBucket(ctx, "bucket")
+	assert.ErrorContains(t, err, `region is already "eu-west-2"`)
+	assert.Equal(t, int32(2), lookups.Load())
+}
+
+func TestAWSSigningHelperCoalesce(t *testing.T) {
+	var tokens, creds atomic.Int32
+	srv := httptest.NewServer(slowHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "PUT" && r.URL.Path == tokenResourcePath:
+			n := tokens.Add(1)
+			_, _ = fmt.Fprintf(w, "token%d", n)
+		case r.Method == "GET" && r.URL.Path == "/creds":
+			creds.Add(1)
+			if r.Header.Get("Authorization") != fmt.Sprintf("token%d", tokens.Load()) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = fmt.Fprintf(w, `{"AccessKeyId":"key","SecretAccessKey":"secret","Token":"session","Expiration":%q}`,
+				time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}), func(r *http.Request) bool {
+		return r.Method == "PUT"
+	}))
+	defer srv.Close()
+	t.Setenv(httpProviderEnvVar, srv.URL+"/creds")
+	p := newAWSSigningHelperRemoteCredProvider(defaults.Config(), defaults.Handlers())
+	_, ok := p.(*awsSigningHelperProvider)
+	require.True(t, ok)
+
+	// retrieve retrieves the credentials n times at once
+	retrieve := func(n int) {
+		concurrently(n, func() {
+			value, err := p.Retrieve()
+			require.NoError(t, err)
+			assert.Equal(t, "key", value.AccessKeyID)
+			assert.Equal(t, "session", value.SessionToken)
+		})
+	}
+
+	// Concurrent retrievals share one token and credentials fetch
+	retrieve(10)
+	assert.Equal(t, int32(1), tokens.Load())
+	assert.Equal(t, int32(1), creds.Load())
+
+	// But later ones fetch them again
+	retrieve(1)
+	assert.Equal(t, int32(2), tokens.Load())
+	assert.Equal(t, int32(2), creds.Load())
+
+	// A fetch whose caller's context times out doesn't fail the
+	// retrievals sharing it
+	ctx := context.Background()
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	provider := p.(*awsSigningHelperProvider)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := provider.RetrieveWithContext(timeoutCtx)
+		assert.Error(t, err)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	value, err := provider.RetrieveWithContext(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "key", value.AccessKeyID)
+	wg.Wait()
+	assert.Equal(t, int32(4), tokens.Load())
+}
+
+func TestACLRules(t *testing.T) {
+	ctx := context.Background()
+	// Don't let the environment change the transport
+	t.Setenv("AWS_CA_BUNDLE", "")
+	fake := &fakeS3{objects: map[string][]byte{}, acls: map[string]string{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	remote := fmt.Sprintf(`:s3,provider=Other,endpoint='%s',access_key_id=key,secret_access_key=secret,force_path_style,list_version=1,list_url_encode=false,acl=private,acl_rules='/dir/public/**=public-read,"*.{jpg,png}=authenticated-read"':bucket/dir`, srv.URL)
+	f, err := fs.NewFs(ctx, remote)
+	require.NoError(t, err)
+
+	for _, remote := range []string{"public/index.html", "public/image.png", "image.png", "index.html"} {
+		contents := "hello " + remote
+		src := object.NewStaticObjectInfo(remote, time.Now(), int64(len(contents)), true, nil, nil)
+		_, err := f.Put(ctx, strings.NewReader(contents), src)
+		require.NoError(t, err)
+	}
+	o, err := f.NewObject(ctx, "index.html")
+	require.NoError(t, err)
+	_, err = f.Features().Copy(ctx, o, "public/copy.html")
+	require.NoError(t, err)
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	assert.Equal(t, map[string]string{
+		"dir/public/index.html": "public-read",
+		"dir/public/image.png":  "public-read",
+		"dir/image.png":         "authenticated-read",
+		"dir/index.html":        "private",
+		"dir/public/copy.html":  "public-read",
+	}, fake.acls)
+}
+
+func TestCleanUpMultipart(t *testing.T) {
+	ctx := context.Background()
+	// Don't let the environment change the transport
+	t.Setenv("AWS_CA_BUNDLE", "")
+	now := time.Now()
+	makeFake := func() *fakeS3 {
+		return &fakeS3{objects: map[string][]byte{}, uploads: []fakeUpload{
+			{key: "old", id: "1", initiated: now.Add(-48 * time.Hour), parts: []int64{100, 200}},
+			{key: "dir/older", id: "2", initiated: now.Add(-72 * time.Hour), parts: []int64{1000}},
+			{key: "new", id: "3", initiated: now.Add(-time.Hour), parts: []int64{5000}},
+		}}
+	}
+	remainingIDs := func(fake *fakeS3) (ids []string) {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		for _, upload := range fake.uploads {
+			ids = append(ids, upload.id)
+		}
+		return ids
+	}
+
+	for _, test := range []struct {
+		name    string
+		dryRun  bool
+		opt     map[string]string
+		want    cleanUpResult
+		wantIDs []string
+	}{
+		{name: "default", want: cleanUpResult{Uploads: 2, Size: 1300}, wantIDs: []string{"3"}},
+		{name: "max-age", opt: map[string]string{"max-age": "50h"}, want: cleanUpResult{Uploads: 1, Size: 1000}, wantIDs: []string{"1", "3"}},
+		{name: "dry-run", dryRun: true, want: cleanUpResult{Uploads: 2, Size: 1300}, wantIDs: []string{"1", "2", "3"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			fake := makeFake()
+			srv := httptest.NewServer(fake)
+			defer srv.Close()
+			remote := fmt.Sprintf(":s3,provider=Other,endpoint='%s',access_key_id=key,secret_access_key=secret,force_path_style:bucket", srv.URL)
+			f, err := fs.NewFs(ctx, remote)
+			require.NoError(t, err)
+			ctx, ci := fs.AddConfig(ctx)
+			ci.DryRun = test.dryRun
+			out, err := f.Features().Command(ctx, "cleanup", nil, test.opt)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, out)
+			assert.Equal(t, test.wantIDs, remainingIDs(fake))
+		})
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	ctx := context.Background()
+	// Don't let the environment change the transport
+	t.Setenv("AWS_CA_BUNDLE", "")
+	fake := &fakeS3{objects: map[string][]byte{}, headers: map[string]http.Header{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	remote := fmt.Sprintf(":s3,provider=Other,endpoint='%s',access_key_id=key,secret_access_key=secret,force_path_style,list_version=1", srv.URL)
+	f, err := fs.NewFs(ctx, remote+":bucket")
+	require.NoError(t, err)
+
+	const contents = "hello world"
+	modTime := fstest.Time("2001-02-03T04:05:06.499999999Z")
+	for _, remote := range []string{"file.txt", "other.txt"} {
+		src := object.NewStaticObjectInfo(remote, modTime, int64(len(contents)), true, nil, nil)
+		_, err = f.Put(ctx, strings.NewReader(contents), src)
+		require.NoError(t, err)
+	}
+	fake.mu.Lock()
+	before := fake.headers["file.txt"].Clone()
+	fake.puts = 0
+	fake.mu.Unlock()
+
+	// Rewrite with new settings for the backend
+	f, err = fs.NewFs(ctx, remote+",server_side_encryption=AES256:bucket")
+	require.NoError(t, err)
+	fi, err := filter.NewFilter(nil)
+	require.NoError(t, err)
+	require.NoError(t, fi.AddRule("+ file.txt"))
+	require.NoError(t, fi.AddRule("- *"))
+	out, err := f.Features().Command(filter.ReplaceConfig(ctx, fi), "rewrite", nil, map[string]string{
+		"tier":          "standard_ia",
+		"cache-control": "no-cache",
+		"potato":        "jersey royal",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []rewriteStatusOut{{Status: "OK", Remote: "file.txt"}}, out)
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	assert.Equal(t, 0, fake.puts, "data shouldn't be uploaded")
+	assert.Equal(t, contents, string(fake.objects["file.txt"]))
+	assert.Equal(t, contents, string(fake.objects["other.txt"]))
+	after := fake.headers["file.txt"]
+	assert.Equal(t, before.Get("X-Amz-Meta-Mtime"), after.Get("X-Amz-Meta-Mtime"))
+	assert.Equal(t, before.Get("Content-Type"), after.Get("Content-Type"))
+	assert.Equal(t, "no-cache", after.Get("Cache-Control"))
+	assert.Equal(t, "jersey royal", after.Get("X-Amz-Meta-Potato"))
+	assert.Equal(t, "STANDARD_IA", after.Get("X-Amz-Storage-Class"))
+	assert.Equal(t, "AES256", after.Get("X-Amz-Server-Side-Encryption"))
+	assert.Equal(t, "", after.Get("X-Amz-Meta-Btime"))
+	assert.Equal(t, "", after.Get("X-Amz-Meta-Tier"))
+	assert.Equal(t, "", fake.headers["other.txt"].Get("X-Amz-Meta-Potato"))
+}
+
+func TestAddChecksum(t *testing.T) {
+	ctx := context.Background()
+	// Don't let the environment change the transport
+	t.Setenv("AWS_CA_BUNDLE", "")
+	fake := &fakeS3{objects: map[string][]byte{}, headers: map[string]http.Header{}, sha256s: map[string]string{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	remote := fmt.Sprintf(":s3,provider=Other,endpoint='%s',access_key_id=key,secret_access_key=secret,force_path_style,list_version=1,use_object_attributes:bucket", srv.URL)
+	f, err := fs.NewFs(ctx, remote)
+	require.NoError(t, err)
+
+	for _, remote := range []string{"file.txt", "dir/other.txt"} {
+		contents := "hello " + remote
+		src := object.NewStaticObjectInfo(remote, time.Now(), int64(len(contents)), true, nil, nil)
+		_, err = f.Put(ctx, strings.NewReader(contents), src)
+		require.NoError(t, err)
+	}
+	sha256sum := func(contents string) string {
+		sum := sha256.Sum256([]byte(contents))
+		return hex.EncodeToString(sum[:])
+	}
+	fake.mu.Lock()
+	fake.puts = 0
+	fake.mu.Unlock()
+
+	// Only sha256, sha1 and crc32 can be added
+	_, err = f.Features().Command(ctx, "add-checksum", nil, map[string]string{"algorithm": "md5"})
+	assert.Error(t, err)
+
+	// Nothing is changed with --dry-run
+	dryCtx, ci := fs.AddConfig(ctx)
+	ci.DryRun = true
+	_, err = f.Features().Command(dryCtx, "add-checksum", nil, nil)
+	require.NoError(t, err)
+	fake.mu.Lock()
+	assert.Empty(t, fake.sha256s)
+	fake.mu.Unlock()
+
+	// The objects gain a checksum without their data being transferred
+	out, err := f.Features().Command(ctx, "add-checksum", nil, nil)
+	require.NoError(t, err)
+	sortOut := func(out interface{}) []addChecksumStatusOut {
+		sts := out.([]addChecksumStatusOut)
+		sort.Slice(sts, func(i, j int) bool { return sts[i].Remote < sts[j].Remote })
+		return sts
+	}
+	assert.Equal(t, []addChecksumStatusOut{
+		{Status: "OK", Remote: "dir/other.txt", Checksum: sha256sum("hello dir/other.txt")},
+		{Status: "OK", Remote: "file.txt", Checksum: sha256sum("hello file.txt")},
+	}, sortOut(out))
+	fake.mu.Lock()
+	assert.Equal(t, 0, fake.puts, "data shouldn't be uploaded")
+	assert.Equal(t, 0, fake.gets, "data shouldn't be downloaded")
+	assert.Equal(t, "hello file.txt", string(fake.objects["file.txt"]))
+	fake.mu.Unlock()
+
+	// The checksum can be read as a hash
+	o, err := f.NewObject(ctx, "file.txt")
+	require.NoError(t, err)
+	sum, err := o.Hash(ctx, hash.SHA256)
+	require.NoError(t, err)
+	assert.Equal(t, sha256sum("hello file.txt"), sum)
+
+	// Objects with a checksum are left alone
+	out, err = f.Features().Command(ctx, "add-checksum", nil, map[string]string{"algorithm": "sha256"})
+	require.NoError(t, err)
+	assert.Equal(t, []addChecksumStatusOut{
+		{Status: "Exists", Remote: "dir/other.txt", Checksum: sha256sum("hello dir/other.txt")},
+		{Status: "Exists", Remote: "file.txt", Checksum: sha256sum("hello file.txt")},
+	}, sortOut(out))
+}
+
+func TestMakeBucketSettings(t *testing.T) {
+	ctx := context.Background()
+	// Don't let the environment change the transport
+	t.Setenv("AWS_CA_BUNDLE", "")
+	fake := &fakeS3{objects: map[string][]byte{}, buckets: map[string]http.Header{"existing": nil}, configs: map[string]string{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	newFs := func(opts, bucket string) (fs.Fs, error) {
+		return fs.NewFs(ctx, fmt.Sprintf(":s3,provider=Other,endpoint='%s',access_key_id=key,secret_access_key=secret,force_path_style%s:%s", srv.URL, opts, bucket))
+	}
+
+	// A bucket is created with the settings
+	f, err := newFs(",location_constraint=eu-west-2,bucket_acl=public-read,bucket_encryption='aws:kms',sse_kms_key_id=my-key,bucket_object_lock_mode=governance,bucket_object_lock_days=30", "new")
+	require.NoError(t, err)
+	require.NoError(t, f.Mkdir(ctx, ""))
+	fake.mu.Lock()
+	require.Contains(t, fake.buckets, "new")
+	assert.Equal(t, "public-read", fake.buckets["new"].Get("X-Amz-Acl"))
+	assert.Equal(t, "true", fake.buckets["new"].Get("X-Amz-Bucket-Object-Lock-Enabled"))
+	assert.Contains(t, fake.configs["new"], "<LocationConstraint>eu-west-2</LocationConstraint>")
+	assert.Contains(t, fake.configs["new?encryption"], "<SSEAlgorithm>aws:kms</SSEAlgorithm>")
+	assert.Contains(t, fake.configs["new?encryption"], "<KMSMasterKeyID>my-key</KMSMasterKeyID>")
+	assert.Contains(t, fake.configs["new?object-lock"], "<ObjectLockEnabled>Enabled</ObjectLockEnabled>")
+	assert.Contains(t, fake.configs["new?object-lock"], "<Mode>GOVERNANCE</Mode>")
+	assert.Contains(t, fake.configs["new?object-lock"], "<Days>30</Days>")
+	assert.NotContains(t, fake.configs, "new?versioning", "object lock enables versioning itself")
+	fake.mu.Unlock()
+
+	// Versioning is enabled if set
+	f, err = newFs(",bucket_versioning", "versioned")
+	require.NoError(t, err)
+	require.NoError(t, f.Mkdir(ctx, ""))
+	fake.mu.Lock()
+	assert.Equal(t, "", fake.buckets["versioned"].Get("X-Amz-Bucket-Object-Lock-Enabled"))
+	assert.Contains(t, fake.configs["versioned?versioning"], "<Status>Enabled</Status>")
+	assert.NotContains(t, fake.configs, "versioned?encryption")
+	fake.mu.Unlock()
+
+	// The settings aren't applied to existing buckets
+	f, err = newFs(",bucket_versioning,bucket_encryption=AES256", "existing")
+	require.NoError(t, err)
+	require.NoError(t, f.Mkdir(ctx, ""))
+	fake.mu.Lock()
+	assert.NotContains(t, fake.configs, "existing?versioning")
+	assert.NotContains(t, fake.configs, "existing?encryption")
+	fake.mu.Unlock()
+
+	// A bucket which can't be configured is removed so it is
+	// created again on the next attempt
+	fake.mu.Lock()
+	fake.failConfigs = 1
+	fake.mu.Unlock()
+	f, err = newFs(",bucket_versioning", "flaky")
+	require.NoError(t, err)
+	err = f.Mkdir(ctx, "")
+	assert.ErrorContains(t, err, "failed to enable versioning")
+	assert.False(t, fserrors.IsFatalError(err))
+	fake.mu.Lock()
+	assert.NotContains(t, fake.buckets, "flaky")
+	fake.mu.Unlock()
+	require.NoError(t, f.Mkdir(ctx, ""))
+	fake.mu.Lock()
+	assert.Contains(t, fake.buckets, "flaky")
+	assert.Contains(t, fake.configs["flaky?versioning"], "<Status>Enabled</Status>")
+	fake.mu.Unlock()
+
+	// If it can't be removed the error is fatal
+	fake.mu.Lock()
+	fake.failConfigs = 1
+	fake.failDeleteBucket = true
+	fake.mu.Unlock()
+	f, err = newFs(",bucket_versioning", "stuck")
+	require.NoError(t, err)
+	err = f.Mkdir(ctx, "")
+	assert.ErrorContains(t, err, "failed to enable versioning")
+	assert.True(t, fserrors.IsFatalError(err))
+	fake.mu.Lock()
+	fake.failDeleteBucket = false
+	fake.mu.Unlock()
+
+	// Buckets aren't created with no_create_bucket
+	f, err = newFs(",no_create_bucket", "missing")
+	require.NoError(t, err)
+	err = f.Mkdir(ctx, "")
+	assert.ErrorContains(t, err, "doesn't exist")
+	fake.mu.Lock()
+	assert.NotContains(t, fake.buckets, "missing")
+	fake.mu.Unlock()
+	f, err = newFs(",no_create_bucket", "existing")
+	require.NoError(t, err)
+	require.NoError(t, f.Mkdir(ctx, ""))
+
+	// The object lock options are checked
+	_, err = newFs(",bucket_object_lock_mode=potato,bucket_object_lock_days=1", "new")
+	assert.ErrorContains(t, err, "bucket_object_lock_mode must be")
+	_, err = newFs(",bucket_object_lock_mode=COMPLIANCE", "new")
+	assert.ErrorContains(t, err, "must be set together")
+	_, err = newFs(",bucket_object_lock_days=7", "new")
+	assert.ErrorContains(t, err, "must be set together")
+}
+
+// testInventorySchema is the schema of the test inventories
+const testInventorySchema = "Bucket, Key, VersionId, IsLatest, IsDeleteMarker, Size, LastModifiedDate, ETag, StorageClass"
+
+// testInventoryCSV is an inventory of a versioned bucket
+const testInventoryCSV = `"bucket","data/file1.txt","v1","true","false","5","2001-02-03T04:05:06.000Z","5a105e8b9d40e1329780d62ea2265d8a","STANDARD"
+"bucket","data/dir/file2.txt","v2","true","false","11","2002-02-03T04:05:06.000Z","b10a8db164e0754105b7a99be72e3fe5","STANDARD_IA"
+"bucket","data/dir/sub/a%2Bb%20c.txt","v3","true","false","3","2003-02-03T04:05:06.000Z","900150983cd24fb0d6963f7d28e17f72","STANDARD"
+"bucket","data/dir/old.txt","v4","false","false","7","2000-02-03T04:05:06.000Z","11111111111111111111111111111111","STANDARD"
+"bucket","data/deleted.txt","v5","true","true","","2004-02-03T04:05:06.000Z","",""
+"bucket","other/file3.txt","v6","true","false","1","2005-02-03T04:05:06.000Z","c4ca4238a0b923820dcc509a6f75849b","STANDARD"
+`
+
+// readInventoryObjects reads all the objects from an inventory file
+func readInventoryObjects(t *testing.T, data, schema string, gzipped bool) (objects []*s3.Object, err error) {
+	ir, err := newInventoryReader(io.NopCloser(strings.NewReader(data)), schema, gzipped)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		require.NoError(t, ir.close())
+	}()
+	for {
+		object, err := ir.next()
+		if err == io.EOF {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, object)
+	}
+}
+
+// testInventoryCSV2 is a second file of the inventory
+const testInventoryCSV2 = `"bucket","data/dir/file5.txt","v7","true","false","2","2006-02-03T04:05:06.000Z","187ef4436122d1cc2f40dc2b92f0eba0","STANDARD"
+"bucket","data/file4.txt","v8","true","false","4","2007-02-03T04:05:06.000Z","e2fc714c4727ee9395f324cd2e7f331f","STANDARD"
+`
+
+func TestInventoryReadCSV(t *testing.T) {
+	inv, err := newInventory(&inventoryManifest{
+		SourceBucket:      "bucket",
+		DestinationBucket: "arn:aws:s3:::inventory-bucket",
+		CreationTimestamp: "981173106000",
+		FileFormat:        "CSV",
+		FileSchema:        testInventorySchema,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "bucket", inv.bucket)
+	assert.Equal(t, "inventory-bucket", inv.dstBucket)
+	assert.Equal(t, testInventorySchema, inv.schema)
+	assert.True(t, fstest.Time("2001-02-03T04:05:06Z").Equal(inv.created), inv.created)
+
+	objects, err := readInventoryObjects(t, gz(t, testInventoryCSV), testInventorySchema, true)
+	require.NoError(t, err)
+	var keys []string
+	for _, object := range objects {
+		keys = append(keys, *object.Key)
+	}
+	assert.Equal(t, []string{"data/file1.txt", "data/dir/file2.txt", "data/dir/sub/a+b c.txt", "other/file3.txt"}, keys)
+	object := objects[1]
+	assert.Equal(t, int64(11), *object.Size)
+	assert.Equal(t, `"b10a8db164e0754105b7a99be72e3fe5"`, *object.ETag)
+	assert.Equal(t, "STANDARD_IA", *object.StorageClass)
+	assert.True(t, fstest.Time("2002-02-03T04:05:06Z").Equal(*object.LastModified))
+
+	// Unversioned inventories don't have IsLatest or IsDeleteMarker
+	objects, err = readInventoryObjects(t, `"bucket","potato","1"`+"\n", "Bucket, Key, Size", false)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(objects))
+	assert.Equal(t, "potato", *objects[0].Key)
+	assert.Equal(t, int64(1), *objects[0].Size)
+
+	_, err = readInventoryObjects(t, `"bucket","potato"`+"\n", "Bucket, Size", false)
+	assert.Error(t, err)
+
+	// Reading can carry on after the records read already
+	ir, err := newInventoryReader(io.NopCloser(strings.NewReader(testInventoryCSV)), testInventorySchema, false)
+	require.NoError(t, err)
+	require.NoError(t, ir.skip(3))
+	object, err = ir.next()
+	require.NoError(t, err)
+	assert.Equal(t, "other/file3.txt", *object.Key)
+	require.NoError(t, ir.close())
+
+	_, err = newInventory(&inventoryManifest{SourceBucket: "bucket", FileFormat: "Parquet"})
+	assert.ErrorContains(t, err, "only CSV")
+}
+
+func TestInventoryList(t *testing.T) {
+	ctx := context.Background()
+	// Don't let the environment change the transport
+	t.Setenv("AWS_CA_BUNDLE", "")
+	fake := &fakeS3{objects: map[string][]byte{
+		"inventory/manifest.json": []byte(`{
+  "sourceBucket": "bucket",
+  "destinationBucket": "arn:aws:s3:::bucket",
+  "version": "2016-11-30",
+  "creationTimestamp": "981173106000",
+  "fileFormat": "CSV",
+  "fileSchema": "` + testInventorySchema + `",
+  "files": [{"key": "inventory/data/1.csv.gz", "size": 1, "MD5checksum": ""}, {"key": "inventory/data/2.csv", "size": 1, "MD5checksum": ""}]
+}`),
+		"inventory/data/1.csv.gz": []byte(gz(t, testInventoryCSV)),
+		"inventory/data/2.csv":    []byte(testInventoryCSV2),
+	}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	// Check with the report read in pages of one object too
+	for _, test := range []struct {
+		encode bool
+		chunk  int
+	}{
+		{false, 1000},
+		{true, 1000},
+		{false, 1},
+	} {
+		t.Run(fmt.Sprintf("list_url_encode=%v,list_chunk=%d", test.encode, test.chunk), func(t *testing.T) {
+			remote := fmt.Sprintf(":s3,provider=Other,endpoint='%s',access_key_id=key,secret_access_key=secret,force_path_style,list_url_encode=%v,list_chunk=%d,inventory='bucket/inventory/manifest.json':bucket/data", srv.URL, test.encode, test.chunk)
+			f, err := fs.NewFs(ctx, remote)
+			require.NoError(t, err)
+
+			// The directory in both files is only listed once
+			entries, err := f.List(ctx, "")
+			require.NoError(t, err)
+			var names []string
+			for _, entry := range entries {
+				names = append(names, fmt.Sprintf("%s %d", entry.Remote(), entry.Size()))
+			}
+			sort.Strings(names)
+			assert.Equal(t, []string{"dir 0", "file1.txt 5", "file4.txt 4"}, names)
+
+			entries, err = f.List(ctx, "dir")
+			require.NoError(t, err)
+			names = nil
+			for _, entry := range entries {
+				names = append(names, fmt.Sprintf("%s %d", entry.Remote(), entry.Size()))
+			}
+			sort.Strings(names)
+			assert.Equal(t, []string{"dir/file2.txt 11", "dir/file5.txt 2", "dir/sub 0"}, names)
+
+			var objects []string
+			err = f.Features().ListR(ctx, "", func(entries fs.DirEntries) error {
+				for _, entry := range entries {
+					if o, ok := entry.(*Object); ok {
+						md5, err := o.Hash(ctx, hash.MD5)
+						require.NoError(t, err)
+						objects = append(objects, o.Remote()+" "+md5)
+					}
+				}
+				return nil
+			})
+			require.NoError(t, err)
+			sort.Strings(objects)
+			assert.Equal(t, []string{
+				"dir/file2.txt b10a8db164e0754105b7a99be72e3fe5",
+				"dir/file5.txt 187ef4436122d1cc2f40dc2b92f0eba0",
+				"dir/sub/a+b c.txt 900150983cd24fb0d6963f7d28e17f72",
+				"file1.txt 5a105e8b9d40e1329780d62ea2265d8a",
+				"file4.txt e2fc714c4727ee9395f324cd2e7f331f",
+			}, objects)
+		})
+	}
+}
+
+func TestInventoryListRetry(t *testing.T) {
+	ctx := context.Background()
+	// Don't let the environment change the transport
+	t.Setenv("AWS_CA_BUNDLE", "")
+	data := []byte(testInventoryCSV)
+	fake := &fakeS3{objects: map[string][]byte{
+		"inventory/manifest.json": []byte(`{
+  "sourceBucket": "bucket",
+  "destinationBucket": "arn:aws:s3:::bucket",
+  "creationTimestamp": "981173106000",
+  "fileFormat": "CSV",
+  "fileSchema": "` + testInventorySchema + `",
+  "files": [{"key": "inventory/data/1.csv"}]
+}`),
+		"inventory/data/1.csv": data,
+	}}
+	// Cut the first read of the file off part way through
+	var reads atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" && r.URL.Path == "/bucket/inventory/data/1.csv" && reads.Add(1) == 1 {
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			_, _ = w.Write(data[:len(data)*2/3])
+			return
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	remote := fmt.Sprintf(":s3,provider=Other,endpoint='%s',access_key_id=key,secret_access_key=secret,force_path_style,list_chunk=1,inventory='bucket/inventory/manifest.json':bucket", srv.URL)
+	f, err := fs.NewFs(ctx, remote)
+	require.NoError(t, err)
+	var objects []string
+	err = f.Features().ListR(ctx, "", func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			objects = append(objects, entry.Remote())
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"data/file1.txt", "data/dir/file2.txt", "data/dir/sub/a+b c.txt", "other/file3.txt"}, objects)
+	assert.Equal(t, int32(2), reads.Load())
+}
+
+// rotatingProvider is a credentials provider whose credentials can be
+// rotated without them being reported as expired
+type rotatingProvider struct {
+	mu        sync.Mutex
+	key       string
+	retrieves int
+}
+
+func (p *rotatingProvider) Retrieve() (credentials.Value, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.retrieves++
+	return credentials.Value{
+		AccessKeyID:     p.key,
+		SecretAccessKey: "secret",
+		ProviderName:    "rotatingProvider",
+	}, nil
+}
+
+func (p *rotatingProvider) IsExpired() bool {
+	return false
+}
+
+func (p *rotatingProvider) rotate(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.key = key
+}
+
+func TestRefreshCredentials(t *testing.T) {
+	ctx := context.Background()
+	// Don't let the environment change the transport
+	t.Setenv("AWS_CA_BUNDLE", "")
+	fake := &fakeS3{objects: map[string][]byte{}, key: "key1"}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	remote := fmt.Sprintf(":s3,provider=Other,endpoint='%s',access_key_id=unused,secret_access_key=secret,force_path_style:bucket", srv.URL)
+	fsrc, err := fs.NewFs(ctx, remote)
+	require.NoError(t, err)
+	f := fsrc.(*Fs)
+	provider := &rotatingProvider{key: "key1"}
+	f.c.Config.Credentials = credentials.NewCredentials(provider)
+
+	put := func(name string) error {
+		src := object.NewMemoryObject(name, time.Now(), []byte(random.String(100)))
+		_, err := operations.Copy(ctx, f, nil, name, src)
+		return err
+	}
+	require.NoError(t, put("file1"))
+	assert.Equal(t, 0, fake.denied)
+
+	// Rotate the credentials without them expiring - the first
+	// attempt fails, then the credentials are refreshed and the
+	// transfer retried
+	provider.rotate("key2")
+	fake.key = "key2"
+	require.NoError(t, put("file2"))
+	assert.Equal(t, 1, fake.denied)
+	assert.Equal(t, 2, provider.retrieves)
+	assert.Equal(t, 2, len(fake.objects))
+
+	// Check other calls are retried too
+	f.credsRefreshed = time.Time{}
+	provider.rotate("key3")
+	fake.key = "key3"
+	fake.denied = 0
+	_, err = f.NewObject(ctx, "file1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, fake.denied)
+	assert.Equal(t, 3, provider.retrieves)
+
+	// If refreshing the credentials doesn't change them then the
+	// auth failure isn't retried
+	f.credsRefreshed = time.Time{}
+	fake.key = "key4"
+	fake.denied = 0
+	err = put("file3")
+	require.Error(t, err)
+	assert.Equal(t, 1, fake.denied)
+	assert.Equal(t, 4, provider.retrieves)
+}
+
+func TestDeleteObjects(t *testing.T) {
+	ctx := context.Background()
+	// Don't let the environment change the transport
+	t.Setenv("AWS_CA_BUNDLE", "")
+	fake := &fakeS3{objects: map[string][]byte{}, locked: map[string]bool{"file3": true}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	remote := fmt.Sprintf(":s3,provider=Other,endpoint='%s',access_key_id=key,secret_access_key=secret,force_path_style:bucket", srv.URL)
+	f, err := fs.NewFs(ctx, remote)
+	require.NoError(t, err)
+	require.NotNil(t, f.Features().DeleteObjects)
+
+	var objs []fs.Object
+	for i := 0; i < maxDeleteObjects+5; i++ {
+		fake.objects[fmt.Sprintf("file%d", i)] = []byte("data")
+		o, err := f.NewObject(ctx, fmt.Sprintf("file%d", i))
+		require.NoError(t, err)
+		objs = append(objs, o)
+	}
+
+	errs := f.Features().DeleteObjects(ctx, objs)
+	require.Equal(t, len(objs), len(errs))
+	for i, err := range errs {
+		if i == 3 {
+			assert.ErrorContains(t, err, "AccessDenied")
+		} else {
+			assert.NoError(t, err, i)
+		}
+	}
+	// The keys should have been deleted in two chunks
+	assert.Equal(t, 2, fake.deletes)
+	assert.Equal(t, map[string][]byte{"file3": []byte("data")}, fake.objects)
+
+	// GCS doesn't support DeleteObjects
+	f, err = fs.NewFs(ctx, strings.Replace(remote, "provider=Other", "provider=GCS", 1))
+	require.NoError(t, err)
+	assert.Nil(t, f.Features().DeleteObjects)
+}
+
+// fakeVersionedS3 is a minimal S3 server with versioning enabled on
+// all its buckets which stores the versions of the objects in memory
+type fakeVersionedS3 struct {
+	mu      sync.Mutex
+	buckets map[string]map[string][]fakeVersion // versions of each key in each bucket, oldest first
+	nextID  int
+}
+
+// fakeVersion is a version of an object in fakeVersionedS3
+type fakeVersion struct {
+	id           string
+	data         string
+	deleteMarker bool
+	modTime      time.Time
+}
+
+// add a version to bucket/key returning it
+func (s *fakeVersionedS3) add(bucketName, key string, data string, deleteMarker bool) fakeVersion {
+	s.nextID++
+	v := fakeVersion{
+		id:           fmt.Sprintf("v%d", s.nextID),
+		data:         data,
+		deleteMarker: deleteMarker,
+		modTime:      time.Date(2001, 2, 3, 4, 5, s.nextID, 0, time.UTC),
+	}
+	if s.buckets[bucketName] == nil {
+		s.buckets[bucketName] = map[string][]fakeVersion{}
+	}
+	s.buckets[bucketName][key] = append(s.buckets[bucketName][key], v)
+	return v
+}
+
+// history returns the history of bucket/key as a list of contents
+// with "-" for a delete marker
+func (s *fakeVersionedS3) history(bucketName, key string) (history []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range s.buckets[bucketName][key] {
+		if v.deleteMarker {
+			history = append(history, "-")
+		} else {
+			history = append(history, v.data)
+		}
+	}
+	return history
+}
+
+func (s *fakeVersionedS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bucketName, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+	switch {
+	case key == "" && r.Method == "GET" && query.Has("versioning"):
+		_, _ = fmt.Fprint(w, "<VersioningConfiguration><Status>Enabled</Status></VersioningConfiguration>")
+	case key == "" && r.Method == "GET" && query.Has("versions"):
+		s.listVersions(w, bucketName, query.Get("prefix"))
+	case key == "":
+		w.WriteHeader(http.StatusNotImplemented)
+	case r.Method == "PUT":
+		copySource := r.Header.Get("X-Amz-Copy-Source")
+		if copySource == "" {
+			data, _ := io.ReadAll(r.Body)
+			s.add(bucketName, key, string(data), false)
+			return
+		}
+		copySource, versionID, _ := strings.Cut(strings.TrimPrefix(copySource, "/"), "?versionId=")
+		copySource, _ = url.PathUnescape(copySource)
+		srcBucket, srcKey, _ := strings.Cut(copySource, "/")
+		for _, v := range s.buckets[srcBucket][srcKey] {
+			if v.id == versionID && !v.deleteMarker {
+				s.add(bucketName, key, v.data, false)
+				_, _ = fmt.Fprint(w, "<CopyObjectResult><LastModified>2001-02-03T04:05:06.000Z</LastModified></CopyObjectResult>")
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == "DELETE" && !query.Has("versionId"):
+		s.add(bucketName, key, "", true)
+		w.Header().Set("X-Amz-Delete-Marker", "true")
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "HEAD" || r.Method == "GET":
+		// Only the versions are read in these tests
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// listVersions lists the versions as a ListObjectVersions response
+func (s *fakeVersionedS3) listVersions(w http.ResponseWriter, bucketName, prefix string) {
+	var keys []string
+	for key := range s.buckets[bucketName] {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	var out strings.Builder
+	for _, key := range keys {
+		versions := s.buckets[bucketName][key]
+		for i := len(versions) - 1; i >= 0; i-- {
+			v := versions[i]
+			isLatest := i == len(versions)-1
+			modTime := v.modTime.Format(time.RFC3339)
+			if v.deleteMarker {
+				_, _ = fmt.Fprintf(&out, "<DeleteMarker><Key>%s</Key><VersionId>%s</VersionId><IsLatest>%v</IsLatest><LastModified>%s</LastModified></DeleteMarker>", key, v.id, isLatest, modTime)
+			} else {
+				_, _ = fmt.Fprintf(&out, "<Version><Key>%s</Key><VersionId>%s</VersionId><IsLatest>%v</IsLatest><LastModified>%s</LastModified><Size>%d</Size></Version>", key, v.id, isLatest, modTime, len(v.data))
+			}
+		}
+	}
+	_, _ = fmt.Fprintf(w, "<ListVersionsResult><IsTruncated>false</IsTruncated>%s</ListVersionsResult>", out.String())
+}
+
+func TestReplicateVersions(t *testing.T) {
+	ctx := context.Background()
+	// Don't let the environment change the transport
+	t.Setenv("AWS_CA_BUNDLE", "")
+	fake := &fakeVersionedS3{buckets: map[string]map[string][]fakeVersion{}}
+	fake.add("src", "dir/file", "one", false)
+	fake.add("src", "dir/file", "two!", false)
+	fake.add("src", "dir/file", "", true)
+	fake.add("src", "dir/file", "three", false)
+	fake.add("src", "dir/gone", "gone", false)
+	fake.add("src", "dir/gone", "", true)
+	fake.add("src", "other", "not replicated", false)
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	remote := func(root string) string {
+		return fmt.Sprintf(":s3,provider=Other,endpoint='%s',access_key_id=key,secret_access_key=secret,force_path_style:%s", srv.URL, root)
+	}
+	f, err := fs.NewFs(ctx, remote("src/dir"))
+	require.NoError(t, err)
+	replicate := func() (*replicateVersionsOut, error) {
+		out, err := f.(*Fs).Command(ctx, "replicate-versions", []string{remote("dst/backup")}, nil)
+		return out.(*replicateVersionsOut), err
+	}
+
+	// Check the history is copied oldest first with the delete markers
+	out, err := replicate()
+	require.NoError(t, err)
+	assert.Equal(t, &replicateVersionsOut{Keys: 2, Versions: 4, DeleteMarkers: 2}, out)
+	assert.Equal(t, []string{"one", "two!", "-", "three"}, fake.history("dst", "backup/file"))
+	assert.Equal(t, []string{"gone", "-"}, fake.history("dst", "backup/gone"))
+	assert.Nil(t, fake.history("dst", "other"))
+	assert.Nil(t, fake.history("dst", "backup/other"))
+
+	// Running again does nothing
+	out, err = replicate()
+	require.NoError(t, err)
+	assert.Equal(t, &replicateVersionsOut{Keys: 2, Skipped: 6}, out)
+
+	// Only new versions are copied
+	fake.mu.Lock()
+	fake.add("src", "dir/gone", "back again", false)
+	fake.mu.Unlock()
+	out, err = replicate()
+	require.NoError(t, err)
+	assert.Equal(t, &replicateVersionsOut{Keys: 2, Versions: 1, Skipped: 6}, out)
+	assert.Equal(t, []string{"gone", "-", "back again"}, fake.history("dst", "backup/gone"))
+
+	// A destination which has diverged isn't changed
+	fake.mu.Lock()
+	fake.add("dst", "backup/file", "", true)
+	fake.add("src", "dir/file", "four", false)
+	fake.mu.Unlock()
+	out, err = replicate()
+	require.Error(t, err)
+	assert.Equal(t, &replicateVersionsOut{Keys: 2, Skipped: 3, Errors: 1}, out)
+	assert.Equal(t, []string{"one", "two!", "-", "three", "-"}, fake.history("dst", "backup/file"))
+}
+
+func TestClockSkew(t *testing.T) {
+	ctx := context.Background()
+	// Don't let the environment change the transport
+	t.Setenv("AWS_CA_BUNDLE", "")
+	fake := &fakeS3{objects: map[string][]byte{"file": []byte("data")}, skew: time.Hour}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	remote := fmt.Sprintf(":s3,provider=Other,endpoint='%s',access_key_id=key,secret_access_key=secret,force_path_style:bucket", srv.URL)
+
+	// The first request is rejected then retried with the corrected time
+	f, err := fs.NewFs(ctx, remote)
+	require.NoError(t, err)
+	_, err = f.NewObject(ctx, "file")
+	require.NoError(t, err)
+	assert.Equal(t, 1, fake.skewed)
+	assert.InDelta(t, float64(time.Hour), float64(f.(*Fs).skew.offset.Load()), float64(2*time.Second))
+
+	// Subsequent requests are signed with the corrected time
+	src := object.NewMemoryObject("file2", time.Now(), []byte("data2"))
+	_, err = f.Put(ctx, bytes.NewBufferString("data2"), src)
+	require.NoError(t, err)
+	entries, err := f.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, 1, fake.skewed)
+
+	// Without fix_clock_skew the error is returned
+	fake.skewed = 0
+	f, err = fs.NewFs(ctx, strings.Replace(remote, ",force_path_style", ",fix_clock_skew=false,force_path_style", 1))
+	require.NoError(t, err)
+	_, err = f.NewObject(ctx, "file")
+	require.Error(t, err)
+	assert.Equal(t, 1, fake.skewed)
+}
+
+func TestWaitVisible(t *testing.T) {
+	ctx := context.Background()
+	// Don't let the environment change the transport
+	t.Setenv("AWS_CA_BUNDLE", "")
+	fake := &fakeS3{objects: map[string][]byte{}, lag: 2}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	newFs := func(opts string) fs.Fs {
+		f, err := fs.NewFs(ctx, fmt.Sprintf(":s3,provider=Other,endpoint='%s',access_key_id=key,secret_access_key=secret,force_path_style%s:bucket", srv.URL, opts))
+		require.NoError(t, err)
+		return f
+	}
+	put := func(f fs.Fs, remote, contents string) (fs.Object, error) {
+		src := object.NewStaticObjectInfo(remote, fstest.Time("2001-02-03T04:05:06Z"), int64(len(contents)), true, nil, nil)
+		return f.Put(ctx, strings.NewReader(contents), src)
+	}
+	heads := func() int {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		n := fake.heads
+		fake.heads = 0
+		return n
+	}
+
+	// Without waiting the object isn't found after the upload
+	_, err := put(newFs(""), "file", "hello")
+	assert.ErrorIs(t, err, fs.ErrorObjectNotFound)
+	heads()
+
+	// Waiting HEADs the object until it is visible
+	f := newFs(",wait_visible=10s")
+	o, err := put(f, "file2", "hello")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), o.Size())
+	assert.Equal(t, 3, heads())
+
+	// An overwritten object is waited for until the new version is seen
+	o, err = put(f, "file2", "hello world")
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), o.Size())
+	assert.Equal(t, 3, heads())
+
+	// Copies are waited for too
+	do := f.Features().Copy
+	o, err = do(ctx, o, "copy")
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), o.Size())
+	assert.Equal(t, 3, heads())
+
+	// Copying over an object waits until the new version is seen
+	src, err := put(f, "file4", "new contents")
+	require.NoError(t, err)
+	heads()
+	o, err = do(ctx, src, "copy")
+	require.NoError(t, err)
+	assert.Equal(t, int64(12), o.Size())
+	assert.Equal(t, 3, heads())
+
+	// An error is returned if the object isn't visible in time
+	fake.mu.Lock()
+	fake.lag = 100
+	fake.mu.Unlock()
+	_, err = put(newFs(",wait_visible=1ms"), "file3", "hello")
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "not visible after --s3-wait-visible")
+	assert.ErrorIs(t, err, fs.ErrorObjectNotFound)
+}
+
+func TestPreserveEncryption(t *testing.T) {
+	ctx := context.Background()
+	// Don't let the environment change the transport
+	t.Setenv("AWS_CA_BUNDLE", "")
+	fake := &fakeS3{objects: map[string][]byte{}, headers: map[string]http.Header{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	newFs := func(opts string) fs.Fs {
+		f, err := fs.NewFs(ctx, fmt.Sprintf(":s3,provider=Other,endpoint='%s',access_key_id=key,secret_access_key=secret,force_path_style%s:bucket", srv.URL, opts))
+		require.NoError(t, err)
+		return f
+	}
+	const keyID = "arn:aws:kms:us-east-1:111122223333:key/1234abcd"
+	put := func(f fs.Fs, remote string) fs.Object {
+		const contents = "hello world"
+		src := object.NewStaticObjectInfo(remote, fstest.Time("2001-02-03T04:05:06Z"), int64(len(contents)), true, nil, nil)
+		o, err := f.Put(ctx, strings.NewReader(contents), src)
+		require.NoError(t, err)
+		return o
+	}
+	// encryption returns the SSE algorithm and KMS key of remote
+	encryption := func(remote string) (sse, kmsKeyID string) {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		header := fake.headers[remote]
+		return header.Get("X-Amz-Server-Side-Encryption"), header.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id")
+	}
+	sources := []struct {
+		remote   string
+		sse      string
+		kmsKeyID string
+	}{
+		{remote: "kms", sse: "aws:kms", kmsKeyID: keyID},
+		{remote: "aes", sse: "AES256"},
+		{remote: "none"},
+	}
+	srcs := map[string]fs.Object{}
+	for _, src := range sources {
+		opts := ""
+		if src.sse != "" {
+			opts = fmt.Sprintf(",server_side_encryption='%s',sse_kms_key_id='%s'", src.sse, src.kmsKeyID)
+		}
+		o := put(newFs(opts), "src/"+src.remote)
+		// Read the source fresh so the encryption must be read with a HEAD
+		o, err := newFs("").NewObject(ctx, o.Remote())
+		require.NoError(t, err)
+		srcs[src.remote] = o
+	}
+
+	for _, test := range []struct {
+		name     string
+		opts     string
+		preserve bool // whether the encryption should be preserved
+		kms      bool // whether the KMS encryption should be preserved
+	}{
+		{name: "default", opts: ""},
+		{name: "preserve", opts: ",preserve_encryption,region=us-east-1", preserve: true, kms: true},
+		{name: "other-region", opts: ",preserve_encryption,region=eu-west-2", preserve: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			f := newFs(test.opts)
+			for _, src := range sources {
+				wantSSE, wantKMSKeyID := "", ""
+				if test.preserve && (src.kmsKeyID == "" || test.kms) {
+					wantSSE, wantKMSKeyID = src.sse, src.kmsKeyID
+				}
+
+				// Server-side copy
+				dst := "copy/" + test.name + "/" + src.remote
+				_, err := f.Features().Copy(ctx, srcs[src.remote], dst)
+				require.NoError(t, err)
+				sse, kmsKeyID := encryption(dst)
+				assert.Equal(t, wantSSE, sse, dst)
+				assert.Equal(t, wantKMSKeyID, kmsKeyID, dst)
+
+				// Upload
+				dst = "upload/" + test.name + "/" + src.remote
+				in, err := srcs[src.remote].Open(ctx)
+				require.NoError(t, err)
+				_, err = f.Put(ctx, in, fs.NewOverrideRemote(srcs[src.remote], dst))
+				require.NoError(t, err)
+				require.NoError(t, in.Close())
+				sse, kmsKeyID = encryption(dst)
+				assert.Equal(t, wantSSE, sse, dst)
+				assert.Equal(t, wantKMSKeyID, kmsKeyID, dst)
+			}
+		})
+	}
+}
+
+func TestKMSKeyRegion(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want string
+	}{
+		{in: "arn:aws:kms:us-east-1:111122223333:key/1234abcd", want: "us-east-1"},
+		{in: "arn:aws:kms:eu-west-2:111122223333:alias/my-key", want: "eu-west-2"},
+		{in: "1234abcd-12ab-34cd-56ef-1234567890ab"},
+		{in: "arn:aws:s3:::bucket/key"},
+		{in: ""},
+	} {
+		assert.Equal(t, test.want, kmsKeyRegion(test.in), test.in)
+	}
+}
+
+func TestMultipartCompleteRetries(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	ci.LowLevelRetries = 1
+	// Don't let the environment change the transport
+	t.Setenv("AWS_CA_BUNDLE", "")
+	oldSleep := completeRetrySleep
+	completeRetrySleep = time.Millisecond
+	defer func() { completeRetrySleep = oldSleep }()
+	fake := &fakeS3{objects: map[string][]byte{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	contents := random.String(6 * 1024 * 1024)
+
+	for _, test := range []struct {
+		name    string
+		retries int
+		failing int  // number of completions which fail
+		lost    bool // whether the failing completions complete the upload
+		wantErr bool
+	}{
+		{name: "retried", retries: 3, failing: 5},
+		{name: "exhausted", retries: 1, failing: 100, wantErr: true},
+		{name: "no-retries", retries: 0, failing: 5, wantErr: true},
+		{name: "lost-response", retries: 0, failing: 1, lost: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := fs.NewFs(ctx, fmt.Sprintf(":s3,provider=Other,endpoint='%s',access_key_id=key,secret_access_key=secret,force_path_style,chunk_size=5Mi,upload_cutoff=5Mi,multipart_complete_retries=%d:bucket", srv.URL, test.retries))
+			require.NoError(t, err)
+			fake.mu.Lock()
+			fake.parts = 0
+			fake.failing = test.failing
+			fake.lost = test.lost
+			fake.mu.Unlock()
+
+			src := object.NewStaticObjectInfo(test.name, fstest.Time("2001-02-03T04:05:06Z"), int64(len(contents)), true, nil, nil)
+			_, err = f.Put(ctx, strings.NewReader(contents), src)
+
+			fake.mu.Lock()
+			defer fake.mu.Unlock()
+			assert.Equal(t, 2, fake.parts, "parts shouldn't be uploaded again")
+			assert.Empty(t, fake.uploads, "upload should be completed or aborted")
+			if test.wantErr {
+				assert.ErrorContains(t, err, "failed to complete multipart upload")
+				assert.NotContains(t, fake.objects, test.name)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, contents, string(fake.objects[test.name]))
+		})
+	}
+}
+
+func TestMultipartCompleteConcurrency(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	ci.Transfers = 8
+	// Don't let the environment change the transport
+	t.Setenv("AWS_CA_BUNDLE", "")
+	fake := &fakeS3{objects: map[string][]byte{}}
+	// Count the completions in progress at once, making each take
+	// a while so they overlap if they aren't limited
+	var (
+		mu       sync.Mutex
+		inFlight int
+		maxIn    int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" && r.URL.Query().Has("uploadId") {
+			mu.Lock()
+			inFlight++
+			if inFlight > maxIn {
+				maxIn = inFlight
+			}
+			mu.Unlock()
+			time.Sleep(50 * time.Millisecond)
+			defer func() {
+				mu.Lock()
+				inFlight--
+				mu.Unlock()
+			}()
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	contents := random.String(6 * 1024 * 1024)
+	const uploads = 8
+
+	for _, test := range []struct {
+		concurrency int
+		wantMax     int
+	}{
+		{concurrency: 2, wantMax: 2},
+		{concurrency: 1, wantMax: 1},
+		{concurrency: 0, wantMax: uploads},
+	} {
+		t.Run(fmt.Sprint(test.concurrency), func(t *testing.T) {
+			f, err := fs.NewFs(ctx, fmt.Sprintf(":s3,provider=Other,endpoint='%s',access_key_id=key,secret_access_key=secret,force_path_style,chunk_size=5Mi,upload_cutoff=5Mi,multipart_complete_concurrency=%d:bucket", srv.URL, test.concurrency))
+			require.NoError(t, err)
+			mu.Lock()
+			maxIn = 0
+			mu.Unlock()
+
+			// Start the uploads together so they all complete at once
+			var wg sync.WaitGroup
+			start := make(chan struct{})
+			errs := make([]error, uploads)
+			for i := 0; i < uploads; i++ {
+				i := i
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					<-start
+					remote := fmt.Sprintf("file%d-%d", test.concurrency, i)
+					src := object.NewStaticObjectInfo(remote, fstest.Time("2001-02-03T04:05:06Z"), int64(len(contents)), true, nil, nil)
+					_, errs[i] = f.Put(ctx, strings.NewReader(contents), src)
+				}()
+			}
+			close(start)
+			wg.Wait()
+			for _, err := range errs {
+				require.NoError(t, err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			assert.LessOrEqual(t, maxIn, test.wantMax)
+			assert.Greater(t, maxIn, 0)
+			fake.mu.Lock()
+			defer fake.mu.Unlock()
+			assert.Empty(t, fake.uploads)
+			for i := 0; i < uploads; i++ {
+				assert.Equal(t, contents, string(fake.objects[fmt.Sprintf("file%d-%d", test.concurrency, i)]))
+			}
+		})
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	// Don't let the environment change the transport
+	t.Setenv("AWS_CA_BUNDLE", "")
+	fake := &fakeS3{objects: map[string][]byte{}, headers: map[string]http.Header{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	newFs := func(opts string) fs.Fs {
+		f, err := fs.NewFs(ctx, fmt.Sprintf(":s3,provider=Other,endpoint='%s',access_key_id=key,secret_access_key=secret,force_path_style%s:bucket", srv.URL, opts))
+		require.NoError(t, err)
+		return f
+	}
+	original := random.String(1000)
+	contents := gz(t, original)
+
+	// Upload a gzip encoded object
+	f := newFs("")
+	src := object.NewStaticObjectInfo("file.txt", fstest.Time("2001-02-03T04:05:06Z"), int64(len(contents)), true, nil, nil)
+	_, err := f.Put(ctx, strings.NewReader(contents), src, &fs.HTTPOption{Key: "Content-Encoding", Value: "gzip"})
+	require.NoError(t, err)
+
+	// Without decompression the compressed data is read
+	o, err := f.NewObject(ctx, "file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(contents)), o.Size())
+	assert.Equal(t, contents, fstests.ReadObject(ctx, t, o, -1))
+	metadata, err := o.(fs.Metadataer).Metadata(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "gzip", metadata["content-encoding"])
+
+	// With decompression the size and hash are unknown, the
+	// decompressed data is read and the encoding isn't passed on
+	fsrc := newFs(",decompress")
+	o, err = fsrc.NewObject(ctx, "file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), o.Size())
+	md5sum, err := o.Hash(ctx, hash.MD5)
+	require.NoError(t, err)
+	assert.Equal(t, "", md5sum)
+	assert.Equal(t, original, fstests.ReadObject(ctx, t, o, -1))
+	metadata, err = o.(fs.Metadataer).Metadata(ctx)
+	require.NoError(t, err)
+	assert.NotContains(t, metadata, "content-encoding")
+
+	// Copying it stores the decompressed data without the
+	// encoding even when copying the metadata
+	ci.Metadata = true
+	fdst := newFs(",decompress,list_chunk=100")
+	newDst, err := operations.Copy(ctx, fdst, nil, "copy.txt", o)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(original)), newDst.Size())
+	assert.Equal(t, original, fstests.ReadObject(ctx, t, newDst, -1))
+	fake.mu.Lock()
+	assert.Equal(t, original, string(fake.objects["copy.txt"]))
+	assert.NotContains(t, fake.headers["copy.txt"], "Content-Encoding")
+	fake.mu.Unlock()
+}
+
+func TestDeleteIfUnchanged(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	// Don't let the environment change the transport
+	t.Setenv("AWS_CA_BUNDLE", "")
+	fake := &fakeS3{objects: map[string][]byte{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	f, err := fs.NewFs(ctx, fmt.Sprintf(":s3,provider=Other,endpoint='%s',access_key_id=key,secret_access_key=secret,force_path_style:bucket", srv.URL))
+	require.NoError(t, err)
+	put := func(remote, contents string) {
+		src := object.NewStaticObjectInfo(remote, fstest.Time("2001-02-03T04:05:06Z"), int64(len(contents)), true, nil, nil)
+		_, err := f.Put(ctx, strings.NewReader(contents), src)
+		require.NoError(t, err)
+	}
+	exists := func(remote string) bool {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		_, found := fake.objects[remote]
+		return found
+	}
+	put("changed.txt", "original contents")
+	put("unchanged.txt", "original contents")
+	entries, err := f.List(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	// Replace one of the objects after listing it
+	put("changed.txt", "new contents")
+
+	ci.DeleteIfUnchanged = true
+	for _, entry := range entries {
+		require.NoError(t, operations.DeleteFile(ctx, entry.(fs.Object)))
+	}
+	assert.True(t, exists("changed.txt"), "changed object should not be deleted")
+	assert.False(t, exists("unchanged.txt"), "unchanged object should be deleted")
+
+	// The object is reported as changed
+	o := entries[0].(*Object)
+	require.Equal(t, "changed.txt", o.Remote())
+	assert.ErrorIs(t, o.RemoveIfUnchanged(ctx), fs.ErrorObjectChanged)
+
+	// Deleting an object which has gone already isn't an error
+	o = entries[1].(*Object)
+	require.Equal(t, "unchanged.txt", o.Remote())
+	assert.NoError(t, o.RemoveIfUnchanged(ctx))
+}
+
+// fakeEndpoint is an endpoint for fakeS3 which can be taken down
+type fakeEndpoint struct {
+	fake     *fakeS3
+	down     atomic.Bool  // if set requests fail with a server error
+	requests atomic.Int64 // number of signed requests received
+	probes   atomic.Int64 // number of unsigned probes received
+}
+
+func (e *fakeEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") == "" {
+		e.probes.Add(1)
+	} else {
+		e.requests.Add(1)
+	}
+	if e.down.Load() {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = fmt.Fprint(w, "<Error><Code>InternalError</Code><Message>We encountered an internal error. Please try again.</Message></Error>")
+		return
+	}
+	e.fake.ServeHTTP(w, r)
+}
+
+func TestEndpointFailover(t *testing.T) {
+	ctx := context.Background()
+	// Don't let the environment change the transport
+	t.Setenv("AWS_CA_BUNDLE", "")
+	fake := &fakeS3{objects: map[string][]byte{"file": []byte("hello")}}
+	primary := &fakeEndpoint{fake: fake}
+	secondary := &fakeEndpoint{fake: fake}
+	primarySrv := httptest.NewServer(primary)
+	defer primarySrv.Close()
+	secondarySrv := httptest.NewServer(secondary)
+	defer secondarySrv.Close()
+	f, err := fs.NewFs(ctx, fmt.Sprintf(":s3,provider=Other,endpoint='%s',failover_endpoints='%s',failover_threshold=2,failover_probe_interval=10ms,access_key_id=key,secret_access_key=secret,force_path_style:bucket", primarySrv.URL, secondarySrv.URL))
+	require.NoError(t, err)
+	check := func() {
+		o, err := f.NewObject(ctx, "file")
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), o.Size())
+	}
+	reset := func() (primaryRequests, secondaryRequests int64) {
+		return primary.requests.Swap(0), secondary.requests.Swap(0)
+	}
+
+	// Requests go to the primary endpoint while it is up
+	check()
+	p, s := reset()
+	assert.Equal(t, int64(1), p)
+	assert.Equal(t, int64(0), s)
+
+	// When it goes down the request fails over to the secondary
+	primary.down.Store(true)
+	check()
+	p, s = reset()
+	assert.Equal(t, int64(2), p, "should fail over after failover_threshold failures")
+	assert.Equal(t, int64(1), s)
+
+	// Further requests go to the secondary - the primary only gets probes
+	check()
+	check()
+	p, s = reset()
+	assert.Equal(t, int64(0), p)
+	assert.Equal(t, int64(2), s)
+
+	// When the primary recovers the probe finds it and requests go
+	// there again
+	assert.Greater(t, primary.probes.Load(), int64(0))
+	primary.down.Store(false)
+	assert.Eventually(t, func() bool {
+		check()
+		p, s := reset()
+		return p == 1 && s == 0
+	}, 5*time.Second, 20*time.Millisecond)
+
+	// The failover needs an endpoint
+	_, err = fs.NewFs(ctx, ":s3,provider=Other,failover_endpoints=http://127.0.0.1:1,access_key_id=key,secret_access_key=secret:bucket")
+	assert.ErrorContains(t, err, "endpoint must be set to use failover_endpoints")
+}
+
+func TestLegalHold(t *testing.T) {
+	ctx := context.Background()
+	// Don't let the environment change the transport
+	t.Setenv("AWS_CA_BUNDLE", "")
+	fake := &fakeS3{objects: map[string][]byte{}, holds: map[string]string{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	remote := fmt.Sprintf(":s3,provider=Other,endpoint='%s',access_key_id=key,secret_access_key=secret,force_path_style,list_version=1", srv.URL)
+	f, err := fs.NewFs(ctx, remote+":bucket")
+	require.NoError(t, err)
+	mailFs, err := fs.NewFs(ctx, remote+":bucket/mail")
+	require.NoError(t, err)
+	for _, key := range []string{"mail/1.eml", "mail/2.eml", "mail/3.txt", "other.eml"} {
+		fake.objects[key] = []byte(key)
+	}
+
+	legalHold := func(ctx context.Context, f fs.Fs, opt map[string]string) []legalHoldStatusOut {
+		out, err := f.Features().Command(ctx, "legal-hold", nil, opt)
+		require.NoError(t, err)
+		statuses := out.([]legalHoldStatusOut)
+		sort.Slice(statuses, func(i, j int) bool { return statuses[i].Remote < statuses[j].Remote })
+		return statuses
+	}
+	holds := func() map[string]string {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		holds := map[string]string{}
+		for k, v := range fake.holds {
+			holds[k] = v
+		}
+		return holds
+	}
+
+	// Objects start without legal holds
+	assert.Equal(t, []legalHoldStatusOut{
+		{Status: "OK", Remote: "1.eml", LegalHold: "OFF"},
+		{Status: "OK", Remote: "2.eml", LegalHold: "OFF"},
+		{Status: "OK", Remote: "3.txt", LegalHold: "OFF"},
+	}, legalHold(ctx, mailFs, nil))
+
+	// Apply legal holds to the objects matching the filter
+	fi, err := filter.NewFilter(nil)
+	require.NoError(t, err)
+	require.NoError(t, fi.AddRule("+ *.eml"))
+	require.NoError(t, fi.AddRule("- *"))
+	filterCtx := filter.ReplaceConfig(ctx, fi)
+	assert.Equal(t, []legalHoldStatusOut{
+		{Status: "OK", Remote: "mail/1.eml", LegalHold: "ON"},
+		{Status: "OK", Remote: "mail/2.eml", LegalHold: "ON"},
+		{Status: "OK", Remote: "other.eml", LegalHold: "ON"},
+	}, legalHold(filterCtx, f, map[string]string{"status": "on", "concurrency": "2"}))
+	assert.Equal(t, map[string]string{"mail/1.eml": "ON", "mail/2.eml": "ON", "other.eml": "ON"}, holds())
+
+	// Reading reports the holds
+	assert.Equal(t, []legalHoldStatusOut{
+		{Status: "OK", Remote: "mail/1.eml", LegalHold: "ON"},
+		{Status: "OK", Remote: "mail/2.eml", LegalHold: "ON"},
+		{Status: "OK", Remote: "mail/3.txt", LegalHold: "OFF"},
+		{Status: "OK", Remote: "other.eml", LegalHold: "ON"},
+	}, legalHold(ctx, f, nil))
+
+	// Dry run doesn't release the holds
+	dryCtx, ci := fs.AddConfig(ctx)
+	ci.DryRun = true
+	legalHold(dryCtx, f, map[string]string{"status": "OFF"})
+	assert.Equal(t, map[string]string{"mail/1.eml": "ON", "mail/2.eml": "ON", "other.eml": "ON"}, holds())
+
+	// Release the holds in a directory
+	assert.Equal(t, []legalHoldStatusOut{
+		{Status: "OK", Remote: "1.eml", LegalHold: "OFF"},
+		{Status: "OK", Remote: "2.eml", LegalHold: "OFF"},
+		{Status: "OK", Remote: "3.txt", LegalHold: "OFF"},
+	}, legalHold(ctx, mailFs, map[string]string{"status": "OFF"}))
+	assert.Equal(t, map[string]string{"mail/1.eml": "OFF", "mail/2.eml": "OFF", "mail/3.txt": "OFF", "other.eml": "ON"}, holds())
+
+	// Bad options are errors
+	_, err = f.Features().Command(ctx, "legal-hold", nil, map[string]string{"status": "maybe"})
+	assert.ErrorContains(t, err, `legal hold status must be ON or OFF not "maybe"`)
+	_, err = f.Features().Command(ctx, "legal-hold", nil, map[string]string{"concurrency": "0"})
+	assert.ErrorContains(t, err, `bad concurrency "0"`)
+
+	// A bucket without object lock enabled is an error
+	fake.mu.Lock()
+	fake.holds = nil
+	fake.mu.Unlock()
+	_, err = f.Features().Command(ctx, "legal-hold", nil, map[string]string{"status": "ON"})
+	assert.ErrorContains(t, err, `bucket "bucket" doesn't have object lock enabled`)
+}
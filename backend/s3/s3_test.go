@@ -54,7 +54,7 @@ func TestAWSDualStackOption(t *testing.T) {
 		// test enabled
 		ctx, opt, client := SetupS3Test(t)
 		opt.UseDualStack = true
-		s3Conn, _, _ := s3Connection(ctx, opt, client)
+		s3Conn, _, _ := s3Connection(ctx, opt, client, nil, nil)
 		if !strings.Contains(s3Conn.Endpoint, "dualstack") {
 			t.Errorf("dualstack failed got: %s, wanted: dualstack", s3Conn.Endpoint)
 			t.Fail()
@@ -63,7 +63,7 @@ func TestAWSDualStackOption(t *testing.T) {
 	{
 		// test default case
 		ctx, opt, client := SetupS3Test(t)
-		s3Conn, _, _ := s3Connection(ctx, opt, client)
+		s3Conn, _, _ := s3Connection(ctx, opt, client, nil, nil)
 		if strings.Contains(s3Conn.Endpoint, "dualstack") {
 			t.Errorf("dualstack failed got: %s, NOT wanted: dualstack", s3Conn.Endpoint)
 			t.Fail()
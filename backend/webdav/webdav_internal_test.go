@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 
@@ -80,3 +83,74 @@ func TestHeaders(t *testing.T) {
 	_, err := f.Features().About(context.Background())
 	require.NoError(t, err)
 }
+
+// TestSecretCommand checks the credentials can be read from the
+// secret_command
+func TestSecretCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses a shell script")
+	}
+	ctx := context.Background()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "alice" || pass != "open sesame" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprint(w, `<d:multistatus xmlns:d="DAV:">
+<d:response>
+ <d:href>/</d:href>
+ <d:propstat>
+  <d:prop>
+   <d:quota-available-bytes>-3</d:quota-available-bytes>
+   <d:quota-used-bytes>1234</d:quota-used-bytes>
+  </d:prop>
+  <d:status>HTTP/1.1 200 OK</d:status>
+ </d:propstat>
+</d:response>
+</d:multistatus>`)
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+	configfile.Install()
+
+	// The command prints the secret asked for recording each call
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	script := filepath.Join(dir, "secret.sh")
+	require.NoError(t, os.WriteFile(script, []byte(`#!/bin/sh
+echo "$RCLONE_SECRET_REMOTE $1" >> "`+calls+`"
+case "$1" in
+  user) echo "alice" ;;
+  pass) echo "open sesame" ;;
+esac
+`), 0700))
+
+	const name = "TestWebDAVSecret"
+	t.Setenv("RCLONE_CONFIG_TESTWEBDAVSECRET_TYPE", "webdav")
+	t.Setenv("RCLONE_CONFIG_TESTWEBDAVSECRET_URL", ts.URL)
+
+	// Without the command the server refuses the requests
+	f, err := fs.NewFs(ctx, name+":")
+	require.NoError(t, err)
+	_, err = f.Features().About(ctx)
+	require.Error(t, err)
+
+	// With the command the user and pass are read from it
+	t.Setenv("RCLONE_CONFIG_TESTWEBDAVSECRET_SECRET_COMMAND", script)
+	for i := 0; i < 2; i++ {
+		f, err = fs.NewFs(ctx, name+":")
+		require.NoError(t, err)
+		usage, err := f.Features().About(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1234), *usage.Used)
+	}
+
+	// The command was run once for each secret
+	data, err := os.ReadFile(calls)
+	require.NoError(t, err)
+	for _, secret := range []string{"user", "pass", "bearer_token"} {
+		assert.Equal(t, 1, strings.Count(string(data), name+" "+secret+"\n"), secret)
+	}
+}
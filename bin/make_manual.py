@@ -34,11 +34,13 @@ docs = [
     "b2.md",
     "box.md",
     "cache.md",
+    "cas.md",
     "chunker.md",
     "sharefile.md",
     "crypt.md",
     "compress.md",
     "combine.md",
+    "dedup.md",
     "dropbox.md",
     "filefabric.md",
     "ftp.md",
@@ -57,12 +59,14 @@ docs = [
     "mailru.md",
     "mega.md",
     "memory.md",
+    "mirror.md",
     "netstorage.md",
     "azureblob.md",
     "azurefiles.md",
     "onedrive.md",
     "opendrive.md",
     "oracleobjectstorage.md",
+    "pack.md",
     "qingstor.md",
     "quatrix.md",
     "sia.md",
@@ -105,20 +105,49 @@ var configPathsCommand = &cobra.Command{
 	},
 }
 
+var showResolved bool
+
+func init() {
+	flags.BoolVarP(configShowCommand.Flags(), &showResolved, "resolved", "", false, "Show the values in use for all the options of the remote and where they came from", "")
+}
+
 var configShowCommand = &cobra.Command{
 	Use:   "show [<remote>]",
 	Short: `Print (decrypted) config file, or the config for a single remote.`,
+	Long: `Print the (decrypted) config file, or the config for a single remote
+as stored in the config file.
+
+Use the ` + "`--resolved`" + ` flag with a remote to show the values rclone will
+use for all of the options of the remote instead. These are made by
+applying, in order, the defaults, the config file, the environment
+variables and the command line flags and finally the options of any
+connection string, each overriding the ones before. The options are
+shown in that order, along with where the value of each came from and
+which other values it overrode, for example
+
+    rclone config show --resolved "s3remote,region=eu-west-1:"
+
+Passwords and other sensitive values are redacted by replacing them
+with XXX.
+`,
 	Annotations: map[string]string{
 		"versionIntroduced": "v1.38",
 	},
-	Run: func(command *cobra.Command, args []string) {
+	RunE: func(command *cobra.Command, args []string) error {
 		cmd.CheckArgs(0, 1, command, args)
+		if showResolved {
+			if len(args) == 0 {
+				return errors.New("a remote must be given with --resolved")
+			}
+			return config.ShowResolvedRemote(strings.TrimRight(args[0], ":"))
+		}
 		if len(args) == 0 {
 			config.ShowConfig()
 		} else {
 			name := strings.TrimRight(args[0], ":")
 			config.ShowRemote(name)
 		}
+		return nil
 	},
 }
 
@@ -0,0 +1,103 @@
+// Package costestimate provides the costestimate command.
+package costestimate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/spf13/cobra"
+)
+
+var (
+	priceFile  string
+	jsonOutput bool
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+	cmdFlags := commandDefinition.Flags()
+	flags.StringVarP(cmdFlags, &priceFile, "price-file", "", "", "JSON file of prices per GiB per month for each storage class", "")
+	flags.BoolVarP(cmdFlags, &jsonOutput, "json", "", false, "Format output as JSON", "")
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "costestimate remote:path --price-file prices.json",
+	Short: `Estimate the monthly cost of storing the objects in remote:path.`,
+	Long: `
+Lists the objects in the path, sums their sizes by storage class and
+multiplies each total by the price of that storage class to estimate
+the monthly storage cost. Prints a breakdown by storage class and the
+total to standard output.
+
+The prices are read from the JSON file given with ` + "`--price-file`" + `
+which maps each storage class to the price per GiB per month, for
+example
+
+    {
+        "STANDARD": 0.023,
+        "STANDARD_IA": 0.0125,
+        "GLACIER": 0.0036,
+        "default": 0.023
+    }
+
+The storage classes are the ones reported in the listing, the same as
+shown by ` + "`rclone lsjson`" + ` in the ` + "`Tier`" + ` field. Objects
+on backends without storage classes are counted as the ` + "`default`" + `
+class. The ` + "`default`" + ` price is also used for any storage class
+which isn't in the price file. If there isn't a ` + "`default`" + ` price
+then a storage class without a price is an error.
+
+    rclone costestimate --price-file prices.json s3:bucket/path
+
+Use ` + "`--json`" + ` to format the output as JSON instead.
+
+This only estimates the cost of storage. It doesn't include the cost
+of requests, retrieval, data transfer or minimum storage durations, so
+check your provider's pricing for those.
+
+Recurses by default, use ` + "`--max-depth 1`" + ` to stop the
+recursion. Filters can be used to estimate the cost of some of the
+objects only.
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.67",
+		"groups":            "Filter,Listing",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		fsrc := cmd.NewFsSrc(args)
+		cmd.Run(false, false, command, func() error {
+			if priceFile == "" {
+				return errors.New("--price-file must be set")
+			}
+			prices, err := operations.ReadStoragePrices(priceFile)
+			if err != nil {
+				return err
+			}
+			estimate, err := operations.EstimateCost(context.Background(), fsrc, prices)
+			if err != nil {
+				return err
+			}
+			if estimate.Sizeless > 0 {
+				fs.Logf(fsrc, "Cost may be underestimated due to %d objects with unknown size", estimate.Sizeless)
+			}
+			if jsonOutput {
+				return json.NewEncoder(os.Stdout).Encode(estimate)
+			}
+			for _, c := range estimate.Classes {
+				fmt.Printf("%s: %d objects, %s (%d Byte) at %g per GiB = %.4f per month\n", c.Class, c.Count, fs.SizeSuffix(c.Bytes).ByteUnit(), c.Bytes, c.Price, c.Cost)
+			}
+			fmt.Printf("Total objects: %d\n", estimate.Count)
+			fmt.Printf("Total size: %s (%d Byte)\n", fs.SizeSuffix(estimate.Bytes).ByteUnit(), estimate.Bytes)
+			fmt.Printf("Total cost: %.4f per month\n", estimate.Cost)
+			return nil
+		})
+	},
+}
@@ -0,0 +1,54 @@
+// Package flushqueue provides the flush-queue command.
+package flushqueue
+
+import (
+	"context"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "flush-queue file",
+	Short: `Do the operations recorded in a queue with --queue.`,
+	Long: `
+When rclone is run with ` + "`--queue file`" + ` it doesn't copy, move or
+delete any files or make or remove any directories. Instead it records
+each of these operations in the queue file. For example
+
+    rclone sync --queue /path/to/queue.json /path/to/src remote:dst
+
+This command does the operations recorded in the queue, in the order
+they were recorded. It can be used to plan operations while
+connectivity is poor and do them when it returns.
+
+    rclone flush-queue /path/to/queue.json
+
+Each operation is marked as done in the queue when it succeeds, so
+running the command again only does the operations which failed. The
+operations are safe to repeat - files which have already been copied
+are skipped and files which have already been deleted are ignored.
+
+Note that the planning is done when ` + "`--queue`" + ` is used, so the
+remotes still need to be listed then. Operations other than those
+above, like setting directory modification times, are skipped when
+` + "`--queue`" + ` is used.
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.67",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		cmd.Run(true, true, command, func() error {
+			done, err := operations.FlushQueue(context.Background(), args[0])
+			fs.Logf(nil, "Done %d queued operations", done)
+			return err
+		})
+	},
+}
@@ -0,0 +1,87 @@
+// Package fsck provides the fsck command.
+package fsck
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/spf13/cobra"
+)
+
+var (
+	opt = operations.FsckOpt{}
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+	cmdFlags := commandDefinition.Flags()
+	flags.BoolVarP(cmdFlags, &opt.Repair, "repair", "", opt.Repair, "Repair the issues which can be repaired automatically", "")
+	flags.BoolVarP(cmdFlags, &opt.EmptyDirs, "empty-dirs", "", opt.EmptyDirs, "Report empty directory markers as orphaned, removing them with --repair", "")
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "fsck remote:path",
+	Short: `Check the directory structure of the remote for inconsistencies.`,
+	Long: `
+Object stores don't have real directories, so buckets written to by
+different tools can end up with a directory structure which gives
+confusing listings. This scans the path for these issues and reports
+them.
+
+On remotes which keep directory markers (for example s3 with
+` + "`--s3-directory-markers`" + `) it finds
+
+- missing markers - directories with files in which don't have a marker
+- orphaned markers - directory markers with no files under them, only if ` + "`--empty-dirs`" + ` is used
+
+Empty directories are allowed on these remotes, so directory markers
+with nothing under them are only reported if ` + "`--empty-dirs`" + `
+is used, for when they are left over from files which have been
+deleted rather than made on purpose.
+
+On all remotes it finds
+
+- case collisions - names in the same directory which only differ in case
+- file/directory collisions - a file with the same name as a directory
+
+Each issue is logged as an error. If ` + "`--repair`" + ` is used then
+missing markers are created, and orphaned markers are removed if
+` + "`--empty-dirs`" + ` is used too.
+Collisions are only reported as they need a decision about which
+entry to rename, which can be done with [moveto](/commands/rclone_moveto/).
+
+Use ` + "`--dry-run`" + ` with ` + "`--repair`" + ` to see what would
+be repaired.
+
+The command returns a non-zero exit code if any issues were found
+which weren't repaired.
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.67",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		f := cmd.NewFsSrc(args)
+		cmd.Run(false, false, command, func() error {
+			issues, err := operations.Fsck(context.Background(), f, opt)
+			if err != nil {
+				return err
+			}
+			unrepaired := 0
+			for _, issue := range issues {
+				if !issue.Repaired {
+					unrepaired++
+				}
+			}
+			fs.Logf(f, "%d issues found, %d repaired", len(issues), len(issues)-unrepaired)
+			if unrepaired > 0 {
+				return fmt.Errorf("%d issues found which weren't repaired", unrepaired)
+			}
+			return nil
+		})
+	},
+}
@@ -0,0 +1,124 @@
+// Package index provides the index command and the --from-index flag
+// for the listing commands.
+package index
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Options for making an index
+type Options struct {
+	NoHash    bool     // don't store hashes in the index
+	HashTypes []string // only store these hash types if set
+}
+
+var (
+	opt Options
+
+	// FromIndex is the index file to list from if set
+	FromIndex string
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+	cmdFlags := commandDefinition.Flags()
+	flags.BoolVarP(cmdFlags, &opt.NoHash, "no-hash", "", false, "Don't store hashes in the index (can speed things up)", "")
+	flags.StringArrayVarP(cmdFlags, &opt.HashTypes, "hash-type", "", nil, "Only store this hash type (may be repeated)", "")
+}
+
+// AddFromIndexFlag adds the --from-index flag to flagSet
+func AddFromIndexFlag(flagSet *pflag.FlagSet) {
+	flags.StringVarP(flagSet, &FromIndex, "from-index", "", FromIndex, "Read the listing from this index made with rclone index instead of the remote", "")
+}
+
+// NewFsSrc makes the Fs to list from the arguments.
+//
+// If --from-index is set this reads the listing from the index
+// otherwise it calls cmd.NewFsSrc.
+func NewFsSrc(args []string) fs.Fs {
+	if FromIndex == "" {
+		return cmd.NewFsSrc(args)
+	}
+	f, err := NewFs(context.Background(), FromIndex, args[0])
+	if err != nil {
+		err = fs.CountError(err)
+		log.Fatalf("Failed to read listing for %q from index: %v", args[0], err)
+	}
+	return f
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "index remote:path file",
+	Short: `Save the listing of a remote to a local index file.`,
+	Long: `
+Lists the objects and directories in the source path recursively and
+saves their names, sizes, modification times and hashes to a local
+index file.
+
+The listing commands ` + "`ls`" + ` and ` + "`lsjson`" + ` can then read the listing
+from the index instead of the remote with the ` + "`--from-index`" + ` flag
+which is useful for browsing a remote offline or for quickly querying
+a large remote, for example
+
+    rclone index s3:bucket bucket.index
+    rclone lsjson --from-index bucket.index s3:bucket/dir
+
+The path given to the listing commands may either be the remote the
+index was made from as above, optionally with a subdirectory, or a
+path within the index.
+
+The index is a gzip compressed file with a line of JSON for each
+object or directory. It stores all the hashes the remote supports
+unless ` + "`--no-hash`" + ` or ` + "`--hash-type`" + ` are given. Note that calculating
+hashes may take a long time for some remotes such as local disks.
+
+The filtering flags can be used to choose what is stored in the index.
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.67",
+		"groups":            "Filter,Listing",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(2, 2, command, args)
+		fsrc := cmd.NewFsSrc(args)
+		indexFile := args[1]
+		cmd.Run(false, false, command, func() error {
+			return saveIndex(context.Background(), fsrc, indexFile)
+		})
+	},
+}
+
+// saveIndex writes the index of f to indexFile
+//
+// The index is written to a temporary file first so an existing index
+// isn't lost if the listing fails.
+func saveIndex(ctx context.Context, f fs.Fs, indexFile string) (err error) {
+	tmpFile := indexFile + ".partial"
+	out, err := os.Create(tmpFile)
+	if err != nil {
+		return fmt.Errorf("failed to create index: %w", err)
+	}
+	err = writeIndex(ctx, f, out, &opt)
+	closeErr := out.Close()
+	if err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to close index: %w", closeErr)
+	}
+	if err == nil {
+		err = os.Rename(tmpFile, indexFile)
+	}
+	if err != nil {
+		_ = os.Remove(tmpFile)
+		return err
+	}
+	fs.Infof(nil, "Saved index of %v to %q", f, indexFile)
+	return nil
+}
@@ -0,0 +1,141 @@
+package index
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeFiles makes some files to index in a temporary directory
+func makeFiles(t *testing.T) fs.Fs {
+	dir := t.TempDir()
+	t1 := fstest.Time("2001-02-03T04:05:06.499999999Z")
+	for _, file := range []struct {
+		path    string
+		content string
+	}{
+		{"file1", "hello"},
+		{"dir/file2", "potato"},
+		{"dir/sub/file3", "sausage and mash"},
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(file.path))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0777))
+		require.NoError(t, os.WriteFile(p, []byte(file.content), 0666))
+		require.NoError(t, os.Chtimes(p, t1, t1))
+	}
+	f, err := fs.NewFs(context.Background(), dir)
+	require.NoError(t, err)
+	return f
+}
+
+func TestIndex(t *testing.T) {
+	ctx := context.Background()
+	f := makeFiles(t)
+	indexFile := filepath.Join(t.TempDir(), "test.index")
+	require.NoError(t, saveIndex(ctx, f, indexFile))
+
+	fi, err := NewFs(ctx, indexFile, "")
+	require.NoError(t, err)
+	assert.Equal(t, f.Hashes(), fi.Hashes())
+	assert.Equal(t, f.Precision(), fi.Precision())
+
+	// Check ls gives the same output from the index and the remote
+	for _, dir := range []string{"", "dir"} {
+		var want, got bytes.Buffer
+		src := f
+		if dir != "" {
+			src, err = fs.NewFs(ctx, fs.ConfigString(f)+"/"+dir)
+			require.NoError(t, err)
+		}
+		require.NoError(t, operations.List(ctx, src, &want))
+
+		// index path can be relative or the original remote
+		for _, remote := range []string{dir, fs.ConfigString(src)} {
+			fi, err := NewFs(ctx, indexFile, remote)
+			require.NoError(t, err, remote)
+			got.Reset()
+			require.NoError(t, operations.List(ctx, fi, &got))
+			assert.Equal(t, want.String(), got.String(), remote)
+		}
+	}
+
+	// Check lsjson gives the same output including the hashes
+	listJSON := func(f fs.Fs) (items []operations.ListJSONItem) {
+		opt := operations.ListJSONOpt{Recurse: true, ShowHash: true, NoMimeType: true}
+		require.NoError(t, operations.ListJSON(ctx, f, "", &opt, func(item *operations.ListJSONItem) error {
+			items = append(items, *item)
+			return nil
+		}))
+		return items
+	}
+	want, got := listJSON(f), listJSON(fi)
+	require.Equal(t, len(want), len(got))
+	for i := range want {
+		assert.Equal(t, want[i].Path, got[i].Path)
+		assert.Equal(t, want[i].IsDir, got[i].IsDir)
+		assert.Equal(t, want[i].Hashes, got[i].Hashes)
+		if !want[i].IsDir {
+			assert.Equal(t, want[i].Size, got[i].Size)
+			assert.True(t, want[i].ModTime.When.Equal(got[i].ModTime.When), want[i].Path)
+		}
+	}
+
+	// Check objects
+	o, err := fi.NewObject(ctx, "dir/file2")
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), o.Size())
+	md5, err := o.Hash(ctx, hash.MD5)
+	require.NoError(t, err)
+	assert.Equal(t, "8ee2027983915ec78acc45027d874316", md5)
+	_, err = o.Open(ctx)
+	assert.Equal(t, errReadOnly, err)
+	_, err = fi.NewObject(ctx, "dir")
+	assert.Equal(t, fs.ErrorIsDir, err)
+	_, err = fi.NewObject(ctx, "potato")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+
+	// Check bad roots
+	_, err = NewFs(ctx, indexFile, "potato")
+	assert.ErrorIs(t, err, fs.ErrorDirNotFound)
+	_, err = NewFs(ctx, indexFile, "file1")
+	assert.ErrorIs(t, err, fs.ErrorIsFile)
+}
+
+func TestIndexHashTypes(t *testing.T) {
+	ctx := context.Background()
+	f := makeFiles(t)
+	defer func() {
+		opt = Options{}
+	}()
+
+	for _, test := range []struct {
+		opt  Options
+		want hash.Set
+	}{
+		{opt: Options{NoHash: true}, want: hash.Set(hash.None)},
+		{opt: Options{HashTypes: []string{"SHA-1"}}, want: hash.Set(hash.SHA1)},
+	} {
+		opt = test.opt
+		indexFile := filepath.Join(t.TempDir(), "test.index")
+		require.NoError(t, saveIndex(ctx, f, indexFile))
+		fi, err := NewFs(ctx, indexFile, "")
+		require.NoError(t, err)
+		assert.Equal(t, test.want, fi.Hashes())
+		o, err := fi.NewObject(ctx, "file1")
+		require.NoError(t, err)
+		_, err = o.Hash(ctx, hash.MD5)
+		assert.Equal(t, hash.ErrUnsupported, err)
+		assert.WithinDuration(t, fstest.Time("2001-02-03T04:05:06.499999999Z"), o.ModTime(ctx), time.Second)
+	}
+}
@@ -0,0 +1,376 @@
+package index
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/operations"
+)
+
+// indexVersion is the version of the index file format
+const indexVersion = 1
+
+// errReadOnly is returned when trying to modify an index
+var errReadOnly = errors.New("can't modify or read file contents from an index")
+
+// header is the first line of an index file
+type header struct {
+	Version   int           // version of the index file format
+	Remote    string        // remote the index was made from
+	Created   time.Time     // when the index was made
+	Precision time.Duration // precision of the modification times
+	Hashes    []string      // names of the hashes stored in the index
+}
+
+// entry is each subsequent line of an index file
+type entry struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	IsDir   bool              `json:",omitempty"`
+	Hashes  map[string]string `json:",omitempty"`
+}
+
+// writeIndex lists f recursively and writes the index to out
+func writeIndex(ctx context.Context, f fs.Fs, out io.Writer, opt *Options) (err error) {
+	zw := gzip.NewWriter(out)
+	enc := json.NewEncoder(zw)
+	hashes := hash.Set(hash.None)
+	if !opt.NoHash {
+		hashes = f.Hashes()
+		if len(opt.HashTypes) > 0 {
+			hashes = hash.Set(hash.None)
+			for _, hashType := range opt.HashTypes {
+				var ht hash.Type
+				if err := ht.Set(hashType); err != nil {
+					return err
+				}
+				hashes.Add(ht)
+			}
+			hashes = hashes.Overlap(f.Hashes())
+		}
+	}
+	err = enc.Encode(header{
+		Version:   indexVersion,
+		Remote:    fs.ConfigString(f),
+		Created:   time.Now(),
+		Precision: f.Precision(),
+		Hashes:    hashNames(hashes),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write index header: %w", err)
+	}
+	listOpt := operations.ListJSONOpt{
+		Recurse:    true,
+		NoMimeType: true,
+		ShowHash:   hashes.Count() > 0,
+		HashTypes:  hashNames(hashes),
+	}
+	err = operations.ListJSON(ctx, f, "", &listOpt, func(item *operations.ListJSONItem) error {
+		return enc.Encode(entry{
+			Path:    item.Path,
+			Size:    item.Size,
+			ModTime: item.ModTime.When,
+			IsDir:   item.IsDir,
+			Hashes:  item.Hashes,
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	return zw.Close()
+}
+
+// hashNames returns the names of the hashes in set
+func hashNames(set hash.Set) (names []string) {
+	for _, ht := range set.Array() {
+		names = append(names, ht.String())
+	}
+	return names
+}
+
+// Fs is a read only fs.Fs which serves the listing stored in an
+// index file.
+type Fs struct {
+	name     string              // path to the index file
+	root     string              // root within the index
+	header   header              // header of the index
+	hashes   hash.Set            // hashes stored in the index
+	features *fs.Features        // optional features
+	entries  map[string]*entry   // entries by path
+	children map[string][]string // paths of the children of each directory
+}
+
+// NewFs opens the index file at name and returns an Fs which lists
+// the remote path within it.
+//
+// remote may either be a path within the index or the path of the
+// remote the index was made from, optionally with a subdirectory.
+func NewFs(ctx context.Context, name, remote string) (*Fs, error) {
+	in, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index: %w", err)
+	}
+	defer fs.CheckClose(in, &err)
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index %q: %w", name, err)
+	}
+	f := &Fs{
+		name:     name,
+		entries:  map[string]*entry{},
+		children: map[string][]string{},
+	}
+	dec := json.NewDecoder(bufio.NewReader(zr))
+	if err = dec.Decode(&f.header); err != nil {
+		return nil, fmt.Errorf("failed to read index %q header: %w", name, err)
+	}
+	if f.header.Version != indexVersion {
+		return nil, fmt.Errorf("unsupported index %q version %d", name, f.header.Version)
+	}
+	for _, hashName := range f.header.Hashes {
+		var ht hash.Type
+		if err := ht.Set(hashName); err == nil {
+			f.hashes.Add(ht)
+		}
+	}
+	for {
+		e := new(entry)
+		err = dec.Decode(e)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read index %q: %w", name, err)
+		}
+		f.add(e)
+	}
+	for _, children := range f.children {
+		sort.Strings(children)
+	}
+	f.root, err = f.rootOf(remote)
+	if err != nil {
+		return nil, err
+	}
+	f.features = (&fs.Features{}).Fill(ctx, f)
+	return f, nil
+}
+
+// add e to the index, making any parent directories which are
+// missing
+func (f *Fs) add(e *entry) {
+	if old, found := f.entries[e.Path]; found {
+		// replace a directory made for a missing parent
+		*old = *e
+		return
+	}
+	f.entries[e.Path] = e
+	parent := path.Dir(e.Path)
+	if parent == "." {
+		parent = ""
+	}
+	f.children[parent] = append(f.children[parent], e.Path)
+	if parent != "" {
+		f.add(&entry{Path: parent, IsDir: true, Size: -1, ModTime: e.ModTime})
+	}
+}
+
+// rootOf works out the root within the index from remote
+func (f *Fs) rootOf(remote string) (string, error) {
+	root := remote
+	if indexRemote := f.header.Remote; indexRemote != "" && strings.HasPrefix(remote, indexRemote) {
+		// Only strip the prefix at a path boundary
+		rest := remote[len(indexRemote):]
+		if rest == "" || strings.HasPrefix(rest, "/") || strings.HasSuffix(indexRemote, ":") || strings.HasSuffix(indexRemote, "/") {
+			root = rest
+		}
+	}
+	root = strings.Trim(root, "/")
+	if root != "" {
+		e, found := f.entries[root]
+		if !found {
+			return "", fmt.Errorf("%q: %w in index %q", remote, fs.ErrorDirNotFound, f.name)
+		}
+		if !e.IsDir {
+			return "", fmt.Errorf("%q: %w", remote, fs.ErrorIsFile)
+		}
+	}
+	return root, nil
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return "index"
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// String converts this Fs to a string
+func (f *Fs) String() string {
+	return fmt.Sprintf("index %q of %s", f.name, path.Join(f.header.Remote, f.root))
+}
+
+// Precision of the ModTimes in this Fs
+func (f *Fs) Precision() time.Duration {
+	return f.header.Precision
+}
+
+// Hashes returns the supported hash types of the filesystem
+func (f *Fs) Hashes() hash.Set {
+	return f.hashes
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	dirPath := path.Join(f.root, dir)
+	if dirPath == "." {
+		dirPath = ""
+	}
+	if dirPath != "" {
+		if e, found := f.entries[dirPath]; !found || !e.IsDir {
+			return nil, fs.ErrorDirNotFound
+		}
+	}
+	for _, childPath := range f.children[dirPath] {
+		e := f.entries[childPath]
+		remote := f.remote(childPath)
+		if e.IsDir {
+			entries = append(entries, fs.NewDir(remote, e.ModTime))
+		} else {
+			entries = append(entries, &Object{fs: f, remote: remote, entry: e})
+		}
+	}
+	return entries, nil
+}
+
+// remote returns the path relative to the root of p
+func (f *Fs) remote(p string) string {
+	if f.root == "" {
+		return p
+	}
+	return strings.TrimPrefix(p, f.root+"/")
+}
+
+// NewObject finds the Object at remote.  If it can't be found
+// it returns the error fs.ErrorObjectNotFound.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	e, found := f.entries[path.Join(f.root, remote)]
+	if !found {
+		return nil, fs.ErrorObjectNotFound
+	}
+	if e.IsDir {
+		return nil, fs.ErrorIsDir
+	}
+	return &Object{fs: f, remote: remote, entry: e}, nil
+}
+
+// Put is not supported
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return nil, errReadOnly
+}
+
+// Mkdir is not supported
+func (f *Fs) Mkdir(ctx context.Context, dir string) error {
+	return errReadOnly
+}
+
+// Rmdir is not supported
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	return errReadOnly
+}
+
+// Object is a file in the index
+type Object struct {
+	fs     *Fs
+	remote string
+	entry  *entry
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *Object) Fs() fs.Info {
+	return o.fs
+}
+
+// String returns a description of the Object
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *Object) Remote() string {
+	return o.remote
+}
+
+// ModTime returns the modification date of the file
+func (o *Object) ModTime(ctx context.Context) time.Time {
+	return o.entry.ModTime
+}
+
+// Size returns the size of the file
+func (o *Object) Size() int64 {
+	return o.entry.Size
+}
+
+// Hash returns the selected checksum of the file as recorded in the
+// index
+func (o *Object) Hash(ctx context.Context, ht hash.Type) (string, error) {
+	if !o.fs.hashes.Contains(ht) {
+		return "", hash.ErrUnsupported
+	}
+	return o.entry.Hashes[ht.String()], nil
+}
+
+// Storable says whether this object can be stored
+func (o *Object) Storable() bool {
+	return true
+}
+
+// SetModTime is not supported
+func (o *Object) SetModTime(ctx context.Context, t time.Time) error {
+	return errReadOnly
+}
+
+// Open is not supported as the index doesn't have the file contents
+func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	return nil, errReadOnly
+}
+
+// Update is not supported
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	return errReadOnly
+}
+
+// Remove is not supported
+func (o *Object) Remove(ctx context.Context) error {
+	return errReadOnly
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs     = (*Fs)(nil)
+	_ fs.Object = (*Object)(nil)
+)
@@ -6,6 +6,7 @@ import (
 	"os"
 
 	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/cmd/index"
 	"github.com/rclone/rclone/cmd/ls/lshelp"
 	"github.com/rclone/rclone/fs/operations"
 	"github.com/spf13/cobra"
@@ -13,6 +14,7 @@ import (
 
 func init() {
 	cmd.Root.AddCommand(commandDefinition)
+	index.AddFromIndexFlag(commandDefinition.Flags())
 }
 
 var commandDefinition = &cobra.Command{
@@ -36,7 +38,7 @@ Eg
 	},
 	Run: func(command *cobra.Command, args []string) {
 		cmd.CheckArgs(1, 1, command, args)
-		fsrc := cmd.NewFsSrc(args)
+		fsrc := index.NewFsSrc(args)
 		cmd.Run(false, false, command, func() error {
 			return operations.List(context.Background(), fsrc, os.Stdout)
 		})
@@ -4,10 +4,12 @@ package lsjson
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 
 	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/cmd/index"
 	"github.com/rclone/rclone/cmd/ls/lshelp"
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/config/flags"
@@ -34,6 +36,7 @@ func init() {
 	flags.BoolVarP(cmdFlags, &opt.Metadata, "metadata", "M", false, "Add metadata to the listing", "")
 	flags.StringArrayVarP(cmdFlags, &opt.HashTypes, "hash-type", "", nil, "Show only this hash type (may be repeated)", "")
 	flags.BoolVarP(cmdFlags, &statOnly, "stat", "", false, "Just return the info for the pointed to file", "")
+	index.AddFromIndexFlag(cmdFlags)
 }
 
 var commandDefinition = &cobra.Command{
@@ -127,9 +130,12 @@ can be processed line by line as each item is written one to a line.
 		var fsrc fs.Fs
 		var remote string
 		if statOnly {
+			if index.FromIndex != "" {
+				return errors.New("can't use --stat with --from-index")
+			}
 			fsrc, remote = cmd.NewFsFile(args[0])
 		} else {
-			fsrc = cmd.NewFsSrc(args)
+			fsrc = index.NewFsSrc(args)
 		}
 		cmd.Run(false, false, command, func() error {
 			if statOnly {
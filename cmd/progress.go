@@ -4,7 +4,9 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -85,7 +87,13 @@ func printProgress(logMessage string) {
 
 	var buf bytes.Buffer
 	w, _ := terminal.GetSize()
-	stats := strings.TrimSpace(accounting.GlobalStats().String())
+	var stats string
+	if fs.GetConfig(context.Background()).ProgressPerFile && terminal.IsTerminal(int(os.Stdout.Fd())) {
+		stats = accounting.GlobalStats().StringWithProgressBars(w)
+	} else {
+		stats = accounting.GlobalStats().String()
+	}
+	stats = strings.TrimSpace(stats)
 	logMessage = strings.TrimSpace(logMessage)
 
 	out := func(s string) {
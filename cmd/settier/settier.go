@@ -6,12 +6,18 @@ import (
 	"fmt"
 
 	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs/config/flags"
 	"github.com/rclone/rclone/fs/operations"
 	"github.com/spf13/cobra"
 )
 
+var opt = operations.SetTierOpt{}
+
 func init() {
 	cmd.Root.AddCommand(commandDefinition)
+	cmdFlags := commandDefinition.Flags()
+	flags.IntVarP(cmdFlags, &opt.Concurrency, "concurrency", "", opt.Concurrency, "Number of tier changes to run at once (default --checkers)", "")
+	flags.Float64VarP(cmdFlags, &opt.Rate, "rate", "", opt.Rate, "Maximum number of tier changes per second (0 for unlimited)", "")
 }
 
 var commandDefinition = &cobra.Command{
@@ -39,6 +45,19 @@ Or use rclone filters to set tier on only specific files
 Or just provide remote directory and all files in directory will be tiered
 
     rclone settier tier remote:path/dir
+
+All the files in the directory and its subdirectories are tiered, use
+--max-depth to limit this.
+
+The tier changes are run --checkers at a time. Use --concurrency to
+change how many run at once and --rate to limit the number of tier
+changes per second, for example to transition a large prefix to
+GLACIER without overloading the provider
+
+    rclone settier --concurrency 32 --rate 100 -P GLACIER remote:bucket/prefix
+
+Progress is shown in the checks of the stats, so use -P or --stats to
+see it.
 `,
 	Annotations: map[string]string{
 		"versionIntroduced": "v1.44",
@@ -54,7 +73,7 @@ Or just provide remote directory and all files in directory will be tiered
 				return fmt.Errorf("remote %s does not support settier", fsrc.Name())
 			}
 
-			return operations.SetTier(context.Background(), fsrc, tier)
+			return operations.SetTierWithOpt(context.Background(), fsrc, tier, opt)
 		})
 	},
 }
@@ -0,0 +1,79 @@
+// Package swap provides the swap command.
+package swap
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "swap remote:path1 remote:path2",
+	Short: `Swap the contents of two files.`,
+	Long: `
+Swap the contents of the files at remote:path1 and remote:path2 so
+each ends up with the other's contents.
+
+This can be used to promote a staged file to a live one, keeping the
+old live file in the staging location so it can be swapped back.
+
+    rclone swap s3:bucket/site/index.html s3:bucket/staging/index.html
+
+The files may be on different remotes.
+
+Neither file is deleted at any point. Rclone does this:
+
+- copy path1 to a temporary file next to it
+- copy path2 over path1
+- copy the temporary file over path2
+- delete the temporary file
+
+Each copy is checked by size and hash (if available) before going on
+to the next step. Copies are done server-side if the backend supports
+it.
+
+If something goes wrong after path1 has been overwritten then the
+temporary file is kept and its name is given in the error so the
+original contents of path1 can be recovered.
+
+Whether a reader can see a partially written file while it is being
+overwritten depends on the backend:
+
+- Object stores such as s3, GCS, Azure Blob, B2 and Swift replace
+  objects atomically, so readers see either the old or the new
+  contents.
+- Backends which upload to a temporary name and rename it into place,
+  such as local, ftp and sftp, replace files atomically unless
+  ` + "`--inplace`" + ` is set.
+- Other backends may briefly show a partially written or missing file
+  while it is overwritten.
+
+The swap as a whole is not atomic: for a short time both files have
+the same contents.
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.67",
+		"groups":            "Important,Copy",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(2, 2, command, args)
+		fa, a := cmd.NewFsFile(args[0])
+		fb, b := cmd.NewFsFile(args[1])
+		cmd.Run(true, false, command, func() error {
+			for i, name := range []string{a, b} {
+				if name == "" {
+					return fmt.Errorf("%s is a directory or doesn't exist: %w", args[i], fs.ErrorObjectNotFound)
+				}
+			}
+			return operations.Swap(context.Background(), fa, a, fb, b)
+		})
+	},
+}
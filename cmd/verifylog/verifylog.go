@@ -0,0 +1,65 @@
+// Package verifylog provides the verifylog command.
+package verifylog
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "verifylog file",
+	Short: `Check a verify log written with --verify-log hasn't been tampered with.`,
+	Long: `
+When rclone is run with ` + "`--verify-log file`" + ` it appends an entry
+to the file for each file it successfully copies or moves. Each entry
+records the source, destination, size and hash of the transfer, is
+signed with the secret ` + "`--verify-log-key`" + ` and includes the
+signature of the previous entry, chaining the entries together.
+
+This command checks the signature of every entry and that each entry
+follows the previous one, using the same ` + "`--verify-log-key`" + `.
+
+    rclone verifylog --verify-log-key KEY /path/to/verify.log
+
+If an entry has been modified, or entries have been removed or
+reordered, it reports the first line which failed to verify and
+returns a non-zero exit code.
+
+Note that removing entries from the end of the log can't be detected
+from the log alone, so keep a record of the number of entries or the
+last signature if you need to detect that.
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.67",
+		"groups":            "Logging",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		cmd.Run(false, false, command, func() error {
+			ci := fs.GetConfig(context.Background())
+			in, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = in.Close()
+			}()
+			entries, err := operations.CheckVerifyLog(in, ci.VerifyLogKey)
+			if err != nil {
+				return fmt.Errorf("verify log failed after %d good entries: %w", entries, err)
+			}
+			fmt.Printf("%d entries verified OK\n", entries)
+			return nil
+		})
+	},
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strings"
 	"sync"
 	"time"
 	"unicode/utf8"
@@ -39,6 +40,15 @@ func Start(ctx context.Context) {
 
 	// Start the transactions per second limiter
 	StartLimitTPS(ctx)
+
+	// Start the adaptive concurrency limiter
+	StartAdaptiveConcurrency(ctx)
+
+	// Start the transfer log
+	StartTransferLog(ctx)
+
+	// Start the pause signal handler
+	startPauseSignalHandler()
 }
 
 // Account limits and accounts for one transfer
@@ -361,8 +371,23 @@ func (acc *Account) read(in io.Reader, p []byte) (n int, err error) {
 	return n, err
 }
 
+// waitIfSuspended blocks while running transfers are suspended. It
+// must be called without holding acc.mu.
+func (acc *Account) waitIfSuspended() error {
+	if !pause.suspended.Load() {
+		return nil
+	}
+	acc.mu.Lock()
+	ctx := acc.ctx
+	acc.mu.Unlock()
+	return pause.wait(ctx, true)
+}
+
 // Read bytes from the object - see io.Reader
 func (acc *Account) Read(p []byte) (n int, err error) {
+	if err := acc.waitIfSuspended(); err != nil {
+		return 0, err
+	}
 	acc.mu.Lock()
 	defer acc.mu.Unlock()
 	return acc.read(acc.in, p)
@@ -382,6 +407,9 @@ type accountWriteTo struct {
 //
 // Implementations must not retain p.
 func (awt *accountWriteTo) Write(p []byte) (n int, err error) {
+	if err := awt.acc.waitIfSuspended(); err != nil {
+		return 0, err
+	}
 	bytesUntilLimit, err := awt.acc.checkReadBefore()
 	if err == nil {
 		n, err = awt.w.Write(p)
@@ -409,6 +437,9 @@ func (acc *Account) WriteTo(w io.Writer) (n int64, err error) {
 
 // AccountRead account having read n bytes
 func (acc *Account) AccountRead(n int) (err error) {
+	if err := acc.waitIfSuspended(); err != nil {
+		return err
+	}
 	acc.mu.Lock()
 	defer acc.mu.Unlock()
 	bytesUntilLimit, err := acc.checkReadBefore()
@@ -539,6 +570,72 @@ func (acc *Account) String() string {
 	)
 }
 
+// minProgressBarWidth is the narrowest bar worth drawing - if there
+// isn't room for this then only the numbers are shown.
+const minProgressBarWidth = 10
+
+// progressBar produces a full width progress bar for this file
+// which fits in width columns.
+func (acc *Account) progressBar(width int) string {
+	a, b := acc.progress()
+	_, cur := acc.speed()
+	eta, etaok := acc.eta()
+	etas := "-"
+	if etaok {
+		etas = fs.Duration(eta).ShortReadableString()
+	}
+	var speed string
+	if acc.ci.DataRateUnit == "bits" {
+		speed = fs.SizeSuffix(cur * 8).BitRateUnit()
+	} else {
+		speed = fs.SizeSuffix(cur).ByteRateUnit()
+	}
+	return progressBar(acc.name, a, b, speed, etas, width)
+}
+
+// progressBar renders the progress of a single transfer in width
+// columns as two lines - the name of the file then a bar followed by
+// the amount done, speed and ETA.
+//
+// The bar is left out if there isn't room for it.
+func progressBar(name string, done, size int64, speed, eta string, width int) string {
+	const indent = " * "
+	pct, total := "-", "-"
+	if size > 0 {
+		pct = fmt.Sprintf("%d%%", int(100*float64(done)/float64(size)))
+	}
+	if size >= 0 {
+		total = fs.SizeSuffix(size).ByteUnit()
+	}
+	info := fmt.Sprintf(" %4s %s / %s, %s, ETA %s",
+		pct,
+		fs.SizeSuffix(done).ByteUnit(),
+		total,
+		speed,
+		eta,
+	)
+	nameLine := indent + shortenName(name, width-len(indent))
+	barWidth := width - len(indent) - len(info) - 2 // for the [ ]
+	if barWidth < minProgressBarWidth {
+		return nameLine + "\n" + strings.Repeat(" ", len(indent)-1) + info
+	}
+	filled := 0
+	if size > 0 && done > 0 {
+		filled = int(int64(barWidth) * done / size)
+		if filled > barWidth {
+			filled = barWidth
+		}
+	}
+	bar := strings.Repeat("=", filled)
+	if filled < barWidth {
+		if filled > 0 {
+			bar = bar[:filled-1] + ">"
+		}
+		bar += strings.Repeat(" ", barWidth-filled)
+	}
+	return nameLine + "\n" + indent + "[" + bar + "]" + info
+}
+
 // rcStats adds remote control stats for this file
 func (acc *Account) rcStats(out rc.Params) {
 	a, b := acc.progress()
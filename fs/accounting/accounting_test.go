@@ -7,6 +7,7 @@ import (
 	"io"
 	"strings"
 	"testing"
+	"time"
 	"unicode/utf8"
 
 	"github.com/rclone/rclone/fs"
@@ -384,3 +385,67 @@ func TestShortenName(t *testing.T) {
 		})
 	}
 }
+
+func TestProgressBar(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		done  int64
+		size  int64
+		width int
+		want  string
+	}{
+		{"file.txt", 0, 100, 60, " * file.txt\n * [" + strings.Repeat(" ", 21) + "]   0% 0 B / 100 B, 1 KiB/s, ETA 5s"},
+		{"file.txt", 50, 100, 60, " * file.txt\n * [=========>" + strings.Repeat(" ", 10) + "]  50% 50 B / 100 B, 1 KiB/s, ETA 5s"},
+		{"file.txt", 100, 100, 60, " * file.txt\n * [" + strings.Repeat("=", 19) + "] 100% 100 B / 100 B, 1 KiB/s, ETA 5s"},
+		{"file.txt", 50, -1, 60, " * file.txt\n * [" + strings.Repeat(" ", 24) + "]    - 50 B / -, 1 KiB/s, ETA 5s"},
+		{"file.txt", 50, 100, 40, " * file.txt\n    50% 50 B / 100 B, 1 KiB/s, ETA 5s"},
+		{"a/long/file/name.txt", 50, 100, 16, " * a/long…me.txt\n    50% 50 B / 100 B, 1 KiB/s, ETA 5s"},
+	} {
+		t.Run(fmt.Sprintf("%s,%d/%d,width=%d", test.name, test.done, test.size, test.width), func(t *testing.T) {
+			got := progressBar(test.name, test.done, test.size, "1 KiB/s", "5s", test.width)
+			assert.Equal(t, test.want, got)
+			lines := strings.Split(got, "\n")
+			require.Equal(t, 2, len(lines))
+			assert.LessOrEqual(t, utf8.RuneCountInString(lines[0]), test.width)
+			if strings.Contains(lines[1], "[") {
+				assert.Equal(t, test.width, len(lines[1]))
+			}
+		})
+	}
+}
+
+func TestStatsStringWithProgressBars(t *testing.T) {
+	ctx := context.Background()
+	s := NewStats(ctx)
+	var accs []*Account
+	for _, remote := range []string{"one", "two", "three"} {
+		tr := s.NewTransferRemoteSize(remote, 4, nil, nil)
+		in := io.NopCloser(bytes.NewBuffer([]byte{1, 2, 3, 4}))
+		acc := tr.Account(ctx, in)
+		accs = append(accs, acc)
+		defer func() {
+			assert.NoError(t, acc.Close())
+			tr.Done(ctx, nil)
+		}()
+		time.Sleep(time.Millisecond) // make sure start times differ
+	}
+	var buf = make([]byte, 2)
+	_, err := accs[1].Read(buf)
+	require.NoError(t, err)
+
+	out := s.StringWithProgressBars(72)
+	i := strings.Index(out, "Transferring:\n")
+	require.True(t, i >= 0, out)
+	lines := strings.Split(strings.TrimSpace(out[i:]), "\n")[1:]
+	require.Equal(t, 6, len(lines), out)
+	for i, remote := range []string{"one", "two", "three"} {
+		assert.Equal(t, " * "+remote, lines[2*i])
+		assert.True(t, strings.HasPrefix(lines[2*i+1], " * ["), lines[2*i+1])
+		assert.Equal(t, 72, len(lines[2*i+1]), lines[2*i+1])
+	}
+	assert.Contains(t, lines[1], "   0% 0 B / 4 B")
+	assert.Contains(t, lines[3], "  50% 2 B / 4 B")
+
+	// The normal String doesn't draw bars
+	assert.NotContains(t, s.String(), " * [")
+}
@@ -46,3 +46,20 @@ func (tb *tokenBucket) startSignalHandler() {
 		}
 	}()
 }
+
+// startPauseSignalHandler() sets a signal handler to catch SIGUSR1 and
+// toggle pausing new transfers.
+func startPauseSignalHandler() {
+	pauseSignalOnce.Do(func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGUSR1)
+
+		go func() {
+			// This runs forever, but blocks until the signal is received.
+			for {
+				<-signals
+				togglePause()
+			}
+		}()
+	})
+}
@@ -0,0 +1,204 @@
+// Adaptive concurrency - backing off when the backend returns errors
+
+package accounting
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"golang.org/x/time/rate"
+)
+
+const (
+	adaptiveMinRequests = 10       // minimum number of transactions in a window to judge the error rate
+	adaptiveIncrease    = 0.1      // fraction of the maximum to increase by after a good window
+	adaptiveMinLevel    = 1.0 / 64 // lowest fraction of the maximum to back off to
+)
+
+// adaptiveLimiter reduces the number of transfers and the
+// transactions per second when the error rate of the transactions
+// rises above a threshold.
+//
+// It is an AIMD controller: the level, the fraction of --transfers
+// and --tpslimit in use, is halved after each window with too many
+// errors and increased by adaptiveIncrease after each window without.
+type adaptiveLimiter struct {
+	errorRate float64          // error rate above which to back off
+	window    time.Duration    // how long to measure the error rate over
+	max       int              // maximum number of transfers
+	maxTPS    float64          // maximum transactions per second or 0 for unlimited
+	tps       *rate.Limiter    // limiter to set the transactions per second of, may be nil
+	now       func() time.Time // the time now - for testing
+	mu        sync.Mutex       // protects the fields below
+	level     float64          // fraction of the maximums in use
+	running   int              // number of transfers running
+	requests  int              // transactions in this window
+	errors    int              // failed transactions in this window
+	start     time.Time        // when this window started
+	changed   chan struct{}    // closed when a transfer finishes or the level changes
+}
+
+// adaptive is the global adaptive limiter or nil if not in use
+var adaptive *adaptiveLimiter
+
+// newAdaptiveLimiter makes a new adaptiveLimiter from the config
+func newAdaptiveLimiter(ci *fs.ConfigInfo, tps *rate.Limiter) *adaptiveLimiter {
+	a := &adaptiveLimiter{
+		errorRate: ci.AdaptiveErrorRate,
+		window:    ci.AdaptiveWindow,
+		max:       ci.Transfers,
+		tps:       tps,
+		now:       time.Now,
+		level:     1,
+		changed:   make(chan struct{}),
+	}
+	if a.max < 1 {
+		a.max = 1
+	}
+	if tps != nil {
+		a.maxTPS = float64(tps.Limit())
+	}
+	a.start = a.now()
+	return a
+}
+
+// StartAdaptiveConcurrency starts the adaptive limiter if
+// --adaptive-concurrency is set.
+//
+// This should be called after StartLimitTPS.
+func StartAdaptiveConcurrency(ctx context.Context) {
+	ci := fs.GetConfig(ctx)
+	if ci.AdaptiveConcurrency {
+		adaptive = newAdaptiveLimiter(ci, tpsBucket)
+		fs.Infof(nil, "Starting adaptive concurrency: backing off when over %g%% of transactions fail in %v", ci.AdaptiveErrorRate*100, ci.AdaptiveWindow)
+	}
+}
+
+// transfers returns the number of transfers allowed to run
+//
+// Call with the lock held
+func (a *adaptiveLimiter) transfers() int {
+	return int(math.Ceil(a.level * float64(a.max)))
+}
+
+// setLevel sets the level, adjusting the transactions per second and
+// waking any transfers waiting to start.
+//
+// Call with the lock held
+func (a *adaptiveLimiter) setLevel(level float64) {
+	if level > 1 {
+		level = 1
+	} else if level < adaptiveMinLevel {
+		level = adaptiveMinLevel
+	}
+	if level == a.level {
+		return
+	}
+	a.level = level
+	if a.tps != nil {
+		a.tps.SetLimit(rate.Limit(a.maxTPS * level))
+	}
+	close(a.changed)
+	a.changed = make(chan struct{})
+}
+
+// record notes the result of a transaction, adjusting the level at
+// the end of each window.
+func (a *adaptiveLimiter) record(failed bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.requests++
+	if failed {
+		a.errors++
+	}
+	now := a.now()
+	if now.Sub(a.start) < a.window || a.requests < adaptiveMinRequests {
+		return
+	}
+	errorRate := float64(a.errors) / float64(a.requests)
+	oldTransfers := a.transfers()
+	if errorRate > a.errorRate {
+		a.setLevel(a.level / 2)
+		fs.Logf(nil, "Adaptive concurrency: %.0f%% of transactions failed - backing off to %d/%d transfers%s", errorRate*100, a.transfers(), a.max, a.tpsString())
+	} else if a.level < 1 {
+		a.setLevel(a.level + adaptiveIncrease)
+		if a.transfers() != oldTransfers || a.level == 1 {
+			fs.Infof(nil, "Adaptive concurrency: error rate %.0f%% - increasing to %d/%d transfers%s", errorRate*100, a.transfers(), a.max, a.tpsString())
+		}
+	}
+	a.requests = 0
+	a.errors = 0
+	a.start = now
+}
+
+// tpsString describes the transactions per second in use if limited
+//
+// Call with the lock held
+func (a *adaptiveLimiter) tpsString() string {
+	if a.tps == nil {
+		return ""
+	}
+	return fmt.Sprintf(" and %g transactions/s", a.maxTPS*a.level)
+}
+
+// acquire waits until a transfer is allowed to start.
+//
+// It returns an error if ctx is cancelled while waiting.
+func (a *adaptiveLimiter) acquire(ctx context.Context) error {
+	for {
+		a.mu.Lock()
+		if a.running < a.transfers() {
+			a.running++
+			a.mu.Unlock()
+			return nil
+		}
+		changed := a.changed
+		a.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release notes a transfer has finished
+func (a *adaptiveLimiter) release() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.running--
+	close(a.changed)
+	a.changed = make(chan struct{})
+}
+
+// RecordTransaction records whether a transaction failed for
+// --adaptive-concurrency. A transaction has failed if it was
+// throttled or returned a server or network error.
+//
+// It should be called once per transaction.
+func RecordTransaction(failed bool) {
+	if adaptive != nil {
+		adaptive.record(failed)
+	}
+}
+
+// WaitAdaptive blocks until --adaptive-concurrency allows another
+// transfer to start. It should be called before starting a transfer
+// and done should be called when it has finished.
+//
+// It returns an error if ctx is cancelled while waiting.
+func WaitAdaptive(ctx context.Context) (done func(), err error) {
+	a := adaptive
+	if a == nil {
+		return func() {}, nil
+	}
+	err = a.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return a.release, nil
+}
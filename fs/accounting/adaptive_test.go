@@ -0,0 +1,161 @@
+package accounting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+// newTestAdaptiveLimiter makes an adaptiveLimiter with a fake clock
+func newTestAdaptiveLimiter(transfers int, tps float64) (a *adaptiveLimiter, window func(requests, errors int)) {
+	_, ci := fs.AddConfig(context.Background())
+	ci.Transfers = transfers
+	ci.AdaptiveErrorRate = 0.1
+	ci.AdaptiveWindow = 10 * time.Second
+	var tpsLimiter *rate.Limiter
+	if tps > 0 {
+		tpsLimiter = rate.NewLimiter(rate.Limit(tps), 1)
+	}
+	a = newAdaptiveLimiter(ci, tpsLimiter)
+	now := a.start
+	a.now = func() time.Time { return now }
+	// window records a window of transactions of which errors failed
+	window = func(requests, errors int) {
+		for i := 0; i < requests; i++ {
+			if i == requests-1 {
+				now = now.Add(ci.AdaptiveWindow)
+			}
+			a.record(i < errors)
+		}
+	}
+	return a, window
+}
+
+func TestAdaptiveBackoffAndRecover(t *testing.T) {
+	a, window := newTestAdaptiveLimiter(16, 100)
+	state := func() (int, float64) {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		return a.transfers(), float64(a.tps.Limit())
+	}
+
+	// A low error rate doesn't change anything
+	window(100, 5)
+	transfers, tps := state()
+	assert.Equal(t, 16, transfers)
+	assert.Equal(t, 100.0, tps)
+
+	// A rising error rate backs off by half each window
+	window(100, 20)
+	transfers, tps = state()
+	assert.Equal(t, 8, transfers)
+	assert.Equal(t, 50.0, tps)
+	window(100, 50)
+	transfers, tps = state()
+	assert.Equal(t, 4, transfers)
+	assert.Equal(t, 25.0, tps)
+
+	// Too few transactions to judge the error rate doesn't change anything
+	window(adaptiveMinRequests-1, adaptiveMinRequests-1)
+	transfers, _ = state()
+	assert.Equal(t, 4, transfers)
+	a.requests, a.errors = 0, 0
+
+	// It never backs off to no transfers
+	for i := 0; i < 20; i++ {
+		window(100, 100)
+	}
+	transfers, tps = state()
+	assert.Equal(t, 1, transfers)
+	assert.Equal(t, 100*adaptiveMinLevel, tps)
+
+	// It recovers a bit each window until it is back to the maximum
+	window(100, 0)
+	transfers, tps = state()
+	assert.Equal(t, 2, transfers)
+	assert.InDelta(t, 100*(adaptiveMinLevel+adaptiveIncrease), tps, 1e-9)
+	for i := 0; i < 20; i++ {
+		window(100, 0)
+	}
+	transfers, tps = state()
+	assert.Equal(t, 16, transfers)
+	assert.Equal(t, 100.0, tps)
+}
+
+func TestAdaptiveTransfers(t *testing.T) {
+	ctx := context.Background()
+	a, window := newTestAdaptiveLimiter(2, 0)
+	assert.Nil(t, a.tps)
+
+	acquired := func() bool {
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		return a.acquire(ctx) == nil
+	}
+
+	// Both transfers can run
+	require.True(t, acquired())
+	require.True(t, acquired())
+	assert.False(t, acquired())
+
+	// After backing off only one can run
+	window(10, 10)
+	a.release()
+	assert.False(t, acquired())
+	a.release()
+	require.True(t, acquired())
+	assert.False(t, acquired())
+
+	// A waiting transfer starts when it recovers
+	started := make(chan error)
+	go func() {
+		started <- a.acquire(ctx)
+	}()
+	select {
+	case <-started:
+		t.Fatal("transfer started before recovering")
+	case <-time.After(50 * time.Millisecond):
+	}
+	for i := 0; i < 10; i++ {
+		window(10, 0)
+	}
+	require.NoError(t, <-started)
+	a.release()
+	a.release()
+}
+
+func TestWaitAdaptive(t *testing.T) {
+	ctx := context.Background()
+
+	// Off does nothing
+	assert.Nil(t, adaptive)
+	RecordTransaction(true)
+	done, err := WaitAdaptive(ctx)
+	require.NoError(t, err)
+	done()
+
+	// On limits the transfers
+	ctx, ci := fs.AddConfig(ctx)
+	ci.AdaptiveConcurrency = true
+	ci.Transfers = 1
+	StartAdaptiveConcurrency(ctx)
+	require.NotNil(t, adaptive)
+	defer func() {
+		adaptive = nil
+	}()
+	done, err = WaitAdaptive(ctx)
+	require.NoError(t, err)
+	cancelCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = WaitAdaptive(cancelCtx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	done()
+	done, err = WaitAdaptive(ctx)
+	require.NoError(t, err)
+	done()
+}
@@ -0,0 +1,189 @@
+// Cancelling individual transfers
+
+package accounting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync/atomic"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fs/rc"
+)
+
+// ErrorTransferCancelled is returned by transfers cancelled with
+// core/transfer-cancel
+var ErrorTransferCancelled = errors.New("transfer cancelled")
+
+// lastTransferID is the ID given to the last transfer created
+var lastTransferID atomic.Int64
+
+// ID returns the unique ID of the transfer
+func (tr *Transfer) ID() int64 {
+	return tr.id
+}
+
+// Context returns a context derived from ctx which is cancelled if
+// the transfer is cancelled with Cancel. It should be used for the
+// work done by the transfer.
+func (tr *Transfer) Context(ctx context.Context) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
+	tr.mu.Lock()
+	tr.cancel = cancel
+	tr.mu.Unlock()
+	return ctx
+}
+
+// Cancel cancels the context returned by Context making the transfer
+// fail with ErrorTransferCancelled. This is only retried by --retries
+// if retry is set.
+func (tr *Transfer) Cancel(retry bool) error {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if !tr.completedAt.IsZero() {
+		return errors.New("transfer has already finished")
+	}
+	if tr.cancel == nil {
+		return errors.New("transfer can't be cancelled")
+	}
+	tr.cancelErr = ErrorTransferCancelled
+	if !retry {
+		tr.cancelErr = fserrors.NoRetryError(ErrorTransferCancelled)
+	}
+	tr.cancel()
+	fs.Logf(tr.remote, "Transfer cancelled")
+	return nil
+}
+
+// CancelledError returns the error the transfer was cancelled with
+// if err is not nil and the transfer was cancelled, otherwise err.
+func (tr *Transfer) CancelledError(err error) error {
+	if err == nil {
+		return nil
+	}
+	tr.mu.RLock()
+	defer tr.mu.RUnlock()
+	if tr.cancelErr != nil {
+		return tr.cancelErr
+	}
+	return err
+}
+
+// rcRunningStats returns the stats for a running transfer for the rc
+func (tr *Transfer) rcRunningStats() rc.Params {
+	out := tr.rcStats()
+	out["id"] = tr.id
+	out["group"] = tr.stats.group
+	tr.mu.RLock()
+	acc := tr.acc
+	tr.mu.RUnlock()
+	if acc != nil {
+		acc.rcStats(out)
+	}
+	return out
+}
+
+// runningTransfers returns the transfers running in the stats group
+// passed in, or in all the groups if it is "", in the order they
+// were started
+func runningTransfers(ctx context.Context, group string) (trs []*Transfer) {
+	var stats []*StatsInfo
+	if group != "" {
+		stats = append(stats, StatsGroup(ctx, group))
+	} else {
+		groups.mu.Lock()
+		for _, s := range groups.m {
+			stats = append(stats, s)
+		}
+		groups.mu.Unlock()
+	}
+	for _, s := range stats {
+		s.mu.RLock()
+		for _, tr := range s.startedTransfers {
+			if !tr.checking && !tr.IsDone() {
+				trs = append(trs, tr)
+			}
+		}
+		s.mu.RUnlock()
+	}
+	sort.Slice(trs, func(i, j int) bool {
+		return trs[i].id < trs[j].id
+	})
+	return trs
+}
+
+func rcTransfersList(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	group, err := in.GetString("group")
+	if rc.NotErrParamNotFound(err) {
+		return nil, err
+	}
+	transfers := []rc.Params{}
+	for _, tr := range runningTransfers(ctx, group) {
+		transfers = append(transfers, tr.rcRunningStats())
+	}
+	return rc.Params{"transfers": transfers}, nil
+}
+
+func rcTransferCancel(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	id, err := in.GetInt64("id")
+	if err != nil {
+		return nil, err
+	}
+	retry, err := in.GetBool("retry")
+	if rc.NotErrParamNotFound(err) {
+		return nil, err
+	}
+	for _, tr := range runningTransfers(ctx, "") {
+		if tr.id == id {
+			return nil, tr.Cancel(retry)
+		}
+	}
+	return nil, fmt.Errorf("transfer %d not found", id)
+}
+
+// Remote control for cancelling transfers
+func init() {
+	rc.Add(rc.Call{
+		Path:  "core/transfers-list",
+		Fn:    rcTransfersList,
+		Title: "List the running transfers.",
+		Help: `
+This lists the file transfers which are running with their IDs, which
+can be passed to core/transfer-cancel.
+
+Parameters:
+
+- group - name of the stats group to list the transfers of (optional)
+
+If group is not provided then the transfers of all groups are listed.
+
+This returns
+
+- transfers - an array of the running transfers in the order they started
+
+Each transfer has an "id" and a "group" as well as the same values as
+the "transferring" items in core/stats.
+`,
+	})
+	rc.Add(rc.Call{
+		Path:  "core/transfer-cancel",
+		Fn:    rcTransferCancel,
+		Title: "Cancel a running transfer.",
+		Help: `
+This cancels a single running transfer, leaving the others running.
+
+Parameters:
+
+- id - the ID of the transfer as returned by core/transfers-list
+- retry - set to true to retry the transfer with --retries (optional)
+
+The transfer fails with a "transfer cancelled" error. This isn't
+retried by the --retries of the sync or copy it is part of, unless
+retry is set, in which case it will be attempted again when the other
+transfers have finished.
+`,
+	})
+}
@@ -0,0 +1,90 @@
+package accounting
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fstest/mockobject"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransferCancel(t *testing.T) {
+	ctx := context.Background()
+	stats := NewStatsGroup(ctx, "TestTransferCancel")
+	defer groups.delete("TestTransferCancel")
+
+	// Start two transfers and a check
+	tr1 := newTransfer(stats, mockobject.Object("file1"), nil, nil)
+	tr2 := newTransfer(stats, mockobject.Object("file2"), nil, nil)
+	check := newCheckingTransfer(stats, mockobject.Object("file3"), "checking")
+	defer check.Done(ctx, nil)
+	ctx1 := tr1.Context(ctx)
+	ctx2 := tr2.Context(ctx)
+	acc1 := tr1.Account(ctx1, io.NopCloser(bytes.NewBufferString("file1 contents")))
+	acc2 := tr2.Account(ctx2, io.NopCloser(bytes.NewBufferString("file2 contents")))
+	assert.Greater(t, tr2.ID(), tr1.ID())
+
+	// List the transfers
+	list := rc.Calls.Get("core/transfers-list")
+	require.NotNil(t, list)
+	out, err := list.Fn(ctx, rc.Params{"group": "TestTransferCancel"})
+	require.NoError(t, err)
+	transfers := out["transfers"].([]rc.Params)
+	require.Equal(t, 2, len(transfers), "checks aren't listed")
+	assert.Equal(t, tr1.ID(), transfers[0]["id"])
+	assert.Equal(t, "file1", transfers[0]["name"])
+	assert.Equal(t, "TestTransferCancel", transfers[0]["group"])
+	assert.Equal(t, tr2.ID(), transfers[1]["id"])
+
+	// Cancel the first transfer
+	cancel := rc.Calls.Get("core/transfer-cancel")
+	require.NotNil(t, cancel)
+	_, err = cancel.Fn(ctx, rc.Params{"id": tr1.ID()})
+	require.NoError(t, err)
+
+	// The first transfer stops but the second carries on
+	assert.Equal(t, context.Canceled, ctx1.Err())
+	_, err = acc1.Read(make([]byte, 1))
+	assert.Equal(t, context.Canceled, err)
+	assert.NoError(t, ctx2.Err())
+	_, err = acc2.Read(make([]byte, 1))
+	assert.NoError(t, err)
+
+	// The cancelled transfer returns an error which isn't retried
+	err = tr1.CancelledError(context.Canceled)
+	assert.ErrorIs(t, err, ErrorTransferCancelled)
+	assert.True(t, fserrors.IsNoRetryError(err))
+	assert.NoError(t, tr1.CancelledError(nil))
+	assert.Equal(t, io.EOF, tr2.CancelledError(io.EOF))
+	tr1.Done(ctx, err)
+
+	// Only the running transfer is listed now
+	out, err = list.Fn(ctx, rc.Params{})
+	require.NoError(t, err)
+	var ids []int64
+	for _, transfer := range out["transfers"].([]rc.Params) {
+		ids = append(ids, transfer["id"].(int64))
+	}
+	assert.Contains(t, ids, tr2.ID())
+	assert.NotContains(t, ids, tr1.ID())
+
+	// Cancelling with retry returns a retriable error
+	_, err = cancel.Fn(ctx, rc.Params{"id": tr2.ID(), "retry": true})
+	require.NoError(t, err)
+	err = tr2.CancelledError(context.Canceled)
+	assert.ErrorIs(t, err, ErrorTransferCancelled)
+	assert.False(t, fserrors.IsNoRetryError(err))
+	tr2.Done(ctx, err)
+
+	// Finished and unknown transfers can't be cancelled
+	_, err = cancel.Fn(ctx, rc.Params{"id": tr1.ID()})
+	assert.ErrorContains(t, err, "not found")
+	assert.ErrorContains(t, tr1.Cancel(false), "already finished")
+	_, err = cancel.Fn(ctx, rc.Params{})
+	assert.Error(t, err)
+}
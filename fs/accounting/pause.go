@@ -0,0 +1,174 @@
+// Pausing and resuming transfers
+
+package accounting
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+)
+
+// pauseState holds whether transfers are paused
+type pauseState struct {
+	mu        sync.Mutex
+	paused    bool          // set if new transfers shouldn't start
+	suspended atomic.Bool   // set if running transfers should stop reading too
+	changed   chan struct{} // closed when the state changes
+}
+
+// pause is the global pause state
+var pause = pauseState{
+	changed: make(chan struct{}),
+}
+
+// pauseSignalOnce makes sure the pause signal handler is only started once
+var pauseSignalOnce sync.Once
+
+// set changes the state waking up anything waiting for it
+func (p *pauseState) set(paused, suspend bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.paused == paused && p.suspended.Load() == suspend {
+		return
+	}
+	p.paused = paused
+	p.suspended.Store(suspend)
+	close(p.changed)
+	p.changed = make(chan struct{})
+	switch {
+	case suspend:
+		fs.Logf(nil, "Transfers paused and running transfers suspended")
+	case paused:
+		fs.Logf(nil, "Transfers paused - running transfers will finish")
+	default:
+		fs.Logf(nil, "Transfers resumed")
+	}
+}
+
+// get returns the current state
+func (p *pauseState) get() (paused, suspended bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.paused, p.suspended.Load()
+}
+
+// wait blocks while transfers are paused, or only while running
+// transfers are suspended if suspendedOnly is set, or until ctx is
+// cancelled.
+func (p *pauseState) wait(ctx context.Context, suspendedOnly bool) error {
+	for {
+		p.mu.Lock()
+		blocked := p.suspended.Load() || (p.paused && !suspendedOnly)
+		changed := p.changed
+		p.mu.Unlock()
+		if !blocked {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// PauseTransfers stops new transfers from starting until
+// ResumeTransfers is called. Running transfers carry on unless
+// suspend is set in which case they stop reading data too.
+func PauseTransfers(suspend bool) {
+	pause.set(true, suspend)
+}
+
+// ResumeTransfers lets paused and suspended transfers carry on
+func ResumeTransfers() {
+	pause.set(false, false)
+}
+
+// TransfersPaused returns whether transfers are paused and whether
+// running transfers are suspended
+func TransfersPaused() (paused, suspended bool) {
+	return pause.get()
+}
+
+// WaitIfPaused blocks while transfers are paused. It should be called
+// before starting a transfer.
+//
+// It returns an error if ctx is cancelled while waiting.
+func WaitIfPaused(ctx context.Context) error {
+	return pause.wait(ctx, false)
+}
+
+// togglePause pauses transfers if they are running or resumes them if
+// they are paused
+func togglePause() {
+	if paused, _ := pause.get(); paused {
+		ResumeTransfers()
+	} else {
+		PauseTransfers(false)
+	}
+}
+
+// rcPauseState returns the pause state for the rc
+func rcPauseState() rc.Params {
+	paused, suspended := pause.get()
+	return rc.Params{
+		"paused":    paused,
+		"suspended": suspended,
+	}
+}
+
+// Remote control for pausing transfers
+func init() {
+	rc.Add(rc.Call{
+		Path: "core/pause",
+		Fn: func(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+			suspend, err := in.GetBool("suspend")
+			if rc.NotErrParamNotFound(err) {
+				return nil, err
+			}
+			PauseTransfers(suspend)
+			return rcPauseState(), nil
+		},
+		Title: "Pause transfers.",
+		Help: `
+This stops new transfers from starting until core/resume is called.
+Checks carry on so the transfers are queued up ready to go.
+
+Parameters:
+
+- suspend - set to true to suspend running transfers too (optional)
+
+Without suspend, running transfers carry on until they finish, so this
+can be used to drain the running transfers cleanly.
+
+With suspend=true running transfers stop reading data at the next
+buffer or chunk boundary. Note that if they are suspended for a long
+time the remote may time out the connection, in which case the
+transfer will be retried when resumed.
+
+This returns
+
+- paused - whether new transfers are paused
+- suspended - whether running transfers are suspended
+
+On Unix systems, sending rclone a SIGUSR1 signal toggles pausing
+new transfers in the same way.
+`,
+	})
+	rc.Add(rc.Call{
+		Path: "core/resume",
+		Fn: func(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+			ResumeTransfers()
+			return rcPauseState(), nil
+		},
+		Title: "Resume paused transfers.",
+		Help: `
+This resumes the transfers paused or suspended with core/pause.
+
+It returns the same values as core/pause.
+`,
+	})
+}
@@ -0,0 +1,111 @@
+package accounting
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// waitDone returns true if done is closed within a short time
+func waitDone(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	case <-time.After(100 * time.Millisecond):
+		return false
+	}
+}
+
+func TestWaitIfPaused(t *testing.T) {
+	ctx := context.Background()
+	defer ResumeTransfers()
+
+	// Not paused
+	require.NoError(t, WaitIfPaused(ctx))
+
+	PauseTransfers(false)
+	paused, suspended := TransfersPaused()
+	assert.True(t, paused)
+	assert.False(t, suspended)
+
+	done := make(chan struct{})
+	go func() {
+		assert.NoError(t, WaitIfPaused(ctx))
+		close(done)
+	}()
+	assert.False(t, waitDone(done), "WaitIfPaused returned while paused")
+
+	ResumeTransfers()
+	assert.True(t, waitDone(done), "WaitIfPaused didn't return when resumed")
+
+	// Cancelling the context stops the wait
+	PauseTransfers(false)
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Equal(t, context.Canceled, WaitIfPaused(ctx))
+}
+
+func TestAccountSuspend(t *testing.T) {
+	ctx := context.Background()
+	defer ResumeTransfers()
+	in := io.NopCloser(bytes.NewBuffer([]byte{1, 2, 3}))
+	stats := NewStats(ctx)
+	acc := newAccountSizeName(ctx, stats, in, 3, "test")
+	buf := make([]byte, 1)
+
+	// Pausing without suspend lets running transfers carry on
+	PauseTransfers(false)
+	n, err := acc.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	// Suspending blocks reads until resumed
+	PauseTransfers(true)
+	done := make(chan struct{})
+	go func() {
+		n, err := acc.Read(buf)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+		close(done)
+	}()
+	assert.False(t, waitDone(done), "Read returned while suspended")
+	assert.Equal(t, int64(1), stats.GetBytes())
+
+	ResumeTransfers()
+	assert.True(t, waitDone(done), "Read didn't return when resumed")
+	assert.Equal(t, int64(2), stats.GetBytes())
+}
+
+func TestRcPauseResume(t *testing.T) {
+	ctx := context.Background()
+	defer ResumeTransfers()
+
+	call := rc.Calls.Get("core/pause")
+	require.NotNil(t, call)
+	out, err := call.Fn(ctx, rc.Params{"suspend": true})
+	require.NoError(t, err)
+	assert.Equal(t, rc.Params{"paused": true, "suspended": true}, out)
+
+	out, err = call.Fn(ctx, rc.Params{})
+	require.NoError(t, err)
+	assert.Equal(t, rc.Params{"paused": true, "suspended": false}, out)
+
+	call = rc.Calls.Get("core/resume")
+	require.NotNil(t, call)
+	out, err = call.Fn(ctx, rc.Params{})
+	require.NoError(t, err)
+	assert.Equal(t, rc.Params{"paused": false, "suspended": false}, out)
+
+	togglePause()
+	paused, _ := TransfersPaused()
+	assert.True(t, paused)
+	togglePause()
+	paused, _ = TransfersPaused()
+	assert.False(t, paused)
+}
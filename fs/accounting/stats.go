@@ -51,6 +51,7 @@ type StatsInfo struct {
 	deletes             int64
 	deletesSize         int64
 	deletedDirs         int64
+	skipped             [numSkipReasons]int64 // files skipped indexed by SkipReason
 	inProgress          *inProgress
 	startedTransfers    []*Transfer   // currently active transfers
 	oldTimeRanges       timeRanges    // a merged list of time ranges for the transfers
@@ -113,6 +114,12 @@ func (s *StatsInfo) RemoteStats() (out rc.Params, err error) {
 	out["deletes"] = s.deletes
 	out["deletedDirs"] = s.deletedDirs
 	out["renames"] = s.renames
+	out["skippedExisting"] = s.skipped[SkipExisting]
+	skipped := make(rc.Params, numSkipReasons)
+	for reason, n := range s.skipped {
+		skipped[SkipReason(reason).String()] = n
+	}
+	out["skipped"] = skipped
 	out["elapsedTime"] = time.Since(s.startTime).Seconds()
 	out["serverSideCopies"] = s.serverSideCopies
 	out["serverSideCopyBytes"] = s.serverSideCopyBytes
@@ -385,6 +392,20 @@ func (s *StatsInfo) stopAverageLoop() {
 
 // String convert the StatsInfo to a string for printing
 func (s *StatsInfo) String() string {
+	return s.string(0)
+}
+
+// StringWithProgressBars is like String but shows a progress bar
+// width columns wide for each file being transferred instead of a
+// single line summary.
+func (s *StatsInfo) StringWithProgressBars(width int) string {
+	return s.string(width)
+}
+
+// string converts the StatsInfo to a string for printing. If
+// barWidth > 0 then each transfer is shown with a progress bar of
+// that width.
+func (s *StatsInfo) string(barWidth int) string {
 	// NB if adding more stats in here, remember to add them into
 	// RemoteStats() too.
 
@@ -469,6 +490,13 @@ func (s *StatsInfo) String() string {
 		if s.renames != 0 {
 			_, _ = fmt.Fprintf(buf, "Renamed:       %10d\n", s.renames)
 		}
+		if s.ci.StatsSkipped {
+			if total, reasons := s._skippedReasons(); total != 0 {
+				_, _ = fmt.Fprintf(buf, "Skipped:       %10d (%s)\n", total, reasons)
+			}
+		} else if s.skipped[SkipExisting] != 0 {
+			_, _ = fmt.Fprintf(buf, "Skipped:       %10d (existing files)\n", s.skipped[SkipExisting])
+		}
 		if s.transfers != 0 || ts.totalTransfers != 0 {
 			_, _ = fmt.Fprintf(buf, "Transferred:   %10d / %d, %s\n",
 				s.transfers, ts.totalTransfers, percent(s.transfers, ts.totalTransfers))
@@ -496,7 +524,11 @@ func (s *StatsInfo) String() string {
 			_, _ = fmt.Fprintf(buf, "Checking:\n%s\n", s.checking.String(s.ctx, s.inProgress, s.transferring))
 		}
 		if !s.transferring.empty() {
-			_, _ = fmt.Fprintf(buf, "Transferring:\n%s\n", s.transferring.String(s.ctx, s.inProgress, nil))
+			if barWidth > 0 {
+				_, _ = fmt.Fprintf(buf, "Transferring:\n%s\n", s.transferring.progressBars(s.ctx, s.inProgress, barWidth))
+			} else {
+				_, _ = fmt.Fprintf(buf, "Transferring:\n%s\n", s.transferring.String(s.ctx, s.inProgress, nil))
+			}
 		}
 	}
 
@@ -654,6 +686,19 @@ func (s *StatsInfo) DeleteFile(ctx context.Context, size int64) error {
 	return nil
 }
 
+// UndoDeleteFile undoes the DeleteFile of a file of size which
+// wasn't deleted after all, so it doesn't count towards the stats or
+// --max-delete and --max-delete-size
+func (s *StatsInfo) UndoDeleteFile(size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if size < 0 {
+		size = 0
+	}
+	s.deletes--
+	s.deletesSize -= size
+}
+
 // GetDeletes returns the number of deletes
 func (s *StatsInfo) GetDeletes() int64 {
 	s.mu.Lock()
@@ -677,7 +722,66 @@ func (s *StatsInfo) Renames(renames int64) int64 {
 	return s.renames
 }
 
-// ResetCounters sets the counters (bytes, checks, errors, transfers, deletes, renames) to 0 and resets lastError, fatalError and retryError
+// SkipReason is the reason a file wasn't transferred
+type SkipReason int
+
+// Reasons for skipping files
+const (
+	SkipUnchanged SkipReason = iota // the destination is the same as the source
+	SkipFiltered                    // the source was excluded by the filters
+	SkipExisting                    // the destination exists, e.g. with --ignore-existing
+	SkipNewer                       // the destination is newer with --update
+	SkipError                       // an error stopped the file being transferred
+	numSkipReasons
+)
+
+var skipReasonNames = [numSkipReasons]string{
+	SkipUnchanged: "unchanged",
+	SkipFiltered:  "filtered",
+	SkipExisting:  "existing",
+	SkipNewer:     "newer",
+	SkipError:     "error",
+}
+
+// String returns the name of the reason as used in the stats
+func (reason SkipReason) String() string {
+	if reason < 0 || reason >= numSkipReasons {
+		return fmt.Sprintf("SkipReason(%d)", int(reason))
+	}
+	return skipReasonNames[reason]
+}
+
+// Skipped updates the stats for files skipped for reason returning
+// the number skipped for that reason so far
+func (s *StatsInfo) Skipped(reason SkipReason, skipped int64) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.skipped[reason] += skipped
+	return s.skipped[reason]
+}
+
+// SkippedExisting updates the stats for files skipped because they
+// exist on the destination
+func (s *StatsInfo) SkippedExisting(skipped int64) int64 {
+	return s.Skipped(SkipExisting, skipped)
+}
+
+// _skippedReasons returns the total number of files skipped and the
+// non zero reasons for it, e.g. "3 unchanged, 1 filtered"
+//
+// Call with lock held
+func (s *StatsInfo) _skippedReasons() (total int64, reasons string) {
+	var out []string
+	for reason, n := range s.skipped {
+		if n != 0 {
+			total += n
+			out = append(out, fmt.Sprintf("%d %s", n, SkipReason(reason)))
+		}
+	}
+	return total, strings.Join(out, ", ")
+}
+
+// ResetCounters sets the counters (bytes, checks, errors, transfers, deletes, renames, skipped) to 0 and resets lastError, fatalError and retryError
 func (s *StatsInfo) ResetCounters() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -693,6 +797,7 @@ func (s *StatsInfo) ResetCounters() {
 	s.deletesSize = 0
 	s.deletedDirs = 0
 	s.renames = 0
+	s.skipped = [numSkipReasons]int64{}
 	s.startedTransfers = nil
 	s.oldDuration = 0
 
@@ -787,6 +892,7 @@ func (s *StatsInfo) NewTransfer(obj fs.DirEntry, dstFs fs.Fs) *Transfer {
 	tr := newTransfer(s, obj, srcFs, dstFs)
 	s.transferring.add(tr)
 	s.startAverageLoop()
+	events.publish(transferStart, tr)
 	return tr
 }
 
@@ -795,6 +901,7 @@ func (s *StatsInfo) NewTransferRemoteSize(remote string, size int64, srcFs, dstF
 	tr := newTransferRemoteSize(s, remote, size, false, "", srcFs, dstFs)
 	s.transferring.add(tr)
 	s.startAverageLoop()
+	events.publish(transferStart, tr)
 	return tr
 }
 
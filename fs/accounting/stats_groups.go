@@ -97,6 +97,8 @@ Returns the following values:
 	"lastError": last error string,
 	"renames" : number of files renamed,
 	"retryError": boolean showing whether there has been at least one non-NoRetryError,
+	"skipped": number of files skipped for each reason - unchanged, filtered, existing, newer or error,
+	"skippedExisting": number of files skipped as they exist on the destination,
         "serverSideCopies": number of server side copies done,
         "serverSideCopyBytes": number bytes server side copied,
         "serverSideMoves": number of server side moves done,
@@ -388,6 +390,9 @@ func (sg *statsGroups) sum(ctx context.Context) *StatsInfo {
 			sum.renameQueueSize += stats.renameQueueSize
 			sum.deletes += stats.deletes
 			sum.deletedDirs += stats.deletedDirs
+			for reason, n := range stats.skipped {
+				sum.skipped[reason] += n
+			}
 			sum.inProgress.merge(stats.inProgress)
 			sum.startedTransfers = append(sum.startedTransfers, stats.startedTransfers...)
 			sum.oldTimeRanges = append(sum.oldTimeRanges, stats.oldTimeRanges...)
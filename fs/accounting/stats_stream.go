@@ -0,0 +1,318 @@
+package accounting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+)
+
+// Types of transfer event
+const (
+	transferStart    = "transferStart"
+	transferProgress = "transferProgress"
+	transferComplete = "transferComplete"
+	statsDelta       = "stats"
+)
+
+// transferEvent is sent to subscribers when a transfer starts or
+// completes
+type transferEvent struct {
+	what string
+	tr   *Transfer
+}
+
+// transferEvents distributes transfer events to subscribers
+type transferEvents struct {
+	active atomic.Int32 // number of subscribers - read without the lock
+	mu     sync.Mutex
+	subs   map[chan transferEvent]struct{}
+}
+
+// events is the global distributor of transfer events
+var events = transferEvents{
+	subs: make(map[chan transferEvent]struct{}),
+}
+
+// subscribe returns a channel which receives transfer events
+//
+// Call unsubscribe when finished with it.
+func (e *transferEvents) subscribe() chan transferEvent {
+	ch := make(chan transferEvent, 1024)
+	e.mu.Lock()
+	e.subs[ch] = struct{}{}
+	e.active.Add(1)
+	e.mu.Unlock()
+	return ch
+}
+
+// unsubscribe stops ch receiving transfer events
+func (e *transferEvents) unsubscribe(ch chan transferEvent) {
+	e.mu.Lock()
+	delete(e.subs, ch)
+	e.active.Add(-1)
+	e.mu.Unlock()
+}
+
+// publish sends the event to all subscribers
+//
+// This never blocks - if a subscriber isn't keeping up the event is
+// dropped for that subscriber.
+func (e *transferEvents) publish(what string, tr *Transfer) {
+	if e.active.Load() == 0 {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for ch := range e.subs {
+		select {
+		case ch <- transferEvent{what: what, tr: tr}:
+		default:
+			fs.Debugf(nil, "core/stats-stream: dropping %s event for %q", what, tr.remote)
+		}
+	}
+}
+
+// rcEvent returns the transfer as an rc event of type what
+func (tr *Transfer) rcEvent(what string) rc.Params {
+	out := tr.rcStats()
+	out["type"] = what
+	out["group"] = tr.stats.group
+	switch what {
+	case transferProgress:
+		tr.mu.RLock()
+		acc := tr.acc
+		tr.mu.RUnlock()
+		if acc != nil {
+			acc.rcStats(out)
+		}
+	case transferComplete:
+		snapshot := tr.Snapshot()
+		out["bytes"] = snapshot.Bytes
+		out["error"] = ""
+		if snapshot.Error != nil {
+			out["error"] = snapshot.Error.Error()
+		}
+	}
+	return out
+}
+
+// statsStream writes events from the stats to w
+type statsStream struct {
+	group    string              // group to stream or "" for all
+	interval time.Duration       // how often to send progress
+	enc      *json.Encoder       // to write the events
+	flusher  http.Flusher        // to flush the events - may be nil
+	active   map[*Transfer]int64 // active transfers and bytes sent
+	last     rc.Params           // stats last sent
+	events   chan transferEvent  // incoming transfer events
+}
+
+// send writes the event and flushes it to the client
+func (ss *statsStream) send(event rc.Params) error {
+	err := ss.enc.Encode(event)
+	if err != nil {
+		return err
+	}
+	if ss.flusher != nil {
+		ss.flusher.Flush()
+	}
+	return nil
+}
+
+// sendTransfer sends an event for a transfer start or complete
+func (ss *statsStream) sendTransfer(ev transferEvent) error {
+	if ss.group != "" && ev.tr.stats.group != ss.group {
+		return nil
+	}
+	switch ev.what {
+	case transferStart:
+		ss.active[ev.tr] = -1
+	case transferComplete:
+		if _, ok := ss.active[ev.tr]; !ok {
+			// didn't see the start so ignore
+			return nil
+		}
+		delete(ss.active, ev.tr)
+	}
+	return ss.send(ev.tr.rcEvent(ev.what))
+}
+
+// sendProgress sends progress of the active transfers if it has
+// changed and the changes in the stats since they were last sent.
+//
+// Transfers which are done but whose complete event was dropped are
+// sent as complete and forgotten here.
+func (ss *statsStream) sendProgress(ctx context.Context) error {
+	for tr, lastBytes := range ss.active {
+		if tr.IsDone() {
+			delete(ss.active, tr)
+			err := ss.send(tr.rcEvent(transferComplete))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		event := tr.rcEvent(transferProgress)
+		bytes, _ := event["bytes"].(int64)
+		if _, ok := event["bytes"]; !ok || bytes == lastBytes {
+			continue
+		}
+		ss.active[tr] = bytes
+		err := ss.send(event)
+		if err != nil {
+			return err
+		}
+	}
+
+	var stats *StatsInfo
+	if ss.group != "" {
+		stats = StatsGroup(ctx, ss.group)
+	} else {
+		stats = groups.sum(ctx)
+	}
+	current, err := stats.RemoteStats()
+	if err != nil {
+		return err
+	}
+	delta := rc.Params{}
+	for k, v := range current {
+		switch k {
+		case "transferring", "checking", "elapsedTime":
+			// sent as transfer events or always changing
+			continue
+		}
+		if old, ok := ss.last[k]; !ok || !reflect.DeepEqual(old, v) {
+			delta[k] = v
+		}
+	}
+	ss.last = current
+	if len(delta) == 0 {
+		return nil
+	}
+	delta["elapsedTime"] = current["elapsedTime"]
+	return ss.send(rc.Params{
+		"type":  statsDelta,
+		"stats": delta,
+	})
+}
+
+// run sends events until the context is cancelled or the duration
+// expires (if it is non zero)
+func (ss *statsStream) run(ctx context.Context, duration time.Duration) error {
+	if duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, duration)
+		defer cancel()
+	}
+	ticker := time.NewTicker(ss.interval)
+	defer ticker.Stop()
+	err := ss.sendProgress(ctx)
+	for err == nil {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev := <-ss.events:
+			err = ss.sendTransfer(ev)
+		case <-ticker.C:
+			err = ss.sendProgress(ctx)
+		}
+	}
+	return err
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:          "core/stats-stream",
+		Fn:            rcStatsStream,
+		NeedsResponse: true,
+		Title:         "Streams stats and transfer events as they happen.",
+		Help: `
+This streams stats and transfer events to the client as they happen
+so there is no need to poll core/stats.
+
+	curl -N -X POST http://localhost:5572/core/stats-stream
+
+The events are written to the HTTP response as they happen, one JSON
+object per line, until the client disconnects or the duration
+expires. The stream ends with an empty object {}.
+
+Parameters
+
+- group - name of the stats group (string)
+- interval - how often to send progress and stats, default "1s" (Duration)
+- duration - stop streaming after this long, default until the client disconnects (Duration)
+
+If group is not provided then summed up stats and the transfers of all
+groups will be streamed.
+
+Each event has a "type" which is one of
+
+- stats - the values from core/stats which have changed since last sent in "stats"
+- transferStart - a transfer has started
+- transferProgress - progress of a transfer which has changed since last sent
+- transferComplete - a transfer has finished, "error" is set if it failed
+
+The transfer events have the same values as the "transferring" items
+in core/stats along with the "group" of the transfer. Events for a
+transfer are always sent in the order transferStart, transferProgress,
+transferComplete.
+
+Transfers which were already running when the stream started aren't
+reported.
+
+` + "```" + `
+{"stats":{"bytes":0,"checks":0,...,"elapsedTime":1.5},"type":"stats"}
+{"group":"job/1","name":"file.txt","size":1048576,"type":"transferStart"}
+{"bytes":524288,"eta":1,"group":"job/1","name":"file.txt","percentage":50,"size":1048576,"speed":524288,"speedAvg":524288,"type":"transferProgress"}
+{"bytes":1048576,"error":"","group":"job/1","name":"file.txt","size":1048576,"type":"transferComplete"}
+{"stats":{"bytes":1048576,"elapsedTime":2.5,"transfers":1,...},"type":"stats"}
+` + "```" + `
+`,
+	})
+}
+
+// Stream the stats and transfer events
+func rcStatsStream(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	group, err := in.GetString("group")
+	if rc.NotErrParamNotFound(err) {
+		return nil, err
+	}
+	interval, err := in.GetDuration("interval")
+	if rc.IsErrParamNotFound(err) {
+		interval = time.Second
+	} else if err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		return nil, errors.New("interval must be positive")
+	}
+	duration, err := in.GetDuration("duration")
+	if rc.NotErrParamNotFound(err) {
+		return nil, err
+	}
+	w, err := in.GetHTTPResponseWriter()
+	if err != nil {
+		return nil, fmt.Errorf("response object is required: %w", err)
+	}
+
+	ss := &statsStream{
+		group:    group,
+		interval: interval,
+		enc:      json.NewEncoder(w),
+		active:   make(map[*Transfer]int64),
+		events:   events.subscribe(),
+	}
+	defer events.unsubscribe(ss.events)
+	ss.flusher, _ = w.(http.Flusher)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	return nil, ss.run(ctx, duration)
+}
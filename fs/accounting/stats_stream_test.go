@@ -0,0 +1,175 @@
+package accounting
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsStream(t *testing.T) {
+	ctx := context.Background()
+	const group = "test-stats-stream"
+	defer groups.delete(group)
+
+	call := rc.Calls.Get("core/stats-stream")
+	require.NotNil(t, call)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := call.Fn(r.Context(), rc.Params{
+			"group":     group,
+			"interval":  "10ms",
+			"_response": w,
+		})
+		assert.NoError(t, err)
+	}))
+	defer server.Close()
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req, err := http.NewRequestWithContext(streamCtx, "GET", server.URL, nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+
+	// Read the events from the stream as they arrive
+	eventsIn := make(chan rc.Params, 100)
+	go func() {
+		defer close(eventsIn)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			var event rc.Params
+			if err := json.Unmarshal(scanner.Bytes(), &event); err == nil {
+				eventsIn <- event
+			}
+		}
+	}()
+	var got []rc.Params
+	waitFor := func(eventType string) rc.Params {
+		timeout := time.After(10 * time.Second)
+		for {
+			select {
+			case event, ok := <-eventsIn:
+				require.True(t, ok, "stream closed waiting for %q", eventType)
+				got = append(got, event)
+				if event["type"] == eventType {
+					return event
+				}
+			case <-timeout:
+				t.Fatalf("timed out waiting for %q", eventType)
+			}
+		}
+	}
+
+	// The stream starts with the stats
+	stats := waitFor("stats")["stats"].(map[string]interface{})
+	assert.Equal(t, float64(0), stats["transfers"])
+
+	// Run a transfer while the stream is being read
+	s := StatsGroup(ctx, group)
+	tr := s.NewTransferRemoteSize("file.txt", 10, nil, nil)
+	acc := tr.Account(ctx, io.NopCloser(strings.NewReader("0123456789")))
+	start := waitFor("transferStart")
+	assert.Equal(t, "file.txt", start["name"])
+	assert.Equal(t, group, start["group"])
+	assert.Equal(t, float64(10), start["size"])
+
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(acc, buf)
+	require.NoError(t, err)
+	progress := waitFor("transferProgress")
+	assert.Equal(t, "file.txt", progress["name"])
+	assert.Equal(t, float64(5), progress["bytes"])
+	assert.Equal(t, float64(50), progress["percentage"])
+
+	_, err = io.ReadFull(acc, buf)
+	require.NoError(t, err)
+	tr.Done(ctx, nil)
+	complete := waitFor("transferComplete")
+	assert.Equal(t, "file.txt", complete["name"])
+	assert.Equal(t, float64(10), complete["bytes"])
+	assert.Equal(t, "", complete["error"])
+
+	// The stats should show the transfer
+	for {
+		stats = waitFor("stats")["stats"].(map[string]interface{})
+		if stats["transfers"] == float64(1) {
+			break
+		}
+	}
+
+	// Check the events for the transfer were in order
+	var order []string
+	for _, event := range got {
+		if event["name"] == "file.txt" {
+			order = append(order, event["type"].(string))
+		}
+	}
+	require.True(t, len(order) >= 3, order)
+	assert.Equal(t, "transferStart", order[0])
+	assert.Equal(t, "transferComplete", order[len(order)-1])
+	for _, eventType := range order[1 : len(order)-1] {
+		assert.Equal(t, "transferProgress", eventType)
+	}
+}
+
+func TestStatsStreamMissedComplete(t *testing.T) {
+	ctx := context.Background()
+	const group = "test-stats-stream-missed"
+	defer groups.delete(group)
+	var buf strings.Builder
+	ss := &statsStream{
+		group:  group,
+		enc:    json.NewEncoder(&buf),
+		active: make(map[*Transfer]int64),
+	}
+
+	// A transfer whose complete event was dropped
+	s := StatsGroup(ctx, group)
+	tr := s.NewTransferRemoteSize("file.txt", 10, nil, nil)
+	require.NoError(t, ss.sendTransfer(transferEvent{what: transferStart, tr: tr}))
+	tr.Done(ctx, nil)
+
+	// is sent as complete and forgotten by the next progress
+	buf.Reset()
+	require.NoError(t, ss.sendProgress(ctx))
+	assert.Empty(t, ss.active)
+	assert.Contains(t, buf.String(), `"type":"transferComplete"`)
+
+	// and the complete event turning up late is ignored
+	buf.Reset()
+	require.NoError(t, ss.sendTransfer(transferEvent{what: transferComplete, tr: tr}))
+	assert.Equal(t, "", buf.String())
+}
+
+func TestStatsStreamDuration(t *testing.T) {
+	call := rc.Calls.Get("core/stats-stream")
+	require.NotNil(t, call)
+	w := httptest.NewRecorder()
+	start := time.Now()
+	_, err := call.Fn(context.Background(), rc.Params{
+		"duration":  "50ms",
+		"_response": w,
+	})
+	require.NoError(t, err)
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+	assert.True(t, strings.HasPrefix(w.Body.String(), `{"stats":{`), w.Body.String())
+
+	_, err = call.Fn(context.Background(), rc.Params{
+		"interval":  "0s",
+		"_response": w,
+	})
+	assert.Error(t, err)
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fs/rc"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -273,6 +274,45 @@ func TestRemoteStats(t *testing.T) {
 	})
 }
 
+func TestStatsSkipped(t *testing.T) {
+	ctx, ci := fs.AddConfig(context.Background())
+	s := NewStats(ctx)
+
+	s.Skipped(SkipUnchanged, 3)
+	s.Skipped(SkipFiltered, 2)
+	assert.Equal(t, int64(1), s.SkippedExisting(1))
+	assert.Equal(t, int64(4), s.Skipped(SkipUnchanged, 1))
+
+	// Without --stats-skipped only the existing files are shown
+	assert.Contains(t, s.String(), "Skipped:                1 (existing files)\n")
+
+	ci.StatsSkipped = true
+	assert.Contains(t, s.String(), "Skipped:                7 (4 unchanged, 2 filtered, 1 existing)\n")
+
+	rs, err := s.RemoteStats()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), rs["skippedExisting"])
+	assert.Equal(t, rc.Params{
+		"unchanged": int64(4),
+		"filtered":  int64(2),
+		"existing":  int64(1),
+		"newer":     int64(0),
+		"error":     int64(0),
+	}, rs["skipped"])
+
+	// The reasons are summed over the groups
+	sg := newStatsGroups()
+	s2 := NewStats(ctx)
+	s2.Skipped(SkipError, 2)
+	sg.set(ctx, "a", s)
+	sg.set(ctx, "b", s2)
+	assert.Contains(t, sg.sum(ctx).String(), "Skipped:                9 (4 unchanged, 2 filtered, 1 existing, 2 error)\n")
+
+	s.ResetCounters()
+	assert.NotContains(t, s.String(), "Skipped:")
+	assert.Equal(t, "SkipReason(99)", SkipReason(99).String())
+}
+
 // make time ranges from string description for testing
 func makeTimeRanges(t *testing.T, in []string) timeRanges {
 	trs := make(timeRanges, len(in))
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/fs/rc"
 )
 
@@ -47,6 +48,7 @@ func (as TransferSnapshot) MarshalJSON() ([]byte, error) {
 // Transfer needs to be closed on completion.
 type Transfer struct {
 	// these are initialised at creation and may be accessed without locking
+	id        int64 // unique ID of the transfer
 	stats     *StatsInfo
 	remote    string
 	size      int64
@@ -65,6 +67,9 @@ type Transfer struct {
 	acc         *Account
 	err         error
 	completedAt time.Time
+	cancel      context.CancelFunc // cancels the context returned by Context - may be nil
+	cancelErr   error              // the error to return if the transfer was cancelled
+	hash        string             // hash of the file transferred as "type:sum" if known
 }
 
 // newCheckingTransfer instantiates new checking of the object.
@@ -79,6 +84,7 @@ func newTransfer(stats *StatsInfo, obj fs.DirEntry, srcFs, dstFs fs.Fs) *Transfe
 
 func newTransferRemoteSize(stats *StatsInfo, remote string, size int64, checking bool, what string, srcFs, dstFs fs.Fs) *Transfer {
 	tr := &Transfer{
+		id:        lastTransferID.Add(1),
 		stats:     stats,
 		remote:    remote,
 		size:      size,
@@ -121,12 +127,19 @@ func (tr *Transfer) Done(ctx context.Context, err error) {
 
 	tr.mu.Lock()
 	tr.completedAt = time.Now()
+	if tr.cancel != nil {
+		tr.cancel() // free the resources of the context
+	}
 	tr.mu.Unlock()
 
 	if tr.checking {
 		tr.stats.DoneChecking(tr.remote)
 	} else {
 		tr.stats.DoneTransferring(tr.remote, err == nil)
+		events.publish(transferComplete, tr)
+		if globalTransferLog != nil {
+			globalTransferLog.add(tr)
+		}
 	}
 	tr.stats.PruneTransfers()
 }
@@ -160,6 +173,17 @@ func (tr *Transfer) Account(ctx context.Context, in io.ReadCloser) *Account {
 	return tr.acc
 }
 
+// SetHash records the hash of the file transferred, as checked after
+// the transfer, for the --transfer-log
+func (tr *Transfer) SetHash(ht hash.Type, sum string) {
+	if ht == hash.None || sum == "" {
+		return
+	}
+	tr.mu.Lock()
+	tr.hash = ht.String() + ":" + sum
+	tr.mu.Unlock()
+}
+
 // TimeRange returns the time transfer started and ended at. If not completed
 // it will return zero time for end time.
 func (tr *Transfer) TimeRange() (time.Time, time.Time) {
@@ -0,0 +1,183 @@
+package accounting
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/atexit"
+)
+
+// transferLogHeader is the first row of a new transfer log
+var transferLogHeader = []string{
+	"started_at",
+	"completed_at",
+	"duration",
+	"src_fs",
+	"dst_fs",
+	"path",
+	"size",
+	"bytes",
+	"hash",
+	"status",
+	"error",
+}
+
+// transferLogTimeFormat is the format of the times in the transfer log
+const transferLogTimeFormat = time.RFC3339Nano
+
+// transferLog appends a CSV record of each completed transfer to a
+// file.
+//
+// Records are written by a background go routine which writes as many
+// records as are waiting before flushing them to the file so that
+// recording a transfer doesn't slow it down. If the writer falls
+// behind so far that transferLogBuffer records are waiting then the
+// transfers wait for it so no records are lost.
+type transferLog struct {
+	f       *os.File
+	w       *csv.Writer
+	records chan []string
+	done    chan struct{}
+	once    sync.Once
+	mu      sync.Mutex // held while queueing a record and closing records
+	closed  bool       // set when records has been closed
+}
+
+// transferLogBuffer is the number of records which can be waiting to
+// be written
+const transferLogBuffer = 1024
+
+// the global transfer log if --transfer-log is set
+var globalTransferLog *transferLog
+
+// StartTransferLog opens the --transfer-log file if set
+func StartTransferLog(ctx context.Context) {
+	ci := fs.GetConfig(ctx)
+	if ci.TransferLog == "" {
+		return
+	}
+	tl, err := newTransferLog(ci.TransferLog)
+	if err != nil {
+		log.Fatalf("--transfer-log: %v", err)
+	}
+	globalTransferLog = tl
+	atexit.Register(func() {
+		if err := tl.close(); err != nil {
+			fs.Errorf(nil, "--transfer-log: %v", err)
+		}
+	})
+	fs.Infof(nil, "Logging transfers to %q", ci.TransferLog)
+}
+
+// newTransferLog opens path for appending records to, writing the
+// header row if it is a new file.
+func newTransferLog(path string) (*transferLog, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open transfer log: %w", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("failed to stat transfer log: %w", err)
+	}
+	tl := &transferLog{
+		f:       f,
+		w:       csv.NewWriter(f),
+		records: make(chan []string, transferLogBuffer),
+		done:    make(chan struct{}),
+	}
+	if fi.Size() == 0 {
+		_ = tl.w.Write(transferLogHeader)
+	}
+	go tl.writer()
+	return tl, nil
+}
+
+// writer writes the records to the file, flushing once there are no
+// more waiting.
+func (tl *transferLog) writer() {
+	defer close(tl.done)
+	for record := range tl.records {
+		_ = tl.w.Write(record)
+	drain:
+		for {
+			select {
+			case record, ok := <-tl.records:
+				if !ok {
+					break drain
+				}
+				_ = tl.w.Write(record)
+			default:
+				break drain
+			}
+		}
+		tl.w.Flush()
+		if err := tl.w.Error(); err != nil {
+			fs.Errorf(nil, "--transfer-log: failed to write: %v", err)
+		}
+	}
+	tl.w.Flush()
+}
+
+// add queues a record of the transfer for writing
+func (tl *transferLog) add(tr *Transfer) {
+	s := tr.Snapshot()
+	tr.mu.RLock()
+	hashString := tr.hash
+	tr.mu.RUnlock()
+	status, errString := "ok", ""
+	if s.Error != nil {
+		status, errString = "error", s.Error.Error()
+	}
+	tl.queue(s.Name, []string{
+		s.StartedAt.Format(transferLogTimeFormat),
+		s.CompletedAt.Format(transferLogTimeFormat),
+		strconv.FormatFloat(s.CompletedAt.Sub(s.StartedAt).Seconds(), 'f', -1, 64),
+		s.SrcFs,
+		s.DstFs,
+		s.Name,
+		strconv.FormatInt(s.Size, 10),
+		strconv.FormatInt(s.Bytes, 10),
+		hashString,
+		status,
+		errString,
+	})
+}
+
+// queue queues record of the transfer of remote for writing, waiting
+// for the writer if too many records are waiting
+func (tl *transferLog) queue(remote string, record []string) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	if tl.closed {
+		fs.Errorf(nil, "--transfer-log: can't record transfer of %q as the log has been closed", remote)
+		return
+	}
+	tl.records <- record
+}
+
+// close writes any outstanding records and closes the file
+func (tl *transferLog) close() (err error) {
+	tl.once.Do(func() {
+		tl.mu.Lock()
+		tl.closed = true
+		close(tl.records)
+		tl.mu.Unlock()
+		<-tl.done
+		if wErr := tl.w.Error(); wErr != nil {
+			err = fmt.Errorf("failed to write transfer log: %w", wErr)
+		}
+		if cErr := tl.f.Close(); cErr != nil && err == nil {
+			err = fmt.Errorf("failed to close transfer log: %w", cErr)
+		}
+	})
+	return err
+}
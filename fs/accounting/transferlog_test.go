@@ -0,0 +1,159 @@
+package accounting
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readTransferLog reads the CSV transfer log at path
+func readTransferLog(t *testing.T, path string) [][]string {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, f.Close())
+	}()
+	records, err := csv.NewReader(f).ReadAll()
+	require.NoError(t, err)
+	return records
+}
+
+func TestTransferLog(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "transfers.csv")
+
+	// run does some transfers with the log open then closes it
+	run := func(remotes ...string) {
+		tl, err := newTransferLog(path)
+		require.NoError(t, err)
+		oldTransferLog := globalTransferLog
+		globalTransferLog = tl
+		defer func() {
+			globalTransferLog = oldTransferLog
+		}()
+
+		s := NewStats(ctx)
+		for i, remote := range remotes {
+			tr := s.NewTransferRemoteSize(remote, 3, nil, nil)
+			acc := tr.Account(ctx, io.NopCloser(bytes.NewBuffer([]byte{1, 2, 3})))
+			_, err := io.ReadAll(acc)
+			require.NoError(t, err)
+			var trErr error
+			if i == 1 {
+				trErr = errors.New("potato")
+			} else {
+				tr.SetHash(hash.MD5, "5289df737df57326fcdd22597afb1fac")
+			}
+			tr.Done(ctx, trErr)
+		}
+
+		// Checks aren't logged
+		tr := newTransferRemoteSize(s, "checked", 1, true, "checking", nil, nil)
+		tr.Done(ctx, nil)
+
+		require.NoError(t, tl.close())
+		require.NoError(t, tl.close()) // check double close is OK
+	}
+
+	start := time.Now().Add(-time.Second)
+	run("file1", "dir/file2")
+	records := readTransferLog(t, path)
+	require.Equal(t, 3, len(records))
+	assert.Equal(t, transferLogHeader, records[0])
+
+	for i, want := range []struct {
+		path   string
+		hash   string
+		status string
+		err    string
+	}{
+		{"file1", "md5:5289df737df57326fcdd22597afb1fac", "ok", ""},
+		{"dir/file2", "", "error", "potato"},
+	} {
+		record := records[i+1]
+		require.Equal(t, len(transferLogHeader), len(record))
+		startedAt, err := time.Parse(transferLogTimeFormat, record[0])
+		require.NoError(t, err)
+		completedAt, err := time.Parse(transferLogTimeFormat, record[1])
+		require.NoError(t, err)
+		assert.True(t, startedAt.After(start))
+		assert.False(t, completedAt.Before(startedAt))
+		duration, err := strconv.ParseFloat(record[2], 64)
+		require.NoError(t, err)
+		assert.InDelta(t, completedAt.Sub(startedAt).Seconds(), duration, 1e-6)
+		assert.Equal(t, want.path, record[5])
+		assert.Equal(t, "3", record[6])
+		assert.Equal(t, "3", record[7])
+		assert.Equal(t, want.hash, record[8])
+		assert.Equal(t, want.status, record[9])
+		assert.Equal(t, want.err, record[10])
+	}
+
+	// Check a second run appends without writing another header
+	run("file3")
+	records = readTransferLog(t, path)
+	require.Equal(t, 4, len(records))
+	assert.Equal(t, transferLogHeader, records[0])
+	assert.Equal(t, "file3", records[3][5])
+}
+
+func TestTransferLogFull(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "transfers.csv")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	// Make a log with room for one record and no writer yet so
+	// it falls behind
+	tl := &transferLog{
+		f:       f,
+		w:       csv.NewWriter(f),
+		records: make(chan []string, 1),
+		done:    make(chan struct{}),
+	}
+
+	s := NewStats(ctx)
+	add := func(remote string) {
+		tr := s.NewTransferRemoteSize(remote, 0, nil, nil)
+		tr.Done(ctx, nil)
+		tl.add(tr)
+	}
+
+	// Records which don't fit wait for the writer rather than
+	// being dropped
+	add("file1")
+	added := make(chan struct{})
+	go func() {
+		add("file2")
+		add("file3")
+		close(added)
+	}()
+	select {
+	case <-added:
+		t.Fatal("records added without waiting for the writer")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	go tl.writer()
+	<-added
+	require.NoError(t, tl.close())
+
+	// Records added after the log is closed aren't written
+	add("file4")
+
+	records := readTransferLog(t, path)
+	require.Equal(t, 3, len(records))
+	for i, remote := range []string{"file1", "file2", "file3"} {
+		assert.Equal(t, remote, records[i][5])
+	}
+}
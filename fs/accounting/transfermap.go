@@ -128,6 +128,31 @@ func (tm *transferMap) String(ctx context.Context, progress *inProgress, exclude
 	return strings.Join(stringList, "\n")
 }
 
+// progressBars returns a progress bar width columns wide for each
+// item in the map.
+func (tm *transferMap) progressBars(ctx context.Context, progress *inProgress, width int) string {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	ci := fs.GetConfig(ctx)
+	stringList := make([]string, 0, len(tm.items))
+	for _, tr := range tm._sortedSlice() {
+		if acc := progress.get(tr.remote); acc != nil {
+			stringList = append(stringList, acc.progressBar(width))
+			continue
+		}
+		what := tr.what
+		if what == "" {
+			what = tm.name
+		}
+		stringList = append(stringList, fmt.Sprintf(" * %*s: %s",
+			ci.StatsFileNameLength,
+			shortenName(tr.remote, ci.StatsFileNameLength),
+			what,
+		))
+	}
+	return strings.Join(stringList, "\n")
+}
+
 // progress returns total bytes read as well as the size.
 func (tm *transferMap) progress(stats *StatsInfo) (totalBytes, totalSize int64) {
 	tm.mu.RLock()
@@ -129,10 +129,61 @@ func parseWeekday(dayOfWeek string) (int, error) {
 	return 0, fmt.Errorf("invalid weekday: %q", dayOfWeek)
 }
 
+// parseDaysAndHour parses the time part of a timetable entry which
+// is one of
+//
+//	hh:mm                  - every day at hh:mm
+//	day-hh:mm              - on day at hh:mm
+//	day                    - on day at 00:00
+//	firstDay-lastDay-hh:mm - every day from firstDay to lastDay at hh:mm
+//	firstDay-lastDay       - every day from firstDay to lastDay at 00:00
+//
+// It returns the days of the week the entry applies to and the hh:mm.
+// A range of days may wrap around the end of the week, e.g. Fri-Mon.
+func parseDaysAndHour(spec string) (days []int, HHMM string, err error) {
+	parts := strings.Split(spec, "-")
+	if len(parts) == 1 && strings.Contains(spec, ":") {
+		if err := validateHour(spec); err != nil {
+			return nil, "", err
+		}
+		return []int{0, 1, 2, 3, 4, 5, 6}, spec, nil
+	}
+	HHMM = "00:00"
+	if last := parts[len(parts)-1]; len(parts) > 1 && strings.Contains(last, ":") {
+		HHMM = last
+		parts = parts[:len(parts)-1]
+		if err := validateHour(HHMM); err != nil {
+			return nil, "", err
+		}
+	}
+	if len(parts) > 2 {
+		return nil, "", fmt.Errorf("invalid time specification: %q", spec)
+	}
+	first, err := parseWeekday(parts[0])
+	if err != nil {
+		return nil, "", err
+	}
+	last := first
+	if len(parts) == 2 {
+		last, err = parseWeekday(parts[1])
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	for day := first; ; day = (day + 1) % 7 {
+		days = append(days, day)
+		if day == last {
+			break
+		}
+	}
+	return days, HHMM, nil
+}
+
 // Set the bandwidth timetable.
 func (x *BwTimetable) Set(s string) error {
 	// The timetable is formatted as:
 	// "dayOfWeek-hh:mm,bandwidth dayOfWeek-hh:mm,bandwidth..." ex: "Mon-10:00,10G Mon-11:30,1G Tue-18:00,off"
+	// dayOfWeek may be a range of days, ex: "Mon-Fri-08:00,512k Mon-Fri-18:00,off Sat-Sun,off"
 	// If only a single bandwidth identifier is provided, we assume constant bandwidth.
 
 	if len(s) == 0 {
@@ -158,44 +209,15 @@ func (x *BwTimetable) Set(s string) error {
 			return fmt.Errorf("invalid time/bandwidth specification: %q", tok)
 		}
 
-		weekday := 0
-		HHMM := ""
-		if !strings.Contains(tv[0], "-") {
-			HHMM = tv[0]
-			if err := validateHour(HHMM); err != nil {
-				return err
-			}
-			for i := 0; i < 7; i++ {
-				hh, _ := strconv.Atoi(HHMM[0:2])
-				mm, _ := strconv.Atoi(HHMM[3:])
-				ts := BwTimeSlot{
-					DayOfTheWeek: i,
-					HHMM:         (hh * 100) + mm,
-				}
-				if err := ts.Bandwidth.Set(tv[1]); err != nil {
-					return err
-				}
-				*x = append(*x, ts)
-			}
-		} else {
-			timespec := strings.Split(tv[0], "-")
-			if len(timespec) != 2 {
-				return fmt.Errorf("invalid time specification: %q", tv[0])
-			}
-			var err error
-			weekday, err = parseWeekday(timespec[0])
-			if err != nil {
-				return err
-			}
-			HHMM = timespec[1]
-			if err := validateHour(HHMM); err != nil {
-				return err
-			}
-
-			hh, _ := strconv.Atoi(HHMM[0:2])
-			mm, _ := strconv.Atoi(HHMM[3:])
+		days, HHMM, err := parseDaysAndHour(tv[0])
+		if err != nil {
+			return err
+		}
+		hh, _ := strconv.Atoi(HHMM[0:2])
+		mm, _ := strconv.Atoi(HHMM[3:])
+		for _, day := range days {
 			ts := BwTimeSlot{
-				DayOfTheWeek: weekday,
+				DayOfTheWeek: day,
 				HHMM:         (hh * 100) + mm,
 			}
 			// Bandwidth limit for this time slot.
@@ -32,6 +32,10 @@ func TestBwTimetableSet(t *testing.T) {
 		{"bad-10:20,666", BwTimetable{}, true, ""},
 		{"Mon-bad,666", BwTimetable{}, true, ""},
 		{"Mon-10:20,bad", BwTimetable{}, true, ""},
+		{"Mon-Bad-10:20,666", BwTimetable{}, true, ""},
+		{"Mon-Fri-Sat-10:20,666", BwTimetable{}, true, ""},
+		{"Mon-Fri-25:20,666", BwTimetable{}, true, ""},
+		{"Bad,666", BwTimetable{}, true, ""},
 		{
 			"0",
 			BwTimetable{
@@ -256,6 +260,38 @@ func TestBwTimetableSet(t *testing.T) {
 			false,
 			"Mon-00:00,512Ki Sun-12:00,1Mi Mon-12:00,1Mi Tue-12:00,1Mi Wed-12:00,1Mi Thu-12:00,1Mi Fri-12:00,1Mi Sat-12:00,1Mi Sun-20:00,off",
 		},
+		{
+			"Mon-Fri-08:00,512k Mon-Fri-18:00,off Sat-Sun,1M",
+			BwTimetable{
+				BwTimeSlot{DayOfTheWeek: 1, HHMM: 800, Bandwidth: BwPair{Tx: 512 * 1024, Rx: 512 * 1024}},
+				BwTimeSlot{DayOfTheWeek: 2, HHMM: 800, Bandwidth: BwPair{Tx: 512 * 1024, Rx: 512 * 1024}},
+				BwTimeSlot{DayOfTheWeek: 3, HHMM: 800, Bandwidth: BwPair{Tx: 512 * 1024, Rx: 512 * 1024}},
+				BwTimeSlot{DayOfTheWeek: 4, HHMM: 800, Bandwidth: BwPair{Tx: 512 * 1024, Rx: 512 * 1024}},
+				BwTimeSlot{DayOfTheWeek: 5, HHMM: 800, Bandwidth: BwPair{Tx: 512 * 1024, Rx: 512 * 1024}},
+				BwTimeSlot{DayOfTheWeek: 1, HHMM: 1800, Bandwidth: BwPair{Tx: -1, Rx: -1}},
+				BwTimeSlot{DayOfTheWeek: 2, HHMM: 1800, Bandwidth: BwPair{Tx: -1, Rx: -1}},
+				BwTimeSlot{DayOfTheWeek: 3, HHMM: 1800, Bandwidth: BwPair{Tx: -1, Rx: -1}},
+				BwTimeSlot{DayOfTheWeek: 4, HHMM: 1800, Bandwidth: BwPair{Tx: -1, Rx: -1}},
+				BwTimeSlot{DayOfTheWeek: 5, HHMM: 1800, Bandwidth: BwPair{Tx: -1, Rx: -1}},
+				BwTimeSlot{DayOfTheWeek: 6, HHMM: 0, Bandwidth: BwPair{Tx: 1024 * 1024, Rx: 1024 * 1024}},
+				BwTimeSlot{DayOfTheWeek: 0, HHMM: 0, Bandwidth: BwPair{Tx: 1024 * 1024, Rx: 1024 * 1024}},
+			},
+			false,
+			"Mon-08:00,512Ki Tue-08:00,512Ki Wed-08:00,512Ki Thu-08:00,512Ki Fri-08:00,512Ki Mon-18:00,off Tue-18:00,off Wed-18:00,off Thu-18:00,off Fri-18:00,off Sat-00:00,1Mi Sun-00:00,1Mi",
+		},
+		{
+			// range wrapping around the end of the week
+			"Fri-Mon-12:00,1M Sat,off",
+			BwTimetable{
+				BwTimeSlot{DayOfTheWeek: 5, HHMM: 1200, Bandwidth: BwPair{Tx: 1024 * 1024, Rx: 1024 * 1024}},
+				BwTimeSlot{DayOfTheWeek: 6, HHMM: 1200, Bandwidth: BwPair{Tx: 1024 * 1024, Rx: 1024 * 1024}},
+				BwTimeSlot{DayOfTheWeek: 0, HHMM: 1200, Bandwidth: BwPair{Tx: 1024 * 1024, Rx: 1024 * 1024}},
+				BwTimeSlot{DayOfTheWeek: 1, HHMM: 1200, Bandwidth: BwPair{Tx: 1024 * 1024, Rx: 1024 * 1024}},
+				BwTimeSlot{DayOfTheWeek: 6, HHMM: 0, Bandwidth: BwPair{Tx: -1, Rx: -1}},
+			},
+			false,
+			"Fri-12:00,1Mi Sat-12:00,1Mi Sun-12:00,1Mi Mon-12:00,1Mi Sat-00:00,off",
+		},
 	} {
 		tt := BwTimetable{}
 		err := tt.Set(test.in)
@@ -468,6 +504,40 @@ func TestBwTimetableLimitAt(t *testing.T) {
 	}
 }
 
+func TestBwTimetableLimitAtWeekdays(t *testing.T) {
+	var tt BwTimetable
+	require.NoError(t, tt.Set("Mon-Fri-08:00,512k Mon-Fri-18:00,off Sat-Sun,1M"))
+	const (
+		weekday = 512 * 1024
+		weekend = 1024 * 1024
+		off     = -1
+	)
+	for _, test := range []struct {
+		now  time.Time
+		want SizeSuffix
+	}{
+		// 2017-04-17 is a Monday
+		{time.Date(2017, time.April, 17, 7, 59, 0, 0, time.UTC), weekend},
+		{time.Date(2017, time.April, 17, 8, 0, 0, 0, time.UTC), weekday},
+		{time.Date(2017, time.April, 17, 17, 59, 0, 0, time.UTC), weekday},
+		{time.Date(2017, time.April, 17, 18, 0, 0, 0, time.UTC), off},
+		{time.Date(2017, time.April, 19, 12, 0, 0, 0, time.UTC), weekday},
+		{time.Date(2017, time.April, 20, 3, 0, 0, 0, time.UTC), off},
+		{time.Date(2017, time.April, 21, 12, 0, 0, 0, time.UTC), weekday},
+		{time.Date(2017, time.April, 21, 23, 59, 0, 0, time.UTC), off},
+		{time.Date(2017, time.April, 22, 0, 0, 0, 0, time.UTC), weekend},
+		{time.Date(2017, time.April, 22, 12, 0, 0, 0, time.UTC), weekend},
+		{time.Date(2017, time.April, 23, 0, 0, 0, 0, time.UTC), weekend},
+		{time.Date(2017, time.April, 23, 23, 59, 0, 0, time.UTC), weekend},
+	} {
+		t.Run(test.now.Format("Mon 15:04"), func(t *testing.T) {
+			slot := tt.LimitAt(test.now)
+			assert.Equal(t, test.want, slot.Bandwidth.Tx)
+			assert.Equal(t, test.want, slot.Bandwidth.Rx)
+		})
+	}
+}
+
 func TestBwTimetableUnmarshalJSON(t *testing.T) {
 	for _, test := range []struct {
 		in   string
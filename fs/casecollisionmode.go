@@ -0,0 +1,22 @@
+package fs
+
+type caseCollisionModeChoices struct{}
+
+func (caseCollisionModeChoices) Choices() []string {
+	return []string{
+		CaseCollisionSkip:   "SKIP",
+		CaseCollisionError:  "ERROR",
+		CaseCollisionRename: "RENAME",
+	}
+}
+
+// CaseCollisionMode describes what to do with source files whose
+// names would be the same on a case insensitive destination
+type CaseCollisionMode = Enum[caseCollisionModeChoices]
+
+// CaseCollisionMode constants
+const (
+	CaseCollisionSkip CaseCollisionMode = iota
+	CaseCollisionError
+	CaseCollisionRename
+)
@@ -0,0 +1,22 @@
+package fs
+
+type checkNamesModeChoices struct{}
+
+func (checkNamesModeChoices) Choices() []string {
+	return []string{
+		CheckNamesOff:    "OFF",
+		CheckNamesReport: "REPORT",
+		CheckNamesError:  "ERROR",
+	}
+}
+
+// CheckNamesMode describes what to do with names the destination
+// can't store without changing them
+type CheckNamesMode = Enum[checkNamesModeChoices]
+
+// CheckNamesMode constants
+const (
+	CheckNamesOff CheckNamesMode = iota
+	CheckNamesReport
+	CheckNamesError
+)
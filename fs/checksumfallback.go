@@ -0,0 +1,24 @@
+package fs
+
+type checksumFallbackChoices struct{}
+
+func (checksumFallbackChoices) Choices() []string {
+	return []string{
+		ChecksumFallbackSize:     "SIZE",
+		ChecksumFallbackModTime:  "MODTIME",
+		ChecksumFallbackTransfer: "TRANSFER",
+		ChecksumFallbackError:    "ERROR",
+	}
+}
+
+// ChecksumFallback describes what --checksum does when there are no
+// hashes to compare
+type ChecksumFallback = Enum[checksumFallbackChoices]
+
+// ChecksumFallback constants
+const (
+	ChecksumFallbackSize ChecksumFallback = iota
+	ChecksumFallbackModTime
+	ChecksumFallbackTransfer
+	ChecksumFallbackError
+)
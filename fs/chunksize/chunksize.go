@@ -42,3 +42,26 @@ func Calculator(o interface{}, size int64, maxParts int, defaultChunkSize fs.Siz
 	fs.Debugf(o, "size: %v, parts: %v, default: %v, new: %v; default chunk size insufficient, returned new chunk size", fileSize, maxParts, defaultChunkSize, minChunk)
 	return minChunk
 }
+
+// Align rounds chunkSize up to the nearest multiple of alignment.
+//
+// Rounding up only ever makes the chunks bigger so the result still
+// respects the minimum chunk size and the maximum number of parts
+// that chunkSize did.
+//
+// If alignment is <= 0 or the aligned chunk size would exceed
+// maxChunkSize (if > 0) then chunkSize is returned unchanged.
+func Align(o interface{}, chunkSize, alignment, maxChunkSize fs.SizeSuffix) fs.SizeSuffix {
+	if alignment <= 0 {
+		return chunkSize
+	}
+	aligned := chunkSize
+	if remainder := aligned % alignment; remainder != 0 {
+		aligned += alignment - remainder
+	}
+	if maxChunkSize > 0 && aligned > maxChunkSize {
+		fs.Debugf(o, "chunk size %v aligned to %v is %v which is bigger than the maximum %v; not aligning", chunkSize, alignment, aligned, maxChunkSize)
+		return chunkSize
+	}
+	return aligned
+}
@@ -104,3 +104,92 @@ func TestComputeChunkSize(t *testing.T) {
 func toSizeSuffixMiB(size int64) fs.SizeSuffix {
 	return fs.SizeSuffix(size * int64(fs.Mebi))
 }
+
+func TestAlignChunkSize(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		chunkSize fs.SizeSuffix
+		alignment fs.SizeSuffix
+		max       fs.SizeSuffix
+		want      fs.SizeSuffix
+	}{
+		{
+			name:      "no alignment",
+			chunkSize: toSizeSuffixMiB(5),
+			alignment: 0,
+			want:      toSizeSuffixMiB(5),
+		}, {
+			name:      "negative alignment",
+			chunkSize: toSizeSuffixMiB(5),
+			alignment: -1,
+			want:      toSizeSuffixMiB(5),
+		}, {
+			name:      "already aligned",
+			chunkSize: toSizeSuffixMiB(16),
+			alignment: toSizeSuffixMiB(8),
+			want:      toSizeSuffixMiB(16),
+		}, {
+			name:      "rounded up",
+			chunkSize: toSizeSuffixMiB(5),
+			alignment: toSizeSuffixMiB(8),
+			want:      toSizeSuffixMiB(8),
+		}, {
+			name:      "rounded up by a byte",
+			chunkSize: toSizeSuffixMiB(8) + 1,
+			alignment: toSizeSuffixMiB(8),
+			want:      toSizeSuffixMiB(16),
+		}, {
+			name:      "within maximum",
+			chunkSize: toSizeSuffixMiB(5),
+			alignment: toSizeSuffixMiB(8),
+			max:       toSizeSuffixMiB(8),
+			want:      toSizeSuffixMiB(8),
+		}, {
+			name:      "exceeds maximum",
+			chunkSize: toSizeSuffixMiB(5),
+			alignment: toSizeSuffixMiB(8),
+			max:       toSizeSuffixMiB(7),
+			want:      toSizeSuffixMiB(5),
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := Align(test.name, test.chunkSize, test.alignment, test.max)
+			if got != test.want {
+				t.Fatalf("expected: %v, got: %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestCalculatorAligned(t *testing.T) {
+	const (
+		maxParts  = 10000
+		minChunk  = 5 * fs.Mebi
+		maxChunk  = 5 * fs.Gibi
+		alignment = 8 * fs.Mebi
+	)
+	for _, size := range []fs.SizeSuffix{
+		1,
+		minChunk,
+		toSizeSuffixMiB(100000) - 1,
+		toSizeSuffixMiB(100000) + 1,
+		120864818840,
+		toSizeSuffixMiB(1000000) + 1,
+		5 * fs.Tebi,
+	} {
+		t.Run(size.String(), func(t *testing.T) {
+			got := Calculator(size, int64(size), maxParts, minChunk)
+			got = Align(size, got, alignment, maxChunk)
+			if got%alignment != 0 {
+				t.Fatalf("chunk size %v is not aligned to %v", got, alignment)
+			}
+			if got < minChunk || got > maxChunk {
+				t.Fatalf("chunk size %v out of range", got)
+			}
+			parts := (size + got - 1) / got
+			if parts > maxParts {
+				t.Fatalf("too many parts %d", parts)
+			}
+		})
+	}
+}
@@ -57,19 +57,25 @@ type ConfigInfo struct {
 	DryRun                     bool
 	Interactive                bool
 	CheckSum                   bool
+	ChecksumFallback           ChecksumFallback
 	SizeOnly                   bool
 	IgnoreTimes                bool
 	IgnoreExisting             bool
+	NoUpdateExisting           bool
 	IgnoreErrors               bool
 	ModifyWindow               time.Duration
 	Checkers                   int
+	CheckersPerRemote          map[string]int
+	ListConcurrency            int
 	Transfers                  int
 	ConnectTimeout             time.Duration // Connect timeout
 	Timeout                    time.Duration // Data channel timeout
+	FirstByteTimeout           time.Duration // Timeout waiting for the first byte of a response - 0 to use Timeout
 	ExpectContinueTimeout      time.Duration
 	Dump                       DumpFlags
 	InsecureSkipVerify         bool // Skip server certificate verification
 	DeleteMode                 DeleteMode
+	DeleteAfterConcurrency     int // number of deleters for --delete-after, 0 for --checkers
 	MaxDelete                  int64
 	MaxDeleteSize              SizeSuffix
 	TrackRenames               bool          // Track file renames.
@@ -77,6 +83,7 @@ type ConfigInfo struct {
 	Retries                    int           // High-level retries
 	RetriesInterval            time.Duration // --retries-sleep
 	LowLevelRetries            int
+	PartRetries                int  // number of times to retry a failed part of a multipart upload
 	UpdateOlder                bool // Skip files that are newer on the destination
 	NoGzip                     bool // Disable compression
 	MaxDepth                   int
@@ -94,14 +101,19 @@ type ConfigInfo struct {
 	CompareDest                []string
 	CopyDest                   []string
 	BackupDir                  string
+	QuarantineDir              string // if set, move destination files which may hold unique data here rather than overwriting or deleting them
 	Suffix                     string
 	SuffixKeepExtension        bool
 	UseListR                   bool
 	BufferSize                 SizeSuffix
+	MaxBufferMemory            SizeSuffix // if set, limit the memory used by all upload buffers to this
 	BwLimit                    BwTimetable
 	BwLimitFile                BwTimetable
 	TPSLimit                   float64
 	TPSLimitBurst              int
+	AdaptiveConcurrency        bool
+	AdaptiveErrorRate          float64
+	AdaptiveWindow             time.Duration
 	BindAddr                   net.IP
 	DisableFeatures            []string
 	UserAgent                  string
@@ -115,14 +127,18 @@ type ConfigInfo struct {
 	MaxTransfer                SizeSuffix
 	MaxDuration                time.Duration
 	CutoffMode                 CutoffMode
+	MinFreeSpace               SizeSuffix
 	MaxBacklog                 int
 	MaxStatsGroups             int
 	StatsOneLine               bool
 	StatsOneLineDate           bool   // If we want a date prefix at all
 	StatsOneLineDateFormat     string // If we want to customize the prefix
+	StatsSkipped               bool   // If we want to show why files were skipped
 	ErrorOnNoTransfer          bool   // Set appropriate exit code if no files transferred
 	Progress                   bool
 	ProgressTerminalTitle      bool
+	ProgressPerFile            bool
+	TransferLog                string // file to append a CSV record of each transfer to
 	Cookie                     bool
 	UseMmap                    bool
 	CaCert                     []string // Client Side CA
@@ -133,27 +149,53 @@ type ConfigInfo struct {
 	MultiThreadSet             bool       // whether MultiThreadStreams was set (set in fs/config/configflags)
 	MultiThreadChunkSize       SizeSuffix // Chunk size for multi-thread downloads / uploads, if not set by filesystem
 	MultiThreadWriteBufferSize SizeSuffix
+	MultiThreadHash            int    // number of blocks of a file to hash at once for hashes which support it
 	OrderBy                    string // instructions on how to order the transfer
+	PriorityGlob               []string
+	DestState                  string // file to keep the state of the destination in instead of listing it
+	DestStateRefresh           bool   // list the destination and rewrite the DestState file
+	DestEmpty                  bool   // the destination is known to be empty so don't list it
+	VerifyAfterSync            bool   // check the destination matches the source after a sync
+	RenameMap                  string // file of old and new paths to rename files to when transferring
+	DeleteIfUnchanged          bool   // only delete files if they haven't changed since they were listed
 	UploadHeaders              []*HTTPOption
 	DownloadHeaders            []*HTTPOption
 	Headers                    []*HTTPOption
 	MetadataSet                Metadata // extra metadata to write when uploading
+	MetadataSetTemplate        Metadata // extra metadata to write when uploading with substitutions for each object
+	VerifyLog                  string   // file to append a signed record of each transfer to
+	VerifyLogKey               string   // key to sign the VerifyLog records with
+	Queue                      string   // file to record operations in instead of doing them
 	RefreshTimes               bool
 	NoConsole                  bool
 	TrafficClass               uint8
 	FsCacheExpireDuration      time.Duration
 	FsCacheExpireInterval      time.Duration
 	DisableHTTP2               bool
+	HTTPVersion                string            // HTTP version to use for the transport or "" for automatic
+	HTTPVersionPerRemote       map[string]string // HTTP version to use for the transport of each remote
 	HumanReadable              bool
 	KvLockTime                 time.Duration // maximum time to keep key-value database locked by process
 	DisableHTTPKeepAlives      bool
+	RedirectCodes              []int // if set only follow HTTP redirects with these status codes
+	RedirectSameHost           bool  // only follow HTTP redirects to the same host
+	RedirectKeepAuth           bool  // keep the Authorization header on HTTP redirects to another host
 	Metadata                   bool
+	PreserveBirthtime          bool // copy just the btime metadata if the destination can set it
 	ServerSideAcrossConfigs    bool
+	ServerSideRelay            bool // copy between remotes by having the destination fetch a link to the source
 	TerminalColorMode          TerminalColorMode
 	DefaultTime                Time // time that directories with no time should display
 	Inplace                    bool // Download directly to destination file instead of atomic download to temp/rename
+	CheckSourceStability       bool // Check the source didn't change during the transfer
+	RetryOnHashMismatch        int  // Number of times to retry a transfer if the hashes differ after it
 	PartialSuffix              string
 	MetadataMapper             SpaceSepList
+	OnDirComplete              SpaceSepList
+	SniffMimeType              bool // detect the mime type from the contents if the name doesn't give one
+	CheckNames                 CheckNamesMode
+	CaseCollision              CaseCollisionMode
+	SetModTime                 Time // if set, the modification time to give all files copied
 }
 
 // NewConfig creates a new config with everything set to the default
@@ -185,7 +227,10 @@ func NewConfig() *ConfigInfo {
 	c.StatsFileNameLength = 45
 	c.AskPassword = true
 	c.TPSLimitBurst = 1
+	c.AdaptiveErrorRate = 0.05
+	c.AdaptiveWindow = 10 * time.Second
 	c.MaxTransfer = -1
+	c.MinFreeSpace = -1
 	c.MaxBacklog = 10000
 	// We do not want to set the default here. We use this variable being empty as part of the fall-through of options.
 	//	c.StatsOneLineDateFormat = "2006/01/02 15:04:05 - "
@@ -193,6 +238,7 @@ func NewConfig() *ConfigInfo {
 	c.MultiThreadStreams = 4
 	c.MultiThreadChunkSize = SizeSuffix(64 * 1024 * 1024)
 	c.MultiThreadWriteBufferSize = SizeSuffix(128 * 1024)
+	c.MultiThreadHash = 4
 
 	c.TrackRenamesStrategy = "hash"
 	c.FsCacheExpireDuration = 300 * time.Second
@@ -231,6 +277,43 @@ func (c *ConfigInfo) TimeoutOrInfinite() time.Duration {
 	return ModTimeNotSupported
 }
 
+// ListConcurrencyOrCheckers returns ci.ListConcurrency if > 0 or
+// the checkers for the remotes passed in otherwise
+func (c *ConfigInfo) ListConcurrencyOrCheckers(remotes ...Info) int {
+	if c.ListConcurrency > 0 {
+		return c.ListConcurrency
+	}
+	return c.CheckersFor(remotes...)
+}
+
+// CheckersFor returns the number of checkers to use for the remotes
+// passed in.
+//
+// This is the value from ci.CheckersPerRemote for the remote if set
+// or ci.Checkers otherwise. If more than one remote is passed in,
+// for example the source and destination of a sync, the largest is
+// returned.
+func (c *ConfigInfo) CheckersFor(remotes ...Info) int {
+	if len(c.CheckersPerRemote) == 0 || len(remotes) == 0 {
+		return c.Checkers
+	}
+	checkers := 0
+	for _, f := range remotes {
+		n := c.Checkers
+		if f != nil {
+			// Look up the name without any {suffix} added by overrides
+			name, _, _ := strings.Cut(f.Name(), "{")
+			if perRemote, found := c.CheckersPerRemote[name]; found {
+				n = perRemote
+			}
+		}
+		if n > checkers {
+			checkers = n
+		}
+	}
+	return checkers
+}
+
 type configContextKeyType struct{}
 
 // Context key for config
@@ -21,24 +21,28 @@ import (
 
 var (
 	// these will get interpreted into fs.Config via SetFlags() below
-	verbose         int
-	quiet           bool
-	configPath      string
-	cacheDir        string
-	tempDir         string
-	dumpHeaders     bool
-	dumpBodies      bool
-	deleteBefore    bool
-	deleteDuring    bool
-	deleteAfter     bool
-	bindAddr        string
-	disableFeatures string
-	dscp            string
-	uploadHeaders   []string
-	downloadHeaders []string
-	headers         []string
-	metadataSet     []string
-	partialSuffix   string
+	verbose              int
+	quiet                bool
+	configPath           string
+	cacheDir             string
+	tempDir              string
+	dumpHeaders          bool
+	dumpBodies           bool
+	deleteBefore         bool
+	deleteDuring         bool
+	deleteAfter          bool
+	bindAddr             string
+	disableFeatures      string
+	dscp                 string
+	uploadHeaders        []string
+	downloadHeaders      []string
+	headers              []string
+	metadataSet          []string
+	metadataTemplate     []string
+	checkersPerRemote    []string
+	httpVersionPerRemote []string
+	partialSuffix        string
+	redirectCodes        string
 )
 
 // AddFlags adds the non filing system specific flags to the command
@@ -49,18 +53,25 @@ func AddFlags(ci *fs.ConfigInfo, flagSet *pflag.FlagSet) {
 	flags.BoolVarP(flagSet, &quiet, "quiet", "q", false, "Print as little stuff as possible", "Logging")
 	flags.DurationVarP(flagSet, &ci.ModifyWindow, "modify-window", "", ci.ModifyWindow, "Max time diff to be considered the same", "Copy")
 	flags.IntVarP(flagSet, &ci.Checkers, "checkers", "", ci.Checkers, "Number of checkers to run in parallel", "Performance")
+	flags.StringArrayVarP(flagSet, &checkersPerRemote, "checkers-per-remote", "", nil, "Number of checkers to run in parallel on the remote as remote=N", "Performance")
+	flags.IntVarP(flagSet, &ci.ListConcurrency, "list-concurrency", "", ci.ListConcurrency, "Max number of directories to list at once on each remote (default --checkers)", "Performance,Listing")
 	flags.IntVarP(flagSet, &ci.Transfers, "transfers", "", ci.Transfers, "Number of file transfers to run in parallel", "Performance")
 	flags.StringVarP(flagSet, &configPath, "config", "", config.GetConfigPath(), "Config file", "Config")
 	flags.StringVarP(flagSet, &cacheDir, "cache-dir", "", config.GetCacheDir(), "Directory rclone will use for caching", "Config")
 	flags.StringVarP(flagSet, &tempDir, "temp-dir", "", os.TempDir(), "Directory rclone will use for temporary files", "Config")
-	flags.BoolVarP(flagSet, &ci.CheckSum, "checksum", "c", ci.CheckSum, "Check for changes with size & checksum (if available, or fallback to size only).", "Copy")
+	flags.BoolVarP(flagSet, &ci.CheckSum, "checksum", "c", ci.CheckSum, "Check for changes with size & checksum (if available, or see --checksum-fallback).", "Copy")
+	flags.FVarP(flagSet, &ci.ChecksumFallback, "checksum-fallback", "", "What --checksum does if there are no hashes to compare SIZE|MODTIME|TRANSFER|ERROR", "Copy")
 	flags.BoolVarP(flagSet, &ci.SizeOnly, "size-only", "", ci.SizeOnly, "Skip based on size only, not modtime or checksum", "Copy")
 	flags.BoolVarP(flagSet, &ci.IgnoreTimes, "ignore-times", "I", ci.IgnoreTimes, "Don't skip items that match size and time - transfer all unconditionally", "Copy")
 	flags.BoolVarP(flagSet, &ci.IgnoreExisting, "ignore-existing", "", ci.IgnoreExisting, "Skip all files that exist on destination", "Copy")
+	flags.BoolVarP(flagSet, &ci.NoUpdateExisting, "no-update-existing", "", ci.NoUpdateExisting, "Never modify files that exist on destination (implies --ignore-existing)", "Copy")
 	flags.BoolVarP(flagSet, &ci.IgnoreErrors, "ignore-errors", "", ci.IgnoreErrors, "Delete even if there are I/O errors", "Sync")
 	flags.BoolVarP(flagSet, &ci.DryRun, "dry-run", "n", ci.DryRun, "Do a trial run with no permanent changes", "Config,Important")
+	flags.StringVarP(flagSet, &ci.Queue, "queue", "", ci.Queue, "Record transfers and deletes in this file for rclone flush-queue instead of doing them", "Config")
 	flags.BoolVarP(flagSet, &ci.Interactive, "interactive", "i", ci.Interactive, "Enable interactive mode", "Config,Important")
 	flags.DurationVarP(flagSet, &ci.ConnectTimeout, "contimeout", "", ci.ConnectTimeout, "Connect timeout", "Networking")
+	flags.DurationVarP(flagSet, &ci.ConnectTimeout, "connect-timeout", "", ci.ConnectTimeout, "Connect timeout (same as --contimeout)", "Networking")
+	flags.DurationVarP(flagSet, &ci.FirstByteTimeout, "first-byte-timeout", "", ci.FirstByteTimeout, "Timeout waiting for the first byte of a response (0 to use --timeout)", "Networking")
 	flags.DurationVarP(flagSet, &ci.Timeout, "timeout", "", ci.Timeout, "IO idle timeout", "Networking")
 	flags.DurationVarP(flagSet, &ci.ExpectContinueTimeout, "expect-continue-timeout", "", ci.ExpectContinueTimeout, "Timeout when using expect / 100-continue in HTTP", "Networking")
 	flags.BoolVarP(flagSet, &dumpHeaders, "dump-headers", "", false, "Dump HTTP headers - may contain sensitive info", "Debugging")
@@ -71,13 +82,22 @@ func AddFlags(ci *fs.ConfigInfo, flagSet *pflag.FlagSet) {
 	flags.BoolVarP(flagSet, &deleteBefore, "delete-before", "", false, "When synchronizing, delete files on destination before transferring", "Sync")
 	flags.BoolVarP(flagSet, &deleteDuring, "delete-during", "", false, "When synchronizing, delete files during transfer", "Sync")
 	flags.BoolVarP(flagSet, &deleteAfter, "delete-after", "", false, "When synchronizing, delete files on destination after transferring (default)", "Sync")
+	flags.IntVarP(flagSet, &ci.DeleteAfterConcurrency, "delete-after-concurrency", "", ci.DeleteAfterConcurrency, "Number of deletes to run in parallel with --delete-after (default --checkers)", "Sync,Performance")
 	flags.Int64VarP(flagSet, &ci.MaxDelete, "max-delete", "", -1, "When synchronizing, limit the number of deletes", "Sync")
 	flags.FVarP(flagSet, &ci.MaxDeleteSize, "max-delete-size", "", "When synchronizing, limit the total size of deletes", "Sync")
+	flags.StringVarP(flagSet, &ci.DestState, "dest-state", "", ci.DestState, "Use this file to record the destination contents instead of listing it each time", "Sync")
+	flags.BoolVarP(flagSet, &ci.DestEmpty, "dest-empty", "", ci.DestEmpty, "The destination is empty so transfer all files without listing it", "Sync")
+	flags.BoolVarP(flagSet, &ci.DestStateRefresh, "dest-state-refresh", "", ci.DestStateRefresh, "List the destination and rewrite the --dest-state file", "Sync")
+	flags.BoolVarP(flagSet, &ci.VerifyAfterSync, "verify-after-sync", "", ci.VerifyAfterSync, "Check the destination matches the source after the sync, failing if not", "Sync")
+	flags.BoolVarP(flagSet, &ci.DeleteIfUnchanged, "delete-if-unchanged", "", ci.DeleteIfUnchanged, "Only delete files on the destination if they haven't changed since they were listed", "Sync")
+	flags.FVarP(flagSet, &ci.OnDirComplete, "on-dir-complete", "", "Command to run with {dir} replaced by the directory when all the transfers in a directory are complete", "Sync")
+	flags.StringVarP(flagSet, &ci.RenameMap, "rename-map", "", ci.RenameMap, "Read a file of old and new paths and transfer source files at old paths to the new paths", "Sync")
 	flags.BoolVarP(flagSet, &ci.TrackRenames, "track-renames", "", ci.TrackRenames, "When synchronizing, track file renames and do a server-side move if possible", "Sync")
-	flags.StringVarP(flagSet, &ci.TrackRenamesStrategy, "track-renames-strategy", "", ci.TrackRenamesStrategy, "Strategies to use when synchronizing using track-renames hash|modtime|leaf", "Sync")
+	flags.StringVarP(flagSet, &ci.TrackRenamesStrategy, "track-renames-strategy", "", ci.TrackRenamesStrategy, "Strategies to use when synchronizing using track-renames hash|modtime|leaf|inode", "Sync")
 	flags.IntVarP(flagSet, &ci.Retries, "retries", "", 3, "Retry operations this many times if they fail", "Config")
 	flags.DurationVarP(flagSet, &ci.RetriesInterval, "retries-sleep", "", 0, "Interval between retrying operations if they fail, e.g. 500ms, 60s, 5m (0 to disable)", "Config")
 	flags.IntVarP(flagSet, &ci.LowLevelRetries, "low-level-retries", "", ci.LowLevelRetries, "Number of low level retries to do", "Config")
+	flags.IntVarP(flagSet, &ci.PartRetries, "part-retries", "", ci.PartRetries, "Number of times to retry each failed part of a multipart upload on its own", "Config")
 	flags.BoolVarP(flagSet, &ci.UpdateOlder, "update", "u", ci.UpdateOlder, "Skip files that are newer on the destination", "Copy")
 	flags.BoolVarP(flagSet, &ci.UseServerModTime, "use-server-modtime", "", ci.UseServerModTime, "Use server modified time instead of object metadata", "Config")
 	flags.BoolVarP(flagSet, &ci.NoGzip, "no-gzip-encoding", "", ci.NoGzip, "Don't set Accept-Encoding: gzip", "Networking")
@@ -95,11 +115,15 @@ func AddFlags(ci *fs.ConfigInfo, flagSet *pflag.FlagSet) {
 	flags.StringArrayVarP(flagSet, &ci.CompareDest, "compare-dest", "", nil, "Include additional comma separated server-side paths during comparison", "Copy")
 	flags.StringArrayVarP(flagSet, &ci.CopyDest, "copy-dest", "", nil, "Implies --compare-dest but also copies files from paths into destination", "Copy")
 	flags.StringVarP(flagSet, &ci.BackupDir, "backup-dir", "", ci.BackupDir, "Make backups into hierarchy based in DIR", "Sync")
+	flags.StringVarP(flagSet, &ci.QuarantineDir, "quarantine-dir", "", ci.QuarantineDir, "Move destination files which may hold unique data into DIR rather than overwriting or deleting them", "Sync")
 	flags.StringVarP(flagSet, &ci.Suffix, "suffix", "", ci.Suffix, "Suffix to add to changed files", "Sync")
 	flags.BoolVarP(flagSet, &ci.SuffixKeepExtension, "suffix-keep-extension", "", ci.SuffixKeepExtension, "Preserve the extension when using --suffix", "Sync")
 	flags.BoolVarP(flagSet, &ci.UseListR, "fast-list", "", ci.UseListR, "Use recursive list if available; uses more memory but fewer transactions", "Listing")
 	flags.Float64VarP(flagSet, &ci.TPSLimit, "tpslimit", "", ci.TPSLimit, "Limit HTTP transactions per second to this", "Networking")
 	flags.IntVarP(flagSet, &ci.TPSLimitBurst, "tpslimit-burst", "", ci.TPSLimitBurst, "Max burst of transactions for --tpslimit", "Networking")
+	flags.BoolVarP(flagSet, &ci.AdaptiveConcurrency, "adaptive-concurrency", "", ci.AdaptiveConcurrency, "Reduce --transfers and --tpslimit when the backend returns too many errors", "Networking")
+	flags.Float64VarP(flagSet, &ci.AdaptiveErrorRate, "adaptive-error-rate", "", ci.AdaptiveErrorRate, "Fraction of transactions failing above which --adaptive-concurrency backs off", "Networking")
+	flags.DurationVarP(flagSet, &ci.AdaptiveWindow, "adaptive-window", "", ci.AdaptiveWindow, "Time to measure the error rate over for --adaptive-concurrency", "Networking")
 	flags.StringVarP(flagSet, &bindAddr, "bind", "", "", "Local address to bind to for outgoing connections, IPv4, IPv6 or name", "Networking")
 	flags.StringVarP(flagSet, &disableFeatures, "disable", "", "", "Disable a comma separated list of features (use --disable help to see a list)", "Config")
 	flags.StringVarP(flagSet, &ci.UserAgent, "user-agent", "", ci.UserAgent, "Set the user-agent to a specified string", "Networking")
@@ -111,19 +135,24 @@ func AddFlags(ci *fs.ConfigInfo, flagSet *pflag.FlagSet) {
 	flags.FVarP(flagSet, &ci.BwLimit, "bwlimit", "", "Bandwidth limit in KiB/s, or use suffix B|K|M|G|T|P or a full timetable", "Networking")
 	flags.FVarP(flagSet, &ci.BwLimitFile, "bwlimit-file", "", "Bandwidth limit per file in KiB/s, or use suffix B|K|M|G|T|P or a full timetable", "Networking")
 	flags.FVarP(flagSet, &ci.BufferSize, "buffer-size", "", "In memory buffer size when reading files for each --transfer", "Performance")
+	flags.FVarP(flagSet, &ci.MaxBufferMemory, "max-buffer-memory", "", "If set, don't allocate more than this amount of memory as upload buffers", "Performance")
 	flags.FVarP(flagSet, &ci.StreamingUploadCutoff, "streaming-upload-cutoff", "", "Cutoff for switching to chunked upload if file size is unknown, upload starts after reaching cutoff or when file ends", "Copy")
 	flags.FVarP(flagSet, &ci.Dump, "dump", "", "List of items to dump from: "+fs.DumpFlagsList, "Debugging")
 	flags.FVarP(flagSet, &ci.MaxTransfer, "max-transfer", "", "Maximum size of data to transfer", "Copy")
 	flags.DurationVarP(flagSet, &ci.MaxDuration, "max-duration", "", 0, "Maximum duration rclone will transfer data for", "Copy")
 	flags.FVarP(flagSet, &ci.CutoffMode, "cutoff-mode", "", "Mode to stop transfers when reaching the max transfer limit HARD|SOFT|CAUTIOUS", "Copy")
+	flags.FVarP(flagSet, &ci.MinFreeSpace, "min-free-space", "", "Stop transferring if the destination would have less free space than this", "Copy")
 	flags.IntVarP(flagSet, &ci.MaxBacklog, "max-backlog", "", ci.MaxBacklog, "Maximum number of objects in sync or check backlog", "Copy,Check")
 	flags.IntVarP(flagSet, &ci.MaxStatsGroups, "max-stats-groups", "", ci.MaxStatsGroups, "Maximum number of stats groups to keep in memory, on max oldest is discarded", "Logging")
 	flags.BoolVarP(flagSet, &ci.StatsOneLine, "stats-one-line", "", ci.StatsOneLine, "Make the stats fit on one line", "Logging")
+	flags.BoolVarP(flagSet, &ci.StatsSkipped, "stats-skipped", "", ci.StatsSkipped, "Show why files were skipped in the stats", "Logging")
 	flags.BoolVarP(flagSet, &ci.StatsOneLineDate, "stats-one-line-date", "", ci.StatsOneLineDate, "Enable --stats-one-line and add current date/time prefix", "Logging")
 	flags.StringVarP(flagSet, &ci.StatsOneLineDateFormat, "stats-one-line-date-format", "", ci.StatsOneLineDateFormat, "Enable --stats-one-line-date and use custom formatted date: Enclose date string in double quotes (\"), see https://golang.org/pkg/time/#Time.Format", "Logging")
 	flags.BoolVarP(flagSet, &ci.ErrorOnNoTransfer, "error-on-no-transfer", "", ci.ErrorOnNoTransfer, "Sets exit code 9 if no files are transferred, useful in scripts", "Config")
 	flags.BoolVarP(flagSet, &ci.Progress, "progress", "P", ci.Progress, "Show progress during transfer", "Logging")
 	flags.BoolVarP(flagSet, &ci.ProgressTerminalTitle, "progress-terminal-title", "", ci.ProgressTerminalTitle, "Show progress on the terminal title (requires -P/--progress)", "Logging")
+	flags.BoolVarP(flagSet, &ci.ProgressPerFile, "progress-per-file", "", ci.ProgressPerFile, "Show a progress bar for each file being transferred (requires -P/--progress)", "Logging")
+	flags.StringVarP(flagSet, &ci.TransferLog, "transfer-log", "", ci.TransferLog, "Append a CSV record of each transfer to this file", "Logging")
 	flags.BoolVarP(flagSet, &ci.Cookie, "use-cookies", "", ci.Cookie, "Enable session cookiejar", "Networking")
 	flags.BoolVarP(flagSet, &ci.UseMmap, "use-mmap", "", ci.UseMmap, "Use mmap allocator (see docs)", "Config")
 	flags.StringArrayVarP(flagSet, &ci.CaCert, "ca-cert", "", ci.CaCert, "CA certificate used to verify servers", "Networking")
@@ -132,27 +161,45 @@ func AddFlags(ci *fs.ConfigInfo, flagSet *pflag.FlagSet) {
 	flags.FVarP(flagSet, &ci.MultiThreadCutoff, "multi-thread-cutoff", "", "Use multi-thread downloads for files above this size", "Copy")
 	flags.IntVarP(flagSet, &ci.MultiThreadStreams, "multi-thread-streams", "", ci.MultiThreadStreams, "Number of streams to use for multi-thread downloads", "Copy")
 	flags.FVarP(flagSet, &ci.MultiThreadWriteBufferSize, "multi-thread-write-buffer-size", "", "In memory buffer size for writing when in multi-thread mode", "Copy")
+	flags.IntVarP(flagSet, &ci.MultiThreadHash, "multi-thread-hash", "", ci.MultiThreadHash, "Number of blocks of a local file to hash at once for hashes made from blocks", "Copy,Check")
 	flags.FVarP(flagSet, &ci.MultiThreadChunkSize, "multi-thread-chunk-size", "", "Chunk size for multi-thread downloads / uploads, if not set by filesystem", "Copy")
 	flags.BoolVarP(flagSet, &ci.UseJSONLog, "use-json-log", "", ci.UseJSONLog, "Use json log format", "Logging")
 	flags.StringVarP(flagSet, &ci.OrderBy, "order-by", "", ci.OrderBy, "Instructions on how to order the transfers, e.g. 'size,descending'", "Copy")
+	flags.StringArrayVarP(flagSet, &ci.PriorityGlob, "priority-glob", "", nil, "Transfer files matching this glob before the others (can repeat)", "Copy")
 	flags.StringArrayVarP(flagSet, &uploadHeaders, "header-upload", "", nil, "Set HTTP header for upload transactions", "Networking")
 	flags.StringArrayVarP(flagSet, &downloadHeaders, "header-download", "", nil, "Set HTTP header for download transactions", "Networking")
 	flags.StringArrayVarP(flagSet, &headers, "header", "", nil, "Set HTTP header for all transactions", "Networking")
 	flags.StringArrayVarP(flagSet, &metadataSet, "metadata-set", "", nil, "Add metadata key=value when uploading", "Metadata")
+	flags.StringArrayVarP(flagSet, &metadataTemplate, "metadata-set-template", "", nil, "Add metadata key=value when uploading substituting {path}, {basename}, {size} and {hash} in value", "Metadata")
+	flags.StringVarP(flagSet, &ci.VerifyLog, "verify-log", "", ci.VerifyLog, "Append a tamper evident record of each transfer to this file", "Logging")
+	flags.StringVarP(flagSet, &ci.VerifyLogKey, "verify-log-key", "", ci.VerifyLogKey, "Secret key to sign the --verify-log entries with", "Logging")
 	flags.BoolVarP(flagSet, &ci.RefreshTimes, "refresh-times", "", ci.RefreshTimes, "Refresh the modtime of remote files", "Copy")
 	flags.BoolVarP(flagSet, &ci.NoConsole, "no-console", "", ci.NoConsole, "Hide console window (supported on Windows only)", "Config")
 	flags.StringVarP(flagSet, &dscp, "dscp", "", "", "Set DSCP value to connections, value or name, e.g. CS1, LE, DF, AF21", "Networking")
 	flags.DurationVarP(flagSet, &ci.FsCacheExpireDuration, "fs-cache-expire-duration", "", ci.FsCacheExpireDuration, "Cache remotes for this long (0 to disable caching)", "Config")
 	flags.DurationVarP(flagSet, &ci.FsCacheExpireInterval, "fs-cache-expire-interval", "", ci.FsCacheExpireInterval, "Interval to check for expired remotes", "Config")
 	flags.BoolVarP(flagSet, &ci.DisableHTTP2, "disable-http2", "", ci.DisableHTTP2, "Disable HTTP/2 in the global transport", "Networking")
+	flags.StringVarP(flagSet, &ci.HTTPVersion, "http-version", "", ci.HTTPVersion, "HTTP version to use in the global transport: 1.1|2 (default automatic)", "Networking")
+	flags.StringArrayVarP(flagSet, &httpVersionPerRemote, "http-version-per-remote", "", nil, "HTTP version to use in the transport of the remote as remote=1.1|2", "Networking")
 	flags.BoolVarP(flagSet, &ci.HumanReadable, "human-readable", "", ci.HumanReadable, "Print numbers in a human-readable format, sizes with suffix Ki|Mi|Gi|Ti|Pi", "Config")
 	flags.DurationVarP(flagSet, &ci.KvLockTime, "kv-lock-time", "", ci.KvLockTime, "Maximum time to keep key-value database locked by process", "Config")
 	flags.BoolVarP(flagSet, &ci.DisableHTTPKeepAlives, "disable-http-keep-alives", "", ci.DisableHTTPKeepAlives, "Disable HTTP keep-alives and use each connection once.", "Networking")
+	flags.StringVarP(flagSet, &redirectCodes, "redirect-codes", "", "", "Only follow HTTP redirects with these comma separated status codes, e.g. 301,302", "Networking")
+	flags.BoolVarP(flagSet, &ci.RedirectSameHost, "redirect-same-host", "", ci.RedirectSameHost, "Refuse to follow HTTP redirects to a different host", "Networking")
+	flags.BoolVarP(flagSet, &ci.RedirectKeepAuth, "redirect-keep-auth", "", ci.RedirectKeepAuth, "Keep the Authorization header when following HTTP redirects to a different host", "Networking")
 	flags.BoolVarP(flagSet, &ci.Metadata, "metadata", "M", ci.Metadata, "If set, preserve metadata when copying objects", "Metadata,Copy")
+	flags.BoolVarP(flagSet, &ci.PreserveBirthtime, "preserve-birthtime", "", ci.PreserveBirthtime, "Preserve the creation time of files where the destination can set it", "Metadata,Copy")
 	flags.BoolVarP(flagSet, &ci.ServerSideAcrossConfigs, "server-side-across-configs", "", ci.ServerSideAcrossConfigs, "Allow server-side operations (e.g. copy) to work across different configs", "Copy")
+	flags.BoolVarP(flagSet, &ci.ServerSideRelay, "server-side-relay", "", ci.ServerSideRelay, "Copy between remotes by having the destination fetch a link to the source", "Copy")
 	flags.FVarP(flagSet, &ci.TerminalColorMode, "color", "", "When to show colors (and other ANSI codes) AUTO|NEVER|ALWAYS", "Config")
 	flags.FVarP(flagSet, &ci.DefaultTime, "default-time", "", "Time to show if modtime is unknown for files and directories", "Config,Listing")
 	flags.BoolVarP(flagSet, &ci.Inplace, "inplace", "", ci.Inplace, "Download directly to destination file instead of atomic download to temp/rename", "Copy")
+	flags.BoolVarP(flagSet, &ci.SniffMimeType, "sniff-mime-type", "", ci.SniffMimeType, "Detect the mime type of uploads from their contents if the name doesn't give one", "Copy")
+	flags.FVarP(flagSet, &ci.SetModTime, "set-modtime", "", "Set the modification time of all files copied to this time", "Copy")
+	flags.FVarP(flagSet, &ci.CheckNames, "check-names", "", "Check new names can be stored on the destination without changing them OFF|REPORT|ERROR", "Copy")
+	flags.FVarP(flagSet, &ci.CaseCollision, "case-collision", "", "What to do with source files whose names collide on a case insensitive destination SKIP|ERROR|RENAME", "Copy")
+	flags.IntVarP(flagSet, &ci.RetryOnHashMismatch, "retry-on-hash-mismatch", "", ci.RetryOnHashMismatch, "Number of times to retry a transfer if the hashes differ after it", "Copy")
+	flags.BoolVarP(flagSet, &ci.CheckSourceStability, "check-source-stability", "", ci.CheckSourceStability, "Fail the transfer if the source changes while it is being copied", "Copy")
 	flags.StringVarP(flagSet, &partialSuffix, "partial-suffix", "", ci.PartialSuffix, "Add partial-suffix to temporary file name when --inplace is not used", "Copy")
 	flags.FVarP(flagSet, &ci.MetadataMapper, "metadata-mapper", "", "Program to run to transforming metadata before upload", "Metadata")
 }
@@ -194,7 +241,7 @@ func SetFlags(ci *fs.ConfigInfo) {
 	} else if verbose >= 1 {
 		ci.LogLevel = fs.LogLevelInfo
 	}
-	if (ci.DryRun || ci.Interactive) && ci.StatsLogLevel > fs.LogLevelNotice {
+	if (ci.DryRun || ci.Interactive || ci.Queue != "") && ci.StatsLogLevel > fs.LogLevelNotice {
 		ci.StatsLogLevel = fs.LogLevelNotice
 	}
 	if quiet {
@@ -302,6 +349,63 @@ func SetFlags(ci *fs.ConfigInfo) {
 		}
 		fs.Debugf(nil, "MetadataUpload %v", ci.MetadataSet)
 	}
+	if len(metadataTemplate) != 0 {
+		ci.MetadataSetTemplate = make(fs.Metadata, len(metadataTemplate))
+		for _, kv := range metadataTemplate {
+			equal := strings.IndexRune(kv, '=')
+			if equal < 0 {
+				log.Fatalf("Failed to parse '%s' as metadata key=template.", kv)
+			}
+			ci.MetadataSetTemplate[strings.ToLower(kv[:equal])] = kv[equal+1:]
+		}
+		fs.Debugf(nil, "MetadataSetTemplate %v", ci.MetadataSetTemplate)
+	}
+	if len(checkersPerRemote) != 0 {
+		ci.CheckersPerRemote = make(map[string]int, len(checkersPerRemote))
+		for _, kv := range checkersPerRemote {
+			equal := strings.LastIndexByte(kv, '=')
+			if equal < 0 {
+				log.Fatalf("Failed to parse '%s' as --checkers-per-remote remote=N.", kv)
+			}
+			name := strings.TrimSuffix(kv[:equal], ":")
+			n, err := strconv.Atoi(kv[equal+1:])
+			if err != nil || n <= 0 {
+				log.Fatalf("Failed to parse '%s' as --checkers-per-remote remote=N: N must be a positive integer.", kv)
+			}
+			ci.CheckersPerRemote[name] = n
+		}
+		fs.Debugf(nil, "CheckersPerRemote %v", ci.CheckersPerRemote)
+	}
+	if redirectCodes != "" {
+		ci.RedirectCodes = nil
+		for _, code := range strings.Split(redirectCodes, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(code))
+			if err != nil || n < 300 || n > 399 {
+				log.Fatalf("--redirect-codes: Invalid HTTP redirect status code %q", code)
+			}
+			ci.RedirectCodes = append(ci.RedirectCodes, n)
+		}
+	}
+
+	checkHTTPVersion("--http-version", ci.HTTPVersion)
+	if ci.HTTPVersion == "2" && ci.DisableHTTP2 {
+		log.Fatalf("Can't use --http-version 2 with --disable-http2")
+	}
+	if len(httpVersionPerRemote) != 0 {
+		ci.HTTPVersionPerRemote = make(map[string]string, len(httpVersionPerRemote))
+		for _, kv := range httpVersionPerRemote {
+			equal := strings.LastIndexByte(kv, '=')
+			if equal < 0 {
+				log.Fatalf("Failed to parse '%s' as --http-version-per-remote remote=VERSION.", kv)
+			}
+			name := strings.TrimSuffix(kv[:equal], ":")
+			version := kv[equal+1:]
+			checkHTTPVersion("--http-version-per-remote", version)
+			ci.HTTPVersionPerRemote[name] = version
+		}
+		fs.Debugf(nil, "HTTPVersionPerRemote %v", ci.HTTPVersionPerRemote)
+	}
+
 	if len(dscp) != 0 {
 		if value, ok := parseDSCP(dscp); ok {
 			ci.TrafficClass = value << 2
@@ -334,6 +438,10 @@ func SetFlags(ci *fs.ConfigInfo) {
 	}
 	ci.PartialSuffix = partialSuffix
 
+	if ci.VerifyLog != "" && ci.VerifyLogKey == "" {
+		log.Fatalf("--verify-log-key must be set to use --verify-log")
+	}
+
 	// Make sure some values are > 0
 	nonZero := func(pi *int) {
 		if *pi <= 0 {
@@ -345,6 +453,17 @@ func SetFlags(ci *fs.ConfigInfo) {
 	nonZero(&ci.Checkers)
 }
 
+// checkHTTPVersion checks version is a valid HTTP version for flag
+func checkHTTPVersion(flag, version string) {
+	switch version {
+	case "", "1.1", "2":
+	case "3":
+		log.Fatalf("%s: HTTP/3 is not supported as rclone is built without QUIC support", flag)
+	default:
+		log.Fatalf("%s: Invalid HTTP version %q - use 1.1 or 2", flag, version)
+	}
+}
+
 // parseHeaders converts DSCP names to value
 func parseDSCP(dscp string) (uint8, bool) {
 	if s, err := strconv.ParseUint(dscp, 10, 6); err == nil {
@@ -361,6 +361,31 @@ func ShowRedactedRemote(name string) {
 	printRemoteOptions(name, "", " = ", true)
 }
 
+// ShowResolvedRemote shows the values in use for all the options of
+// the remote, which may include a connection string, in the order the
+// sources of the values were applied along with where each came
+// from. Sensitive values are redacted.
+func ShowResolvedRemote(name string) error {
+	fsInfo, configName, _, connectionStringConfig, err := fs.ParseRemote(name + ":")
+	if err != nil {
+		return fmt.Errorf("failed to find remote %q: %w", name, err)
+	}
+	fmt.Printf("[%s]\n", configName)
+	fmt.Printf("type = %s\n", fsInfo.Name)
+	for _, option := range fs.ResolveConfig(fsInfo, configName, connectionStringConfig) {
+		value := option.Value
+		if (option.Option.Sensitive || option.Option.IsPassword) && value != "" {
+			value = "XXX"
+		}
+		source := option.Source
+		if len(option.Overrides) > 0 {
+			source += " overriding " + strings.Join(option.Overrides, ", ")
+		}
+		fmt.Printf("%s = %s ; %s\n", option.Option.Name, value, source)
+	}
+	return nil
+}
+
 // OkRemote prints the contents of the remote and ask if it is OK
 func OkRemote(name string) bool {
 	fmt.Println("Configuration complete.")
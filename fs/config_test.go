@@ -3,7 +3,9 @@ package fs
 import (
 	"context"
 	"testing"
+	"time"
 
+	"github.com/rclone/rclone/fs/hash"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -29,3 +31,42 @@ func TestGetConfig(t *testing.T) {
 	config2ctx := GetConfig(ctx2)
 	assert.Equal(t, config2, config2ctx)
 }
+
+// namedInfo is an Info with just a name
+type namedInfo string
+
+func (n namedInfo) Name() string             { return string(n) }
+func (n namedInfo) Root() string             { return "" }
+func (n namedInfo) String() string           { return string(n) }
+func (n namedInfo) Precision() time.Duration { return time.Second }
+func (n namedInfo) Hashes() hash.Set         { return hash.Set(hash.None) }
+func (n namedInfo) Features() *Features      { return &Features{} }
+
+func TestCheckersFor(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := AddConfig(ctx)
+	ci.Checkers = 8
+	local, s3, s3Override, other := namedInfo("local"), namedInfo("s3"), namedInfo("s3{AbCdE}"), namedInfo("other")
+
+	// No per remote settings
+	assert.Equal(t, 8, ci.CheckersFor())
+	assert.Equal(t, 8, ci.CheckersFor(local, s3))
+
+	ci.CheckersPerRemote = map[string]int{"local": 2, "s3": 32}
+	assert.Equal(t, 8, ci.CheckersFor())
+	assert.Equal(t, 2, ci.CheckersFor(local))
+	assert.Equal(t, 32, ci.CheckersFor(s3))
+	assert.Equal(t, 32, ci.CheckersFor(s3Override))
+	assert.Equal(t, 8, ci.CheckersFor(other))
+	assert.Equal(t, 8, ci.CheckersFor(nil))
+
+	// The largest is used for more than one remote
+	assert.Equal(t, 32, ci.CheckersFor(local, s3))
+	assert.Equal(t, 8, ci.CheckersFor(local, other))
+
+	// --list-concurrency overrides the checkers
+	assert.Equal(t, 2, ci.ListConcurrencyOrCheckers(local))
+	ci.ListConcurrency = 4
+	assert.Equal(t, 4, ci.ListConcurrencyOrCheckers(local))
+	assert.Equal(t, 4, ci.ListConcurrencyOrCheckers(s3))
+}
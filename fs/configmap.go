@@ -3,9 +3,17 @@
 package fs
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/obscure"
 )
 
 // A configmap.Getter to read from the environment RCLONE_CONFIG_backend_option_name
@@ -89,6 +97,104 @@ func (section getConfigFile) Get(key string) (value string, ok bool) {
 	return value, ok
 }
 
+// SecretCommandKey is the config key of the command run to read the
+// secrets of a remote which aren't set any other way
+const SecretCommandKey = "secret_command"
+
+// A configmap.Getter to read secrets by running the secret_command
+// of the remote
+type secretCommand struct {
+	fsInfo     *RegInfo
+	configName string
+}
+
+// command returns the secret_command of the remote
+//
+// This is only read from the remote specific environment variable
+// and the config file as it runs a command. Connection strings may
+// come from less trusted places, eg the rc, so they can't set it.
+func (sc secretCommand) command() (command string, ok bool) {
+	command, ok = configEnvVars(sc.configName).Get(SecretCommandKey)
+	if !ok {
+		command, ok = getConfigFile(sc.configName).Get(SecretCommandKey)
+	}
+	return command, ok && command != ""
+}
+
+// Get a sensitive config item by running the secret_command if set
+func (sc secretCommand) Get(key string) (value string, ok bool) {
+	opt := sc.fsInfo.Options.Get(key)
+	if opt == nil || !(opt.Sensitive || opt.IsPassword) {
+		return "", false
+	}
+	command, ok := sc.command()
+	if !ok {
+		return "", false
+	}
+	value, err := runSecretCommand(command, sc.configName, key)
+	if err != nil {
+		Errorf(nil, "Failed to read %q for %q from %s: %v", key, sc.configName, SecretCommandKey, err)
+		return "", false
+	}
+	if value == "" {
+		return "", false
+	}
+	Debugf(nil, "Setting %s for %q from %s", key, sc.configName, SecretCommandKey)
+	if opt.IsPassword {
+		value = obscure.MustObscure(value)
+	}
+	return value, true
+}
+
+// secretResult is the cached result of running a secret_command
+type secretResult struct {
+	value string
+	err   error
+}
+
+var (
+	secretCacheMu sync.Mutex
+	secretCache   = map[string]secretResult{}
+)
+
+// runSecretCommand runs command with key as an extra argument
+// returning what it prints, or the result of running it before.
+//
+// The name of the remote is passed in the RCLONE_SECRET_REMOTE
+// environment variable.
+func runSecretCommand(command, configName, key string) (string, error) {
+	cacheKey := strings.Join([]string{command, configName, key}, "\x00")
+	secretCacheMu.Lock()
+	defer secretCacheMu.Unlock()
+	if result, found := secretCache[cacheKey]; found {
+		return result.value, result.err
+	}
+	var result secretResult
+	var args SpaceSepList
+	result.err = args.Set(command)
+	if result.err == nil && len(args) == 0 {
+		result.err = errors.New("empty command")
+	}
+	if result.err == nil {
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command(args[0], append(args[1:], key)...)
+		cmd.Env = append(os.Environ(), "RCLONE_SECRET_REMOTE="+configName)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		cmd.Stdin = os.Stdin
+		result.err = cmd.Run()
+		if result.err != nil {
+			if ers := strings.TrimSpace(stderr.String()); ers != "" {
+				result.err = fmt.Errorf("%w: %s", result.err, ers)
+			}
+		} else {
+			result.value = strings.Trim(stdout.String(), "\r\n")
+		}
+	}
+	secretCache[cacheKey] = result
+	return result.value, result.err
+}
+
 // ConfigMap creates a configmap.Map from the *RegInfo and the
 // configName passed in. If connectionStringConfig has any entries (it may be nil),
 // then it will be added to the lookup with the highest priority.
@@ -122,6 +228,11 @@ func ConfigMap(fsInfo *RegInfo, configName string, connectionStringConfig config
 	// config file
 	config.AddGetter(getConfigFile(configName), configmap.PriorityConfig)
 
+	// secrets from the secret_command
+	if fsInfo != nil {
+		config.AddGetter(secretCommand{fsInfo: fsInfo, configName: configName}, configmap.PriorityConfig)
+	}
+
 	// default values
 	if fsInfo != nil {
 		config.AddGetter(&regInfoValues{fsInfo, true}, configmap.PriorityDefault)
@@ -131,3 +242,85 @@ func ConfigMap(fsInfo *RegInfo, configName string, connectionStringConfig config
 	config.AddSetter(setConfigFile(configName))
 	return config
 }
+
+// Sources of config values as reported by ResolveConfig
+const (
+	ConfigSourceDefault          = "default"
+	ConfigSourceSecretCommand    = SecretCommandKey
+	ConfigSourceConfigFile       = "config file"
+	ConfigSourceBackendEnv       = "backend environment variable"
+	ConfigSourceRemoteEnv        = "remote environment variable"
+	ConfigSourceFlag             = "command line flag"
+	ConfigSourceConnectionString = "connection string"
+)
+
+// ResolvedOption is the value of a backend option as ConfigMap
+// resolves it along with where the value came from
+type ResolvedOption struct {
+	Option    *Option  // the option
+	Value     string   // the value in use
+	Source    string   // where the value came from
+	Overrides []string // the sources other than the default with values which were overridden
+	applied   int      // the order Source was applied in
+}
+
+// ResolveConfig returns the value of each option of fsInfo that
+// ConfigMap would give for configName and connectionStringConfig
+// along with where each value came from.
+//
+// The options are returned in the order the sources were applied,
+// defaults first, with options from the same source in the order
+// they are registered.
+func ResolveConfig(fsInfo *RegInfo, configName string, connectionStringConfig configmap.Simple) (resolved []ResolvedOption) {
+	// Sources in the order they are applied, each overriding the ones before
+	sources := []struct {
+		name   string
+		getter configmap.Getter
+	}{
+		{ConfigSourceDefault, &regInfoValues{fsInfo, true}},
+		{ConfigSourceSecretCommand, secretCommand{fsInfo: fsInfo, configName: configName}},
+		{ConfigSourceConfigFile, getConfigFile(configName)},
+		{ConfigSourceBackendEnv, optionEnvVars{fsInfo: fsInfo}},
+		{ConfigSourceRemoteEnv, configEnvVars(configName)},
+		{ConfigSourceFlag, &regInfoValues{fsInfo, false}},
+		{ConfigSourceConnectionString, connectionStringConfig},
+	}
+	seen := make(map[string]struct{}, len(fsInfo.Options))
+	for i := range fsInfo.Options {
+		opt := &fsInfo.Options[i]
+		// Options may be registered more than once, eg for different providers
+		if _, found := seen[opt.Name]; found {
+			continue
+		}
+		seen[opt.Name] = struct{}{}
+		var option *ResolvedOption
+		for i := len(sources) - 1; i >= 0; i-- {
+			source := sources[i]
+			// Only run the secret_command if it would be used
+			if option != nil && source.name == ConfigSourceSecretCommand {
+				continue
+			}
+			value, ok := source.getter.Get(opt.Name)
+			if !ok {
+				continue
+			}
+			if option == nil {
+				option = &ResolvedOption{
+					Option:  opt,
+					Value:   value,
+					Source:  source.name,
+					applied: i,
+				}
+			} else if source.name != ConfigSourceDefault {
+				option.Overrides = append(option.Overrides, source.name)
+			}
+		}
+		if option != nil {
+			resolved = append(resolved, *option)
+		}
+	}
+	sort.SliceStable(resolved, func(i, j int) bool {
+		return resolved[i].applied < resolved[j].applied
+	})
+	return resolved
+}
@@ -39,6 +39,7 @@ type Features struct {
 	NoMultiThreading         bool // set if can't have multiplethreads on one download open
 	Overlay                  bool // this wraps one or more backends to add functionality
 	ChunkWriterDoesntSeek    bool // set if the chunk writer doesn't need to read the data more than once
+	PresignedLinks           bool // PublicLink makes presigned links which expire without changing who can read the file
 
 	// Purge all files in the directory specified
 	//
@@ -48,6 +49,16 @@ type Features struct {
 	// Return an error if it doesn't exist
 	Purge func(ctx context.Context, dir string) error
 
+	// DeleteObjects deletes the objects passed in, which are all
+	// from this Fs, using as few transactions as possible.
+	//
+	// Implement this if you have a way of deleting many objects
+	// quicker than running Remove() on each of them.
+	//
+	// It returns an error for each object in objs which is nil if
+	// the object was deleted.
+	DeleteObjects func(ctx context.Context, objs []Object) []error
+
 	// Copy src to this remote using server-side copy operations.
 	//
 	// This is stored with the remote path given
@@ -127,6 +138,17 @@ type Features struct {
 	// nil and the error
 	PutStream func(ctx context.Context, in io.Reader, src ObjectInfo, options ...OpenOption) (Object, error)
 
+	// PutURL uploads the object described by src to the remote
+	// path, having the provider read the data from url itself
+	// rather than sending it through rclone.
+	//
+	// url will be a presigned link to an object on another
+	// remote which expires.
+	//
+	// Return fs.ErrorCantCopy if the object can't be uploaded
+	// this way, in which case it will be copied through rclone.
+	PutURL func(ctx context.Context, url string, src ObjectInfo, options ...OpenOption) (Object, error)
+
 	// MergeDirs merges the contents of all the directories passed
 	// in into the first one and rmdirs the other directories.
 	MergeDirs func(ctx context.Context, dirs []Directory) error
@@ -279,6 +301,9 @@ func (ft *Features) Fill(ctx context.Context, f Fs) *Features {
 	if do, ok := f.(Purger); ok {
 		ft.Purge = do.Purge
 	}
+	if do, ok := f.(DeleteObjectser); ok {
+		ft.DeleteObjects = do.DeleteObjects
+	}
 	if do, ok := f.(Copier); ok {
 		ft.Copy = do.Copy
 	}
@@ -314,6 +339,9 @@ func (ft *Features) Fill(ctx context.Context, f Fs) *Features {
 	if do, ok := f.(PutStreamer); ok {
 		ft.PutStream = do.PutStream
 	}
+	if do, ok := f.(PutURLer); ok {
+		ft.PutURL = do.PutURL
+	}
 	if do, ok := f.(MergeDirser); ok {
 		ft.MergeDirs = do.MergeDirs
 	}
@@ -382,11 +410,15 @@ func (ft *Features) Mask(ctx context.Context, f Fs) *Features {
 	ft.FilterAware = ft.FilterAware && mask.FilterAware
 	ft.PartialUploads = ft.PartialUploads && mask.PartialUploads
 	ft.NoMultiThreading = ft.NoMultiThreading && mask.NoMultiThreading
+	ft.PresignedLinks = ft.PresignedLinks && mask.PresignedLinks
 	// ft.Overlay = ft.Overlay && mask.Overlay don't propagate Overlay
 
 	if mask.Purge == nil {
 		ft.Purge = nil
 	}
+	if mask.DeleteObjects == nil {
+		ft.DeleteObjects = nil
+	}
 	if mask.Copy == nil {
 		ft.Copy = nil
 	}
@@ -420,6 +452,9 @@ func (ft *Features) Mask(ctx context.Context, f Fs) *Features {
 	if mask.PutStream == nil {
 		ft.PutStream = nil
 	}
+	if mask.PutURL == nil {
+		ft.PutURL = nil
+	}
 	if mask.MergeDirs == nil {
 		ft.MergeDirs = nil
 	}
@@ -489,6 +524,19 @@ type Purger interface {
 	Purge(ctx context.Context, dir string) error
 }
 
+// DeleteObjectser is an optional interface for Fs
+type DeleteObjectser interface {
+	// DeleteObjects deletes the objects passed in, which are all
+	// from this Fs, using as few transactions as possible.
+	//
+	// Implement this if you have a way of deleting many objects
+	// quicker than running Remove() on each of them.
+	//
+	// It returns an error for each object in objs which is nil if
+	// the object was deleted.
+	DeleteObjects(ctx context.Context, objs []Object) []error
+}
+
 // Copier is an optional interface for Fs
 type Copier interface {
 	// Copy src to this remote using server-side copy operations.
@@ -611,6 +659,20 @@ type PutStreamer interface {
 	PutStream(ctx context.Context, in io.Reader, src ObjectInfo, options ...OpenOption) (Object, error)
 }
 
+// PutURLer is an optional interface for Fs
+type PutURLer interface {
+	// PutURL uploads the object described by src to the remote
+	// path, having the provider read the data from url itself
+	// rather than sending it through rclone.
+	//
+	// url will be a presigned link to an object on another
+	// remote which expires.
+	//
+	// Return fs.ErrorCantCopy if the object can't be uploaded
+	// this way, in which case it will be copied through rclone.
+	PutURL(ctx context.Context, url string, src ObjectInfo, options ...OpenOption) (Object, error)
+}
+
 // PublicLinker is an optional interface for Fs
 type PublicLinker interface {
 	// PublicLink generates a public link to the remote path (usually readable by anyone)
@@ -3,10 +3,14 @@ package filter
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"log"
 	"path"
+	"regexp/syntax"
+	"sort"
 	"strings"
 	"time"
 
@@ -31,6 +35,10 @@ type Opt struct {
 	MaxAge         fs.Duration
 	MinSize        fs.SizeSuffix
 	MaxSize        fs.SizeSuffix
+	SkipEmpty      bool
+	SampleRate     float64
+	SampleCount    int
+	SampleSeed     int64
 	IgnoreCase     bool
 }
 
@@ -55,6 +63,7 @@ type Filter struct {
 	metaRules   rules
 	files       FilesMap // files if filesFrom
 	dirs        FilesMap // dirs from filesFrom
+	sampled     FilesMap // files chosen by SetSample for --sample-count
 }
 
 // NewFilter parses the command line options and creates a Filter
@@ -82,6 +91,16 @@ func NewFilter(opt *Opt) (f *Filter, err error) {
 		fs.Debugf(nil, "--max-age %v to %v", f.Opt.MaxAge, f.ModTimeFrom)
 	}
 
+	if f.Opt.SampleRate < 0 || f.Opt.SampleRate > 1 {
+		return nil, fmt.Errorf("--sample-rate must be between 0 and 1, got %v", f.Opt.SampleRate)
+	}
+	if f.Opt.SampleCount < 0 {
+		return nil, fmt.Errorf("--sample-count must be positive, got %d", f.Opt.SampleCount)
+	}
+	if f.Opt.SampleRate > 0 && f.Opt.SampleCount > 0 {
+		return nil, errors.New("can't use --sample-rate and --sample-count together")
+	}
+
 	err = parseRules(&f.Opt.RulesOpt, f.Add, f.Clear)
 	if err != nil {
 		return nil, err
@@ -251,6 +270,9 @@ func (f *Filter) InActive() bool {
 		f.ModTimeTo.IsZero() &&
 		f.Opt.MinSize < 0 &&
 		f.Opt.MaxSize < 0 &&
+		!f.Opt.SkipEmpty &&
+		f.Opt.SampleRate == 0 &&
+		f.Opt.SampleCount == 0 &&
 		f.fileRules.len() == 0 &&
 		f.dirRules.len() == 0 &&
 		f.metaRules.len() == 0 &&
@@ -356,6 +378,10 @@ func (f *Filter) Include(remote string, size int64, modTime time.Time, metadata
 		fs.Debugf(remote, "Excluded (Size Filter)")
 		return false
 	}
+	if f.Opt.SkipEmpty && size == 0 {
+		fs.Debugf(remote, "Excluded (Empty File Filter)")
+		return false
+	}
 	if f.metaRules.len() > 0 {
 		metadatas := make([]string, 0, len(metadata)+1)
 		for key, value := range metadata {
@@ -374,8 +400,63 @@ func (f *Filter) Include(remote string, size int64, modTime time.Time, metadata
 	include := f.IncludeRemote(remote)
 	if !include {
 		fs.Debugf(remote, "Excluded (Path Filter)")
+		return false
+	}
+	if f.Opt.SampleRate > 0 && f.SampleValue(remote) >= f.Opt.SampleRate {
+		fs.Debugf(remote, "Excluded (Sample Filter)")
+		return false
+	}
+	if f.sampled != nil {
+		if _, ok := f.sampled[remote]; !ok {
+			fs.Debugf(remote, "Excluded (Sample Filter)")
+			return false
+		}
+	}
+	return true
+}
+
+// SampleValue returns a number in the range [0, 1) for remote which
+// is used to choose the files in the sample.
+//
+// It is derived from a hash of remote and --sample-seed so the same
+// files are chosen each time regardless of the order they are listed.
+func (f *Filter) SampleValue(remote string) float64 {
+	var seed [8]byte
+	binary.BigEndian.PutUint64(seed[:], uint64(f.Opt.SampleSeed))
+	h := sha256.New()
+	_, _ = h.Write(seed[:])
+	_, _ = h.Write([]byte(remote))
+	sum := h.Sum(nil)
+	return float64(binary.BigEndian.Uint64(sum)>>11) / (1 << 53)
+}
+
+// SetSample chooses the --sample-count files with the lowest
+// SampleValue from remotes and only includes those from now on.
+func (f *Filter) SetSample(remotes []string) {
+	type sample struct {
+		remote string
+		value  float64
+	}
+	samples := make([]sample, len(remotes))
+	for i, remote := range remotes {
+		samples[i] = sample{remote: remote, value: f.SampleValue(remote)}
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].value < samples[j].value
+	})
+	if len(samples) > f.Opt.SampleCount {
+		samples = samples[:f.Opt.SampleCount]
+	}
+	f.sampled = make(FilesMap, len(samples))
+	for _, sample := range samples {
+		f.sampled[sample.remote] = struct{}{}
 	}
-	return include
+}
+
+// NeedsSample returns true if --sample-count is in use and SetSample
+// hasn't been called yet.
+func (f *Filter) NeedsSample() bool {
+	return f.Opt.SampleCount > 0 && f.sampled == nil
 }
 
 // IncludeObject returns whether this object should be included into
@@ -419,6 +500,12 @@ func (f *Filter) DumpFilters() string {
 	for _, dirRule := range f.dirRules.rules {
 		rules = append(rules, dirRule.String())
 	}
+	if f.Opt.SampleRate > 0 {
+		rules = append(rules, fmt.Sprintf("Sample of files with rate %v and seed %d", f.Opt.SampleRate, f.Opt.SampleSeed))
+	}
+	if f.Opt.SampleCount > 0 {
+		rules = append(rules, fmt.Sprintf("Sample of %d files with seed %d", f.Opt.SampleCount, f.Opt.SampleSeed))
+	}
 	if f.metaRules.len() > 0 {
 		rules = append(rules, "--- Metadata filter rules ---")
 		for _, metaRule := range f.metaRules.rules {
@@ -495,6 +582,113 @@ func (f *Filter) UsesDirectoryFilters() bool {
 	return true
 }
 
+// ListPrefixes returns the directories which contain all the files
+// the filters can include, so only these need to be listed. The
+// directories are relative to the root of the filters and are never
+// inside each other.
+//
+// It returns false if these can't be worked out, which is the case
+// unless every include rule before an exclude everything rule is
+// anchored to a directory with no wildcards in, e.g. "/dir/sub/**" or
+// "/dir/*.jpg". Exclude rules don't matter as they only remove files.
+func (f *Filter) ListPrefixes() (prefixes []string, ok bool) {
+	if f.files != nil || len(f.Opt.ExcludeFile) > 0 {
+		return nil, false
+	}
+	matchAll := make(map[string]struct{})
+	for _, glob := range []string{"*", "**", "/**"} {
+		re, err := GlobToRegexp(glob, f.Opt.IgnoreCase)
+		if err != nil {
+			return nil, false
+		}
+		matchAll[re.String()] = struct{}{}
+	}
+	prefixes, ok = f.fileRules.anchoredDirs(matchAll)
+	if !ok {
+		return nil, false
+	}
+	// The directories which can be included must be in or above
+	// the prefixes otherwise they won't be found
+	dirs, ok := f.dirRules.anchoredDirs(matchAll)
+	if !ok {
+		return nil, false
+	}
+	for _, dir := range dirs {
+		found := false
+		for _, prefix := range prefixes {
+			if dir == prefix || strings.HasPrefix(dir, prefix+"/") || strings.HasPrefix(prefix, dir+"/") {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return tidyPrefixes(prefixes), true
+}
+
+// anchoredDirs returns the directories the include rules before an
+// exclude everything rule are anchored to, or false if there isn't
+// an exclude everything rule or any of the include rules isn't
+// anchored.
+func (rs *rules) anchoredDirs(matchAll map[string]struct{}) (dirs []string, ok bool) {
+	for _, rule := range rs.rules {
+		if _, found := matchAll[rule.Regexp.String()]; found {
+			return dirs, !rule.Include
+		}
+		if !rule.Include {
+			continue
+		}
+		dir := anchoredDir(rule.Regexp.String())
+		if dir == "" {
+			return nil, false
+		}
+		dirs = append(dirs, dir)
+	}
+	// Anything not matched is included
+	return nil, false
+}
+
+// anchoredDir returns the directory with no wildcards in that all
+// matches of the regexp re made from a glob are inside, or "" if
+// there isn't one.
+func anchoredDir(re string) string {
+	parsed, err := syntax.Parse(re, syntax.Perl)
+	if err != nil || parsed.Op != syntax.OpConcat || len(parsed.Sub) == 0 || parsed.Sub[0].Op != syntax.OpBeginText {
+		return ""
+	}
+	var prefix strings.Builder
+	for _, sub := range parsed.Sub[1:] {
+		if sub.Op != syntax.OpLiteral || sub.Flags&syntax.FoldCase != 0 {
+			break
+		}
+		prefix.WriteString(string(sub.Rune))
+	}
+	dir := prefix.String()
+	i := strings.LastIndex(dir, "/")
+	if i < 0 {
+		return ""
+	}
+	return dir[:i]
+}
+
+// tidyPrefixes sorts the directories and removes any inside others
+func tidyPrefixes(prefixes []string) []string {
+	sort.Strings(prefixes)
+	out := prefixes[:0]
+	for _, prefix := range prefixes {
+		if len(out) > 0 {
+			last := out[len(out)-1]
+			if prefix == last || strings.HasPrefix(prefix, last+"/") {
+				continue
+			}
+		}
+		out = append(out, prefix)
+	}
+	return out
+}
+
 // Context key for config
 type configContextKeyType struct{}
 
@@ -568,3 +762,29 @@ func SetUseFilter(ctx context.Context, useFilter bool) context.Context {
 	*pVal = useFilter
 	return context.WithValue(ctx, useFlagContextKey, pVal)
 }
+
+// Context key for the "count excluded" flag
+type countExcludedContextKeyType struct{}
+
+var countExcludedContextKey = countExcludedContextKeyType{}
+
+// GetCountExcluded obtains the "count excluded" flag from context
+// The flag tells listings to count the files excluded as skipped in the stats
+func GetCountExcluded(ctx context.Context) bool {
+	if ctx != nil {
+		if pVal := ctx.Value(countExcludedContextKey); pVal != nil {
+			return *(pVal.(*bool))
+		}
+	}
+	return false
+}
+
+// SetCountExcluded returns a context having (re)set the "count excluded" flag
+func SetCountExcluded(ctx context.Context, countExcluded bool) context.Context {
+	if countExcluded == GetCountExcluded(ctx) {
+		return ctx // Minimize depth of nested contexts
+	}
+	pVal := new(bool)
+	*pVal = countExcluded
+	return context.WithValue(ctx, countExcludedContextKey, pVal)
+}
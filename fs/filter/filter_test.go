@@ -3,6 +3,7 @@ package filter
 import (
 	"context"
 	"fmt"
+	"math"
 	"os"
 	"strings"
 	"sync"
@@ -383,6 +384,96 @@ func TestNewFilterMinSize(t *testing.T) {
 	assert.False(t, f.InActive())
 }
 
+func TestNewFilterSkipEmpty(t *testing.T) {
+	f, err := NewFilter(nil)
+	require.NoError(t, err)
+	f.Opt.SkipEmpty = true
+	testInclude(t, f, []includeTest{
+		{"file1.jpg", 1, 0, true},
+		{"file2.jpg", 0, 0, false},
+		{"potato/file2.jpg", 0, 0, false},
+		{"unknown.jpg", -1, 0, true},
+	})
+	assert.False(t, f.InActive())
+}
+
+func TestNewFilterSampleRate(t *testing.T) {
+	const n = 10000
+	sample := func(rate float64, seed int64) (included []string) {
+		opt := DefaultOpt
+		opt.SampleRate, opt.SampleSeed = rate, seed
+		f, err := NewFilter(&opt)
+		require.NoError(t, err)
+		assert.False(t, f.InActive())
+		for i := 0; i < n; i++ {
+			remote := fmt.Sprintf("dir%d/file%d.txt", i%10, i)
+			if f.Include(remote, 1, time.Unix(0, 0), nil) {
+				included = append(included, remote)
+			}
+		}
+		return included
+	}
+	for _, rate := range []float64{0.01, 0.1, 0.5} {
+		included := sample(rate, 1)
+		// Allow 5 standard deviations
+		want := rate * n
+		sd := math.Sqrt(n * rate * (1 - rate))
+		assert.InDelta(t, want, float64(len(included)), 5*sd, "rate %v", rate)
+	}
+	// Check the sample is reproducible with the same seed and
+	// differs with a different seed
+	assert.Equal(t, sample(0.1, 1), sample(0.1, 1))
+	assert.NotEqual(t, sample(0.1, 1), sample(0.1, 2))
+	// Check the sample with a higher rate includes the lower one
+	assert.Subset(t, sample(0.2, 1), sample(0.1, 1))
+	assert.Equal(t, n, len(sample(1, 1)))
+}
+
+func TestNewFilterSampleCount(t *testing.T) {
+	var remotes []string
+	for i := 0; i < 1000; i++ {
+		remotes = append(remotes, fmt.Sprintf("file%d", i))
+	}
+	sample := func(count int, seed int64) (included []string) {
+		opt := DefaultOpt
+		opt.SampleCount, opt.SampleSeed = count, seed
+		f, err := NewFilter(&opt)
+		require.NoError(t, err)
+		assert.False(t, f.InActive())
+		assert.True(t, f.NeedsSample())
+		f.SetSample(append([]string(nil), remotes...))
+		assert.False(t, f.NeedsSample())
+		for _, remote := range remotes {
+			if f.Include(remote, 1, time.Unix(0, 0), nil) {
+				included = append(included, remote)
+			}
+		}
+		return included
+	}
+	assert.Equal(t, 10, len(sample(10, 1)))
+	assert.Equal(t, 1000, len(sample(2000, 1)))
+	assert.Equal(t, sample(10, 1), sample(10, 1))
+	assert.NotEqual(t, sample(10, 1), sample(10, 2))
+	assert.Subset(t, sample(20, 1), sample(10, 1))
+}
+
+func TestNewFilterSampleErrors(t *testing.T) {
+	for _, test := range []struct {
+		rate  float64
+		count int
+	}{
+		{rate: -0.1},
+		{rate: 1.1},
+		{count: -1},
+		{rate: 0.1, count: 10},
+	} {
+		opt := DefaultOpt
+		opt.SampleRate, opt.SampleCount = test.rate, test.count
+		_, err := NewFilter(&opt)
+		assert.Error(t, err, test)
+	}
+}
+
 func TestNewFilterMaxSize(t *testing.T) {
 	f, err := NewFilter(nil)
 	require.NoError(t, err)
@@ -853,6 +944,75 @@ func TestNewFilterUsesDirectoryFilters(t *testing.T) {
 	}
 }
 
+func TestFilterListPrefixes(t *testing.T) {
+	for _, test := range []struct {
+		rules []string
+		want  []string
+		ok    bool
+	}{
+		{rules: nil},
+		{rules: []string{"- *.jpg"}},
+		{rules: []string{"+ /dir/**"}},
+		{rules: []string{"+ /dir/**", "- **"}, want: []string{"dir"}, ok: true},
+		{rules: []string{"+ /dir/**", "- /**"}, want: []string{"dir"}, ok: true},
+		{rules: []string{"+ /dir/**", "- *"}, want: []string{"dir"}, ok: true},
+		{rules: []string{"+ /dir/sub/**", "+ /other/*.jpg", "- **"}, want: []string{"dir/sub", "other"}, ok: true},
+		{rules: []string{"+ /a/b/**", "+ /a/**", "+ /a/b/c/*", "- **"}, want: []string{"a"}, ok: true},
+		{rules: []string{"+ /ab/**", "+ /a/**", "- **"}, want: []string{"a", "ab"}, ok: true},
+		{rules: []string{"+ /dir/{a,b}/**", "- **"}, want: []string{"dir"}, ok: true},
+		{rules: []string{"- /dir/sub/secret/**", "+ /dir/sub/**", "- **"}, want: []string{"dir/sub"}, ok: true},
+		{rules: []string{"+ /dir/**", "- **", "+ /other/**"}, want: []string{"dir"}, ok: true},
+		{rules: []string{"- **"}, want: nil, ok: true},
+		{rules: []string{"+ /file.txt", "- **"}},
+		{rules: []string{"+ dir/**", "- **"}},
+		{rules: []string{"+ *.jpg", "- **"}},
+		{rules: []string{"+ /*/sub/**", "- **"}},
+		{rules: []string{"+ /dir/**", "+ **"}},
+		{rules: []string{"+ /dir/", "- **"}},
+	} {
+		what := fmt.Sprintf("%q", test.rules)
+		f, err := NewFilter(nil)
+		require.NoError(t, err)
+		for _, rule := range test.rules {
+			require.NoError(t, f.AddRule(rule), what)
+		}
+		got, ok := f.ListPrefixes()
+		assert.Equal(t, test.ok, ok, what)
+		if test.ok {
+			assert.Equal(t, test.want, got, what)
+		}
+	}
+
+	// The implicit exclude of --include works
+	opt := DefaultOpt
+	opt.IncludeRule = []string{"/dir/**", "/other/file.txt"}
+	f, err := NewFilter(&opt)
+	require.NoError(t, err)
+	got, ok := f.ListPrefixes()
+	assert.True(t, ok)
+	assert.Equal(t, []string{"dir", "other"}, got)
+
+	// Case insensitive rules can't be used
+	opt.IgnoreCase = true
+	f, err = NewFilter(&opt)
+	require.NoError(t, err)
+	_, ok = f.ListPrefixes()
+	assert.False(t, ok)
+
+	// Nor can --exclude-if-present or --files-from
+	opt.IgnoreCase = false
+	opt.ExcludeFile = []string{".ignore"}
+	f, err = NewFilter(&opt)
+	require.NoError(t, err)
+	_, ok = f.ListPrefixes()
+	assert.False(t, ok)
+	f, err = NewFilter(nil)
+	require.NoError(t, err)
+	require.NoError(t, f.AddFile("dir/file.txt"))
+	_, ok = f.ListPrefixes()
+	assert.False(t, ok)
+}
+
 func TestGetConfig(t *testing.T) {
 	ctx := context.Background()
 
@@ -58,6 +58,10 @@ func AddFlags(flagSet *pflag.FlagSet) {
 	flags.FVarP(flagSet, &Opt.MaxAge, "max-age", "", "Only transfer files younger than this in s or suffix ms|s|m|h|d|w|M|y", "Filter")
 	flags.FVarP(flagSet, &Opt.MinSize, "min-size", "", "Only transfer files bigger than this in KiB or suffix B|K|M|G|T|P", "Filter")
 	flags.FVarP(flagSet, &Opt.MaxSize, "max-size", "", "Only transfer files smaller than this in KiB or suffix B|K|M|G|T|P", "Filter")
+	flags.BoolVarP(flagSet, &Opt.SkipEmpty, "skip-empty", "", false, "Don't transfer empty (zero length) files", "Filter")
+	flags.Float64VarP(flagSet, &Opt.SampleRate, "sample-rate", "", 0, "Only transfer a random sample of this fraction of the files, e.g. 0.01", "Filter")
+	flags.IntVarP(flagSet, &Opt.SampleCount, "sample-count", "", 0, "Only transfer a random sample of this many files (sync, copy and move only)", "Filter")
+	flags.Int64VarP(flagSet, &Opt.SampleSeed, "sample-seed", "", 0, "Seed for choosing the --sample-rate or --sample-count files", "Filter")
 	flags.BoolVarP(flagSet, &Opt.IgnoreCase, "ignore-case", "", false, "Ignore case in filters (case insensitive)", "Filter")
 	//cvsExclude     = BoolP("cvs-exclude", "C", false, "Exclude files in the same way CVS does")
 }
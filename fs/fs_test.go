@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"sync"
 	"testing"
@@ -15,6 +17,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/obscure"
 	"github.com/rclone/rclone/fs/fserrors"
 	"github.com/rclone/rclone/lib/pacer"
 	"github.com/stretchr/testify/assert"
@@ -381,3 +384,140 @@ func TestOptionGetters(t *testing.T) {
 	}
 
 }
+
+func TestResolveConfig(t *testing.T) {
+	fsInfo := &RegInfo{
+		Name:    "local",
+		Prefix:  "local",
+		Options: append(testOptions, nouncOption), // check duplicates are ignored
+	}
+
+	oldConfigFileGet := ConfigFileGet
+	ConfigFileGet = func(section, key string) (string, bool) {
+		if section == "sausage" && key == "nounc" {
+			return "file", true
+		}
+		return "", false
+	}
+	defer func() {
+		ConfigFileGet = oldConfigFileGet
+	}()
+
+	type resolved struct {
+		Name      string
+		Value     string
+		Source    string
+		Overrides []string
+	}
+	resolve := func(connectionStringConfig configmap.Simple) (out []resolved) {
+		for _, option := range ResolveConfig(fsInfo, "sausage", connectionStringConfig) {
+			out = append(out, resolved{option.Option.Name, option.Value, option.Source, option.Overrides})
+		}
+		return out
+	}
+
+	// Defaults, the config file and flags
+	assert.Equal(t, []resolved{
+		{"copy_links", "false", ConfigSourceDefault, nil},
+		{"nounc", "file", ConfigSourceConfigFile, nil},
+		{"case_insensitive", "true", ConfigSourceFlag, nil},
+	}, resolve(nil))
+
+	// Environment variables override the config file
+	t.Setenv("RCLONE_COPY_LINKS", "true")
+	t.Setenv("RCLONE_CONFIG_SAUSAGE_NOUNC", "env")
+	assert.Equal(t, []resolved{
+		{"copy_links", "true", ConfigSourceBackendEnv, nil},
+		{"nounc", "env", ConfigSourceRemoteEnv, []string{ConfigSourceConfigFile}},
+		{"case_insensitive", "true", ConfigSourceFlag, nil},
+	}, resolve(nil))
+
+	// The connection string overrides everything
+	assert.Equal(t, []resolved{
+		{"copy_links", "true", ConfigSourceBackendEnv, nil},
+		{"case_insensitive", "true", ConfigSourceFlag, nil},
+		{"nounc", "conn", ConfigSourceConnectionString, []string{ConfigSourceRemoteEnv, ConfigSourceConfigFile}},
+	}, resolve(configmap.Simple{"nounc": "conn"}))
+}
+
+func TestSecretCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses a shell script")
+	}
+	// The command prints the secret asked for recording each call
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	script := filepath.Join(dir, "secret.sh")
+	require.NoError(t, os.WriteFile(script, []byte(`#!/bin/sh
+echo "$RCLONE_SECRET_REMOTE $1" >> "`+calls+`"
+echo "secret-$1"
+`), 0700))
+	readCalls := func() string {
+		data, err := os.ReadFile(calls)
+		if os.IsNotExist(err) {
+			return ""
+		}
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	fsInfo := &RegInfo{
+		Name:   "secrettest",
+		Prefix: "secrettest",
+		Options: Options{
+			{Name: "user"},
+			{Name: "token", Sensitive: true},
+			{Name: "pass", IsPassword: true},
+			{Name: "key", Sensitive: true},
+		},
+	}
+	configFile := map[string]string{}
+	oldConfigFileGet := ConfigFileGet
+	ConfigFileGet = func(section, key string) (string, bool) {
+		value, ok := configFile[section+"."+key]
+		return value, ok
+	}
+	defer func() {
+		ConfigFileGet = oldConfigFileGet
+	}()
+	get := func(configName string, connectionStringConfig configmap.Simple, key string) (string, bool) {
+		return ConfigMap(fsInfo, configName, connectionStringConfig).Get(key)
+	}
+
+	// Not run if set in a connection string
+	value, _ := get("fromconn", configmap.Simple{SecretCommandKey: script}, "token")
+	assert.Equal(t, "", value)
+	assert.Equal(t, "", readCalls())
+
+	// Run if set in the config file, only for secrets
+	configFile["fromfile."+SecretCommandKey] = script
+	configFile["fromfile.key"] = "from file"
+	value, _ = get("fromfile", nil, "user")
+	assert.Equal(t, "", value)
+	value, ok := get("fromfile", nil, "token")
+	assert.True(t, ok)
+	assert.Equal(t, "secret-token", value)
+	value, ok = get("fromfile", nil, "pass")
+	assert.True(t, ok)
+	assert.Equal(t, "secret-pass", obscure.MustReveal(value))
+
+	// Secrets set another way take precedence
+	value, ok = get("fromfile", nil, "key")
+	assert.True(t, ok)
+	assert.Equal(t, "from file", value)
+	value, ok = get("fromfile", configmap.Simple{"token": "from conn"}, "token")
+	assert.True(t, ok)
+	assert.Equal(t, "from conn", value)
+
+	// Run if set in the remote's environment variable
+	t.Setenv("RCLONE_CONFIG_FROMENV_SECRET_COMMAND", script)
+	value, ok = get("fromenv", nil, "token")
+	assert.True(t, ok)
+	assert.Equal(t, "secret-token", value)
+
+	// Each command is run once for each secret of each remote
+	value, ok = get("fromenv", nil, "token")
+	assert.True(t, ok)
+	assert.Equal(t, "secret-token", value)
+	assert.Equal(t, "fromfile token\nfromfile pass\nfromenv token\n", readCalls())
+}
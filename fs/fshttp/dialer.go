@@ -6,6 +6,7 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rclone/rclone/fs"
@@ -17,8 +18,9 @@ import (
 // Dialer structure contains default dialer and timeout, tclass support
 type Dialer struct {
 	net.Dialer
-	timeout time.Duration
-	tclass  int
+	timeout          time.Duration
+	firstByteTimeout time.Duration
+	tclass           int
 }
 
 // NewDialer creates a Dialer structure with Timeout, Keepalive,
@@ -30,8 +32,9 @@ func NewDialer(ctx context.Context) *Dialer {
 			Timeout:   ci.ConnectTimeout,
 			KeepAlive: 30 * time.Second,
 		},
-		timeout: ci.Timeout,
-		tclass:  int(ci.TrafficClass),
+		timeout:          ci.Timeout,
+		firstByteTimeout: ci.FirstByteTimeout,
+		tclass:           int(ci.TrafficClass),
 	}
 	if ci.BindAddr != nil {
 		dialer.Dialer.LocalAddr = &net.TCPAddr{IP: ci.BindAddr}
@@ -85,8 +88,9 @@ func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.
 	}
 
 	t := &timeoutConn{
-		Conn:    c,
-		timeout: d.timeout,
+		Conn:             c,
+		timeout:          d.timeout,
+		firstByteTimeout: d.firstByteTimeout,
 	}
 	return t, t.nudgeDeadline()
 }
@@ -94,15 +98,45 @@ func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.
 // A net.Conn that sets deadline for every Read/Write operation
 type timeoutConn struct {
 	net.Conn
-	timeout time.Duration
+	timeout          time.Duration
+	firstByteTimeout time.Duration // timeout for the first byte of a response if set
+	waiting          atomic.Bool   // set if written to and waiting for the first byte of the response
+}
+
+// deadline returns the time timeout from now or no deadline if
+// timeout is 0
+func deadline(timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
 }
 
 // Nudge the deadline for an idle timeout on by c.timeout if non-zero
+//
+// If c.firstByteTimeout is set then reads waiting for the first byte
+// of a response are given that long instead.
 func (c *timeoutConn) nudgeDeadline() error {
-	if c.timeout > 0 {
-		return c.SetDeadline(time.Now().Add(c.timeout))
+	if c.firstByteTimeout <= 0 {
+		if c.timeout > 0 {
+			return c.SetDeadline(deadline(c.timeout))
+		}
+		return nil
+	}
+	readTimeout := c.timeout
+	if c.waiting.Load() {
+		readTimeout = c.firstByteTimeout
 	}
-	return nil
+	err := c.SetWriteDeadline(deadline(c.timeout))
+	if err != nil {
+		return err
+	}
+	return c.SetReadDeadline(deadline(readTimeout))
+}
+
+// hasTimeout returns true if any timeouts are set
+func (c *timeoutConn) hasTimeout() bool {
+	return c.timeout > 0 || c.firstByteTimeout > 0
 }
 
 // Read bytes with rate limiting and idle timeouts
@@ -110,7 +144,8 @@ func (c *timeoutConn) Read(b []byte) (n int, err error) {
 	// Ideally we would LimitBandwidth(len(b)) here and replace tokens we didn't use
 	n, err = c.Conn.Read(b)
 	accounting.TokenBucket.LimitBandwidth(accounting.TokenBucketSlotTransportRx, n)
-	if err == nil && n > 0 && c.timeout > 0 {
+	if err == nil && n > 0 && c.hasTimeout() {
+		c.waiting.Store(false)
 		err = c.nudgeDeadline()
 	}
 	return n, err
@@ -120,7 +155,8 @@ func (c *timeoutConn) Read(b []byte) (n int, err error) {
 func (c *timeoutConn) Write(b []byte) (n int, err error) {
 	accounting.TokenBucket.LimitBandwidth(accounting.TokenBucketSlotTransportTx, len(b))
 	n, err = c.Conn.Write(b)
-	if err == nil && n > 0 && c.timeout > 0 {
+	if err == nil && n > 0 && c.hasTimeout() {
+		c.waiting.Store(true)
 		err = c.nudgeDeadline()
 	}
 	return n, err
@@ -6,12 +6,15 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
+	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"net/http/cookiejar"
 	"net/http/httputil"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -53,6 +56,9 @@ func NewTransportCustom(ctx context.Context, customize func(*http.Transport)) ht
 	t.MaxIdleConns = 2 * t.MaxIdleConnsPerHost
 	t.TLSHandshakeTimeout = ci.ConnectTimeout
 	t.ResponseHeaderTimeout = ci.Timeout
+	if ci.FirstByteTimeout > 0 {
+		t.ResponseHeaderTimeout = ci.FirstByteTimeout
+	}
 	t.DisableKeepAlives = ci.DisableHTTPKeepAlives
 
 	// TLS Config
@@ -104,8 +110,17 @@ func NewTransportCustom(ctx context.Context, customize func(*http.Transport)) ht
 			" the body of the request will be gunzipped before showing it.")
 	}
 
-	if ci.DisableHTTP2 {
+	switch {
+	case ci.DisableHTTP2 || ci.HTTPVersion == "1.1":
+		t.ForceAttemptHTTP2 = false
 		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	case ci.HTTPVersion == "2":
+		// Attempt HTTP/2 even though we have customized the dialer
+		// and the TLS config. TLSNextProto may have been copied from
+		// the default transport so reset it to configure HTTP/2 for
+		// this transport.
+		t.ForceAttemptHTTP2 = true
+		t.TLSNextProto = nil
 	}
 
 	// customize the transport if required
@@ -134,9 +149,57 @@ func NewClient(ctx context.Context) *http.Client {
 	if ci.Cookie {
 		client.Jar = cookieJar
 	}
+	client.CheckRedirect = checkRedirect(ci)
 	return client
 }
 
+// ErrRedirectNotAllowed is returned when an HTTP redirect is refused
+// by the --redirect-* flags
+var ErrRedirectNotAllowed = errors.New("HTTP redirect not allowed")
+
+// maxRedirects is the number of redirects followed, the same as the
+// default for http.Client
+const maxRedirects = 10
+
+// checkRedirect returns a CheckRedirect function for an http.Client
+// which applies the redirect policy set in ci, or nil to use the
+// default policy if none is set.
+func checkRedirect(ci *fs.ConfigInfo) func(req *http.Request, via []*http.Request) error {
+	if len(ci.RedirectCodes) == 0 && !ci.RedirectSameHost && !ci.RedirectKeepAuth {
+		return nil
+	}
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		first := via[0]
+		if len(ci.RedirectCodes) > 0 && req.Response != nil {
+			allowed := false
+			for _, code := range ci.RedirectCodes {
+				if req.Response.StatusCode == code {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				return fmt.Errorf("%w: status %d is not in --redirect-codes", ErrRedirectNotAllowed, req.Response.StatusCode)
+			}
+		}
+		if ci.RedirectSameHost && !strings.EqualFold(req.URL.Hostname(), first.URL.Hostname()) {
+			return fmt.Errorf("%w: redirect from %q to different host %q with --redirect-same-host", ErrRedirectNotAllowed, first.URL.Hostname(), req.URL.Hostname())
+		}
+		// The http.Client removes the Authorization header when
+		// redirecting to a different host, so put it back if
+		// required.
+		if ci.RedirectKeepAuth && req.Header.Get("Authorization") == "" {
+			if auth := first.Header.Get("Authorization"); auth != "" {
+				req.Header.Set("Authorization", auth)
+			}
+		}
+		return nil
+	}
+}
+
 // Transport is our http Transport which wraps an http.Transport
 // * Sets the User Agent
 // * Does logging
@@ -292,6 +355,8 @@ func (t *Transport) RoundTrip(req *http.Request) (resp *http.Response, err error
 	}
 	// Update metrics
 	t.metrics.onResponse(req, resp)
+	// Record throttling and errors for --adaptive-concurrency
+	accounting.RecordTransaction((err != nil && req.Context().Err() == nil) || (resp != nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500)))
 
 	if err == nil {
 		checkServerTime(req, resp)
@@ -1,9 +1,20 @@
 package fshttp
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
+	"github.com/rclone/rclone/fs"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCleanAuth(t *testing.T) {
@@ -45,3 +56,201 @@ func TestCleanAuths(t *testing.T) {
 		assert.Equal(t, test.want, got, test.in)
 	}
 }
+
+func TestCheckRedirect(t *testing.T) {
+	// Server on another host which records the auth it received
+	var gotAuth string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		_, _ = w.Write([]byte("other"))
+	}))
+	defer other.Close()
+	otherURL, err := url.Parse(other.URL)
+	require.NoError(t, err)
+	// Use a different name for the other server so it is a different host
+	crossHost := fmt.Sprintf("http://localhost:%s/", otherURL.Port())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/same301", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/target", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/same307", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/target", http.StatusTemporaryRedirect)
+	})
+	mux.HandleFunc("/cross302", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, crossHost, http.StatusFound)
+	})
+	mux.HandleFunc("/target", func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		_, _ = w.Write([]byte("target"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for _, test := range []struct {
+		name     string
+		ci       fs.ConfigInfo
+		path     string
+		wantErr  bool
+		wantBody string
+		wantAuth string
+	}{
+		{name: "default same host", path: "/same301", wantBody: "target", wantAuth: "secret"},
+		{name: "default cross host", path: "/cross302", wantBody: "other", wantAuth: ""},
+		{name: "codes allowed", ci: fs.ConfigInfo{RedirectCodes: []int{301, 302}}, path: "/same301", wantBody: "target", wantAuth: "secret"},
+		{name: "codes refused", ci: fs.ConfigInfo{RedirectCodes: []int{301, 302}}, path: "/same307", wantErr: true},
+		{name: "same host allowed", ci: fs.ConfigInfo{RedirectSameHost: true}, path: "/same307", wantBody: "target", wantAuth: "secret"},
+		{name: "same host refused", ci: fs.ConfigInfo{RedirectSameHost: true}, path: "/cross302", wantErr: true},
+		{name: "keep auth", ci: fs.ConfigInfo{RedirectKeepAuth: true}, path: "/cross302", wantBody: "other", wantAuth: "secret"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			gotAuth = ""
+			client := &http.Client{
+				CheckRedirect: checkRedirect(&test.ci),
+			}
+			req, err := http.NewRequest("GET", server.URL+test.path, nil)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", "secret")
+			resp, err := client.Do(req)
+			if test.wantErr {
+				require.Error(t, err)
+				assert.True(t, errors.Is(err, ErrRedirectNotAllowed), err)
+				return
+			}
+			require.NoError(t, err)
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+			buf := make([]byte, 16)
+			n, _ := resp.Body.Read(buf)
+			assert.Equal(t, test.wantBody, string(buf[:n]))
+			assert.Equal(t, test.wantAuth, gotAuth)
+		})
+	}
+}
+
+func TestCheckRedirectDefault(t *testing.T) {
+	assert.Nil(t, checkRedirect(&fs.ConfigInfo{}))
+}
+
+func TestHTTPVersion(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Proto))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	for _, test := range []struct {
+		version      string
+		disableHTTP2 bool
+		want         string
+	}{
+		{version: "1.1", want: "HTTP/1.1"},
+		{version: "2", want: "HTTP/2.0"},
+		{disableHTTP2: true, want: "HTTP/1.1"},
+	} {
+		t.Run(fmt.Sprintf("version=%q,disableHTTP2=%v", test.version, test.disableHTTP2), func(t *testing.T) {
+			ctx, ci := fs.AddConfig(context.Background())
+			ci.InsecureSkipVerify = true
+			ci.HTTPVersion = test.version
+			ci.DisableHTTP2 = test.disableHTTP2
+			client := &http.Client{
+				Transport: NewTransportCustom(ctx, nil),
+			}
+			resp, err := client.Get(server.URL)
+			require.NoError(t, err)
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, resp.Proto)
+			assert.Equal(t, test.want, string(body))
+		})
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	const (
+		short = 100 * time.Millisecond
+		long  = 5 * time.Second
+		delay = 500 * time.Millisecond
+	)
+
+	// A server which is slow to send the first byte of the response
+	slowStart := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer slowStart.Close()
+
+	// A server which goes idle in the middle of the response
+	stall := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hel"))
+		w.(http.Flusher).Flush()
+		time.Sleep(delay)
+		_, _ = w.Write([]byte("lo"))
+	}))
+	defer stall.Close()
+
+	// A server which accepts connections but never does a TLS handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() {
+		_ = listener.Close()
+	}()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, _ = io.Copy(io.Discard, conn)
+				_ = conn.Close()
+			}()
+		}
+	}()
+	noHandshake := "https://" + listener.Addr().String()
+
+	for _, test := range []struct {
+		name             string
+		url              string
+		connectTimeout   time.Duration
+		firstByteTimeout time.Duration
+		timeout          time.Duration
+		wantErr          string
+	}{
+		{name: "connect", url: noHandshake, connectTimeout: short, timeout: long, wantErr: "TLS handshake timeout"},
+		{name: "first-byte", url: slowStart.URL, connectTimeout: long, firstByteTimeout: short, timeout: long, wantErr: "timeout"},
+		{name: "first-byte-longer-than-idle", url: slowStart.URL, connectTimeout: long, firstByteTimeout: long, timeout: short},
+		{name: "first-byte-uses-timeout", url: slowStart.URL, connectTimeout: long, timeout: short, wantErr: "timeout"},
+		{name: "idle", url: stall.URL, connectTimeout: long, firstByteTimeout: long, timeout: short, wantErr: "timeout"},
+		{name: "idle-ok", url: stall.URL, connectTimeout: long, firstByteTimeout: short, timeout: long},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, ci := fs.AddConfig(context.Background())
+			ci.ConnectTimeout = test.connectTimeout
+			ci.FirstByteTimeout = test.firstByteTimeout
+			ci.Timeout = test.timeout
+			client := &http.Client{
+				Transport: NewTransportCustom(ctx, nil),
+			}
+			start := time.Now()
+			var body []byte
+			resp, err := client.Get(test.url)
+			if err == nil {
+				body, err = io.ReadAll(resp.Body)
+				_ = resp.Body.Close()
+			}
+			if test.wantErr != "" {
+				assert.ErrorContains(t, err, test.wantErr)
+				assert.Less(t, time.Since(start), long, "should time out before the long timeout")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "hello", string(body))
+		})
+	}
+}
@@ -26,6 +26,7 @@ type hashDefinition struct {
 	alias    string
 	newFunc  func() hash.Hash
 	hashType Type
+	block    *blockDefinition // set if the hash can be calculated in parallel
 }
 
 var (
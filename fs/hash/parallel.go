@@ -0,0 +1,137 @@
+package hash
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"sync/atomic"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// blockDefinition describes a hash which is made by hashing the
+// hashes of the fixed size blocks of the data
+type blockDefinition struct {
+	size        int64            // size of each block, the last may be shorter
+	newBlock    func() hash.Hash // hash for each block
+	newCombiner func() hash.Hash // hash the block hashes are written to in order
+}
+
+// RegisterBlockHash marks hashType as being made from the hashes of
+// each blockSize block of the data, made with newBlock, written in
+// order to the hash made with newCombiner.
+//
+// As the blocks can be hashed independently hashes registered like
+// this can be calculated in parallel with StreamParallel.
+func RegisterBlockHash(hashType Type, blockSize int64, newBlock, newCombiner func() hash.Hash) {
+	definition := type2hash[hashType]
+	if definition == nil {
+		panic(fmt.Sprintf("RegisterBlockHash: unknown hash type %d", int(hashType)))
+	}
+	definition.block = &blockDefinition{
+		size:        blockSize,
+		newBlock:    newBlock,
+		newCombiner: newCombiner,
+	}
+}
+
+// BlockSize returns the size of the blocks hashType is made from if
+// it can be calculated in parallel, or 0 if it can't.
+func BlockSize(hashType Type) int64 {
+	if definition := type2hash[hashType]; definition != nil && definition.block != nil {
+		return definition.block.size
+	}
+	return 0
+}
+
+// StreamParallel calculates the hash of hashType of the first size
+// bytes of in.
+//
+// If hashType was registered with RegisterBlockHash then up to
+// concurrency blocks are read and hashed at once, otherwise in is
+// read and hashed sequentially.
+func StreamParallel(ctx context.Context, in io.ReaderAt, size int64, hashType Type, concurrency int) (string, error) {
+	definition := type2hash[hashType]
+	if definition == nil {
+		return "", fmt.Errorf("StreamParallel: %w: %v", ErrUnsupported, hashType)
+	}
+	var sum []byte
+	var err error
+	if definition.block == nil || concurrency <= 1 || size <= definition.block.size {
+		h := definition.newFunc()
+		_, err = io.Copy(h, newContextReader(ctx, io.NewSectionReader(in, 0, size)))
+		sum = h.Sum(nil)
+	} else {
+		sum, err = definition.block.stream(ctx, in, size, concurrency)
+	}
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum), nil
+}
+
+// stream hashes the blocks of in using concurrency goroutines
+// returning the combined hash
+func (b *blockDefinition) stream(ctx context.Context, in io.ReaderAt, size int64, concurrency int) ([]byte, error) {
+	blocks := (size + b.size - 1) / b.size
+	if int64(concurrency) > blocks {
+		concurrency = int(blocks)
+	}
+	sums := make([][]byte, blocks)
+	var next atomic.Int64 // the next block to hash
+	g, gCtx := errgroup.WithContext(ctx)
+	for i := 0; i < concurrency; i++ {
+		g.Go(func() error {
+			h := b.newBlock()
+			for {
+				block := next.Add(1) - 1
+				if block >= blocks {
+					return nil
+				}
+				start := block * b.size
+				n := b.size
+				if start+n > size {
+					n = size - start
+				}
+				h.Reset()
+				_, err := io.Copy(h, newContextReader(gCtx, io.NewSectionReader(in, start, n)))
+				if err != nil {
+					return err
+				}
+				sums[block] = h.Sum(nil)
+			}
+		})
+	}
+	err := g.Wait()
+	if err != nil {
+		return nil, err
+	}
+	combiner := b.newCombiner()
+	for _, sum := range sums {
+		_, _ = combiner.Write(sum)
+	}
+	return combiner.Sum(nil), nil
+}
+
+// contextReader stops reading with the context error when the
+// context is cancelled
+type contextReader struct {
+	ctx context.Context
+	in  io.Reader
+}
+
+// newContextReader makes a reader which reads from in until ctx is
+// cancelled
+func newContextReader(ctx context.Context, in io.Reader) io.Reader {
+	return &contextReader{ctx: ctx, in: in}
+}
+
+// Read reads up to len(p) bytes into p
+func (r *contextReader) Read(p []byte) (n int, err error) {
+	if err = r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.in.Read(p)
+}
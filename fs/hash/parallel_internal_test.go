@@ -0,0 +1,99 @@
+package hash
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testBlocks is a hash of the SHA-256 of each 1 KiB block like the
+// Dropbox hash
+var testBlocks = &blockDefinition{
+	size:        1024,
+	newBlock:    sha256.New,
+	newCombiner: sha256.New,
+}
+
+// blockSum calculates the testBlocks hash of data sequentially
+func blockSum(data []byte) string {
+	combiner := sha256.New()
+	for len(data) > 0 {
+		n := 1024
+		if n > len(data) {
+			n = len(data)
+		}
+		sum := sha256.Sum256(data[:n])
+		_, _ = combiner.Write(sum[:])
+		data = data[n:]
+	}
+	return hex.EncodeToString(combiner.Sum(nil))
+}
+
+func TestBlockStream(t *testing.T) {
+	ctx := context.Background()
+	data := make([]byte, 10*1024+17)
+	_, _ = rand.New(rand.NewSource(1)).Read(data)
+	for _, size := range []int{1, 1023, 1024, 1025, 4096, 10*1024 + 17} {
+		for _, concurrency := range []int{1, 2, 4, 64} {
+			t.Run(fmt.Sprintf("size=%d,concurrency=%d", size, concurrency), func(t *testing.T) {
+				sum, err := testBlocks.stream(ctx, bytes.NewReader(data), int64(size), concurrency)
+				require.NoError(t, err)
+				assert.Equal(t, blockSum(data[:size]), hex.EncodeToString(sum))
+			})
+		}
+	}
+
+	// Cancelling the context stops the hashing
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err := testBlocks.stream(ctx, bytes.NewReader(data), int64(len(data)), 4)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestStreamParallel(t *testing.T) {
+	ctx := context.Background()
+	data := []byte("hello world, this is some data to hash")
+
+	// Hashes not made of blocks are hashed sequentially
+	assert.Equal(t, int64(0), BlockSize(MD5))
+	sum, err := StreamParallel(ctx, bytes.NewReader(data), int64(len(data)), MD5, 4)
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%x", md5.Sum(data)), sum)
+
+	// Only size bytes are hashed
+	sum, err = StreamParallel(ctx, bytes.NewReader(data), 5, MD5, 4)
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%x", md5.Sum(data[:5])), sum)
+
+	_, err = StreamParallel(ctx, bytes.NewReader(data), int64(len(data)), None, 4)
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
+
+func BenchmarkBlockStream(b *testing.B) {
+	ctx := context.Background()
+	blocks := &blockDefinition{
+		size:        4 * 1024 * 1024,
+		newBlock:    sha256.New,
+		newCombiner: sha256.New,
+	}
+	data := make([]byte, 64*1024*1024)
+	for _, concurrency := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				_, err := blocks.stream(ctx, bytes.NewReader(data), int64(len(data)), concurrency)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
 	"github.com/rclone/rclone/fs/filter"
 )
 
@@ -41,6 +42,7 @@ func filterAndSortDir(ctx context.Context, entries fs.DirEntries, includeAll boo
 	IncludeObject func(ctx context.Context, o fs.Object) bool,
 	IncludeDirectory func(remote string) (bool, error)) (newEntries fs.DirEntries, err error) {
 	newEntries = entries[:0] // in place filter
+	countExcluded := filter.GetCountExcluded(ctx)
 	prefix := ""
 	if dir != "" {
 		prefix = dir + "/"
@@ -54,6 +56,9 @@ func filterAndSortDir(ctx context.Context, entries fs.DirEntries, includeAll boo
 			if !includeAll && !IncludeObject(ctx, x) {
 				ok = false
 				fs.Debugf(x, "Excluded")
+				if countExcluded {
+					accounting.Stats(ctx).Skipped(accounting.SkipFiltered, 1)
+				}
 			}
 		case fs.Directory:
 			if !includeAll {
@@ -12,6 +12,7 @@ import (
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/dirtree"
 	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/fserrors"
 	"github.com/rclone/rclone/fs/list"
 	"github.com/rclone/rclone/fs/walk"
 	"golang.org/x/text/unicode/norm"
@@ -31,6 +32,7 @@ type March struct {
 	Callback               Marcher         // object to call with results
 	NoCheckDest            bool            // transfer all objects regardless without checking dst
 	NoUnicodeNormalization bool            // don't normalize unicode characters in filenames
+	FdstList               fs.Fs           // if set list the destination with this instead of Fdst
 	// internal state
 	srcListDir listDirFn // function to call to list a directory in the src
 	dstListDir listDirFn // function to call to list a directory in the dst
@@ -48,13 +50,27 @@ type Marcher interface {
 	Match(ctx context.Context, dst, src fs.DirEntry) (recurse bool)
 }
 
+// DirMarcher is an optional interface for Marcher
+type DirMarcher interface {
+	// MarchedDir is called for each directory in the source once
+	// all its entries have been passed to the Marcher with the
+	// subdirectories of it in the source which will be marched
+	// into.
+	MarchedDir(dir string, subdirs []string)
+}
+
 // init sets up a march over opt.Fsrc, and opt.Fdst calling back callback for each match
 // Note: this will flag filter-aware backends on the source side
 func (m *March) init(ctx context.Context) {
 	ci := fs.GetConfig(ctx)
-	m.srcListDir = m.makeListDir(ctx, m.Fsrc, m.SrcIncludeAll)
+	// Each side is listed with its own limit on concurrent listings
+	m.srcListDir = limitListDir(m.makeListDir(ctx, m.Fsrc, m.SrcIncludeAll, true), ci.ListConcurrencyOrCheckers(m.Fsrc))
 	if !m.NoTraverse {
-		m.dstListDir = m.makeListDir(ctx, m.Fdst, m.DstIncludeAll)
+		fdstList := m.Fdst
+		if m.FdstList != nil {
+			fdstList = m.FdstList
+		}
+		m.dstListDir = limitListDir(m.makeListDir(ctx, fdstList, m.DstIncludeAll, false), ci.ListConcurrencyOrCheckers(m.Fdst))
 	}
 	// Now create the matching transform
 	// ..normalise the UTF8 first
@@ -71,22 +87,36 @@ func (m *March) init(ctx context.Context) {
 		m.transforms = append(m.transforms, strings.ToLower)
 	}
 	// Limit parallelism for operations
-	m.limiter = make(chan struct{}, ci.Checkers)
+	m.limiter = make(chan struct{}, ci.CheckersFor(m.Fdst))
 }
 
 // list a directory into entries, err
 type listDirFn func(dir string) (entries fs.DirEntries, err error)
 
+// limitListDir returns a listing function which calls listDir with
+// at most n listings running at once
+func limitListDir(listDir listDirFn, n int) listDirFn {
+	limiter := make(chan struct{}, n)
+	return func(dir string) (entries fs.DirEntries, err error) {
+		limiter <- struct{}{}
+		defer func() { <-limiter }()
+		return listDir(dir)
+	}
+}
+
 // makeListDir makes constructs a listing function for the given fs
 // and includeAll flags for marching through the file system.
+// If countExcluded is set the files excluded are counted as skipped
+// in the stats.
 // Note: this will optionally flag filter-aware backends!
-func (m *March) makeListDir(ctx context.Context, f fs.Fs, includeAll bool) listDirFn {
+func (m *March) makeListDir(ctx context.Context, f fs.Fs, includeAll bool, countExcluded bool) listDirFn {
 	ci := fs.GetConfig(ctx)
 	fi := filter.GetConfig(ctx)
 	if !(ci.UseListR && f.Features().ListR != nil) && // !--fast-list active and
 		!(ci.NoTraverse && fi.HaveFilesFrom()) { // !(--files-from and --no-traverse)
 		return func(dir string) (entries fs.DirEntries, err error) {
 			dirCtx := filter.SetUseFilter(m.Ctx, f.Features().FilterAware && !includeAll) // make filter-aware backends constrain List
+			dirCtx = filter.SetCountExcluded(dirCtx, countExcluded)
 			return list.DirSorted(dirCtx, f, includeAll, dir)
 		}
 	}
@@ -104,6 +134,7 @@ func (m *March) makeListDir(ctx context.Context, f fs.Fs, includeAll bool) listD
 		defer mu.Unlock()
 		if !started {
 			dirCtx := filter.SetUseFilter(m.Ctx, f.Features().FilterAware && !includeAll) // make filter-aware backends constrain List
+			dirCtx = filter.SetCountExcluded(dirCtx, countExcluded)
 			dirs, dirsErr = walk.NewDirTree(dirCtx, f, m.Dir, includeAll, ci.MaxDepth)
 			started = true
 		}
@@ -152,9 +183,9 @@ func (m *March) Run(ctx context.Context) error {
 	// Start some directory listing go routines
 	var wg sync.WaitGroup         // sync closing of go routines
 	var traversing sync.WaitGroup // running directory traversals
-	checkers := ci.Checkers
-	in := make(chan listDirJob, checkers)
-	for i := 0; i < checkers; i++ {
+	listers := ci.ListConcurrencyOrCheckers(m.Fsrc, m.Fdst)
+	in := make(chan listDirJob, listers)
+	for i := 0; i < listers; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
@@ -453,6 +484,9 @@ func (m *March) processJob(job listDirJob) ([]listDirJob, error) {
 		wg.Wait()
 	}
 
+	// Deal with source entries which collide on the destination
+	srcList, collisionErr := m.resolveCollisions(srcList)
+
 	// Work out what to do and do it
 	srcOnly, dstOnly, matches := matchListings(srcList, dstList, m.transforms)
 	for _, src := range srcOnly {
@@ -498,5 +532,105 @@ func (m *March) processJob(job listDirJob) ([]listDirJob, error) {
 			})
 		}
 	}
-	return jobs, nil
+	if do, ok := m.Callback.(DirMarcher); ok && !job.noSrc {
+		var subdirs []string
+		for _, newJob := range jobs {
+			if !newJob.noSrc {
+				subdirs = append(subdirs, newJob.srcRemote)
+			}
+		}
+		do.MarchedDir(job.srcRemote, subdirs)
+	}
+	return jobs, collisionErr
+}
+
+// renamedObject is a source object given a new name so it doesn't
+// collide with another source object on the destination
+type renamedObject struct {
+	fs.Object
+	remote string
+}
+
+// Remote returns the new name of the object
+func (o *renamedObject) Remote() string {
+	return o.remote
+}
+
+// String returns the new name of the object
+func (o *renamedObject) String() string {
+	return o.remote
+}
+
+// UnWrap returns the source object
+func (o *renamedObject) UnWrap() fs.Object {
+	return o.Object
+}
+
+// transformName returns the leaf of remote in the form used for
+// comparison in matchListings
+func (m *March) transformName(remote string) string {
+	name := path.Base(remote)
+	for _, transform := range m.transforms {
+		name = transform(name)
+	}
+	return name
+}
+
+// collisionName returns a new name for remote, e.g. "file (1).txt"
+// for "file.txt", which doesn't collide with any of the names in
+// seen.
+func (m *March) collisionName(remote string, seen map[string]string) string {
+	ext := path.Ext(remote)
+	if ext == path.Base(remote) {
+		ext = ""
+	}
+	base := strings.TrimSuffix(remote, ext)
+	for i := 1; ; i++ {
+		newRemote := fmt.Sprintf("%s (%d)%s", base, i, ext)
+		if _, found := seen[m.transformName(newRemote)]; !found {
+			return newRemote
+		}
+	}
+}
+
+// resolveCollisions deals with the entries in srcList whose names are
+// different but are the same once transformed for comparison with
+// the destination, e.g. "File" and "file" on a case insensitive
+// destination, according to --case-collision.
+//
+// The first of the colliding entries is always kept. Entries with
+// exactly the same name are left for matchListings to report as
+// duplicates.
+func (m *March) resolveCollisions(srcList fs.DirEntries) (out fs.DirEntries, err error) {
+	ci := fs.GetConfig(m.Ctx)
+	seen := make(map[string]string, len(srcList)) // transformed name to the remote of the first entry
+	for _, entry := range srcList {
+		name := m.transformName(entry.Remote())
+		if _, found := seen[name]; !found {
+			seen[name] = entry.Remote()
+		}
+	}
+	out = srcList[:0] // in place filter
+	for _, entry := range srcList {
+		first := seen[m.transformName(entry.Remote())]
+		if first == entry.Remote() {
+			out = append(out, entry)
+			continue
+		}
+		o, isObject := entry.(fs.Object)
+		switch {
+		case ci.CaseCollision == fs.CaseCollisionRename && isObject:
+			newRemote := m.collisionName(o.Remote(), seen)
+			seen[m.transformName(newRemote)] = newRemote
+			fs.Logf(entry, "Renaming to %q as it collides with %q on the destination", newRemote, first)
+			out = append(out, &renamedObject{Object: o, remote: newRemote})
+		case ci.CaseCollision == fs.CaseCollisionSkip:
+			fs.Logf(entry, "Skipping %s as it collides with %q on the destination", fs.DirEntryType(entry), first)
+		default:
+			collisionErr := fserrors.NoRetryError(fmt.Errorf("%s collides with %q on the destination", fs.DirEntryType(entry), first))
+			fs.Errorf(entry, "%v", collisionErr)
+			err = fs.CountError(collisionErr)
+		}
+	}
+	return out, err
 }
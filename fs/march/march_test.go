@@ -6,9 +6,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"path"
+	"sort"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	_ "github.com/rclone/rclone/backend/local"
 	"github.com/rclone/rclone/fs"
@@ -16,6 +19,7 @@ import (
 	"github.com/rclone/rclone/fs/fserrors"
 	"github.com/rclone/rclone/fstest"
 	"github.com/rclone/rclone/fstest/mockdir"
+	"github.com/rclone/rclone/fstest/mockfs"
 	"github.com/rclone/rclone/fstest/mockobject"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -282,6 +286,153 @@ func TestMarchNoTraverse(t *testing.T) {
 	}
 }
 
+// concurrencyFs is an Fs with a tree of empty directories which
+// records the maximum number of listings running at once
+type concurrencyFs struct {
+	fs.Fs
+	mu       sync.Mutex
+	inFlight int
+	maxSeen  int
+}
+
+func newConcurrencyFs(t *testing.T, name string) *concurrencyFs {
+	f, err := mockfs.NewFs(context.Background(), name, "", nil)
+	require.NoError(t, err)
+	return &concurrencyFs{Fs: f}
+}
+
+// List returns 20 directories in the root and empty subdirectories
+func (f *concurrencyFs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	f.mu.Lock()
+	f.inFlight++
+	if f.inFlight > f.maxSeen {
+		f.maxSeen = f.inFlight
+	}
+	f.mu.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	f.mu.Lock()
+	f.inFlight--
+	f.mu.Unlock()
+	if dir == "" {
+		for i := 0; i < 20; i++ {
+			entries = append(entries, mockdir.New(fmt.Sprintf("dir%d", i)))
+		}
+	}
+	return entries, nil
+}
+
+func TestMarchCheckersPerRemote(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx, ci := fs.AddConfig(ctx)
+	ci.Checkers = 4
+	ci.CheckersPerRemote = map[string]int{"slow": 8, "fast": 2}
+	fsrc := newConcurrencyFs(t, "slow")
+	fdst := newConcurrencyFs(t, "fast")
+
+	mt := &marchTester{
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	m := &March{
+		Ctx:      ctx,
+		Fdst:     fdst,
+		Fsrc:     fsrc,
+		Callback: mt,
+	}
+	mt.processError(m.Run(ctx))
+	mt.cancel()
+	require.NoError(t, mt.currentError())
+	assert.Equal(t, 20, len(mt.match))
+
+	assert.LessOrEqual(t, fsrc.maxSeen, 8)
+	assert.Greater(t, fsrc.maxSeen, 2)
+	assert.LessOrEqual(t, fdst.maxSeen, 2)
+	assert.Greater(t, fdst.maxSeen, 0)
+}
+
+// depthFs is an Fs with a tree of directories "a" and "b" in every
+// directory, 4 levels deep, which records the directories listed
+type depthFs struct {
+	fs.Fs
+	mu     sync.Mutex
+	listed []string
+}
+
+func newDepthFs(t *testing.T, name string) *depthFs {
+	f, err := mockfs.NewFs(context.Background(), name, "", nil)
+	require.NoError(t, err)
+	return &depthFs{Fs: f}
+}
+
+// List returns the subdirectories "a" and "b" of dir
+func (f *depthFs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	f.mu.Lock()
+	f.listed = append(f.listed, dir)
+	f.mu.Unlock()
+	if strings.Count(dir, "/") >= 3 {
+		return nil, nil
+	}
+	for _, name := range []string{"a", "b"} {
+		entries = append(entries, mockdir.New(path.Join(dir, name)))
+	}
+	return entries, nil
+}
+
+// Listed returns the sorted directories which were listed
+func (f *depthFs) Listed() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sort.Strings(f.listed)
+	return f.listed
+}
+
+func TestMarchMaxDepth(t *testing.T) {
+	for _, test := range []struct {
+		maxDepth int
+		exclude  string
+		want     []string
+	}{
+		{maxDepth: 1, want: []string{""}},
+		{maxDepth: 2, want: []string{"", "a", "b"}},
+		{maxDepth: 3, want: []string{"", "a", "a/a", "a/b", "b", "b/a", "b/b"}},
+		{maxDepth: 3, exclude: "/b/**", want: []string{"", "a", "a/a", "a/b"}},
+		{maxDepth: 3, exclude: "a/**", want: []string{"", "b", "b/b"}},
+	} {
+		t.Run(fmt.Sprintf("depth=%d,exclude=%q", test.maxDepth, test.exclude), func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			ctx, ci := fs.AddConfig(ctx)
+			ci.MaxDepth = test.maxDepth
+			if test.exclude != "" {
+				fi, err := filter.NewFilter(nil)
+				require.NoError(t, err)
+				require.NoError(t, fi.AddRule("- "+test.exclude))
+				ctx = filter.ReplaceConfig(ctx, fi)
+			}
+			fsrc := newDepthFs(t, "src")
+			fdst := newDepthFs(t, "dst")
+
+			mt := &marchTester{
+				ctx:    ctx,
+				cancel: cancel,
+			}
+			m := &March{
+				Ctx:      ctx,
+				Fdst:     fdst,
+				Fsrc:     fsrc,
+				Callback: mt,
+			}
+			mt.processError(m.Run(ctx))
+			mt.cancel()
+			require.NoError(t, mt.currentError())
+
+			// Only the directories within the depth which aren't
+			// excluded are traversed
+			assert.Equal(t, test.want, fsrc.Listed())
+			assert.Equal(t, test.want, fdst.Listed())
+		})
+	}
+}
+
 func TestNewMatchEntries(t *testing.T) {
 	var (
 		a = mockobject.Object("path/a")
@@ -529,3 +680,70 @@ func TestMatchListings(t *testing.T) {
 		})
 	}
 }
+
+func TestResolveCollisions(t *testing.T) {
+	var (
+		upper  = mockobject.Object("dir/File.txt")
+		lower  = mockobject.Object("dir/file.txt")
+		taken  = mockobject.Object("dir/FILE (1).txt")
+		dot    = mockobject.Object("dir/.rc")
+		dotUp  = mockobject.Object("dir/.RC")
+		dirA   = mockdir.New("dir/A")
+		dira   = mockdir.New("dir/a")
+		single = mockobject.Object("dir/other")
+	)
+	srcList := func() fs.DirEntries {
+		return fs.DirEntries{dotUp, dot, dirA, taken, upper, dira, lower, single}
+	}
+	remotes := func(entries fs.DirEntries) (out []string) {
+		for _, entry := range entries {
+			out = append(out, entry.Remote())
+		}
+		return out
+	}
+	for _, test := range []struct {
+		mode    fs.CaseCollisionMode
+		want    []string
+		wantErr bool
+	}{
+		{
+			mode: fs.CaseCollisionSkip,
+			want: []string{"dir/.RC", "dir/A", "dir/FILE (1).txt", "dir/File.txt", "dir/other"},
+		}, {
+			mode:    fs.CaseCollisionError,
+			want:    []string{"dir/.RC", "dir/A", "dir/FILE (1).txt", "dir/File.txt", "dir/other"},
+			wantErr: true,
+		}, {
+			mode:    fs.CaseCollisionRename,
+			want:    []string{"dir/.RC", "dir/.rc (1)", "dir/A", "dir/FILE (1).txt", "dir/File.txt", "dir/file (2).txt", "dir/other"},
+			wantErr: true, // directories can't be renamed
+		},
+	} {
+		t.Run(test.mode.String(), func(t *testing.T) {
+			ctx, ci := fs.AddConfig(context.Background())
+			ci.CaseCollision = test.mode
+			m := &March{Ctx: ctx, transforms: []matchTransformFn{strings.ToLower}}
+			out, err := m.resolveCollisions(srcList())
+			assert.Equal(t, test.want, remotes(out))
+			if test.wantErr {
+				assert.True(t, fserrors.IsNoRetryError(err))
+			} else {
+				assert.NoError(t, err)
+			}
+			// The renamed objects can be unwrapped
+			for _, entry := range out {
+				if o, ok := entry.(*renamedObject); ok {
+					assert.Equal(t, o.Object, fs.UnWrapObject(o))
+				}
+			}
+		})
+	}
+
+	// Nothing is done without the transforms
+	ctx, ci := fs.AddConfig(context.Background())
+	ci.CaseCollision = fs.CaseCollisionError
+	m := &March{Ctx: ctx}
+	out, err := m.resolveCollisions(srcList())
+	require.NoError(t, err)
+	assert.Equal(t, remotes(srcList()), remotes(out))
+}
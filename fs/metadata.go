@@ -4,10 +4,17 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/rclone/rclone/fs/hash"
 )
 
 // Metadata represents Object metadata in a standardised form
@@ -74,6 +81,47 @@ func GetMetadata(ctx context.Context, o DirEntry) (metadata Metadata, err error)
 	return do.Metadata(ctx)
 }
 
+// canWriteMetadata returns true if f can write the system metadata key
+//
+// If the backend doesn't describe its metadata, for example because
+// it wraps another backend, then this assumes it can.
+func canWriteMetadata(f Fs, key string) bool {
+	if !f.Features().WriteMetadata {
+		return false
+	}
+	fsInfo := FindFromFs(f)
+	if fsInfo == nil || fsInfo.MetadataInfo == nil {
+		return true
+	}
+	help, found := fsInfo.MetadataInfo.System[key]
+	return found && !help.ReadOnly
+}
+
+var warnBirthtime sync.Once
+
+// getBirthtime returns metadata with just the btime of o in for
+// --preserve-birthtime
+//
+// It returns nil if dstFs can't set the btime or o doesn't have one.
+func getBirthtime(ctx context.Context, dstFs Fs, o DirEntry) (metadata Metadata, err error) {
+	if !canWriteMetadata(dstFs, "btime") {
+		warnBirthtime.Do(func() {
+			Logf(dstFs, "Can't set the birth (creation) time on this backend so --preserve-birthtime is ignored")
+		})
+		return nil, nil
+	}
+	srcMetadata, err := GetMetadata(ctx, o)
+	if err != nil {
+		return nil, err
+	}
+	btime, found := srcMetadata["btime"]
+	if !found {
+		Debugf(o, "No birth (creation) time to preserve")
+		return nil, nil
+	}
+	return Metadata{"btime": btime}, nil
+}
+
 // mapItem descripts the item to be mapped
 type mapItem struct {
 	SrcFs     string
@@ -145,9 +193,73 @@ func metadataMapper(ctx context.Context, cmdLine SpaceSepList, dstFs Fs, o DirEn
 	return out.Metadata, nil
 }
 
+// metadataTemplateRe matches the substitutions in a
+// --metadata-set-template value
+var metadataTemplateRe = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// metadataTemplateValue returns the value of the substitution name
+// for o in a --metadata-set-template value.
+//
+// Values which aren't known for o, such as the size of an object of
+// unknown size or a hash the source doesn't support, are empty.
+func metadataTemplateValue(ctx context.Context, name string, o DirEntry) (string, error) {
+	switch name {
+	case "path":
+		return o.Remote(), nil
+	case "basename":
+		return path.Base(o.Remote()), nil
+	case "size":
+		if o.Size() < 0 {
+			return "", nil
+		}
+		return strconv.FormatInt(o.Size(), 10), nil
+	}
+	hashName, isHash := strings.CutPrefix(name, "hash")
+	if !isHash || (hashName != "" && !strings.HasPrefix(hashName, ":")) {
+		return "", fmt.Errorf("unknown substitution {%s}", name)
+	}
+	var ht hash.Type
+	if hashName == "" {
+		ht = o.Fs().Hashes().GetOne()
+	} else if err := ht.Set(hashName[1:]); err != nil {
+		return "", fmt.Errorf("substitution {%s}: %w", name, err)
+	}
+	obj, ok := o.(ObjectInfo)
+	if !ok || ht == hash.None {
+		return "", nil
+	}
+	sum, err := obj.Hash(ctx, ht)
+	if errors.Is(err, hash.ErrUnsupported) {
+		return "", nil
+	}
+	return sum, err
+}
+
+// expandMetadataTemplates returns the metadata with the
+// substitutions in templates made for o.
+func expandMetadataTemplates(ctx context.Context, templates Metadata, o DirEntry) (Metadata, error) {
+	metadata := make(Metadata, len(templates))
+	for k, template := range templates {
+		var err error
+		metadata[k] = metadataTemplateRe.ReplaceAllStringFunc(template, func(match string) string {
+			value, valueErr := metadataTemplateValue(ctx, match[1:len(match)-1], o)
+			if valueErr != nil && err == nil {
+				err = valueErr
+			}
+			return value
+		})
+		if err != nil {
+			return nil, fmt.Errorf("metadata set template for %q: %w", k, err)
+		}
+	}
+	return metadata, nil
+}
+
 // GetMetadataOptions from an DirEntry and merge it with any in options
 //
-// If --metadata isn't in use it will return nil.
+// If --metadata isn't in use it will return nil, unless
+// --preserve-birthtime is in use in which case it returns just the
+// btime.
 //
 // If the object has no metadata then metadata will be nil.
 //
@@ -155,6 +267,9 @@ func metadataMapper(ctx context.Context, cmdLine SpaceSepList, dstFs Fs, o DirEn
 func GetMetadataOptions(ctx context.Context, dstFs Fs, o DirEntry, options []OpenOption) (metadata Metadata, err error) {
 	ci := GetConfig(ctx)
 	if !ci.Metadata {
+		if ci.PreserveBirthtime {
+			return getBirthtime(ctx, dstFs, o)
+		}
 		return nil, nil
 	}
 	metadata, err = GetMetadata(ctx, o)
@@ -162,6 +277,13 @@ func GetMetadataOptions(ctx context.Context, dstFs Fs, o DirEntry, options []Ope
 		return nil, err
 	}
 	metadata.MergeOptions(options)
+	if len(ci.MetadataSetTemplate) != 0 {
+		templated, err := expandMetadataTemplates(ctx, ci.MetadataSetTemplate, o)
+		if err != nil {
+			return nil, err
+		}
+		metadata.Merge(templated)
+	}
 	if len(ci.MetadataMapper) != 0 {
 		metadata, err = metadataMapper(ctx, ci.MetadataMapper, dstFs, o, metadata)
 		if err != nil {
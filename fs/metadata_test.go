@@ -1,8 +1,10 @@
 package fs_test
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"testing"
 	"time"
 
@@ -155,3 +157,156 @@ func TestMetadataMapper(t *testing.T) {
 		}, metadata)
 	})
 }
+
+func TestMetadataSetTemplate(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	now := time.Date(2001, 2, 3, 4, 5, 6, 7, time.UTC)
+	f, err := mockfs.NewFs(ctx, "dstFs", "dstFsRoot", nil)
+	require.NoError(t, err)
+	ci.MetadataSetTemplate = fs.Metadata{
+		"source-path": "{path}",
+		"source-name": "{basename} ({size} bytes)",
+		"source-hash": "{hash}",
+		"source-sha1": "{hash:sha1}",
+		"plain":       "no substitutions",
+	}
+
+	// Templates are ignored without --metadata
+	o := object.NewMemoryObject("dir/file.txt", now, []byte("hello"))
+	metadata, err := fs.GetMetadataOptions(ctx, f, o, nil)
+	require.NoError(t, err)
+	assert.Nil(t, metadata)
+	ci.Metadata = true
+
+	// Each object gets its own values
+	for _, test := range []struct {
+		remote  string
+		content string
+		want    fs.Metadata
+	}{{
+		remote:  "dir/file.txt",
+		content: "hello",
+		want: fs.Metadata{
+			"source-path": "dir/file.txt",
+			"source-name": "file.txt (5 bytes)",
+			"source-hash": "5d41402abc4b2a76b9719d911017c592",
+			"source-sha1": "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d",
+			"plain":       "no substitutions",
+		},
+	}, {
+		remote:  "top.bin",
+		content: "",
+		want: fs.Metadata{
+			"source-path": "top.bin",
+			"source-name": "top.bin (0 bytes)",
+			"source-hash": "d41d8cd98f00b204e9800998ecf8427e",
+			"source-sha1": "da39a3ee5e6b4b0d3255bfef95601890afd80709",
+			"plain":       "no substitutions",
+		},
+	}} {
+		o := object.NewMemoryObject(test.remote, now, []byte(test.content))
+		metadata, err := fs.GetMetadataOptions(ctx, f, o, nil)
+		require.NoError(t, err)
+		assert.Equal(t, test.want, metadata, test.remote)
+	}
+
+	// Templates take priority over the source metadata and --metadata-set
+	o = object.NewMemoryObject("file.txt", now, []byte("hello")).WithMetadata(fs.Metadata{
+		"source-path": "old",
+		"key1":        "potato",
+	})
+	metadata, err = fs.GetMetadataOptions(ctx, f, o, []fs.OpenOption{fs.MetadataOption(fs.Metadata{
+		"source-name": "option",
+	})})
+	require.NoError(t, err)
+	assert.Equal(t, "file.txt", metadata["source-path"])
+	assert.Equal(t, "file.txt (5 bytes)", metadata["source-name"])
+	assert.Equal(t, "potato", metadata["key1"])
+
+	// Directories have no hash
+	ci.MetadataSetTemplate = fs.Metadata{"info": "{path}/{basename}:{hash}"}
+	metadata, err = fs.GetMetadataOptions(ctx, f, fs.NewDir("a/b", now), nil)
+	require.NoError(t, err)
+	assert.Equal(t, fs.Metadata{"info": "a/b/b:"}, metadata)
+
+	// Unknown substitutions are an error
+	for _, template := range []string{"{potato}", "{hashish}", "{hash:potato}"} {
+		ci.MetadataSetTemplate = fs.Metadata{"key": template}
+		_, err = fs.GetMetadataOptions(ctx, f, o, nil)
+		assert.ErrorContains(t, err, `metadata set template for "key"`, template)
+	}
+}
+
+// btimeFs is a mock Fs which can write metadata, storing it on the
+// objects which are uploaded.
+type btimeFs struct {
+	fs.Fs
+	features *fs.Features
+}
+
+func newBtimeFs(ctx context.Context, t *testing.T) *btimeFs {
+	f, err := mockfs.NewFs(ctx, "btimeFs", "root", nil)
+	require.NoError(t, err)
+	bf := &btimeFs{Fs: f}
+	bf.features = (&fs.Features{WriteMetadata: true}).Fill(ctx, bf)
+	return bf
+}
+
+func (f *btimeFs) Features() *fs.Features {
+	return f.features
+}
+
+func (f *btimeFs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	metadata, err := fs.GetMetadataOptions(ctx, f, src, options)
+	if err != nil {
+		return nil, err
+	}
+	o := object.NewMemoryObject(src.Remote(), src.ModTime(ctx), nil).WithMetadata(metadata)
+	return o, o.Update(ctx, in, src, options...)
+}
+
+func TestMetadataPreserveBirthtime(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	now := time.Date(2001, 2, 3, 4, 5, 6, 7, time.UTC)
+	const btime = "2000-02-03T04:05:06.123456789Z"
+	src := object.NewMemoryObject("file.txt", now, []byte("hello")).WithMetadata(fs.Metadata{
+		"btime": btime,
+		"mtime": now.Format(time.RFC3339Nano),
+		"mode":  "0100664",
+	})
+	dst := newBtimeFs(ctx, t)
+
+	// Not in use
+	metadata, err := fs.GetMetadataOptions(ctx, dst, src, nil)
+	require.NoError(t, err)
+	assert.Nil(t, metadata)
+
+	// Round trip the btime through the metadata framework
+	ci.PreserveBirthtime = true
+	o, err := dst.Put(ctx, bytes.NewBufferString("hello"), src)
+	require.NoError(t, err)
+	metadata, err = fs.GetMetadata(ctx, o)
+	require.NoError(t, err)
+	assert.Equal(t, fs.Metadata{"btime": btime}, metadata)
+
+	// Source without a btime
+	noBtime := object.NewMemoryObject("file.txt", now, []byte("hello"))
+	metadata, err = fs.GetMetadataOptions(ctx, dst, noBtime, nil)
+	require.NoError(t, err)
+	assert.Nil(t, metadata)
+
+	// Destination which can't write metadata
+	cantWrite, err := mockfs.NewFs(ctx, "cantWrite", "root", nil)
+	require.NoError(t, err)
+	metadata, err = fs.GetMetadataOptions(ctx, cantWrite, src, nil)
+	require.NoError(t, err)
+	assert.Nil(t, metadata)
+
+	// With --metadata everything is copied
+	ci.Metadata = true
+	metadata, err = fs.GetMetadataOptions(ctx, dst, src, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(metadata))
+}
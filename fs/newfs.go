@@ -39,6 +39,13 @@ func NewFs(ctx context.Context, path string) (Fs, error) {
 	if err != nil {
 		return nil, err
 	}
+	if version, found := GetConfig(ctx).HTTPVersionPerRemote[configName]; found {
+		// Use the HTTP version set for this remote in its transport
+		var ci *ConfigInfo
+		ctx, ci = AddConfig(ctx)
+		ci.HTTPVersion = version
+		ci.DisableHTTP2 = false
+	}
 	overridden := fsInfo.Options.Overridden(config)
 	if len(overridden) > 0 {
 		extraConfig := overridden.String()
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
 	"github.com/rclone/rclone/fstest/mockfs"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -43,3 +44,36 @@ func TestNewFs(t *testing.T) {
 	assert.Equal(t, ":mockfs{S_NHG}:/tmp", fs.ConfigString(f3))
 	assert.Equal(t, ":mockfs,potato='true':/tmp", fs.ConfigStringFull(f3))
 }
+
+func TestNewFsHTTPVersionPerRemote(t *testing.T) {
+	ctx, ci := fs.AddConfig(context.Background())
+	ci.HTTPVersion = "2"
+	ci.HTTPVersionPerRemote = map[string]string{":httpversion": "1.1"}
+
+	// Register a backend which records the HTTP version it is made with
+	oldRegistry := fs.Registry
+	defer func() {
+		fs.Registry = oldRegistry
+	}()
+	var version string
+	for _, name := range []string{"httpversion", "httpversion2"} {
+		fs.Register(&fs.RegInfo{
+			Name: name,
+			NewFs: func(ctx context.Context, name string, root string, config configmap.Mapper) (fs.Fs, error) {
+				version = fs.GetConfig(ctx).HTTPVersion
+				return mockfs.NewFs(ctx, name, root, config)
+			},
+		})
+	}
+
+	_, err := fs.NewFs(ctx, ":httpversion:")
+	require.NoError(t, err)
+	assert.Equal(t, "1.1", version)
+
+	_, err = fs.NewFs(ctx, ":httpversion2:")
+	require.NoError(t, err)
+	assert.Equal(t, "2", version)
+
+	// The version of the caller is unchanged
+	assert.Equal(t, "2", ci.HTTPVersion)
+}
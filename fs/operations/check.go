@@ -214,7 +214,7 @@ func CheckFn(ctx context.Context, opt *CheckOpt) error {
 		return errors.New("internal error: nil check function")
 	}
 	c := &checkMarch{
-		tokens: make(chan struct{}, ci.Checkers),
+		tokens: make(chan struct{}, ci.CheckersFor(opt.Fsrc, opt.Fdst)),
 		opt:    *opt,
 	}
 
@@ -430,7 +430,7 @@ func CheckSum(ctx context.Context, fsrc, fsum fs.Fs, sumFile string, hashType ha
 
 	ci := fs.GetConfig(ctx)
 	c := &checkMarch{
-		tokens: make(chan struct{}, ci.Checkers),
+		tokens: make(chan struct{}, ci.CheckersFor(opt.Fdst)),
 		opt:    *opt,
 	}
 	lastErr := ListFn(ctx, opt.Fdst, func(obj fs.Object) {
@@ -0,0 +1,65 @@
+// This file implements --check-names
+
+package operations
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/lib/encoder"
+)
+
+// nameEncoders caches the encoder used by each destination
+var nameEncoders sync.Map // fs.Fs => *encoder.MultiEncoder or nil
+
+// nameEncoder returns the encoder f uses for the names it stores or
+// nil if it doesn't have one.
+func nameEncoder(f fs.Fs) *encoder.MultiEncoder {
+	if enc, ok := nameEncoders.Load(f); ok {
+		return enc.(*encoder.MultiEncoder)
+	}
+	var enc *encoder.MultiEncoder
+	fsInfo, configName, _, connectionStringConfig, err := fs.ParseRemote(fs.ConfigStringFull(f))
+	if err != nil {
+		fs.Debugf(f, "Can't check names as failed to read config: %v", err)
+	} else if value, ok := fs.ConfigMap(fsInfo, configName, connectionStringConfig).Get(config.ConfigEncoding); ok {
+		enc = new(encoder.MultiEncoder)
+		if err := enc.Set(value); err != nil {
+			fs.Debugf(f, "Can't check names as failed to parse encoding %q: %v", value, err)
+			enc = nil
+		}
+	}
+	nameEncoders.Store(f, enc)
+	return enc
+}
+
+// checkName checks that f can store remote without changing its name
+// if --check-names is set.
+//
+// With --check-names REPORT it logs the name the destination will use
+// instead and with --check-names ERROR it returns an error.
+func checkName(ctx context.Context, f fs.Fs, src fs.ObjectInfo, remote string) error {
+	ci := fs.GetConfig(ctx)
+	if ci.CheckNames == fs.CheckNamesOff {
+		return nil
+	}
+	enc := nameEncoder(f)
+	if enc == nil {
+		return nil
+	}
+	encoded := enc.FromStandardPath(remote)
+	if encoded == remote {
+		return nil
+	}
+	if ci.CheckNames == fs.CheckNamesError {
+		err := fmt.Errorf("can't store name on %v without changing it to %q", f, encoded)
+		fs.Errorf(src, "%v", err)
+		return fs.CountError(fserrors.NoRetryError(err))
+	}
+	fs.Logf(src, "Name will be stored on %v as %q", f, encoded)
+	return nil
+}
@@ -0,0 +1,57 @@
+package operations_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckNames(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+
+	// A destination which can't store : or ? in names
+	dir := t.TempDir()
+	fdst, err := fs.NewFs(ctx, `:local,encoding="Slash,Dot,Colon,Question":`+dir)
+	require.NoError(t, err)
+
+	for _, test := range []struct {
+		name    string
+		mode    fs.CheckNamesMode
+		remote  string
+		stored  string
+		wantErr bool
+	}{
+		{name: "off", mode: fs.CheckNamesOff, remote: "off:1", stored: "off：1"},
+		{name: "report", mode: fs.CheckNamesReport, remote: "report?2", stored: "report？2"},
+		{name: "error", mode: fs.CheckNamesError, remote: "error:3", wantErr: true},
+		{name: "error-ok", mode: fs.CheckNamesError, remote: "error-ok", stored: "error-ok"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ci.CheckNames = test.mode
+			file := r.WriteFile(test.remote, "contents", t1)
+			src, err := r.Flocal.NewObject(ctx, file.Path)
+			require.NoError(t, err)
+
+			_, err = operations.Copy(ctx, fdst, nil, test.remote, src)
+			if test.wantErr {
+				assert.ErrorContains(t, err, "without changing it to")
+				_, err = operations.Move(ctx, fdst, nil, test.remote, src)
+				assert.ErrorContains(t, err, "without changing it to")
+				_, err = os.Stat(dir + "/" + test.remote)
+				assert.True(t, os.IsNotExist(err))
+				return
+			}
+			require.NoError(t, err)
+			_, err = os.Stat(dir + "/" + test.stored)
+			assert.NoError(t, err, "name stored as %q", test.stored)
+		})
+	}
+}
@@ -5,12 +5,15 @@
 package operations
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"path"
 	"strings"
+	"sync"
 	"time"
 	"unicode/utf8"
 
@@ -38,6 +41,7 @@ type copy struct {
 	tr            *accounting.Transfer // accounting for the transfer
 	inplace       bool                 // set if we are updating inplace and not using a partial name
 	remoteForCopy string               // the name used for the transfer, either remote or remote+".partial"
+	mimeType      string               // mime type detected from the contents if set
 }
 
 // Used to remove a failed copy
@@ -127,6 +131,85 @@ func (c *copy) checkLimits(ctx context.Context) (err error) {
 	return nil
 }
 
+// ErrorMinFreeSpace is returned from Copy, wrapped in a fatal error,
+// when the destination would have less free space than --min-free-space.
+var ErrorMinFreeSpace = errors.New("not enough free space on destination as set by --min-free-space")
+
+// freeSpaceCacheTime is how long the free space read from a
+// destination is used for before reading it again
+const freeSpaceCacheTime = 10 * time.Second
+
+// freeSpace is the free space last read from a destination
+type freeSpace struct {
+	mu      sync.Mutex
+	stats   *accounting.StatsInfo // stats the bytes were read from
+	when    time.Time             // when the free space was read
+	free    *int64                // free space when read or nil if unknown
+	bytes   int64                 // bytes transferred when read
+	noticed bool                  // set if we've logged that --min-free-space can't be enforced
+}
+
+// freeSpaces holds the *freeSpace of each destination keyed by its
+// config string
+var freeSpaces sync.Map
+
+// read the free space of f with about, logging once if it can't be
+// read
+func (space *freeSpace) read(ctx context.Context, f fs.Fs, about func(context.Context) (*fs.Usage, error), stats *accounting.StatsInfo) {
+	space.stats = stats
+	space.when = time.Now()
+	space.bytes = stats.GetBytes()
+	space.free = nil
+	reason := "the destination doesn't report its free space"
+	if about != nil {
+		usage, err := about(ctx)
+		if err != nil {
+			reason = fmt.Sprintf("failed to read the free space: %v", err)
+		} else if usage.Free != nil {
+			space.free = usage.Free
+			return
+		}
+	}
+	if space.noticed {
+		fs.Debugf(f, "Can't enforce --min-free-space as %s", reason)
+		return
+	}
+	fs.Logf(f, "Can't enforce --min-free-space as %s", reason)
+	space.noticed = true
+}
+
+// Check to see if the destination has enough free space left to
+// copy c.src to it
+//
+// The free space is read at most every freeSpaceCacheTime, and the
+// bytes written since it was read and still to be written by the
+// transfers in progress are counted as used.
+func (c *copy) checkFreeSpace(ctx context.Context) (err error) {
+	if c.ci.MinFreeSpace < 0 {
+		return nil
+	}
+	value, _ := freeSpaces.LoadOrStore(fs.ConfigString(c.f), new(freeSpace))
+	space := value.(*freeSpace)
+	stats := accounting.Stats(ctx)
+	space.mu.Lock()
+	defer space.mu.Unlock()
+	if space.stats != stats || time.Since(space.when) > freeSpaceCacheTime {
+		space.read(ctx, c.f, c.dstFeatures.About, stats)
+	}
+	if space.free == nil {
+		return nil
+	}
+	free := *space.free - (stats.GetBytesWithPending() - space.bytes)
+	var needed int64
+	if size := c.src.Size(); size > 0 {
+		needed = size
+	}
+	if free-needed < int64(c.ci.MinFreeSpace) {
+		return fserrors.FatalError(fmt.Errorf("%w: %v has %v free after the transfers in progress and %v is needed", ErrorMinFreeSpace, c.f, fs.SizeSuffix(free), fs.SizeSuffix(needed)))
+	}
+	return nil
+}
+
 // Server side copy c.src to (c.f, c.remoteForCopy) if possible or return fs.ErrorCantCopy if not
 func (c *copy) serverSideCopy(ctx context.Context) (actionTaken string, newDst fs.Object, err error) {
 	doCopy := c.dstFeatures.Copy
@@ -146,6 +229,7 @@ func (c *copy) serverSideCopy(ctx context.Context) (actionTaken string, newDst f
 	newDst, err = doCopy(ctx, c.src, c.remoteForCopy)
 	if err == nil {
 		in.ServerSideCopyEnd(newDst.Size()) // account the bytes for the server-side transfer
+		err = c.setModTime(ctx, newDst)
 	}
 	_ = in.Close()
 	if errors.Is(err, fs.ErrorCantCopy) {
@@ -155,6 +239,58 @@ func (c *copy) serverSideCopy(ctx context.Context) (actionTaken string, newDst f
 	return actionTaken, newDst, err
 }
 
+// relayLinkExpiry is how long the link to the source made for
+// relayCopy is valid for
+const relayLinkExpiry = fs.Duration(time.Hour)
+
+// setModTime sets the modification time of newDst to --set-modtime
+// if in use as a server-side copy keeps the time of the source
+func (c *copy) setModTime(ctx context.Context, newDst fs.Object) error {
+	if !c.ci.SetModTime.IsSet() {
+		return nil
+	}
+	err := newDst.SetModTime(ctx, time.Time(c.ci.SetModTime))
+	if errors.Is(err, fs.ErrorCantSetModTime) || errors.Is(err, fs.ErrorCantSetModTimeWithoutDelete) {
+		fs.Debugf(newDst, "Can't set modification time after server-side copy: %v", err)
+		return nil
+	}
+	return err
+}
+
+// Copy c.src to (c.f, c.remoteForCopy) by making a link to c.src and
+// having the destination upload from it if possible or return
+// fs.ErrorCantCopy if not
+//
+// This is only done if the source makes presigned links which expire
+// as other remotes make links which give anyone access to the file
+// until they are removed.
+func (c *copy) relayCopy(ctx context.Context) (actionTaken string, newDst fs.Object, err error) {
+	doPutURL := c.dstFeatures.PutURL
+	srcFeatures := c.src.Fs().Features()
+	doPublicLink := srcFeatures.PublicLink
+	if !c.ci.ServerSideRelay || doPutURL == nil || doPublicLink == nil || !srcFeatures.PresignedLinks || c.src.Size() < 0 {
+		return actionTaken, nil, fs.ErrorCantCopy
+	}
+	link, err := doPublicLink(ctx, c.src.Remote(), relayLinkExpiry, false)
+	if err != nil {
+		fs.Debugf(c.src, "Can't relay copy as failed to make link: %v", err)
+		return actionTaken, nil, fs.ErrorCantCopy
+	}
+	in := c.tr.Account(ctx, nil) // account the transfer
+	in.ServerSideTransferStart()
+	newDst, err = doPutURL(ctx, link, fs.NewOverrideRemote(overrideModTime(ctx, c.src), c.remoteForCopy), c.hashOption)
+	if err == nil {
+		in.ServerSideCopyEnd(newDst.Size()) // account the bytes for the server-side transfer
+	}
+	_ = in.Close()
+	if errors.Is(err, fs.ErrorCantCopy) {
+		fs.Debugf(c.src, "Can't relay copy - copying through rclone: %v", err)
+		c.tr.Reset(ctx) // skip incomplete accounting - will be overwritten by the manual copy
+	}
+	actionTaken = "Copied (server-side relay)"
+	return actionTaken, newDst, err
+}
+
 // Copy c.src to (c.f, c.remoteForCopy) using multiThreadCopy
 func (c *copy) multiThreadCopy(ctx context.Context, uploadOptions []fs.OpenOption) (actionTaken string, newDst fs.Object, err error) {
 	newDst, err = multiThreadCopy(ctx, c.f, c.remoteForCopy, c.src, c.ci.MultiThreadStreams, c.tr, uploadOptions...)
@@ -173,14 +309,14 @@ func (c *copy) rcat(ctx context.Context, in io.ReadCloser) (actionTaken string,
 	// Make any metadata to pass to rcat
 	var meta fs.Metadata
 	if c.ci.Metadata {
-		meta, err = fs.GetMetadata(ctx, c.src)
+		meta, err = fs.GetMetadata(ctx, overrideModTime(ctx, c.src))
 		if err != nil {
 			fs.Errorf(c.src, "Failed to read metadata: %v", err)
 		}
 	}
 
 	// NB Rcat closes in0
-	newDst, err = Rcat(ctx, c.f, c.remoteForCopy, in, c.src.ModTime(ctx), meta)
+	newDst, err = Rcat(ctx, c.f, c.remoteForCopy, in, srcModTime(ctx, c.src), meta)
 	if c.doUpdate {
 		actionTaken = "Copied (Rcat, replaced existing)"
 	} else {
@@ -199,6 +335,10 @@ func (c *copy) updateOrPut(ctx context.Context, in io.ReadCloser, uploadOptions
 	if c.src.Remote() != c.remoteForCopy {
 		wrappedSrc = fs.NewOverrideRemote(c.src, c.remoteForCopy)
 	}
+	if c.mimeType != "" {
+		wrappedSrc = fs.NewOverrideMimeType(wrappedSrc, c.mimeType)
+	}
+	wrappedSrc = overrideModTime(ctx, wrappedSrc)
 	if c.doUpdate && c.inplace {
 		err = c.dst.Update(ctx, inAcc, wrappedSrc, uploadOptions...)
 		// Make sure newDst is c.dst since we updated it
@@ -259,51 +399,146 @@ func (c *copy) manualCopy(ctx context.Context) (actionTaken string, newDst fs.Ob
 	if c.src.Size() == -1 {
 		return c.rcat(ctx, in)
 	}
+	if c.ci.SniffMimeType {
+		in, err = c.sniffMimeType(ctx, in)
+		if err != nil {
+			return actionTaken, nil, err
+		}
+	}
 	return c.updateOrPut(ctx, in, uploadOptions)
 }
 
+// sniffReadCloser reads the sniffed bytes then the rest of the source
+type sniffReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// sniffMimeType detects the mime type of the source from the start of
+// in if neither the source nor the destination name gives one.
+//
+// It returns a reader which reads all of in again and closes in on
+// error.
+func (c *copy) sniffMimeType(ctx context.Context, in io.ReadCloser) (io.ReadCloser, error) {
+	c.mimeType = ""
+	if fs.MimeType(ctx, fs.NewOverrideRemote(c.src, c.remote)) != "application/octet-stream" {
+		return in, nil
+	}
+	buf := make([]byte, 512) // http.DetectContentType only looks at this much
+	n, err := io.ReadFull(in, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		_ = in.Close()
+		return nil, fmt.Errorf("failed to read source to detect mime type: %w", err)
+	}
+	buf = buf[:n]
+	if n > 0 {
+		c.mimeType = http.DetectContentType(buf)
+		fs.Debugf(c.src, "Detected mime type %q from contents", c.mimeType)
+	}
+	return sniffReadCloser{
+		Reader: io.MultiReader(bytes.NewReader(buf), in),
+		Closer: in,
+	}, nil
+}
+
+// errHashesDiffer is wrapped in the error returned by verify if the
+// hashes differ
+var errHashesDiffer = errors.New("hashes differ")
+
 // Verify the copy
 func (c *copy) verify(ctx context.Context, newDst fs.Object) (err error) {
 	// Verify sizes are the same after transfer
 	if sizeDiffers(ctx, c.src, newDst) {
-		return fmt.Errorf("corrupted on transfer: sizes differ src(%s) %d vs dst(%s) %d", c.src.Fs(), c.src.Size(), c.dst.Fs(), c.dst.Size())
+		return fmt.Errorf("corrupted on transfer: sizes differ src(%s) %d vs dst(%s) %d", c.src.Fs(), c.src.Size(), newDst.Fs(), newDst.Size())
 	}
 	// Verify hashes are the same after transfer - ignoring blank hashes
 	if c.hashType != hash.None {
 		// checkHashes has logs and counts errors
 		equal, _, srcSum, dstSum, _ := checkHashes(ctx, c.src, newDst, c.hashType)
 		if !equal {
-			return fmt.Errorf("corrupted on transfer: %v hashes differ src(%s) %q vs dst(%s) %q", c.hashType, c.src.Fs(), srcSum, c.dst.Fs(), dstSum)
+			return fmt.Errorf("corrupted on transfer: %v %w src(%s) %q vs dst(%s) %q", c.hashType, errHashesDiffer, c.src.Fs(), srcSum, newDst.Fs(), dstSum)
 		}
+		c.tr.SetHash(c.hashType, srcSum)
 	}
 	return nil
 }
 
-// copy src object to dst or f if nil.  If dst is nil then it uses
-// remote as the name of the new object.
+// sourceState is the state of the source recorded before the
+// transfer for --check-source-stability
+type sourceState struct {
+	size    int64
+	modTime time.Time
+	hash    string
+}
+
+// readSourceState reads the state of src
+func (c *copy) readSourceState(ctx context.Context, src fs.ObjectInfo) (s sourceState) {
+	s.size = src.Size()
+	s.modTime = src.ModTime(ctx)
+	if c.hashType != hash.None {
+		// A blank hash is ignored when comparing
+		s.hash, _ = src.Hash(ctx, c.hashType)
+	}
+	return s
+}
+
+// checkSourceStable reads the source again and checks it hasn't
+// changed from before
+func (c *copy) checkSourceStable(ctx context.Context, before sourceState) error {
+	srcFs, ok := c.src.Fs().(fs.Fs)
+	if !ok {
+		fs.Debugf(c.src, "Can't check source stability as source Fs is unknown")
+		return nil
+	}
+	src, err := srcFs.NewObject(ctx, c.src.Remote())
+	if err != nil {
+		return fserrors.RetryErrorf("source file changed during transfer: failed to read source again: %v", err)
+	}
+	after := c.readSourceState(ctx, src)
+	switch {
+	case before.size != after.size:
+		return fserrors.RetryErrorf("source file changed during transfer: size changed from %d to %d", before.size, after.size)
+	case !before.modTime.Equal(after.modTime):
+		return fserrors.RetryErrorf("source file changed during transfer: modification time changed from %v to %v", before.modTime, after.modTime)
+	case before.hash != "" && after.hash != "" && before.hash != after.hash:
+		return fserrors.RetryErrorf("source file changed during transfer: %v hash changed from %q to %q", c.hashType, before.hash, after.hash)
+	}
+	return nil
+}
+
+// copyWithRetries does the transfer, retrying it up to c.maxTries
+// times if it fails with a retriable error.
 //
-// It returns the destination object if possible.  Note that this may
-// be nil.
-func (c *copy) copy(ctx context.Context) (newDst fs.Object, err error) {
-	var actionTaken string
+// On error it removes any partial copy and counts the error.
+func (c *copy) copyWithRetries(ctx context.Context) (actionTaken string, newDst fs.Object, err error) {
 	retry := true
 	for tries := 0; retry && tries < c.maxTries; tries++ {
 		// Check we haven't hit any accounting limits
 		err = c.checkLimits(ctx)
 		if err != nil {
-			return nil, err
+			return actionTaken, nil, err
+		}
+		err = c.checkFreeSpace(ctx)
+		if err != nil {
+			return actionTaken, nil, err
 		}
 
 		// Try server side copy
 		actionTaken, newDst, err = c.serverSideCopy(ctx)
 
-		// If can't server-side copy, do it manually
+		// If can't server-side copy, try relaying it between the remotes
+		if errors.Is(err, fs.ErrorCantCopy) {
+			actionTaken, newDst, err = c.relayCopy(ctx)
+		}
+
+		// If can't relay the copy either, do it manually
 		if errors.Is(err, fs.ErrorCantCopy) {
 			actionTaken, newDst, err = c.manualCopy(ctx)
 		}
 
 		// End if ctx is in error
 		if fserrors.ContextError(ctx, &err) {
+			err = c.tr.CancelledError(err)
 			break
 		}
 
@@ -328,15 +563,52 @@ func (c *copy) copy(ctx context.Context) (newDst fs.Object, err error) {
 		if !c.inplace {
 			c.removeFailedPartialCopy(ctx, c.f, c.remoteForCopy)
 		}
-		return newDst, err
+		return actionTaken, newDst, err
 	}
+	return actionTaken, newDst, nil
+}
 
-	// Verify the copy
-	err = c.verify(ctx, newDst)
-	if err != nil {
+// copy src object to dst or f if nil.  If dst is nil then it uses
+// remote as the name of the new object.
+//
+// It returns the destination object if possible.  Note that this may
+// be nil.
+func (c *copy) copy(ctx context.Context) (newDst fs.Object, err error) {
+	var before sourceState
+	if c.ci.CheckSourceStability {
+		before = c.readSourceState(ctx, c.src)
+	}
+	var actionTaken string
+	for hashTries := 0; ; hashTries++ {
+		actionTaken, newDst, err = c.copyWithRetries(ctx)
+		if err != nil {
+			return newDst, err
+		}
+
+		// Check the source didn't change while it was being copied
+		if c.ci.CheckSourceStability {
+			err = c.checkSourceStable(ctx, before)
+			if err != nil {
+				fs.Errorf(c.src, "%v", err)
+				err = fs.CountError(err)
+				c.removeFailedCopy(ctx, newDst)
+				return nil, err
+			}
+		}
+
+		// Verify the copy
+		err = c.verify(ctx, newDst)
+		if err == nil {
+			break
+		}
 		fs.Errorf(newDst, "%v", err)
-		err = fs.CountError(err)
 		c.removeFailedCopy(ctx, newDst)
+		if errors.Is(err, errHashesDiffer) && hashTries < c.ci.RetryOnHashMismatch {
+			fs.Logf(c.src, "Retrying transfer after hash mismatch %d/%d", hashTries+1, c.ci.RetryOnHashMismatch)
+			c.tr.Reset(ctx) // skip incomplete accounting - will be overwritten by retry
+			continue
+		}
+		err = fs.CountError(err)
 		return nil, err
 	}
 
@@ -358,6 +630,7 @@ func (c *copy) copy(ctx context.Context) (newDst fs.Object, err error) {
 		actionTaken = fmt.Sprintf("%s to: %s", actionTaken, newDst.String())
 	}
 	fs.Infof(c.src, "%s%s", actionTaken, fs.LogValueHide("size", fs.SizeSuffix(c.src.Size())))
+	logVerified(ctx, "copy", c.src, newDst, c.hashType)
 
 	return newDst, nil
 }
@@ -369,15 +642,37 @@ func (c *copy) copy(ctx context.Context) (newDst fs.Object, err error) {
 // be nil.
 func Copy(ctx context.Context, f fs.Fs, dst fs.Object, remote string, src fs.Object) (newDst fs.Object, err error) {
 	ci := fs.GetConfig(ctx)
+	if err = accounting.WaitIfPaused(ctx); err != nil {
+		return nil, err
+	}
+	adaptiveDone, err := accounting.WaitAdaptive(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer adaptiveDone()
+	if dst == nil {
+		if err = checkName(ctx, f, src, remote); err != nil {
+			return nil, err
+		}
+	}
 	tr := accounting.Stats(ctx).NewTransfer(src, f)
 	defer func() {
 		tr.Done(ctx, err)
 	}()
+	if ci.Queue != "" {
+		in := tr.Account(ctx, nil)
+		in.DryRun(src.Size())
+		if dst != nil {
+			remote = dst.Remote()
+		}
+		return newDst, queueOperation(ctx, QueueCopy, src, f, remote)
+	}
 	if SkipDestructive(ctx, src, "copy") {
 		in := tr.Account(ctx, nil)
 		in.DryRun(src.Size())
 		return newDst, nil
 	}
+	ctx = tr.Context(ctx) // so the transfer can be cancelled on its own
 	c := &copy{
 		f:           f,
 		dstFeatures: f.Features(),
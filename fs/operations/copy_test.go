@@ -1,20 +1,30 @@
 package operations_test
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/rc"
 	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+	"github.com/rclone/rclone/fstest/mockfs"
+	"github.com/rclone/rclone/fstest/mockobject"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -496,3 +506,528 @@ func TestCopyFileMaxTransfer(t *testing.T) {
 	r.CheckLocalItems(t, file1, file2, file3, file4)
 	r.CheckRemoteItems(t, file1, file4)
 }
+
+// unstableObject is a source object which can change while it is
+// being copied
+type unstableObject struct {
+	mockobject.Object
+	f       fs.Fs
+	mu      sync.Mutex
+	content []byte
+	modTime time.Time
+	change  func(o *unstableObject) // called with the lock held when the object is opened
+}
+
+func (o *unstableObject) Fs() fs.Info   { return o.f }
+func (o *unstableObject) SetFs(f fs.Fs) { o.f = f }
+func (o *unstableObject) Hash(ctx context.Context, t hash.Type) (string, error) {
+	return "", hash.ErrUnsupported
+}
+
+func (o *unstableObject) Size() int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return int64(len(o.content))
+}
+
+func (o *unstableObject) ModTime(ctx context.Context) time.Time {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.modTime
+}
+
+func (o *unstableObject) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	in := io.NopCloser(bytes.NewReader(append([]byte(nil), o.content...)))
+	if o.change != nil {
+		o.change(o)
+	}
+	return in, nil
+}
+
+func TestCopyCheckSourceStability(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	ci.CheckSourceStability = true
+
+	for _, test := range []struct {
+		name    string
+		change  func(o *unstableObject)
+		wantErr string
+	}{
+		{
+			name: "stable",
+		}, {
+			name: "size",
+			change: func(o *unstableObject) {
+				o.content = append(o.content, " more"...)
+			},
+			wantErr: "size changed from 14 to 19",
+		}, {
+			name: "modtime",
+			change: func(o *unstableObject) {
+				o.modTime = o.modTime.Add(time.Minute)
+			},
+			wantErr: "modification time changed",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			srcFs, err := mockfs.NewFs(ctx, "unstable", "", nil)
+			require.NoError(t, err)
+			src := &unstableObject{
+				Object:  mockobject.New(test.name),
+				content: []byte("file1 contents"),
+				modTime: t1,
+				change:  test.change,
+			}
+			srcFs.(*mockfs.Fs).AddObject(src)
+
+			accounting.GlobalStats().ResetCounters()
+			_, err = operations.Copy(ctx, r.Fremote, nil, test.name, src)
+			if test.wantErr == "" {
+				require.NoError(t, err)
+				r.CheckRemoteItems(t, fstest.NewItem(test.name, "file1 contents", t1))
+				operations.Purge(ctx, r.Fremote, "") //nolint:errcheck
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "source file changed during transfer")
+			assert.Contains(t, err.Error(), test.wantErr)
+			assert.True(t, fserrors.IsRetryError(err))
+			r.CheckRemoteItems(t)
+		})
+	}
+	accounting.GlobalStats().ResetCounters()
+}
+
+// corruptingObject is a source object which returns corrupted data
+// the first few times it is opened
+type corruptingObject struct {
+	mockobject.Object
+	f           fs.Fs
+	content     []byte
+	corruptions int // number of times left to return corrupted data
+}
+
+func (o *corruptingObject) Fs() fs.Info   { return o.f }
+func (o *corruptingObject) SetFs(f fs.Fs) { o.f = f }
+func (o *corruptingObject) Size() int64   { return int64(len(o.content)) }
+func (o *corruptingObject) ModTime(ctx context.Context) time.Time {
+	return t1
+}
+
+func (o *corruptingObject) Hash(ctx context.Context, t hash.Type) (string, error) {
+	sums, err := hash.StreamTypes(bytes.NewReader(o.content), hash.NewHashSet(t))
+	if err != nil {
+		return "", err
+	}
+	return sums[t], nil
+}
+
+func (o *corruptingObject) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	content := append([]byte(nil), o.content...)
+	if o.corruptions > 0 {
+		o.corruptions--
+		content[0] ^= 0xFF
+	}
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+func TestCopyRetryOnHashMismatch(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	if !r.Fremote.Hashes().Contains(hash.MD5) {
+		t.Skip("remote doesn't support MD5")
+	}
+
+	for _, test := range []struct {
+		name        string
+		retries     int
+		corruptions int
+		wantErr     bool
+	}{
+		{name: "no-retries", retries: 0, corruptions: 1, wantErr: true},
+		{name: "retry-succeeds", retries: 2, corruptions: 2, wantErr: false},
+		{name: "retries-exhausted", retries: 1, corruptions: 2, wantErr: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ci.RetryOnHashMismatch = test.retries
+			srcFs, err := mockfs.NewFs(ctx, "corrupting", "", nil)
+			require.NoError(t, err)
+			srcFs.(*mockfs.Fs).SetHashes(hash.NewHashSet(hash.MD5))
+			src := &corruptingObject{
+				Object:      mockobject.New(test.name),
+				content:     []byte("file1 contents"),
+				corruptions: test.corruptions,
+			}
+			srcFs.(*mockfs.Fs).AddObject(src)
+
+			accounting.GlobalStats().ResetCounters()
+			_, err = operations.Copy(ctx, r.Fremote, nil, test.name, src)
+			if test.wantErr {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "hashes differ")
+				r.CheckRemoteItems(t)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, 0, src.corruptions)
+			r.CheckRemoteItems(t, fstest.NewItem(test.name, "file1 contents", t1))
+			operations.Purge(ctx, r.Fremote, "") //nolint:errcheck
+		})
+	}
+	accounting.GlobalStats().ResetCounters()
+}
+
+// slowObject is a source object which is read a byte at a time
+// slowly, closing started when the first byte is read. Like a network
+// stream reading it stops when the context it was opened with is
+// cancelled.
+type slowObject struct {
+	mockobject.Object
+	f       fs.Fs
+	size    int
+	started chan struct{}
+}
+
+func (o *slowObject) Fs() fs.Info   { return o.f }
+func (o *slowObject) SetFs(f fs.Fs) { o.f = f }
+func (o *slowObject) Size() int64   { return int64(o.size) }
+func (o *slowObject) ModTime(ctx context.Context) time.Time {
+	return t1
+}
+
+func (o *slowObject) Hash(ctx context.Context, t hash.Type) (string, error) {
+	return "", hash.ErrUnsupported
+}
+
+func (o *slowObject) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	return io.NopCloser(&slowReader{ctx: ctx, o: o, left: o.size}), nil
+}
+
+// slowReader reads a slowObject
+type slowReader struct {
+	ctx  context.Context
+	o    *slowObject
+	left int
+}
+
+func (r *slowReader) Read(p []byte) (n int, err error) {
+	if r.left == 0 {
+		return 0, io.EOF
+	}
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if r.left == r.o.size {
+		close(r.o.started)
+	}
+	time.Sleep(time.Millisecond)
+	r.left--
+	p[0] = 'A'
+	return 1, nil
+}
+
+func TestCopyTransferCancel(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	srcFs, err := mockfs.NewFs(ctx, "slow", "", nil)
+	require.NoError(t, err)
+	src := &slowObject{
+		Object:  mockobject.New("slow"),
+		size:    100000,
+		started: make(chan struct{}),
+	}
+	srcFs.(*mockfs.Fs).AddObject(src)
+	accounting.GlobalStats().ResetCounters()
+
+	// Start copying the slow file
+	errs := make(chan error, 1)
+	go func() {
+		_, err := operations.Copy(ctx, r.Fremote, nil, "slow", src)
+		errs <- err
+	}()
+	<-src.started
+
+	// Find it in the running transfers
+	out, err := rc.Calls.Get("core/transfers-list").Fn(ctx, nil)
+	require.NoError(t, err)
+	var id int64 = -1
+	for _, transfer := range out["transfers"].([]rc.Params) {
+		if transfer["name"] == "slow" {
+			id = transfer["id"].(int64)
+		}
+	}
+	require.NotEqual(t, int64(-1), id, "slow transfer not listed")
+
+	// Other transfers carry on while it is running
+	file1 := r.WriteFile("file1", "file1 contents", t1)
+	require.NoError(t, operations.CopyFile(ctx, r.Fremote, r.Flocal, file1.Path, file1.Path))
+
+	// Cancelling it stops it with an error which isn't retried
+	_, err = rc.Calls.Get("core/transfer-cancel").Fn(ctx, rc.Params{"id": id})
+	require.NoError(t, err)
+	select {
+	case err = <-errs:
+	case <-time.After(10 * time.Second):
+		t.Fatal("transfer didn't stop when cancelled")
+	}
+	assert.ErrorIs(t, err, accounting.ErrorTransferCancelled)
+	assert.True(t, fserrors.IsNoRetryError(err))
+	assert.Equal(t, int64(1), accounting.GlobalStats().GetErrors())
+	assert.False(t, accounting.GlobalStats().HadRetryError())
+	r.CheckRemoteItems(t, file1)
+	accounting.GlobalStats().ResetCounters()
+}
+
+func TestCopySniffMimeType(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	fdst, err := fs.NewFs(ctx, ":memory:sniff")
+	require.NoError(t, err)
+	defer func() {
+		_ = operations.Purge(ctx, fdst, "")
+	}()
+
+	png := "\x89PNG\x0D\x0A\x1A\x0Arest of the image"
+	for _, test := range []struct {
+		name     string
+		contents string
+		sniff    bool
+		want     string
+	}{
+		{name: "image", contents: png, sniff: true, want: "image/png"},
+		{name: "page", contents: "<!DOCTYPE html><html></html>", sniff: true, want: "text/html; charset=utf-8"},
+		{name: "pdf", contents: "%PDF-1.4 document", sniff: true, want: "application/pdf"},
+		{name: "binary", contents: "\x00\x01\x02\x03", sniff: true, want: "application/octet-stream"},
+		{name: "image.txt", contents: png, sniff: true, want: "text/plain; charset=utf-8"},
+		{name: "unsniffed", contents: png, sniff: false, want: "application/octet-stream"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ci.SniffMimeType = test.sniff
+			src := r.WriteFile(test.name, test.contents, t1)
+			srcObj, err := r.Flocal.NewObject(ctx, src.Path)
+			require.NoError(t, err)
+			dst, err := operations.Copy(ctx, fdst, nil, test.name, srcObj)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, fs.MimeType(ctx, dst))
+			assert.Equal(t, test.contents, fstests.ReadObject(ctx, t, dst, -1), "contents must not be changed by sniffing")
+		})
+	}
+}
+
+// putURLFs wraps an Fs adding a PutURL feature which reads the data
+// from the links in links
+type putURLFs struct {
+	fs.Fs
+	features *fs.Features
+	links    map[string]string // link to contents
+	urls     []string          // links passed to PutURL
+	cantCopy bool              // set to return fs.ErrorCantCopy
+}
+
+func newPutURLFs(f fs.Fs) *putURLFs {
+	p := &putURLFs{Fs: f, links: map[string]string{}}
+	features := *f.Features()
+	features.PutURL = p.putURL
+	p.features = &features
+	return p
+}
+
+func (p *putURLFs) Features() *fs.Features {
+	return p.features
+}
+
+func (p *putURLFs) putURL(ctx context.Context, url string, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	p.urls = append(p.urls, url)
+	if p.cantCopy {
+		return nil, fs.ErrorCantCopy
+	}
+	contents, ok := p.links[url]
+	if !ok {
+		return nil, fmt.Errorf("unknown link %q", url)
+	}
+	return p.Fs.Put(ctx, strings.NewReader(contents), src, options...)
+}
+
+func TestCopyServerSideRelay(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	fdst := newPutURLFs(r.Fremote)
+
+	srcFs, err := mockfs.NewFs(ctx, "relay", "", nil)
+	require.NoError(t, err)
+	srcFs.Features().PublicLink = func(ctx context.Context, remote string, expire fs.Duration, unlink bool) (string, error) {
+		link := "https://example.com/" + remote
+		fdst.links[link] = "file contents"
+		return link, nil
+	}
+	srcFs.Features().PresignedLinks = true
+
+	for _, test := range []struct {
+		name         string
+		relay        bool
+		notPresigned bool
+		cantCopy     bool
+		wantURLs     []string
+	}{
+		{name: "relayed", relay: true, wantURLs: []string{"https://example.com/relayed"}},
+		{name: "not-enabled", relay: false},
+		{name: "not-presigned", relay: true, notPresigned: true},
+		{name: "fallback", relay: true, cantCopy: true, wantURLs: []string{"https://example.com/fallback"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ci.ServerSideRelay = test.relay
+			srcFs.Features().PresignedLinks = !test.notPresigned
+			fdst.cantCopy = test.cantCopy
+			fdst.urls = nil
+			src := &corruptingObject{
+				Object:  mockobject.New(test.name),
+				content: []byte("file contents"),
+			}
+			srcFs.(*mockfs.Fs).AddObject(src)
+
+			dst, err := operations.Copy(ctx, fdst, nil, test.name, src)
+			require.NoError(t, err)
+			assert.Equal(t, test.wantURLs, fdst.urls)
+			assert.Equal(t, "file contents", fstests.ReadObject(ctx, t, dst, -1))
+		})
+	}
+	r.CheckRemoteItems(t,
+		fstest.NewItem("relayed", "file contents", t1),
+		fstest.NewItem("not-enabled", "file contents", t1),
+		fstest.NewItem("not-presigned", "file contents", t1),
+		fstest.NewItem("fallback", "file contents", t1),
+	)
+}
+
+// freeSpaceFs wraps an Fs reporting free as its free space
+type freeSpaceFs struct {
+	fs.Fs
+	features *fs.Features
+	free     *int64 // free space to report, unknown if nil
+	abouts   int    // number of calls to About
+}
+
+func newFreeSpaceFs(f fs.Fs) *freeSpaceFs {
+	p := &freeSpaceFs{Fs: f}
+	features := *f.Features()
+	features.About = p.about
+	p.features = &features
+	return p
+}
+
+// Features returns the optional features of this Fs
+func (p *freeSpaceFs) Features() *fs.Features {
+	return p.features
+}
+
+func (p *freeSpaceFs) about(ctx context.Context) (*fs.Usage, error) {
+	p.abouts++
+	return &fs.Usage{Free: p.free}, nil
+}
+
+func TestCopyMinFreeSpace(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	fdst := newFreeSpaceFs(r.Fremote)
+	contents := strings.Repeat("x", 1000)
+	file1 := r.WriteFile("file1", contents, t1)
+	srcObj, err := r.Flocal.NewObject(ctx, file1.Path)
+	require.NoError(t, err)
+
+	free := func(n int64) *int64 { return &n }
+	for _, test := range []struct {
+		name         string
+		minFreeSpace fs.SizeSuffix
+		free         *int64
+		wantErr      bool
+		wantAbouts   int
+	}{
+		{name: "off", minFreeSpace: -1, free: free(0)},
+		{name: "enough", minFreeSpace: 1000, free: free(2000), wantAbouts: 1},
+		{name: "too-little", minFreeSpace: 1001, free: free(2000), wantErr: true, wantAbouts: 1},
+		{name: "full", minFreeSpace: 0, free: free(999), wantErr: true, wantAbouts: 1},
+		{name: "unknown", minFreeSpace: 1000, free: nil, wantAbouts: 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			// A new stats group reads the free space again
+			ctx := accounting.WithStatsGroup(ctx, "TestCopyMinFreeSpace-"+test.name)
+			ci.MinFreeSpace = test.minFreeSpace
+			fdst.free = test.free
+			fdst.abouts = 0
+			dst, err := operations.Copy(ctx, fdst, nil, test.name, srcObj)
+			assert.Equal(t, test.wantAbouts, fdst.abouts)
+			if test.wantErr {
+				assert.ErrorIs(t, err, operations.ErrorMinFreeSpace)
+				assert.True(t, fserrors.IsFatalError(err))
+				assert.Nil(t, dst)
+				_, err = r.Fremote.NewObject(ctx, test.name)
+				assert.Equal(t, fs.ErrorObjectNotFound, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, contents, fstests.ReadObject(ctx, t, dst, -1))
+			}
+		})
+	}
+
+	// The free space is read once and the bytes written since are
+	// counted as used
+	cachedCtx := accounting.WithStatsGroup(ctx, "TestCopyMinFreeSpace-cached")
+	ci.MinFreeSpace = 500
+	fdst.free = free(2500)
+	fdst.abouts = 0
+	for _, remote := range []string{"cached1", "cached2"} {
+		_, err = operations.Copy(cachedCtx, fdst, nil, remote, srcObj)
+		require.NoError(t, err)
+	}
+	_, err = operations.Copy(cachedCtx, fdst, nil, "cached3", srcObj)
+	assert.ErrorIs(t, err, operations.ErrorMinFreeSpace)
+	assert.Equal(t, 1, fdst.abouts)
+
+	// Destinations which don't report their free space are copied to
+	ctx = accounting.WithStatsGroup(ctx, "TestCopyMinFreeSpace-no-about")
+	ci.MinFreeSpace = fs.SizeSuffix(1 << 60)
+	fdst.features.About = nil
+	_, err = operations.Copy(ctx, fdst, nil, "no-about", srcObj)
+	require.NoError(t, err)
+}
+
+func TestCopySetModTime(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	ci.SetModTime = fs.Time(t3)
+
+	file1 := r.WriteFile("file1", "file1 contents", t1)
+	file2 := r.WriteFile("file2", strings.Repeat("file2 contents ", 100), t1)
+
+	// Copied through rclone
+	remote1 := file1
+	remote1.ModTime = t3
+	require.NoError(t, operations.CopyFile(ctx, r.Fremote, r.Flocal, file1.Path, file1.Path))
+	r.CheckRemoteItems(t, remote1)
+
+	// Copied with multi-thread copy
+	ci.MultiThreadCutoff = 1
+	ci.MultiThreadStreams = 2
+	ci.MultiThreadSet = true
+	remote2 := file2
+	remote2.ModTime = t3
+	require.NoError(t, operations.CopyFile(ctx, r.Fremote, r.Flocal, file2.Path, file2.Path))
+	r.CheckRemoteItems(t, remote1, remote2)
+
+	// Copied server-side if possible
+	remote3 := remote1
+	remote3.Path = "file3"
+	remote3.ModTime = t2
+	ci.SetModTime = fs.Time(t2)
+	require.NoError(t, operations.CopyFile(ctx, r.Fremote, r.Fremote, remote3.Path, remote1.Path))
+	r.CheckRemoteItems(t, remote1, remote2, remote3)
+}
@@ -0,0 +1,132 @@
+package operations
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// DefaultStorageClass is the storage class used for objects which
+// don't have one and the key of the price used for storage classes
+// which aren't in the price file.
+const DefaultStorageClass = "default"
+
+// StoragePrices are the prices per GiB per month of each storage
+// class as read from a price file
+type StoragePrices map[string]float64
+
+// ReadStoragePrices reads the prices from the JSON file at path
+//
+// The file should contain an object mapping storage class names to
+// the price per GiB per month, for example
+//
+//	{"STANDARD": 0.023, "GLACIER": 0.0036, "default": 0.023}
+func ReadStoragePrices(path string) (StoragePrices, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price file: %w", err)
+	}
+	var prices StoragePrices
+	err = json.Unmarshal(data, &prices)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse price file %q: %w", path, err)
+	}
+	for class, price := range prices {
+		if price < 0 {
+			return nil, fmt.Errorf("price file %q: price for storage class %q can't be negative", path, class)
+		}
+	}
+	return prices, nil
+}
+
+// price returns the price for class
+func (prices StoragePrices) price(class string) (price float64, ok bool) {
+	price, ok = prices[class]
+	if !ok {
+		price, ok = prices[DefaultStorageClass]
+	}
+	return price, ok
+}
+
+// StorageClassCost is the cost of storing the objects in a storage class
+type StorageClassCost struct {
+	Class string  `json:"class"` // name of the storage class
+	Count int64   `json:"count"` // number of objects
+	Bytes int64   `json:"bytes"` // total size of the objects
+	Price float64 `json:"price"` // price per GiB per month
+	Cost  float64 `json:"cost"`  // cost per month
+}
+
+// CostEstimate is the estimated cost of storing the objects in a remote
+type CostEstimate struct {
+	Classes  []StorageClassCost `json:"classes"`  // cost of each storage class sorted by name
+	Count    int64              `json:"count"`    // total number of objects
+	Bytes    int64              `json:"bytes"`    // total size of the objects
+	Cost     float64            `json:"cost"`     // total cost per month
+	Sizeless int64              `json:"sizeless"` // number of objects with unknown size
+}
+
+// EstimateCost lists f and estimates the monthly cost of storing its
+// objects using prices.
+//
+// The objects are grouped by the storage class reported in the
+// listing. Objects without a storage class are counted as
+// DefaultStorageClass. It is an error if there is no price for a
+// storage class and no default price.
+func EstimateCost(ctx context.Context, f fs.Fs, prices StoragePrices) (*CostEstimate, error) {
+	var (
+		mu       sync.Mutex
+		classes  = make(map[string]*StorageClassCost)
+		sizeless int64
+	)
+	err := ListFn(ctx, f, func(o fs.Object) {
+		class := ""
+		if do, ok := o.(fs.GetTierer); ok {
+			class = do.GetTier()
+		}
+		if class == "" {
+			class = DefaultStorageClass
+		}
+		size := o.Size()
+		mu.Lock()
+		defer mu.Unlock()
+		c := classes[class]
+		if c == nil {
+			c = &StorageClassCost{Class: class}
+			classes[class] = c
+		}
+		c.Count++
+		if size < 0 {
+			sizeless++
+		} else {
+			c.Bytes += size
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	estimate := &CostEstimate{
+		Sizeless: sizeless,
+	}
+	for _, c := range classes {
+		price, ok := prices.price(c.Class)
+		if !ok {
+			return nil, fmt.Errorf("no price for storage class %q and no %q price", c.Class, DefaultStorageClass)
+		}
+		c.Price = price
+		c.Cost = float64(c.Bytes) / float64(fs.Gibi) * price
+		estimate.Classes = append(estimate.Classes, *c)
+		estimate.Count += c.Count
+		estimate.Bytes += c.Bytes
+		estimate.Cost += c.Cost
+	}
+	sort.Slice(estimate.Classes, func(i, j int) bool {
+		return estimate.Classes[i].Class < estimate.Classes[j].Class
+	})
+	return estimate, nil
+}
@@ -0,0 +1,85 @@
+package operations_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fstest/mockfs"
+	"github.com/rclone/rclone/fstest/mockobject"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tierObject is a mock object with a size and storage class
+type tierObject struct {
+	mockobject.Object
+	size int64
+	tier string
+}
+
+func (o tierObject) Size() int64     { return o.size }
+func (o tierObject) GetTier() string { return o.tier }
+
+// writePrices writes a price file with contents returning its path
+func writePrices(t *testing.T, contents string) string {
+	path := filepath.Join(t.TempDir(), "prices.json")
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0600))
+	return path
+}
+
+func TestReadStoragePrices(t *testing.T) {
+	prices, err := operations.ReadStoragePrices(writePrices(t, `{"STANDARD": 0.023, "default": 0.01}`))
+	require.NoError(t, err)
+	assert.Equal(t, operations.StoragePrices{"STANDARD": 0.023, "default": 0.01}, prices)
+
+	_, err = operations.ReadStoragePrices(writePrices(t, `{"STANDARD": "cheap"}`))
+	assert.ErrorContains(t, err, "failed to parse price file")
+	_, err = operations.ReadStoragePrices(writePrices(t, `{"STANDARD": -1}`))
+	assert.ErrorContains(t, err, `price for storage class "STANDARD" can't be negative`)
+	_, err = operations.ReadStoragePrices(filepath.Join(t.TempDir(), "notfound"))
+	assert.ErrorContains(t, err, "failed to read price file")
+}
+
+func TestEstimateCost(t *testing.T) {
+	ctx := context.Background()
+	f, err := mockfs.NewFs(ctx, "mock", "", nil)
+	require.NoError(t, err)
+	m := f.(*mockfs.Fs)
+	for _, o := range []tierObject{
+		{Object: mockobject.New("a"), size: 2 * int64(fs.Gibi), tier: "STANDARD"},
+		{Object: mockobject.New("b"), size: 1 * int64(fs.Gibi), tier: "STANDARD"},
+		{Object: mockobject.New("c"), size: 10 * int64(fs.Gibi), tier: "GLACIER"},
+		{Object: mockobject.New("d"), size: int64(fs.Gibi) / 2, tier: "STANDARD_IA"},
+		{Object: mockobject.New("e"), size: 4 * int64(fs.Gibi)},
+		{Object: mockobject.New("f"), size: -1, tier: "GLACIER"},
+	} {
+		m.AddObject(o)
+	}
+
+	prices := operations.StoragePrices{
+		"STANDARD": 0.02,
+		"GLACIER":  0.004,
+		"default":  0.01,
+	}
+	estimate, err := operations.EstimateCost(ctx, f, prices)
+	require.NoError(t, err)
+	assert.Equal(t, []operations.StorageClassCost{
+		{Class: "GLACIER", Count: 2, Bytes: 10 * int64(fs.Gibi), Price: 0.004, Cost: 0.04},
+		{Class: "STANDARD", Count: 2, Bytes: 3 * int64(fs.Gibi), Price: 0.02, Cost: 0.06},
+		{Class: "STANDARD_IA", Count: 1, Bytes: int64(fs.Gibi) / 2, Price: 0.01, Cost: 0.005},
+		{Class: "default", Count: 1, Bytes: 4 * int64(fs.Gibi), Price: 0.01, Cost: 0.04},
+	}, estimate.Classes)
+	assert.Equal(t, int64(6), estimate.Count)
+	assert.Equal(t, int64(fs.Gibi)*35/2, estimate.Bytes)
+	assert.InDelta(t, 0.145, estimate.Cost, 1e-9)
+	assert.Equal(t, int64(1), estimate.Sizeless)
+
+	// Without a default price classes not in the file are an error
+	delete(prices, "default")
+	_, err = operations.EstimateCost(ctx, f, prices)
+	assert.ErrorContains(t, err, `no price for storage class`)
+}
@@ -0,0 +1,192 @@
+// fsck - checks the directory structure of a remote for inconsistencies
+
+package operations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/walk"
+)
+
+// FsckIssueType is the type of a structural issue found by Fsck
+type FsckIssueType string
+
+// Types of structural issue found by Fsck
+const (
+	// A directory marker with nothing under it - an empty
+	// directory. Only found if FsckOpt.EmptyDirs is set.
+	FsckOrphanedMarker FsckIssueType = "orphaned marker"
+	// An object in a directory which doesn't have a marker
+	FsckMissingMarker FsckIssueType = "missing marker"
+	// Entries in the same directory whose names only differ in case
+	FsckCaseCollision FsckIssueType = "case collision"
+	// A file and a directory with the same name
+	FsckFileDirCollision FsckIssueType = "file/directory collision"
+)
+
+// FsckIssue describes a structural issue found by Fsck
+type FsckIssue struct {
+	Type     FsckIssueType // type of the issue
+	Remote   string        // path of the entry with the issue
+	Other    string        // path of the colliding entry for collisions
+	Repaired bool          // set if the issue was repaired
+}
+
+// String describes the issue
+func (issue FsckIssue) String() string {
+	if issue.Other != "" {
+		return fmt.Sprintf("%s: %q and %q", issue.Type, issue.Remote, issue.Other)
+	}
+	return fmt.Sprintf("%s: %q", issue.Type, issue.Remote)
+}
+
+// FsckOpt are the options for Fsck
+type FsckOpt struct {
+	Repair    bool // repair the issues which can be repaired
+	EmptyDirs bool // report empty directory markers as orphaned, removing them if repairing
+}
+
+// fsckParent returns the parent directory of remote with the root as ""
+func fsckParent(remote string) string {
+	dir := path.Dir(remote)
+	if dir == "." || dir == "/" {
+		dir = ""
+	}
+	return dir
+}
+
+// Fsck scans f for issues with its directory structure and returns
+// them sorted by type and path.
+//
+// On remotes which keep directory markers (bucket based remotes which
+// can have empty directories) it finds objects in directories with no
+// marker, and if opt.EmptyDirs is set markers with nothing under them.
+// These are only found if asked for as empty directories are allowed
+// on these remotes. On all remotes it finds names in the same
+// directory which only differ in case and files with the same name as
+// a directory.
+//
+// If opt.Repair is set then missing markers are created and orphaned
+// markers are removed. Collisions are only reported as they need a
+// decision about which entry to rename.
+//
+// It returns an error if it couldn't list f. It logs each issue found
+// and counts an error for each issue not repaired.
+func Fsck(ctx context.Context, f fs.Fs, opt FsckOpt) (issues []FsckIssue, err error) {
+	ci := fs.GetConfig(ctx)
+	features := f.Features()
+	checkMarkers := features.BucketBased && features.CanHaveEmptyDirectories
+
+	// Read the listing of f. Use ListR directly if available so
+	// the directories are only those the remote returns and
+	// aren't made up from the paths of the objects.
+	objects := map[string]bool{}  // objects found
+	dirs := map[string]bool{}     // directories found
+	nonEmpty := map[string]bool{} // directories with objects under them
+	fn := func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			remote := entry.Remote()
+			switch entry.(type) {
+			case fs.Directory:
+				dirs[remote] = true
+			case fs.Object:
+				objects[remote] = true
+				for dir := fsckParent(remote); dir != "" && !nonEmpty[dir]; dir = fsckParent(dir) {
+					nonEmpty[dir] = true
+				}
+			}
+		}
+		return nil
+	}
+	if listR := features.ListR; listR != nil {
+		err = listR(ctx, "", fn)
+	} else {
+		err = walk.ListR(ctx, f, "", true, -1, walk.ListAll, fn)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fsck failed to list: %w", err)
+	}
+
+	// Find the names in each directory including directories
+	// implied by the paths of objects
+	names := map[string]bool{}
+	for _, set := range []map[string]bool{objects, dirs, nonEmpty} {
+		for remote := range set {
+			names[remote] = true
+		}
+	}
+	byLower := map[string][]string{}
+	for remote := range names {
+		lower := path.Join(fsckParent(remote), strings.ToLower(path.Base(remote)))
+		byLower[lower] = append(byLower[lower], remote)
+	}
+
+	for _, remotes := range byLower {
+		if len(remotes) < 2 {
+			continue
+		}
+		sort.Strings(remotes)
+		for _, other := range remotes[1:] {
+			issues = append(issues, FsckIssue{Type: FsckCaseCollision, Remote: remotes[0], Other: other})
+		}
+	}
+	for remote := range objects {
+		if dirs[remote] || nonEmpty[remote] {
+			issues = append(issues, FsckIssue{Type: FsckFileDirCollision, Remote: remote})
+		}
+	}
+	if checkMarkers {
+		for dir := range dirs {
+			if opt.EmptyDirs && !nonEmpty[dir] {
+				issues = append(issues, FsckIssue{Type: FsckOrphanedMarker, Remote: dir})
+			}
+		}
+		for dir := range nonEmpty {
+			if !dirs[dir] {
+				issues = append(issues, FsckIssue{Type: FsckMissingMarker, Remote: dir})
+			}
+		}
+	}
+
+	// Sort the issues so that markers are removed deepest first
+	// and created shallowest first
+	sort.Slice(issues, func(i, j int) bool {
+		a, b := issues[i], issues[j]
+		if a.Type != b.Type {
+			return a.Type > b.Type
+		}
+		if a.Type == FsckOrphanedMarker {
+			return a.Remote > b.Remote
+		}
+		return a.Remote < b.Remote
+	})
+	for i := range issues {
+		issue := &issues[i]
+		if opt.Repair && (issue.Type == FsckOrphanedMarker || issue.Type == FsckMissingMarker) {
+			if issue.Type == FsckOrphanedMarker {
+				err = Rmdir(ctx, f, issue.Remote)
+			} else {
+				err = Mkdir(ctx, f, issue.Remote)
+			}
+			if err != nil {
+				err = fs.CountError(err)
+				fs.Errorf(fs.LogDirName(f, issue.Remote), "Failed to repair %s: %v", issue, err)
+				continue
+			}
+			issue.Repaired = !ci.DryRun && ci.Queue == ""
+		}
+		if issue.Repaired {
+			fs.Logf(fs.LogDirName(f, issue.Remote), "Repaired %s", issue)
+		} else {
+			_ = fs.CountError(errors.New(issue.String()))
+			fs.Errorf(fs.LogDirName(f, issue.Remote), "Found %s", issue)
+		}
+	}
+	return issues, nil
+}
@@ -0,0 +1,223 @@
+package operations_test
+
+import (
+	"context"
+	"errors"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fstest/mockdir"
+	"github.com/rclone/rclone/fstest/mockfs"
+	"github.com/rclone/rclone/fstest/mockobject"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bucketFs is a mock bucket which keeps directory markers and lists
+// exactly what is in it
+type bucketFs struct {
+	*mockfs.Fs
+	features *fs.Features
+	entries  map[string]fs.DirEntry
+	mkdirErr error // error for Mkdir to return if set
+}
+
+func newBucketFs(t *testing.T, objects, markers []string) *bucketFs {
+	ctx := context.Background()
+	f, err := mockfs.NewFs(ctx, "bucket", "", nil)
+	require.NoError(t, err)
+	b := &bucketFs{
+		Fs:      f.(*mockfs.Fs),
+		entries: map[string]fs.DirEntry{},
+	}
+	b.features = (&fs.Features{
+		BucketBased:             true,
+		CanHaveEmptyDirectories: true,
+	}).Fill(ctx, b)
+	for _, remote := range objects {
+		b.entries[remote] = mockobject.New(remote)
+	}
+	for _, dir := range markers {
+		b.entries[dir+"/"] = mockdir.New(dir)
+	}
+	return b
+}
+
+func (b *bucketFs) Features() *fs.Features {
+	return b.features
+}
+
+// List the directory like a bucket would, making up directories from
+// the paths of the objects
+func (b *bucketFs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	seen := map[string]bool{}
+	for _, entry := range b.entries {
+		remote := entry.Remote()
+		if dir != "" && !strings.HasPrefix(remote, dir+"/") {
+			continue
+		}
+		rest := strings.TrimPrefix(remote, dir+"/")
+		if dir == "" {
+			rest = remote
+		}
+		if i := strings.IndexRune(rest, '/'); i >= 0 {
+			sub := path.Join(dir, rest[:i])
+			if !seen[sub] {
+				seen[sub] = true
+				entries = append(entries, mockdir.New(sub))
+			}
+		} else if _, isDir := entry.(fs.Directory); isDir {
+			if !seen[remote] {
+				seen[remote] = true
+				entries = append(entries, entry)
+			}
+		} else {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// ListR returns the markers and objects only
+func (b *bucketFs) ListR(ctx context.Context, dir string, callback fs.ListRCallback) error {
+	var entries fs.DirEntries
+	for _, entry := range b.entries {
+		entries = append(entries, entry)
+	}
+	return callback(entries)
+}
+
+func (b *bucketFs) Mkdir(ctx context.Context, dir string) error {
+	if b.mkdirErr != nil {
+		return b.mkdirErr
+	}
+	b.entries[dir+"/"] = mockdir.New(dir)
+	return nil
+}
+
+func (b *bucketFs) Rmdir(ctx context.Context, dir string) error {
+	delete(b.entries, dir+"/")
+	return nil
+}
+
+// markers returns the sorted directory markers in the bucket
+func (b *bucketFs) markers() (markers []string) {
+	for key := range b.entries {
+		if strings.HasSuffix(key, "/") {
+			markers = append(markers, strings.TrimSuffix(key, "/"))
+		}
+	}
+	sort.Strings(markers)
+	return markers
+}
+
+func TestFsck(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	b := newBucketFs(t,
+		[]string{
+			"ok/file",                // fine
+			"nomarker/sub/file",      // missing markers for nomarker and nomarker/sub
+			"Case/file", "case/file", // case collision
+			"clash", "clash/file", // file/directory collision
+		},
+		[]string{"ok", "empty", "empty/sub", "Case", "case", "clash"},
+	)
+
+	issueStrings := func(issues []operations.FsckIssue) (out []string) {
+		for _, issue := range issues {
+			out = append(out, issue.String())
+		}
+		return out
+	}
+	want := []string{
+		`missing marker: "nomarker"`,
+		`missing marker: "nomarker/sub"`,
+		`file/directory collision: "clash"`,
+		`case collision: "Case" and "case"`,
+	}
+	wantEmpty := append([]string{
+		`orphaned marker: "empty/sub"`,
+		`orphaned marker: "empty"`,
+	}, want...)
+	repairedStrings := func(issues []operations.FsckIssue) (out []string) {
+		for _, issue := range issues {
+			if issue.Repaired {
+				out = append(out, issue.String())
+			}
+		}
+		return out
+	}
+
+	// Check without repair
+	issues, err := operations.Fsck(ctx, b, operations.FsckOpt{})
+	require.NoError(t, err)
+	assert.Equal(t, want, issueStrings(issues))
+	assert.Nil(t, repairedStrings(issues))
+	wantMarkers := []string{"Case", "case", "clash", "empty", "empty/sub", "ok"}
+	assert.Equal(t, wantMarkers, b.markers())
+
+	// Empty directories are only reported if asked for
+	issues, err = operations.Fsck(ctx, b, operations.FsckOpt{EmptyDirs: true})
+	require.NoError(t, err)
+	assert.Equal(t, wantEmpty, issueStrings(issues))
+	assert.Nil(t, repairedStrings(issues))
+
+	// Check with --dry-run nothing is repaired
+	ci.DryRun = true
+	issues, err = operations.Fsck(ctx, b, operations.FsckOpt{Repair: true, EmptyDirs: true})
+	require.NoError(t, err)
+	assert.Equal(t, wantEmpty, issueStrings(issues))
+	assert.Equal(t, wantMarkers, b.markers())
+	ci.DryRun = false
+
+	// Repair leaves the empty directories alone
+	issues, err = operations.Fsck(ctx, b, operations.FsckOpt{Repair: true})
+	require.NoError(t, err)
+	assert.Equal(t, want, issueStrings(issues))
+	assert.Equal(t, want[:2], repairedStrings(issues))
+	assert.Equal(t, []string{"Case", "case", "clash", "empty", "empty/sub", "nomarker", "nomarker/sub", "ok"}, b.markers())
+
+	// Repair with EmptyDirs removes them
+	issues, err = operations.Fsck(ctx, b, operations.FsckOpt{Repair: true, EmptyDirs: true})
+	require.NoError(t, err)
+	assert.Equal(t, wantEmpty[:2], repairedStrings(issues))
+	assert.Equal(t, []string{"Case", "case", "clash", "nomarker", "nomarker/sub", "ok"}, b.markers())
+
+	// Only the collisions should remain
+	issues, err = operations.Fsck(ctx, b, operations.FsckOpt{Repair: true, EmptyDirs: true})
+	require.NoError(t, err)
+	assert.Equal(t, want[2:], issueStrings(issues))
+}
+
+func TestFsckNoMarkers(t *testing.T) {
+	ctx := context.Background()
+	b := newBucketFs(t, []string{"dir/file", "DIR/file2", "file"}, nil)
+	// Without directory markers only collisions are checked
+	b.features.CanHaveEmptyDirectories = false
+	b.features.ListR = nil
+	issues, err := operations.Fsck(ctx, b, operations.FsckOpt{Repair: true, EmptyDirs: true})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(issues))
+	assert.Equal(t, `case collision: "DIR" and "dir"`, issues[0].String())
+	assert.False(t, issues[0].Repaired)
+}
+
+func TestFsckRepairFails(t *testing.T) {
+	ctx := context.Background()
+	b := newBucketFs(t, []string{"nomarker/file"}, nil)
+	b.mkdirErr = errors.New("mkdir failed")
+
+	accounting.GlobalStats().ResetCounters()
+	issues, err := operations.Fsck(ctx, b, operations.FsckOpt{Repair: true})
+	require.NoError(t, err)
+	require.Len(t, issues, 1)
+	assert.False(t, issues[0].Repaired)
+	assert.True(t, accounting.GlobalStats().Errored())
+	assert.ErrorIs(t, accounting.GlobalStats().GetLastError(), b.mkdirErr)
+}
@@ -234,7 +234,7 @@ func WinningSide(ctx context.Context, sigil Sigil, src, dst fs.DirEntry, err err
 			winner.Obj = src
 			winner.Side = "src" // copy src to dst unconditionally
 		}
-		if (sigil == Match || sigil == Differ) && (ci.IgnoreExisting || ci.Immutable) {
+		if (sigil == Match || sigil == Differ) && (ci.IgnoreExisting || ci.NoUpdateExisting || ci.Immutable) {
 			winner.Obj = dst
 			winner.Side = "dst" // dst should remain unchanged if it already exists (and we know it does because it's Match or Differ)
 		}
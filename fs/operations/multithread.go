@@ -96,6 +96,10 @@ func (mc *multiThreadCopyState) copyChunk(ctx context.Context, chunk int, writer
 		// Read the chunk into buffered reader
 		rw := multipart.NewRW()
 		defer fs.CheckClose(rw, &err)
+		err = rw.Reserve(ctx, size)
+		if err != nil {
+			return fmt.Errorf("multi-thread copy: failed to get memory for chunk: %w", err)
+		}
 		_, err = io.CopyN(rw, rc, size)
 		if err != nil {
 			return fmt.Errorf("multi-thread copy: failed to read chunk: %w", err)
@@ -106,7 +110,7 @@ func (mc *multiThreadCopyState) copyChunk(ctx context.Context, chunk int, writer
 	}
 
 	// Write the chunk
-	bytesWritten, err := writer.WriteChunk(ctx, chunk, rs)
+	bytesWritten, err := multipart.WriteChunk(ctx, mc.src, writer, chunk, rs)
 	if err != nil {
 		return fmt.Errorf("multi-thread copy: failed to write chunk: %w", err)
 	}
@@ -158,7 +162,7 @@ func multiThreadCopy(ctx context.Context, f fs.Fs, remote string, src fs.Object,
 		return nil, fmt.Errorf("multi-thread copy: can't copy zero sized file")
 	}
 
-	info, chunkWriter, err := openChunkWriter(ctx, remote, src, options...)
+	info, chunkWriter, err := openChunkWriter(ctx, remote, overrideModTime(ctx, src), options...)
 	if err != nil {
 		return nil, fmt.Errorf("multi-thread copy: failed to open chunk writer: %w", err)
 	}
@@ -242,7 +246,7 @@ func multiThreadCopy(ctx context.Context, f fs.Fs, remote string, src fs.Object,
 	}
 
 	if f.Features().PartialUploads {
-		err = obj.SetModTime(ctx, src.ModTime(ctx))
+		err = obj.SetModTime(ctx, srcModTime(ctx, src))
 		switch err {
 		case nil, fs.ErrorCantSetModTime, fs.ErrorCantSetModTimeWithoutDelete:
 		default:
@@ -1,6 +1,7 @@
 package operations
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -304,3 +305,151 @@ func TestMultithreadCopyAbort(t *testing.T) {
 		require.NoError(t, o.Remove(ctx))
 	}
 }
+
+// chunkFs is an fs.Fs which uploads with a ChunkWriter and records
+// how many chunks are written at once
+type chunkFs struct {
+	fs.Fs
+	features    fs.Features
+	info        fs.ChunkWriterInfo
+	wantWriting int // chunks written are held until this many are being written
+
+	mu         sync.Mutex
+	writing    int // number of chunks being written
+	maxWriting int // most chunks written at once
+}
+
+func newChunkFs(f fs.Fs, info fs.ChunkWriterInfo) *chunkFs {
+	cf := &chunkFs{Fs: f, info: info}
+	cf.features = *f.Features()
+	cf.features.IsLocal = false
+	cf.features.PartialUploads = false
+	cf.features.OpenWriterAt = nil
+	cf.features.OpenChunkWriter = cf.openChunkWriter
+	return cf
+}
+
+// Features returns the optional features of this Fs
+func (f *chunkFs) Features() *fs.Features {
+	return &f.features
+}
+
+func (f *chunkFs) openChunkWriter(ctx context.Context, remote string, src fs.ObjectInfo, options ...fs.OpenOption) (fs.ChunkWriterInfo, fs.ChunkWriter, error) {
+	return f.info, &chunkFsWriter{f: f, remote: remote, src: src, chunks: map[int][]byte{}}, nil
+}
+
+// chunkFsWriter writes the chunks to memory then uploads them joined
+// together to the Fs wrapped by chunkFs on Close
+type chunkFsWriter struct {
+	f      *chunkFs
+	remote string
+	src    fs.ObjectInfo
+	mu     sync.Mutex
+	chunks map[int][]byte
+}
+
+func (w *chunkFsWriter) WriteChunk(ctx context.Context, chunkNumber int, reader io.ReadSeeker) (int64, error) {
+	f := w.f
+	f.mu.Lock()
+	f.writing++
+	if f.writing > f.maxWriting {
+		f.maxWriting = f.writing
+	}
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.writing--
+		f.mu.Unlock()
+	}()
+
+	// Wait for the other streams to start writing so it can be
+	// seen that they write at the same time
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		f.mu.Lock()
+		started := f.maxWriting >= f.wantWriting
+		f.mu.Unlock()
+		if started {
+			break
+		}
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return 0, err
+	}
+	w.mu.Lock()
+	w.chunks[chunkNumber] = data
+	w.mu.Unlock()
+	return int64(len(data)), nil
+}
+
+func (w *chunkFsWriter) Close(ctx context.Context) error {
+	var data []byte
+	for i := 0; i < len(w.chunks); i++ {
+		chunk, ok := w.chunks[i]
+		if !ok {
+			return fmt.Errorf("chunk %d missing", i)
+		}
+		data = append(data, chunk...)
+	}
+	info := object.NewStaticObjectInfo(w.remote, w.src.ModTime(ctx), int64(len(data)), true, nil, nil)
+	_, err := w.f.Fs.Put(ctx, bytes.NewReader(data), info)
+	return err
+}
+
+func (w *chunkFsWriter) Abort(ctx context.Context) error {
+	return nil
+}
+
+// Test a large file is uploaded by reading and writing chunks of it
+// at the same time and is put back together correctly
+func TestMultithreadUploadConcurrentChunks(t *testing.T) {
+	const chunkSize = 1024
+	r := fstest.NewRun(t)
+
+	for _, test := range []struct {
+		name           string
+		streams        int
+		streamsSet     bool
+		backendStreams int
+		wantWriting    int
+		size           int
+	}{
+		{name: "streams", streams: 4, streamsSet: true, backendStreams: 1, wantWriting: 4, size: 10*chunkSize + 5},
+		{name: "backend", streams: 4, streamsSet: false, backendStreams: 3, wantWriting: 3, size: 10 * chunkSize},
+		{name: "few-chunks", streams: 4, streamsSet: true, backendStreams: 1, wantWriting: 2, size: 2*chunkSize - 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			ctx, ci := fs.AddConfig(ctx)
+			ci.MultiThreadCutoff = chunkSize
+			ci.MultiThreadStreams = test.streams
+			ci.MultiThreadSet = test.streamsSet
+
+			contents := random.String(test.size)
+			file := r.WriteFile(test.name, contents, fstest.Time("2001-02-03T04:05:06.499999999Z"))
+			src, err := r.Flocal.NewObject(ctx, test.name)
+			require.NoError(t, err)
+
+			f := newChunkFs(r.Fremote, fs.ChunkWriterInfo{ChunkSize: chunkSize, Concurrency: test.backendStreams})
+			f.wantWriting = test.wantWriting
+			require.True(t, doMultiThreadCopy(ctx, f, src))
+
+			dst, err := Copy(ctx, f, nil, test.name, src)
+			require.NoError(t, err)
+			assert.Equal(t, int64(test.size), dst.Size())
+			assert.Equal(t, test.wantWriting, f.maxWriting, "chunks written at once")
+
+			o, err := r.Fremote.NewObject(ctx, test.name)
+			require.NoError(t, err)
+			in, err := o.Open(ctx)
+			require.NoError(t, err)
+			got, err := io.ReadAll(in)
+			require.NoError(t, err)
+			require.NoError(t, in.Close())
+			assert.Equal(t, contents, string(got))
+			fstest.CheckListingWithPrecision(t, r.Fremote, []fstest.Item{file}, nil, fs.GetModifyWindow(ctx, r.Flocal, r.Fremote))
+			require.NoError(t, o.Remove(ctx))
+		})
+	}
+}
@@ -40,6 +40,7 @@ import (
 	"github.com/rclone/rclone/lib/readers"
 	"golang.org/x/sync/errgroup"
 	"golang.org/x/text/unicode/norm"
+	"golang.org/x/time/rate"
 )
 
 // CheckHashes checks the two files to see if they have common
@@ -150,7 +151,7 @@ func DirsEqual(ctx context.Context, src, dst fs.Directory, opt DirsEqualOpt) (eq
 		return false
 	}
 	ci := fs.GetConfig(ctx)
-	if ci.SizeOnly || ci.Immutable || ci.IgnoreExisting || opt.ModifyWindow == fs.ModTimeNotSupported {
+	if ci.SizeOnly || ci.Immutable || ci.IgnoreExisting || ci.NoUpdateExisting || opt.ModifyWindow == fs.ModTimeNotSupported {
 		return true
 	}
 	if ci.IgnoreTimes {
@@ -187,6 +188,10 @@ func sizeDiffers(ctx context.Context, src, dst fs.ObjectInfo) bool {
 
 var checksumWarning sync.Once
 
+// errNoHashesToCompare is returned with --checksum-fallback ERROR if
+// there are no hashes to compare
+var errNoHashesToCompare = errors.New("can't compare with --checksum as there are no hashes to compare")
+
 // options for equal function()
 type equalOpt struct {
 	sizeOnly          bool // if set only check size
@@ -235,6 +240,24 @@ func WithEqualFn(ctx context.Context, equalFn EqualFn) context.Context {
 	return context.WithValue(ctx, equalFnKey, equalFn)
 }
 
+// srcModTime returns the modification time src should have on the
+// destination which is the time set with --set-modtime if in use
+func srcModTime(ctx context.Context, src fs.ObjectInfo) time.Time {
+	if ci := fs.GetConfig(ctx); ci.SetModTime.IsSet() {
+		return time.Time(ci.SetModTime)
+	}
+	return src.ModTime(ctx)
+}
+
+// overrideModTime returns src with its modification time overridden
+// by --set-modtime if in use
+func overrideModTime(ctx context.Context, src fs.ObjectInfo) fs.ObjectInfo {
+	if ci := fs.GetConfig(ctx); ci.SetModTime.IsSet() {
+		return fs.NewOverrideModTime(src, time.Time(ci.SetModTime))
+	}
+	return src
+}
+
 func equal(ctx context.Context, src fs.ObjectInfo, dst fs.Object, opt equalOpt) bool {
 	ci := fs.GetConfig(ctx)
 	logger, _ := GetLogger(ctx)
@@ -260,7 +283,25 @@ func equal(ctx context.Context, src fs.ObjectInfo, dst fs.Object, opt equalOpt)
 			logger(ctx, Differ, src, dst, nil)
 			return false
 		}
-		if ht == hash.None {
+		if ht != hash.None {
+			fs.Debugf(src, "Size and %v of src and dst objects identical", ht)
+			logger(ctx, Match, src, dst, nil)
+			return true
+		}
+		// No hashes to compare so do what --checksum-fallback says
+		switch ci.ChecksumFallback {
+		case fs.ChecksumFallbackModTime:
+			fs.Debugf(src, "No hashes to compare - checking modification times")
+		case fs.ChecksumFallbackTransfer:
+			fs.Debugf(src, "No hashes to compare - transferring")
+			logger(ctx, Differ, src, dst, nil)
+			return false
+		case fs.ChecksumFallbackError:
+			err := fs.CountError(errNoHashesToCompare)
+			fs.Errorf(src, "%v", err)
+			logger(ctx, TransferError, src, dst, err)
+			return true
+		default:
 			common := src.Fs().Hashes().Overlap(dst.Fs().Hashes())
 			if common.Count() == 0 {
 				checksumWarning.Do(func() {
@@ -268,14 +309,12 @@ func equal(ctx context.Context, src fs.ObjectInfo, dst fs.Object, opt equalOpt)
 				})
 			}
 			fs.Debugf(src, "Size of src and dst objects identical")
-		} else {
-			fs.Debugf(src, "Size and %v of src and dst objects identical", ht)
+			logger(ctx, Match, src, dst, nil)
+			return true
 		}
-		logger(ctx, Match, src, dst, nil)
-		return true
 	}
 
-	srcModTime := src.ModTime(ctx)
+	srcModTime := srcModTime(ctx, src)
 	if !opt.forceModTimeMatch {
 		// Sizes the same so check the mtime
 		modifyWindow := fs.GetModifyWindow(ctx, src.Fs(), dst.Fs())
@@ -310,7 +349,10 @@ func equal(ctx context.Context, src fs.ObjectInfo, dst fs.Object, opt equalOpt)
 
 	// mod time differs but hash is the same to reset mod time if required
 	if opt.updateModTime {
-		if !SkipDestructive(ctx, src, "update modification time") {
+		if ci.Queue != "" {
+			// Copying the file again will update the modification time
+			_ = queueOperation(ctx, QueueCopy, src, dst.Fs(), dst.Remote())
+		} else if !SkipDestructive(ctx, src, "update modification time") {
 			// Size and hash the same but mtime different
 			// Error if objects are treated as immutable
 			if ci.Immutable {
@@ -424,6 +466,9 @@ func MoveTransfer(ctx context.Context, fdst fs.Fs, dst fs.Object, remote string,
 // move - see Move for help
 func move(ctx context.Context, fdst fs.Fs, dst fs.Object, remote string, src fs.Object, isTransfer bool) (newDst fs.Object, err error) {
 	ci := fs.GetConfig(ctx)
+	if err = accounting.WaitIfPaused(ctx); err != nil {
+		return nil, err
+	}
 	var tr *accounting.Transfer
 	if isTransfer {
 		tr = accounting.Stats(ctx).NewTransfer(src, fdst)
@@ -437,6 +482,11 @@ func move(ctx context.Context, fdst fs.Fs, dst fs.Object, remote string, src fs.
 		tr.Done(ctx, err)
 	}()
 	newDst = dst
+	if ci.Queue != "" {
+		in := tr.Account(ctx, nil)
+		in.DryRun(src.Size())
+		return newDst, queueOperation(ctx, QueueMove, src, fdst, remote)
+	}
 	if SkipDestructive(ctx, src, "move") {
 		in := tr.Account(ctx, nil)
 		in.DryRun(src.Size())
@@ -444,6 +494,11 @@ func move(ctx context.Context, fdst fs.Fs, dst fs.Object, remote string, src fs.
 	}
 	// See if we have Move available
 	if doMove := fdst.Features().Move; doMove != nil && (SameConfig(src.Fs(), fdst) || (SameRemoteType(src.Fs(), fdst) && (fdst.Features().ServerSideAcrossConfigs || ci.ServerSideAcrossConfigs))) {
+		if dst == nil {
+			if err = checkName(ctx, fdst, src, remote); err != nil {
+				return nil, err
+			}
+		}
 		// Delete destination if it exists and is not the same file as src (could be same file while seemingly different if the remote is case insensitive)
 		if dst != nil {
 			if !SameObject(src, dst) {
@@ -470,6 +525,8 @@ func move(ctx context.Context, fdst fs.Fs, dst fs.Object, remote string, src fs.
 			}
 			in.ServerSideMoveEnd(newDst.Size()) // account the bytes for the server-side transfer
 			_ = in.Close()
+			hashType, _ := CommonHash(ctx, fdst, src.Fs())
+			logVerified(ctx, "move", src, newDst, hashType)
 			return newDst, nil
 		case fs.ErrorCantMove:
 			fs.Debugf(src, "Can't move, switching to copy")
@@ -550,11 +607,25 @@ func DeleteFileWithBackupDir(ctx context.Context, dst fs.Object, backupDir fs.Fs
 	if backupDir != nil {
 		action, actioned = "move into backup dir", "Moved into backup dir"
 	}
-	skip := SkipDestructive(ctx, dst, action)
-	if skip {
+	ci := fs.GetConfig(ctx)
+	queue := ci.Queue != ""
+	skip := queue || SkipDestructive(ctx, dst, action)
+	if queue && backupDir != nil {
+		// Move queues the move into the backup dir
+		err = MoveBackupDir(ctx, backupDir, dst)
+	} else if queue {
+		err = queueOperation(ctx, QueueDelete, nil, dst.Fs(), dst.Remote())
+	} else if skip {
 		// do nothing
 	} else if backupDir != nil {
 		err = MoveBackupDir(ctx, backupDir, dst)
+	} else if ci.DeleteIfUnchanged {
+		var removed bool
+		removed, err = removeIfUnchanged(ctx, dst)
+		if err == nil && !removed {
+			accounting.Stats(ctx).UndoDeleteFile(dst.Size())
+			skip = true
+		}
 	} else {
 		err = dst.Remove(ctx)
 	}
@@ -567,6 +638,41 @@ func DeleteFileWithBackupDir(ctx context.Context, dst fs.Object, backupDir fs.Fs
 	return err
 }
 
+// removeIfUnchanged removes dst only if it is the same as when it was
+// listed. It returns removed false if dst wasn't removed as it has
+// changed or has been deleted already.
+//
+// If dst can't do this itself it is read again and its size and
+// modification time compared with the listing.
+func removeIfUnchanged(ctx context.Context, dst fs.Object) (removed bool, err error) {
+	if do, ok := dst.(fs.ConditionalRemover); ok {
+		err = do.RemoveIfUnchanged(ctx)
+	} else if f, ok := dst.Fs().(fs.Fs); !ok {
+		err = dst.Remove(ctx)
+	} else {
+		var current fs.Object
+		current, err = f.NewObject(ctx, dst.Remote())
+		if errors.Is(err, fs.ErrorObjectNotFound) {
+			fs.Debugf(dst, "Not deleting as it has been deleted already")
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		if current.Size() != dst.Size() {
+			err = fs.ErrorObjectChanged
+		} else if f.Precision() != fs.ModTimeNotSupported && !current.ModTime(ctx).Equal(dst.ModTime(ctx)) {
+			err = fs.ErrorObjectChanged
+		} else {
+			err = current.Remove(ctx)
+		}
+	}
+	if errors.Is(err, fs.ErrorObjectChanged) {
+		fs.Logf(dst, "Not deleting as it has changed since it was listed")
+		return false, nil
+	}
+	return err == nil, err
+}
+
 // DeleteFile deletes a single file respecting --dry-run and accumulating stats and errors.
 //
 // If useBackupDir is set and --backup-dir is in effect then it moves
@@ -581,27 +687,148 @@ func DeleteFile(ctx context.Context, dst fs.Object) (err error) {
 // If backupDir is set the files will be placed into that directory
 // instead of being deleted.
 func DeleteFilesWithBackupDir(ctx context.Context, toBeDeleted fs.ObjectsChan, backupDir fs.Fs) error {
-	var wg sync.WaitGroup
 	ci := fs.GetConfig(ctx)
-	wg.Add(ci.Checkers)
+	return deleteFiles(ctx, toBeDeleted, ci.Checkers, 1, func(ctx context.Context, objs []fs.Object) []error {
+		return []error{DeleteFileWithBackupDir(ctx, objs[0], backupDir)}
+	})
+}
+
+// QuarantineFile moves a single file which sync would delete into
+// quarantineDir respecting --dry-run and accumulating stats and
+// errors.
+func QuarantineFile(ctx context.Context, dst fs.Object, quarantineDir fs.Fs) (err error) {
+	tr := accounting.Stats(ctx).NewCheckingTransfer(dst, "quarantining")
+	defer func() {
+		tr.Done(ctx, err)
+	}()
+	err = accounting.Stats(ctx).DeleteFile(ctx, dst.Size())
+	if err != nil {
+		return err
+	}
+	err = MoveQuarantineDir(ctx, quarantineDir, dst)
+	if err != nil {
+		fs.Errorf(dst, "Couldn't move into quarantine dir: %v", err)
+		err = fs.CountError(err)
+	}
+	return err
+}
+
+// QuarantineFiles moves all the files passed in the channel into
+// quarantineDir instead of deleting them.
+func QuarantineFiles(ctx context.Context, toBeQuarantined fs.ObjectsChan, quarantineDir fs.Fs) error {
+	ci := fs.GetConfig(ctx)
+	return deleteFiles(ctx, toBeQuarantined, ci.Checkers, 1, func(ctx context.Context, objs []fs.Object) []error {
+		return []error{QuarantineFile(ctx, objs[0], quarantineDir)}
+	})
+}
+
+// deleteBatchSize is the maximum number of objects passed to
+// DeleteObjects at once
+const deleteBatchSize = 1000
+
+// DeleteFilesBatched removes all the files in f passed in the channel
+// using concurrency deleters, or --checkers if concurrency is 0.
+//
+// If f supports DeleteObjects then the files are deleted in batches,
+// otherwise they are deleted one at a time as with
+// DeleteFilesWithBackupDir. Batches aren't used if backupDir is set
+// or if the deletes might be skipped, e.g. with --dry-run or
+// --delete-if-unchanged.
+//
+// The files may be deleted in any order.
+func DeleteFilesBatched(ctx context.Context, f fs.Fs, toBeDeleted fs.ObjectsChan, backupDir fs.Fs, concurrency int) error {
+	ci := fs.GetConfig(ctx)
+	if concurrency <= 0 {
+		concurrency = ci.Checkers
+	}
+	doDeleteObjects := f.Features().DeleteObjects
+	if doDeleteObjects == nil || backupDir != nil || ci.DryRun || ci.Interactive || ci.Queue != "" || ci.DeleteIfUnchanged {
+		return deleteFiles(ctx, toBeDeleted, concurrency, 1, func(ctx context.Context, objs []fs.Object) []error {
+			return []error{DeleteFileWithBackupDir(ctx, objs[0], backupDir)}
+		})
+	}
+	return deleteFiles(ctx, toBeDeleted, concurrency, deleteBatchSize, func(ctx context.Context, objs []fs.Object) []error {
+		return deleteObjects(ctx, doDeleteObjects, objs)
+	})
+}
+
+// deleteObjects deletes a batch of objects with doDeleteObjects
+// accumulating stats and errors for each object.
+func deleteObjects(ctx context.Context, doDeleteObjects func(ctx context.Context, objs []fs.Object) []error, objs []fs.Object) (errs []error) {
+	errs = make([]error, len(objs))
+	trs := make([]*accounting.Transfer, len(objs))
+	var toDelete []fs.Object
+	var toDeleteIndex []int
+	for i, dst := range objs {
+		trs[i] = accounting.Stats(ctx).NewCheckingTransfer(dst, "deleting")
+		errs[i] = accounting.Stats(ctx).DeleteFile(ctx, dst.Size())
+		if errs[i] == nil {
+			toDelete = append(toDelete, dst)
+			toDeleteIndex = append(toDeleteIndex, i)
+		}
+	}
+	if len(toDelete) > 0 {
+		fs.Debugf(nil, "Deleting batch of %d files", len(toDelete))
+		deleteErrs := doDeleteObjects(ctx, toDelete)
+		for j, i := range toDeleteIndex {
+			dst := objs[i]
+			if j < len(deleteErrs) && deleteErrs[j] != nil {
+				fs.Errorf(dst, "Couldn't delete: %v", deleteErrs[j])
+				errs[i] = fs.CountError(deleteErrs[j])
+			} else {
+				fs.Infof(dst, "Deleted")
+			}
+		}
+	}
+	for i := range objs {
+		trs[i].Done(ctx, errs[i])
+	}
+	return errs
+}
+
+// deleteFiles removes all the files passed in the channel with
+// concurrency go routines calling deleteBatch with up to batchSize
+// files at once.
+//
+// deleteBatch should return an error for each file passed in.
+func deleteFiles(ctx context.Context, toBeDeleted fs.ObjectsChan, concurrency int, batchSize int, deleteBatch func(ctx context.Context, objs []fs.Object) []error) error {
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
 	var errorCount atomic.Int32
 	var fatalErrorCount atomic.Int32
 
-	for i := 0; i < ci.Checkers; i++ {
+	for i := 0; i < concurrency; i++ {
 		go func() {
 			defer wg.Done()
+			batch := make([]fs.Object, 0, batchSize)
 			for dst := range toBeDeleted {
-				err := DeleteFileWithBackupDir(ctx, dst, backupDir)
-				if err != nil {
+				batch = append(batch[:0], dst)
+				for len(batch) < batchSize {
+					dst, ok := <-toBeDeleted
+					if !ok {
+						break
+					}
+					batch = append(batch, dst)
+				}
+				errs := deleteBatch(ctx, batch)
+				fatal := false
+				for i, err := range errs {
+					if err == nil {
+						continue
+					}
+					dst := batch[i]
 					errorCount.Add(1)
 					logger, _ := GetLogger(ctx)
 					logger(ctx, TransferError, nil, dst, err)
 					if fserrors.IsFatalError(err) {
 						fs.Errorf(dst, "Got fatal error on delete: %s", err)
 						fatalErrorCount.Add(1)
-						return
+						fatal = true
 					}
 				}
+				if fatal {
+					return
+				}
 			}
 		}()
 	}
@@ -1017,6 +1244,9 @@ func ListDir(ctx context.Context, f fs.Fs, w io.Writer) error {
 
 // Mkdir makes a destination directory or container
 func Mkdir(ctx context.Context, f fs.Fs, dir string) error {
+	if fs.GetConfig(ctx).Queue != "" {
+		return queueOperation(ctx, QueueMkdir, nil, f, dir)
+	}
 	if SkipDestructive(ctx, fs.LogDirName(f, dir), "make directory") {
 		return nil
 	}
@@ -1035,7 +1265,7 @@ func Mkdir(ctx context.Context, f fs.Fs, dir string) error {
 // Mkdir and in this case newDst will be nil.
 func MkdirMetadata(ctx context.Context, f fs.Fs, dir string, metadata fs.Metadata) (newDst fs.Directory, err error) {
 	do := f.Features().MkdirMetadata
-	if do == nil {
+	if do == nil || fs.GetConfig(ctx).Queue != "" {
 		return nil, Mkdir(ctx, f, dir)
 	}
 	logName := fs.LogDirName(f, dir)
@@ -1065,6 +1295,9 @@ func MkdirMetadata(ctx context.Context, f fs.Fs, dir string, metadata fs.Metadat
 // If the directory was created with MkDir then it will attempt to use
 // Fs.DirSetModTime to update the directory modtime if available.
 func MkdirModTime(ctx context.Context, f fs.Fs, dir string, modTime time.Time) (newDst fs.Directory, err error) {
+	if fs.GetConfig(ctx).Queue != "" {
+		return nil, Mkdir(ctx, f, dir)
+	}
 	logName := fs.LogDirName(f, dir)
 	if SkipDestructive(ctx, logName, "make directory") {
 		return nil, nil
@@ -1092,6 +1325,9 @@ func MkdirModTime(ctx context.Context, f fs.Fs, dir string, modTime time.Time) (
 // count errors but may return one.
 func TryRmdir(ctx context.Context, f fs.Fs, dir string) error {
 	accounting.Stats(ctx).DeletedDirs(1)
+	if fs.GetConfig(ctx).Queue != "" {
+		return queueOperation(ctx, QueueRmdir, nil, f, dir)
+	}
 	if SkipDestructive(ctx, fs.LogDirName(f, dir), "remove directory") {
 		return nil
 	}
@@ -1465,7 +1701,7 @@ func Rmdirs(ctx context.Context, f fs.Fs, dir string, leaveRoot bool) error {
 		fs.Debugf(nil, "removing %d level %d directories", len(dirs), level)
 		sort.Strings(dirs)
 		g, gCtx := errgroup.WithContext(ctx)
-		g.SetLimit(ci.Checkers)
+		g.SetLimit(ci.CheckersFor(f))
 		for _, dir := range dirs {
 			// End early if error
 			if gCtx.Err() != nil {
@@ -1633,8 +1869,9 @@ func NeedTransfer(ctx context.Context, dst, src fs.Object) bool {
 		return true
 	}
 	// If we should ignore existing files, don't transfer
-	if ci.IgnoreExisting {
+	if ci.IgnoreExisting || ci.NoUpdateExisting {
 		fs.Debugf(src, "Destination exists, skipping")
+		accounting.Stats(ctx).SkippedExisting(1)
 		logger(ctx, Match, src, dst, nil)
 		return false
 	}
@@ -1646,7 +1883,7 @@ func NeedTransfer(ctx context.Context, dst, src fs.Object) bool {
 	}
 	// If UpdateOlder is in effect, skip if dst is newer than src
 	if ci.UpdateOlder {
-		srcModTime := src.ModTime(ctx)
+		srcModTime := srcModTime(ctx, src)
 		dstModTime := dst.ModTime(ctx)
 		dt := dstModTime.Sub(srcModTime)
 		// If have a mutually agreed precision then use that
@@ -1660,6 +1897,7 @@ func NeedTransfer(ctx context.Context, dst, src fs.Object) bool {
 		switch {
 		case dt >= modifyWindow:
 			fs.Debugf(src, "Destination is newer than source, skipping")
+			accounting.Stats(ctx).Skipped(accounting.SkipNewer, 1)
 			logger(ctx, Match, src, dst, nil)
 			return false
 		case dt <= -modifyWindow:
@@ -1668,6 +1906,7 @@ func NeedTransfer(ctx context.Context, dst, src fs.Object) bool {
 			opt.forceModTimeMatch = true
 			if equal(ctx, src, dst, opt) {
 				fs.Debugf(src, "Unchanged skipping")
+				accounting.Stats(ctx).Skipped(accounting.SkipUnchanged, 1)
 				return false
 			}
 		default:
@@ -1676,6 +1915,7 @@ func NeedTransfer(ctx context.Context, dst, src fs.Object) bool {
 			opt.sizeOnly = !ci.CheckSum
 			if equal(ctx, src, dst, opt) {
 				fs.Debugf(src, "Destination mod time is within %v of source and files identical, skipping", modifyWindow)
+				accounting.Stats(ctx).Skipped(accounting.SkipUnchanged, 1)
 				return false
 			}
 			fs.Debugf(src, "Destination mod time is within %v of source but files differ, transferring", modifyWindow)
@@ -1684,10 +1924,15 @@ func NeedTransfer(ctx context.Context, dst, src fs.Object) bool {
 		// Check to see if changed or not
 		equalFn, ok := ctx.Value(equalFnKey).(EqualFn)
 		if ok {
-			return !equalFn(ctx, src, dst)
+			if equalFn(ctx, src, dst) {
+				accounting.Stats(ctx).Skipped(accounting.SkipUnchanged, 1)
+				return false
+			}
+			return true
 		}
 		if Equal(ctx, src, dst) && !SameObject(src, dst) {
 			fs.Debugf(src, "Unchanged skipping")
+			accounting.Stats(ctx).Skipped(accounting.SkipUnchanged, 1)
 			return false
 		}
 	}
@@ -1844,6 +2089,64 @@ func MoveBackupDir(ctx context.Context, backupDir fs.Fs, dst fs.Object) (err err
 	return err
 }
 
+// QuarantineDir returns the correctly configured --quarantine-dir
+func QuarantineDir(ctx context.Context, fdst fs.Fs, fsrc fs.Fs) (quarantineDir fs.Fs, err error) {
+	ci := fs.GetConfig(ctx)
+	if ci.QuarantineDir == "" {
+		return nil, fserrors.FatalError(errors.New("internal error: QuarantineDir called when --quarantine-dir is empty"))
+	}
+	quarantineDir, err = cache.Get(ctx, ci.QuarantineDir)
+	if err != nil {
+		return nil, fserrors.FatalError(fmt.Errorf("failed to make fs for --quarantine-dir %q: %w", ci.QuarantineDir, err))
+	}
+	if !SameConfig(fdst, quarantineDir) {
+		return nil, fserrors.FatalError(errors.New("parameter to --quarantine-dir has to be on the same remote as destination"))
+	}
+	if OverlappingFilterCheck(ctx, quarantineDir, fdst) {
+		return nil, fserrors.FatalError(errors.New("destination and parameter to --quarantine-dir mustn't overlap"))
+	}
+	if OverlappingFilterCheck(ctx, quarantineDir, fsrc) {
+		return nil, fserrors.FatalError(errors.New("source and parameter to --quarantine-dir mustn't overlap"))
+	}
+	if !CanServerSideMove(quarantineDir) {
+		return nil, fserrors.FatalError(errors.New("can't use --quarantine-dir on a remote which doesn't support server-side move or copy"))
+	}
+	return quarantineDir, nil
+}
+
+// quarantineName returns a name for remote in quarantineDir which
+// isn't in use, adding .1, .2, etc before the extension if needed so
+// files quarantined before aren't overwritten.
+func quarantineName(ctx context.Context, quarantineDir fs.Fs, remote string) string {
+	ext := path.Ext(remote)
+	base := strings.TrimSuffix(remote, ext)
+	name := remote
+	for i := 1; ; i++ {
+		_, err := quarantineDir.NewObject(ctx, name)
+		if err != nil {
+			return name
+		}
+		name = fmt.Sprintf("%s.%d%s", base, i, ext)
+	}
+}
+
+// MoveQuarantineDir moves a file to the quarantine dir logging where
+// it was moved to.
+//
+// It is moved to the same path as in the destination unless that is
+// in use already.
+func MoveQuarantineDir(ctx context.Context, quarantineDir fs.Fs, dst fs.Object) (err error) {
+	name := quarantineName(ctx, quarantineDir, dst.Remote())
+	newDst, err := Move(ctx, quarantineDir, nil, name, dst)
+	if err != nil {
+		return err
+	}
+	if newDst != nil {
+		fs.Logf(dst, "Moved into quarantine dir as %q", name)
+	}
+	return nil
+}
+
 // needsMoveCaseInsensitive returns true if moveCaseInsensitive is needed
 func needsMoveCaseInsensitive(fdst fs.Fs, fsrc fs.Fs, dstFileName string, srcFileName string, cp bool) bool {
 	dstFilePath := path.Join(fdst.Root(), dstFileName)
@@ -1909,6 +2212,10 @@ func moveOrCopyFile(ctx context.Context, fdst fs.Fs, fsrc fs.Fs, dstFileName str
 		return nil
 	}
 
+	if ci.NoUpdateExisting && ci.NoCheckDest {
+		return errors.New("can't use --no-check-dest with --no-update-existing as existing files can't be found")
+	}
+
 	// Choose operations
 	Op := MoveTransfer
 	if cp {
@@ -1992,7 +2299,7 @@ func moveOrCopyFile(ctx context.Context, fdst fs.Fs, fsrc fs.Fs, dstFileName str
 		_, err = Op(ctx, fdst, dstObj, dstFileName, srcObj)
 	} else {
 		if !cp {
-			if ci.IgnoreExisting {
+			if ci.IgnoreExisting || ci.NoUpdateExisting {
 				fs.Debugf(srcObj, "Not removing source file as destination file exists and --ignore-existing is set")
 				logger(ctx, Match, srcObj, dstObj, nil)
 			} else if !SameObject(srcObj, dstObj) {
@@ -2011,19 +2318,64 @@ func MoveFile(ctx context.Context, fdst fs.Fs, fsrc fs.Fs, dstFileName string, s
 	return moveOrCopyFile(ctx, fdst, fsrc, dstFileName, srcFileName, false)
 }
 
+// SetTierOpt controls how SetTierWithOpt changes the tiers
+type SetTierOpt struct {
+	Concurrency int     // number of tier changes to run at once - if <= 0 uses --checkers
+	Rate        float64 // maximum number of tier changes per second - if <= 0 unlimited
+}
+
 // SetTier changes tier of object in remote
 func SetTier(ctx context.Context, fsrc fs.Fs, tier string) error {
-	return ListFn(ctx, fsrc, func(o fs.Object) {
-		objImpl, ok := o.(fs.SetTierer)
-		if !ok {
-			fs.Errorf(fsrc, "Remote object does not implement SetTier")
+	return SetTierWithOpt(ctx, fsrc, tier, SetTierOpt{})
+}
+
+// SetTierWithOpt changes the tier of all the objects in fsrc running
+// opt.Concurrency changes at once, limited to opt.Rate changes per
+// second.
+//
+// Each change is shown in the stats as a check.
+func SetTierWithOpt(ctx context.Context, fsrc fs.Fs, tier string, opt SetTierOpt) error {
+	ci := fs.GetConfig(ctx)
+	concurrency := opt.Concurrency
+	if concurrency <= 0 {
+		concurrency = ci.CheckersFor(fsrc)
+	}
+	var limiter *rate.Limiter
+	if opt.Rate > 0 {
+		limiter = rate.NewLimiter(rate.Limit(opt.Rate), 1)
+	}
+	errCount := errcount.New()
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrency)
+	err := ListFn(ctx, fsrc, func(o fs.Object) {
+		if SkipDestructive(ctx, o, "set tier") {
 			return
 		}
-		err := objImpl.SetTier(tier)
-		if err != nil {
-			fs.Errorf(fsrc, "Failed to do SetTier, %v", err)
-		}
+		g.Go(func() error {
+			if limiter != nil {
+				err := limiter.Wait(gCtx)
+				if err != nil {
+					return err
+				}
+			}
+			tr := accounting.Stats(gCtx).NewCheckingTransfer(o, "setting tier")
+			err := SetTierFile(gCtx, o, tier)
+			if err != nil {
+				err = fs.CountError(err)
+				errCount.Add(err)
+			}
+			tr.Done(gCtx, err)
+			return nil // don't return errors, just count them
+		})
 	})
+	gErr := g.Wait()
+	if err != nil {
+		return err
+	}
+	if gErr != nil {
+		return gErr
+	}
+	return errCount.Err("failed to set tier")
 }
 
 // SetTierFile changes tier of a single file in remote
@@ -2502,6 +2854,9 @@ func SkipDestructive(ctx context.Context, subject interface{}, action string) (s
 	case ci.DryRun:
 		flag = "--dry-run"
 		skip = true
+	case ci.Queue != "":
+		flag = "--queue"
+		skip = true
 	case ci.Interactive:
 		flag = "--interactive"
 		interactiveMu.Lock()
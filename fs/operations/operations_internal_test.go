@@ -4,13 +4,20 @@ package operations
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
 	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fstest/mockfs"
+	"github.com/rclone/rclone/fstest/mockobject"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSizeDiffers(t *testing.T) {
@@ -41,3 +48,87 @@ func TestSizeDiffers(t *testing.T) {
 		assert.Equal(t, test.want, got, fmt.Sprintf("ignoreSize=%v, srcSize=%v, dstSize=%v", test.ignoreSize, test.srcSize, test.dstSize))
 	}
 }
+
+// tierObject is a mock object which records its tier
+type tierObject struct {
+	mockobject.Object
+	mu      *sync.Mutex
+	tiers   map[string]string
+	running *int32
+	maxRun  *int32
+}
+
+// SetTier records the tier for the object
+func (o tierObject) SetTier(tier string) error {
+	n := atomic.AddInt32(o.running, 1)
+	defer atomic.AddInt32(o.running, -1)
+	for {
+		max := atomic.LoadInt32(o.maxRun)
+		if n <= max || atomic.CompareAndSwapInt32(o.maxRun, max, n) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+	if tier == "" {
+		return errors.New("empty tier")
+	}
+	o.mu.Lock()
+	o.tiers[o.Remote()] = tier
+	o.mu.Unlock()
+	return nil
+}
+
+// GetTier returns the tier for the object
+func (o tierObject) GetTier() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.tiers[o.Remote()]
+}
+
+func TestSetTierWithOpt(t *testing.T) {
+	ctx := context.Background()
+	const objects = 100
+	var (
+		mu      sync.Mutex
+		tiers   = map[string]string{}
+		running int32
+		maxRun  int32
+	)
+	f, err := mockfs.NewFs(ctx, "tier", "", nil)
+	require.NoError(t, err)
+	for i := 0; i < objects; i++ {
+		remote := fmt.Sprintf("file%03d", i)
+		tiers[remote] = "STANDARD"
+		f.(*mockfs.Fs).AddObject(tierObject{
+			Object:  mockobject.New(remote),
+			mu:      &mu,
+			tiers:   tiers,
+			running: &running,
+			maxRun:  &maxRun,
+		})
+	}
+
+	err = SetTierWithOpt(ctx, f, "GLACIER", SetTierOpt{Concurrency: 4})
+	require.NoError(t, err)
+	for remote, tier := range tiers {
+		assert.Equal(t, "GLACIER", tier, remote)
+	}
+	assert.LessOrEqual(t, maxRun, int32(4))
+	assert.Greater(t, maxRun, int32(1))
+
+	// Check the rate limit is applied
+	maxRun = 0
+	start := time.Now()
+	err = SetTierWithOpt(ctx, f, "STANDARD", SetTierOpt{Concurrency: 10, Rate: 1000})
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), (objects-1)*time.Millisecond)
+	for remote, tier := range tiers {
+		assert.Equal(t, "STANDARD", tier, remote)
+	}
+
+	// Check errors are returned
+	defer accounting.GlobalStats().ResetErrors()
+	err = SetTierWithOpt(ctx, f, "", SetTierOpt{Concurrency: 10})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to set tier")
+}
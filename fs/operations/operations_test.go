@@ -422,6 +422,37 @@ func TestDelete(t *testing.T) {
 	r.CheckRemoteItems(t, file3)
 }
 
+func TestDeleteFileIfUnchanged(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	ci.DeleteIfUnchanged = true
+	ctx = accounting.WithStatsGroup(ctx, "test-delete-if-unchanged")
+	r := fstest.NewRun(t)
+	r.WriteObject(ctx, "changed", "original contents", t1)
+	r.WriteObject(ctx, "unchanged", "original contents", t1)
+	changed, err := r.Fremote.NewObject(ctx, "changed")
+	require.NoError(t, err)
+	unchanged, err := r.Fremote.NewObject(ctx, "unchanged")
+	require.NoError(t, err)
+
+	// Replace the object after reading it
+	file1 := r.WriteObject(ctx, "changed", "new contents", t2)
+
+	// Only the unchanged object is deleted, and only it is
+	// counted towards the deletes and --max-delete
+	ci.MaxDelete = 1
+	require.NoError(t, operations.DeleteFile(ctx, changed))
+	require.NoError(t, operations.DeleteFile(ctx, unchanged))
+	r.CheckRemoteItems(t, file1)
+	assert.Equal(t, int64(1), accounting.Stats(ctx).GetDeletes())
+
+	// Deleting an object which has gone already isn't an error
+	// and isn't counted
+	ci.MaxDelete = -1
+	require.NoError(t, operations.DeleteFile(ctx, unchanged))
+	assert.Equal(t, int64(1), accounting.Stats(ctx).GetDeletes())
+}
+
 func isChunker(f fs.Fs) bool {
 	return strings.HasPrefix(f.Name(), "TestChunker")
 }
@@ -0,0 +1,281 @@
+// This file implements --queue to record operations for later
+// execution with FlushQueue
+
+package operations
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/lib/random"
+)
+
+// Operations recorded in the --queue
+const (
+	QueueCopy   = "copy"
+	QueueMove   = "move"
+	QueueDelete = "delete"
+	QueueMkdir  = "mkdir"
+	QueueRmdir  = "rmdir"
+)
+
+// QueueEntry is an operation in the --queue
+//
+// Each entry is written as a line of JSON. When FlushQueue has done an
+// operation it appends an entry with the same ID and Done set, so
+// flushing the queue again doesn't repeat it.
+type QueueEntry struct {
+	ID    string `json:"id"`              // unique ID of the operation
+	Time  string `json:"time,omitempty"`  // time the operation was queued in RFC3339 format
+	Op    string `json:"op,omitempty"`    // one of the Queue* operations
+	SrcFs string `json:"srcFs,omitempty"` // source Fs for copy and move
+	Src   string `json:"src,omitempty"`   // source file for copy and move
+	DstFs string `json:"dstFs,omitempty"` // destination Fs
+	Dst   string `json:"dst,omitempty"`   // destination file or directory
+	Done  bool   `json:"done,omitempty"`  // set when the operation with ID is done
+}
+
+// String describes the entry
+func (e *QueueEntry) String() string {
+	if e.SrcFs != "" {
+		return fmt.Sprintf("%s %q in %q to %q in %q", e.Op, e.Src, e.SrcFs, e.Dst, e.DstFs)
+	}
+	return fmt.Sprintf("%s %q in %q", e.Op, e.Dst, e.DstFs)
+}
+
+// queueFile appends entries to a queue
+type queueFile struct {
+	mu  sync.Mutex
+	out *os.File
+}
+
+var (
+	queueFilesMu sync.Mutex
+	queueFiles   = map[string]*queueFile{} // open queues by path
+)
+
+// getQueueFile returns the open queue at path, opening it if necessary
+func getQueueFile(path string) (*queueFile, error) {
+	queueFilesMu.Lock()
+	defer queueFilesMu.Unlock()
+	if q, ok := queueFiles[path]; ok {
+		return q, nil
+	}
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open queue: %w", err)
+	}
+	q := &queueFile{out: out}
+	queueFiles[path] = q
+	return q, nil
+}
+
+// add appends entry to the queue
+func (q *queueFile) add(entry *QueueEntry) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return writeQueueEntry(q.out, entry)
+}
+
+// writeQueueEntry appends entry to the queue in out, syncing it to
+// disk so it isn't lost in a crash
+func writeQueueEntry(out *os.File, entry *QueueEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(append(data, '\n'))
+	if err != nil {
+		return fmt.Errorf("failed to write queue: %w", err)
+	}
+	err = out.Sync()
+	if err != nil {
+		return fmt.Errorf("failed to sync queue: %w", err)
+	}
+	return nil
+}
+
+// fsString returns the config string to recreate f
+func fsString(f fs.Info) string {
+	if do, ok := f.(fs.Fs); ok {
+		return fs.ConfigStringFull(do)
+	}
+	return f.Name() + ":" + f.Root()
+}
+
+// queueOperation adds the operation to the --queue, counting and
+// returning any error.
+//
+// src may be nil for operations which don't have a source.
+func queueOperation(ctx context.Context, op string, src fs.ObjectInfo, fdst fs.Info, dst string) error {
+	ci := fs.GetConfig(ctx)
+	entry := &QueueEntry{
+		ID:    random.String(16),
+		Time:  time.Now().UTC().Format(time.RFC3339Nano),
+		Op:    op,
+		DstFs: fsString(fdst),
+		Dst:   dst,
+	}
+	if src != nil {
+		entry.SrcFs = fsString(src.Fs())
+		entry.Src = src.Remote()
+	}
+	q, err := getQueueFile(ci.Queue)
+	if err == nil {
+		err = q.add(entry)
+	}
+	if err != nil {
+		err = fs.CountError(err)
+		fs.Errorf(nil, "Failed to queue %s: %v", entry, err)
+		return err
+	}
+	fs.Logf(nil, "Queued %s as --queue is set", entry)
+	return nil
+}
+
+// ReadQueue reads the entries from a queue written with --queue.
+//
+// It returns the operations which haven't been done yet in the order
+// they were queued.
+func ReadQueue(in io.Reader) (pending []*QueueEntry, err error) {
+	var entries []*QueueEntry
+	done := map[string]bool{}
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(nil, 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		entry := new(QueueEntry)
+		err = json.Unmarshal(scanner.Bytes(), entry)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: failed to parse queue entry: %w", line, err)
+		}
+		if entry.Done {
+			done[entry.ID] = true
+		} else {
+			entries = append(entries, entry)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read queue: %w", err)
+	}
+	for _, entry := range entries {
+		if !done[entry.ID] {
+			pending = append(pending, entry)
+		}
+	}
+	return pending, nil
+}
+
+// runQueueEntry does the operation in entry
+//
+// The operations are idempotent so it is safe to run an entry which
+// was done but not marked as done.
+func runQueueEntry(ctx context.Context, entry *QueueEntry) error {
+	fdst, err := cache.Get(ctx, entry.DstFs)
+	if err != nil {
+		return err
+	}
+	var fsrc fs.Fs
+	if entry.Op == QueueCopy || entry.Op == QueueMove {
+		fsrc, err = cache.Get(ctx, entry.SrcFs)
+		if err != nil {
+			return err
+		}
+	}
+	switch entry.Op {
+	case QueueCopy:
+		return CopyFile(ctx, fdst, fsrc, entry.Dst, entry.Src)
+	case QueueMove:
+		_, err = fsrc.NewObject(ctx, entry.Src)
+		if errors.Is(err, fs.ErrorObjectNotFound) {
+			// Already moved if the destination exists
+			_, dstErr := fdst.NewObject(ctx, entry.Dst)
+			if dstErr == nil {
+				return nil
+			}
+		}
+		if err != nil {
+			return err
+		}
+		return MoveFile(ctx, fdst, fsrc, entry.Dst, entry.Src)
+	case QueueDelete:
+		o, err := fdst.NewObject(ctx, entry.Dst)
+		if errors.Is(err, fs.ErrorObjectNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return DeleteFile(ctx, o)
+	case QueueMkdir:
+		return Mkdir(ctx, fdst, entry.Dst)
+	case QueueRmdir:
+		err = TryRmdir(ctx, fdst, entry.Dst)
+		if errors.Is(err, fs.ErrorDirNotFound) {
+			return nil
+		}
+		return err
+	}
+	return fmt.Errorf("unknown queue operation %q", entry.Op)
+}
+
+// FlushQueue does the operations in the queue at path written with
+// --queue, marking each as done in the queue when it succeeds.
+//
+// Operations which fail are left in the queue to be retried the next
+// time it is flushed. It returns the number of operations done and an
+// error if any failed.
+func FlushQueue(ctx context.Context, path string) (done int, err error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	pending, err := ReadQueue(in)
+	_ = in.Close()
+	if err != nil {
+		return 0, err
+	}
+	// Run the operations rather than queueing them again
+	ctx, ci := fs.AddConfig(ctx)
+	ci.Queue = ""
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer fs.CheckClose(out, &err)
+	failed := 0
+	for _, entry := range pending {
+		if ci.DryRun {
+			fs.Logf(nil, "Skipped %s as --dry-run is set", entry)
+			continue
+		}
+		err = runQueueEntry(ctx, entry)
+		if err != nil {
+			failed++
+			fs.Errorf(nil, "Failed to %s: %v", entry, err)
+			continue
+		}
+		err = writeQueueEntry(out, &QueueEntry{ID: entry.ID, Done: true})
+		if err != nil {
+			return done, fmt.Errorf("failed to mark queue entry done: %w", err)
+		}
+		done++
+	}
+	if failed > 0 {
+		return done, fmt.Errorf("%d queued operations failed", failed)
+	}
+	return done, nil
+}
@@ -0,0 +1,110 @@
+package operations_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueue(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	file1 := r.WriteFile("file1", "copy me", t1)
+	file2 := r.WriteFile("file2", "move me", t1)
+	file3 := r.WriteObject(ctx, "file3", "delete me", t2)
+	r.CheckRemoteItems(t, file3)
+
+	queue := filepath.Join(t.TempDir(), "queue.json")
+	ci.Queue = queue
+	readPending := func() (ops []string) {
+		in, err := os.Open(queue)
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, in.Close())
+		}()
+		pending, err := operations.ReadQueue(in)
+		require.NoError(t, err)
+		for _, entry := range pending {
+			ops = append(ops, entry.Op+" "+entry.Dst)
+		}
+		return ops
+	}
+
+	// Queue some operations
+	src1, err := r.Flocal.NewObject(ctx, "file1")
+	require.NoError(t, err)
+	_, err = operations.Copy(ctx, r.Fremote, nil, "file1", src1)
+	require.NoError(t, err)
+	src2, err := r.Flocal.NewObject(ctx, "file2")
+	require.NoError(t, err)
+	_, err = operations.Move(ctx, r.Fremote, nil, "file2", src2)
+	require.NoError(t, err)
+	dst3, err := r.Fremote.NewObject(ctx, "file3")
+	require.NoError(t, err)
+	require.NoError(t, operations.DeleteFile(ctx, dst3))
+	require.NoError(t, operations.Mkdir(ctx, r.Fremote, "dir"))
+	require.NoError(t, operations.Rmdir(ctx, r.Fremote, "dir"))
+
+	// Check nothing was done and all were queued
+	r.CheckLocalItems(t, file1, file2)
+	r.CheckRemoteItems(t, file3)
+	want := []string{"copy file1", "move file2", "delete file3", "mkdir dir", "rmdir dir"}
+	assert.Equal(t, want, readPending())
+
+	// Flush the queue
+	ci.Queue = ""
+	done, err := operations.FlushQueue(ctx, queue)
+	require.NoError(t, err)
+	assert.Equal(t, 5, done)
+	r.CheckLocalItems(t, file1)
+	r.CheckRemoteItems(t, file1, file2)
+	assert.Equal(t, []string(nil), readPending())
+
+	// Replaying operations which were done but not marked as done
+	// is safe
+	data, err := os.ReadFile(queue)
+	require.NoError(t, err)
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if !strings.Contains(line, `"done":true`) {
+			lines = append(lines, line)
+		}
+	}
+	require.NoError(t, os.WriteFile(queue, []byte(strings.Join(lines, "\n")+"\n"), 0600))
+	assert.Equal(t, want, readPending())
+	done, err = operations.FlushQueue(ctx, queue)
+	require.NoError(t, err)
+	assert.Equal(t, 5, done)
+	r.CheckLocalItems(t, file1)
+	r.CheckRemoteItems(t, file1, file2)
+
+	// Operations which fail are left in the queue
+	ci.Queue = queue
+	src4 := r.WriteFile("file4", "vanishes", t1)
+	obj4, err := r.Flocal.NewObject(ctx, src4.Path)
+	require.NoError(t, err)
+	_, err = operations.Copy(ctx, r.Fremote, nil, "file4", obj4)
+	require.NoError(t, err)
+	require.NoError(t, obj4.Remove(ctx))
+	ci.Queue = ""
+	done, err = operations.FlushQueue(ctx, queue)
+	assert.ErrorContains(t, err, "1 queued operations failed")
+	assert.Equal(t, 0, done)
+	assert.Equal(t, []string{"copy file4"}, readPending())
+
+	// Check --dry-run doesn't do or mark anything
+	ci.DryRun = true
+	done, err = operations.FlushQueue(ctx, queue)
+	require.NoError(t, err)
+	assert.Equal(t, 0, done)
+	assert.Equal(t, []string{"copy file4"}, readPending())
+}
@@ -0,0 +1,118 @@
+// swap - exchanges the contents of two objects
+
+package operations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/lib/random"
+)
+
+// swapVerify checks dst is a faithful copy of src by size and hash
+// if available
+func swapVerify(ctx context.Context, src fs.ObjectInfo, dst fs.Object) error {
+	if src.Size() >= 0 && dst.Size() >= 0 && src.Size() != dst.Size() {
+		return fmt.Errorf("verify failed: size of %q is %d but should be %d", dst.Remote(), dst.Size(), src.Size())
+	}
+	equal, ht, err := CheckHashes(ctx, src, dst)
+	if err != nil {
+		return fmt.Errorf("verify failed: %w", err)
+	}
+	if !equal {
+		return fmt.Errorf("verify failed: %v hash of %q differs from %q", ht, dst.Remote(), src.Remote())
+	}
+	if ht == hash.None {
+		fs.Debugf(dst, "Verified by size only as no common hash")
+	}
+	return nil
+}
+
+// swapCopy copies src over dst, or to remote in f if dst is nil, and
+// verifies the result
+func swapCopy(ctx context.Context, f fs.Fs, dst fs.Object, remote string, src fs.Object) (fs.Object, error) {
+	newDst, err := Copy(ctx, f, dst, remote, src)
+	if err != nil {
+		return nil, err
+	}
+	if newDst == nil {
+		return nil, fmt.Errorf("copy of %q to %q returned no object", src.Remote(), remote)
+	}
+	err = swapVerify(ctx, src, newDst)
+	if err != nil {
+		return nil, err
+	}
+	return newDst, nil
+}
+
+// Swap exchanges the contents of the object a in fa with the object b
+// in fb. It can be used to promote a staged object to a live one
+// while keeping the old live object in the staging location.
+//
+// Neither a nor b is removed at any point. First a is copied to a
+// temporary object next to it, then b is copied over a and the
+// temporary object is copied over b, verifying each copy before the
+// next step. Finally the temporary object is deleted.
+//
+// Whether readers can see a partially written object while it is
+// being overwritten depends on whether the backend replaces objects
+// atomically.
+//
+// If the swap fails after a has been overwritten then the temporary
+// object is kept so the original contents of a can be recovered and
+// the error says where it is.
+func Swap(ctx context.Context, fa fs.Fs, a string, fb fs.Fs, b string) (err error) {
+	objA, err := fa.NewObject(ctx, a)
+	if err != nil {
+		return fmt.Errorf("swap: failed to find %q: %w", a, err)
+	}
+	objB, err := fb.NewObject(ctx, b)
+	if err != nil {
+		return fmt.Errorf("swap: failed to find %q: %w", b, err)
+	}
+	if SameObject(objA, objB) {
+		return errors.New("swap: can't swap an object with itself")
+	}
+	if SkipDestructive(ctx, objA, fmt.Sprintf("swap with %s", fs.LogDirName(fb, b))) {
+		return nil
+	}
+	// Don't ask again about each step if --interactive
+	ctx, ci := fs.AddConfig(ctx)
+	ci.Interactive = false
+
+	// Keep a copy of a
+	tmpName := a + ".rclone-swap-" + random.String(8)
+	tmp, err := swapCopy(ctx, fa, nil, tmpName, objA)
+	if err != nil {
+		return fmt.Errorf("swap: failed to copy %q to temporary object: %w", a, err)
+	}
+	removeTmp := func() {
+		if rmErr := DeleteFile(ctx, tmp); rmErr != nil {
+			fs.Errorf(tmp, "Failed to remove temporary object: %v", rmErr)
+		}
+	}
+
+	// Overwrite a with b
+	_, err = swapCopy(ctx, fa, objA, a, objB)
+	if err != nil {
+		// a may be damaged so only remove tmp if a is still intact
+		if newA, findErr := fa.NewObject(ctx, a); findErr == nil && swapVerify(ctx, tmp, newA) == nil {
+			removeTmp()
+			return fmt.Errorf("swap: failed to copy %q to %q: %w", b, a, err)
+		}
+		return fmt.Errorf("swap: failed to copy %q to %q, original contents of %q kept in %q: %w", b, a, a, tmpName, err)
+	}
+
+	// Overwrite b with the original a
+	_, err = swapCopy(ctx, fb, objB, b, tmp)
+	if err != nil {
+		return fmt.Errorf("swap: failed to copy %q to %q, original contents of %q kept in %q: %w", a, b, a, tmpName, err)
+	}
+
+	removeTmp()
+	fs.Infof(objA, "Swapped with %s", fs.LogDirName(fb, b))
+	return nil
+}
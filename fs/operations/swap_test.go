@@ -0,0 +1,50 @@
+package operations_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSwap(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	live := r.WriteObject(ctx, "live", "live contents", t1)
+	staged := r.WriteObject(ctx, "staging/live", "new staged contents", t2)
+	local := r.WriteFile("local", "local contents", t1)
+
+	// Check --dry-run does nothing
+	ci.DryRun = true
+	require.NoError(t, operations.Swap(ctx, r.Fremote, "live", r.Fremote, "staging/live"))
+	r.CheckRemoteItems(t, live, staged)
+	ci.DryRun = false
+
+	// Swap within the same remote
+	require.NoError(t, operations.Swap(ctx, r.Fremote, "live", r.Fremote, "staging/live"))
+	live = fstest.NewItem("live", "new staged contents", t2)
+	staged = fstest.NewItem("staging/live", "live contents", t1)
+	r.CheckRemoteItems(t, live, staged)
+
+	// Swap between remotes
+	require.NoError(t, operations.Swap(ctx, r.Flocal, "local", r.Fremote, "live"))
+	r.CheckLocalItems(t, fstest.NewItem("local", "new staged contents", t2))
+	r.CheckRemoteItems(t, fstest.NewItem("live", "local contents", t1), staged)
+
+	// Swapping back restores the originals
+	require.NoError(t, operations.Swap(ctx, r.Flocal, "local", r.Fremote, "live"))
+	r.CheckLocalItems(t, local)
+	r.CheckRemoteItems(t, live, staged)
+
+	// Errors
+	err := operations.Swap(ctx, r.Fremote, "live", r.Fremote, "missing")
+	assert.ErrorContains(t, err, `failed to find "missing"`)
+	err = operations.Swap(ctx, r.Fremote, "live", r.Fremote, "live")
+	assert.ErrorContains(t, err, "can't swap an object with itself")
+	r.CheckRemoteItems(t, live, staged)
+}
@@ -0,0 +1,231 @@
+// This file implements the --verify-log tamper evident transfer log
+
+package operations
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/hash"
+)
+
+// VerifyLogEntry is an entry in the --verify-log
+//
+// Each entry is written as a line of JSON. MAC is the HMAC-SHA256 of
+// the entry encoded as JSON without the MAC, which includes Prev, the
+// MAC of the previous entry, chaining the entries together.
+type VerifyLogEntry struct {
+	Time   string            `json:"time"`             // time of the transfer in RFC3339 format
+	Action string            `json:"action"`           // "copy" or "move"
+	Src    string            `json:"src"`              // source of the transfer
+	Dst    string            `json:"dst"`              // destination of the transfer
+	Size   int64             `json:"size"`             // size of the destination
+	Hashes map[string]string `json:"hashes,omitempty"` // hashes of the destination if known
+	Prev   string            `json:"prev"`             // MAC of the previous entry or "" for the first
+	MAC    string            `json:"mac,omitempty"`    // MAC of this entry
+}
+
+// sign returns the MAC for the entry
+func (e VerifyLogEntry) sign(key string) (string, error) {
+	e.MAC = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	_, _ = mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// verifyLog appends entries to a verification log
+type verifyLog struct {
+	mu   sync.Mutex
+	out  *os.File
+	key  string
+	last string // MAC of the last entry written
+}
+
+var (
+	verifyLogsMu sync.Mutex
+	verifyLogs   = map[string]*verifyLog{} // open verify logs by path
+)
+
+// getVerifyLog returns the open verify log for the config, opening
+// it if necessary, or nil if --verify-log isn't in use
+func getVerifyLog(ci *fs.ConfigInfo) (*verifyLog, error) {
+	if ci.VerifyLog == "" {
+		return nil, nil
+	}
+	if ci.VerifyLogKey == "" {
+		return nil, errors.New("--verify-log-key must be set to use --verify-log")
+	}
+	verifyLogsMu.Lock()
+	defer verifyLogsMu.Unlock()
+	if vl, ok := verifyLogs[ci.VerifyLog]; ok {
+		return vl, nil
+	}
+	vl, err := openVerifyLog(ci.VerifyLog, ci.VerifyLogKey)
+	if err != nil {
+		return nil, err
+	}
+	verifyLogs[ci.VerifyLog] = vl
+	return vl, nil
+}
+
+// openVerifyLog opens the verify log at path for appending, reading
+// the MAC of the last entry so new entries chain to it.
+func openVerifyLog(path, key string) (*verifyLog, error) {
+	out, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open verify log: %w", err)
+	}
+	vl := &verifyLog{
+		out: out,
+		key: key,
+	}
+	scanner := bufio.NewScanner(out)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry VerifyLogEntry
+		err = json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			_ = out.Close()
+			return nil, fmt.Errorf("failed to read verify log %q: %w", path, err)
+		}
+		vl.last = entry.MAC
+	}
+	if err = scanner.Err(); err != nil {
+		_ = out.Close()
+		return nil, fmt.Errorf("failed to read verify log %q: %w", path, err)
+	}
+	return vl, nil
+}
+
+// add signs entry, chains it to the previous entry and appends it to
+// the log, syncing it to disk so it isn't lost in a crash
+func (vl *verifyLog) add(entry VerifyLogEntry) (err error) {
+	vl.mu.Lock()
+	defer vl.mu.Unlock()
+	entry.Prev = vl.last
+	entry.MAC, err = entry.sign(vl.key)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = vl.out.Write(append(data, '\n'))
+	if err != nil {
+		return fmt.Errorf("failed to write verify log: %w", err)
+	}
+	vl.last = entry.MAC
+	err = vl.out.Sync()
+	if err != nil {
+		return fmt.Errorf("failed to sync verify log: %w", err)
+	}
+	return nil
+}
+
+// verifyLogPath returns the path of o including its remote
+func verifyLogPath(o fs.Object) string {
+	f, ok := o.Fs().(fs.Fs)
+	if !ok {
+		return o.Remote()
+	}
+	return fspath.JoinRootPath(fs.ConfigString(f), o.Remote())
+}
+
+// logVerified adds an entry to the --verify-log if in use for the
+// successful transfer of src to dst.
+//
+// Failing to write the log is reported as an error but doesn't fail
+// the transfer.
+func logVerified(ctx context.Context, action string, src fs.Object, dst fs.Object, hashType hash.Type) {
+	ci := fs.GetConfig(ctx)
+	vl, err := getVerifyLog(ci)
+	if vl == nil && err == nil {
+		return
+	}
+	if err == nil && dst == nil {
+		err = errors.New("destination unknown")
+	}
+	if err == nil {
+		entry := VerifyLogEntry{
+			Time:   time.Now().UTC().Format(time.RFC3339Nano),
+			Action: action,
+			Src:    verifyLogPath(src),
+			Dst:    verifyLogPath(dst),
+			Size:   dst.Size(),
+		}
+		if hashType != hash.None {
+			if sum, hashErr := dst.Hash(ctx, hashType); hashErr == nil && sum != "" {
+				entry.Hashes = map[string]string{hashType.String(): sum}
+			}
+		}
+		err = vl.add(entry)
+	}
+	if err != nil {
+		err = fs.CountError(err)
+		fs.Errorf(src, "Failed to add to verify log: %v", err)
+	}
+}
+
+// CheckVerifyLog reads a verify log written with --verify-log from
+// in and checks the MAC of every entry and that the entries are
+// chained together, using key which must be the --verify-log-key the
+// log was written with.
+//
+// It returns the number of entries checked and an error indicating
+// the first entry which failed to verify, if any.
+func CheckVerifyLog(in io.Reader, key string) (entries int, err error) {
+	if key == "" {
+		return 0, errors.New("--verify-log-key must be set to check a verify log")
+	}
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(nil, 1024*1024)
+	prev := ""
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry VerifyLogEntry
+		err = json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			return entries, fmt.Errorf("line %d: failed to parse entry: %w", line, err)
+		}
+		mac, err := entry.sign(key)
+		if err != nil {
+			return entries, fmt.Errorf("line %d: %w", line, err)
+		}
+		if !hmac.Equal([]byte(mac), []byte(entry.MAC)) {
+			return entries, fmt.Errorf("line %d: entry for %q has been modified or the key is wrong", line, entry.Dst)
+		}
+		if entry.Prev != prev {
+			return entries, fmt.Errorf("line %d: entry for %q doesn't follow the previous entry - entries have been removed or reordered", line, entry.Dst)
+		}
+		prev = entry.MAC
+		entries++
+	}
+	if err = scanner.Err(); err != nil {
+		return entries, fmt.Errorf("failed to read verify log: %w", err)
+	}
+	return entries, nil
+}
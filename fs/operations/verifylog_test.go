@@ -0,0 +1,121 @@
+package operations_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyLog(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	for _, name := range []string{"file1", "file2", "file3"} {
+		r.WriteFile(name, "hello "+name, t1)
+	}
+	copyFile := func(name string) {
+		src, err := r.Flocal.NewObject(ctx, name)
+		require.NoError(t, err)
+		_, err = operations.Copy(ctx, r.Fremote, nil, name, src)
+		require.NoError(t, err)
+	}
+	readLines := func(path string) []string {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+	check := func(lines []string, key string) (int, error) {
+		return operations.CheckVerifyLog(strings.NewReader(strings.Join(lines, "\n")+"\n"), key)
+	}
+
+	dir := t.TempDir()
+	ci.VerifyLog = filepath.Join(dir, "first.log")
+	ci.VerifyLogKey = "secret"
+	copyFile("file1")
+	copyFile("file2")
+
+	lines := readLines(ci.VerifyLog)
+	require.Equal(t, 2, len(lines))
+	entries, err := check(lines, "secret")
+	require.NoError(t, err)
+	assert.Equal(t, 2, entries)
+
+	var entry operations.VerifyLogEntry
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, "copy", entry.Action)
+	assert.True(t, strings.HasSuffix(entry.Src, "/file1"), entry.Src)
+	assert.True(t, strings.HasSuffix(entry.Dst, "/file1"), entry.Dst)
+	assert.Equal(t, int64(len("hello file1")), entry.Size)
+	assert.Equal(t, "", entry.Prev)
+	assert.NotEqual(t, "", entry.MAC)
+
+	// Check a new run chains onto the existing entries
+	data, err := os.ReadFile(ci.VerifyLog)
+	require.NoError(t, err)
+	ci.VerifyLog = filepath.Join(dir, "second.log")
+	require.NoError(t, os.WriteFile(ci.VerifyLog, data, 0600))
+	copyFile("file3")
+	lines = readLines(ci.VerifyLog)
+	require.Equal(t, 3, len(lines))
+	entries, err = check(lines, "secret")
+	require.NoError(t, err)
+	assert.Equal(t, 3, entries)
+
+	// Check tampering is detected
+	for _, test := range []struct {
+		name    string
+		key     string
+		lines   []string
+		wantErr string
+	}{
+		{
+			name:    "wrong key",
+			key:     "potato",
+			lines:   lines,
+			wantErr: "line 1: ",
+		}, {
+			name:    "modified",
+			key:     "secret",
+			lines:   []string{lines[0], strings.Replace(lines[1], `"size":11`, `"size":12`, 1), lines[2]},
+			wantErr: "line 2: entry for",
+		}, {
+			name:    "removed",
+			key:     "secret",
+			lines:   []string{lines[0], lines[2]},
+			wantErr: "line 2: entry for",
+		}, {
+			name:    "reordered",
+			key:     "secret",
+			lines:   []string{lines[1], lines[0], lines[2]},
+			wantErr: "line 1: entry for",
+		}, {
+			name:    "corrupted",
+			key:     "secret",
+			lines:   []string{lines[0], lines[1][1:], lines[2]},
+			wantErr: "line 2: failed to parse",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := check(test.lines, test.key)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.wantErr)
+		})
+	}
+
+	// Check there is nothing written without --verify-log
+	ci.VerifyLog = ""
+	copyFile("file1")
+	after, err := os.ReadFile(filepath.Join(dir, "second.log"))
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(after, []byte(strings.Join(lines, "\n")+"\n")))
+}
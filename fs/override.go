@@ -1,12 +1,17 @@
 package fs
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // OverrideRemote is a wrapper to override the Remote for an
 // ObjectInfo
 type OverrideRemote struct {
 	ObjectInfo
-	remote string
+	remote   string
+	mimeType string
+	modTime  time.Time
 }
 
 // NewOverrideRemote returns an OverrideRemoteObject which will
@@ -17,6 +22,8 @@ func NewOverrideRemote(oi ObjectInfo, remote string) *OverrideRemote {
 		return &OverrideRemote{
 			ObjectInfo: or.ObjectInfo,
 			remote:     remote,
+			mimeType:   or.mimeType,
+			modTime:    or.modTime,
 		}
 	}
 	return &OverrideRemote{
@@ -25,6 +32,22 @@ func NewOverrideRemote(oi ObjectInfo, remote string) *OverrideRemote {
 	}
 }
 
+// NewOverrideMimeType returns an OverrideRemote which will return the
+// mime type specified
+func NewOverrideMimeType(oi ObjectInfo, mimeType string) *OverrideRemote {
+	or := NewOverrideRemote(oi, oi.Remote())
+	or.mimeType = mimeType
+	return or
+}
+
+// NewOverrideModTime returns an OverrideRemote which will return the
+// modification time specified
+func NewOverrideModTime(oi ObjectInfo, modTime time.Time) *OverrideRemote {
+	or := NewOverrideRemote(oi, oi.Remote())
+	or.modTime = modTime
+	return or
+}
+
 // Remote returns the overridden remote name
 func (o *OverrideRemote) Remote() string {
 	return o.remote
@@ -35,9 +58,21 @@ func (o *OverrideRemote) String() string {
 	return o.remote
 }
 
-// MimeType returns the mime type of the underlying object or "" if it
-// can't be worked out
+// ModTime returns the overridden modification time if set, otherwise
+// the modification time of the underlying object
+func (o *OverrideRemote) ModTime(ctx context.Context) time.Time {
+	if !o.modTime.IsZero() {
+		return o.modTime
+	}
+	return o.ObjectInfo.ModTime(ctx)
+}
+
+// MimeType returns the overridden mime type if set, otherwise the
+// mime type of the underlying object or "" if it can't be worked out
 func (o *OverrideRemote) MimeType(ctx context.Context) string {
+	if o.mimeType != "" {
+		return o.mimeType
+	}
 	if do, ok := o.ObjectInfo.(MimeTyper); ok {
 		return do.MimeType(ctx)
 	}
@@ -74,7 +109,18 @@ func (o *OverrideRemote) GetTier() string {
 // It should return nil if there is no Metadata
 func (o *OverrideRemote) Metadata(ctx context.Context) (Metadata, error) {
 	if do, ok := o.ObjectInfo.(Metadataer); ok {
-		return do.Metadata(ctx)
+		metadata, err := do.Metadata(ctx)
+		if err != nil || o.modTime.IsZero() || metadata == nil {
+			return metadata, err
+		}
+		// Make sure the mtime in the metadata matches ModTime
+		if _, found := metadata["mtime"]; found {
+			newMetadata := make(Metadata, len(metadata))
+			newMetadata.Merge(metadata)
+			newMetadata["mtime"] = o.modTime.Format(time.RFC3339Nano)
+			metadata = newMetadata
+		}
+		return metadata, nil
 	}
 	return nil, nil
 }
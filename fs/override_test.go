@@ -1,4 +1,52 @@
 package fs
 
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
 // Check all optional interfaces satisfied
 var _ FullObjectInfo = (*OverrideRemote)(nil)
+
+// metadataInfo is an ObjectInfo with Metadata for testing
+type metadataInfo struct {
+	ObjectInfo
+	modTime  time.Time
+	metadata Metadata
+}
+
+func (o metadataInfo) Remote() string                                 { return "remote" }
+func (o metadataInfo) ModTime(ctx context.Context) time.Time          { return o.modTime }
+func (o metadataInfo) Metadata(ctx context.Context) (Metadata, error) { return o.metadata, nil }
+
+func TestOverrideModTime(t *testing.T) {
+	ctx := context.Background()
+	t1 := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	t2 := time.Date(2011, 12, 25, 12, 59, 59, 0, time.UTC)
+	src := metadataInfo{
+		modTime:  t1,
+		metadata: Metadata{"mtime": t1.Format(time.RFC3339Nano), "mode": "644"},
+	}
+
+	// Not overridden
+	or := NewOverrideRemote(src, "new remote")
+	assert.Equal(t, t1, or.ModTime(ctx))
+
+	// Overridden
+	or = NewOverrideModTime(src, t2)
+	assert.Equal(t, "remote", or.Remote())
+	assert.Equal(t, t2, or.ModTime(ctx))
+	metadata, err := or.Metadata(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Metadata{"mtime": t2.Format(time.RFC3339Nano), "mode": "644"}, metadata)
+	assert.Equal(t, t1.Format(time.RFC3339Nano), src.metadata["mtime"], "source metadata changed")
+
+	// Kept when re-wrapped
+	or = NewOverrideRemote(or, "new remote")
+	assert.Equal(t, "new remote", or.Remote())
+	assert.Equal(t, t2, or.ModTime(ctx))
+}
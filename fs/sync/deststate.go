@@ -0,0 +1,420 @@
+// This file implements --dest-state
+
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/dirtree"
+	"github.com/rclone/rclone/fs/hash"
+)
+
+// destStateVersion is the version of the --dest-state file format
+const destStateVersion = 1
+
+// destStateFile is the format of the --dest-state file
+type destStateFile struct {
+	Version  int              `json:"version"`
+	Remote   string           `json:"remote"`             // the destination this is the state of
+	HashType string           `json:"hashType,omitempty"` // type of the hashes stored if any
+	Objects  []destStateEntry `json:"objects"`
+}
+
+// destStateEntry is an object in the --dest-state file
+type destStateEntry struct {
+	Remote  string    `json:"remote"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	Hash    string    `json:"hash,omitempty"`
+}
+
+// destState records the contents of the destination so it doesn't
+// need to be listed each sync.
+type destState struct {
+	path     string    // file to read and write the state
+	fdst     fs.Fs     // the destination
+	hashType hash.Type // hash to record or hash.None
+	mu       sync.Mutex
+	objects  map[string]fs.Object // what is on the destination now
+	tree     dirtree.DirTree      // listing read from the state or nil to list the destination
+}
+
+// newDestState reads the state of fdst from path.
+//
+// If the state can't be used then the destination will be listed as
+// normal and the state rewritten from that at the end of the sync.
+// Setting refresh does this unconditionally.
+func newDestState(ctx context.Context, fdst fs.Fs, path string, hashType hash.Type, refresh bool) (*destState, error) {
+	ds := &destState{
+		path:     path,
+		fdst:     fdst,
+		hashType: hashType,
+		objects:  make(map[string]fs.Object),
+	}
+	if refresh {
+		fs.Infof(fdst, "Listing the destination to refresh the destination state %q", path)
+		return ds, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		fs.Infof(fdst, "Destination state %q not found - listing the destination", path)
+		return ds, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read destination state: %w", err)
+	}
+	var state destStateFile
+	err = json.Unmarshal(data, &state)
+	switch {
+	case err != nil:
+		fs.Errorf(fdst, "Destination state %q is corrupt - listing the destination: %v", path, err)
+		return ds, nil
+	case state.Version != destStateVersion:
+		fs.Logf(fdst, "Destination state %q has unknown version %d - listing the destination", path, state.Version)
+		return ds, nil
+	case state.Remote != fs.ConfigString(fdst):
+		fs.Logf(fdst, "Destination state %q is for %q not this destination - listing the destination", path, state.Remote)
+		return ds, nil
+	}
+	// Only use the hashes if they are the ones we are using
+	useHashes := hashType != hash.None && state.HashType == hashType.String()
+	ds.tree = dirtree.New()
+	for _, entry := range state.Objects {
+		o := &destStateObject{
+			state:   ds,
+			remote:  entry.Remote,
+			size:    entry.Size,
+			modTime: entry.ModTime,
+		}
+		if useHashes {
+			o.hash = entry.Hash
+		}
+		ds.objects[o.remote] = o
+		ds.tree.Add(o)
+	}
+	ds.tree.CheckParents("")
+	fs.Infof(fdst, "Using destination state %q with %d objects instead of listing the destination", path, len(state.Objects))
+	return ds, nil
+}
+
+// lister returns an Fs to list the destination with or nil if the
+// destination should be listed as normal.
+func (ds *destState) lister() fs.Fs {
+	if ds.tree == nil {
+		return nil
+	}
+	features := *ds.fdst.Features()
+	// Make sure the listing is done with List
+	features.ListR = nil
+	return &destStateFs{
+		Fs:       ds.fdst,
+		state:    ds,
+		features: &features,
+	}
+}
+
+// set records o as being on the destination
+func (ds *destState) set(o fs.Object) {
+	ds.mu.Lock()
+	ds.objects[o.Remote()] = o
+	ds.mu.Unlock()
+}
+
+// remove records remote as no longer being on the destination
+func (ds *destState) remove(remote string) {
+	ds.mu.Lock()
+	delete(ds.objects, remote)
+	ds.mu.Unlock()
+}
+
+// entry returns the state file entry for o
+func (ds *destState) entry(ctx context.Context, o fs.Object) destStateEntry {
+	if so, ok := o.(*destStateObject); ok {
+		if obj := so.resolved(); obj != nil {
+			o = obj
+		} else {
+			// Don't look the object up just to save it
+			return destStateEntry{
+				Remote:  so.remote,
+				Size:    so.size,
+				ModTime: so.modTime,
+				Hash:    so.hash,
+			}
+		}
+	}
+	entry := destStateEntry{
+		Remote:  o.Remote(),
+		Size:    o.Size(),
+		ModTime: o.ModTime(ctx),
+	}
+	if ds.hashType != hash.None {
+		hashValue, err := o.Hash(ctx, ds.hashType)
+		if err != nil {
+			fs.Debugf(o, "Not saving hash in destination state: %v", err)
+		} else {
+			entry.Hash = hashValue
+		}
+	}
+	return entry
+}
+
+// save writes the state to the state file
+func (ds *destState) save(ctx context.Context) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	state := destStateFile{
+		Version: destStateVersion,
+		Remote:  fs.ConfigString(ds.fdst),
+		Objects: make([]destStateEntry, 0, len(ds.objects)),
+	}
+	if ds.hashType != hash.None {
+		state.HashType = ds.hashType.String()
+	}
+	for _, o := range ds.objects {
+		state.Objects = append(state.Objects, ds.entry(ctx, o))
+	}
+	sort.Slice(state.Objects, func(i, j int) bool {
+		return state.Objects[i].Remote < state.Objects[j].Remote
+	})
+	data, err := json.Marshal(&state)
+	if err != nil {
+		return fmt.Errorf("failed to encode destination state: %w", err)
+	}
+	// Write to a temporary file and rename so the state is never
+	// left half written
+	tmpPath := ds.path + ".tmp"
+	err = os.WriteFile(tmpPath, data, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write destination state: %w", err)
+	}
+	err = os.Rename(tmpPath, ds.path)
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to write destination state: %w", err)
+	}
+	fs.Infof(ds.fdst, "Saved destination state %q with %d objects", ds.path, len(state.Objects))
+	return nil
+}
+
+// discard removes the state file so the next sync lists the
+// destination. This is used when the sync didn't complete so the
+// state can't be trusted.
+func (ds *destState) discard() {
+	err := os.Remove(ds.path)
+	if err == nil {
+		fs.Logf(ds.fdst, "Removed destination state %q as the sync had errors - the destination will be listed next time", ds.path)
+	} else if !os.IsNotExist(err) {
+		fs.Errorf(ds.fdst, "Failed to remove destination state %q: %v", ds.path, err)
+	}
+}
+
+// destStateRealObject returns the object on the destination that o
+// refers to if it was read from the state, so it can be used where a
+// backend needs its own objects, e.g. as the source of a server-side
+// move.
+//
+// It returns nil if the object is no longer on the destination.
+func destStateRealObject(ctx context.Context, o fs.Object) fs.Object {
+	so, ok := o.(*destStateObject)
+	if !ok {
+		return o
+	}
+	obj, err := so.resolve(ctx)
+	if errors.Is(err, fs.ErrorObjectNotFound) {
+		fs.Debugf(o, "Object in destination state is no longer on the destination")
+		return nil
+	} else if err != nil {
+		fs.Debugf(o, "Failed to find object in destination state: %v", err)
+		return o
+	}
+	return obj
+}
+
+// destStateFs lists the destination from the state
+type destStateFs struct {
+	fs.Fs
+	state    *destState
+	features *fs.Features
+}
+
+// Features returns the optional features of this Fs
+func (f *destStateFs) Features() *fs.Features {
+	return f.features
+}
+
+// List the objects and directories in dir into entries from the
+// state.
+func (f *destStateFs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	dirEntries, ok := f.state.tree[dir]
+	if !ok {
+		if dir == "" {
+			return nil, nil
+		}
+		return nil, fs.ErrorDirNotFound
+	}
+	// Return a copy as the caller filters the entries in place
+	return append(entries, dirEntries...), nil
+}
+
+// NewObject finds the Object at remote in the state
+func (f *destStateFs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	_, entry := f.state.tree.Find(remote)
+	if o, ok := entry.(fs.Object); ok {
+		return o, nil
+	}
+	return nil, fs.ErrorObjectNotFound
+}
+
+// destStateObject is an object on the destination read from the
+// state.
+//
+// The real object is only looked up if it is needed, for example to
+// read or change it.
+type destStateObject struct {
+	state   *destState
+	remote  string
+	size    int64
+	modTime time.Time
+	hash    string // hash of state.hashType or "" if not known
+	mu      sync.Mutex
+	obj     fs.Object // the real object once looked up
+}
+
+// resolved returns the real object if it has been looked up already
+func (o *destStateObject) resolved() fs.Object {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.obj
+}
+
+// resolve looks up the real object on the destination
+func (o *destStateObject) resolve(ctx context.Context) (fs.Object, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.obj != nil {
+		return o.obj, nil
+	}
+	obj, err := o.state.fdst.NewObject(ctx, o.remote)
+	if err != nil {
+		return nil, err
+	}
+	o.obj = obj
+	return obj, nil
+}
+
+// Fs returns the destination the object is on
+func (o *destStateObject) Fs() fs.Info {
+	return o.state.fdst
+}
+
+// Return a string version
+func (o *destStateObject) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *destStateObject) Remote() string {
+	return o.remote
+}
+
+// Size returns the size of the object
+func (o *destStateObject) Size() int64 {
+	if obj := o.resolved(); obj != nil {
+		return obj.Size()
+	}
+	return o.size
+}
+
+// ModTime returns the modification time of the object
+func (o *destStateObject) ModTime(ctx context.Context) time.Time {
+	if obj := o.resolved(); obj != nil {
+		return obj.ModTime(ctx)
+	}
+	return o.modTime
+}
+
+// Hash returns the hash of the object from the state if it is
+// there, otherwise from the real object.
+func (o *destStateObject) Hash(ctx context.Context, ty hash.Type) (string, error) {
+	if obj := o.resolved(); obj == nil && ty == o.state.hashType && o.hash != "" {
+		return o.hash, nil
+	}
+	obj, err := o.resolve(ctx)
+	if err != nil {
+		return "", err
+	}
+	return obj.Hash(ctx, ty)
+}
+
+// Storable returns whether this object is storable
+func (o *destStateObject) Storable() bool {
+	return true
+}
+
+// SetModTime sets the modification time of the object
+func (o *destStateObject) SetModTime(ctx context.Context, modTime time.Time) error {
+	obj, err := o.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	return obj.SetModTime(ctx, modTime)
+}
+
+// Open opens the object for read
+func (o *destStateObject) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	obj, err := o.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return obj.Open(ctx, options...)
+}
+
+// Update the object with the contents of in.
+//
+// If the object has gone from the destination it is uploaded again.
+func (o *destStateObject) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	obj, err := o.resolve(ctx)
+	if errors.Is(err, fs.ErrorObjectNotFound) {
+		fs.Debugf(o, "Object in destination state is no longer on the destination - uploading")
+		obj, err = o.state.fdst.Put(ctx, in, src, options...)
+		if err != nil {
+			return err
+		}
+		o.mu.Lock()
+		o.obj = obj
+		o.mu.Unlock()
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return obj.Update(ctx, in, src, options...)
+}
+
+// Remove the object
+func (o *destStateObject) Remove(ctx context.Context) error {
+	obj, err := o.resolve(ctx)
+	if errors.Is(err, fs.ErrorObjectNotFound) {
+		fs.Debugf(o, "Object in destination state is already gone from the destination")
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return obj.Remove(ctx)
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs     = (*destStateFs)(nil)
+	_ fs.Object = (*destStateObject)(nil)
+)
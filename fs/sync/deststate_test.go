@@ -0,0 +1,121 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readDestState reads the remotes recorded in the state file
+func readDestState(t *testing.T, path string) (remotes []string) {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var state destStateFile
+	require.NoError(t, json.Unmarshal(data, &state))
+	assert.Equal(t, destStateVersion, state.Version)
+	for _, entry := range state.Objects {
+		remotes = append(remotes, entry.Remote)
+	}
+	return remotes
+}
+
+func TestSyncDestState(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	ci.DestState = statePath
+
+	sync := func() {
+		accounting.GlobalStats().ResetCounters()
+		require.NoError(t, Sync(ctx, r.Fremote, r.Flocal, false))
+	}
+
+	// The first sync lists the destination and writes the state
+	file1 := r.WriteFile("file1", "file1 contents", t1)
+	file2 := r.WriteFile("dir/file2", "file2 contents", t1)
+	sync()
+	r.CheckRemoteItems(t, file1, file2)
+	assert.Equal(t, []string{"dir/file2", "file1"}, readDestState(t, statePath))
+
+	// Files put on the destination outside rclone aren't seen
+	// when using the state, so aren't deleted
+	extra := r.WriteObject(ctx, "extra", "extra contents", t1)
+	file3 := r.WriteFile("dir/file3", "file3 contents", t2)
+	sync()
+	assert.Equal(t, int64(1), accounting.GlobalStats().GetTransfers())
+	r.CheckRemoteItems(t, file1, file2, file3, extra)
+	assert.Equal(t, []string{"dir/file2", "dir/file3", "file1"}, readDestState(t, statePath))
+
+	// Deletes and updates are recorded in the state
+	obj, err := r.Flocal.NewObject(ctx, "file1")
+	require.NoError(t, err)
+	require.NoError(t, obj.Remove(ctx))
+	file2 = r.WriteFile("dir/file2", "file2 updated", t3)
+	sync()
+	r.CheckRemoteItems(t, file2, file3, extra)
+	assert.Equal(t, []string{"dir/file2", "dir/file3"}, readDestState(t, statePath))
+
+	// Nothing to do the next time using the state
+	sync()
+	assert.Equal(t, int64(0), accounting.GlobalStats().GetTransfers())
+	assert.Equal(t, int64(0), accounting.GlobalStats().GetDeletes())
+
+	// Refreshing lists the destination so sees the extra file
+	ci.DestStateRefresh = true
+	sync()
+	r.CheckRemoteItems(t, file2, file3)
+	assert.Equal(t, []string{"dir/file2", "dir/file3"}, readDestState(t, statePath))
+}
+
+func TestSyncDestStateStale(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	ci.DestState = statePath
+
+	file1 := r.WriteFile("file1", "file1 contents", t1)
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, Sync(ctx, r.Fremote, r.Flocal, false))
+
+	// Remove the file from the destination behind rclone's back
+	// then change it so it is updated from the state
+	obj, err := r.Fremote.NewObject(ctx, "file1")
+	require.NoError(t, err)
+	require.NoError(t, obj.Remove(ctx))
+	file1 = r.WriteFile("file1", "file1 updated", t2)
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, Sync(ctx, r.Fremote, r.Flocal, false))
+	r.CheckRemoteItems(t, file1)
+
+	// A corrupt state is ignored and the destination listed
+	require.NoError(t, os.WriteFile(statePath, []byte("potato"), 0600))
+	r.WriteObject(ctx, "extra", "extra contents", t1)
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, Sync(ctx, r.Fremote, r.Flocal, false))
+	r.CheckRemoteItems(t, file1)
+	assert.Equal(t, []string{"file1"}, readDestState(t, statePath))
+
+	// A state for a different destination isn't used - if it
+	// was file1 wouldn't be copied
+	fdst, err := fs.NewFs(ctx, t.TempDir())
+	require.NoError(t, err)
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, Sync(ctx, fdst, r.Flocal, false))
+	fstest.CheckItems(t, fdst, file1)
+	assert.Equal(t, []string{"file1"}, readDestState(t, statePath))
+
+	// Can't be used with --no-traverse
+	ci.NoTraverse = true
+	err = CopyDir(ctx, r.Fremote, r.Flocal, false)
+	assert.ErrorContains(t, err, "--dest-state with --no-traverse")
+}
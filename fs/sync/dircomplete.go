@@ -0,0 +1,194 @@
+// This file implements --on-dir-complete
+
+package sync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// dirProgress is the progress of syncing a directory
+type dirProgress struct {
+	parent  *dirProgress // parent directory or nil for the root
+	dir     string       // path of the directory
+	pending int          // files being transferred and subdirectories not complete
+	marched bool         // set once all the entries of the directory are known
+	failed  bool         // set if anything in the directory or its subdirectories failed
+}
+
+// dirTracker works out when all the transfers within a directory
+// have finished.
+//
+// Each file passed to the transfer pipeline is counted against its
+// directory as is each subdirectory of a directory. A directory is
+// complete once the march has passed all its entries and the count
+// is back to zero.
+type dirTracker struct {
+	mu   sync.Mutex
+	dirs map[string]*dirProgress
+}
+
+// newDirTracker makes a new dirTracker
+func newDirTracker() *dirTracker {
+	return &dirTracker{
+		dirs: make(map[string]*dirProgress),
+	}
+}
+
+// parentDir returns the directory remote is in
+func parentDir(remote string) string {
+	dir := path.Dir(remote)
+	if dir == "." {
+		dir = ""
+	}
+	return dir
+}
+
+// get returns the progress of dir, creating it if necessary
+//
+// Call with the lock held
+func (t *dirTracker) get(dir string) *dirProgress {
+	d := t.dirs[dir]
+	if d == nil {
+		d = &dirProgress{dir: dir}
+		t.dirs[dir] = d
+	}
+	return d
+}
+
+// complete removes d and any of its parents which are now complete
+// returning the directories which completed successfully in the order
+// they completed.
+//
+// Call with the lock held
+func (t *dirTracker) complete(d *dirProgress) (dirs []string) {
+	for d != nil && d.marched && d.pending == 0 {
+		delete(t.dirs, d.dir)
+		if !d.failed {
+			dirs = append(dirs, d.dir)
+		}
+		parent := d.parent
+		if parent != nil {
+			parent.pending--
+			parent.failed = parent.failed || d.failed
+		}
+		d = parent
+	}
+	return dirs
+}
+
+// add records the file remote is being transferred
+func (t *dirTracker) add(remote string) {
+	t.mu.Lock()
+	t.get(parentDir(remote)).pending++
+	t.mu.Unlock()
+}
+
+// done records the transfer of the file remote has finished
+// returning any directories this completed.
+func (t *dirTracker) done(remote string, err error) (dirs []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d := t.get(parentDir(remote))
+	d.pending--
+	if err != nil {
+		d.failed = true
+	}
+	return t.complete(d)
+}
+
+// marched records that all the entries of dir are known and that
+// subdirs will be marched into, returning any directories this
+// completed.
+func (t *dirTracker) marched(dir string, subdirs []string) (dirs []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d := t.get(dir)
+	for _, subdir := range subdirs {
+		t.get(subdir).parent = d
+		d.pending++
+	}
+	d.marched = true
+	return t.complete(d)
+}
+
+// dirQueue is a queue of directories to run the --on-dir-complete
+// command for.
+//
+// It has no limit so the transfers are never held up by a slow
+// command.
+type dirQueue struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	dirs   []string
+	closed bool
+}
+
+// newDirQueue makes a new dirQueue
+func newDirQueue() *dirQueue {
+	q := &dirQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// put adds dirs to the end of the queue
+func (q *dirQueue) put(dirs ...string) {
+	if len(dirs) == 0 {
+		return
+	}
+	q.mu.Lock()
+	q.dirs = append(q.dirs, dirs...)
+	q.mu.Unlock()
+	q.cond.Signal()
+}
+
+// get returns the directory at the start of the queue waiting for one
+// if necessary. It returns false once the queue is closed and empty.
+func (q *dirQueue) get() (dir string, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.dirs) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.dirs) == 0 {
+		return "", false
+	}
+	dir = q.dirs[0]
+	q.dirs = q.dirs[1:]
+	return dir, true
+}
+
+// close marks that nothing more will be put on the queue
+func (q *dirQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+// runDirComplete runs the --on-dir-complete command for dir
+func runDirComplete(ctx context.Context, cmdLine fs.SpaceSepList, dir string) error {
+	args := make([]string, len(cmdLine))
+	for i, arg := range cmdLine {
+		args[i] = strings.ReplaceAll(arg, "{dir}", dir)
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	start := time.Now()
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("on dir complete: failed on %v: %q: %w", args, strings.TrimSpace(stderr.String()), err)
+	}
+	fs.Debugf(dir, "Ran on dir complete command %v in %v: %q", args, time.Since(start), strings.TrimSpace(stdout.String()))
+	return nil
+}
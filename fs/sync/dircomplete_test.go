@@ -0,0 +1,147 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirTracker(t *testing.T) {
+	dt := newDirTracker()
+
+	// Files are transferred in the root and dir
+	dt.add("file1")
+	dt.add("dir/file2")
+	dt.add("dir/file3")
+
+	// The root isn't complete until dir is
+	assert.Nil(t, dt.marched("", []string{"dir"}))
+	assert.Nil(t, dt.done("file1", nil))
+
+	// dir isn't complete until it has been marched
+	assert.Nil(t, dt.done("dir/file2", nil))
+	assert.Nil(t, dt.done("dir/file3", nil))
+	assert.Equal(t, []string{"dir", ""}, dt.marched("dir", nil))
+	assert.Empty(t, dt.dirs)
+
+	// Completing dir completes the root too, but not if a sibling failed
+	dt = newDirTracker()
+	dt.add("file1")
+	dt.add("failed/file4")
+	assert.Nil(t, dt.marched("", []string{"dir", "failed"}))
+	assert.Nil(t, dt.marched("failed", nil))
+	assert.Nil(t, dt.done("failed/file4", errors.New("boom")))
+	assert.Equal(t, []string{"dir"}, dt.marched("dir", nil))
+	assert.Nil(t, dt.done("file1", nil))
+	assert.Empty(t, dt.dirs)
+
+	// Without failures the directories complete bottom up
+	dt = newDirTracker()
+	dt.add("dir/file2")
+	assert.Nil(t, dt.marched("", []string{"dir"}))
+	assert.Nil(t, dt.marched("dir", []string{"dir/sub"}))
+	assert.Equal(t, []string{"dir/sub"}, dt.marched("dir/sub", nil))
+	assert.Equal(t, []string{"dir", ""}, dt.done("dir/file2", nil))
+	assert.Empty(t, dt.dirs)
+}
+
+func TestDirQueue(t *testing.T) {
+	q := newDirQueue()
+
+	// Putting never blocks and the directories come out in order
+	q.put("dir/sub", "dir")
+	q.put()
+	q.put("")
+	for _, want := range []string{"dir/sub", "dir", ""} {
+		dir, ok := q.get()
+		assert.True(t, ok)
+		assert.Equal(t, want, dir)
+	}
+
+	// get waits until a directory is put or the queue is closed
+	got := make(chan string)
+	go func() {
+		for {
+			dir, ok := q.get()
+			if !ok {
+				close(got)
+				return
+			}
+			got <- dir
+		}
+	}()
+	q.put("other")
+	assert.Equal(t, "other", <-got)
+	q.close()
+	_, ok := <-got
+	assert.False(t, ok)
+}
+
+func TestSyncOnDirComplete(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	if !r.Fremote.Features().IsLocal {
+		t.Skip("needs a local destination to check")
+	}
+	file1 := r.WriteFile("file1", "file1 contents", t1)
+	file2 := r.WriteFile("dir/file2", "file2 contents", t2)
+	file3 := r.WriteFile("dir/sub/file3", "file3 contents", t3)
+	file4 := r.WriteFile("other/file4", "file4 contents", t1)
+	file5 := r.WriteFile("other/file5", "file5 contents", t2)
+
+	// The hook records the directory and what is in it on the
+	// destination when it is run
+	out := filepath.Join(t.TempDir(), "out")
+	ci.OnDirComplete = fs.SpaceSepList{"sh", "-c", `echo "$1:" $(ls "$0/$1") >> "$2"`, r.Fremote.Root(), "{dir}", out}
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, Sync(ctx, r.Fremote, r.Flocal, false))
+	r.CheckRemoteItems(t, file1, file2, file3, file4, file5)
+
+	readOut := func() []string {
+		data, err := os.ReadFile(out)
+		require.NoError(t, err)
+		require.NoError(t, os.Remove(out))
+		return strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+	lines := readOut()
+
+	// The root is last as it completes after everything in it
+	require.Len(t, lines, 4)
+	assert.Equal(t, ": dir file1 other", lines[3])
+	sort.Strings(lines)
+	assert.Equal(t, []string{
+		": dir file1 other",
+		"dir/sub: file3",
+		"dir: file2 sub",
+		"other: file4 file5",
+	}, lines)
+
+	// The hook isn't run with --dry-run
+	ci.DryRun = true
+	r.WriteFile("dir/file6", "file6 contents", t3)
+	require.NoError(t, Sync(ctx, r.Fremote, r.Flocal, false))
+	_, err := os.Stat(out)
+	assert.True(t, os.IsNotExist(err), "hook must not be run")
+	ci.DryRun = false
+
+	// A failing hook is an error
+	ci.OnDirComplete = fs.SpaceSepList{"sh", "-c", `echo "hook failed" >&2; exit 1`}
+	accounting.GlobalStats().ResetCounters()
+	err = Sync(ctx, r.Fremote, r.Flocal, false)
+	assert.ErrorContains(t, err, "hook failed")
+}
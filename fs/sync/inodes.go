@@ -0,0 +1,98 @@
+package sync
+
+import (
+	"context"
+	"path"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/kv"
+)
+
+// inodesFacility is the name of the kv database used to store the
+// inodes for --track-renames-strategy inode
+const inodesFacility = "track-renames"
+
+// inodeStore remembers which source inode each file in the
+// destination was last synced from.
+//
+// This is used by --track-renames-strategy inode to detect files
+// which were renamed in the source as the source inode stays the same
+// across a rename.
+type inodeStore struct {
+	db   *kv.DB
+	fdst fs.Fs
+}
+
+// newInodeStore opens the inode store for fdst
+func newInodeStore(ctx context.Context, fdst fs.Fs) (*inodeStore, error) {
+	db, err := kv.Start(ctx, inodesFacility, fdst)
+	if err != nil {
+		return nil, err
+	}
+	return &inodeStore{
+		db:   db,
+		fdst: fdst,
+	}, nil
+}
+
+// key makes the database key for remote in the destination
+func (is *inodeStore) key(remote string) []byte {
+	return []byte(path.Join(is.fdst.Root(), remote))
+}
+
+// inodeGet reads the inode stored for a key
+type inodeGet struct {
+	key   []byte
+	inode string
+}
+
+// Do the inodeGet operation
+func (op *inodeGet) Do(ctx context.Context, b kv.Bucket) error {
+	op.inode = string(b.Get(op.key))
+	return nil
+}
+
+// inodePut stores the inode for a key
+type inodePut struct {
+	key   []byte
+	inode string
+}
+
+// Do the inodePut operation
+func (op *inodePut) Do(ctx context.Context, b kv.Bucket) error {
+	return b.Put(op.key, []byte(op.inode))
+}
+
+// get returns the source inode that remote in the destination was
+// synced from or "" if not known
+func (is *inodeStore) get(remote string) string {
+	op := &inodeGet{key: is.key(remote)}
+	if err := is.db.Do(false, op); err != nil {
+		fs.Debugf(remote, "Failed to read inode for --track-renames: %v", err)
+		return ""
+	}
+	return op.inode
+}
+
+// put records that remote in the destination was synced from src
+func (is *inodeStore) put(src fs.Object) {
+	do, ok := src.(fs.Inoder)
+	if !ok {
+		return
+	}
+	inode := do.Inode()
+	if inode == "" {
+		return
+	}
+	err := is.db.Do(true, &inodePut{key: is.key(src.Remote()), inode: inode})
+	if err != nil {
+		fs.Debugf(src, "Failed to store inode for --track-renames: %v", err)
+	}
+}
+
+// close the inode store
+func (is *inodeStore) close() {
+	if err := is.db.Stop(false); err != nil {
+		fs.Debugf(is.fdst, "Failed to close inode store for --track-renames: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+// This file implements --rename-map
+
+package sync
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// pathMap maps source paths to the destination paths they should be
+// transferred to.
+type pathMap struct {
+	newPath map[string]string // old path to new path
+	oldPath map[string]string // new path to old path
+}
+
+// readPathMap reads the --rename-map file at path.
+//
+// Each line has an old path and a new path separated by a tab. Blank
+// lines and lines starting with # are ignored. It is an error for
+// more than one old path to be renamed to the same new path.
+func readPathMap(path string) (*pathMap, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open rename map: %w", err)
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	m := &pathMap{
+		newPath: make(map[string]string),
+		oldPath: make(map[string]string),
+	}
+	scanner := bufio.NewScanner(in)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		oldPath, newPath, ok := strings.Cut(line, "\t")
+		oldPath = strings.Trim(oldPath, "/")
+		newPath = strings.Trim(newPath, "/")
+		if !ok || oldPath == "" || newPath == "" {
+			return nil, fmt.Errorf("rename map %q line %d: expecting old and new paths separated by a tab", path, lineNumber)
+		}
+		if previous, found := m.newPath[oldPath]; found {
+			return nil, fmt.Errorf("rename map %q line %d: %q is already renamed to %q", path, lineNumber, oldPath, previous)
+		}
+		if previous, found := m.oldPath[newPath]; found {
+			return nil, fmt.Errorf("rename map %q line %d: %q and %q are both renamed to %q", path, lineNumber, previous, oldPath, newPath)
+		}
+		m.newPath[oldPath] = newPath
+		m.oldPath[newPath] = oldPath
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rename map: %w", err)
+	}
+	return m, nil
+}
+
+// rename returns the path remote should be transferred to and
+// whether it is renamed. It is safe to call on a nil pathMap.
+func (m *pathMap) rename(remote string) (newRemote string, renamed bool) {
+	if m == nil {
+		return remote, false
+	}
+	newRemote, renamed = m.newPath[remote]
+	if !renamed {
+		newRemote = remote
+	}
+	return newRemote, renamed
+}
+
+// isTarget returns true if a file is renamed to remote. It is safe to
+// call on a nil pathMap.
+func (m *pathMap) isTarget(remote string) bool {
+	if m == nil {
+		return false
+	}
+	_, found := m.oldPath[remote]
+	return found
+}
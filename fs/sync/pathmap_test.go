@@ -0,0 +1,165 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writePathMap writes a --rename-map file with contents returning its path
+func writePathMap(t *testing.T, contents string) string {
+	path := filepath.Join(t.TempDir(), "renames.txt")
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0600))
+	return path
+}
+
+// renamed returns item moved to newPath
+func renamed(item fstest.Item, newPath string) fstest.Item {
+	item.Path = newPath
+	return item
+}
+
+func TestReadPathMap(t *testing.T) {
+	m, err := readPathMap(writePathMap(t, "# comment\n\nfile1\tnew/file1\r\n/dir/file2/\tfile2\n"))
+	require.NoError(t, err)
+	for _, test := range []struct {
+		in      string
+		want    string
+		renamed bool
+		target  bool
+	}{
+		{in: "file1", want: "new/file1", renamed: true},
+		{in: "dir/file2", want: "file2", renamed: true},
+		{in: "new/file1", want: "new/file1", target: true},
+		{in: "file2", want: "file2", target: true},
+		{in: "file3", want: "file3"},
+	} {
+		got, renamed := m.rename(test.in)
+		assert.Equal(t, test.want, got, test.in)
+		assert.Equal(t, test.renamed, renamed, test.in)
+		assert.Equal(t, test.target, m.isTarget(test.in), test.in)
+	}
+
+	// nil pathMap renames nothing
+	var nilMap *pathMap
+	got, renamed := nilMap.rename("file1")
+	assert.Equal(t, "file1", got)
+	assert.False(t, renamed)
+	assert.False(t, nilMap.isTarget("file1"))
+
+	for _, test := range []struct {
+		contents string
+		err      string
+	}{
+		{contents: "file1 new/file1\n", err: "line 1: expecting old and new paths"},
+		{contents: "file1\t\n", err: "line 1: expecting old and new paths"},
+		{contents: "a\tb\na\tc\n", err: `line 2: "a" is already renamed to "b"`},
+		{contents: "a\tc\nb\tc\n", err: `line 2: "a" and "b" are both renamed to "c"`},
+	} {
+		_, err := readPathMap(writePathMap(t, test.contents))
+		assert.ErrorContains(t, err, test.err, test.contents)
+	}
+	_, err = readPathMap(filepath.Join(t.TempDir(), "notfound"))
+	assert.ErrorContains(t, err, "failed to open rename map")
+}
+
+func TestSyncRenameMap(t *testing.T) {
+	t.Run("Before", func(t *testing.T) { testSyncRenameMap(t, fs.DeleteModeBefore) })
+	t.Run("During", func(t *testing.T) { testSyncRenameMap(t, fs.DeleteModeDuring) })
+	t.Run("After", func(t *testing.T) { testSyncRenameMap(t, fs.DeleteModeAfter) })
+}
+
+func testSyncRenameMap(t *testing.T, deleteMode fs.DeleteMode) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	ci.DeleteMode = deleteMode
+	r := fstest.NewRun(t)
+	file1 := r.WriteFile("file1", "file1 contents", t1)
+	file2 := r.WriteFile("dir/file2", "file2 contents", t2)
+	file3 := r.WriteFile("file3", "file3 contents", t3)
+
+	// Transfer with the old layout
+	require.NoError(t, Sync(ctx, r.Fremote, r.Flocal, false))
+	r.CheckRemoteItems(t, file1, file2, file3)
+
+	ci.RenameMap = writePathMap(t, "file1\tnew/file1\ndir/file2\tnew/dir/file2\n")
+	newFile1 := renamed(file1, "new/file1")
+	newFile2 := renamed(file2, "new/dir/file2")
+
+	// Sync renames the mapped files and deletes the old paths
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, Sync(ctx, r.Fremote, r.Flocal, false))
+	assert.Equal(t, int64(2), accounting.GlobalStats().GetTransfers())
+	assert.Equal(t, int64(2), accounting.GlobalStats().GetDeletes())
+	r.CheckLocalItems(t, file1, file2, file3)
+	r.CheckRemoteItems(t, newFile1, newFile2, file3)
+
+	// The renamed files are up to date so aren't deleted or transferred again
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, Sync(ctx, r.Fremote, r.Flocal, false))
+	assert.Equal(t, int64(0), accounting.GlobalStats().GetTransfers())
+	assert.Equal(t, int64(0), accounting.GlobalStats().GetDeletes())
+	r.CheckRemoteItems(t, newFile1, newFile2, file3)
+
+	// Changes are transferred to the new path
+	file1 = r.WriteFile("file1", "file1 updated", t2)
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, Sync(ctx, r.Fremote, r.Flocal, false))
+	assert.Equal(t, int64(1), accounting.GlobalStats().GetTransfers())
+	r.CheckRemoteItems(t, renamed(file1, "new/file1"), newFile2, file3)
+}
+
+func TestCopyRenameMap(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	file1 := r.WriteFile("file1", "file1 contents", t1)
+	file2 := r.WriteFile("file2", "file2 contents", t2)
+	oldFile1 := r.WriteObject(ctx, "file1", "file1 contents", t1)
+
+	// Swap the names of the files - copy leaves the old paths
+	ci.RenameMap = writePathMap(t, "file1\tfile2\nfile2\tfile3\n")
+	require.NoError(t, CopyDir(ctx, r.Fremote, r.Flocal, false))
+	r.CheckRemoteItems(t, oldFile1, renamed(file1, "file2"), renamed(file2, "file3"))
+}
+
+func TestSyncRenameMapCollision(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	file1 := r.WriteFile("file1", "file1 contents", t1)
+	r.WriteFile("file2", "file2 contents", t2)
+
+	// file2 would be overwritten by file1 so is an error
+	ci.RenameMap = writePathMap(t, "file1\tfile2\n")
+	accounting.GlobalStats().ResetCounters()
+	err := Sync(ctx, r.Fremote, r.Flocal, false)
+	assert.ErrorContains(t, err, "collides with a file renamed to it")
+	r.CheckRemoteItems(t, renamed(file1, "file2"))
+}
+
+func TestSyncRenameMapNotInSource(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	file2 := r.WriteFile("file2", "file2 contents", t2)
+
+	// file1 isn't in the source so file2 is transferred as normal
+	ci.RenameMap = writePathMap(t, "file1\tfile2\n")
+	require.NoError(t, Sync(ctx, r.Fremote, r.Flocal, false))
+	r.CheckRemoteItems(t, file2)
+
+	// and is updated as normal
+	file2 = r.WriteFile("file2", "file2 updated", t3)
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, Sync(ctx, r.Fremote, r.Flocal, false))
+	assert.Equal(t, int64(1), accounting.GlobalStats().GetTransfers())
+	r.CheckRemoteItems(t, file2)
+}
@@ -4,18 +4,23 @@ import (
 	"context"
 	"fmt"
 	"math/bits"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
 
 	"github.com/aalpar/deheap"
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/filter"
 	"github.com/rclone/rclone/fs/fserrors"
 )
 
 // compare two items for order by
 type lessFn func(a, b fs.ObjectPair) bool
 
+// returns true if the item with this remote should go first
+type priorityFn func(remote string) bool
+
 // pipe provides an unbounded channel like experience
 //
 // Note unlike channels these aren't strictly ordered.
@@ -23,14 +28,16 @@ type pipe struct {
 	mu        sync.Mutex
 	c         chan struct{}
 	queue     []fs.ObjectPair
+	priQueue  []fs.ObjectPair // items which match priority in the order they arrived
 	closed    bool
 	totalSize int64
 	stats     func(items int, totalSize int64)
 	less      lessFn
+	priority  priorityFn
 	fraction  int
 }
 
-func newPipe(orderBy string, stats func(items int, totalSize int64), maxBacklog int) (*pipe, error) {
+func newPipe(orderBy string, priority priorityFn, stats func(items int, totalSize int64), maxBacklog int) (*pipe, error) {
 	if maxBacklog < 0 {
 		maxBacklog = (1 << (bits.UintSize - 1)) - 1 // largest positive int
 	}
@@ -42,6 +49,7 @@ func newPipe(orderBy string, stats func(items int, totalSize int64), maxBacklog
 		c:        make(chan struct{}, maxBacklog),
 		stats:    stats,
 		less:     less,
+		priority: priority,
 		fraction: fraction,
 	}
 	if p.less != nil {
@@ -92,7 +100,9 @@ func (p *pipe) Put(ctx context.Context, pair fs.ObjectPair) (ok bool) {
 		return false
 	}
 	p.mu.Lock()
-	if p.less == nil {
+	if p.priority != nil && p.priority(pair.Src.Remote()) {
+		p.priQueue = append(p.priQueue, pair)
+	} else if p.less == nil {
 		// no order-by
 		p.queue = append(p.queue, pair)
 	} else {
@@ -102,7 +112,7 @@ func (p *pipe) Put(ctx context.Context, pair fs.ObjectPair) (ok bool) {
 	if size > 0 && pair.Src != pair.Dst {
 		p.totalSize += size
 	}
-	p.stats(len(p.queue), p.totalSize)
+	p.stats(len(p.queue)+len(p.priQueue), p.totalSize)
 	p.mu.Unlock()
 	select {
 	case <-ctx.Done():
@@ -132,7 +142,12 @@ func (p *pipe) GetMax(ctx context.Context, fraction int) (pair fs.ObjectPair, ok
 		}
 	}
 	p.mu.Lock()
-	if p.less == nil {
+	if len(p.priQueue) > 0 {
+		// priority items go first whatever the order-by
+		pair = p.priQueue[0]
+		p.priQueue[0] = fs.ObjectPair{} // avoid memory leak
+		p.priQueue = p.priQueue[1:]
+	} else if p.less == nil {
 		// no order-by
 		pair = p.queue[0]
 		p.queue[0] = fs.ObjectPair{} // avoid memory leak
@@ -149,7 +164,7 @@ func (p *pipe) GetMax(ctx context.Context, fraction int) (pair fs.ObjectPair, ok
 	if p.totalSize < 0 {
 		p.totalSize = 0
 	}
-	p.stats(len(p.queue), p.totalSize)
+	p.stats(len(p.queue)+len(p.priQueue), p.totalSize)
 	p.mu.Unlock()
 	return pair, true
 }
@@ -165,7 +180,7 @@ func (p *pipe) Get(ctx context.Context) (pair fs.ObjectPair, ok bool) {
 // Stats reads the number of items in the queue and the totalSize
 func (p *pipe) Stats() (items int, totalSize int64) {
 	p.mu.Lock()
-	items, totalSize = len(p.queue), p.totalSize
+	items, totalSize = len(p.queue)+len(p.priQueue), p.totalSize
 	p.mu.Unlock()
 	return items, totalSize
 }
@@ -235,3 +250,27 @@ func newLess(orderBy string) (less lessFn, fraction int, err error) {
 	}
 	return less, fraction, nil
 }
+
+// newPriority returns a function which returns true for remotes
+// matching any of the globs passed in or nil if there are none
+func newPriority(globs []string, ignoreCase bool) (priority priorityFn, err error) {
+	if len(globs) == 0 {
+		return nil, nil
+	}
+	res := make([]*regexp.Regexp, 0, len(globs))
+	for _, glob := range globs {
+		re, err := filter.GlobToRegexp(glob, ignoreCase)
+		if err != nil {
+			return nil, fmt.Errorf("bad --priority-glob %q: %w", glob, err)
+		}
+		res = append(res, re)
+	}
+	return func(remote string) bool {
+		for _, re := range res {
+			if re.MatchString(remote) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
@@ -24,7 +24,7 @@ func TestPipe(t *testing.T) {
 	}
 
 	// Make a new pipe
-	p, err := newPipe("", stats, 10)
+	p, err := newPipe("", nil, stats, 10)
 	require.NoError(t, err)
 
 	checkStats := func(expectedN int, expectedSize int64) {
@@ -78,7 +78,7 @@ func TestPipe(t *testing.T) {
 	assert.Panics(t, func() { p.Put(ctx, pair1) })
 
 	// Make a new pipe
-	p, err = newPipe("", stats, 10)
+	p, err = newPipe("", nil, stats, 10)
 	require.NoError(t, err)
 	ctx2, cancel := context.WithCancel(ctx)
 
@@ -105,7 +105,7 @@ func TestPipeConcurrent(t *testing.T) {
 	stats := func(n int, size int64) {}
 
 	// Make a new pipe
-	p, err := newPipe("", stats, 10)
+	p, err := newPipe("", nil, stats, 10)
 	require.NoError(t, err)
 
 	var wg sync.WaitGroup
@@ -171,7 +171,7 @@ func TestPipeOrderBy(t *testing.T) {
 		{"size,mixed,51", true, true, 75},
 	} {
 		t.Run(test.orderBy, func(t *testing.T) {
-			p, err := newPipe(test.orderBy, stats, 10)
+			p, err := newPipe(test.orderBy, nil, stats, 10)
 			require.NoError(t, err)
 
 			readAndCheck := func(swapped bool) {
@@ -288,3 +288,47 @@ func TestNewLess(t *testing.T) {
 	}
 
 }
+
+func TestPipePriority(t *testing.T) {
+	var (
+		stats = func(n int, size int64) {}
+		ctx   = context.Background()
+	)
+	priority, err := newPriority([]string{"*.db", "/important/**"}, false)
+	require.NoError(t, err)
+
+	for _, test := range []struct {
+		orderBy  string
+		fraction int
+		want     []string
+	}{
+		{"", -1, []string{"c.db", "important/z", "a.db", "bulk22", "bulk1", "bulk333"}},
+		{"size,descending", -1, []string{"c.db", "important/z", "a.db", "bulk333", "bulk22", "bulk1"}},
+		{"name", -1, []string{"c.db", "important/z", "a.db", "bulk1", "bulk22", "bulk333"}},
+		{"size,mixed,50", 75, []string{"c.db", "important/z", "a.db", "bulk333", "bulk22", "bulk1"}},
+	} {
+		t.Run(test.orderBy, func(t *testing.T) {
+			p, err := newPipe(test.orderBy, priority, stats, 10)
+			require.NoError(t, err)
+			for _, remote := range []string{"bulk22", "c.db", "bulk1", "important/z", "bulk333", "a.db"} {
+				obj := mockobject.New(remote).WithContent([]byte(remote), mockobject.SeekModeNone)
+				require.True(t, p.Put(ctx, fs.ObjectPair{Src: obj}))
+			}
+			items, _ := p.Stats()
+			assert.Equal(t, 6, items)
+			var got []string
+			for range test.want {
+				pair, ok := p.GetMax(ctx, test.fraction)
+				require.True(t, ok)
+				got = append(got, pair.Src.Remote())
+			}
+			assert.Equal(t, test.want, got)
+		})
+	}
+
+	_, err = newPriority([]string{"***"}, false)
+	assert.ErrorContains(t, err, "bad --priority-glob")
+	priority, err = newPriority(nil, false)
+	require.NoError(t, err)
+	assert.Nil(t, priority)
+}
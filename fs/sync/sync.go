@@ -18,6 +18,7 @@ import (
 	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/fs/march"
 	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/walk"
 	"github.com/rclone/rclone/lib/errcount"
 	"golang.org/x/sync/errgroup"
 )
@@ -48,6 +49,7 @@ type syncCopyMove struct {
 	inCancel               func()                 // cancel the march context
 	noTraverse             bool                   // if set don't traverse the dst
 	noCheckDest            bool                   // if set transfer all objects regardless without checking dst
+	destEmpty              bool                   // if set the destination is known to be empty so isn't listed
 	noUnicodeNormalization bool                   // don't normalize unicode characters in filenames
 	deletersWg             sync.WaitGroup         // for delete before go routine
 	deleteFilesCh          chan fs.Object         // channel to receive deletes if delete before
@@ -80,8 +82,18 @@ type syncCopyMove struct {
 	trackRenamesWg         sync.WaitGroup         // wg for background track renames
 	trackRenamesCh         chan fs.Object         // objects are pumped in here
 	renameCheck            []fs.Object            // accumulate files to check for rename here
+	inodes                 *inodeStore            // source inodes of dst files - only used by track renames strategy inode
+	destState              *destState             // state of the destination - only used by --dest-state
+	pathMap                *pathMap               // paths to rename files to - only used by --rename-map
+	pathMappedMu           sync.Mutex             // protect pathMapped
+	dirTracker             *dirTracker            // tracks when directories are complete - only used by --on-dir-complete
+	dirQueue               *dirQueue              // directories to run the --on-dir-complete command for
+	dirCompleteWg          sync.WaitGroup         // for the --on-dir-complete runner
+	pathMapped             []fs.Object            // source files to transfer to their --rename-map paths after the march
+	pathTargets            []fs.ObjectPair        // source files at --rename-map new paths to transfer after the march
 	compareCopyDest        []fs.Fs                // place to check for files to server side copy
 	backupDir              fs.Fs                  // place to store overwrites/deletes
+	quarantineDir          fs.Fs                  // place to store overwrites/deletes of files which may hold unique data
 	checkFirst             bool                   // if set run all the checkers before starting transfers
 	maxDurationEndTime     time.Time              // end time if --max-duration is set
 	logger                 operations.LoggerFn    // LoggerFn used to report the results of a sync (or bisync) to an io.Writer
@@ -109,6 +121,7 @@ const (
 	trackRenamesStrategyHash trackRenamesStrategy = 1 << iota
 	trackRenamesStrategyModtime
 	trackRenamesStrategyLeaf
+	trackRenamesStrategyInode
 )
 
 func (strategy trackRenamesStrategy) hash() bool {
@@ -123,6 +136,10 @@ func (strategy trackRenamesStrategy) leaf() bool {
 	return (strategy & trackRenamesStrategyLeaf) != 0
 }
 
+func (strategy trackRenamesStrategy) inode() bool {
+	return (strategy & trackRenamesStrategyInode) != 0
+}
+
 func newSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.DeleteMode, DoMove bool, deleteEmptySrcDirs bool, copyEmptySrcDirs bool) (*syncCopyMove, error) {
 	if (deleteMode != fs.DeleteModeOff || DoMove) && operations.OverlappingFilterCheck(ctx, fdst, fsrc) {
 		return nil, fserrors.FatalError(fs.ErrorOverlapping)
@@ -146,6 +163,7 @@ func newSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.Delete
 		srcEmptyDirs:           make(map[string]fs.DirEntry),
 		noTraverse:             ci.NoTraverse,
 		noCheckDest:            ci.NoCheckDest,
+		destEmpty:              ci.DestEmpty,
 		noUnicodeNormalization: ci.NoUnicodeNormalization,
 		deleteFilesCh:          make(chan fs.Object, ci.Checkers),
 		trackRenames:           ci.TrackRenames,
@@ -173,16 +191,19 @@ func newSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.Delete
 		fs.Infof(s.fdst, "Running all checks before starting transfers")
 		backlog = -1
 	}
-	var err error
-	s.toBeChecked, err = newPipe(ci.OrderBy, accounting.Stats(ctx).SetCheckQueue, backlog)
+	priority, err := newPriority(ci.PriorityGlob, s.fi.Opt.IgnoreCase)
+	if err != nil {
+		return nil, fserrors.FatalError(err)
+	}
+	s.toBeChecked, err = newPipe(ci.OrderBy, priority, accounting.Stats(ctx).SetCheckQueue, backlog)
 	if err != nil {
 		return nil, err
 	}
-	s.toBeUploaded, err = newPipe(ci.OrderBy, accounting.Stats(ctx).SetTransferQueue, backlog)
+	s.toBeUploaded, err = newPipe(ci.OrderBy, priority, accounting.Stats(ctx).SetTransferQueue, backlog)
 	if err != nil {
 		return nil, err
 	}
-	s.toBeRenamed, err = newPipe(ci.OrderBy, accounting.Stats(ctx).SetRenameQueue, backlog)
+	s.toBeRenamed, err = newPipe(ci.OrderBy, priority, accounting.Stats(ctx).SetRenameQueue, backlog)
 	if err != nil {
 		return nil, err
 	}
@@ -229,6 +250,20 @@ func newSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.Delete
 		if s.backupDir != nil {
 			return nil, errors.New("can't use --no-check-dest with --backup-dir")
 		}
+		if ci.QuarantineDir != "" {
+			return nil, errors.New("can't use --no-check-dest with --quarantine-dir")
+		}
+	}
+	if ci.CheckSum && ci.ChecksumFallback == fs.ChecksumFallbackError && s.commonHash == hash.None {
+		return nil, errors.New("can't use --checksum as the source and destination have no hashes in common")
+	}
+	if ci.NoUpdateExisting {
+		if s.noCheckDest {
+			return nil, errors.New("can't use --no-check-dest with --no-update-existing as existing files can't be found")
+		}
+		if s.trackRenames {
+			return nil, errors.New("can't use --track-renames with --no-update-existing as it moves existing files")
+		}
 	}
 	if s.trackRenames {
 		// Don't track renames for remotes without server-side move support.
@@ -241,7 +276,7 @@ func newSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.Delete
 			s.trackRenames = false
 		}
 
-		if s.trackRenamesStrategy.modTime() && s.modifyWindow == fs.ModTimeNotSupported {
+		if (s.trackRenamesStrategy.modTime() || s.trackRenamesStrategy.inode()) && s.modifyWindow == fs.ModTimeNotSupported {
 			fs.Errorf(fdst, "Ignoring --track-renames as either the source or destination do not support modtime")
 			s.trackRenames = false
 		}
@@ -251,6 +286,13 @@ func newSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.Delete
 			s.trackRenames = false
 		}
 	}
+	if s.trackRenames && s.trackRenamesStrategy.inode() {
+		s.inodes, err = newInodeStore(ctx, fdst)
+		if err != nil {
+			fs.Errorf(fdst, "Ignoring --track-renames as the inode store could not be opened: %v", err)
+			s.trackRenames = false
+		}
+	}
 	if s.trackRenames {
 		// track renames needs delete after
 		if s.deleteMode != fs.DeleteModeOff {
@@ -261,6 +303,42 @@ func newSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.Delete
 			s.noTraverse = false
 		}
 	}
+	if ci.DestState != "" {
+		if s.noTraverse {
+			return nil, errors.New("can't use --dest-state with --no-traverse")
+		}
+		if s.noCheckDest {
+			return nil, errors.New("can't use --dest-state with --no-check-dest")
+		}
+		// Only record hashes if they come with the listing
+		hashType := s.commonHash
+		if fdst.Features().SlowHash {
+			hashType = hash.None
+		}
+		s.destState, err = newDestState(ctx, fdst, ci.DestState, hashType, ci.DestStateRefresh)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(ci.OnDirComplete) > 0 && deleteMode != fs.DeleteModeOnly {
+		s.dirTracker = newDirTracker()
+		s.dirQueue = newDirQueue()
+	}
+	if ci.RenameMap != "" {
+		s.pathMap, err = readPathMap(ci.RenameMap)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if s.destEmpty {
+		if ci.DestState != "" {
+			return nil, errors.New("can't use --dest-empty with --dest-state")
+		}
+		err = checkDestEmpty(ctx, fdst, s.dir)
+		if err != nil {
+			return nil, err
+		}
+	}
 	// Make Fs for --backup-dir if required
 	if ci.BackupDir != "" || ci.Suffix != "" {
 		var err error
@@ -269,6 +347,14 @@ func newSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.Delete
 			return nil, err
 		}
 	}
+	// Make Fs for --quarantine-dir if required
+	if ci.QuarantineDir != "" {
+		var err error
+		s.quarantineDir, err = operations.QuarantineDir(ctx, fdst, fsrc)
+		if err != nil {
+			return nil, err
+		}
+	}
 	if len(ci.CompareDest) > 0 {
 		var err error
 		s.compareCopyDest, err = operations.GetCompareDest(ctx)
@@ -370,6 +456,8 @@ func (s *syncCopyMove) pairChecker(in *pipe, out *pipe, fraction int, wg *sync.W
 		}
 		src := pair.Src
 		var err error
+		var dirErr error   // error to report for --on-dir-complete
+		forwarded := false // set if the pair is sent on to be transferred
 		tr := accounting.Stats(s.ctx).NewCheckingTransfer(src, "checking")
 		// Check to see if can store this
 		if src.Storable() {
@@ -385,12 +473,21 @@ func (s *syncCopyMove) pairChecker(in *pipe, out *pipe, fraction int, wg *sync.W
 				}
 			}
 			// Fix case for case insensitive filesystems
-			if s.ci.FixCase && !s.ci.Immutable && src.Remote() != pair.Dst.Remote() {
-				if newDst, err := operations.Move(s.ctx, s.fdst, pair.Dst, src.Remote(), pair.Dst); err != nil {
-					fs.Errorf(pair.Dst, "Error while attempting to rename to %s: %v", src.Remote(), err)
+			if s.ci.FixCase && !s.ci.Immutable && s.dstRemote(src) != pair.Dst.Remote() {
+				if s.destState != nil {
+					pair.Dst = destStateRealObject(s.ctx, pair.Dst)
+				}
+				if pair.Dst == nil {
+					needTransfer = true
+				} else if newDst, err := operations.Move(s.ctx, s.fdst, pair.Dst, s.dstRemote(src), pair.Dst); err != nil {
+					fs.Errorf(pair.Dst, "Error while attempting to rename to %s: %v", s.dstRemote(src), err)
 					s.processError(err)
 				} else {
-					fs.Infof(pair.Dst, "Fixed case by renaming to: %s", src.Remote())
+					fs.Infof(pair.Dst, "Fixed case by renaming to: %s", s.dstRemote(src))
+					if s.destState != nil {
+						s.destState.remove(pair.Dst.Remote())
+						s.destState.set(newDst)
+					}
 					pair.Dst = newDst
 				}
 			}
@@ -399,19 +496,28 @@ func (s *syncCopyMove) pairChecker(in *pipe, out *pipe, fraction int, wg *sync.W
 				if s.ci.Immutable && pair.Dst != nil {
 					err := fs.CountError(fserrors.NoRetryError(fs.ErrorImmutableModified))
 					fs.Errorf(pair.Dst, "Source and destination exist but do not match: %v", err)
+					accounting.Stats(s.ctx).Skipped(accounting.SkipError, 1)
 					s.processError(err)
+					dirErr = err
 				} else {
 					if pair.Dst != nil {
 						s.markDirModifiedObject(pair.Dst)
 					} else {
 						s.markDirModifiedObject(src)
 					}
-					// If destination already exists, then we must move it into --backup-dir if required
-					if pair.Dst != nil && s.backupDir != nil {
-						err := operations.MoveBackupDir(s.ctx, s.backupDir, pair.Dst)
+					// If destination already exists, then we must move it into --backup-dir or --quarantine-dir if required
+					keepDst := s.keepDst(src, pair.Dst)
+					if keepDst != nil && s.destState != nil {
+						s.destState.remove(pair.Dst.Remote())
+						pair.Dst = destStateRealObject(s.ctx, pair.Dst)
+					}
+					if keepDst != nil {
+						err := keepDst(s.ctx, pair.Dst)
 						if err != nil {
+							accounting.Stats(s.ctx).Skipped(accounting.SkipError, 1)
 							s.processError(err)
 							s.logger(s.ctx, operations.TransferError, pair.Src, pair.Dst, err)
+							dirErr = err
 						} else {
 							// If successful zero out the dst as it is no longer there and copy the file
 							pair.Dst = nil
@@ -419,21 +525,27 @@ func (s *syncCopyMove) pairChecker(in *pipe, out *pipe, fraction int, wg *sync.W
 							if !ok {
 								return
 							}
+							forwarded = true
 						}
 					} else {
 						ok = out.Put(s.inCtx, pair)
 						if !ok {
 							return
 						}
+						forwarded = true
 					}
 				}
 			} else {
+				// The destination is up to date with the source
+				if s.inodes != nil {
+					s.inodes.put(src)
+				}
 				// If moving need to delete the files we don't need to copy
 				if s.DoMove {
 					// Delete src if no error on copy
 					if operations.SameObject(src, pair.Dst) {
 						fs.Logf(src, "Not removing source file as it is the same file as the destination")
-					} else if s.ci.IgnoreExisting {
+					} else if s.ci.IgnoreExisting || s.ci.NoUpdateExisting {
 						fs.Debugf(src, "Not removing source file as destination file exists and --ignore-existing is set")
 					} else if s.checkFirst && s.ci.OrderBy != "" {
 						// If we want perfect ordering then use the transfers to delete the file
@@ -443,14 +555,19 @@ func (s *syncCopyMove) pairChecker(in *pipe, out *pipe, fraction int, wg *sync.W
 						if !ok {
 							return
 						}
+						forwarded = true
 					} else {
 						deleteFileErr := operations.DeleteFile(s.ctx, src)
 						s.processError(deleteFileErr)
 						s.logger(s.ctx, operations.TransferError, pair.Src, pair.Dst, deleteFileErr)
+						dirErr = deleteFileErr
 					}
 				}
 			}
 		}
+		if !forwarded {
+			s.dirDone(src, dirErr)
+		}
 		tr.Done(s.ctx, err)
 	}
 }
@@ -472,6 +589,8 @@ func (s *syncCopyMove) pairRenamer(in *pipe, out *pipe, fraction int, wg *sync.W
 			if !ok {
 				return
 			}
+		} else {
+			s.dirDone(src, nil)
 		}
 	}
 }
@@ -487,28 +606,38 @@ func (s *syncCopyMove) pairCopyOrMove(ctx context.Context, in *pipe, fdst fs.Fs,
 		}
 		src := pair.Src
 		dst := pair.Dst
+		var newDst fs.Object
 		if s.DoMove {
 			if src != dst {
-				_, err = operations.MoveTransfer(ctx, fdst, dst, src.Remote(), src)
+				newDst, err = operations.MoveTransfer(ctx, fdst, dst, s.dstRemote(src), src)
 			} else {
 				// src == dst signals delete the src
 				err = operations.DeleteFile(ctx, src)
 			}
 		} else {
-			_, err = operations.Copy(ctx, fdst, dst, src.Remote(), src)
+			newDst, err = operations.Copy(ctx, fdst, dst, s.dstRemote(src), src)
+		}
+		if err == nil && newDst != nil && s.destState != nil {
+			s.destState.set(newDst)
+		}
+		// Only record the inode once the transfer has succeeded
+		if err == nil && newDst != nil && s.inodes != nil {
+			s.inodes.put(src)
 		}
 		s.processError(err)
 		if err != nil {
 			s.logger(ctx, operations.TransferError, src, dst, err)
 		}
+		s.dirDone(src, err)
 	}
 }
 
 // This starts the background checkers.
 func (s *syncCopyMove) startCheckers() {
-	s.checkerWg.Add(s.ci.Checkers)
-	for i := 0; i < s.ci.Checkers; i++ {
-		fraction := (100 * i) / s.ci.Checkers
+	checkers := s.ci.CheckersFor(s.fsrc, s.fdst)
+	s.checkerWg.Add(checkers)
+	for i := 0; i < checkers; i++ {
+		fraction := (100 * i) / checkers
 		go s.pairChecker(s.toBeChecked, s.toBeUploaded, fraction, &s.checkerWg)
 	}
 }
@@ -541,9 +670,10 @@ func (s *syncCopyMove) startRenamers() {
 	if !s.trackRenames {
 		return
 	}
-	s.renamerWg.Add(s.ci.Checkers)
-	for i := 0; i < s.ci.Checkers; i++ {
-		fraction := (100 * i) / s.ci.Checkers
+	checkers := s.ci.CheckersFor(s.fsrc, s.fdst)
+	s.renamerWg.Add(checkers)
+	for i := 0; i < checkers; i++ {
+		fraction := (100 * i) / checkers
 		go s.pairRenamer(s.toBeRenamed, s.toBeUploaded, fraction, &s.renamerWg)
 	}
 }
@@ -589,7 +719,12 @@ func (s *syncCopyMove) startDeleters() {
 	s.deletersWg.Add(1)
 	go func() {
 		defer s.deletersWg.Done()
-		err := operations.DeleteFilesWithBackupDir(s.ctx, s.deleteFilesCh, s.backupDir)
+		var err error
+		if s.quarantineDir != nil {
+			err = operations.QuarantineFiles(s.ctx, s.deleteFilesCh, s.quarantineDir)
+		} else {
+			err = operations.DeleteFilesWithBackupDir(s.ctx, s.deleteFilesCh, s.backupDir)
+		}
 		s.processError(err)
 	}()
 }
@@ -638,6 +773,13 @@ func (s *syncCopyMove) deleteFiles(checkSrcMap bool) error {
 			if s.aborting() {
 				break
 			}
+			if s.destState != nil {
+				s.destState.remove(remote)
+				o = destStateRealObject(s.ctx, o)
+				if o == nil {
+					continue
+				}
+			}
 			select {
 			case <-s.ctx.Done():
 				break outer
@@ -646,7 +788,46 @@ func (s *syncCopyMove) deleteFiles(checkSrcMap bool) error {
 		}
 		close(toDelete)
 	}()
-	return operations.DeleteFilesWithBackupDir(s.ctx, toDelete, s.backupDir)
+	if s.quarantineDir != nil {
+		return operations.QuarantineFiles(s.ctx, toDelete, s.quarantineDir)
+	}
+	return operations.DeleteFilesBatched(s.ctx, s.fdst, toDelete, s.backupDir, s.ci.DeleteAfterConcurrency)
+}
+
+// keepDst returns the function to move dst out of the way before src
+// overwrites it, or nil if dst can be overwritten.
+//
+// If dst is newer than src it may have been changed in the
+// destination, so it is moved into --quarantine-dir if set, otherwise
+// it is moved into --backup-dir if set.
+func (s *syncCopyMove) keepDst(src, dst fs.Object) func(ctx context.Context, dst fs.Object) error {
+	if dst == nil {
+		return nil
+	}
+	if s.quarantineDir != nil && s.isAmbiguous(src, dst) {
+		return func(ctx context.Context, dst fs.Object) error {
+			return operations.MoveQuarantineDir(ctx, s.quarantineDir, dst)
+		}
+	}
+	if s.backupDir != nil {
+		return func(ctx context.Context, dst fs.Object) error {
+			return operations.MoveBackupDir(ctx, s.backupDir, dst)
+		}
+	}
+	return nil
+}
+
+// isAmbiguous returns true if dst, which src is about to overwrite,
+// is newer than src so may hold changes which aren't in src.
+//
+// If the modification times can't be compared then dst is assumed
+// to be ambiguous.
+func (s *syncCopyMove) isAmbiguous(src, dst fs.Object) bool {
+	modifyWindow := fs.GetModifyWindow(s.ctx, s.fsrc, s.fdst)
+	if modifyWindow == fs.ModTimeNotSupported {
+		return true
+	}
+	return dst.ModTime(s.ctx).Sub(src.ModTime(s.ctx)) > modifyWindow
 }
 
 // This deletes the empty directories in the slice passed in.  It
@@ -751,6 +932,8 @@ func parseTrackRenamesStrategy(strategies string) (strategy trackRenamesStrategy
 			strategy |= trackRenamesStrategyModtime
 		case "leaf":
 			strategy |= trackRenamesStrategyLeaf
+		case "inode":
+			strategy |= trackRenamesStrategyInode
 		case "size":
 			// ignore
 		default:
@@ -791,9 +974,31 @@ func (s *syncCopyMove) renameID(obj fs.Object, renamesStrategy trackRenamesStrat
 		builder.WriteString(path.Base(obj.Remote()))
 	}
 
+	if renamesStrategy.inode() {
+		inode := s.sourceInode(obj)
+		if inode == "" {
+			return ""
+		}
+		builder.WriteRune(',')
+		builder.WriteString(inode)
+	}
+
 	return builder.String()
 }
 
+// sourceInode returns the inode of the source file obj was synced
+// from if obj is in the destination, or the inode of obj if it is in
+// the source. It returns "" if the inode isn't known.
+func (s *syncCopyMove) sourceInode(obj fs.Object) string {
+	if obj.Fs() == fs.Info(s.fdst) {
+		return s.inodes.get(obj.Remote())
+	}
+	if do, ok := obj.(fs.Inoder); ok {
+		return do.Inode()
+	}
+	return ""
+}
+
 // pushRenameMap adds the object with hash to the rename map
 func (s *syncCopyMove) pushRenameMap(hash string, obj fs.Object) {
 	s.renameMapMu.Lock()
@@ -812,7 +1017,10 @@ func (s *syncCopyMove) popRenameMap(hash string, src fs.Object) (dst fs.Object)
 		i := 0
 
 		// If using track renames strategy modtime then we need to check the modtimes here
-		if s.trackRenamesStrategy.modTime() {
+		//
+		// Do this for strategy inode too as inodes may be reused
+		// by the filesystem for a different file
+		if s.trackRenamesStrategy.modTime() || s.trackRenamesStrategy.inode() {
 			i = -1
 			srcModTime := src.ModTime(s.ctx)
 			for j, dst := range dsts {
@@ -853,14 +1061,15 @@ func (s *syncCopyMove) makeRenameMap() {
 	}
 
 	// pump all the dstFiles into in
-	in := make(chan fs.Object, s.ci.Checkers)
+	checkers := s.ci.CheckersFor(s.fdst)
+	in := make(chan fs.Object, checkers)
 	go s.pumpMapToChan(s.dstFiles, in)
 
 	// now make a map of size,hash for all dstFiles
 	s.renameMap = make(map[string][]fs.Object)
 	var wg sync.WaitGroup
-	wg.Add(s.ci.Checkers)
-	for i := 0; i < s.ci.Checkers; i++ {
+	wg.Add(checkers)
+	for i := 0; i < checkers; i++ {
 		go func() {
 			defer wg.Done()
 			for obj := range in {
@@ -897,22 +1106,39 @@ func (s *syncCopyMove) tryRename(src fs.Object) bool {
 	if dst == nil {
 		return false
 	}
+	if s.destState != nil {
+		dst = destStateRealObject(s.ctx, dst)
+		if dst == nil {
+			return false
+		}
+	}
 
 	// Find dst object we are about to overwrite if it exists
 	dstOverwritten, _ := s.fdst.NewObject(s.ctx, src.Remote())
 
 	// Rename dst to have name src.Remote()
-	_, err := operations.Move(s.ctx, s.fdst, dstOverwritten, src.Remote(), dst)
+	newDst, err := operations.Move(s.ctx, s.fdst, dstOverwritten, src.Remote(), dst)
 	if err != nil {
 		fs.Debugf(src, "Failed to rename to %q: %v", dst.Remote(), err)
 		return false
 	}
 
+	if s.destState != nil {
+		s.destState.remove(dst.Remote())
+		if newDst != nil {
+			s.destState.set(newDst)
+		}
+	}
+
 	// remove file from dstFiles if present
 	s.dstFilesMu.Lock()
 	delete(s.dstFiles, dst.Remote())
 	s.dstFilesMu.Unlock()
 
+	if s.inodes != nil {
+		s.inodes.put(src)
+	}
+
 	fs.Infof(src, "Renamed from %q", dst.Remote())
 	return true
 }
@@ -925,6 +1151,9 @@ func (s *syncCopyMove) tryRename(src fs.Object) bool {
 //
 // dir is the start directory, "" for root
 func (s *syncCopyMove) run() error {
+	if s.inodes != nil {
+		defer s.inodes.close()
+	}
 	if operations.Same(s.fdst, s.fsrc) {
 		fs.Errorf(s.fdst, "Nothing to do as source and destination are the same")
 		return nil
@@ -937,6 +1166,7 @@ func (s *syncCopyMove) run() error {
 		s.startTransfers()
 	}
 	s.startDeleters()
+	s.startDirCompleters()
 	s.dstFiles = make(map[string]fs.Object)
 
 	s.startTrackRenames()
@@ -950,11 +1180,17 @@ func (s *syncCopyMove) run() error {
 		NoTraverse:             s.noTraverse,
 		Callback:               s,
 		DstIncludeAll:          s.fi.Opt.DeleteExcluded,
-		NoCheckDest:            s.noCheckDest,
+		NoCheckDest:            s.noCheckDest || s.destEmpty,
 		NoUnicodeNormalization: s.noUnicodeNormalization,
 	}
+	if s.destState != nil {
+		m.FdstList = s.destState.lister()
+	}
 	s.processError(m.Run(s.ctx))
 
+	// Transfer renamed files now the march won't see them arriving
+	s.transferPathMapped()
+
 	s.stopTrackRenames()
 	if s.trackRenames {
 		// Build the map of the remaining dstFiles by hash
@@ -977,6 +1213,7 @@ func (s *syncCopyMove) run() error {
 	s.stopRenamers()
 	s.stopTransfers()
 	s.stopDeleters()
+	s.stopDirCompleters()
 
 	if s.copyEmptySrcDirs {
 		s.processError(copyEmptyDirectories(s.ctx, s.fdst, s.srcEmptyDirs))
@@ -1022,6 +1259,15 @@ func (s *syncCopyMove) run() error {
 		s.processError(ErrorMaxDurationReachedFatal)
 	}
 
+	// Save the state of the destination for next time if it can be trusted
+	if s.destState != nil && !s.ci.DryRun {
+		if s.currentError() != nil {
+			s.destState.discard()
+		} else {
+			s.processError(s.destState.save(s.ctx))
+		}
+	}
+
 	// Print nothing to transfer message if there were no transfers and no errors
 	if s.deleteMode != fs.DeleteModeOnly && accounting.Stats(s.ctx).GetTransfers() == 0 && s.currentError() == nil {
 		fs.Infof(nil, "There was nothing to transfer")
@@ -1035,6 +1281,13 @@ func (s *syncCopyMove) run() error {
 
 // DstOnly have an object which is in the destination only
 func (s *syncCopyMove) DstOnly(dst fs.DirEntry) (recurse bool) {
+	if dstX, ok := dst.(fs.Object); ok && s.destState != nil {
+		s.destState.set(dstX)
+	}
+	if s.pathMap.isTarget(dst.Remote()) {
+		// Leave files source files are renamed to
+		return false
+	}
 	if s.deleteMode == fs.DeleteModeOff {
 		if s.usingLogger {
 			switch x := dst.(type) {
@@ -1060,10 +1313,18 @@ func (s *syncCopyMove) DstOnly(dst fs.DirEntry) (recurse bool) {
 			s.dstFiles[x.Remote()] = x
 			s.dstFilesMu.Unlock()
 		case fs.DeleteModeDuring, fs.DeleteModeOnly:
+			var o fs.Object = x
+			if s.destState != nil {
+				s.destState.remove(x.Remote())
+				o = destStateRealObject(s.ctx, x)
+				if o == nil {
+					return false
+				}
+			}
 			select {
 			case <-s.ctx.Done():
 				return
-			case s.deleteFilesCh <- x:
+			case s.deleteFilesCh <- o:
 			}
 		default:
 			panic(fmt.Sprintf("unexpected delete mode %d", s.deleteMode))
@@ -1105,6 +1366,184 @@ func (s *syncCopyMove) markDirModifiedObject(o fs.Object) {
 	s.markDirModified(dir)
 }
 
+// dirAdd records src is being transferred for --on-dir-complete
+func (s *syncCopyMove) dirAdd(src fs.Object) {
+	if s.dirTracker == nil {
+		return
+	}
+	if _, renamed := s.pathMap.rename(src.Remote()); renamed {
+		return
+	}
+	s.dirTracker.add(src.Remote())
+}
+
+// dirDone records the transfer of src has finished for
+// --on-dir-complete
+func (s *syncCopyMove) dirDone(src fs.Object, err error) {
+	if s.dirTracker == nil {
+		return
+	}
+	if _, renamed := s.pathMap.rename(src.Remote()); renamed {
+		return
+	}
+	s.dirsComplete(s.dirTracker.done(src.Remote(), err))
+}
+
+// MarchedDir is called by the march once all the entries of dir
+// have been seen
+func (s *syncCopyMove) MarchedDir(dir string, subdirs []string) {
+	if s.dirTracker == nil {
+		return
+	}
+	s.dirsComplete(s.dirTracker.marched(dir, subdirs))
+}
+
+// dirsComplete queues the --on-dir-complete command to run for each
+// of dirs
+func (s *syncCopyMove) dirsComplete(dirs []string) {
+	for _, dir := range dirs {
+		if operations.SkipDestructive(s.ctx, fs.LogDirName(s.fdst, dir), "run on dir complete command") {
+			continue
+		}
+		s.dirQueue.put(dir)
+	}
+}
+
+// This starts the background runner for the --on-dir-complete command
+//
+// The commands are run one at a time in the order the directories
+// complete so the command for a directory runs after the commands for
+// its subdirectories.
+func (s *syncCopyMove) startDirCompleters() {
+	if s.dirQueue == nil {
+		return
+	}
+	s.dirCompleteWg.Add(1)
+	go func() {
+		defer s.dirCompleteWg.Done()
+		for {
+			dir, ok := s.dirQueue.get()
+			if !ok {
+				return
+			}
+			err := runDirComplete(s.ctx, s.ci.OnDirComplete, dir)
+			if err != nil {
+				err = fs.CountError(err)
+				fs.Errorf(fs.LogDirName(s.fdst, dir), "%v", err)
+				s.processError(err)
+			}
+		}
+	}()
+}
+
+// This stops the background runner for the --on-dir-complete command
+// once it has run the commands queued
+func (s *syncCopyMove) stopDirCompleters() {
+	if s.dirQueue == nil {
+		return
+	}
+	s.dirQueue.close()
+	s.dirCompleteWg.Wait()
+}
+
+// dstRemote returns the path on the destination src should be
+// transferred to.
+func (s *syncCopyMove) dstRemote(src fs.Object) string {
+	remote, _ := s.pathMap.rename(src.Remote())
+	return remote
+}
+
+// renameMapped records src to be transferred to its new path if it
+// is in the --rename-map, returning true if it was dealt with.
+//
+// oldDst is the file at the old path on the destination or nil. This
+// is deleted if syncing as nothing is transferred to it any more.
+//
+// If a file is renamed to the path of src then src is recorded to be
+// transferred after the march, as only then is it known whether the
+// file renamed to it is in the source.
+func (s *syncCopyMove) renameMapped(src fs.Object, oldDst fs.Object) bool {
+	_, renamed := s.pathMap.rename(src.Remote())
+	if !renamed {
+		if s.pathMap.isTarget(src.Remote()) {
+			s.dirAdd(src)
+			s.pathMappedMu.Lock()
+			s.pathTargets = append(s.pathTargets, fs.ObjectPair{Src: src, Dst: oldDst})
+			s.pathMappedMu.Unlock()
+			return true
+		}
+		return false
+	}
+	if oldDst != nil {
+		s.DstOnly(oldDst)
+	}
+	s.pathMappedMu.Lock()
+	s.pathMapped = append(s.pathMapped, src)
+	s.pathMappedMu.Unlock()
+	return true
+}
+
+// transferPathMapped sends the files recorded by renameMapped to be
+// transferred to their new paths.
+//
+// This is done after the march, otherwise the march could find files
+// being transferred to directories it hasn't listed yet and delete
+// them.
+//
+// Source files at the new path of a file in the source are an error
+// as they would be overwritten. Otherwise they are transferred as
+// normal.
+func (s *syncCopyMove) transferPathMapped() {
+	renamedTo := make(map[string]struct{}, len(s.pathMapped))
+	for _, src := range s.pathMapped {
+		renamedTo[s.dstRemote(src)] = struct{}{}
+	}
+	for _, pair := range s.pathTargets {
+		if _, found := renamedTo[pair.Src.Remote()]; found {
+			err := fserrors.NoRetryError(errors.New("source file collides with a file renamed to it by --rename-map"))
+			fs.Errorf(pair.Src, "%v", err)
+			s.processError(err)
+			s.logger(s.ctx, operations.TransferError, pair.Src, pair.Dst, err)
+			s.dirDone(pair.Src, err)
+			continue
+		}
+		if !s.sendPathMapped(pair.Src, pair.Dst) {
+			return
+		}
+	}
+	for _, src := range s.pathMapped {
+		newRemote := s.dstRemote(src)
+		dst, err := s.fdst.NewObject(s.ctx, newRemote)
+		if errors.Is(err, fs.ErrorObjectNotFound) {
+			dst = nil
+		} else if err != nil {
+			err = fmt.Errorf("failed to find %q to rename to with --rename-map: %w", newRemote, err)
+			fs.Errorf(src, "%v", err)
+			s.processError(err)
+			s.logger(s.ctx, operations.TransferError, src, nil, err)
+			continue
+		}
+		fs.Debugf(src, "Renaming to %q with --rename-map", newRemote)
+		if !s.sendPathMapped(src, dst) {
+			return
+		}
+	}
+}
+
+// sendPathMapped sends src to be checked against dst, or uploaded if
+// dst is nil, returning false if the sync is finishing.
+func (s *syncCopyMove) sendPathMapped(src, dst fs.Object) bool {
+	if dst == nil {
+		dir := path.Dir(s.dstRemote(src))
+		if dir == "." {
+			dir = ""
+		}
+		s.markDirModified(dir)
+		return s.toBeUploaded.Put(s.inCtx, fs.ObjectPair{Src: src, Dst: nil})
+	}
+	return s.toBeChecked.Put(s.inCtx, fs.ObjectPair{Src: src, Dst: dst})
+}
+
 // copyDirMetadata copies the src directory modTime or Metadata to dst
 // or f if nil. If dst is nil then it uses dir as the name of the new
 // directory.
@@ -1221,6 +1660,10 @@ func (s *syncCopyMove) SrcOnly(src fs.DirEntry) (recurse bool) {
 		s.srcParentDirCheck(src)
 		s.srcEmptyDirsMu.Unlock()
 
+		if s.renameMapped(x, nil) {
+			return false
+		}
+		s.dirAdd(x)
 		if s.trackRenames {
 			// Save object to check for a rename later
 			select {
@@ -1243,6 +1686,8 @@ func (s *syncCopyMove) SrcOnly(src fs.DirEntry) (recurse bool) {
 				if !ok {
 					return
 				}
+			} else {
+				s.dirDone(x, err)
 			}
 		}
 	case fs.Directory:
@@ -1272,11 +1717,22 @@ func (s *syncCopyMove) Match(ctx context.Context, dst, src fs.DirEntry) (recurse
 		s.srcParentDirCheck(src)
 		s.srcEmptyDirsMu.Unlock()
 
+		if dstX, ok := dst.(fs.Object); ok && s.destState != nil {
+			s.destState.set(dstX)
+		}
 		if s.deleteMode == fs.DeleteModeOnly {
+			if _, renamed := s.pathMap.rename(srcX.Remote()); renamed {
+				// Nothing is transferred to the old path so delete it
+				s.DstOnly(dst)
+			}
 			return false
 		}
 		dstX, ok := dst.(fs.Object)
 		if ok {
+			if s.renameMapped(srcX, dstX) {
+				return false
+			}
+			s.dirAdd(srcX)
 			// No logger here because we'll handle it in equal()
 			ok = s.toBeChecked.Put(s.inCtx, fs.ObjectPair{Src: srcX, Dst: dstX})
 			if !ok {
@@ -1342,6 +1798,14 @@ func runSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.Delete
 	if deleteMode != fs.DeleteModeOff && DoMove {
 		return fserrors.FatalError(errors.New("can't delete and move at the same time"))
 	}
+	isSync := deleteMode != fs.DeleteModeOff
+	if filter.GetConfig(ctx).NeedsSample() {
+		var err error
+		ctx, err = sampleFiles(ctx, fsrc)
+		if err != nil {
+			return err
+		}
+	}
 	// Run an extra pass to delete only
 	if deleteMode == fs.DeleteModeBefore {
 		if ci.TrackRenames {
@@ -1363,7 +1827,91 @@ func runSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.Delete
 	if err != nil {
 		return err
 	}
-	return do.run()
+	err = do.run()
+	if err != nil || !ci.VerifyAfterSync {
+		return err
+	}
+	return verifyAfterSync(ctx, fdst, fsrc, isSync, DoMove)
+}
+
+// verifyAfterSync checks the destination matches the source after a
+// successful sync or copy for --verify-after-sync.
+//
+// It checks the files in both have the same sizes, and the same
+// hashes with --checksum. After a copy it only checks the source
+// files are in the destination.
+func verifyAfterSync(ctx context.Context, fdst, fsrc fs.Fs, isSync bool, isMove bool) error {
+	ci := fs.GetConfig(ctx)
+	if isMove {
+		fs.Logf(fdst, "Not verifying after move as the source files have been moved")
+		return nil
+	}
+	if ci.DryRun {
+		fs.Logf(fdst, "Not verifying after sync as --dry-run is set")
+		return nil
+	}
+	fs.Infof(fdst, "Verifying destination matches source")
+	opt := &operations.CheckOpt{
+		Fdst:   fdst,
+		Fsrc:   fsrc,
+		OneWay: !isSync,
+	}
+	var err error
+	if ci.CheckSum {
+		err = operations.Check(ctx, opt)
+	} else {
+		// The sizes have already been compared
+		opt.Check = func(ctx context.Context, dst, src fs.Object) (differ bool, noHash bool, err error) {
+			return false, false, nil
+		}
+		err = operations.CheckFn(ctx, opt)
+	}
+	if err != nil {
+		return fmt.Errorf("verify after sync failed: %w", err)
+	}
+	return nil
+}
+
+// sampleFiles lists fsrc and returns a new context with a filter
+// which only includes the --sample-count files chosen from it.
+func sampleFiles(ctx context.Context, fsrc fs.Fs) (context.Context, error) {
+	ci := fs.GetConfig(ctx)
+	var remotes []string
+	err := walk.ListR(ctx, fsrc, "", false, ci.MaxDepth, walk.ListObjects, func(entries fs.DirEntries) error {
+		entries.ForObject(func(o fs.Object) {
+			remotes = append(remotes, o.Remote())
+		})
+		return nil
+	})
+	if err != nil {
+		return ctx, fmt.Errorf("failed to list source for --sample-count: %w", err)
+	}
+	newFi := *filter.GetConfig(ctx)
+	n := len(remotes)
+	newFi.SetSample(remotes)
+	if n > newFi.Opt.SampleCount {
+		n = newFi.Opt.SampleCount
+	}
+	fs.Infof(fsrc, "Chose a sample of %d files from %d", n, len(remotes))
+	return filter.ReplaceConfig(ctx, &newFi), nil
+}
+
+// checkDestEmpty checks the destination is empty for --dest-empty.
+//
+// This only lists the top level of the destination so is cheap
+// compared to listing all of it.
+func checkDestEmpty(ctx context.Context, fdst fs.Fs, dir string) error {
+	entries, err := fdst.List(ctx, dir)
+	if errors.Is(err, fs.ErrorDirNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check destination is empty for --dest-empty: %w", err)
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("can't use --dest-empty as the destination isn't empty: found %q", entries[0].Remote())
+	}
+	return nil
 }
 
 // Sync fsrc into fdst
@@ -1390,8 +1938,9 @@ func MoveDir(ctx context.Context, fdst, fsrc fs.Fs, deleteEmptySrcDirs bool, cop
 		return nil
 	}
 
-	// First attempt to use DirMover if exists, same Fs and no filters are active
-	if fdstDirMove := fdst.Features().DirMove; fdstDirMove != nil && operations.SameConfig(fsrc, fdst) && fi.InActive() {
+	// First attempt to use DirMover if exists, same Fs and no filters are active.
+	// Don't use it with --queue so the moves of the files are queued.
+	if fdstDirMove := fdst.Features().DirMove; fdstDirMove != nil && operations.SameConfig(fsrc, fdst) && fi.InActive() && fs.GetConfig(ctx).Queue == "" {
 		if operations.SkipDestructive(ctx, fdst, "server-side directory move") {
 			return nil
 		}
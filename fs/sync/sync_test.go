@@ -10,6 +10,7 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"sort"
 	"strings"
@@ -25,8 +26,10 @@ import (
 	"github.com/rclone/rclone/fs/filter"
 	"github.com/rclone/rclone/fs/fserrors"
 	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
 	"github.com/rclone/rclone/fs/operations"
 	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/lib/kv"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/text/unicode/norm"
@@ -245,6 +248,173 @@ func TestCopyWithDepth(t *testing.T) {
 	r.CheckRemoteItems(t, file2)
 }
 
+// Test sync with depth doesn't traverse or delete deeper directories
+func TestSyncWithDepth(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	file1 := r.WriteFile("hello world", "hello world", t1)
+	file2 := r.WriteFile("sub dir/hello world2", "hello world2", t2)
+	file3 := r.WriteFile("sub dir/deep dir/hello world3", "hello world3", t1)
+	file4 := r.WriteObject(ctx, "sub dir/deep dir/dst only", "dst only", t1)
+	file5 := r.WriteObject(ctx, "sub dir/dst only", "dst only", t1)
+
+	ci.MaxDepth = 2
+
+	accounting.GlobalStats().ResetCounters()
+	err := Sync(ctx, r.Fremote, r.Flocal, false)
+	require.NoError(t, err)
+
+	r.CheckLocalItems(t, file1, file2, file3)
+	r.CheckRemoteItems(t, file1, file2, file4)
+	assert.Equal(t, int64(1), accounting.GlobalStats().GetDeletes(), "only %v deleted", file5.Path)
+}
+
+// Test sync with --set-modtime gives all the files the time set
+// and that syncing again doesn't transfer anything
+func TestSyncSetModTime(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	file1 := r.WriteFile("file1", "file1 contents", t1)
+	file2 := r.WriteFile("sub dir/file2", "file2 contents", t2)
+
+	ci.SetModTime = fs.Time(t3)
+
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, Sync(ctx, r.Fremote, r.Flocal, false))
+	assert.Equal(t, int64(2), accounting.GlobalStats().GetTransfers())
+
+	r.CheckLocalItems(t, file1, file2)
+	remote1, remote2 := file1, file2
+	remote1.ModTime, remote2.ModTime = t3, t3
+	r.CheckRemoteItems(t, remote1, remote2)
+
+	// Nothing to do the second time
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, Sync(ctx, r.Fremote, r.Flocal, false))
+	assert.Equal(t, int64(0), accounting.GlobalStats().GetTransfers())
+	r.CheckRemoteItems(t, remote1, remote2)
+
+	// A changed file is transferred with the time set
+	file1 = r.WriteFile("file1", "file1 new contents", t2)
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, Sync(ctx, r.Fremote, r.Flocal, false))
+	assert.Equal(t, int64(1), accounting.GlobalStats().GetTransfers())
+	remote1 = file1
+	remote1.ModTime = t3
+	r.CheckRemoteItems(t, remote1, remote2)
+}
+
+// listFs records the directories listed
+type listFs struct {
+	fs.Fs
+	mu    mutex.Mutex
+	lists []string
+}
+
+// List the objects and directories in dir into entries
+func (f *listFs) List(ctx context.Context, dir string) (fs.DirEntries, error) {
+	f.mu.Lock()
+	f.lists = append(f.lists, dir)
+	f.mu.Unlock()
+	return f.Fs.List(ctx, dir)
+}
+
+// lossyFs is a fs.Fs which loses the upload of the file called lose
+// after it has been uploaded
+type lossyFs struct {
+	fs.Fs
+	lose string
+}
+
+// Put the object then remove it again if it should be lost
+func (f *lossyFs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	o, err := f.Fs.Put(ctx, in, src, options...)
+	if err == nil && src.Remote() == f.lose {
+		err = o.Remove(ctx)
+	}
+	return o, err
+}
+
+// Test --verify-after-sync catches differences left after the sync
+func TestSyncVerifyAfterSync(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	file1 := r.WriteFile("file1", "file1 contents", t1)
+	file2 := r.WriteFile("sub dir/file2", "file2 contents", t2)
+	r.Mkdir(ctx, r.Fremote)
+	fdst := &lossyFs{Fs: r.Fremote, lose: "sub dir/file2"}
+	ci.Inplace = true        // so the file is uploaded with its own name
+	ci.IgnoreChecksum = true // so the lost file isn't read after uploading
+
+	// Without verifying the lost file isn't noticed
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, Sync(ctx, fdst, r.Flocal, false))
+	r.CheckRemoteItems(t, file1)
+
+	// With verifying the sync fails
+	ci.VerifyAfterSync = true
+	accounting.GlobalStats().ResetCounters()
+	err := Sync(ctx, fdst, r.Flocal, false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "verify after sync failed")
+	assert.Contains(t, err.Error(), "1 differences found")
+
+	// Once the sync has converged it passes
+	fdst.lose = ""
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, Sync(ctx, fdst, r.Flocal, false))
+	r.CheckRemoteItems(t, file1, file2)
+
+	// A file only on the destination is a difference after a
+	// sync but not after a copy
+	file3 := r.WriteObject(ctx, "file3", "file3 contents", t3)
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, CopyDir(ctx, fdst, r.Flocal, false))
+	r.CheckRemoteItems(t, file1, file2, file3)
+
+	// With --checksum the hashes are checked too
+	ci.CheckSum = true
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, Sync(ctx, fdst, r.Flocal, false))
+	r.CheckRemoteItems(t, file1, file2)
+}
+
+// Test sync with --dest-empty transfers everything without listing
+// the destination and refuses to run if it isn't empty
+func TestSyncDestEmpty(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	file1 := r.WriteFile("file1", "file1 contents", t1)
+	file2 := r.WriteFile("sub dir/file2", "file2 contents", t2)
+	file3 := r.WriteFile("sub dir/deep dir/file3", "file3 contents", t3)
+	fdst := &listFs{Fs: r.Fremote}
+
+	ci.DestEmpty = true
+
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, Sync(ctx, fdst, r.Flocal, false))
+	assert.Equal(t, int64(3), accounting.GlobalStats().GetTransfers())
+	assert.Equal(t, []string{""}, fdst.lists, "only the root should be listed to check it is empty")
+	r.CheckRemoteItems(t, file1, file2, file3)
+
+	// The destination isn't empty now
+	fdst.lists = nil
+	accounting.GlobalStats().ResetCounters()
+	err := Sync(ctx, fdst, r.Flocal, false)
+	assert.ErrorContains(t, err, "destination isn't empty")
+	assert.Equal(t, int64(0), accounting.GlobalStats().GetTransfers())
+	assert.Equal(t, []string{""}, fdst.lists)
+
+	// Can't be used with --dest-state
+	ci.DestState = filepath.Join(t.TempDir(), "state.json")
+	err = CopyDir(ctx, r.Fremote, r.Flocal, false)
+	assert.ErrorContains(t, err, "--dest-empty with --dest-state")
+}
+
 // Test copy with files from
 func testCopyWithFilesFrom(t *testing.T, noTraverse bool) {
 	ctx := context.Background()
@@ -705,6 +875,115 @@ func TestSyncIgnoreExisting(t *testing.T) {
 	testLoggerVsLsf(ctx, r.Fremote, operations.GetLoggerOpt(ctx).JSON, t)
 }
 
+func TestCopyNoUpdateExisting(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	ci.NoUpdateExisting = true
+	flt, err := filter.NewFilter(nil)
+	require.NoError(t, err)
+	require.NoError(t, flt.AddRule("- *.tmp"))
+	ctx = filter.ReplaceConfig(ctx, flt)
+
+	existing := r.WriteObject(ctx, "existing", "potato", t1)
+	r.WriteFile("existing", "newer potatoes", t2)
+	newFile := r.WriteFile("new", "hello", t1)
+	r.WriteFile("excluded.tmp", "not me", t1)
+
+	accounting.GlobalStats().ResetCounters()
+	err = CopyDir(ctx, r.Fremote, r.Flocal, false)
+	require.NoError(t, err)
+
+	// The existing file must not be overwritten even though the
+	// source changed, and the excluded file isn't counted
+	r.CheckRemoteItems(t, existing, newFile)
+	assert.Equal(t, int64(1), accounting.GlobalStats().SkippedExisting(0))
+	assert.Equal(t, int64(1), accounting.GlobalStats().GetTransfers())
+
+	// Copying again leaves everything alone
+	accounting.GlobalStats().ResetCounters()
+	err = CopyDir(ctx, r.Fremote, r.Flocal, false)
+	require.NoError(t, err)
+	r.CheckRemoteItems(t, existing, newFile)
+	assert.Equal(t, int64(2), accounting.GlobalStats().SkippedExisting(0))
+	assert.Equal(t, int64(0), accounting.GlobalStats().GetTransfers())
+
+	// Flags which would modify existing files are refused
+	ci.TrackRenames = true
+	err = Sync(ctx, r.Fremote, r.Flocal, false)
+	assert.ErrorContains(t, err, "--track-renames")
+	ci.TrackRenames = false
+	ci.NoCheckDest = true
+	err = CopyDir(ctx, r.Fremote, r.Flocal, false)
+	assert.ErrorContains(t, err, "--no-check-dest")
+	ci.NoCheckDest = false
+	r.CheckRemoteItems(t, existing, newFile)
+}
+
+// Test the reasons files are skipped are counted in the stats
+func TestCopySkippedReasons(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	flt, err := filter.NewFilter(nil)
+	require.NoError(t, err)
+	require.NoError(t, flt.AddRule("- *.tmp"))
+	ctx = filter.ReplaceConfig(ctx, flt)
+
+	skipped := func() map[accounting.SkipReason]int64 {
+		out := map[accounting.SkipReason]int64{}
+		for _, reason := range []accounting.SkipReason{accounting.SkipUnchanged, accounting.SkipFiltered, accounting.SkipExisting, accounting.SkipNewer, accounting.SkipError} {
+			if n := accounting.GlobalStats().Skipped(reason, 0); n != 0 {
+				out[reason] = n
+			}
+		}
+		return out
+	}
+
+	r.WriteBoth(ctx, "unchanged", "potato", t1)
+	r.WriteObject(ctx, "newer", "newer potatoes", t3)
+	r.WriteFile("newer", "potato", t2)
+	r.WriteFile("changed", "tomatoes", t2)
+	r.WriteObject(ctx, "changed", "tomato", t1)
+	r.WriteFile("excluded.tmp", "not me", t1)
+	// Excluded files in the destination aren't counted
+	r.WriteObject(ctx, "excluded-dst.tmp", "not me either", t1)
+
+	// With --update the newer destination is skipped
+	ci.UpdateOlder = true
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, CopyDir(ctx, r.Fremote, r.Flocal, false))
+	assert.Equal(t, map[accounting.SkipReason]int64{
+		accounting.SkipUnchanged: 1,
+		accounting.SkipFiltered:  1,
+		accounting.SkipNewer:     1,
+	}, skipped())
+	assert.Equal(t, int64(1), accounting.GlobalStats().GetTransfers())
+	ci.UpdateOlder = false
+
+	// With --ignore-existing all the existing files are skipped
+	ci.IgnoreExisting = true
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, CopyDir(ctx, r.Fremote, r.Flocal, false))
+	assert.Equal(t, map[accounting.SkipReason]int64{
+		accounting.SkipFiltered: 1,
+		accounting.SkipExisting: 3,
+	}, skipped())
+	ci.IgnoreExisting = false
+
+	// With --immutable the changed file is skipped with an error
+	ci.Immutable = true
+	accounting.GlobalStats().ResetCounters()
+	err = CopyDir(ctx, r.Fremote, r.Flocal, false)
+	assert.ErrorIs(t, err, fs.ErrorImmutableModified)
+	assert.Equal(t, map[accounting.SkipReason]int64{
+		accounting.SkipUnchanged: 2,
+		accounting.SkipFiltered:  1,
+		accounting.SkipError:     1,
+	}, skipped())
+	assert.Equal(t, int64(0), accounting.GlobalStats().GetTransfers())
+}
+
 func TestSyncIgnoreErrors(t *testing.T) {
 	ctx := context.Background()
 	ctx, ci := fs.AddConfig(ctx)
@@ -1176,6 +1455,239 @@ func TestSyncWithExclude(t *testing.T) {
 	r.CheckLocalItems(t, file2, file1, file3)
 }
 
+// Test with --skip-empty
+func TestSyncWithSkipEmpty(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	file1 := r.WriteFile("potato", "------------------------------------------------------------", t1)
+	file2 := r.WriteFile("empty", "", t2)
+	r.CheckLocalItems(t, file1, file2)
+
+	fi, err := filter.NewFilter(nil)
+	require.NoError(t, err)
+	fi.Opt.SkipEmpty = true
+	ctx = filter.ReplaceConfig(ctx, fi)
+
+	// --ignore-size shouldn't change which files are skipped
+	ci.IgnoreSize = true
+
+	accounting.GlobalStats().ResetCounters()
+	err = Sync(ctx, r.Fremote, r.Flocal, false)
+	require.NoError(t, err)
+	r.CheckRemoteItems(t, file1)
+	assert.Equal(t, int64(1), accounting.GlobalStats().GetTransfers())
+}
+
+// Test with --sample-count choosing the same files each time
+func TestSyncWithSampleCount(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	var items []fstest.Item
+	for i := 0; i < 20; i++ {
+		items = append(items, r.WriteFile(fmt.Sprintf("dir%d/file%02d", i%3, i), fmt.Sprintf("file %d", i), t1))
+	}
+	r.CheckLocalItems(t, items...)
+
+	fi, err := filter.NewFilter(nil)
+	require.NoError(t, err)
+	fi.Opt.SampleCount = 5
+	fi.Opt.SampleSeed = 42
+	ctx = filter.ReplaceConfig(ctx, fi)
+
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, CopyDir(ctx, r.Fremote, r.Flocal, false))
+	assert.Equal(t, int64(5), accounting.GlobalStats().GetTransfers())
+
+	// The files chosen should be the ones with the lowest sample values
+	sort.Slice(items, func(i, j int) bool {
+		return fi.SampleValue(items[i].Path) < fi.SampleValue(items[j].Path)
+	})
+	sampled := items[:5]
+	r.CheckRemoteItems(t, sampled...)
+
+	// Syncing again with the same seed chooses the same files so
+	// nothing is transferred or deleted
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, Sync(ctx, r.Fremote, r.Flocal, false))
+	assert.Equal(t, int64(0), accounting.GlobalStats().GetTransfers())
+	assert.Equal(t, int64(0), accounting.GlobalStats().GetDeletes())
+	r.CheckRemoteItems(t, sampled...)
+}
+
+// Test with --queue recording the operations and flushing them later
+func TestSyncWithQueue(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	file1 := r.WriteFile("new", "this is new", t1)
+	file2 := r.WriteBoth(ctx, "same", "this is the same", t1)
+	file3 := r.WriteObject(ctx, "extra", "this should be deleted", t2)
+	r.CheckLocalItems(t, file1, file2)
+	r.CheckRemoteItems(t, file2, file3)
+
+	// Queue the sync - nothing should change
+	ci.Queue = filepath.Join(t.TempDir(), "queue.json")
+	accounting.GlobalStats().ResetCounters()
+	err := Sync(ctx, r.Fremote, r.Flocal, false)
+	require.NoError(t, err)
+	r.CheckLocalItems(t, file1, file2)
+	r.CheckRemoteItems(t, file2, file3)
+
+	in, err := os.Open(ci.Queue)
+	require.NoError(t, err)
+	pending, err := operations.ReadQueue(in)
+	require.NoError(t, in.Close())
+	require.NoError(t, err)
+	var ops []string
+	for _, entry := range pending {
+		ops = append(ops, entry.Op+" "+entry.Dst)
+	}
+	sort.Strings(ops)
+	assert.Equal(t, []string{"copy new", "delete extra"}, ops)
+
+	// Now flush the queue
+	queue := ci.Queue
+	ci.Queue = ""
+	done, err := operations.FlushQueue(ctx, queue)
+	require.NoError(t, err)
+	assert.Equal(t, 2, done)
+	r.CheckRemoteItems(t, file1, file2)
+
+	// Flushing again does nothing
+	done, err = operations.FlushQueue(ctx, queue)
+	require.NoError(t, err)
+	assert.Equal(t, 0, done)
+	r.CheckRemoteItems(t, file1, file2)
+}
+
+// offlineFs wraps an Fs which can't be reached
+type offlineFs struct {
+	fs.Fs
+}
+
+var errOffline = errors.New("offline")
+
+func (f offlineFs) List(ctx context.Context, dir string) (fs.DirEntries, error) {
+	return nil, errOffline
+}
+
+func (f offlineFs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	return nil, errOffline
+}
+
+// Test a copy can be queued with --no-check-dest while the destination
+// is offline
+func TestCopyWithQueueOffline(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	file1 := r.WriteFile("dir/new", "this is new", t1)
+	r.CheckLocalItems(t, file1)
+
+	ci.Queue = filepath.Join(t.TempDir(), "queue.json")
+	ci.NoCheckDest = true
+	err := CopyDir(ctx, offlineFs{Fs: r.Fremote}, r.Flocal, false)
+	require.NoError(t, err)
+	r.CheckRemoteItems(t)
+
+	// Flush the queue once the destination is back
+	queue := ci.Queue
+	ci.Queue = ""
+	done, err := operations.FlushQueue(ctx, queue)
+	require.NoError(t, err)
+	assert.Equal(t, 2, done) // mkdir dir and copy dir/new
+	r.CheckRemoteItems(t, file1)
+}
+
+// batchDeleteFs wraps an Fs adding a DeleteObjects feature which
+// records the size of each batch and the number run at once
+type batchDeleteFs struct {
+	fs.Fs
+	features *fs.Features
+	mu       mutex.Mutex
+	batches  []int
+	inFlight int
+	maxIn    int
+}
+
+func newBatchDeleteFs(f fs.Fs) *batchDeleteFs {
+	b := &batchDeleteFs{Fs: f}
+	features := *f.Features()
+	features.DeleteObjects = b.deleteObjects
+	b.features = &features
+	return b
+}
+
+func (b *batchDeleteFs) Features() *fs.Features {
+	return b.features
+}
+
+func (b *batchDeleteFs) deleteObjects(ctx context.Context, objs []fs.Object) (errs []error) {
+	b.mu.Lock()
+	b.batches = append(b.batches, len(objs))
+	b.inFlight++
+	if b.inFlight > b.maxIn {
+		b.maxIn = b.inFlight
+	}
+	b.mu.Unlock()
+	// Give the other deleters a chance to start
+	time.Sleep(100 * time.Millisecond)
+	for _, o := range objs {
+		errs = append(errs, o.Remove(ctx))
+	}
+	b.mu.Lock()
+	b.inFlight--
+	b.mu.Unlock()
+	return errs
+}
+
+// Test the --delete-after phase deletes in batches concurrently
+func TestSyncDeleteAfterBatched(t *testing.T) {
+	const nFiles = 2100 // more than two batches
+	for _, concurrency := range []int{1, 4} {
+		t.Run(fmt.Sprint(concurrency), func(t *testing.T) {
+			ctx := context.Background()
+			ctx, ci := fs.AddConfig(ctx)
+			r := fstest.NewRun(t)
+			r.WriteFile("keep", "keep me", t1)
+			fremote, err := fs.NewFs(ctx, fmt.Sprintf(":memory:batched%d", concurrency))
+			require.NoError(t, err)
+			for i := 0; i < nFiles; i++ {
+				src := object.NewStaticObjectInfo(fmt.Sprintf("delete%04d", i), t1, 0, true, nil, nil)
+				_, err := fremote.Put(ctx, bytes.NewBuffer(nil), src)
+				require.NoError(t, err)
+			}
+			ci.DeleteMode = fs.DeleteModeAfter
+			ci.DeleteAfterConcurrency = concurrency
+			fdst := newBatchDeleteFs(fremote)
+
+			accounting.GlobalStats().ResetCounters()
+			require.NoError(t, Sync(ctx, fdst, r.Flocal, false))
+			assert.Equal(t, int64(nFiles), accounting.GlobalStats().GetDeletes())
+			entries, err := fremote.List(ctx, "")
+			require.NoError(t, err)
+			require.Equal(t, 1, len(entries))
+			assert.Equal(t, "keep", entries[0].Remote())
+
+			sort.Ints(fdst.batches)
+			if concurrency == 1 {
+				assert.Equal(t, []int{100, 1000, 1000}, fdst.batches)
+				assert.Equal(t, 1, fdst.maxIn)
+			} else {
+				// The remainder may be split between the deleters
+				total := 0
+				for _, n := range fdst.batches {
+					total += n
+				}
+				assert.Equal(t, nFiles, total)
+				assert.Equal(t, []int{1000, 1000}, fdst.batches[len(fdst.batches)-2:])
+				assert.Greater(t, fdst.maxIn, 1)
+			}
+		})
+	}
+}
+
 // Test with exclude and delete excluded
 func TestSyncWithExcludeAndDeleteExcluded(t *testing.T) {
 	ctx := context.Background()
@@ -1366,6 +1878,7 @@ func TestParseRenamesStrategyModtime(t *testing.T) {
 		{"size", 0, false},
 		{"modtime,hash", trackRenamesStrategyModtime | trackRenamesStrategyHash, false},
 		{"hash,modtime,size", trackRenamesStrategyModtime | trackRenamesStrategyHash, false},
+		{"inode", trackRenamesStrategyInode, false},
 		{"size,boom", 0, true},
 	} {
 		got, err := parseTrackRenamesStrategy(test.in)
@@ -1426,6 +1939,84 @@ func TestSyncWithTrackRenamesStrategyModtime(t *testing.T) {
 	}
 }
 
+func TestSyncWithTrackRenamesStrategyInode(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+
+	ci.TrackRenames = true
+	ci.TrackRenamesStrategy = "inode"
+
+	// Hold the inode store open between syncs as it is removed
+	// when first opened by a test binary
+	db, err := kv.Start(ctx, inodesFacility, r.Fremote)
+	if err == kv.ErrUnsupported {
+		t.Skip("inode store not supported")
+	}
+	require.NoError(t, err)
+	defer func() {
+		_ = db.Stop(false)
+	}()
+
+	f1 := r.WriteFile("potato", "Potato Content", t1)
+	f2 := r.WriteFile("yam", "Yam Content", t2)
+
+	src, err := r.Flocal.NewObject(ctx, f2.Path)
+	require.NoError(t, err)
+	do, ok := src.(fs.Inoder)
+	canTrackRenames := ok && do.Inode() != "" && operations.CanServerSideMove(r.Fremote) && r.Fremote.Precision() != fs.ModTimeNotSupported
+	t.Logf("Can track renames: %v", canTrackRenames)
+
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, Sync(ctx, r.Fremote, r.Flocal, false))
+
+	r.CheckRemoteItems(t, f1, f2)
+	r.CheckLocalItems(t, f1, f2)
+
+	// Now rename locally - this should be tracked as a rename
+	f2 = r.RenameFile(f2, "yaml")
+
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, Sync(ctx, r.Fremote, r.Flocal, false))
+
+	r.CheckRemoteItems(t, f1, f2)
+	if canTrackRenames {
+		assert.Equal(t, int64(1), accounting.GlobalStats().Renames(0))
+		assert.Equal(t, int64(0), accounting.GlobalStats().GetTransfers())
+	}
+
+	// Rename and change the modtime - this looks like the inode
+	// has been reused for a different file so shouldn't be
+	// tracked as a rename
+	f2 = r.RenameFile(f2, "yams")
+	src, err = r.Flocal.NewObject(ctx, f2.Path)
+	require.NoError(t, err)
+	require.NoError(t, src.SetModTime(ctx, t3))
+	f2.ModTime = t3
+
+	accounting.GlobalStats().ResetCounters()
+	require.NoError(t, Sync(ctx, r.Fremote, r.Flocal, false))
+
+	r.CheckRemoteItems(t, f1, f2)
+	assert.Equal(t, int64(0), accounting.GlobalStats().Renames(0))
+
+	// The inode of a file is only recorded once it has been
+	// transferred, so not when it is skipped by --dry-run
+	f3 := r.WriteFile("carrot", "Carrot Content", t1)
+	ci.DryRun = true
+	require.NoError(t, Sync(ctx, r.Fremote, r.Flocal, false))
+	ci.DryRun = false
+	inodes, err := newInodeStore(ctx, r.Fremote)
+	require.NoError(t, err)
+	defer inodes.close()
+	assert.Equal(t, "", inodes.get(f3.Path))
+	require.NoError(t, Sync(ctx, r.Fremote, r.Flocal, false))
+	r.CheckRemoteItems(t, f1, f2, f3)
+	if canTrackRenames {
+		assert.NotEqual(t, "", inodes.get(f3.Path))
+	}
+}
+
 func TestSyncWithTrackRenamesStrategyLeaf(t *testing.T) {
 	ctx := context.Background()
 	ctx, ci := fs.AddConfig(ctx)
@@ -2224,6 +2815,65 @@ func TestSyncBackupDirSuffixOnly(t *testing.T) {
 	testSyncBackupDir(t, "", ".bak", false)
 }
 
+// Test with QuarantineDir set
+func TestSyncQuarantineDir(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+
+	if !operations.CanServerSideMove(r.Fremote) {
+		t.Skip("Skipping test as remote does not support server-side move")
+	}
+	r.Mkdir(ctx, r.Fremote)
+	ci.QuarantineDir = r.FremoteName + "/quarantine"
+
+	// Make the setup so we have one, two, three in the dest and
+	// one (newer), two (older) in the source
+	file1 := r.WriteObject(ctx, "dst/one", "one", t1)
+	file2 := r.WriteObject(ctx, "dst/two", "twoB", t3)
+	file3 := r.WriteObject(ctx, "dst/three.txt", "three", t1)
+	file1a := r.WriteFile("one", "oneA", t2)
+	file2a := r.WriteFile("two", "two", t1)
+
+	r.CheckRemoteItems(t, file1, file2, file3)
+	r.CheckLocalItems(t, file1a, file2a)
+
+	fdst, err := fs.NewFs(ctx, r.FremoteName+"/dst")
+	require.NoError(t, err)
+
+	accounting.GlobalStats().ResetCounters()
+	err = Sync(ctx, fdst, r.Flocal, false)
+	require.NoError(t, err)
+
+	// one should be overwritten as the source is newer
+	file1a.Path = "dst/one"
+	// two should be moved to the quarantine dir as it is newer
+	// than the source and the new one installed
+	file2.Path = "quarantine/two"
+	file2a.Path = "dst/two"
+	// three should be moved to the quarantine dir instead of deleted
+	file3.Path = "quarantine/three.txt"
+
+	r.CheckRemoteItems(t, file1a, file2, file2a, file3)
+
+	// Now check that quarantining three again doesn't overwrite
+	// the one quarantined already
+	file3a := r.WriteObject(ctx, "dst/three.txt", "threeA", t2)
+	r.CheckRemoteItems(t, file1a, file2, file2a, file3, file3a)
+
+	accounting.GlobalStats().ResetCounters()
+	err = Sync(ctx, fdst, r.Flocal, false)
+	require.NoError(t, err)
+
+	file3a.Path = "quarantine/three.1.txt"
+	r.CheckRemoteItems(t, file1a, file2, file2a, file3, file3a)
+
+	// The quarantine dir mustn't overlap the destination
+	ci.QuarantineDir = r.FremoteName + "/dst/quarantine"
+	err = Sync(ctx, fdst, r.Flocal, false)
+	assert.ErrorContains(t, err, "mustn't overlap")
+}
+
 // Test with Suffix set
 func testSyncSuffix(t *testing.T, suffix string, suffixKeepExtension bool) {
 	ctx := context.Background()
@@ -2409,6 +3059,63 @@ func TestSyncIgnoreCase(t *testing.T) {
 	r.CheckRemoteItems(t, file2)
 }
 
+// Test --case-collision with source files which collide on a case
+// insensitive destination
+func TestSyncCaseCollision(t *testing.T) {
+	ctx := context.Background()
+
+	// Only test if filesystems are case sensitive
+	r := fstest.NewRun(t)
+	if r.Fremote.Features().CaseInsensitive || r.Flocal.Features().CaseInsensitive {
+		t.Skip("Skipping test as local or remote are case-insensitive")
+	}
+
+	for _, test := range []struct {
+		mode fs.CaseCollisionMode
+		err  bool
+	}{
+		{mode: fs.CaseCollisionSkip},
+		{mode: fs.CaseCollisionError, err: true},
+		{mode: fs.CaseCollisionRename},
+	} {
+		t.Run(test.mode.String(), func(t *testing.T) {
+			ctx, ci := fs.AddConfig(ctx)
+			r := fstest.NewRun(t)
+			// Make the destination behave as if it is case insensitive
+			ci.IgnoreCaseSync = true
+			ci.CaseCollision = test.mode
+
+			file1 := r.WriteFile("File.txt", "upper", t1)
+			file2 := r.WriteFile("file.txt", "lower", t2)
+			file3 := r.WriteFile("other", "other", t1)
+			r.CheckLocalItems(t, file1, file2, file3)
+
+			for i := 0; i < 2; i++ {
+				accounting.GlobalStats().ResetCounters()
+				err := Sync(ctx, r.Fremote, r.Flocal, false)
+				if test.err {
+					assert.Error(t, err)
+					assert.Equal(t, int64(1), accounting.GlobalStats().GetErrors())
+				} else {
+					require.NoError(t, err)
+				}
+				// Syncing again doesn't transfer anything
+				if i > 0 {
+					assert.Equal(t, int64(0), accounting.GlobalStats().GetTransfers())
+				}
+			}
+
+			// The first of the colliding files is always transferred
+			if test.mode == fs.CaseCollisionRename {
+				file2.Path = "file (1).txt"
+				r.CheckRemoteItems(t, file1, file2, file3)
+			} else {
+				r.CheckRemoteItems(t, file1, file3)
+			}
+		})
+	}
+}
+
 // Test --fix-case
 func TestFixCase(t *testing.T) {
 	ctx := context.Background()
@@ -2729,3 +3436,91 @@ func testLoggerVsLsf(ctx context.Context, Fremote fs.Fs, logger *bytes.Buffer, t
 		require.NoError(t, err)
 	}
 }
+
+// Test that pausing stops a sync transferring files until it is resumed
+func TestSyncPaused(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	file1 := r.WriteFile("potato", "Potato Content", t1)
+	file2 := r.WriteFile("sub dir/yam", "Yam Content", t2)
+
+	accounting.PauseTransfers(false)
+	defer accounting.ResumeTransfers()
+	accounting.GlobalStats().ResetCounters()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- Sync(ctx, r.Fremote, r.Flocal, false)
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Sync finished while paused: %v", err)
+	case <-time.After(500 * time.Millisecond):
+	}
+	assert.Equal(t, int64(0), accounting.GlobalStats().GetTransfers())
+	r.CheckRemoteItems(t)
+
+	accounting.ResumeTransfers()
+	require.NoError(t, <-done)
+	assert.Equal(t, int64(2), accounting.GlobalStats().GetTransfers())
+	r.CheckLocalItems(t, file1, file2)
+	r.CheckRemoteItems(t, file1, file2)
+}
+
+// Test --checksum-fallback with a destination which has no hashes
+func TestSyncChecksumFallback(t *testing.T) {
+	for _, test := range []struct {
+		fallback      fs.ChecksumFallback
+		wantUnchanged int64 // transfers if nothing changed
+		wantTouched   int64 // transfers if the modtime changed
+		wantErr       bool
+	}{
+		{fallback: fs.ChecksumFallbackSize, wantUnchanged: 0, wantTouched: 0},
+		{fallback: fs.ChecksumFallbackModTime, wantUnchanged: 0, wantTouched: 1},
+		{fallback: fs.ChecksumFallbackTransfer, wantUnchanged: 1, wantTouched: 1},
+		{fallback: fs.ChecksumFallbackError, wantErr: true},
+	} {
+		t.Run(test.fallback.String(), func(t *testing.T) {
+			ctx := context.Background()
+			ctx, ci := fs.AddConfig(ctx)
+			r := fstest.NewRun(t)
+			fdst, err := fs.NewFs(ctx, ":chunker,remote='"+t.TempDir()+"',hash_type=none:")
+			require.NoError(t, err)
+			require.Equal(t, hash.None, r.Flocal.Hashes().Overlap(fdst.Hashes()).GetOne())
+
+			r.WriteFile("file", "contents", t1)
+			accounting.GlobalStats().ResetCounters()
+			require.NoError(t, Sync(ctx, fdst, r.Flocal, false))
+
+			ci.CheckSum = true
+			ci.ChecksumFallback = test.fallback
+			sync := func() (int64, error) {
+				accounting.GlobalStats().ResetCounters()
+				err := Sync(ctx, fdst, r.Flocal, false)
+				return accounting.GlobalStats().GetTransfers(), err
+			}
+
+			transfers, err := sync()
+			if test.wantErr {
+				assert.ErrorContains(t, err, "no hashes in common")
+				assert.Equal(t, int64(0), transfers)
+
+				// Single files report an error without transferring
+				accounting.GlobalStats().ResetCounters()
+				require.NoError(t, operations.CopyFile(ctx, fdst, r.Flocal, "file", "file"))
+				assert.Equal(t, int64(0), accounting.GlobalStats().GetTransfers())
+				assert.Equal(t, int64(1), accounting.GlobalStats().GetErrors())
+				accounting.GlobalStats().ResetCounters()
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.wantUnchanged, transfers, "unchanged")
+
+			r.WriteFile("file", "contents", t2)
+			transfers, err = sync()
+			require.NoError(t, err)
+			assert.Equal(t, test.wantTouched, transfers, "modtime changed")
+		})
+	}
+}
@@ -167,6 +167,13 @@ type IDer interface {
 	ID() string
 }
 
+// Inoder is an optional interface for Object
+type Inoder interface {
+	// Inode returns a string made from the device and inode numbers
+	// of the Object if known, or "" if not
+	Inode() string
+}
+
 // ParentIDer is an optional interface for Object
 type ParentIDer interface {
 	// ParentID returns the ID of the parent directory if known or nil if not
@@ -193,6 +200,15 @@ type GetTierer interface {
 	GetTier() string
 }
 
+// ConditionalRemover is an optional interface for Object
+type ConditionalRemover interface {
+	// RemoveIfUnchanged removes the Object only if it hasn't
+	// changed since it was read.
+	//
+	// It should return fs.ErrorObjectChanged if it has changed.
+	RemoveIfUnchanged(ctx context.Context) error
+}
+
 // Metadataer is an optional interface for DirEntry
 type Metadataer interface {
 	// Metadata returns metadata for an DirEntry
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
 	"github.com/rclone/rclone/fs/dirtree"
 	"github.com/rclone/rclone/fs/filter"
 	"github.com/rclone/rclone/fs/list"
@@ -310,6 +311,9 @@ func listR(ctx context.Context, f fs.Fs, path string, includeAll bool, listType
 				switch x := entry.(type) {
 				case fs.Object:
 					include = fi.IncludeObject(ctx, x)
+					if !include && filter.GetCountExcluded(ctx) {
+						accounting.Stats(ctx).Skipped(accounting.SkipFiltered, 1)
+					}
 				case fs.Directory:
 					include, err = includeDirectory(x.Remote())
 					if err != nil {
@@ -375,7 +379,8 @@ func walk(ctx context.Context, f fs.Fs, path string, includeAll bool, maxLevel i
 		depth  int
 	}
 
-	in := make(chan listJob, ci.Checkers)
+	listers := ci.ListConcurrencyOrCheckers(f)
+	in := make(chan listJob, listers)
 	errs := make(chan error, 1)
 	quit := make(chan struct{})
 	closeQuit := func() {
@@ -388,7 +393,7 @@ func walk(ctx context.Context, f fs.Fs, path string, includeAll bool, maxLevel i
 			}()
 		})
 	}
-	for i := 0; i < ci.Checkers; i++ {
+	for i := 0; i < listers; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
@@ -456,13 +461,57 @@ func walk(ctx context.Context, f fs.Fs, path string, includeAll bool, maxLevel i
 	return <-errs
 }
 
+// prefixListR returns a ListRFn which only lists the directories the
+// filters can include files from, so the excluded parts of the tree
+// aren't listed at all. It returns listR if the filters can't be
+// turned into directories to list.
+func prefixListR(f fs.Fs, fi *filter.Filter, listR fs.ListRFn) fs.ListRFn {
+	prefixes, ok := fi.ListPrefixes()
+	if !ok {
+		return listR
+	}
+	return func(ctx context.Context, dir string, callback fs.ListRCallback) error {
+		var targets []string
+		for _, prefix := range prefixes {
+			if dir == "" || prefix == dir || strings.HasPrefix(prefix, dir+"/") {
+				targets = append(targets, prefix)
+			} else if strings.HasPrefix(dir, prefix+"/") {
+				// dir is inside the prefix so list all of it
+				return listR(ctx, dir, callback)
+			}
+		}
+		found := false
+		for _, target := range targets {
+			fs.Debugf(target, "Listing only this directory as the filters exclude the others")
+			err := listR(ctx, target, callback)
+			if err == fs.ErrorDirNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			found = true
+		}
+		if !found && f != nil {
+			// Return an error if dir doesn't exist
+			_, err := f.List(ctx, dir)
+			return err
+		}
+		return nil
+	}
+}
+
 func walkRDirTree(ctx context.Context, f fs.Fs, startPath string, includeAll bool, maxLevel int, listR fs.ListRFn) (dirtree.DirTree, error) {
 	fi := filter.GetConfig(ctx)
+	if !includeAll {
+		listR = prefixListR(f, fi, listR)
+	}
 	dirs := dirtree.New()
 	// Entries can come in arbitrary order. We use toPrune to keep
 	// all directories to exclude later.
 	toPrune := make(map[string]bool)
 	includeDirectory := fi.IncludeDirectory(ctx, f)
+	countExcluded := filter.GetCountExcluded(ctx)
 	var mu sync.Mutex
 	err := listR(ctx, startPath, func(entries fs.DirEntries) error {
 		mu.Lock()
@@ -478,6 +527,8 @@ func walkRDirTree(ctx context.Context, f fs.Fs, startPath string, includeAll boo
 						dirs.Add(x)
 						excluded = false
 					}
+				} else if countExcluded {
+					accounting.Stats(ctx).Skipped(accounting.SkipFiltered, 1)
 				}
 				// Make sure we include any parent directories of excluded objects
 				if excluded {
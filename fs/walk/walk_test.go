@@ -8,6 +8,7 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/rclone/rclone/fs"
 	_ "github.com/rclone/rclone/fs/accounting"
@@ -431,6 +432,42 @@ func testWalkMultiErrors(t *testing.T) *listDirs {
 func TestWalkMultiErrors(t *testing.T)  { testWalkMultiErrors(t).Walk() }
 func TestWalkRMultiErrors(t *testing.T) { testWalkMultiErrors(t).Walk() }
 
+func TestWalkListConcurrency(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	ci.Checkers = 16
+	ci.ListConcurrency = 2
+	lr, _ := makeTree(3, false)
+
+	var (
+		mu       sync.Mutex
+		inFlight int
+		maxSeen  int
+		listed   int
+	)
+	listDir := func(ctx context.Context, f fs.Fs, includeAll bool, dir string) (entries fs.DirEntries, err error) {
+		mu.Lock()
+		inFlight++
+		listed++
+		if inFlight > maxSeen {
+			maxSeen = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		return lr[dir].entries, nil
+	}
+	err := walk(ctx, nil, "", true, -1, func(dir string, entries fs.DirEntries, err error) error {
+		return err
+	}, listDir)
+	require.NoError(t, err)
+	assert.Equal(t, len(lr), listed)
+	assert.LessOrEqual(t, maxSeen, ci.ListConcurrency)
+	assert.Greater(t, maxSeen, 0)
+}
+
 // a very simple listRcallback function
 func makeListRCallback(entries fs.DirEntries, err error) fs.ListRFn {
 	return func(ctx context.Context, dir string, callback fs.ListRCallback) error {
@@ -745,6 +782,130 @@ b/c/d/
 	fi.Opt.ExcludeFile = nil
 }
 
+func TestWalkRDirTreePrefixes(t *testing.T) {
+	entries := fs.DirEntries{
+		mockobject.Object("a"),
+		mockobject.Object("dir/sub/b"),
+		mockobject.Object("dir/sub/deeper/c"),
+		mockobject.Object("dir/other/d"),
+		mockobject.Object("other/e.jpg"),
+		mockobject.Object("other/f.txt"),
+	}
+	// listR lists the entries under dir recording the dirs listed
+	var listed []string
+	listR := func(ctx context.Context, dir string, callback fs.ListRCallback) error {
+		listed = append(listed, dir)
+		var found fs.DirEntries
+		for _, entry := range entries {
+			if dir == "" || strings.HasPrefix(entry.Remote(), dir+"/") {
+				found = append(found, entry)
+			}
+		}
+		if len(found) == 0 {
+			return fs.ErrorDirNotFound
+		}
+		return callback(found)
+	}
+	for _, test := range []struct {
+		rules      []string
+		root       string
+		includeAll bool
+		wantListed []string
+		want       string
+	}{{
+		rules:      []string{"+ /dir/sub/**", "+ /other/*.jpg", "+ /missing/**", "- **"},
+		wantListed: []string{"dir/sub", "missing", "other"},
+		want: `/
+  dir/
+  other/
+dir/
+  sub/
+dir/sub/
+  b
+  deeper/
+dir/sub/deeper/
+  c
+other/
+  e.jpg
+`,
+	}, {
+		rules:      []string{"+ /dir/sub/**", "+ /other/*.jpg", "- **"},
+		root:       "dir",
+		wantListed: []string{"dir/sub"},
+		want: `dir/
+  sub/
+dir/sub/
+  b
+  deeper/
+dir/sub/deeper/
+  c
+`,
+	}, {
+		rules:      []string{"+ /dir/**", "- **"},
+		root:       "dir/sub",
+		wantListed: []string{"dir/sub"},
+		want: `dir/sub/
+  b
+  deeper/
+dir/sub/deeper/
+  c
+`,
+	}, {
+		// Not a prefix so everything is listed
+		rules:      []string{"+ *.jpg", "- **"},
+		wantListed: []string{""},
+		want: `/
+  dir/
+  other/
+dir/
+  other/
+  sub/
+dir/other/
+dir/sub/
+  deeper/
+dir/sub/deeper/
+other/
+  e.jpg
+`,
+	}, {
+		// The filters aren't used with includeAll
+		rules:      []string{"+ /other/**", "- **"},
+		includeAll: true,
+		wantListed: []string{""},
+		want: `/
+  a
+  dir/
+  other/
+dir/
+  other/
+  sub/
+dir/other/
+  d
+dir/sub/
+  b
+  deeper/
+dir/sub/deeper/
+  c
+other/
+  e.jpg
+  f.txt
+`,
+	}} {
+		what := fmt.Sprintf("%q root=%q", test.rules, test.root)
+		fi, err := filter.NewFilter(nil)
+		require.NoError(t, err)
+		for _, rule := range test.rules {
+			require.NoError(t, fi.AddRule(rule), what)
+		}
+		ctx := filter.ReplaceConfig(context.Background(), fi)
+		listed = nil
+		r, err := walkRDirTree(ctx, nil, test.root, test.includeAll, -1, listR)
+		require.NoError(t, err, what)
+		assert.Equal(t, test.wantListed, listed, what)
+		assert.Equal(t, test.want, r.String(), what)
+	}
+}
+
 func TestListType(t *testing.T) {
 	assert.Equal(t, true, ListObjects.Objects())
 	assert.Equal(t, false, ListObjects.Dirs())
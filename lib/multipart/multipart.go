@@ -10,6 +10,7 @@ import (
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/fserrors"
 	"github.com/rclone/rclone/lib/atexit"
 	"github.com/rclone/rclone/lib/pacer"
 	"github.com/rclone/rclone/lib/pool"
@@ -22,6 +23,13 @@ const (
 	bufferCacheFlushTime = 5 * time.Second // flush the cached buffers after this long
 )
 
+// The time to wait before the first retry of a part with
+// --part-retries which doubles after each retry up to the maximum
+var (
+	partRetryMinSleep = time.Second
+	partRetryMaxSleep = 30 * time.Second
+)
+
 // bufferPool is a global pool of buffers
 var (
 	bufferPool     *pool.Pool
@@ -34,6 +42,9 @@ func getPool() *pool.Pool {
 		ci := fs.GetConfig(context.Background())
 		// Initialise the buffer pool when used
 		bufferPool = pool.New(bufferCacheFlushTime, bufferSize, bufferCacheSize, ci.UseMmap)
+		if ci.MaxBufferMemory > 0 {
+			bufferPool.SetMaxMemory(int64(ci.MaxBufferMemory))
+		}
 	})
 	return bufferPool
 }
@@ -43,6 +54,39 @@ func NewRW() *pool.RW {
 	return pool.NewRW(getPool())
 }
 
+// WriteChunk writes chunk chunkNumber of src from reader with
+// chunkWriter.
+//
+// If writing the chunk fails it is retried on its own, up to
+// --part-retries times with an exponential backoff, rewinding reader
+// each time, so a failing part doesn't cause the other parts or the
+// whole upload to be retried. Errors which can't be retried and
+// cancelling ctx stop the retries.
+func WriteChunk(ctx context.Context, src fs.ObjectInfo, chunkWriter fs.ChunkWriter, chunkNumber int, reader io.ReadSeeker) (bytesWritten int64, err error) {
+	retries := fs.GetConfig(ctx).PartRetries
+	sleep := partRetryMinSleep
+	for try := 1; ; try++ {
+		bytesWritten, err = chunkWriter.WriteChunk(ctx, chunkNumber, reader)
+		if err == nil || try > retries || ctx.Err() != nil || fserrors.IsFatalError(err) || fserrors.IsNoRetryError(err) {
+			return bytesWritten, err
+		}
+		fs.Debugf(src, "multipart upload: retrying chunk %d (%d/%d) in %v: %v", chunkNumber, try, retries, sleep, err)
+		select {
+		case <-time.After(sleep):
+		case <-ctx.Done():
+			return bytesWritten, err
+		}
+		sleep *= 2
+		if sleep > partRetryMaxSleep {
+			sleep = partRetryMaxSleep
+		}
+		_, seekErr := reader.Seek(0, io.SeekStart)
+		if seekErr != nil {
+			return bytesWritten, fmt.Errorf("failed to rewind chunk %d to retry it: %w: %v", chunkNumber, seekErr, err)
+		}
+	}
+}
+
 // UploadMultipartOptions options for the generic multipart upload
 type UploadMultipartOptions struct {
 	Open        fs.OpenChunkWriter // thing to call OpenChunkWriter on
@@ -106,6 +150,16 @@ func UploadMultipart(ctx context.Context, src fs.ObjectInfo, in io.Reader, opt U
 			tokens.Put()
 		}
 
+		// Wait for the memory for the chunk
+		err = rw.Reserve(gCtx, chunkSize)
+		if err != nil {
+			free()
+			if gCtx.Err() != nil {
+				break
+			}
+			return nil, fmt.Errorf("multipart upload: failed to get memory for chunk: %w", err)
+		}
+
 		// Fail fast, in case an errgroup managed function returns an error
 		// gCtx is cancelled. There is no point in uploading all the other parts.
 		if gCtx.Err() != nil {
@@ -133,7 +187,7 @@ func UploadMultipart(ctx context.Context, src fs.ObjectInfo, in io.Reader, opt U
 		g.Go(func() (err error) {
 			defer free()
 			fs.Debugf(src, "multipart upload: starting chunk %d size %v offset %v/%v", partNum, fs.SizeSuffix(n), fs.SizeSuffix(partOff), fs.SizeSuffix(size))
-			_, err = chunkWriter.WriteChunk(gCtx, int(partNum), rw)
+			_, err = WriteChunk(gCtx, src, chunkWriter, int(partNum), rw)
 			return err
 		})
 	}
@@ -0,0 +1,135 @@
+package multipart
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/lib/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testChunkWriter is a fs.ChunkWriter which fails writing chunks
+// the number of times set in fail
+type testChunkWriter struct {
+	chunkSize int64
+	mu        sync.Mutex
+	fail      map[int]int    // number of times left to fail each chunk
+	err       error          // error to fail with
+	tries     map[int]int    // number of times each chunk was written
+	chunks    map[int]string // contents of each chunk written OK
+	closed    bool
+	aborted   bool
+}
+
+func newTestChunkWriter(chunkSize int64, fail map[int]int) *testChunkWriter {
+	return &testChunkWriter{
+		chunkSize: chunkSize,
+		fail:      fail,
+		err:       errors.New("flaky part"),
+		tries:     map[int]int{},
+		chunks:    map[int]string{},
+	}
+}
+
+// OpenChunkWriter returns the testChunkWriter
+func (w *testChunkWriter) OpenChunkWriter(ctx context.Context, remote string, src fs.ObjectInfo, options ...fs.OpenOption) (fs.ChunkWriterInfo, fs.ChunkWriter, error) {
+	return fs.ChunkWriterInfo{ChunkSize: w.chunkSize, Concurrency: 4}, w, nil
+}
+
+// WriteChunk reads the chunk failing if set
+func (w *testChunkWriter) WriteChunk(ctx context.Context, chunkNumber int, reader io.ReadSeeker) (int64, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return 0, err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.tries[chunkNumber]++
+	if w.fail[chunkNumber] != 0 {
+		w.fail[chunkNumber]--
+		return 0, w.err
+	}
+	w.chunks[chunkNumber] = string(data)
+	return int64(len(data)), nil
+}
+
+// Close the upload
+func (w *testChunkWriter) Close(ctx context.Context) error {
+	w.closed = true
+	return nil
+}
+
+// Abort the upload
+func (w *testChunkWriter) Abort(ctx context.Context) error {
+	w.aborted = true
+	return nil
+}
+
+// contents returns the chunks written OK joined together
+func (w *testChunkWriter) contents() string {
+	var out strings.Builder
+	for i := 0; i < len(w.chunks); i++ {
+		out.WriteString(w.chunks[i])
+	}
+	return out.String()
+}
+
+func TestUploadMultipartPartRetries(t *testing.T) {
+	oldMinSleep := partRetryMinSleep
+	partRetryMinSleep = time.Millisecond
+	defer func() {
+		partRetryMinSleep = oldMinSleep
+	}()
+
+	const chunkSize = 1024
+	contents := random.String(5*chunkSize + 100)
+	src := object.NewStaticObjectInfo("remote", time.Now(), int64(len(contents)), true, nil, nil)
+	ctx, ci := fs.AddConfig(context.Background())
+
+	upload := func(w *testChunkWriter) error {
+		_, err := UploadMultipart(ctx, src, strings.NewReader(contents), UploadMultipartOptions{Open: w})
+		return err
+	}
+
+	// Without retries a failing part fails the upload
+	w := newTestChunkWriter(chunkSize, map[int]int{2: 1})
+	err := upload(w)
+	assert.Equal(t, w.err, err)
+	assert.Equal(t, 1, w.tries[2])
+	assert.True(t, w.aborted)
+	assert.False(t, w.closed)
+
+	// Only the parts which fail are retried
+	ci.PartRetries = 3
+	w = newTestChunkWriter(chunkSize, map[int]int{1: 2, 4: 3})
+	require.NoError(t, upload(w))
+	assert.Equal(t, map[int]int{0: 1, 1: 3, 2: 1, 3: 1, 4: 4, 5: 1}, w.tries)
+	assert.Equal(t, contents, w.contents())
+	assert.True(t, w.closed)
+	assert.False(t, w.aborted)
+
+	// A part which fails more than the retries aborts the upload
+	w = newTestChunkWriter(chunkSize, map[int]int{3: 4})
+	err = upload(w)
+	assert.Equal(t, w.err, err)
+	assert.Equal(t, 4, w.tries[3])
+	assert.True(t, w.aborted)
+	assert.False(t, w.closed)
+
+	// Errors which can't be retried aren't
+	w = newTestChunkWriter(chunkSize, map[int]int{3: 1})
+	w.err = fserrors.NoRetryError(errors.New("permanent"))
+	err = upload(w)
+	assert.Equal(t, w.err, err)
+	assert.Equal(t, 1, w.tries[3])
+	assert.True(t, w.aborted)
+}
@@ -3,12 +3,14 @@
 package pool
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"sync"
 	"time"
 
 	"github.com/rclone/rclone/lib/mmap"
+	"golang.org/x/sync/semaphore"
 )
 
 // Pool of internal buffers
@@ -31,6 +33,8 @@ type Pool struct {
 	flushPending bool
 	alloc        func(int) ([]byte, error)
 	free         func([]byte) error
+	limit        *semaphore.Weighted // if set limits the number of buffers in use
+	limitSize    int64               // size of limit in buffers
 }
 
 // New makes a buffer pool
@@ -61,6 +65,43 @@ func New(flushTime time.Duration, bufferSize, poolSize int, useMmap bool) *Pool
 	return bp
 }
 
+// SetMaxMemory limits the total size of the buffers in use from the
+// pool to size bytes, rounded down to a whole number of buffers but at
+// least one.
+//
+// Once the limit is reached Get blocks until buffers are returned with
+// Put. It must be called before the pool is used.
+func (bp *Pool) SetMaxMemory(size int64) {
+	bp.limitSize = size / int64(bp.bufferSize)
+	if bp.limitSize < 1 {
+		bp.limitSize = 1
+	}
+	bp.limit = semaphore.NewWeighted(bp.limitSize)
+}
+
+// reserve acquires n buffers from the memory limit which the caller
+// must take with getReserved or return with unreserve.
+//
+// It blocks until they are available or ctx is cancelled and returns
+// an error if n is more than the limit as it could never be satisfied.
+func (bp *Pool) reserve(ctx context.Context, n int) error {
+	if bp.limit == nil || n <= 0 {
+		return nil
+	}
+	if int64(n) > bp.limitSize {
+		return fmt.Errorf("pool: can't reserve %d bytes as the memory limit is %d bytes", int64(n)*int64(bp.bufferSize), bp.limitSize*int64(bp.bufferSize))
+	}
+	return bp.limit.Acquire(ctx, int64(n))
+}
+
+// unreserve returns n reserved buffers to the memory limit
+func (bp *Pool) unreserve(n int) {
+	if bp.limit == nil || n <= 0 {
+		return
+	}
+	bp.limit.Release(int64(n))
+}
+
 // get gets the last buffer in bp.cache
 //
 // Call with mu held
@@ -146,7 +187,19 @@ func (bp *Pool) updateMinFill() {
 }
 
 // Get a buffer from the pool or allocate one
+//
+// If the pool has a memory limit this blocks until a buffer is
+// available under it.
 func (bp *Pool) Get() []byte {
+	if bp.limit != nil {
+		_ = bp.limit.Acquire(context.Background(), 1) // can't fail without a deadline
+	}
+	return bp.getReserved()
+}
+
+// getReserved gets a buffer from the pool or allocates one without
+// acquiring it from the memory limit
+func (bp *Pool) getReserved() []byte {
 	bp.mu.Lock()
 	var buf []byte
 	waitTime := time.Millisecond
@@ -202,4 +255,7 @@ func (bp *Pool) Put(buf []byte) {
 	bp.inUse--
 	bp.updateMinFill()
 	bp.kickFlusher()
+	if bp.limit != nil {
+		bp.limit.Release(1)
+	}
 }
@@ -225,3 +225,33 @@ func TestPool(t *testing.T) {
 		})
 	}
 }
+
+func TestMaxMemory(t *testing.T) {
+	bp := New(60*time.Second, 4096, 2, false)
+	bp.SetMaxMemory(2*4096 + 100) // rounded down to 2 buffers
+
+	b1 := bp.Get()
+	b2 := bp.Get()
+	assert.Equal(t, 2, bp.InUse())
+
+	got := make(chan []byte)
+	go func() {
+		got <- bp.Get()
+	}()
+	select {
+	case <-got:
+		t.Fatal("Get should block when the memory limit is reached")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	bp.Put(b1)
+	select {
+	case b3 := <-got:
+		assert.Equal(t, 2, bp.InUse())
+		bp.Put(b3)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Get should unblock when a buffer is returned")
+	}
+	bp.Put(b2)
+	assert.Equal(t, 0, bp.InUse())
+}
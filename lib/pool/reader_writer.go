@@ -1,6 +1,7 @@
 package pool
 
 import (
+	"context"
 	"errors"
 	"io"
 )
@@ -21,6 +22,7 @@ type RW struct {
 	account    RWAccount // account for a read
 	reads      int       // count how many times the data has been read
 	accountOn  int       // only account on or after this read
+	reserved   int       // number of pages reserved but not yet used
 }
 
 var (
@@ -169,7 +171,12 @@ func (rw *RW) writePage() (page []byte) {
 	if len(rw.pages) > 0 && rw.lastOffset < rw.pool.bufferSize {
 		return rw.pages[len(rw.pages)-1][rw.lastOffset:]
 	}
-	page = rw.pool.Get()
+	if rw.reserved > 0 {
+		page = rw.pool.getReserved()
+		rw.reserved--
+	} else {
+		page = rw.pool.Get()
+	}
 	rw.pages = append(rw.pages, page)
 	rw.lastOffset = 0
 	return page
@@ -250,12 +257,39 @@ func (rw *RW) Seek(offset int64, whence int) (int64, error) {
 	return abs, nil
 }
 
+// Reserve makes sure there is memory for the RW to hold size bytes
+// in total, blocking until it is available under the memory limit of
+// the pool if it has one.
+//
+// The memory is reserved all at once, so RWs which are filled at the
+// same time can't deadlock by each holding part of the memory they
+// need. Call this before writing a known amount of data to the RW.
+//
+// It returns an error if ctx is cancelled or size is more than the
+// memory limit.
+func (rw *RW) Reserve(ctx context.Context, size int64) error {
+	bufferSize := int64(rw.pool.bufferSize)
+	// pages are filled in turn so size bytes always need this many
+	pages := int((size+bufferSize-1)/bufferSize) - len(rw.pages) - rw.reserved
+	if pages <= 0 {
+		return nil
+	}
+	err := rw.pool.reserve(ctx, pages)
+	if err != nil {
+		return err
+	}
+	rw.reserved += pages
+	return nil
+}
+
 // Close the buffer returning memory to the pool
 func (rw *RW) Close() error {
 	for _, page := range rw.pages {
 		rw.pool.Put(page)
 	}
 	rw.pages = nil
+	rw.pool.unreserve(rw.reserved)
+	rw.reserved = 0
 	return nil
 }
 
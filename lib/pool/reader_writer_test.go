@@ -2,8 +2,11 @@ package pool
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"io"
+	"math/rand"
+	"sync"
 	"testing"
 	"time"
 
@@ -489,3 +492,76 @@ func TestRWBoundaryConditions(t *testing.T) {
 		})
 	}
 }
+
+func TestRWReserve(t *testing.T) {
+	const (
+		bufferSize = 1024
+		limit      = 8 // buffers
+		goroutines = 64
+	)
+	ctx := context.Background()
+	bp := New(60*time.Second, bufferSize, 2, false)
+	bp.SetMaxMemory(limit * bufferSize)
+
+	// Reserving more than the limit can never succeed
+	rw := NewRW(bp)
+	err := rw.Reserve(ctx, limit*bufferSize+1)
+	assert.ErrorContains(t, err, "memory limit")
+	require.NoError(t, rw.Close())
+
+	// Fill lots of RWs at once checking the buffers in use never
+	// exceed the limit
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		maxUsed int
+	)
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			size := rand.Intn(limit*bufferSize) + 1
+			data := random.String(size)
+			rw := NewRW(bp)
+			defer func() {
+				assert.NoError(t, rw.Close())
+			}()
+			if !assert.NoError(t, rw.Reserve(ctx, int64(size))) {
+				return
+			}
+			for off := 0; off < size; off += 100 {
+				end := off + 100
+				if end > size {
+					end = size
+				}
+				_, err := rw.Write([]byte(data[off:end]))
+				assert.NoError(t, err)
+				inUse := bp.InUse()
+				mu.Lock()
+				if inUse > maxUsed {
+					maxUsed = inUse
+				}
+				mu.Unlock()
+			}
+			got, err := io.ReadAll(rw)
+			assert.NoError(t, err)
+			assert.Equal(t, data, string(got))
+		}(i)
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, maxUsed, limit)
+	assert.Greater(t, maxUsed, 0)
+	assert.Equal(t, 0, bp.InUse())
+
+	// Reserve waits for memory and can be cancelled
+	full := NewRW(bp)
+	require.NoError(t, full.Reserve(ctx, limit*bufferSize))
+	ctxTimeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	rw = NewRW(bp)
+	err = rw.Reserve(ctxTimeout, 1)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	require.NoError(t, full.Close())
+	require.NoError(t, rw.Reserve(ctx, 1))
+	require.NoError(t, rw.Close())
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/rand"
 	"os"
 	"path"
 	"path/filepath"
@@ -143,6 +144,7 @@ func New(ctx context.Context, fremote fs.Fs, opt *vfscommon.Options, avFn AddVir
 	c.cond = sync.Cond{L: &c.mu}
 
 	go c.cleaner(ctx)
+	go c.verifier(ctx)
 
 	return c, nil
 }
@@ -845,6 +847,65 @@ func (c *Cache) cleaner(ctx context.Context) {
 	}
 }
 
+// verifySample is the number of cached files checked by each verify
+const verifySample = 10
+
+// verify checks a random sample of the cached files against the
+// remote, removing any which don't match.
+//
+// The files are checked one at a time without holding the cache lock
+// so as not to disturb any IO in progress.
+func (c *Cache) verify(ctx context.Context) {
+	c.mu.Lock()
+	items := make(Items, 0, len(c.item))
+	for _, item := range c.item {
+		items = append(items, item)
+	}
+	c.mu.Unlock()
+
+	rand.Shuffle(len(items), func(i, j int) {
+		items[i], items[j] = items[j], items[i]
+	})
+	if len(items) > verifySample {
+		items = items[:verifySample]
+	}
+
+	removed := 0
+	for _, item := range items {
+		if ctx.Err() != nil {
+			return
+		}
+		itemRemoved, err := item.verify(ctx)
+		if err != nil {
+			fs.Errorf(item.GetName(), "vfs cache: failed to verify: %v", err)
+		}
+		if itemRemoved {
+			removed++
+		}
+	}
+	fs.Infof(nil, "vfs cache: verified %d files, removed %d", len(items), removed)
+}
+
+// verifier calls verify at regular intervals
+//
+// doesn't return until context is cancelled
+func (c *Cache) verifier(ctx context.Context) {
+	if c.opt.VerifyInterval <= 0 {
+		return
+	}
+	timer := time.NewTicker(c.opt.VerifyInterval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			c.verify(ctx)
+		case <-ctx.Done():
+			fs.Debugf(nil, "vfs cache: verifier exiting")
+			return
+		}
+	}
+}
+
 // TotalInUse returns the number of items in the cache which are InUse
 func (c *Cache) TotalInUse() (n int) {
 	c.mu.Lock()
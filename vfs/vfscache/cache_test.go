@@ -14,6 +14,7 @@ import (
 	"github.com/rclone/rclone/fs/config"
 	"github.com/rclone/rclone/fstest"
 	"github.com/rclone/rclone/lib/diskusage"
+	"github.com/rclone/rclone/lib/random"
 	"github.com/rclone/rclone/vfs/vfscommon"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -727,3 +728,67 @@ func TestCacheStats(t *testing.T) {
 	assert.Equal(t, 0, out["uploadsInProgress"])
 	assert.Equal(t, 0, out["uploadsQueued"])
 }
+
+func TestCacheVerify(t *testing.T) {
+	r, c := newTestCache(t)
+	ctx := context.Background()
+
+	// cacheFile opens, downloads and closes the remote file
+	cacheFile := func(remote string) *Item {
+		_, obj, item := newFile(t, r, c, remote)
+		require.NoError(t, item.Open(obj))
+		buf := make([]byte, 100)
+		_, err := item.ReadAt(buf, 0)
+		require.NoError(t, err)
+		require.NoError(t, item.Close(nil))
+		require.True(t, item.present())
+		return item
+	}
+
+	// An unchanged file isn't removed
+	item := cacheFile("existing")
+	removed, err := item.verify(ctx)
+	require.NoError(t, err)
+	assert.False(t, removed)
+	assert.True(t, item.Exists())
+
+	// A corrupted cache file is removed
+	require.NoError(t, os.WriteFile(c.toOSPath("existing"), []byte(zeroes), 0600))
+	removed, err = item.verify(ctx)
+	require.NoError(t, err)
+	assert.True(t, removed)
+	assert.False(t, item.Exists())
+
+	// A cache file of a changed remote file is removed by the
+	// periodic verify
+	item = cacheFile("existing")
+	item2 := cacheFile("existing2")
+	r.WriteObject(ctx, "existing", random.String(100), time.Now().Add(time.Minute))
+	c.verify(ctx)
+	assert.False(t, item.Exists())
+	assert.True(t, item2.Exists())
+
+	// A cache file of a deleted remote file is removed
+	obj, err := r.Fremote.NewObject(ctx, "existing2")
+	require.NoError(t, err)
+	require.NoError(t, obj.Remove(ctx))
+	removed, err = item2.verify(ctx)
+	require.NoError(t, err)
+	assert.True(t, removed)
+	assert.False(t, item2.Exists())
+
+	// Files which are open or dirty aren't checked
+	item = cacheFile("existing")
+	require.NoError(t, item.Open(nil))
+	require.NoError(t, os.WriteFile(c.toOSPath("existing"), []byte(zeroes), 0600))
+	removed, err = item.verify(ctx)
+	require.NoError(t, err)
+	assert.False(t, removed)
+	_, err = item.WriteAt([]byte("hello"), 0)
+	require.NoError(t, err)
+	require.NoError(t, item.Close(nil))
+	removed, err = item.verify(ctx)
+	require.NoError(t, err)
+	assert.False(t, removed)
+	assert.True(t, item.Exists())
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/fs/operations"
 	"github.com/rclone/rclone/lib/file"
 	"github.com/rclone/rclone/lib/ranges"
@@ -832,6 +833,65 @@ func (item *Item) _checkObject(o fs.Object) error {
 	return nil
 }
 
+// verify checks the cached file against the object in the remote
+// and removes it if the remote object has changed or gone, or if the
+// hash of the cached data doesn't match the hash of the remote
+// object.
+//
+// Items which are open, dirty or not completely downloaded are
+// skipped so as not to disturb any IO. It returns true if the cached
+// file was removed.
+func (item *Item) verify(ctx context.Context) (removed bool, err error) {
+	item.mu.Lock()
+	if item.opens != 0 || item.info.Dirty || item.info.Fingerprint == "" || !item._present() || !item._exists() {
+		item.mu.Unlock()
+		return false, nil
+	}
+	fingerprint, modTime := item.info.Fingerprint, item.info.ModTime
+	item.mu.Unlock()
+
+	var reason string
+	o, err := item.c.fremote.NewObject(ctx, item.name)
+	if err == fs.ErrorObjectNotFound {
+		reason = "stale (remote deleted)"
+	} else if err != nil {
+		return false, fmt.Errorf("vfs cache verify: failed to find remote object: %w", err)
+	} else if remoteFingerprint := fs.Fingerprint(ctx, o, item.c.opt.FastFingerprint); remoteFingerprint != fingerprint {
+		fs.Debugf(item.name, "vfs cache verify: remote fingerprint %q != cached fingerprint %q", remoteFingerprint, fingerprint)
+		reason = "stale (remote is different)"
+	} else if item.c.hashType != hash.None {
+		remoteHash, err := o.Hash(ctx, item.c.hashType)
+		if err != nil {
+			return false, fmt.Errorf("vfs cache verify: failed to read remote hash: %w", err)
+		}
+		cacheObj, err := item.c.fcache.NewObject(ctx, item.name)
+		if err != nil {
+			return false, fmt.Errorf("vfs cache verify: failed to find cache object: %w", err)
+		}
+		cacheHash, err := cacheObj.Hash(ctx, item.c.hashType)
+		if err != nil {
+			return false, fmt.Errorf("vfs cache verify: failed to hash cache object: %w", err)
+		}
+		if remoteHash != "" && cacheHash != "" && remoteHash != cacheHash {
+			fs.Debugf(item.name, "vfs cache verify: remote %v hash %q != cached hash %q", item.c.hashType, remoteHash, cacheHash)
+			reason = "corrupt (cached data doesn't match remote)"
+		}
+	}
+	if reason == "" {
+		return false, nil
+	}
+
+	item.mu.Lock()
+	defer item.mu.Unlock()
+	// Leave the item alone if it was used while being checked
+	if item.opens != 0 || item.info.Dirty || item.info.Fingerprint != fingerprint || !item.info.ModTime.Equal(modTime) {
+		return false, nil
+	}
+	fs.Errorf(item.name, "vfs cache verify: cached file is %s - removing it", reason)
+	item._remove(reason)
+	return true, nil
+}
+
 // WrittenBack checks to see if the item has been written back or not
 func (item *Item) WrittenBack() bool {
 	item.mu.Lock()
@@ -29,6 +29,7 @@ type Options struct {
 	CacheMaxSize       fs.SizeSuffix
 	CacheMinFreeSpace  fs.SizeSuffix
 	CachePollInterval  time.Duration
+	VerifyInterval     time.Duration // how often to check a sample of the cached files against the remote
 	CaseInsensitive    bool
 	BlockNormDupes     bool
 	WriteWait          time.Duration // time to wait for in-sequence write